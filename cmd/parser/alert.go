@@ -0,0 +1,468 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Version of -alert-state file
+const alertStateVersion = 1
+
+// Alert rule like "error_rate > 5%" or "p95 > 500ms".
+// Options after the threshold protect from firing on too little data:
+// "min_samples=100" requires that many records, "warmup=5m" requires
+// records to cover that much time.
+type AlertRule struct {
+	Expr       string
+	Metric     string
+	Op         string
+	Threshold  float64
+	MinSamples int
+	Warmup     time.Duration
+
+	// Prefix of dedup key (-alert-dedup-prefix), "ginlog" when empty
+	DedupPrefix string
+}
+
+// Evaluated alert rule
+type Alert struct {
+	Rule     AlertRule
+	Value    float64
+	Firing   bool
+	Pending  bool
+	DedupKey string
+	Labels   map[string]string
+}
+
+// Alert destination
+type Notifier interface {
+	Name() string
+	Trigger(alert Alert) error
+	Resolve(alert Alert) error
+
+	// Checking credentials without sending alerts
+	Check() error
+}
+
+var alertRulePattern = regexp.MustCompile(`^\s*([a-z_0-9.]+)\s*(>=|<=|>|<)\s*(\S+)((?:\s+[a-z_]+=\S+)*)\s*$`)
+
+// Parsing alert rule
+func parseAlertRule(expr string) (AlertRule, error) {
+	m := alertRulePattern.FindStringSubmatch(expr)
+	if m == nil {
+		return AlertRule{}, fmt.Errorf("invalid alert rule %q (expected e.g. \"p95 > 500ms\")", expr)
+	}
+
+	rule := AlertRule{Expr: strings.TrimSpace(expr), Metric: m[1], Op: m[2]}
+
+	if _, ok := rule.Value(Metrics{}); !ok {
+		return AlertRule{}, fmt.Errorf("unknown metric %q in alert rule", rule.Metric)
+	}
+
+	threshold, err := parseThreshold(m[3])
+	if err != nil {
+		return AlertRule{}, fmt.Errorf("invalid threshold in alert rule %q: %w", expr, err)
+	}
+	rule.Threshold = threshold
+
+	for _, option := range strings.Fields(m[4]) {
+		key, value, _ := strings.Cut(option, "=")
+
+		switch key {
+		case "min_samples":
+			rule.MinSamples, err = strconv.Atoi(value)
+		case "warmup":
+			rule.Warmup, err = time.ParseDuration(value)
+		default:
+			err = fmt.Errorf("unknown option %q", key)
+		}
+
+		if err != nil {
+			return AlertRule{}, fmt.Errorf("invalid option in alert rule %q: %w", expr, err)
+		}
+	}
+
+	return rule, nil
+}
+
+// Parsing threshold, durations are converted to seconds
+// and percents to ratio
+func parseThreshold(value string) (float64, error) {
+	if strings.HasSuffix(value, "%") {
+		f, err := strconv.ParseFloat(strings.TrimSuffix(value, "%"), 64)
+		return f / 100, err
+	}
+
+	if f, err := strconv.ParseFloat(value, 64); err == nil {
+		return f, nil
+	}
+
+	d, err := parseDuration(value)
+	if err != nil {
+		return 0, err
+	}
+	return d.Seconds(), nil
+}
+
+// Metric value of rule, durations are in seconds
+func (r AlertRule) Value(metrics Metrics) (float64, bool) {
+	switch r.Metric {
+	case "count":
+		return float64(metrics.Count), true
+	case "errors":
+		return float64(metrics.Errors), true
+	case "error_rate":
+		return metrics.ErrorRate, true
+	case "avg":
+		return metrics.AverageTime().Seconds(), true
+	case "min":
+		return metrics.MinTime.Seconds(), true
+	case "max":
+		return metrics.MaxTime.Seconds(), true
+	}
+
+	if strings.HasPrefix(r.Metric, "p") {
+		p, err := strconv.ParseFloat(r.Metric[1:], 64)
+		if err != nil || p <= 0 || p > 100 {
+			return 0, false
+		}
+		for _, percentile := range metrics.Percentiles {
+			if percentile.P == p {
+				return percentile.Value.Seconds(), true
+			}
+		}
+		return 0, true
+	}
+
+	return 0, false
+}
+
+// Percentiles referenced by rules, so metrics can calculate them
+func (r AlertRule) Percentile() (float64, bool) {
+	if !strings.HasPrefix(r.Metric, "p") {
+		return 0, false
+	}
+	p, err := strconv.ParseFloat(r.Metric[1:], 64)
+	return p, err == nil
+}
+
+// Evaluating rule against metrics.
+// Rule without enough samples or time coverage is pending, it is
+// neither triggered nor resolved.
+func (r AlertRule) Evaluate(metrics Metrics) Alert {
+	value, _ := r.Value(metrics)
+
+	pending := metrics.Count < r.MinSamples ||
+		r.Warmup > 0 && metrics.End.Sub(metrics.Start) < r.Warmup
+
+	var firing bool
+	switch r.Op {
+	case ">":
+		firing = value > r.Threshold
+	case ">=":
+		firing = value >= r.Threshold
+	case "<":
+		firing = value < r.Threshold
+	case "<=":
+		firing = value <= r.Threshold
+	}
+
+	prefix := r.DedupPrefix
+	if prefix == "" {
+		prefix = "ginlog"
+	}
+
+	return Alert{
+		Rule:     r,
+		Value:    value,
+		Firing:   firing && !pending,
+		Pending:  pending,
+		DedupKey: prefix + "/" + strings.ReplaceAll(r.Expr, " ", ""),
+		Labels: map[string]string{
+			"alertname": r.Expr,
+			"metric":    r.Metric,
+			"host":      hostname(),
+		},
+	}
+}
+
+// Alert summary line
+func (a Alert) Summary() string {
+	return fmt.Sprintf("ginlog: %s (current %s)", a.Rule.Expr, strconv.FormatFloat(a.Value, 'g', 4, 64))
+}
+
+// Alerts firing at earlier evaluations by dedup key, so alerts are
+// resolved only when they stop firing. It's kept in memory by one
+// process and in -alert-state file between runs.
+type AlertState struct {
+	firing map[string]bool
+}
+
+// File of -alert-state, dedup keys of firing alerts
+type alertStateFile struct {
+	Version   int      `json:"version"`
+	WrittenBy string   `json:"written_by,omitempty"`
+	Firing    []string `json:"firing"`
+}
+
+func NewAlertState() *AlertState {
+	return &AlertState{firing: make(map[string]bool)}
+}
+
+// Reading firing alerts of state file, missing file is first run
+func (s *AlertState) Load(path string) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var state alertStateFile
+	if err := json.Unmarshal(data, &state); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	if state.Version != alertStateVersion {
+		return incompatibleState(path, "alert state", state.Version, alertStateVersion, state.WrittenBy, "move it away and resolve alerts fired by earlier runs by hand")
+	}
+	for _, key := range state.Firing {
+		s.firing[key] = true
+	}
+	return nil
+}
+
+// Writing firing alerts to state file, replaced only when written
+// completely
+func (s *AlertState) Save(path string, dryRun *DryRun) error {
+	state := alertStateFile{Version: alertStateVersion, WrittenBy: currentBuild().String(), Firing: slices.Sorted(maps.Keys(s.firing))}
+	if state.Firing == nil {
+		state.Firing = []string{}
+	}
+
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	if dryRun != nil {
+		dryRun.File(path, "alerts", false).Add(len(state.Firing), int64(len(data)+1))
+		return nil
+	}
+
+	out, err := createAtomic(path, false)
+	if err != nil {
+		return err
+	}
+	if _, err := out.File().Write(append(data, '\n')); err != nil {
+		out.Abort()
+		return err
+	}
+	return out.Commit()
+}
+
+// Evaluating rules and notifying destinations.
+// Firing alerts are triggered, alerts firing at earlier evaluation of
+// state are resolved when they stop firing, others aren't sent. Dedup
+// keys are stable per rule and prefix, so repeated runs update the same
+// incident. Alerts matched by an active silence are not sent at all but
+// noted in issues, they are resolved after silence when they stopped
+// firing.
+func runAlerts(rules []AlertRule, metrics Metrics, notifiers []Notifier, silences []Silence, state *AlertState, issues *Issues, now time.Time) []error {
+	var errs []error
+
+	for _, rule := range rules {
+		alert := rule.Evaluate(metrics)
+		if alert.Pending {
+			continue
+		}
+		if !alert.Firing && !state.firing[alert.DedupKey] {
+			continue
+		}
+
+		if silence, ok := findSilence(silences, alert, now); ok {
+			if alert.Firing {
+				issues.Add(issueSilenced, strings.TrimSpace(fmt.Sprintf("%s until %s %s",
+					alert.Summary(), silence.End.Format(time.DateTime), silence.Comment)))
+			}
+			continue
+		}
+
+		// Failed resolve is sent again at next evaluation
+		sent := true
+		for _, notifier := range notifiers {
+			var err error
+			if alert.Firing {
+				err = notifier.Trigger(alert)
+			} else {
+				err = notifier.Resolve(alert)
+			}
+
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", notifier.Name(), err))
+				sent = false
+			}
+		}
+		if alert.Firing {
+			state.firing[alert.DedupKey] = true
+		} else if sent {
+			delete(state.firing, alert.DedupKey)
+		}
+	}
+
+	return errs
+}
+
+var alertClient = &http.Client{Timeout: 10 * time.Second}
+
+// Sending JSON request to alert API
+func postAlertJSON(endpoint string, headers map[string]string, body any) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := alertClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+// PagerDuty Events API v2 destination
+type PagerDuty struct {
+	RoutingKey string
+	Endpoint   string
+}
+
+func (p PagerDuty) Name() string {
+	return "pagerduty"
+}
+
+func (p PagerDuty) Trigger(alert Alert) error {
+	return p.send("trigger", alert)
+}
+
+func (p PagerDuty) Resolve(alert Alert) error {
+	return p.send("resolve", alert)
+}
+
+// Events API has no way to check routing key without sending an event,
+// only key format is checked
+func (p PagerDuty) Check() error {
+	if len(p.RoutingKey) != 32 {
+		return fmt.Errorf("routing key should be 32 characters")
+	}
+	return nil
+}
+
+func (p PagerDuty) send(action string, alert Alert) error {
+	endpoint := p.Endpoint
+	if endpoint == "" {
+		endpoint = "https://events.pagerduty.com/v2/enqueue"
+	}
+
+	event := map[string]any{
+		"routing_key":  p.RoutingKey,
+		"event_action": action,
+		"dedup_key":    alert.DedupKey,
+	}
+	if action == "trigger" {
+		event["payload"] = map[string]any{
+			"summary":  alert.Summary(),
+			"source":   hostname(),
+			"severity": "error",
+		}
+	}
+
+	return postAlertJSON(endpoint, nil, event)
+}
+
+// Opsgenie Alert API destination
+type Opsgenie struct {
+	APIKey   string
+	Endpoint string
+}
+
+func (o Opsgenie) Name() string {
+	return "opsgenie"
+}
+
+func (o Opsgenie) Trigger(alert Alert) error {
+	return postAlertJSON(o.endpoint(), o.headers(), map[string]any{
+		"message":     alert.Summary(),
+		"alias":       alert.DedupKey,
+		"source":      hostname(),
+		"priority":    "P2",
+		"description": "Alert rule " + alert.Rule.Expr + " is violated",
+	})
+}
+
+func (o Opsgenie) Resolve(alert Alert) error {
+	endpoint := o.endpoint() + "/" + url.PathEscape(alert.DedupKey) + "/close?identifierType=alias"
+	return postAlertJSON(endpoint, o.headers(), map[string]any{
+		"source": hostname(),
+		"note":   "Recovered, current " + strconv.FormatFloat(alert.Value, 'g', 4, 64),
+	})
+}
+
+// Listing one alert checks API key
+func (o Opsgenie) Check() error {
+	req, err := http.NewRequest(http.MethodGet, o.endpoint()+"?limit=1", nil)
+	if err != nil {
+		return err
+	}
+	for k, v := range o.headers() {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := alertClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized:
+		return fmt.Errorf("invalid API key")
+	case resp.StatusCode >= 300 && resp.StatusCode != http.StatusForbidden:
+		// Forbidden is a valid key without read access
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+func (o Opsgenie) endpoint() string {
+	if o.Endpoint != "" {
+		return o.Endpoint
+	}
+	return "https://api.opsgenie.com/v2/alerts"
+}
+
+func (o Opsgenie) headers() map[string]string {
+	return map[string]string{"Authorization": "GenieKey " + o.APIKey}
+}
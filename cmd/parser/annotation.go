@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// Timeout of fetching annotations from URL
+const annotationsTimeout = 10 * time.Second
+
+// Environment event (deploy, feature flag flip) shown in time based reports
+type Annotation struct {
+	Time  time.Time
+	Label string
+}
+
+// Loading annotations from JSON file or http(s) URL.
+// Input is an array like [{"time": "2024-05-01T10:30:00Z", "label": "deploy v1.2"}],
+// time accepts the same formats as -from.
+func loadAnnotations(source string, now time.Time) ([]Annotation, error) {
+	data, err := readSource(source)
+	if err != nil {
+		return nil, err
+	}
+
+	var decoded []struct {
+		Time  string `json:"time"`
+		Label string `json:"label"`
+	}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return nil, fmt.Errorf("%s: %w", source, err)
+	}
+
+	annotations := make([]Annotation, 0, len(decoded))
+	for i, a := range decoded {
+		t, err := parseTimestamp(a.Time, now)
+		if err != nil {
+			return nil, fmt.Errorf("%s: annotation %d: %w", source, i+1, err)
+		}
+		annotations = append(annotations, Annotation{Time: t, Label: a.Label})
+	}
+
+	return annotations, nil
+}
+
+// Reading file or http(s) URL
+func readSource(source string) ([]byte, error) {
+	if !strings.HasPrefix(source, "http://") && !strings.HasPrefix(source, "https://") {
+		return os.ReadFile(source)
+	}
+
+	client := http.Client{Timeout: annotationsTimeout}
+	resp, err := client.Get(source)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", source, resp.Status)
+	}
+
+	return io.ReadAll(resp.Body)
+}
+
+// Labels of annotations in time window
+func annotationsBetween(annotations []Annotation, start, end time.Time) []string {
+	var labels []string
+	for _, a := range annotations {
+		if !a.Time.Before(start) && a.Time.Before(end) {
+			labels = append(labels, a.Label)
+		}
+	}
+	return labels
+}
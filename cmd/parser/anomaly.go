@@ -0,0 +1,300 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Intervals with fewer requests are not checked, as a single
+// error or slow request would make them anomalies
+const anomalyMinRequests = 10
+
+// Baseline needs this many checked intervals
+const anomalyMinBaseline = 3
+
+// Number of contributing routes of anomaly
+const anomalyTopRoutes = 3
+
+// Settings of anomaly detection
+type AnomalyConfig struct {
+	Interval time.Duration
+
+	// Number of previous intervals forming baseline, and number of
+	// standard deviations above baseline mean which is an anomaly
+	Window int
+	Sigma  float64
+
+	// Fixed thresholds used instead of baseline, zero disables
+	ErrorRate float64
+	P95       time.Duration
+}
+
+// Route contributing to anomaly, excess of errors (error_rate) or
+// of total time in seconds (p95) over its baseline average
+type AnomalyRoute struct {
+	Route  string  `json:"route"`
+	Excess float64 `json:"excess"`
+}
+
+// Interval with error rate or p95 above baseline or threshold.
+// Latencies are in seconds.
+type Anomaly struct {
+	Start     time.Time      `json:"start"`
+	End       time.Time      `json:"end"`
+	Metric    string         `json:"metric"`
+	Value     float64        `json:"value"`
+	Baseline  float64        `json:"baseline"`
+	Threshold float64        `json:"threshold"`
+	Requests  int            `json:"requests"`
+	Routes    []AnomalyRoute `json:"routes"`
+}
+
+// Requests of route in one interval
+type anomalyRoute struct {
+	count, errors int
+	totalTime     time.Duration
+}
+
+// Requests of one interval
+type anomalyBucket struct {
+	count, errors int
+	quantiles     Quantiles
+	routes        map[string]*anomalyRoute
+}
+
+func (b *anomalyBucket) errorRate() float64 {
+	return float64(b.errors) / float64(b.count)
+}
+
+func (b *anomalyBucket) p95() float64 {
+	return b.quantiles.Quantile(95).Seconds()
+}
+
+// Error rate and p95 latency per interval, compared with
+// previous intervals once all records are read
+type Anomalies struct {
+	config  AnomalyConfig
+	now     time.Time
+	buckets map[time.Time]*anomalyBucket
+}
+
+func NewAnomalies(config AnomalyConfig, now time.Time) *Anomalies {
+	return &Anomalies{config: config, now: now, buckets: make(map[time.Time]*anomalyBucket)}
+}
+
+// Checking anomaly settings
+func validAnomalies(config AnomalyConfig) error {
+	switch {
+	case config.Interval <= 0:
+		return fmt.Errorf("interval must be positive")
+	case config.Window < anomalyMinBaseline:
+		return fmt.Errorf("-anomaly-window must be at least %d intervals", anomalyMinBaseline)
+	case config.Sigma <= 0:
+		return fmt.Errorf("-anomaly-sigma must be positive")
+	case config.ErrorRate < 0 || config.ErrorRate > 1:
+		return fmt.Errorf("-anomaly-error-rate must be between 0 and 1")
+	case config.P95 < 0:
+		return fmt.Errorf("-anomaly-p95 can't be negative")
+	}
+	return nil
+}
+
+// Adding record to its interval, records with implausible
+// timestamps are skipped
+func (a *Anomalies) Add(record LogRecord) {
+	if !plausibleTimestamp(record.Date, a.now) {
+		return
+	}
+
+	start := record.Date.Truncate(a.config.Interval)
+	bucket, ok := a.buckets[start]
+	if !ok {
+		bucket = &anomalyBucket{routes: make(map[string]*anomalyRoute)}
+		a.buckets[start] = bucket
+	}
+
+	key := groupKey(record, "url")
+	route, ok := bucket.routes[key]
+	if !ok {
+		route = &anomalyRoute{}
+		bucket.routes[key] = route
+	}
+
+	bucket.count++
+	bucket.quantiles.Add(record.Duration)
+	route.count++
+	route.totalTime += record.Duration
+	if isError(record.Code) {
+		bucket.errors++
+		route.errors++
+	}
+}
+
+// Anomalies in time order, error rate before p95 of same interval
+func (a *Anomalies) Anomalies() []Anomaly {
+	starts := make([]time.Time, 0, len(a.buckets))
+	for start := range a.buckets {
+		starts = append(starts, start)
+	}
+	slices.SortFunc(starts, func(a, b time.Time) int { return a.Compare(b) })
+
+	anomalies := []Anomaly{}
+	for _, start := range starts {
+		bucket := a.buckets[start]
+		if bucket.count < anomalyMinRequests {
+			continue
+		}
+
+		// Checked intervals of window before this one, empty
+		// intervals are part of window but not of baseline
+		var baseline []*anomalyBucket
+		for i := 1; i <= a.config.Window; i++ {
+			previous, ok := a.buckets[start.Add(-time.Duration(i)*a.config.Interval)]
+			if ok && previous.count >= anomalyMinRequests {
+				baseline = append(baseline, previous)
+			}
+		}
+
+		check := func(metric string, value func(b *anomalyBucket) float64, fixed float64, excess func(r *anomalyRoute) float64) {
+			mean, threshold := 0.0, fixed
+			if len(baseline) > 0 {
+				values := make([]float64, len(baseline))
+				for i, b := range baseline {
+					values[i] = value(b)
+				}
+				var std float64
+				mean, std = meanStd(values)
+				if fixed == 0 {
+					threshold = mean + a.config.Sigma*std
+				}
+			}
+
+			if fixed == 0 && len(baseline) < anomalyMinBaseline {
+				return
+			}
+			v := value(bucket)
+			if v <= threshold || fixed == 0 && v <= mean {
+				return
+			}
+
+			anomalies = append(anomalies, Anomaly{
+				Start:     start,
+				End:       start.Add(a.config.Interval),
+				Metric:    metric,
+				Value:     v,
+				Baseline:  mean,
+				Threshold: threshold,
+				Requests:  bucket.count,
+				Routes:    topAnomalyRoutes(bucket, baseline, excess),
+			})
+		}
+
+		check("error_rate", (*anomalyBucket).errorRate, a.config.ErrorRate, func(r *anomalyRoute) float64 {
+			return float64(r.errors)
+		})
+		check("p95", (*anomalyBucket).p95, a.config.P95.Seconds(), func(r *anomalyRoute) float64 {
+			return r.totalTime.Seconds()
+		})
+	}
+
+	return anomalies
+}
+
+// Mean and standard deviation of values
+func meanStd(values []float64) (float64, float64) {
+	var sum, sumSq float64
+	for _, v := range values {
+		sum += v
+		sumSq += v * v
+	}
+
+	mean := sum / float64(len(values))
+	return mean, math.Sqrt(max(sumSq/float64(len(values))-mean*mean, 0))
+}
+
+// Routes with largest excess over their average of baseline intervals
+func topAnomalyRoutes(bucket *anomalyBucket, baseline []*anomalyBucket, value func(r *anomalyRoute) float64) []AnomalyRoute {
+	routes := []AnomalyRoute{}
+	for key, route := range bucket.routes {
+		var sum float64
+		for _, b := range baseline {
+			if r, ok := b.routes[key]; ok {
+				sum += value(r)
+			}
+		}
+
+		excess := value(route)
+		if len(baseline) > 0 {
+			excess -= sum / float64(len(baseline))
+		}
+		if excess > 0 {
+			routes = append(routes, AnomalyRoute{Route: key, Excess: excess})
+		}
+	}
+
+	slices.SortFunc(routes, func(a, b AnomalyRoute) int {
+		if a.Excess != b.Excess {
+			if a.Excess > b.Excess {
+				return -1
+			}
+			return 1
+		}
+		return strings.Compare(a.Route, b.Route)
+	})
+	return routes[:min(len(routes), anomalyTopRoutes)]
+}
+
+// Anomalies output
+func printAnomalies(anomalies []Anomaly, config AnomalyConfig, locale Locale) {
+	fmt.Printf("Anomalies of %v intervals (baseline of %d previous intervals, %s sigma", config.Interval, config.Window, locale.Float(config.Sigma, 1))
+	if config.ErrorRate > 0 {
+		fmt.Printf(", error rate above %s", locale.Percent(config.ErrorRate))
+	}
+	if config.P95 > 0 {
+		fmt.Printf(", p95 above %s", locale.Duration(config.P95))
+	}
+	fmt.Printf("):\n\n")
+
+	if len(anomalies) == 0 {
+		fmt.Println("No anomalies found")
+		return
+	}
+
+	w := newTable(os.Stdout)
+	defer w.Flush()
+
+	seconds := func(v float64) string {
+		return locale.Duration(time.Duration(math.Round(v * float64(time.Second))))
+	}
+
+	fmt.Fprintf(w, "TIME\tMETRIC\tVALUE\tBASELINE\tTHRESHOLD\tREQUESTS\tTOP ROUTES\n")
+	for _, a := range anomalies {
+		format := seconds
+		excess := func(v float64) string {
+			return "+" + locale.Duration(time.Duration(v*float64(time.Second)).Round(time.Millisecond))
+		}
+		if a.Metric == "error_rate" {
+			format = locale.Percent
+			excess = func(v float64) string { return "+" + locale.Float(v, 1) + " errors" }
+		}
+
+		var routes []string
+		for _, r := range a.Routes {
+			routes = append(routes, fmt.Sprintf("%s (%s)", r.Route, excess(r.Excess)))
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			locale.FormatDateTime(a.Start),
+			a.Metric,
+			format(a.Value),
+			format(a.Baseline),
+			format(a.Threshold),
+			locale.Int(a.Requests),
+			strings.Join(routes, ", "),
+		)
+	}
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Records returned by /records at most
+const maxAPIRecords = 10000
+
+// In-memory index of records read by serve command, oldest records
+// are dropped when it holds retain of them
+type RecordIndex struct {
+	mu      sync.RWMutex
+	records []LogRecord
+	next    int
+	retain  int
+
+	// Records of mapped binary record files, nothing is retained
+	mapped recordSet
+}
+
+func NewRecordIndex(retain int) *RecordIndex {
+	return &RecordIndex{retain: retain}
+}
+
+// Index over records mapped from binary record files, all of them are
+// queried without being kept in memory
+func NewMappedRecordIndex(records recordSet) *RecordIndex {
+	return &RecordIndex{mapped: records}
+}
+
+func (x *RecordIndex) Add(record LogRecord) {
+	if x.mapped != nil {
+		return
+	}
+
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	if len(x.records) < x.retain {
+		x.records = append(x.records, record)
+		return
+	}
+	x.records[x.next] = record
+	x.next = (x.next + 1) % x.retain
+}
+
+// Calling fn with records from newest to oldest until it returns false,
+// mapped records are newest at end of files
+func (x *RecordIndex) Newest(fn func(record LogRecord) bool) {
+	if x.mapped != nil {
+		for i := x.mapped.Len() - 1; i >= 0; i-- {
+			if !fn(x.mapped.Record(i)) {
+				return
+			}
+		}
+		return
+	}
+
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+
+	n := len(x.records)
+	for i := range n {
+		if !fn(x.records[(x.next-1-i+2*n)%n]) {
+			return
+		}
+	}
+}
+
+// Registering REST endpoints over index:
+//
+//	GET /records             matching records, newest first (limit, offset)
+//	GET /metrics/summary     metrics of matching records
+//	GET /metrics/timeseries  requests, errors and average time per interval
+//
+// All of them take filter query params named like filter flags with
+// underscores (code=5xx, min_duration=1s, url_prefix=/api, from=-1h)
+// and route, which matches routes of -routes and -normalize too.
+func (x *RecordIndex) Register(mux *http.ServeMux, percentiles []float64) {
+	mux.HandleFunc("GET /records", func(w http.ResponseWriter, r *http.Request) {
+		match, err := apiFilter(r.URL.Query())
+		if err != nil {
+			writeAPIError(w, err)
+			return
+		}
+		limit, err := apiInt(r.URL.Query(), "limit", 100, maxAPIRecords)
+		if err != nil {
+			writeAPIError(w, err)
+			return
+		}
+		offset, err := apiInt(r.URL.Query(), "offset", 0, -1)
+		if err != nil {
+			writeAPIError(w, err)
+			return
+		}
+
+		response := struct {
+			Total   int         `json:"total"`
+			Records []LogRecord `json:"records"`
+		}{Records: []LogRecord{}}
+		x.Newest(func(record LogRecord) bool {
+			if match(record) {
+				if response.Total >= offset && len(response.Records) < limit {
+					response.Records = append(response.Records, record)
+				}
+				response.Total++
+			}
+			return true
+		})
+		writeAPIJSON(w, response)
+	})
+
+	mux.HandleFunc("GET /metrics/summary", func(w http.ResponseWriter, r *http.Request) {
+		match, err := apiFilter(r.URL.Query())
+		if err != nil {
+			writeAPIError(w, err)
+			return
+		}
+
+		metrics := NewMetricsAccumulator(time.Now(), percentiles)
+		x.Newest(func(record LogRecord) bool {
+			if match(record) {
+				metrics.Add(record)
+			}
+			return true
+		})
+		writeAPIJSON(w, metrics.Metrics())
+	})
+
+	mux.HandleFunc("GET /metrics/timeseries", func(w http.ResponseWriter, r *http.Request) {
+		match, err := apiFilter(r.URL.Query())
+		if err != nil {
+			writeAPIError(w, err)
+			return
+		}
+		interval := time.Minute
+		if value := r.URL.Query().Get("interval"); value != "" {
+			if interval, err = time.ParseDuration(value); err != nil || interval <= 0 {
+				writeAPIError(w, fmt.Errorf("invalid interval %q", value))
+				return
+			}
+		}
+
+		series := NewTimeSeries(interval, time.Now(), nil)
+		x.Newest(func(record LogRecord) bool {
+			if match(record) {
+				series.Add(record)
+			}
+			return true
+		})
+		buckets, err := series.Buckets()
+		if err != nil {
+			writeAPIError(w, err)
+			return
+		}
+		if buckets == nil {
+			buckets = []TimeBucket{}
+		}
+		writeAPIJSON(w, buckets)
+	})
+}
+
+// Matcher of filter query params
+func apiFilter(query url.Values) (func(record LogRecord) bool, error) {
+	filter := Filter{
+		Method:      query.Get("method"),
+		Code:        query.Get("code"),
+		Class:       query.Get("class"),
+		Date:        query.Get("date"),
+		URL:         query.Get("url"),
+		URLPrefix:   query.Get("url_prefix"),
+		URLRegex:    query.Get("url_regex"),
+		IP:          query.Get("ip"),
+		Param:       query.Get("param"),
+		MinDuration: query.Get("min_duration"),
+		MaxDuration: query.Get("max_duration"),
+		Where:       query.Get("where"),
+	}
+	if err := filter.SetRange(query.Get("from"), query.Get("to"), time.Now()); err != nil {
+		return nil, apiParamError(err)
+	}
+	if err := filter.Compile(); err != nil {
+		return nil, apiParamError(err)
+	}
+
+	route := query.Get("route")
+	return func(record LogRecord) bool {
+		return (route == "" || normalizedRoute(record) == route) && matchesFilter(record, filter)
+	}, nil
+}
+
+// Error of filter with query param instead of flag, -min-duration
+// is min_duration
+func apiParamError(err error) error {
+	name, message, ok := strings.Cut(err.Error(), ": ")
+	if !ok || !strings.HasPrefix(name, "-") {
+		return err
+	}
+	return fmt.Errorf("%s: %s", strings.ReplaceAll(name[1:], "-", "_"), message)
+}
+
+// Integer query param with default, above limit is error unless
+// limit is negative
+func apiInt(query url.Values, name string, value, limit int) (int, error) {
+	if s := query.Get(name); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 || (limit >= 0 && n > limit) {
+			return 0, fmt.Errorf("invalid %s %q", name, s)
+		}
+		value = n
+	}
+	return value, nil
+}
+
+func writeAPIJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing response: %v\n", err)
+	}
+}
+
+// Bad request with error as JSON, errors of API come from query params
+func writeAPIError(w http.ResponseWriter, err error) {
+	writeAPIStatus(w, http.StatusBadRequest, err)
+}
+
+// Internal error with error as JSON, like failed write of state file
+func writeAPIServerError(w http.ResponseWriter, err error) {
+	fmt.Fprintf(os.Stderr, "Error %v\n", err)
+	writeAPIStatus(w, http.StatusInternalServerError, err)
+}
+
+func writeAPIStatus(w http.ResponseWriter, status int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,409 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/pbkdf2"
+	"crypto/sha1"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"os"
+	"path"
+	"strings"
+)
+
+// Reader of archive members matching glob, members are read one
+// after another like concatenated files
+type archiveReader struct {
+	concatReader
+	file *os.File
+}
+
+// Opening zip, tar or tar.gz archive.
+// Pattern is matched against member name, or base name when it has no slash.
+// Members ending with .gz are decompressed.
+func openArchive(name, pattern, password string) (*archiveReader, error) {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, fmt.Errorf("bad member pattern: %w", err)
+	}
+
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &archiveReader{file: file}
+
+	lower := strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(lower, ".zip"):
+		err = r.openZip(pattern, password)
+	case strings.HasSuffix(lower, ".tar.gz") || strings.HasSuffix(lower, ".tgz"):
+		var gz *gzip.Reader
+		if gz, err = gzip.NewReader(bufio.NewReader(file)); err == nil {
+			r.openTar(gz, pattern)
+		}
+	case strings.HasSuffix(lower, ".tar"):
+		r.openTar(file, pattern)
+	default:
+		err = fmt.Errorf("unknown archive type (supported: .zip, .tar, .tar.gz, .tgz)")
+	}
+
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return r, nil
+}
+
+// Checking is member name matching pattern
+func matchMember(pattern, name string) bool {
+	if !strings.Contains(pattern, "/") {
+		name = path.Base(name)
+	}
+	ok, _ := path.Match(pattern, name)
+	return ok
+}
+
+func (r *archiveReader) openZip(pattern, password string) error {
+	info, err := r.file.Stat()
+	if err != nil {
+		return err
+	}
+
+	zr, err := zip.NewReader(r.file, info.Size())
+	if err != nil {
+		return err
+	}
+
+	members := zr.File
+	r.next = func() (io.Reader, error) {
+		for len(members) > 0 {
+			f := members[0]
+			members = members[1:]
+
+			if f.FileInfo().IsDir() || !matchMember(pattern, f.Name) {
+				continue
+			}
+
+			member, err := openZipMember(f, password)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", f.Name, err)
+			}
+			return decompressMember(f.Name, member)
+		}
+		return nil, io.EOF
+	}
+	return nil
+}
+
+func (r *archiveReader) openTar(input io.Reader, pattern string) {
+	tr := tar.NewReader(input)
+
+	r.next = func() (io.Reader, error) {
+		for {
+			header, err := tr.Next()
+			if err != nil {
+				return nil, err
+			}
+
+			if header.Typeflag != tar.TypeReg || !matchMember(pattern, header.Name) {
+				continue
+			}
+			return decompressMember(header.Name, tr)
+		}
+	}
+}
+
+// Decompressing gzipped member
+func decompressMember(name string, member io.Reader) (io.Reader, error) {
+	if !strings.HasSuffix(strings.ToLower(name), ".gz") {
+		return member, nil
+	}
+
+	gz, err := gzip.NewReader(member)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return gz, nil
+}
+
+func (r *archiveReader) Close() error {
+	return r.file.Close()
+}
+
+// Zip member flags and methods
+const (
+	zipEncrypted      = 0x1
+	zipDataDescriptor = 0x8
+	zipMethodAES      = 99
+	zipExtraAES       = 0x9901
+)
+
+// Opening zip member, encrypted ones are decrypted with password
+// (traditional PKWARE encryption and WinZip AES)
+func openZipMember(f *zip.File, password string) (io.Reader, error) {
+	if f.Flags&zipEncrypted == 0 {
+		return f.Open()
+	}
+
+	if password == "" {
+		return nil, fmt.Errorf("member is encrypted, use -archive-password")
+	}
+
+	raw, err := f.OpenRaw()
+	if err != nil {
+		return nil, err
+	}
+
+	if f.Method == zipMethodAES {
+		method, data, err := decryptAES(f, raw, password)
+		if err != nil {
+			return nil, err
+		}
+		return decompressZip(method, data)
+	}
+
+	data, err := decryptZipCrypto(f, raw, password)
+	if err != nil {
+		return nil, err
+	}
+	member, err := decompressZip(f.Method, data)
+	if err != nil {
+		return nil, err
+	}
+	return &crcReader{r: member, want: f.CRC32}, nil
+}
+
+// Decompressing zip member data
+func decompressZip(method uint16, data io.Reader) (io.Reader, error) {
+	switch method {
+	case zip.Store:
+		return data, nil
+	case zip.Deflate:
+		return drainReader{r: flate.NewReader(data), rest: data}, nil
+	}
+	return nil, fmt.Errorf("unsupported compression method %d", method)
+}
+
+// Reader checking CRC-32 of member at its end. Check byte of
+// traditional encryption lets 1 of 256 wrong passwords through, their
+// data is garbage which fails CRC.
+type crcReader struct {
+	r    io.Reader
+	crc  uint32
+	want uint32
+}
+
+func (r *crcReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.crc = crc32.Update(r.crc, crc32.IEEETable, p[:n])
+	if err == io.EOF && r.crc != r.want {
+		return n, errArchivePassword
+	}
+	return n, err
+}
+
+// Reader reading rest of underlying data at end, so AES authentication
+// code is checked even if decompressor stops before end of data
+type drainReader struct {
+	r    io.Reader
+	rest io.Reader
+}
+
+func (r drainReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if err == io.EOF {
+		if _, err := io.Copy(io.Discard, r.rest); err != nil {
+			return n, err
+		}
+	}
+	return n, err
+}
+
+// Wrong archive password
+var errArchivePassword = errors.New("wrong archive password")
+
+// Traditional PKWARE encryption keys
+type zipCryptoKeys [3]uint32
+
+func newZipCryptoKeys(password string) *zipCryptoKeys {
+	k := &zipCryptoKeys{0x12345678, 0x23456789, 0x34567890}
+	for i := 0; i < len(password); i++ {
+		k.update(password[i])
+	}
+	return k
+}
+
+func (k *zipCryptoKeys) update(b byte) {
+	k[0] = crc32Byte(k[0], b)
+	k[1] = (k[1]+k[0]&0xff)*134775813 + 1
+	k[2] = crc32Byte(k[2], byte(k[1]>>24))
+}
+
+func (k *zipCryptoKeys) decrypt(b byte) byte {
+	temp := uint16(k[2] | 2)
+	b ^= byte((temp * (temp ^ 1)) >> 8)
+	k.update(b)
+	return b
+}
+
+func crc32Byte(crc uint32, b byte) uint32 {
+	return crc32.IEEETable[byte(crc)^b] ^ crc>>8
+}
+
+// Reader decrypting traditional PKWARE encrypted data
+type zipCryptoReader struct {
+	r    io.Reader
+	keys *zipCryptoKeys
+}
+
+func (r zipCryptoReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	for i := range p[:n] {
+		p[i] = r.keys.decrypt(p[i])
+	}
+	return n, err
+}
+
+func decryptZipCrypto(f *zip.File, raw io.Reader, password string) (io.Reader, error) {
+	keys := newZipCryptoKeys(password)
+
+	header := make([]byte, 12)
+	if _, err := io.ReadFull(raw, header); err != nil {
+		return nil, err
+	}
+	for i := range header {
+		header[i] = keys.decrypt(header[i])
+	}
+
+	// Last header byte is check byte of password
+	check := byte(f.CRC32 >> 24)
+	if f.Flags&zipDataDescriptor != 0 {
+		check = byte(f.ModifiedTime >> 8)
+	}
+	if header[11] != check {
+		return nil, errArchivePassword
+	}
+
+	return zipCryptoReader{r: raw, keys: keys}, nil
+}
+
+// Decrypting WinZip AES member, returns actual compression method.
+// Authentication code is checked when data is read to the end.
+func decryptAES(f *zip.File, raw io.Reader, password string) (uint16, io.Reader, error) {
+	strength, method, err := aesExtra(f.Extra)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	keyLen := 8 + 8*int(strength)
+	saltLen := keyLen / 2
+
+	salt := make([]byte, saltLen+2)
+	if _, err := io.ReadFull(raw, salt); err != nil {
+		return 0, nil, err
+	}
+	verifier := salt[saltLen:]
+	salt = salt[:saltLen]
+
+	keys, err := pbkdf2.Key(sha1.New, password, salt, 1000, 2*keyLen+2)
+	if err != nil {
+		return 0, nil, err
+	}
+	if !bytes.Equal(keys[2*keyLen:], verifier) {
+		return 0, nil, errArchivePassword
+	}
+
+	block, err := aes.NewCipher(keys[:keyLen])
+	if err != nil {
+		return 0, nil, err
+	}
+
+	size := int64(f.CompressedSize64) - int64(saltLen) - 2 - 10
+	if size < 0 {
+		return 0, nil, fmt.Errorf("invalid encrypted size")
+	}
+
+	return method, &aesReader{
+		data:  io.LimitReader(raw, size),
+		raw:   raw,
+		block: block,
+		mac:   hmac.New(sha1.New, keys[keyLen:2*keyLen]),
+	}, nil
+}
+
+// Parsing WinZip AES extra field, returns key strength and compression method
+func aesExtra(extra []byte) (byte, uint16, error) {
+	for len(extra) >= 4 {
+		id := binary.LittleEndian.Uint16(extra)
+		size := int(binary.LittleEndian.Uint16(extra[2:]))
+		if len(extra) < 4+size {
+			break
+		}
+
+		field := extra[4 : 4+size]
+		if id == zipExtraAES && size >= 7 {
+			strength := field[4]
+			if strength < 1 || strength > 3 {
+				return 0, 0, fmt.Errorf("unknown AES strength %d", strength)
+			}
+			return strength, binary.LittleEndian.Uint16(field[5:]), nil
+		}
+		extra = extra[4+size:]
+	}
+	return 0, 0, fmt.Errorf("missing AES extra field")
+}
+
+// Reader decrypting WinZip AES data, CTR mode with little-endian counter
+type aesReader struct {
+	data    io.Reader
+	raw     io.Reader
+	block   cipher.Block
+	mac     hash.Hash
+	counter uint64
+	stream  [aes.BlockSize]byte
+	used    int
+	checked bool
+}
+
+func (r *aesReader) Read(p []byte) (int, error) {
+	n, err := r.data.Read(p)
+	r.mac.Write(p[:n])
+
+	for i := range p[:n] {
+		if r.counter == 0 || r.used == aes.BlockSize {
+			r.counter++
+			var ctr [aes.BlockSize]byte
+			binary.LittleEndian.PutUint64(ctr[:], r.counter)
+			r.block.Encrypt(r.stream[:], ctr[:])
+			r.used = 0
+		}
+		p[i] ^= r.stream[r.used]
+		r.used++
+	}
+
+	if err == io.EOF && !r.checked {
+		r.checked = true
+
+		code := make([]byte, 10)
+		if _, err := io.ReadFull(r.raw, code); err != nil {
+			return n, err
+		}
+		if !hmac.Equal(code, r.mac.Sum(nil)[:10]) {
+			return n, fmt.Errorf("authentication of encrypted data failed")
+		}
+	}
+	return n, err
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Encrypting data with traditional PKWARE encryption, header check
+// byte is high byte of CRC
+func encryptZipCrypto(password string, crc uint32, data []byte) []byte {
+	keys := newZipCryptoKeys(password)
+	header := []byte("random hdr\x00\x00")
+	header[11] = byte(crc >> 24)
+
+	out := make([]byte, 0, len(header)+len(data))
+	for _, p := range append(header, data...) {
+		temp := uint16(keys[2] | 2)
+		out = append(out, p^byte((temp*(temp^1))>>8))
+		keys.update(p)
+	}
+	return out
+}
+
+// Writing zip with one encrypted member
+func writeEncryptedZip(t *testing.T, password string, method uint16, content []byte) string {
+	t.Helper()
+
+	data := content
+	if method == zip.Deflate {
+		var b bytes.Buffer
+		w, _ := flate.NewWriter(&b, flate.DefaultCompression)
+		w.Write(content)
+		w.Close()
+		data = b.Bytes()
+	}
+
+	crc := crc32.ChecksumIEEE(content)
+	encrypted := encryptZipCrypto(password, crc, data)
+
+	var b bytes.Buffer
+	zw := zip.NewWriter(&b)
+	w, err := zw.CreateRaw(&zip.FileHeader{
+		Name:               "app.log",
+		Flags:              zipEncrypted,
+		Method:             method,
+		CRC32:              crc,
+		CompressedSize64:   uint64(len(encrypted)),
+		UncompressedSize64: uint64(len(content)),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write(encrypted)
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "logs.zip")
+	if err := os.WriteFile(path, b.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// Opening single member of zip written by writeEncryptedZip
+func openZipFile(t *testing.T, name, password string) (io.Reader, error) {
+	t.Helper()
+	zr, err := zip.OpenReader(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { zr.Close() })
+	return openZipMember(zr.File[0], password)
+}
+
+func ginLine(clock, url string) string {
+	return "[GIN] 2024/05/01 - " + clock + ` | 200 |       1ms |       127.0.0.1 | GET      "` + url + `"` + "\n"
+}
+
+func TestZipCrypto(t *testing.T) {
+	content := bytes.Repeat([]byte(ginLine("10:00:01", "/ping")), 50)
+
+	for _, method := range []uint16{zip.Store, zip.Deflate} {
+		name := writeEncryptedZip(t, "secret", method, content)
+
+		r, err := openArchive(name, "*", "secret")
+		if err != nil {
+			t.Fatalf("method %d: %v", method, err)
+		}
+		got, err := io.ReadAll(r)
+		r.Close()
+		if err != nil {
+			t.Fatalf("method %d: %v", method, err)
+		}
+		if !bytes.Equal(got, append(content, '\n')) {
+			t.Errorf("method %d: decrypted content differs", method)
+		}
+
+		if _, err := openZipFile(t, name, "wrong"); !errors.Is(err, errArchivePassword) {
+			t.Errorf("method %d: wrong password gave %v, want %v", method, err, errArchivePassword)
+		}
+		if _, err := openZipFile(t, name, ""); err == nil {
+			t.Errorf("method %d: encrypted member opened without password", method)
+		}
+	}
+}
+
+// Wrong password passing check byte of header is caught by CRC
+func TestZipCryptoCRC(t *testing.T) {
+	content := bytes.Repeat([]byte(ginLine("10:00:01", "/ping")), 50)
+	name := writeEncryptedZip(t, "secret", zip.Store, content)
+
+	zr, err := zip.OpenReader(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer zr.Close()
+	f := zr.File[0]
+
+	for i := range 10000 {
+		password := fmt.Sprintf("wrong%d", i)
+		member, err := openZipMember(f, password)
+		if errors.Is(err, errArchivePassword) {
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := io.ReadAll(member); !errors.Is(err, errArchivePassword) {
+			t.Errorf("password %q passing check byte read with %v, want %v", password, err, errArchivePassword)
+		}
+		return
+	}
+	t.Fatal("no wrong password passes check byte")
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Periodic traffic needs this many gaps between arrivals
+// with coefficient of variation below arrivalPeriodicCV
+const (
+	arrivalPeriodicGaps = 8
+	arrivalPeriodicCV   = 0.1
+)
+
+// Inter-arrival time statistics of route ("" for all requests)
+type ArrivalStats struct {
+	Route    string        `json:"route,omitempty"`
+	Requests int           `json:"requests"`
+	Mean     time.Duration `json:"mean"`
+	CV       float64       `json:"cv"`
+	P50      time.Duration `json:"p50"`
+	P95      time.Duration `json:"p95"`
+
+	// Arrivals repeat with steady period (cron-driven clients),
+	// requests of same timestamp count as one arrival
+	Periodic bool          `json:"periodic"`
+	Period   time.Duration `json:"period,omitempty"`
+}
+
+// Running gap statistics of one route
+type arrivalGaps struct {
+	last     time.Time
+	requests int
+
+	// Gaps of all requests
+	n          int
+	sum, sumSq float64
+	quantiles  Quantiles
+
+	// Gaps between distinct timestamps
+	ticks              int
+	tickSum, tickSumSq float64
+}
+
+// Inter-arrival times overall and per route, only gaps are kept.
+// Records out of time order don't make gaps, so concatenated
+// inputs of different hosts give gaps of each input only.
+type Arrivals struct {
+	all    arrivalGaps
+	routes map[string]*arrivalGaps
+	now    time.Time
+}
+
+func NewArrivals(now time.Time) *Arrivals {
+	return &Arrivals{routes: make(map[string]*arrivalGaps), now: now}
+}
+
+// Adding record, records with implausible timestamps are skipped
+func (a *Arrivals) Add(record LogRecord) {
+	if !plausibleTimestamp(record.Date, a.now) {
+		return
+	}
+
+	route := groupKey(record, "url")
+	gaps, ok := a.routes[route]
+	if !ok {
+		gaps = &arrivalGaps{}
+		a.routes[route] = gaps
+	}
+
+	a.all.add(record.Date)
+	gaps.add(record.Date)
+}
+
+func (g *arrivalGaps) add(date time.Time) {
+	g.requests++
+	if g.requests == 1 {
+		g.last = date
+		return
+	}
+	if date.Before(g.last) {
+		return
+	}
+
+	gap := date.Sub(g.last)
+	seconds := gap.Seconds()
+
+	g.n++
+	g.sum += seconds
+	g.sumSq += seconds * seconds
+	g.quantiles.Add(gap)
+
+	if gap > 0 {
+		g.ticks++
+		g.tickSum += seconds
+		g.tickSumSq += seconds * seconds
+	}
+	g.last = date
+}
+
+// Coefficient of variation of n values with sum and sum of squares
+func coefficientOfVariation(n int, sum, sumSq float64) float64 {
+	if n == 0 || sum == 0 {
+		return 0
+	}
+
+	avg := sum / float64(n)
+	variance := max(sumSq/float64(n)-avg*avg, 0)
+	return math.Sqrt(variance) / avg
+}
+
+func (g *arrivalGaps) stats(route string) ArrivalStats {
+	stats := ArrivalStats{Route: route, Requests: g.requests}
+	if g.n == 0 {
+		return stats
+	}
+
+	stats.Mean = time.Duration(g.sum / float64(g.n) * float64(time.Second))
+	stats.CV = coefficientOfVariation(g.n, g.sum, g.sumSq)
+	stats.P50 = g.quantiles.Quantile(50)
+	stats.P95 = g.quantiles.Quantile(95)
+
+	if g.ticks >= arrivalPeriodicGaps && coefficientOfVariation(g.ticks, g.tickSum, g.tickSumSq) < arrivalPeriodicCV {
+		stats.Periodic = true
+		stats.Period = time.Duration(g.tickSum / float64(g.ticks) * float64(time.Second))
+	}
+	return stats
+}
+
+// Statistics of all requests and of routes by request count
+func (a *Arrivals) Stats() (ArrivalStats, []ArrivalStats) {
+	routes := []ArrivalStats{}
+	for route, gaps := range a.routes {
+		routes = append(routes, gaps.stats(route))
+	}
+
+	slices.SortFunc(routes, func(a, b ArrivalStats) int {
+		if a.Requests != b.Requests {
+			return b.Requests - a.Requests
+		}
+		return strings.Compare(a.Route, b.Route)
+	})
+	return a.all.stats(""), routes
+}
+
+// Inter-arrival output
+func printArrivals(all ArrivalStats, routes []ArrivalStats, locale Locale) {
+	fmt.Printf("Inter-arrival times of %s requests: mean %s, CV %s, p50 %s, p95 %s\n\n",
+		locale.Int(all.Requests),
+		locale.Duration(all.Mean),
+		locale.Float(all.CV, 2),
+		locale.Duration(all.P50),
+		locale.Duration(all.P95),
+	)
+
+	w := newTable(os.Stdout)
+	defer w.Flush()
+
+	fmt.Fprintf(w, "ROUTE\tREQUESTS\tMEAN GAP\tCV\tP50 GAP\tP95 GAP\tPERIODIC\n")
+	for _, r := range routes {
+		periodic := "-"
+		if r.Periodic {
+			periodic = "every " + locale.Duration(r.Period)
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			r.Route,
+			locale.Int(r.Requests),
+			locale.Duration(r.Mean),
+			locale.Float(r.CV, 2),
+			locale.Duration(r.P50),
+			locale.Duration(r.P95),
+			periodic,
+		)
+	}
+}
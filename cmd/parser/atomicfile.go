@@ -0,0 +1,76 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Output file written to temp file next to it and renamed over it on
+// Commit, so readers never see partial output when process is killed
+type atomicFile struct {
+	tmp  *os.File
+	path string
+	mode os.FileMode
+}
+
+// Creating temp file for path, with existing contents when appending
+func createAtomic(path string, appending bool) (*atomicFile, error) {
+	mode := os.FileMode(0o644)
+
+	existing, err := os.Open(path)
+	if err == nil {
+		defer existing.Close()
+		if info, err := existing.Stat(); err == nil {
+			mode = info.Mode().Perm()
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return nil, err
+	}
+	f := &atomicFile{tmp: tmp, path: path, mode: mode}
+
+	if appending && existing != nil {
+		if _, err := io.Copy(tmp, existing); err != nil {
+			f.Abort()
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+// File to write output to
+func (f *atomicFile) File() *os.File {
+	return f.tmp
+}
+
+// Replacing target with written temp file
+func (f *atomicFile) Commit() error {
+	if err := f.tmp.Sync(); err != nil {
+		f.Abort()
+		return err
+	}
+	if err := f.tmp.Close(); err != nil {
+		os.Remove(f.tmp.Name())
+		return err
+	}
+	if err := os.Chmod(f.tmp.Name(), f.mode); err != nil {
+		os.Remove(f.tmp.Name())
+		return err
+	}
+	if err := os.Rename(f.tmp.Name(), f.path); err != nil {
+		os.Remove(f.tmp.Name())
+		return err
+	}
+	return nil
+}
+
+// Removing temp file, target is left as it was
+func (f *atomicFile) Abort() {
+	f.tmp.Close()
+	os.Remove(f.tmp.Name())
+}
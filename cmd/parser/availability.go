@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"strconv"
+	"time"
+)
+
+// Row of availability series, availability is share of requests which
+// didn't fail, null in intervals without requests
+type AvailabilityRow struct {
+	Start        time.Time `json:"start"`
+	Requests     int       `json:"requests"`
+	Failed       int       `json:"failed"`
+	Availability *float64  `json:"availability"`
+}
+
+// Availability per interval (export -availability), uptime history of
+// status pages. Requests matching -availability-errors are failures,
+// intervals without requests between first and last one are kept as
+// rows without availability, so gaps in logs aren't shown as uptime.
+type AvailabilitySeries struct {
+	interval time.Duration
+	failed   filterList
+	now      time.Time
+	rows     map[time.Time]*AvailabilityRow
+}
+
+func NewAvailabilitySeries(interval time.Duration, failed filterList, now time.Time) *AvailabilitySeries {
+	return &AvailabilitySeries{interval: interval, failed: failed, now: now, rows: make(map[time.Time]*AvailabilityRow)}
+}
+
+// Adding record to row of its interval, records with implausible
+// timestamps are skipped
+func (s *AvailabilitySeries) Add(record LogRecord) error {
+	if !plausibleTimestamp(record.Date, s.now) {
+		return nil
+	}
+
+	start := record.Date.Truncate(s.interval)
+	row, ok := s.rows[start]
+	if !ok {
+		row = &AvailabilityRow{Start: start}
+		s.rows[start] = row
+	}
+	row.Requests++
+	if s.failed.matches(record) {
+		row.Failed++
+	}
+	return nil
+}
+
+// Rows of every interval from first to last one
+func (s *AvailabilitySeries) Rows() []AvailabilityRow {
+	var first, last time.Time
+	for start := range s.rows {
+		if first.IsZero() || start.Before(first) {
+			first = start
+		}
+		if start.After(last) {
+			last = start
+		}
+	}
+
+	rows := []AvailabilityRow{}
+	if first.IsZero() {
+		return rows
+	}
+	for start := first; !start.After(last); start = start.Add(s.interval) {
+		row := AvailabilityRow{Start: start}
+		if r, ok := s.rows[start]; ok {
+			row = *r
+			availability := 1 - float64(row.Failed)/float64(row.Requests)
+			row.Availability = &availability
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// Writing availability series as CSV (empty availability without
+// requests), JSON array or NDJSON
+func writeAvailability(w io.Writer, rows []AvailabilityRow, format string) error {
+	switch format {
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(rows)
+
+	case "ndjson":
+		enc := json.NewEncoder(w)
+		for _, row := range rows {
+			if err := enc.Encode(row); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"start", "requests", "failed", "availability"})
+	for _, row := range rows {
+		availability := ""
+		if row.Availability != nil {
+			availability = strconv.FormatFloat(*row.Availability, 'f', -1, 64)
+		}
+		cw.Write([]string{row.Start.Format(time.RFC3339), strconv.Itoa(row.Requests), strconv.Itoa(row.Failed), availability})
+	}
+	cw.Flush()
+	return cw.Error()
+}
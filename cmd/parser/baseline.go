@@ -0,0 +1,245 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Version of baseline profile file
+const baselineVersion = 1
+
+// Routes with fewer requests in baseline or current input are not
+// checked, as their percentiles are too noisy
+const baselineMinRequests = 20
+
+// Metrics of route in baseline profile
+type BaselineRoute struct {
+	Route       string       `json:"route"`
+	Count       int          `json:"count"`
+	RPS         float64      `json:"rps"`
+	ErrorRate   float64      `json:"error_rate"`
+	Percentiles []Percentile `json:"percentiles"`
+}
+
+// Baseline profile written by "baseline save", per route metrics
+// current traffic is checked against
+type BaselineProfile struct {
+	Version     int             `json:"version"`
+	WrittenBy   string          `json:"written_by,omitempty"`
+	Created     time.Time       `json:"created"`
+	Percentiles []float64       `json:"percentiles"`
+	Total       BaselineRoute   `json:"total"`
+	Routes      []BaselineRoute `json:"routes"`
+}
+
+// Profile of metrics and per route groups
+func newBaselineProfile(total Metrics, groups []GroupMetrics, percentiles []float64, now time.Time) BaselineProfile {
+	route := func(name string, m Metrics) BaselineRoute {
+		return BaselineRoute{Route: name, Count: m.Count, RPS: m.RPS, ErrorRate: m.ErrorRate, Percentiles: m.Percentiles}
+	}
+
+	profile := BaselineProfile{
+		Version:     baselineVersion,
+		WrittenBy:   currentBuild().String(),
+		Created:     now,
+		Percentiles: percentiles,
+		Total:       route("", total),
+		Routes:      []BaselineRoute{},
+	}
+	for _, group := range groups {
+		profile.Routes = append(profile.Routes, route(group.Key, group.Metrics))
+	}
+	return profile
+}
+
+// Writing profile, file is replaced only when it is written completely
+func saveBaselineProfile(path string, profile BaselineProfile) error {
+	data, err := json.MarshalIndent(profile, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	out, err := createAtomic(path, false)
+	if err != nil {
+		return err
+	}
+	if _, err := out.File().Write(append(data, '\n')); err != nil {
+		out.Abort()
+		return err
+	}
+	return out.Commit()
+}
+
+// Reading profile of "baseline save"
+func loadBaselineProfile(path string) (BaselineProfile, error) {
+	var profile BaselineProfile
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return profile, err
+	}
+	if err := json.Unmarshal(data, &profile); err != nil {
+		return profile, fmt.Errorf("%s: %w", path, err)
+	}
+
+	if profile.Version < 1 || profile.Version > baselineVersion {
+		return profile, incompatibleState(path, "baseline", profile.Version, baselineVersion, profile.WrittenBy, "save baseline again with this ginlog")
+	}
+	if len(profile.Percentiles) == 0 {
+		return profile, fmt.Errorf("%s: baseline has no percentiles", path)
+	}
+	return profile, nil
+}
+
+// Metric of route worse than baseline beyond tolerance.
+// Latencies are in seconds.
+type BaselineViolation struct {
+	Route    string  `json:"route"`
+	Metric   string  `json:"metric"`
+	Baseline float64 `json:"baseline"`
+	Current  float64 `json:"current"`
+	Change   float64 `json:"change"`
+}
+
+// Result of baseline check
+type BaselineCheck struct {
+	Tolerance  float64             `json:"tolerance"`
+	Checked    int                 `json:"checked"`
+	Violations []BaselineViolation `json:"violations"`
+
+	// Routes of baseline without enough current requests,
+	// and current routes not in baseline
+	Missing []string `json:"missing"`
+	New     []string `json:"new"`
+}
+
+// Routes with violations
+func (c BaselineCheck) Regressed() []string {
+	var routes []string
+	for _, v := range c.Violations {
+		if !slices.Contains(routes, v.Route) {
+			routes = append(routes, v.Route)
+		}
+	}
+	return routes
+}
+
+// Checking current groups against profile. Percentiles fail when they
+// grow by more than tolerance, error rate also needs to grow by at
+// least minOutlierErrorRate, so single errors of quiet routes pass.
+func checkBaseline(profile BaselineProfile, groups []GroupMetrics, tolerance float64) BaselineCheck {
+	check := BaselineCheck{Tolerance: tolerance, Violations: []BaselineViolation{}, Missing: []string{}, New: []string{}}
+
+	current := make(map[string]GroupMetrics, len(groups))
+	for _, group := range groups {
+		current[group.Key] = group
+	}
+
+	for _, route := range profile.Routes {
+		if route.Count < baselineMinRequests {
+			continue
+		}
+
+		group, ok := current[route.Route]
+		if !ok || group.Count < baselineMinRequests {
+			check.Missing = append(check.Missing, route.Route)
+			continue
+		}
+		check.Checked++
+
+		violate := func(metric string, before, after float64) {
+			change := 0.0
+			if before > 0 {
+				change = (after - before) / before
+			}
+			check.Violations = append(check.Violations, BaselineViolation{
+				Route: route.Route, Metric: metric, Baseline: before, Current: after, Change: change,
+			})
+		}
+
+		if group.ErrorRate > route.ErrorRate*(1+tolerance) && group.ErrorRate-route.ErrorRate >= minOutlierErrorRate {
+			violate("error_rate", route.ErrorRate, group.ErrorRate)
+		}
+
+		for i, p := range route.Percentiles {
+			if i >= len(group.Percentiles) {
+				break
+			}
+			before, after := p.Value.Seconds(), group.Percentiles[i].Value.Seconds()
+			if after > before*(1+tolerance) {
+				violate(percentileLabel(p.P), before, after)
+			}
+		}
+	}
+
+	for _, group := range groups {
+		known := slices.ContainsFunc(profile.Routes, func(r BaselineRoute) bool { return r.Route == group.Key })
+		if !known && group.Count >= baselineMinRequests {
+			check.New = append(check.New, group.Key)
+		}
+	}
+
+	return check
+}
+
+// Baseline check output
+func printBaselineCheck(check BaselineCheck, locale Locale) {
+	if len(check.Violations) > 0 {
+		w := newTable(os.Stdout)
+		fmt.Fprintf(w, "ROUTE\tMETRIC\tBASELINE\tCURRENT\tCHANGE\n")
+		for _, v := range check.Violations {
+			format := func(value float64) string {
+				return locale.Duration(time.Duration(value * float64(time.Second)).Round(time.Microsecond))
+			}
+			if v.Metric == "error_rate" {
+				format = locale.Percent
+			}
+
+			change := "-"
+			if v.Baseline > 0 {
+				change = signed(locale.Percent(v.Change), v.Change)
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", v.Route, v.Metric, format(v.Baseline), format(v.Current), change)
+		}
+		w.Flush()
+		fmt.Println()
+	}
+
+	fmt.Printf("%s of %s routes regressed beyond %s tolerance\n",
+		locale.Int(len(check.Regressed())), locale.Int(check.Checked), locale.Percent(check.Tolerance))
+	if len(check.Missing) > 0 {
+		fmt.Printf("Not checked, fewer than %d current requests: %s\n", baselineMinRequests, joinLimited(check.Missing))
+	}
+	if len(check.New) > 0 {
+		fmt.Printf("Not in baseline: %s\n", joinLimited(check.New))
+	}
+}
+
+// Joining first names of list
+func joinLimited(names []string) string {
+	const limit = 10
+	if len(names) <= limit {
+		return strings.Join(names, ", ")
+	}
+	return fmt.Sprintf("%s and %d more", strings.Join(names[:limit], ", "), len(names)-limit)
+}
+
+// Sink of baseline metrics, overall and per route
+type baselineSink struct {
+	metrics *MetricsAccumulator
+	groups  *GroupAccumulator
+}
+
+func (s baselineSink) Add(record LogRecord) error {
+	s.metrics.Add(record)
+	s.groups.Add(record)
+	return nil
+}
+
+func (s baselineSink) Finish() error {
+	return nil
+}
@@ -0,0 +1,457 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// Binary record file (-format binary), written by nightly parse jobs
+// and read through mmap, so reports, repl and REST API query it without
+// loading it. Layout, little endian:
+//
+//	magic     "GINLREC" and version byte
+//	records   fixed size, strings are ids of string table
+//	offsets   uint64 offset of every string in blob, and end of blob
+//	blob      strings, distinct methods, IPs and routes written once
+//	trailer   records, strings, offsets and blob position, magic
+//
+// String 0 is empty string. Fields of record are one JSON string.
+const (
+	binaryMagic       = "GINLREC"
+	binaryVersion     = 1
+	binaryHeaderSize  = 8
+	binaryRecordSize  = 48
+	binaryTrailerSize = 40
+)
+
+// Record writer of binary record file, records are written as they
+// come and strings kept until Close writes string table.
+// Methods, IPs and routes are few, each distinct one is written once.
+// URLs and fields are mostly distinct, so they are kept in blob without
+// lookup, only their bytes and end offset are kept.
+type binaryWriter struct {
+	w      *bufio.Writer
+	offset int64
+	err    error
+
+	records int
+	ids     map[string]uint32
+	ends    []uint64
+	blob    bytes.Buffer
+}
+
+func newBinaryWriter(w io.Writer) *binaryWriter {
+	return &binaryWriter{w: bufio.NewWriter(w), ids: map[string]uint32{"": 0}, ends: []uint64{0, 0}}
+}
+
+func (w *binaryWriter) Write(record LogRecord) error {
+	w.start()
+
+	var fields string
+	if len(record.Fields) > 0 {
+		data, err := json.Marshal(record.Fields)
+		if err != nil {
+			return err
+		}
+		fields = string(data)
+	}
+
+	var buf [binaryRecordSize]byte
+	le := binary.LittleEndian
+	_, zone := record.Date.Zone()
+	le.PutUint64(buf[0:], uint64(record.Date.Unix()))
+	le.PutUint32(buf[8:], uint32(record.Date.Nanosecond()))
+	le.PutUint32(buf[12:], uint32(int32(zone)))
+	le.PutUint64(buf[16:], uint64(record.Duration))
+	le.PutUint16(buf[24:], uint16(record.Code))
+	le.PutUint32(buf[28:], w.id(record.Method))
+	le.PutUint32(buf[32:], w.add(record.URL))
+	le.PutUint32(buf[36:], w.id(record.IP))
+	le.PutUint32(buf[40:], w.id(record.Route))
+	le.PutUint32(buf[44:], w.add(fields))
+	w.write(buf[:])
+	w.records++
+	return w.err
+}
+
+// Id of string in string table, added when it isn't there
+func (w *binaryWriter) id(s string) uint32 {
+	id, ok := w.ids[s]
+	if !ok {
+		id = w.add(s)
+		w.ids[s] = id
+	}
+	return id
+}
+
+// Adding string to string table, empty string is string 0
+func (w *binaryWriter) add(s string) uint32 {
+	if s == "" {
+		return 0
+	}
+	w.blob.WriteString(s)
+	w.ends = append(w.ends, uint64(w.blob.Len()))
+	return uint32(len(w.ends) - 2)
+}
+
+// Writing string table and trailer
+func (w *binaryWriter) Close() error {
+	w.start()
+
+	le := binary.LittleEndian
+	offsets := w.offset
+	for _, end := range w.ends {
+		w.write(le.AppendUint64(nil, end))
+	}
+
+	blob := w.offset
+	w.write(w.blob.Bytes())
+
+	trailer := le.AppendUint64(nil, uint64(w.records))
+	trailer = le.AppendUint64(trailer, uint64(len(w.ends)-1))
+	trailer = le.AppendUint64(trailer, uint64(offsets))
+	trailer = le.AppendUint64(trailer, uint64(blob))
+	w.write(append(trailer, binaryHeader()...))
+
+	if w.err != nil {
+		return w.err
+	}
+	return w.w.Flush()
+}
+
+// Writing magic at start of file, not when writer is created,
+// so writer which is never used writes nothing
+func (w *binaryWriter) start() {
+	if w.offset == 0 {
+		w.write(binaryHeader())
+	}
+}
+
+// Magic and version, at start and end of file
+func binaryHeader() []byte {
+	return append([]byte(binaryMagic), binaryVersion)
+}
+
+func (w *binaryWriter) write(b []byte) {
+	if w.err != nil {
+		return
+	}
+	n, err := w.w.Write(b)
+	w.offset += int64(n)
+	w.err = err
+}
+
+// Records of repl and REST API, kept in memory or mapped from binary
+// record files
+type recordSet interface {
+	Len() int
+	Record(i int) LogRecord
+}
+
+// Records kept in memory
+type recordSlice []LogRecord
+
+func (s recordSlice) Len() int               { return len(s) }
+func (s recordSlice) Record(i int) LogRecord { return s[i] }
+
+// Binary record file mapped into memory. Pages are read by kernel as
+// records are decoded and dropped under memory pressure, so files much
+// bigger than memory can be queried.
+type binaryRecords struct {
+	data    []byte
+	records int
+	strings int
+	offsets int
+	blob    int
+}
+
+// Checking is file binary record file by its magic
+func isBinaryRecordFile(file *os.File) bool {
+	magic := make([]byte, len(binaryMagic))
+	_, err := file.ReadAt(magic, 0)
+	return err == nil && string(magic) == binaryMagic
+}
+
+// Mapping binary record file, its layout is checked so corrupted or
+// truncated files are refused instead of decoded as garbage
+func openBinaryRecords(name string) (*binaryRecords, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	size := info.Size()
+	if size < binaryHeaderSize+binaryTrailerSize || !isBinaryRecordFile(file) {
+		return nil, fmt.Errorf("%s: not a binary record file", name)
+	}
+	if int64(int(size)) != size {
+		return nil, fmt.Errorf("%s: binary record file of %d bytes is too big to map", name, size)
+	}
+
+	data, err := mapFile(file, int(size))
+	if err != nil {
+		return nil, fmt.Errorf("%s: mapping: %w", name, err)
+	}
+	b := &binaryRecords{data: data}
+	if err := b.check(); err != nil {
+		unmapFile(data)
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return b, nil
+}
+
+// Checking header, trailer and string table of mapped file
+func (b *binaryRecords) check() error {
+	le := binary.LittleEndian
+	size := uint64(len(b.data))
+
+	if version := b.data[len(binaryMagic)]; version != binaryVersion {
+		if version > binaryVersion {
+			return fmt.Errorf("binary record file version %d is newer than version %d of this ginlog, parse input again or update ginlog", version, binaryVersion)
+		}
+		return fmt.Errorf("unsupported binary record file version %d", version)
+	}
+
+	trailer := b.data[size-binaryTrailerSize:]
+	if !bytes.Equal(trailer[32:], binaryHeader()) {
+		return errors.New("binary record file is truncated, it has no trailer")
+	}
+	records, strings := le.Uint64(trailer[0:]), le.Uint64(trailer[8:])
+	offsets, blob := le.Uint64(trailer[16:]), le.Uint64(trailer[24:])
+
+	switch {
+	case strings == 0 || records > size/binaryRecordSize || strings > size/8:
+		return errors.New("binary record file has invalid trailer")
+	case offsets != binaryHeaderSize+records*binaryRecordSize || blob != offsets+(strings+1)*8 || blob > size-binaryTrailerSize:
+		return errors.New("binary record file has invalid trailer")
+	case blob+le.Uint64(b.data[blob-8:]) != size-binaryTrailerSize:
+		return errors.New("binary record file has invalid string table")
+	}
+
+	b.records, b.strings, b.offsets, b.blob = int(records), int(strings), int(offsets), int(blob)
+	return nil
+}
+
+func (b *binaryRecords) Len() int {
+	return b.records
+}
+
+// Decoding record, strings are copied so records outlive mapping
+func (b *binaryRecords) Record(i int) LogRecord {
+	le := binary.LittleEndian
+	p := b.data[binaryHeaderSize+i*binaryRecordSize:][:binaryRecordSize]
+
+	record := LogRecord{
+		Date:     binaryDate(int64(le.Uint64(p[0:])), int64(le.Uint32(p[8:])), int(int32(le.Uint32(p[12:])))),
+		Duration: time.Duration(le.Uint64(p[16:])),
+		Code:     int(le.Uint16(p[24:])),
+		Method:   b.string(le.Uint32(p[28:])),
+		URL:      b.string(le.Uint32(p[32:])),
+		IP:       b.string(le.Uint32(p[36:])),
+		Route:    b.string(le.Uint32(p[40:])),
+	}
+	if fields := b.string(le.Uint32(p[44:])); fields != "" {
+		json.Unmarshal([]byte(fields), &record.Fields)
+	}
+	return record
+}
+
+// String of string table, ids out of table are empty strings
+func (b *binaryRecords) string(id uint32) string {
+	if id == 0 || int(id) >= b.strings {
+		return ""
+	}
+	le := binary.LittleEndian
+	start := le.Uint64(b.data[b.offsets+int(id)*8:])
+	end := le.Uint64(b.data[b.offsets+int(id)*8+8:])
+	// Compared as uint64, corrupt offsets above MaxInt64 turn negative as int
+	if start > end || end > uint64(len(b.data)-binaryTrailerSize-b.blob) {
+		return ""
+	}
+	return string(b.data[b.blob+int(start) : b.blob+int(end)])
+}
+
+func (b *binaryRecords) Close() error {
+	return unmapFile(b.data)
+}
+
+// Date of record in zone it was written with, like dates of record
+// stream. Zone of local time is kept as local.
+func binaryDate(sec, nsec int64, zone int) time.Time {
+	date := time.Unix(sec, nsec)
+	if _, local := date.Zone(); local != zone {
+		date = date.In(time.FixedZone("", zone))
+	}
+	return streamDate(date)
+}
+
+// Records of several binary record files one after another
+type mappedRecords struct {
+	files  []*binaryRecords
+	starts []int
+	total  int
+}
+
+// Mapping inputs when every one of them is binary record file, false
+// when some input has to be read as lines
+func openMappedInputs(names []string) (*mappedRecords, bool, error) {
+	for _, name := range names {
+		file, err := os.Open(name)
+		if err != nil {
+			return nil, false, nil
+		}
+		binary := isBinaryRecordFile(file)
+		file.Close()
+		if !binary {
+			return nil, false, nil
+		}
+	}
+
+	m := &mappedRecords{}
+	for _, name := range names {
+		b, err := openBinaryRecords(name)
+		if err != nil {
+			m.Close()
+			return nil, true, err
+		}
+		m.files = append(m.files, b)
+		m.starts = append(m.starts, m.total)
+		m.total += b.Len()
+	}
+	return m, len(names) > 0, nil
+}
+
+func (m *mappedRecords) Len() int {
+	return m.total
+}
+
+func (m *mappedRecords) Record(i int) LogRecord {
+	f := len(m.starts) - 1
+	for m.starts[f] > i {
+		f--
+	}
+	return m.files[f].Record(i - m.starts[f])
+}
+
+func (m *mappedRecords) Close() error {
+	for _, b := range m.files {
+		b.Close()
+	}
+	return nil
+}
+
+// Records of mapped set accepted by filters of flags, tagged and
+// routed as they are queried. Only numbers of accepted records are
+// kept, 4 bytes per record, and none without filters.
+type acceptedRecords struct {
+	set      recordSet
+	filtered bool
+	index    []uint32
+	enrich   func(record *LogRecord)
+}
+
+func acceptMapped(set recordSet, filtered bool, accept func(record LogRecord, number int) (LogRecord, bool, error), enrich func(record *LogRecord)) (recordSet, error) {
+	accepted := &acceptedRecords{set: set, filtered: filtered, enrich: enrich}
+	if !filtered {
+		return accepted, nil
+	}
+	for i := range set.Len() {
+		_, ok, err := accept(set.Record(i), i+1)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			accepted.index = append(accepted.index, uint32(i))
+		}
+	}
+	return accepted, nil
+}
+
+func (a *acceptedRecords) Len() int {
+	if !a.filtered {
+		return a.set.Len()
+	}
+	return len(a.index)
+}
+
+func (a *acceptedRecords) Record(i int) LogRecord {
+	if a.filtered {
+		i = int(a.index[i])
+	}
+	record := a.set.Record(i)
+	a.enrich(&record)
+	return record
+}
+
+// Binary record files given as arguments, when every input is one.
+// readRecords takes their records as they are, filtered by accept,
+// other readers of input read them as record stream.
+type mappedInput struct {
+	*binaryStream
+	records *mappedRecords
+	accept  func(record LogRecord, number int) (LogRecord, bool, error)
+}
+
+func newMappedInput(records *mappedRecords, accept func(record LogRecord, number int) (LogRecord, bool, error)) *mappedInput {
+	return &mappedInput{binaryStream: newBinaryStream(records), records: records, accept: accept}
+}
+
+func (m *mappedInput) readRecords(write func(LogRecord) error) error {
+	for i := range m.records.Len() {
+		record, ok, err := m.accept(m.records.Record(i), i+1)
+		if err != nil {
+			return err
+		}
+		if ok {
+			if err := write(record); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (m *mappedInput) Close() error {
+	return m.records.Close()
+}
+
+// Reader of mapped records as record stream lines, so binary record
+// files given as inputs work with every report. Records are encoded
+// one by one, only one of them is in memory.
+type binaryStream struct {
+	set  recordSet
+	next int
+	buf  bytes.Buffer
+	enc  *streamWriter
+}
+
+func newBinaryStream(set recordSet) *binaryStream {
+	s := &binaryStream{set: set}
+	s.enc = newStreamWriter(&s.buf)
+	return s
+}
+
+func (s *binaryStream) Read(p []byte) (int, error) {
+	for s.buf.Len() == 0 {
+		if s.next >= s.set.Len() {
+			return 0, io.EOF
+		}
+		if err := s.enc.Write(s.set.Record(s.next)); err != nil {
+			return 0, err
+		}
+		s.next++
+	}
+	return s.buf.Read(p)
+}
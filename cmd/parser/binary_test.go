@@ -0,0 +1,193 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+var binaryTestRecords = []LogRecord{
+	{Date: time.Date(2024, 5, 1, 10, 0, 0, 123456789, time.FixedZone("", 3*3600)), Code: 200, Duration: 103601, IP: "127.0.0.1", Method: "GET", URL: "/ping", Route: "/ping"},
+	{Date: time.Date(2024, 5, 1, 10, 0, 1, 0, time.UTC), Code: 404, Duration: time.Millisecond, IP: "10.0.0.1", Method: "GET", URL: "/users/1", Route: "/users/:id", Fields: map[string]string{"user_agent": "curl/8.0"}},
+	{Date: time.Date(2024, 5, 1, 10, 0, 2, 0, time.FixedZone("", -5*3600)), Code: 500, Duration: 2 * time.Second, IP: "127.0.0.1", Method: "POST", URL: "/ping"},
+}
+
+// Writing records into binary record file
+func writeBinaryRecords(t *testing.T, records []LogRecord) string {
+	t.Helper()
+	var out bytes.Buffer
+	w := newBinaryWriter(&out)
+	for _, record := range records {
+		if err := w.Write(record); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "records.bin")
+	if err := os.WriteFile(path, out.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func checkRecord(t *testing.T, got, want LogRecord) {
+	t.Helper()
+	_, gotZone := got.Date.Zone()
+	_, wantZone := want.Date.Zone()
+	if !got.Date.Equal(want.Date) || gotZone != wantZone {
+		t.Errorf("date %v, want %v", got.Date, want.Date)
+	}
+	got.Date, want.Date = time.Time{}, time.Time{}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("record %+v, want %+v", got, want)
+	}
+}
+
+func TestBinaryRecordsRoundTrip(t *testing.T) {
+	b, err := openBinaryRecords(writeBinaryRecords(t, binaryTestRecords))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	if b.Len() != len(binaryTestRecords) {
+		t.Fatalf("%d records, want %d", b.Len(), len(binaryTestRecords))
+	}
+	for i, want := range binaryTestRecords {
+		checkRecord(t, b.Record(i), want)
+	}
+
+	// Methods, IPs and routes are written once, URLs and fields every
+	// time: empty, GET, 3 URLs, 2 IPs, 2 routes, fields, POST
+	if b.strings != 11 {
+		t.Errorf("%d strings in table, want 11", b.strings)
+	}
+}
+
+func TestBinaryRecordsRejected(t *testing.T) {
+	data, err := os.ReadFile(writeBinaryRecords(t, binaryTestRecords))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newer := bytes.Clone(data)
+	newer[len(binaryMagic)] = binaryVersion + 1
+
+	corrupted := bytes.Clone(data)
+	corrupted[len(corrupted)-binaryTrailerSize] = 0xff
+
+	tests := map[string]struct {
+		data []byte
+		err  string
+	}{
+		"truncated":  {data[:len(data)-10], "truncated"},
+		"too short":  {data[:binaryHeaderSize+4], "not a binary record file"},
+		"newer":      {newer, "newer than version"},
+		"trailer":    {corrupted, "invalid trailer"},
+		"not binary": {[]byte(strings.Repeat("[GIN] 2024/05/01 - 10:00:01 | 200 |\n", 10)), "not a binary record file"},
+	}
+	for name, tt := range tests {
+		path := filepath.Join(t.TempDir(), "records.bin")
+		if err := os.WriteFile(path, tt.data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		b, err := openBinaryRecords(path)
+		if err == nil {
+			b.Close()
+			t.Errorf("%s: file opened", name)
+			continue
+		}
+		if !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: error %q, want %q", name, err, tt.err)
+		}
+	}
+}
+
+func TestBinaryRecordsCorruptStrings(t *testing.T) {
+	data, err := os.ReadFile(writeBinaryRecords(t, binaryTestRecords))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Offsets of string 1 above MaxInt64
+	offsets := binaryHeaderSize + len(binaryTestRecords)*binaryRecordSize
+	binary.LittleEndian.PutUint64(data[offsets+8:], 1<<63)
+	binary.LittleEndian.PutUint64(data[offsets+16:], 1<<64-1)
+
+	path := filepath.Join(t.TempDir(), "records.bin")
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	b, err := openBinaryRecords(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	if s := b.string(1); s != "" {
+		t.Errorf("string %q of corrupt offsets, want empty", s)
+	}
+	for i := range b.Len() {
+		b.Record(i)
+	}
+}
+
+func TestMappedInputs(t *testing.T) {
+	first := writeBinaryRecords(t, binaryTestRecords[:2])
+	second := writeBinaryRecords(t, binaryTestRecords[2:])
+
+	m, ok, err := openMappedInputs([]string{first, second})
+	if err != nil || !ok {
+		t.Fatalf("openMappedInputs: %v, %v", ok, err)
+	}
+	defer m.Close()
+
+	if m.Len() != len(binaryTestRecords) {
+		t.Fatalf("%d records, want %d", m.Len(), len(binaryTestRecords))
+	}
+	for i, want := range binaryTestRecords {
+		checkRecord(t, m.Record(i), want)
+	}
+
+	text := writeFile(t, "app.log", ginLine("10:00:01", "/ping"))
+	if _, ok, err := openMappedInputs([]string{first, text}); ok || err != nil {
+		t.Errorf("text input mapped: %v, %v", ok, err)
+	}
+}
+
+func TestMappedInputReadsRecords(t *testing.T) {
+	m, ok, err := openMappedInputs([]string{writeBinaryRecords(t, binaryTestRecords)})
+	if err != nil || !ok {
+		t.Fatalf("openMappedInputs: %v, %v", ok, err)
+	}
+	input := newMappedInput(m, func(record LogRecord, number int) (LogRecord, bool, error) {
+		return record, record.Code >= 400, nil
+	})
+	defer input.Close()
+
+	var got []LogRecord
+	err = readRecords(input, 4, func(line string, number int) (LogRecord, bool, error) {
+		t.Fatalf("line %q parsed", line)
+		return LogRecord{}, false, nil
+	}, func(record LogRecord) error {
+		got = append(got, record)
+		return nil
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(got) != 2 {
+		t.Fatalf("%d records, want 2", len(got))
+	}
+	checkRecord(t, got[0], binaryTestRecords[1])
+	checkRecord(t, got[1], binaryTestRecords[2])
+}
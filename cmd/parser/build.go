@@ -0,0 +1,89 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"runtime/debug"
+)
+
+// Commit of binary, set at build time with -ldflags "-X main.commit=<hash>"
+// when it isn't built from git checkout, which go build stamps itself
+var commit = ""
+
+// Error of integrations left out of builds with -tags minimal
+var errMinimal = errors.New("not in this build (built with -tags minimal)")
+
+// Version of checkpoint file of -checkpoint
+const checkpointVersion = 1
+
+// Build of running binary and versions of schemas it reads and writes,
+// stamped into exports, state files and serve mode responses
+type Build struct {
+	Version  string         `json:"version"`
+	Commit   string         `json:"commit,omitempty"`
+	Modified bool           `json:"modified,omitempty"`
+	Minimal  bool           `json:"minimal,omitempty"`
+	Go       string         `json:"go"`
+	Schemas  map[string]int `json:"schemas"`
+}
+
+func currentBuild() Build {
+	b := Build{
+		Version: currentVersion(),
+		Commit:  commit,
+		Minimal: minimalBuild,
+		Go:      runtime.Version(),
+		Schemas: map[string]int{
+			"records":    streamVersion,
+			"binary":     binaryVersion,
+			"config":     configVersion,
+			"baseline":   baselineVersion,
+			"growth":     growthStateVersion,
+			"checkpoint": checkpointVersion,
+		},
+	}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, s := range info.Settings {
+			switch {
+			case s.Key == "vcs.revision" && b.Commit == "":
+				b.Commit = s.Value
+			case s.Key == "vcs.modified":
+				b.Modified = s.Value == "true"
+			}
+		}
+	}
+	if len(b.Commit) > 12 {
+		b.Commit = b.Commit[:12]
+	}
+	return b
+}
+
+// Version with commit, e.g. "ginlog v1.2.0 (3f2a9c1d0b4e)"
+func (b Build) String() string {
+	s := "ginlog " + b.Version
+	switch {
+	case b.Commit != "" && b.Modified:
+		s += " (" + b.Commit + ", modified)"
+	case b.Commit != "":
+		s += " (" + b.Commit + ")"
+	}
+	if b.Minimal {
+		s += " minimal"
+	}
+	return s
+}
+
+// Error of state file of other schema version than this binary's,
+// with build which wrote it when file has it, and what to do instead
+func incompatibleState(path, kind string, version, supported int, writtenBy, hint string) error {
+	by := ""
+	if writtenBy != "" {
+		by = " written by " + writtenBy
+	}
+	relation := "older"
+	if version > supported {
+		relation, hint = "newer", "upgrade ginlog, or "+hint
+	}
+	return fmt.Errorf("%s: %s version %d%s is %s than version %d of %s; %s", path, kind, version, by, relation, supported, currentBuild(), hint)
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Features of installed version, for wrapper tools and UIs
+type Capabilities struct {
+	Version  string       `json:"version"`
+	Build    Build        `json:"build"`
+	Commands []string     `json:"commands"`
+	Inputs   []string     `json:"inputs"`
+	Patterns []string     `json:"patterns"`
+	Outputs  []string     `json:"outputs"`
+	Sinks    []string     `json:"sinks"`
+	Reports  []string     `json:"reports"`
+	Flags    []FlagSchema `json:"flags"`
+
+	// Flags of each subcommand, Flags are accepted without subcommand
+	CommandFlags map[string][]FlagSchema `json:"command_flags"`
+}
+
+// Description of command line flag
+type FlagSchema struct {
+	Name    string `json:"name"`
+	Type    string `json:"type"`
+	Default string `json:"default"`
+	Usage   string `json:"usage"`
+
+	// Accepted values of flags with fixed choices
+	Values []string `json:"values,omitempty"`
+
+	// Flag can be given several times
+	Repeatable bool `json:"repeatable,omitempty"`
+}
+
+// Commands besides report subcommands
+var commands = []string{"ssh", "query", "store", "resume", "devserver", "config", "self-update", "capabilities"}
+
+// Destinations of results besides stdout
+var sinks = []string{"stdout", "file (-o)", "split-by files", "rollup-dir", "sqlite", "otlp", "serve (prometheus http)", "email", "pagerduty", "opsgenie"}
+
+// Reports besides default metrics, with flag selecting them
+var reports = []string{"metrics", "group-by", "top", "histogram", "heatmap", "interval", "split-at", "compare-sources", "events", "forecast", "arrivals", "anomalies", "episodes", "crawlers", "folded", "tree", "growth", "conformance", "clients", "quotas", "capacity", "keepalive", "threats", "impact", "params", "compare"}
+
+// Capabilities of flags defined in set
+func collectCapabilities(flags *flag.FlagSet) Capabilities {
+	var localeNames []string
+	for _, l := range locales {
+		localeNames = append(localeNames, l.Name)
+	}
+
+	values := map[string][]string{
+		"input":         inputFormats,
+		"pattern":       presetNames(),
+		"format":        outputFormats,
+		"group-by":      append(slices.Clone(groupByKeys), "expr:<expression>", "param:<name>"),
+		"sort":          sortKeys,
+		"split-by":      append(slices.Clone(splitKeys), groupByKeys...),
+		"top":           topReports,
+		"by":            topReports,
+		"events":        eventKinds,
+		"rollup-period": {"hour", "day"},
+		"locale":        localeNames,
+	}
+
+	var names []string
+	for _, cmd := range subcommands {
+		names = append(names, cmd.name)
+	}
+
+	c := Capabilities{
+		Version:  currentVersion(),
+		Build:    currentBuild(),
+		Commands: append(names, commands...),
+		Inputs:   inputFormats,
+		Patterns: values["pattern"],
+		Outputs:  outputFormats,
+		Sinks:    sinks,
+		Reports:  reports,
+		Flags:    flagSchemas(flags, values),
+
+		CommandFlags: make(map[string][]FlagSchema),
+	}
+
+	for _, cmd := range subcommands {
+		fs := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+		cmd.flags(&Options{}, fs)
+		c.CommandFlags[cmd.name] = flagSchemas(fs, values)
+	}
+
+	return c
+}
+
+// Schemas of flags in set, values are choices of flags by name
+func flagSchemas(flags *flag.FlagSet, values map[string][]string) []FlagSchema {
+	schemas := []FlagSchema{}
+	flags.VisitAll(func(f *flag.Flag) {
+		schema := FlagSchema{
+			Name:    f.Name,
+			Type:    flagType(f.Value),
+			Default: f.DefValue,
+			Usage:   f.Usage,
+			Values:  values[f.Name],
+		}
+
+		if _, ok := f.Value.(*listFlag); ok {
+			schema.Type, schema.Repeatable = "string", true
+		}
+
+		schemas = append(schemas, schema)
+	})
+	return schemas
+}
+
+// Type name of flag value
+func flagType(value flag.Value) string {
+	getter, ok := value.(flag.Getter)
+	if !ok {
+		return "string"
+	}
+
+	switch getter.Get().(type) {
+	case bool:
+		return "bool"
+	case int, int64, uint, uint64:
+		return "int"
+	case float64:
+		return "float"
+	case time.Duration:
+		return "duration"
+	}
+	return "string"
+}
+
+// "ginlog capabilities" command
+func printCapabilities(flags *flag.FlagSet, args []string) error {
+	set := flag.NewFlagSet("capabilities", flag.ExitOnError)
+	json := set.Bool("json", false, "Output capabilities in JSON format")
+	set.Parse(args)
+
+	c := collectCapabilities(flags)
+	if *json {
+		return printJSON(c)
+	}
+
+	fmt.Printf("Version: %s\n", c.Version)
+	fmt.Printf("Build: %s, %s\n", c.Build, c.Build.Go)
+	fmt.Printf("Commands: %s\n", strings.Join(c.Commands, ", "))
+	fmt.Printf("Inputs: %s\n", strings.Join(c.Inputs, ", "))
+	fmt.Printf("Patterns: %s\n", strings.Join(c.Patterns, ", "))
+	fmt.Printf("Outputs: %s\n", strings.Join(c.Outputs, ", "))
+	fmt.Printf("Sinks: %s\n", strings.Join(c.Sinks, ", "))
+	fmt.Printf("Reports: %s\n", strings.Join(c.Reports, ", "))
+	fmt.Println("\nFlags:")
+
+	w := newTable(os.Stdout)
+	fmt.Fprintf(w, "NAME\tTYPE\tDEFAULT\tVALUES\n")
+	for _, f := range c.Flags {
+		fmt.Fprintf(w, "-%s\t%s\t%s\t%s\n", f.Name, f.Type, f.Default, strings.Join(f.Values, ", "))
+	}
+	w.Flush()
+	return nil
+}
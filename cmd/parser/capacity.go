@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// Requests of one window of capacity report
+type capacityWindow struct {
+	requests  int
+	totalTime time.Duration
+}
+
+// Capacity needed at peak
+type CapacityReport struct {
+	Window   time.Duration `json:"window"`
+	Requests int           `json:"requests"`
+
+	// Busiest window, its rate and average latency
+	PeakStart    time.Time     `json:"peak_start,omitzero"`
+	PeakRequests int           `json:"peak_requests"`
+	PeakRPS      float64       `json:"peak_rps"`
+	PeakAverage  time.Duration `json:"peak_avg_time"`
+
+	// Requests in flight at peak by Little's law (rate times average
+	// latency), with headroom, and instances of -capacity-workers
+	Concurrency float64 `json:"concurrency"`
+	Headroom    float64 `json:"headroom"`
+	Needed      int     `json:"needed"`
+	Workers     int     `json:"workers,omitempty"`
+	Instances   int     `json:"instances,omitempty"`
+}
+
+// Capacity at peak (-capacity): requests are counted in windows of
+// given size and busiest one gives peak rate and latency. Requests in
+// flight follow from Little's law, so with headroom the report says
+// how many workers (connections, instances of -capacity-workers) peak
+// traffic needs.
+type Capacity struct {
+	window   time.Duration
+	headroom float64
+	workers  int
+	now      time.Time
+
+	requests    int
+	first, last time.Time
+	windows     map[time.Time]*capacityWindow
+}
+
+func NewCapacity(window time.Duration, headroom float64, workers int, now time.Time) *Capacity {
+	return &Capacity{window: window, headroom: headroom, workers: workers, now: now, windows: make(map[time.Time]*capacityWindow)}
+}
+
+// Adding record, records with implausible timestamps are skipped
+func (c *Capacity) Add(record LogRecord) {
+	if !plausibleTimestamp(record.Date, c.now) {
+		return
+	}
+	c.requests++
+	if c.first.IsZero() || record.Date.Before(c.first) {
+		c.first = record.Date
+	}
+	if record.Date.After(c.last) {
+		c.last = record.Date
+	}
+
+	start := record.Date.Truncate(c.window)
+	w, ok := c.windows[start]
+	if !ok {
+		w = &capacityWindow{}
+		c.windows[start] = w
+	}
+	w.requests++
+	w.totalTime += record.Duration
+}
+
+func (c *Capacity) Report() CapacityReport {
+	report := CapacityReport{Window: c.window, Requests: c.requests, Headroom: c.headroom, Workers: c.workers}
+
+	var peak *capacityWindow
+	for start, w := range c.windows {
+		if peak == nil || w.requests > peak.requests || w.requests == peak.requests && start.Before(report.PeakStart) {
+			peak, report.PeakStart = w, start
+		}
+	}
+	if peak == nil {
+		return report
+	}
+
+	// Logs shorter than window would understate rate of window
+	span := min(c.window, max(c.last.Sub(c.first), time.Second))
+	report.PeakRequests = peak.requests
+	report.PeakRPS = float64(peak.requests) / span.Seconds()
+	report.PeakAverage = peak.totalTime / time.Duration(peak.requests)
+
+	report.Concurrency = report.PeakRPS * report.PeakAverage.Seconds()
+	report.Needed = int(math.Ceil(report.Concurrency * c.headroom))
+	if c.workers > 0 {
+		report.Instances = max((report.Needed+c.workers-1)/c.workers, 1)
+	}
+	return report
+}
+
+// Capacity output
+func printCapacity(report CapacityReport, locale Locale) {
+	fmt.Printf("Capacity at peak, busiest %v window:\n\n", report.Window)
+	fmt.Printf("Requests: %s\n", locale.Int(report.Requests))
+	if report.PeakRequests == 0 {
+		return
+	}
+
+	fmt.Printf("Peak window: %s (%s requests)\n", locale.FormatDateTime(report.PeakStart), locale.Int(report.PeakRequests))
+	fmt.Printf("Peak rate: %s req/s\n", locale.Float(report.PeakRPS, 2))
+	fmt.Printf("Avg latency at peak: %s\n", locale.Duration(report.PeakAverage))
+	fmt.Printf("Concurrent requests (rate x latency): %s\n", locale.Float(report.Concurrency, 2))
+	fmt.Printf("Workers needed with %sx headroom: %s\n", locale.Float(report.Headroom, 2), locale.Int(report.Needed))
+	if report.Workers > 0 {
+		fmt.Printf("Instances of %s workers: %s\n", locale.Int(report.Workers), locale.Int(report.Instances))
+	}
+	fmt.Printf("\nLittle's law averages the window, bursts shorter than it need more headroom\n")
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// Threshold of check command and its value in checked logs
+type CheckResult struct {
+	Rule   string  `json:"rule"`
+	Metric string  `json:"metric"`
+	Value  float64 `json:"value"`
+	Limit  float64 `json:"limit"`
+	Passed bool    `json:"passed"`
+}
+
+// Result of check command, latencies are in seconds
+type CheckReport struct {
+	Passed   bool          `json:"passed"`
+	Requests int           `json:"requests"`
+	Results  []CheckResult `json:"results"`
+}
+
+// Checking metrics against threshold rules, rule like
+// "p95 > 300ms" fails when its condition holds
+func checkThresholds(rules []AlertRule, metrics Metrics) CheckReport {
+	report := CheckReport{Passed: true, Requests: metrics.Count, Results: []CheckResult{}}
+	for _, rule := range rules {
+		alert := rule.Evaluate(metrics)
+		report.Results = append(report.Results, CheckResult{
+			Rule:   rule.Expr,
+			Metric: rule.Metric,
+			Value:  alert.Value,
+			Limit:  rule.Threshold,
+			Passed: !alert.Firing,
+		})
+		report.Passed = report.Passed && !alert.Firing
+	}
+	return report
+}
+
+// Check output, failed rules are marked
+func printCheck(report CheckReport, locale Locale) {
+	w := newTable(os.Stdout)
+	fmt.Fprintf(w, "RULE\tVALUE\tSTATUS\n")
+
+	failed := 0
+	for _, r := range report.Results {
+		status := "ok"
+		if !r.Passed {
+			status = "FAILED"
+			failed++
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", r.Rule, formatMetricValue(r.Metric, r.Value, locale), status)
+	}
+	w.Flush()
+
+	result := "PASSED"
+	if !report.Passed {
+		result = "FAILED"
+	}
+	fmt.Printf("\n%s: %s of %s thresholds violated over %s requests\n",
+		result, locale.Int(failed), locale.Int(len(report.Results)), locale.Int(report.Requests))
+}
+
+// Value of alert metric in its unit
+func formatMetricValue(metric string, value float64, locale Locale) string {
+	switch metric {
+	case "count", "errors":
+		return locale.Int(int(value))
+	case "error_rate":
+		return locale.Percent(value)
+	}
+	return locale.Duration(time.Duration(value * float64(time.Second)).Round(time.Microsecond))
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// Checkpoint of export stopped by sink failure (-checkpoint): its
+// command line and records already sent, so "ginlog resume" sends
+// only the rest instead of exporting whole input again
+type Checkpoint struct {
+	Version   int      `json:"version"`
+	WrittenBy string   `json:"written_by"`
+	Args      []string `json:"args"`
+
+	// -offset and -limit of resumed run, first records of output
+	// were sent, limit is what is left of it
+	Offset int `json:"offset"`
+	Limit  int `json:"limit,omitempty"`
+
+	Sent   int       `json:"sent"`
+	Error  string    `json:"error"`
+	Failed time.Time `json:"failed"`
+}
+
+// Checkpoint of run sending records after offset, at most limit of
+// them, written to path when sending fails
+type checkpointer struct {
+	path          string
+	args          []string
+	offset, limit int
+}
+
+func newCheckpointer(path string, offset, limit int) *checkpointer {
+	return &checkpointer{path: path, args: slices.Clone(os.Args[1:]), offset: offset, limit: limit}
+}
+
+// Writing checkpoint after sent records of run were confirmed
+func (c *checkpointer) Fail(sent int, sendErr error) error {
+	checkpoint := Checkpoint{
+		Version:   checkpointVersion,
+		WrittenBy: currentBuild().String(),
+		Args:      c.args,
+		Offset:    c.offset + sent,
+		Sent:      sent,
+		Error:     sendErr.Error(),
+		Failed:    time.Now(),
+	}
+	if c.limit > 0 {
+		checkpoint.Limit = c.limit - sent
+	}
+
+	data, err := json.MarshalIndent(checkpoint, "", "  ")
+	if err != nil {
+		return err
+	}
+	out, err := createAtomic(c.path, false)
+	if err != nil {
+		return err
+	}
+	if _, err := out.File().Write(append(data, '\n')); err != nil {
+		out.Abort()
+		return err
+	}
+	if err := out.Commit(); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "Checkpoint of %d sent records written to %s, send the rest with: ginlog resume %s\n", sent, c.path, c.path)
+	return nil
+}
+
+// Removing checkpoint of earlier failure once everything is sent
+func (c *checkpointer) Done() error {
+	if err := os.Remove(c.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// "ginlog resume FILE", returns command line of checkpoint with
+// -offset (and -limit) skipping records already sent. Flags go before
+// "--" as everything after it is input.
+func resumeCommandLine(args []string) ([]string, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("usage: ginlog resume CHECKPOINT")
+	}
+
+	data, err := os.ReadFile(args[0])
+	if err != nil {
+		return nil, err
+	}
+	var checkpoint Checkpoint
+	if err := json.Unmarshal(data, &checkpoint); err != nil {
+		return nil, fmt.Errorf("%s: %w", args[0], err)
+	}
+	// Checkpoints of first version have no version field
+	if checkpoint.Version == 0 {
+		checkpoint.Version = 1
+	}
+	if checkpoint.Version != checkpointVersion {
+		return nil, incompatibleState(args[0], "checkpoint", checkpoint.Version, checkpointVersion, checkpoint.WrittenBy, "resume it with the ginlog which wrote it, or export again instead")
+	}
+	if len(checkpoint.Args) == 0 {
+		return nil, fmt.Errorf("%s: checkpoint has no command line", args[0])
+	}
+
+	flags := []string{"-offset=" + strconv.Itoa(checkpoint.Offset)}
+	if checkpoint.Limit > 0 {
+		flags = append(flags, "-limit="+strconv.Itoa(checkpoint.Limit))
+	}
+
+	line := slices.Clone(checkpoint.Args)
+	i := slices.Index(line, "--")
+	if i < 0 {
+		i = len(line)
+	}
+	fmt.Fprintf(os.Stderr, "Resuming export which failed with %q, skipping first %d records\n", checkpoint.Error, checkpoint.Offset)
+	return slices.Insert(line, i, flags...), nil
+}
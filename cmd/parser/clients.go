@@ -0,0 +1,174 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Requests of client IP
+type ClientStats struct {
+	IP        string  `json:"ip"`
+	Requests  int     `json:"requests"`
+	Errors    int     `json:"errors"`
+	ErrorRate float64 `json:"error_rate"`
+
+	// Most requests in one minute, start of that minute and
+	// number of minutes above -client-rate
+	PeakRate    int       `json:"peak_rate"`
+	PeakAt      time.Time `json:"peak_at,omitzero"`
+	MinutesOver int       `json:"minutes_over"`
+}
+
+// Client report
+type ClientsReport struct {
+	Unique     int           `json:"unique"`
+	Requests   int           `json:"requests"`
+	Rate       int           `json:"rate"`
+	ByRequests []ClientStats `json:"by_requests"`
+	ByErrors   []ClientStats `json:"by_errors"`
+
+	// Clients exceeding rate in some minute, by peak rate
+	OverRate []ClientStats `json:"over_rate"`
+
+	// Share of lines of -sample, counts are scaled to estimates
+	// but unique clients are those of sampled lines
+	SampleRate float64 `json:"sample_rate,omitempty"`
+}
+
+// Counts of one client, requests are counted per minute
+type clientCounter struct {
+	requests, errors int
+	minutes          map[time.Time]int
+}
+
+// Requests per client IP
+type Clients struct {
+	n, rate  int
+	now      time.Time
+	requests int
+	ips      map[string]*clientCounter
+}
+
+func NewClients(n, rate int, now time.Time) *Clients {
+	return &Clients{n: n, rate: rate, now: now, ips: make(map[string]*clientCounter)}
+}
+
+// Adding record, records with implausible timestamps are
+// counted but not in request rate
+func (c *Clients) Add(record LogRecord) {
+	counter, ok := c.ips[record.IP]
+	if !ok {
+		counter = &clientCounter{minutes: make(map[time.Time]int)}
+		c.ips[record.IP] = counter
+	}
+
+	c.requests++
+	counter.requests++
+	if isError(record.Code) {
+		counter.errors++
+	}
+	if plausibleTimestamp(record.Date, c.now) {
+		counter.minutes[record.Date.Truncate(time.Minute)]++
+	}
+}
+
+func (c *clientCounter) stats(ip string, rate int) ClientStats {
+	stats := ClientStats{
+		IP:        ip,
+		Requests:  scaleCount(c.requests),
+		Errors:    scaleCount(c.errors),
+		ErrorRate: float64(c.errors) / float64(c.requests),
+	}
+
+	for minute, count := range c.minutes {
+		count = scaleCount(count)
+		if count > stats.PeakRate || count == stats.PeakRate && minute.Before(stats.PeakAt) {
+			stats.PeakRate, stats.PeakAt = count, minute
+		}
+		if count > rate {
+			stats.MinutesOver++
+		}
+	}
+	return stats
+}
+
+// Report of clients, top lists have at most n clients
+func (c *Clients) Report() ClientsReport {
+	all := make([]ClientStats, 0, len(c.ips))
+	for ip, counter := range c.ips {
+		all = append(all, counter.stats(ip, c.rate))
+	}
+
+	// Clients with non-zero value, largest first
+	sorted := func(value func(ClientStats) int) []ClientStats {
+		clients := slices.DeleteFunc(slices.Clone(all), func(s ClientStats) bool { return value(s) == 0 })
+		slices.SortFunc(clients, func(a, b ClientStats) int {
+			if value(a) != value(b) {
+				return value(b) - value(a)
+			}
+			return strings.Compare(a.IP, b.IP)
+		})
+		return clients
+	}
+
+	byRequests := sorted(func(s ClientStats) int { return s.Requests })
+	byErrors := sorted(func(s ClientStats) int { return s.Errors })
+
+	// All clients over rate are listed, not only top ones
+	overRate := sorted(func(s ClientStats) int { return s.PeakRate })
+	overRate = slices.DeleteFunc(overRate, func(s ClientStats) bool { return s.MinutesOver == 0 })
+
+	report := ClientsReport{
+		Unique:     len(all),
+		Requests:   scaleCount(c.requests),
+		Rate:       c.rate,
+		ByRequests: byRequests[:min(len(byRequests), c.n)],
+		ByErrors:   byErrors[:min(len(byErrors), c.n)],
+		OverRate:   overRate,
+	}
+	if sampleRate < 1 {
+		report.SampleRate = sampleRate
+	}
+	return report
+}
+
+// Client report output
+func printClients(report ClientsReport, locale Locale) {
+	printSampleNote(os.Stdout, locale)
+	fmt.Printf("Unique clients: %s (%s requests)\n", locale.Int(report.Unique), locale.Int(report.Requests))
+
+	table := func(title string, clients []ClientStats) {
+		fmt.Printf("\n%s:\n", title)
+		if len(clients) == 0 {
+			fmt.Println("  none")
+			return
+		}
+
+		w := newTable(os.Stdout)
+		fmt.Fprintf(w, "IP\tREQUESTS\tERRORS\tERROR RATE\tPEAK/MIN\tPEAK AT\tMINUTES OVER\n")
+		for _, c := range clients {
+			peakAt := "-"
+			if !c.PeakAt.IsZero() {
+				peakAt = locale.FormatDateTime(c.PeakAt)
+			}
+
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+				c.IP,
+				locale.Int(c.Requests),
+				locale.Int(c.Errors),
+				locale.Percent(c.ErrorRate),
+				locale.Int(c.PeakRate),
+				peakAt,
+				locale.Int(c.MinutesOver),
+			)
+		}
+		w.Flush()
+	}
+
+	table("Top clients by requests", report.ByRequests)
+	table("Top clients by errors", report.ByErrors)
+	table(fmt.Sprintf("Clients above %s requests/min", locale.Int(report.Rate)), report.OverRate)
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// ANSI escapes of color output
+const (
+	ansiReset   = "\x1b[0m"
+	ansiRed     = "\x1b[31m"
+	ansiGreen   = "\x1b[32m"
+	ansiYellow  = "\x1b[33m"
+	ansiCyan    = "\x1b[36m"
+	ansiSlow    = "\x1b[1;35m"
+	ansiBoldRed = "\x1b[1;31m"
+)
+
+// Color of raw and metrics output on terminal, disabled by -no-color,
+// NO_COLOR or stdout not being terminal. Durations above colorSlow
+// are highlighted.
+var (
+	colorOutput bool
+	colorSlow   time.Duration
+)
+
+// Enabling color when stdout is terminal, it's checked after
+// -o replaced stdout, so output to files stays plain
+func setColor(disabled bool, slow time.Duration) {
+	colorOutput = !disabled && os.Getenv("NO_COLOR") == "" && os.Getenv("TERM") != "dumb" && isTerminal(os.Stdout)
+	colorSlow = slow
+}
+
+// Checking is file terminal
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// Wrapping text in color escape, text is kept as it is without color
+func colorize(text, color string) string {
+	if !colorOutput || color == "" {
+		return text
+	}
+	return color + text + ansiReset
+}
+
+// Color of status code: green 2xx, cyan 3xx, yellow 4xx, red 5xx
+func codeColor(code int) string {
+	switch {
+	case code >= 500:
+		return ansiRed
+	case code >= 400:
+		return ansiYellow
+	case code >= 300:
+		return ansiCyan
+	case code >= 200:
+		return ansiGreen
+	}
+	return ""
+}
+
+// Color of duration, slow durations are highlighted
+func durationColor(d time.Duration) string {
+	if colorSlow > 0 && d > colorSlow {
+		return ansiSlow
+	}
+	return ""
+}
+
+// Color of error rate, red when there are any server errors
+func errorRateColor(rate float64) string {
+	if rate > 0 {
+		return ansiBoldRed
+	}
+	return ""
+}
+
+// Raw mode output of one record with colored status code and
+// highlighted slow duration, aligned like writeRaw
+func writeColorRaw(w io.Writer, record LogRecord) error {
+	_, err := fmt.Fprintf(w, "%s | %s | %s | %15s | %-7s %#v\n",
+		record.Date.Format("2006/01/02 - 15:04:05"),
+		colorize(fmt.Sprintf("%3d", record.Code), codeColor(record.Code)),
+		colorize(fmt.Sprintf("%12s", strings.TrimSpace(formatDuration(record.Duration))), durationColor(record.Duration)),
+		strings.TrimSpace(record.IP),
+		strings.TrimSpace(record.Method),
+		strings.TrimSpace(record.URL),
+	)
+	return err
+}
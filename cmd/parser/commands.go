@@ -0,0 +1,578 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Subcommand with its own flags
+type command struct {
+	name    string
+	args    string
+	summary string
+
+	// Registering flags, options may be preset to command defaults
+	flags func(o *Options, fs *flag.FlagSet)
+
+	// Setting options implied by command after parsing,
+	// returns arguments left as inputs
+	apply func(o *Options, args []string) ([]string, error)
+}
+
+// Subcommands, old flags without subcommand keep working
+var subcommands = []command{
+	{
+		name:    "parse",
+		args:    "[file|url ...]",
+		summary: "Parse logs into record stream read by other commands (ginlog parse app.log | ginlog stats)",
+		flags: func(o *Options, fs *flag.FlagSet) {
+			o.filterFlags(fs)
+			o.inputFlags(fs)
+			o.routeFlags(fs)
+			o.outputFlags(fs)
+			o.summaryFlag(fs)
+			fs.StringVar(&o.FormatName, "format", "records", "Output: records (stream) or binary (record file mapped by repl, serve -http and reports)")
+		},
+		apply: func(o *Options, args []string) ([]string, error) {
+			if o.FormatName != "records" && o.FormatName != "binary" {
+				return nil, fmt.Errorf("-format must be records or binary")
+			}
+			return args, nil
+		},
+	},
+	{
+		name:    "stats",
+		args:    "[file|url ...]",
+		summary: "Metrics, group-by, histogram, time series, comparison and events reports",
+		flags: func(o *Options, fs *flag.FlagSet) {
+			o.filterFlags(fs)
+			o.inputFlags(fs)
+			o.routeFlags(fs)
+			o.metricsFlags(fs)
+			o.reportFlags(fs)
+			o.emitFlags(fs)
+			o.deliveryFlags(fs)
+			o.dryRunFlag(fs)
+			o.templateFlags(fs)
+			o.colorFlags(fs)
+			o.outputFlags(fs)
+			o.summaryFlag(fs)
+			fs.BoolVar(&o.JSONMetrics, "json", false, "Output metrics in JSON format")
+			fs.StringVar(&o.FormatName, "format", "", "Report format: text, ndjson (-interval, -events) or csv (-forecast)")
+		},
+		apply: func(o *Options, args []string) ([]string, error) {
+			switch {
+			case o.FormatName == "csv" && o.Forecast == 0:
+				return nil, fmt.Errorf("-format csv needs -forecast")
+			case o.FormatName == "ndjson" && o.Interval == 0 && o.EventsKind == "":
+				return nil, fmt.Errorf("-format ndjson needs -interval or -events")
+			case o.FormatName != "" && o.FormatName != "text" && o.FormatName != "csv" && o.FormatName != "ndjson":
+				return nil, fmt.Errorf("unknown report format %q (supported: text, ndjson, csv)", o.FormatName)
+			}
+			return args, nil
+		},
+	},
+	{
+		name:    "filter",
+		args:    "[file|url ...]",
+		summary: "Print matching records",
+		flags: func(o *Options, fs *flag.FlagSet) {
+			o.FormatName = "raw"
+			o.filterFlags(fs)
+			o.inputFlags(fs)
+			o.routeFlags(fs)
+			o.recordFlags(fs)
+			o.templateFlags(fs)
+			o.colorFlags(fs)
+			o.emitFlags(fs)
+			o.dryRunFlag(fs)
+			o.outputFlags(fs)
+			o.summaryFlag(fs)
+		},
+	},
+	{
+		name:    "top",
+		args:    "[file|url ...]",
+		summary: "Top N slowest requests, urls, ips or errors",
+		flags: func(o *Options, fs *flag.FlagSet) {
+			o.Top = "slowest"
+			o.filterFlags(fs)
+			o.inputFlags(fs)
+			o.routeFlags(fs)
+			o.metricsFlags(fs)
+			o.topFlags(fs, "by")
+			o.colorFlags(fs)
+			o.outputFlags(fs)
+			o.summaryFlag(fs)
+			fs.BoolVar(&o.JSONMetrics, "json", false, "Output report in JSON format")
+		},
+		apply: func(o *Options, args []string) ([]string, error) {
+			if o.Top == "" {
+				return nil, fmt.Errorf("-by can't be empty")
+			}
+			if o.Top == "slowest" && o.JSONMetrics {
+				o.FormatName = "json"
+			}
+			return args, nil
+		},
+	},
+	{
+		name:    "compare",
+		args:    "before.log after.log | -baseline-from T -baseline-to T [file|url ...]",
+		summary: "Compare metrics of two inputs or time windows with change in percent (e.g. before and after deploy)",
+		flags: func(o *Options, fs *flag.FlagSet) {
+			o.filterFlags(fs)
+			o.inputFlags(fs)
+			o.routeFlags(fs)
+			o.metricsFlags(fs)
+			o.outputFlags(fs)
+			o.summaryFlag(fs)
+			fs.StringVar(&o.BaselineFrom, "baseline-from", "", "Start of baseline window, compared with -from/-to window (by default from -baseline-to on)")
+			fs.StringVar(&o.BaselineTo, "baseline-to", "", "End of baseline window")
+			fs.BoolVar(&o.JSONMetrics, "json", false, "Output comparison in JSON format")
+		},
+		apply: func(o *Options, args []string) ([]string, error) {
+			o.Compare = true
+			switch {
+			case (o.BaselineFrom == "") != (o.BaselineTo == ""):
+				return nil, fmt.Errorf("-baseline-from and -baseline-to must be given together")
+			case o.BaselineFrom == "" && len(args) != 2:
+				return nil, fmt.Errorf("expected baseline and current inputs, or -baseline-from and -baseline-to")
+			}
+			return args, nil
+		},
+	},
+	{
+		name:    "mirror",
+		args:    "primary.log shadow.log",
+		summary: "Match requests of primary and shadow deployment getting mirrored traffic and report status and latency divergences",
+		flags: func(o *Options, fs *flag.FlagSet) {
+			o.filterFlags(fs)
+			o.inputFlags(fs)
+			o.routeFlags(fs)
+			o.outputFlags(fs)
+			o.summaryFlag(fs)
+			durationVar(fs, &o.MirrorWindow, "match-window", time.Second, "Greatest time between primary request and its mirrored copy")
+			fs.StringVar(&o.MirrorTolerance, "tolerance", "20%", "Latency difference of matched requests counted as slower or faster (e.g. 20% or 0.2)")
+			fs.BoolVar(&o.JSONMetrics, "json", false, "Output comparison in JSON format")
+		},
+		apply: func(o *Options, args []string) ([]string, error) {
+			o.Mirror = true
+			if len(args) != 2 {
+				return nil, fmt.Errorf("expected primary and shadow inputs")
+			}
+			return args, nil
+		},
+	},
+	{
+		name:    "check",
+		args:    "-max-error-rate 1% -max-p95 300ms [file|url ...]",
+		summary: "Check thresholds of metrics for CI gates, exit code 8 when any is violated",
+		flags: func(o *Options, fs *flag.FlagSet) {
+			o.filterFlags(fs)
+			o.inputFlags(fs)
+			o.routeFlags(fs)
+			o.metricsFlags(fs)
+			o.outputFlags(fs)
+			o.summaryFlag(fs)
+			fs.Func("max-error-rate", "Maximal error rate (e.g. 1% or 0.01)", func(value string) error {
+				return o.CheckExprs.Set("error_rate > " + value)
+			})
+			for _, p := range []string{"p50", "p90", "p95", "p99"} {
+				fs.Func("max-"+p, "Maximal "+p+" latency (e.g. 300ms)", func(value string) error {
+					return o.CheckExprs.Set(p + " > " + value)
+				})
+			}
+			fs.Func("min-requests", "Minimal number of requests, so check of idle canary fails", func(value string) error {
+				return o.CheckExprs.Set("count < " + value)
+			})
+			fs.Var(&o.CheckExprs, "rule", "Failing condition like alert rule (e.g. \"max > 5s\"), repeatable")
+			fs.BoolVar(&o.JSONMetrics, "json", false, "Output check in JSON format")
+		},
+		apply: func(o *Options, args []string) ([]string, error) {
+			if len(o.CheckExprs) == 0 {
+				return nil, fmt.Errorf("no thresholds, use -max-error-rate, -max-p95 or other -max-* flags")
+			}
+			return args, nil
+		},
+	},
+	{
+		name:    "repl",
+		args:    "file|url ...",
+		summary: "Load logs once and query them interactively (filter, where, stats, group, top, show, reset)",
+		flags: func(o *Options, fs *flag.FlagSet) {
+			o.filterFlags(fs)
+			o.inputFlags(fs)
+			o.routeFlags(fs)
+			o.metricsFlags(fs)
+		},
+		apply: func(o *Options, args []string) ([]string, error) {
+			o.Repl = true
+			if len(args) == 0 && o.ArchiveFile == "" && o.SSHFile == "" {
+				return nil, fmt.Errorf("expected input files, stdin is used for queries")
+			}
+			return args, nil
+		},
+	},
+	{
+		name:    "incident",
+		args:    "-from T -to T -o incident.tar.gz [file|url ...]",
+		summary: "Bundle raw lines, metrics, route tables, timeline chart and anomalies of time window into tar.gz for incident ticket",
+		flags: func(o *Options, fs *flag.FlagSet) {
+			o.filterFlags(fs)
+			o.inputFlags(fs)
+			o.routeFlags(fs)
+			o.metricsFlags(fs)
+			o.anomalyFlags(fs)
+			o.summaryFlag(fs)
+			fs.StringVar(&o.OutputFile, "o", "", "Bundle file, written to stdout without it")
+			durationVar(fs, &o.Anomaly.Interval, "interval", time.Minute, "Interval of timeline and anomalies")
+		},
+		apply: func(o *Options, args []string) ([]string, error) {
+			o.Incident = true
+			if o.From == "" || o.To == "" {
+				return nil, fmt.Errorf("-from and -to of incident window are required")
+			}
+			return args, nil
+		},
+	},
+	{
+		name:    "report",
+		args:    "-o report.html [file|url ...]",
+		summary: "Render offline HTML page with summary, status code and latency charts, requests over time and top endpoints",
+		flags: func(o *Options, fs *flag.FlagSet) {
+			o.filterFlags(fs)
+			o.inputFlags(fs)
+			o.routeFlags(fs)
+			o.metricsFlags(fs)
+			o.bucketsFlag(fs)
+			o.summaryFlag(fs)
+			fs.StringVar(&o.OutputFile, "o", "", "Report file, written to stdout without it")
+			fs.StringVar(&o.ReportTitle, "title", "Gin log report", "Title of report page")
+			durationVar(fs, &o.ReportInterval, "interval", time.Minute, "Interval of requests over time chart, merged when there are too many")
+		},
+		apply: func(o *Options, args []string) ([]string, error) {
+			o.HTMLReport = true
+			if o.ReportInterval <= 0 {
+				return nil, fmt.Errorf("-interval must be positive")
+			}
+			return args, nil
+		},
+	},
+	{
+		name:    "record-fixtures",
+		args:    "-o fixtures/ [-sample N] [-per-route N] [file|url ...]",
+		summary: "Write anonymized sample requests of every route as JSON or YAML test fixtures",
+		flags: func(o *Options, fs *flag.FlagSet) {
+			o.filterFlags(fs)
+			withoutFlags(fs, o.inputFlags, "sample", "sample-every")
+			o.routeFlags(fs)
+			fs.StringVar(&o.FixturesDir, "o", "fixtures", "Directory of fixture files, one per route")
+			fs.IntVar(&o.FixturesTotal, "sample", 100, "Total number of sampled requests, busiest routes are kept when there are more routes")
+			fs.IntVar(&o.FixturesPerRoute, "per-route", 5, "Number of sampled requests per route, spread over its methods and status classes")
+			fs.StringVar(&o.FixturesFormat, "format", "json", "Format of fixture files: json or yaml")
+		},
+		apply: func(o *Options, args []string) ([]string, error) {
+			if o.FixturesDir == "" {
+				return nil, fmt.Errorf("-o directory is required")
+			}
+			if o.FixturesTotal <= 0 || o.FixturesPerRoute <= 0 {
+				return nil, fmt.Errorf("-sample and -per-route must be positive")
+			}
+			if !slices.Contains(fixtureFormats, o.FixturesFormat) {
+				return nil, fmt.Errorf("unknown -format %q, expected json or yaml", o.FixturesFormat)
+			}
+			return args, nil
+		},
+	},
+	{
+		name:    "baseline save",
+		args:    "baseline.json [file|url ...]",
+		summary: "Save per route metrics of traffic as baseline profile for baseline check",
+		flags: func(o *Options, fs *flag.FlagSet) {
+			o.filterFlags(fs)
+			o.inputFlags(fs)
+			o.routeFlags(fs)
+			o.metricsFlags(fs)
+			o.summaryFlag(fs)
+		},
+		apply: func(o *Options, args []string) ([]string, error) {
+			if len(args) == 0 {
+				return nil, fmt.Errorf("expected baseline file to write")
+			}
+			o.BaselineSave = args[0]
+			return args[1:], nil
+		},
+	},
+	{
+		name:    "baseline check",
+		args:    "-against baseline.json [file|url ...]",
+		summary: "Check per route error rate and percentiles against baseline profile, exit code 7 when routes regressed beyond tolerance",
+		flags: func(o *Options, fs *flag.FlagSet) {
+			o.filterFlags(fs)
+			o.inputFlags(fs)
+			o.routeFlags(fs)
+			o.metricsFlags(fs)
+			o.summaryFlag(fs)
+			fs.StringVar(&o.BaselineAgainst, "against", "", "Baseline profile of baseline save, its percentiles are checked")
+			fs.StringVar(&o.Tolerance, "tolerance", "10%", "Allowed growth of error rate and percentiles over baseline (e.g. 10% or 0.1)")
+			fs.BoolVar(&o.JSONMetrics, "json", false, "Output check in JSON format")
+		},
+		apply: func(o *Options, args []string) ([]string, error) {
+			if o.BaselineAgainst == "" {
+				return nil, fmt.Errorf("-against baseline.json is required")
+			}
+			return args, nil
+		},
+	},
+	{
+		name:    "tail",
+		args:    "file",
+		summary: "Follow log file like tail -F and print matching records",
+		flags: func(o *Options, fs *flag.FlagSet) {
+			o.FormatName = "raw"
+			o.filterFlags(fs)
+			o.lineFlags(fs)
+			o.routeFlags(fs)
+			o.recordFlags(fs)
+			o.templateFlags(fs)
+			o.colorFlags(fs)
+			o.emitFlags(fs)
+		},
+		apply: func(o *Options, args []string) ([]string, error) {
+			if len(args) != 1 {
+				return nil, fmt.Errorf("expected one file to follow")
+			}
+			o.FollowFile = args[0]
+			return nil, nil
+		},
+	},
+	{
+		name:    "dash",
+		args:    "file",
+		summary: "Live terminal dashboard of followed log: requests/sec, error rate, p95 and recent 5xx and slow requests",
+		flags: func(o *Options, fs *flag.FlagSet) {
+			o.filterFlags(fs)
+			o.lineFlags(fs)
+			o.routeFlags(fs)
+			o.colorFlags(fs)
+			durationVar(fs, &o.DashWindow, "window", time.Minute, "Window of requests/sec, error rate and p95")
+			durationVar(fs, &o.DashRefresh, "refresh", time.Second, "Interval of redrawing dashboard")
+			fs.IntVar(&o.DashRecent, "recent", 20, "Number of recent 5xx and slow (-slow) requests shown")
+			fs.Var(&o.DashBudgets, "budget", "Latency budget of routes matching pattern, like \"/api/payments/**=300ms\", routes over it are shown by budget burn (repeatable, first match wins)")
+			fs.IntVar(&o.DashBurnRoutes, "burn-routes", 5, "Number of routes shown by budget burn")
+		},
+		apply: func(o *Options, args []string) ([]string, error) {
+			if len(args) != 1 {
+				return nil, fmt.Errorf("expected one file to follow")
+			}
+			if o.DashWindow < time.Second || o.DashRefresh <= 0 || o.DashRecent < 0 || o.DashBurnRoutes < 1 {
+				return nil, fmt.Errorf("-window must be at least 1s, -refresh positive, -recent not negative and -burn-routes positive")
+			}
+			o.Dash = true
+			o.FollowFile = args[0]
+			return nil, nil
+		},
+	},
+	{
+		name:    "consume",
+		args:    "-kafka brokers=HOST:PORT[,...] topic=NAME [group=NAME] [offset=beginning|end|stored] [property=value ...]",
+		summary: "Read log lines from Kafka topic with kcat and print metrics every interval, or stream records with -format",
+		flags: func(o *Options, fs *flag.FlagSet) {
+			o.filterFlags(fs)
+			o.lineFlags(fs)
+			o.routeFlags(fs)
+			o.metricsFlags(fs)
+			fs.StringVar(&o.KafkaFields, "kafka", "", "Topic to consume as key=value fields: brokers, topic, group, offset and librdkafka properties")
+			durationVar(fs, &o.ConsumeEvery, "every", time.Minute, "Interval of metrics output")
+			fs.StringVar(&o.FormatName, "format", "", "Output: text (metrics every -every), raw, ndjson or records (records as they are read)")
+			fs.BoolVar(&o.JSONMetrics, "json", false, "Output metrics of each interval as JSON line")
+		},
+		apply: func(o *Options, args []string) ([]string, error) {
+			fields := strings.Fields(o.KafkaFields)
+			for _, arg := range args {
+				if !strings.Contains(arg, "=") {
+					return nil, fmt.Errorf("expected key=value fields of -kafka, consume reads no files (got %q)", arg)
+				}
+				fields = append(fields, arg)
+			}
+			spec, err := parseKafkaSpec(fields)
+			if err != nil {
+				return nil, fmt.Errorf("-kafka: %w", err)
+			}
+			if !slices.Contains([]string{"", "text", "raw", "ndjson", "records"}, o.FormatName) {
+				return nil, fmt.Errorf("-format must be text, raw, ndjson or records")
+			}
+			if o.ConsumeEvery <= 0 {
+				return nil, fmt.Errorf("-every must be positive")
+			}
+			o.Kafka = &spec
+			return nil, nil
+		},
+	},
+	{
+		name:    "index",
+		args:    "file ...",
+		summary: "Write block index next to log files, so runs filtering by -from, -to, -code, -class or duration read only blocks which can match",
+		flags: func(o *Options, fs *flag.FlagSet) {
+			o.lineFlags(fs)
+		},
+		apply: func(o *Options, args []string) ([]string, error) {
+			if len(args) == 0 {
+				return nil, fmt.Errorf("expected log files to index")
+			}
+			o.IndexFiles = args
+			return nil, nil
+		},
+	},
+	{
+		name:    "serve",
+		args:    "[file|url ...]",
+		summary: "Serve Prometheus metrics, and records and their metrics over REST API, while reading input",
+		flags: func(o *Options, fs *flag.FlagSet) {
+			o.filterFlags(fs)
+			o.inputFlags(fs)
+			o.routeFlags(fs)
+			o.metricsFlags(fs)
+			o.bucketsFlag(fs)
+			fs.StringVar(&o.ServeAddr, "addr", ":9100", "Address to serve metrics at")
+			fs.StringVar(&o.FollowFile, "follow", "", "Read log file and keep waiting for new lines, like tail -F")
+			fs.StringVar(&o.FollowFile, "ingest", "", "Same as -follow")
+			fs.StringVar(&o.APIAddr, "http", "", "Serve /records, /metrics/summary and /metrics/timeseries at address (e.g. :8080) with /metrics instead of -addr")
+			fs.IntVar(&o.APIRetain, "retain", 1000000, "Number of newest records kept in memory for -http")
+			fs.BoolVar(&o.NativeHistograms, "native-histograms", false, "Serve native latency histograms next to classic buckets to Prometheus scraping protobuf")
+			fs.StringVar(&o.InitCounters, "init-counters", "", "Start counters and histograms from metrics of earlier exporter in this file (text exposition format)")
+			fs.BoolVar(&o.Jobs, "jobs", false, "Run jobs of config file on their schedule, status at /jobs")
+			fs.StringVar(&o.SilencesFile, "silences", "", "JSON file of alert silences managed at /silences, read by -silences of jobs and other runs")
+		},
+		apply: func(o *Options, args []string) ([]string, error) {
+			if o.APIAddr != "" {
+				if o.APIRetain <= 0 {
+					return nil, fmt.Errorf("-retain must be positive")
+				}
+				o.ServeAddr = o.APIAddr
+			}
+			return args, nil
+		},
+	},
+	{
+		name:    "export",
+		args:    "[file|url ...]",
+		summary: "Write records as csv, json, ndjson or prometheus, to SQLite database, OpenTelemetry collector, or time bucket rollups",
+		flags: func(o *Options, fs *flag.FlagSet) {
+			o.FormatName = "ndjson"
+			o.filterFlags(fs)
+			o.inputFlags(fs)
+			o.routeFlags(fs)
+			o.recordFlags(fs)
+			o.rollupFlags(fs)
+			o.sqliteFlag(fs)
+			o.otlpFlags(fs)
+			o.metricsFlags(fs)
+			o.dryRunFlag(fs)
+			o.outputFlags(fs)
+			o.summaryFlag(fs)
+		},
+	},
+}
+
+// Finding subcommand by name
+func findCommand(name string) (command, bool) {
+	for _, cmd := range subcommands {
+		if cmd.name == name {
+			return cmd, true
+		}
+	}
+	return command{}, false
+}
+
+// Parsing flags which may follow inputs (ginlog stats app.log -group-by url),
+// returns inputs. Arguments after "--" are inputs.
+func parseInterspersed(fs *flag.FlagSet, args []string) []string {
+	var inputs []string
+	for {
+		fs.Parse(args)
+		rest := fs.Args()
+		if len(rest) == 0 || len(rest) < len(args) && args[len(args)-len(rest)-1] == "--" {
+			return append(inputs, rest...)
+		}
+
+		inputs = append(inputs, rest[0])
+		args = rest[1:]
+	}
+}
+
+// Registering flags of group except ones command defines differently
+func withoutFlags(fs *flag.FlagSet, group func(*flag.FlagSet), names ...string) {
+	all := flag.NewFlagSet("", flag.ContinueOnError)
+	group(all)
+	all.VisitAll(func(f *flag.Flag) {
+		if !slices.Contains(names, f.Name) {
+			fs.Var(f.Value, f.Name, f.Usage)
+		}
+	})
+}
+
+// Parsing command line, returns options and input arguments.
+// Without known subcommand all flags are accepted as before.
+func parseCommandLine(args []string) (*Options, []string) {
+	o := &Options{}
+
+	// Commands with action, e.g. "baseline save"
+	if len(args) > 1 {
+		if _, ok := findCommand(args[0] + " " + args[1]); ok {
+			args = append([]string{args[0] + " " + args[1]}, args[2:]...)
+		}
+	}
+
+	if len(args) > 0 {
+		if cmd, ok := findCommand(args[0]); ok {
+			// Defaults of flags not accepted by command
+			o.legacyFlags(flag.NewFlagSet("defaults", flag.ContinueOnError))
+
+			fs := flag.NewFlagSet(cmd.name, flag.ExitOnError)
+			cmd.flags(o, fs)
+			o.presetFlag(fs)
+			o.durationUnitFlag(fs)
+			fs.Usage = func() {
+				fmt.Fprintf(fs.Output(), "Usage: ginlog %s [flags] %s\n\n%s\n\nFlags:\n", cmd.name, cmd.args, cmd.summary)
+				fs.PrintDefaults()
+			}
+			rest := parseInterspersed(fs, args[1:])
+			if cmd.apply != nil {
+				var err error
+				if rest, err = cmd.apply(o, rest); err != nil {
+					fmt.Fprintf(os.Stderr, "Error in arguments: %v\n", err)
+					os.Exit(2)
+				}
+			}
+			return o, rest
+		}
+	}
+
+	o.legacyFlags(flag.CommandLine)
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: ginlog [command] [flags] [file|url ...]\n\nCommands:\n")
+		for _, cmd := range subcommands {
+			fmt.Fprintf(flag.CommandLine.Output(), "  %-15s %s\n", cmd.name, cmd.summary)
+		}
+		fmt.Fprintf(flag.CommandLine.Output(), "  %-15s %s\n", "ssh", "Read remote log file (ginlog ssh user@host:/path [flags])")
+		fmt.Fprintf(flag.CommandLine.Output(), "  %-15s %s\n", "query", "Run SQL over database of export -sqlite (ginlog query -sqlite logs.db \"SELECT ...\")")
+		fmt.Fprintf(flag.CommandLine.Output(), "  %-15s %s\n", "resume", "Send rest of export stopped by sink failure (ginlog resume export.checkpoint)")
+		fmt.Fprintf(flag.CommandLine.Output(), "  %-15s %s\n", "store", "Delete old records of export -sqlite database and vacuum it (ginlog store compact -sqlite logs.db -retention 30d)")
+		fmt.Fprintf(flag.CommandLine.Output(), "  %-15s %s\n", "view", "Save command with flags as named view and run it (ginlog view save|run|list|rm)")
+		fmt.Fprintf(flag.CommandLine.Output(), "  %-15s %s\n", "devserver", "Serve toy gin log stream over HTTP and WebSocket for development (ginlog devserver -rate 50)")
+		fmt.Fprintf(flag.CommandLine.Output(), "  %-15s %s\n", "config", "Upgrade config file schema (ginlog config migrate [-dry-run])")
+		fmt.Fprintf(flag.CommandLine.Output(), "  %-15s %s\n", "self-update", "Update to latest release")
+		fmt.Fprintf(flag.CommandLine.Output(), "  %-15s %s\n", "capabilities", "List supported formats, reports and flags")
+		fmt.Fprintf(flag.CommandLine.Output(), "\nWithout command all flags below are accepted:\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	return o, flag.Args()
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"math"
+	"os"
+	"slices"
+	"time"
+)
+
+// Minimal number of samples on each side for significance test
+const minCompareSamples = 5
+
+// Latency comparison of route between two periods
+type RouteComparison struct {
+	Route     string        `json:"route"`
+	Before    int           `json:"before_count"`
+	After     int           `json:"after_count"`
+	BeforeP50 time.Duration `json:"before_p50"`
+	AfterP50  time.Duration `json:"after_p50"`
+	Change    float64       `json:"change"`
+	PValue    float64       `json:"p_value"`
+	Verdict   string        `json:"verdict"`
+}
+
+// Comparing route latencies of two periods.
+// Significance is calculated with Mann-Whitney U test, so low-traffic
+// routes with a few slow requests are not reported as regressions.
+// Routes are ranked by significance, then by size of change.
+func compareRoutes(beforeRoutes, afterRoutes map[string][]time.Duration, alpha float64) []RouteComparison {
+	comparisons := []RouteComparison{}
+	for route, a := range beforeRoutes {
+		b, ok := afterRoutes[route]
+		if !ok {
+			continue
+		}
+
+		c := RouteComparison{
+			Route:     route,
+			Before:    len(a),
+			After:     len(b),
+			BeforeP50: median(a),
+			AfterP50:  median(b),
+			PValue:    1,
+		}
+
+		if c.BeforeP50 > 0 {
+			c.Change = float64(c.AfterP50-c.BeforeP50) / float64(c.BeforeP50)
+		}
+
+		switch {
+		case len(a) < minCompareSamples || len(b) < minCompareSamples:
+			c.Verdict = "insufficient data"
+		default:
+			c.PValue = mannWhitneyU(a, b)
+			if c.PValue >= alpha {
+				c.Verdict = "noise"
+			} else if c.AfterP50 > c.BeforeP50 {
+				c.Verdict = "regression"
+			} else {
+				c.Verdict = "improvement"
+			}
+		}
+
+		comparisons = append(comparisons, c)
+	}
+
+	slices.SortFunc(comparisons, func(x, y RouteComparison) int {
+		if c := cmp.Compare(x.PValue, y.PValue); c != 0 {
+			return c
+		}
+		if c := cmp.Compare(math.Abs(y.Change), math.Abs(x.Change)); c != 0 {
+			return c
+		}
+		return cmp.Compare(x.Route, y.Route)
+	})
+
+	return comparisons
+}
+
+// Durations per route on both sides of split time.
+// Significance test needs all samples, so only durations are kept.
+type SplitSamples struct {
+	at     time.Time
+	Before map[string][]time.Duration
+	After  map[string][]time.Duration
+}
+
+func NewSplitSamples(at time.Time) *SplitSamples {
+	return &SplitSamples{
+		at:     at,
+		Before: make(map[string][]time.Duration),
+		After:  make(map[string][]time.Duration),
+	}
+}
+
+// Adding record duration to its route and side
+func (s *SplitSamples) Add(record LogRecord) {
+	routes := s.After
+	if record.Date.Before(s.at) {
+		routes = s.Before
+	}
+
+	route := groupKey(record, "url")
+	routes[route] = append(routes[route], record.Duration)
+}
+
+// Median of durations
+func median(durations []time.Duration) time.Duration {
+	var q Quantiles
+	for _, d := range durations {
+		q.Add(d)
+	}
+	return q.Quantile(50)
+}
+
+// Two-sided Mann-Whitney U test p-value, normal approximation
+// with tie correction
+func mannWhitneyU(a, b []time.Duration) float64 {
+	type sample struct {
+		value time.Duration
+		first bool
+	}
+
+	samples := make([]sample, 0, len(a)+len(b))
+	for _, d := range a {
+		samples = append(samples, sample{d, true})
+	}
+	for _, d := range b {
+		samples = append(samples, sample{d, false})
+	}
+	slices.SortFunc(samples, func(x, y sample) int {
+		return cmp.Compare(x.value, y.value)
+	})
+
+	// Ranks with ties averaged
+	n := float64(len(samples))
+	var rankSum, tieTerm float64
+	for i := 0; i < len(samples); {
+		j := i
+		for j < len(samples) && samples[j].value == samples[i].value {
+			j++
+		}
+
+		rank := float64(i+j+1) / 2
+		for k := i; k < j; k++ {
+			if samples[k].first {
+				rankSum += rank
+			}
+		}
+
+		t := float64(j - i)
+		tieTerm += t*t*t - t
+		i = j
+	}
+
+	n1, n2 := float64(len(a)), float64(len(b))
+	u := rankSum - n1*(n1+1)/2
+	mean := n1 * n2 / 2
+	variance := n1 * n2 / 12 * ((n + 1) - tieTerm/(n*(n-1)))
+	if variance <= 0 {
+		return 1
+	}
+
+	// Continuity correction
+	z := (math.Abs(u-mean) - 0.5) / math.Sqrt(variance)
+	if z < 0 {
+		z = 0
+	}
+
+	return math.Erfc(z / math.Sqrt2)
+}
+
+// Comparison output
+func printComparison(comparisons []RouteComparison, locale Locale) {
+	w := newTable(os.Stdout)
+	defer w.Flush()
+
+	fmt.Fprintf(w, "ROUTE\tBEFORE\tAFTER\tP50 BEFORE\tP50 AFTER\tCHANGE\tP-VALUE\tVERDICT\n")
+
+	for _, c := range comparisons {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			c.Route,
+			locale.Int(c.Before),
+			locale.Int(c.After),
+			locale.Duration(c.BeforeP50),
+			locale.Duration(c.AfterP50),
+			signed(locale.Percent(c.Change), c.Change),
+			locale.Float(c.PValue, 4),
+			c.Verdict,
+		)
+	}
+}
+
+// Adding plus sign to positive value
+func signed(formatted string, value float64) string {
+	if value > 0 {
+		return "+" + formatted
+	}
+	return formatted
+}
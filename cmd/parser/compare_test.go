@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+	"time"
+)
+
+func durations(from, to int) []time.Duration {
+	var values []time.Duration
+	for i := from; i <= to; i++ {
+		values = append(values, time.Duration(i)*time.Millisecond)
+	}
+	return values
+}
+
+func TestMannWhitneyU(t *testing.T) {
+	a, b := durations(1, 10), durations(11, 20)
+
+	// U = 0, mean 50, variance 10*10/12*21 = 175
+	want := math.Erfc((50 - 0.5) / math.Sqrt(175) / math.Sqrt2)
+	if got := mannWhitneyU(a, b); math.Abs(got-want) > 1e-12 {
+		t.Errorf("separated samples: p = %g, want %g", got, want)
+	}
+	if got := mannWhitneyU(b, a); math.Abs(got-want) > 1e-12 {
+		t.Errorf("swapped samples: p = %g, want %g", got, want)
+	}
+	if got := mannWhitneyU(a, a); got != 1 {
+		t.Errorf("same samples: p = %g, want 1", got)
+	}
+
+	same := []time.Duration{time.Second, time.Second, time.Second}
+	if got := mannWhitneyU(same, same); got != 1 {
+		t.Errorf("all ties: p = %g, want 1", got)
+	}
+
+	// Interleaved samples are not significant
+	odd, even := make([]time.Duration, 0, 10), make([]time.Duration, 0, 10)
+	for i := 1; i <= 20; i++ {
+		if i%2 == 1 {
+			odd = append(odd, time.Duration(i))
+		} else {
+			even = append(even, time.Duration(i))
+		}
+	}
+	if got := mannWhitneyU(odd, even); got < 0.5 {
+		t.Errorf("interleaved samples: p = %g, want >= 0.5", got)
+	}
+}
+
+func TestCompareRoutes(t *testing.T) {
+	before := map[string][]time.Duration{
+		"/slower": durations(1, 10),
+		"/faster": durations(11, 20),
+		"/same":   durations(1, 10),
+		"/rare":   durations(1, minCompareSamples-1),
+		"/gone":   durations(1, 10),
+	}
+	after := map[string][]time.Duration{
+		"/slower": durations(11, 20),
+		"/faster": durations(1, 10),
+		"/same":   durations(1, 10),
+		"/rare":   durations(100, 110),
+		"/new":    durations(1, 10),
+	}
+
+	verdicts := map[string]string{}
+	for _, c := range compareRoutes(before, after, 0.05) {
+		verdicts[c.Route] = c.Verdict
+	}
+	want := map[string]string{
+		"/slower": "regression",
+		"/faster": "improvement",
+		"/same":   "noise",
+		"/rare":   "insufficient data",
+	}
+	if len(verdicts) != len(want) {
+		t.Errorf("got routes %v, want %v", verdicts, want)
+	}
+	for route, verdict := range want {
+		if verdicts[route] != verdict {
+			t.Errorf("%s: verdict %q, want %q", route, verdicts[route], verdict)
+		}
+	}
+
+	comparisons := compareRoutes(before, after, 0.05)
+	if last := comparisons[len(comparisons)-1]; last.PValue != 1 {
+		t.Errorf("last route %s has p = %g, want least significant last", last.Route, last.PValue)
+	}
+
+	// No common routes are [] in JSON like empty -interval
+	empty, _ := json.Marshal(compareRoutes(before, map[string][]time.Duration{}, 0.05))
+	series, _ := (&TimeSeries{}).Buckets()
+	buckets, _ := json.Marshal(series)
+	if string(empty) != "[]" || string(buckets) != "[]" {
+		t.Errorf("empty comparison %s and time series %s, want []", empty, buckets)
+	}
+}
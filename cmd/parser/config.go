@@ -0,0 +1,197 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Version of config file schema written by "ginlog config migrate".
+// Files without version field are version 1.
+const configVersion = 2
+
+// Change of config file made by migration, old lines starting at
+// index line are replaced with new ones (inserted when there are none)
+type configChange struct {
+	line   int
+	old    []string
+	new    []string
+	reason string
+}
+
+// Migrations of config file, index i upgrades version i+1.
+// Migrations keep comments and layout of lines they don't change.
+var configMigrations = []func(lines []string) ([]string, []configChange){
+	migrateConfigV1,
+}
+
+// Version of config file lines, from top-level version field
+func configFileVersion(lines []string) (int, error) {
+	for _, line := range lines {
+		key, value, ok := strings.Cut(stripYAMLComment(line), ":")
+		if !ok || key != "version" {
+			continue
+		}
+
+		value, err := yamlScalar(value)
+		if err != nil {
+			return 0, err
+		}
+		version, err := strconv.Atoi(value)
+		if err != nil || version < 1 {
+			return 0, fmt.Errorf("invalid config version %q", value)
+		}
+		return version, nil
+	}
+	return 1, nil
+}
+
+// Checking is config version supported by this build
+func checkConfigVersion(version int) error {
+	if version > configVersion {
+		return fmt.Errorf("config version %d is newer than supported version %d, upgrade ginlog", version, configVersion)
+	}
+	return nil
+}
+
+// Version 1 to 2: explicit version field, and legacy -raw of presets
+// replaced with -format raw, as commands don't accept -raw
+func migrateConfigV1(lines []string) ([]string, []configChange) {
+	var changes []configChange
+
+	// Version goes after leading comments
+	insert := 0
+	for insert < len(lines) && strings.TrimSpace(stripYAMLComment(lines[insert])) == "" {
+		insert++
+	}
+	changes = append(changes, configChange{
+		line:   insert,
+		new:    []string{fmt.Sprintf("version: %d", configVersion)},
+		reason: "add explicit schema version, older ginlog builds ignore it",
+	})
+
+	// Presets with raw: true and without format
+	var section string
+	presetIndent := -1
+	raw, hasFormat := -1, false
+	finish := func() {
+		if raw >= 0 && !hasFormat {
+			line := lines[raw]
+			indent := line[:len(line)-len(strings.TrimLeft(line, " "))]
+			comment := line[len(strings.TrimRight(stripYAMLComment(line), " ")):]
+			changes = append(changes, configChange{
+				line:   raw,
+				old:    []string{line},
+				new:    []string{indent + "format: raw" + comment},
+				reason: "-raw is accepted only without command, -format raw by every command",
+			})
+		}
+		raw, hasFormat = -1, false
+	}
+
+	for i, line := range lines {
+		content := strings.TrimSpace(stripYAMLComment(line))
+		if content == "" {
+			continue
+		}
+		indent := len(line) - len(strings.TrimLeft(line, " "))
+		key, value, _ := strings.Cut(content, ":")
+		value, _ = yamlScalar(value)
+
+		switch {
+		case indent == 0:
+			finish()
+			section, presetIndent = key, -1
+		case section != "presets":
+		case presetIndent == -1 || indent <= presetIndent:
+			finish()
+			presetIndent = indent
+		case key == "raw" && value == "true":
+			raw = i
+		case key == "format":
+			hasFormat = true
+		}
+	}
+	finish()
+
+	return applyConfigChanges(lines, changes), changes
+}
+
+// Lines with changes applied, changes are in order of lines
+func applyConfigChanges(lines []string, changes []configChange) []string {
+	var out []string
+	next := 0
+	for _, c := range changes {
+		out = append(out, lines[next:c.line]...)
+		out = append(out, c.new...)
+		next = c.line + len(c.old)
+	}
+	return append(out, lines[next:]...)
+}
+
+// "ginlog config migrate [-config path] [-dry-run]"
+func runConfig(args []string) error {
+	if len(args) == 0 || args[0] != "migrate" {
+		return fmt.Errorf("usage: ginlog config migrate [-config path] [-dry-run]")
+	}
+
+	fs := flag.NewFlagSet("config migrate", flag.ExitOnError)
+	path := fs.String("config", configPath(), "Config file to migrate")
+	dryRun := fs.Bool("dry-run", false, "Print changes without writing file")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: ginlog config migrate [flags]\n\nUpgrade config file to schema version %d, printing every change\n\nFlags:\n", configVersion)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args[1:])
+
+	data, err := os.ReadFile(*path)
+	if err != nil {
+		return err
+	}
+
+	text := string(data)
+	lines := strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+
+	version, err := configFileVersion(lines)
+	if err != nil {
+		return fmt.Errorf("%s: %w", *path, err)
+	}
+	if err := checkConfigVersion(version); err != nil {
+		return fmt.Errorf("%s: %w", *path, err)
+	}
+	if version == configVersion {
+		fmt.Printf("%s: already at version %d\n", *path, configVersion)
+		return nil
+	}
+
+	fmt.Printf("%s: version %d -> %d\n", *path, version, configVersion)
+	for v := version; v < configVersion; v++ {
+		migrated, changes := configMigrations[v-1](lines)
+		for _, c := range changes {
+			fmt.Printf("@@ line %d: %s (%d -> %d)\n", c.line+1, c.reason, v, v+1)
+			for _, line := range c.old {
+				fmt.Printf("-%s\n", line)
+			}
+			for _, line := range c.new {
+				fmt.Printf("+%s\n", line)
+			}
+		}
+		lines = migrated
+	}
+
+	if *dryRun {
+		return nil
+	}
+
+	out, err := createAtomic(*path, false)
+	if err != nil {
+		return err
+	}
+	if _, err := out.File().WriteString(strings.Join(lines, "\n") + "\n"); err != nil {
+		out.Abort()
+		return err
+	}
+	return out.Commit()
+}
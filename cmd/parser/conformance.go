@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bufio"
+	"cmp"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Kinds of traffic outside allowlist
+const (
+	unknownRoute     = "unknown_route"
+	unexpectedMethod = "unexpected_method"
+)
+
+// Example paths kept per violation
+const conformanceExamples = 3
+
+// Route of -conformance allowlist with its allowed methods, no
+// methods allows any
+type AllowedRoute struct {
+	Methods []string
+	Route   RoutePattern
+}
+
+// Loading allowlist of method and route pairs, one per line
+// ("GET /users/:id", "GET,POST /orders", "/health" for any method).
+// Empty lines and lines starting with # are ignored, [GIN-debug]
+// route registrations are read as they are, so startup output of
+// service can be used as allowlist.
+func loadAllowlist(path string) ([]AllowedRoute, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var routes []AllowedRoute
+	scanner := bufio.NewScanner(file)
+
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(ansiEscape.ReplaceAllString(scanner.Text(), ""))
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		var fields []string
+		if m := routeLine.FindStringSubmatch(line); m != nil {
+			fields = m[1:3]
+		} else {
+			fields = strings.Fields(line)
+		}
+		if len(fields) > 2 {
+			return nil, fmt.Errorf("%s:%d: expected methods and route", path, n)
+		}
+
+		pattern := fields[len(fields)-1]
+		if !strings.HasPrefix(pattern, "/") {
+			return nil, fmt.Errorf("%s:%d: route must start with /", path, n)
+		}
+
+		route := AllowedRoute{Route: RoutePattern{Pattern: pattern, segments: splitPath(pattern)}}
+		if len(fields) == 2 && fields[0] != "*" && fields[0] != "ANY" {
+			for _, method := range strings.Split(fields[0], ",") {
+				route.Methods = append(route.Methods, strings.ToUpper(strings.TrimSpace(method)))
+			}
+		}
+		routes = append(routes, route)
+	}
+
+	return routes, scanner.Err()
+}
+
+// Traffic of one method and route outside allowlist
+type Violation struct {
+	Kind      string    `json:"kind"`
+	Method    string    `json:"method"`
+	Route     string    `json:"route"`
+	Allowed   []string  `json:"allowed,omitempty"`
+	Requests  int       `json:"requests"`
+	Errors    int       `json:"errors"`
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+	Examples  []string  `json:"examples"`
+}
+
+// Conformance report
+type ConformanceReport struct {
+	Requests   int         `json:"requests"`
+	Conforming int         `json:"conforming"`
+	Violations []Violation `json:"violations"`
+}
+
+// Checking traffic against allowlist of method and route pairs
+// (-conformance): requests of routes not in it and requests of known
+// routes with methods not allowed for them, so API surface drifting
+// from what is expected (forgotten endpoints, scanners, clients of
+// removed routes) shows up.
+type Conformance struct {
+	routes     []AllowedRoute
+	requests   int
+	violations map[[3]string]*Violation
+}
+
+func NewConformance(routes []AllowedRoute) *Conformance {
+	return &Conformance{routes: routes, violations: make(map[[3]string]*Violation)}
+}
+
+func (c *Conformance) Add(record LogRecord) {
+	c.requests++
+
+	segments := splitPath(record.Path())
+	var matched *AllowedRoute
+	for i, route := range c.routes {
+		if !route.Route.match(segments) {
+			continue
+		}
+		if len(route.Methods) == 0 || slices.Contains(route.Methods, record.Method) {
+			return
+		}
+		if matched == nil {
+			matched = &c.routes[i]
+		}
+	}
+
+	kind, route := unknownRoute, groupKey(record, "url")
+	var allowed []string
+	if matched != nil {
+		kind, route = unexpectedMethod, matched.Route.Pattern
+		allowed = matched.Methods
+	}
+
+	key := [3]string{kind, record.Method, route}
+	v, ok := c.violations[key]
+	if !ok {
+		v = &Violation{Kind: kind, Method: record.Method, Route: route, Allowed: allowed, FirstSeen: record.Date, LastSeen: record.Date, Examples: []string{}}
+		c.violations[key] = v
+	}
+	v.Requests++
+	if isError(record.Code) {
+		v.Errors++
+	}
+	if record.Date.Before(v.FirstSeen) {
+		v.FirstSeen = record.Date
+	}
+	if record.Date.After(v.LastSeen) {
+		v.LastSeen = record.Date
+	}
+	if len(v.Examples) < conformanceExamples && !slices.Contains(v.Examples, record.Path()) {
+		v.Examples = append(v.Examples, record.Path())
+	}
+}
+
+// Violations by requests
+func (c *Conformance) Report() ConformanceReport {
+	report := ConformanceReport{Requests: c.requests, Conforming: c.requests, Violations: []Violation{}}
+	for _, v := range c.violations {
+		report.Conforming -= v.Requests
+		report.Violations = append(report.Violations, *v)
+	}
+	slices.SortFunc(report.Violations, func(a, b Violation) int {
+		return cmp.Or(
+			cmp.Compare(b.Requests, a.Requests),
+			cmp.Compare(a.Route, b.Route),
+			cmp.Compare(a.Method, b.Method),
+		)
+	})
+	return report
+}
+
+// Conformance output
+func printConformance(report ConformanceReport, locale Locale) {
+	fmt.Printf("%s of %s requests conform to allowlist\n",
+		locale.Int(report.Conforming),
+		locale.Int(report.Requests),
+	)
+	if len(report.Violations) == 0 {
+		return
+	}
+	fmt.Println()
+
+	w := newTable(os.Stdout)
+	fmt.Fprintf(w, "KIND\tMETHOD\tROUTE\tALLOWED\tREQUESTS\tERRORS\tFIRST SEEN\tLAST SEEN\tEXAMPLES\n")
+	for _, v := range report.Violations {
+		allowed := "-"
+		if len(v.Allowed) > 0 {
+			allowed = strings.Join(v.Allowed, ",")
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			strings.ReplaceAll(v.Kind, "_", " "),
+			v.Method,
+			v.Route,
+			allowed,
+			locale.Int(v.Requests),
+			locale.Int(v.Errors),
+			locale.FormatDateTime(v.FirstSeen),
+			locale.FormatDateTime(v.LastSeen),
+			strings.Join(v.Examples, " "),
+		)
+	}
+	w.Flush()
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Envelope of container runtime around log line, as written by
+// docker json-file driver and shown by docker logs and kubectl logs
+// of such nodes: {"log":"[GIN] ...\n","stream":"stdout","time":"..."}
+type dockerEntry struct {
+	Log    *string `json:"log"`
+	Stream string  `json:"stream"`
+	Time   string  `json:"time"`
+}
+
+// Line of container log with its runtime timestamp and stream
+type containerLine struct {
+	message string
+	date    time.Time
+	stream  string
+
+	// Line longer than runtime buffer, continued in next line
+	partial bool
+}
+
+// Unwrapping container log line. Docker JSON lines, CRI lines of
+// containerd and CRI-O ("2024-05-01T10:00:01.123456789Z stdout F
+// [GIN] ...") and lines of kubectl logs --timestamps are unwrapped,
+// other lines are not container logs.
+func containerMessage(line string) (containerLine, bool) {
+	trimmed := strings.TrimLeft(line, " \t")
+	if strings.HasPrefix(trimmed, `{"log":`) {
+		var entry dockerEntry
+		if err := json.Unmarshal([]byte(trimmed), &entry); err != nil || entry.Log == nil {
+			return containerLine{}, false
+		}
+		date, _ := time.Parse(time.RFC3339Nano, entry.Time)
+		return containerLine{
+			message: strings.TrimRight(*entry.Log, "\r\n"),
+			date:    date,
+			stream:  entry.Stream,
+			partial: !strings.HasSuffix(*entry.Log, "\n"),
+		}, true
+	}
+
+	if line == "" || line[0] < '0' || line[0] > '9' {
+		return containerLine{}, false
+	}
+	fields := strings.SplitN(line, " ", 4)
+	date, err := time.Parse(time.RFC3339Nano, fields[0])
+	if err != nil || len(fields) < 2 {
+		return containerLine{}, false
+	}
+
+	// kubectl logs --timestamps: TIMESTAMP MESSAGE
+	if len(fields) < 3 || (fields[1] != "stdout" && fields[1] != "stderr") {
+		_, message, _ := strings.Cut(line, " ")
+		return containerLine{message: message, date: date}, true
+	}
+
+	// CRI: TIMESTAMP STREAM TAG MESSAGE, where tag is F of full line
+	// or P of partial one
+	tag, _, _ := strings.Cut(fields[2], ":")
+	if len(fields) == 3 {
+		fields = append(fields, "")
+	}
+	return containerLine{message: fields[3], date: date, stream: fields[1], partial: tag == "P"}, true
+}
+
+// Lines wrapped by container runtime, messages are parsed with inner
+// format and stream becomes stream field. With runtimeTime
+// (-container-time) records get runtime timestamps, which have
+// nanoseconds and zone unlike gin ones.
+type containerFormat struct {
+	inner       LineFormat
+	runtimeTime bool
+}
+
+func (f containerFormat) Parse(line string) (LogRecord, error) {
+	entry, ok := containerMessage(line)
+	if !ok {
+		return f.inner.Parse(line)
+	}
+
+	// Lines are split by runtime at 16 KiB, far longer than gin lines
+	if entry.partial && strings.TrimSpace(entry.message) != "" {
+		return LogRecord{}, fmt.Errorf("partial container line")
+	}
+	if ignoredLine(entry.message) {
+		return LogRecord{}, errIgnoredLine
+	}
+
+	record, err := f.inner.Parse(entry.message)
+	if err != nil {
+		return record, err
+	}
+
+	if f.runtimeTime && !entry.date.IsZero() {
+		record.Date = zonedTime(entry.date)
+	}
+	if entry.stream != "" && record.Fields["stream"] == "" {
+		if record.Fields == nil {
+			record.Fields = make(map[string]string)
+		}
+		record.Fields["stream"] = entry.stream
+	}
+	return record, nil
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Representations of media types, by exact type or structured
+// syntax suffix (application/vnd.api+json is json)
+var contentTypeNames = map[string]string{
+	"application/json":                  "json",
+	"text/json":                         "json",
+	"+json":                             "json",
+	"text/html":                         "html",
+	"application/xhtml+xml":             "html",
+	"application/xml":                   "xml",
+	"text/xml":                          "xml",
+	"+xml":                              "xml",
+	"application/protobuf":              "protobuf",
+	"application/x-protobuf":            "protobuf",
+	"application/vnd.google.protobuf":   "protobuf",
+	"application/grpc":                  "protobuf",
+	"application/grpc+proto":            "protobuf",
+	"+proto":                            "protobuf",
+	"+protobuf":                         "protobuf",
+	"application/msgpack":               "msgpack",
+	"application/x-msgpack":             "msgpack",
+	"text/plain":                        "text",
+	"text/event-stream":                 "event-stream",
+	"application/x-www-form-urlencoded": "form",
+	"multipart/form-data":               "form",
+	"*/*":                               "any",
+}
+
+// Group key of content-type: representation of response
+// Content-Type, or of preferred Accept type when only request header
+// is logged. Other media types are kept as they are, requests of
+// formats without headers are "(none)".
+func contentTypeKey(record LogRecord) string {
+	if value := record.Fields["content_type"]; value != "" {
+		return contentTypeName(value)
+	}
+	if value := record.Fields["accept"]; value != "" {
+		return contentTypeName(preferredAccept(value))
+	}
+	return "(none)"
+}
+
+// Representation of media type, parameters are ignored
+func contentTypeName(value string) string {
+	media, _, _ := strings.Cut(value, ";")
+	media = strings.ToLower(strings.TrimSpace(media))
+	if media == "" {
+		return "(none)"
+	}
+
+	if name, ok := contentTypeNames[media]; ok {
+		return name
+	}
+	if i := strings.LastIndex(media, "+"); i >= 0 {
+		if name, ok := contentTypeNames[media[i:]]; ok {
+			return name
+		}
+	}
+	return media
+}
+
+// Media type of Accept header with highest quality, first of equal
+// ones. Wildcards lose to concrete types of same quality.
+func preferredAccept(accept string) string {
+	var best string
+	bestQ := -1.0
+	for part := range strings.SplitSeq(accept, ",") {
+		media, params, _ := strings.Cut(part, ";")
+		media = strings.TrimSpace(media)
+		if media == "" {
+			continue
+		}
+
+		q := 1.0
+		for param := range strings.SplitSeq(params, ";") {
+			if value, ok := strings.CutPrefix(strings.TrimSpace(param), "q="); ok {
+				if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+					q = parsed
+				}
+			}
+		}
+		if strings.Contains(media, "*") {
+			q -= 0.0001
+		}
+
+		if q > bestQ {
+			best, bestQ = media, q
+		}
+	}
+	return best
+}
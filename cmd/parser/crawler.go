@@ -0,0 +1,363 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Routes printed by crawler report, JSON has all of them
+const crawlerRoutes = 20
+
+// Family of crawlers, recognized by user agent tokens (lowercase)
+// or published IP ranges
+type crawlerFamily struct {
+	name   string
+	agents []string
+	ranges []string
+}
+
+// Known crawlers, more ranges are added with -crawler-ranges. Only
+// ranges which are documented and stable are built in.
+var crawlerFamilies = []crawlerFamily{
+	{"Googlebot", []string{"googlebot", "google-inspectiontool", "storebot-google", "adsbot-google"}, []string{"66.249.64.0/19"}},
+	{"Bingbot", []string{"bingbot", "msnbot", "bingpreview", "adidxbot"}, []string{"157.55.39.0/24", "207.46.13.0/24", "40.77.167.0/24"}},
+	{"YandexBot", []string{"yandex"}, []string{"5.255.253.0/24", "77.88.5.0/24"}},
+	{"Baiduspider", []string{"baiduspider"}, []string{"180.76.15.0/24"}},
+	{"Applebot", []string{"applebot"}, nil},
+	{"DuckDuckBot", []string{"duckduckbot"}, nil},
+	{"AI crawlers", []string{"gptbot", "chatgpt-user", "claudebot", "anthropic-ai", "ccbot", "bytespider", "perplexitybot", "amazonbot"}, nil},
+	{"SEO crawlers", []string{"ahrefsbot", "semrushbot", "mj12bot", "dotbot", "petalbot", "blexbot"}, nil},
+	{"Social previews", []string{"facebookexternalhit", "twitterbot", "linkedinbot", "slackbot", "discordbot", "whatsapp"}, nil},
+}
+
+// Agent tokens of other bots
+var botAgentTokens = []string{"bot", "crawler", "spider", "crawl", "slurp"}
+
+// Family of IPs which read robots.txt or sitemaps, only crawlers do
+const robotsFamily = "robots.txt readers"
+
+// Family of agents with bot tokens of no known family
+const otherBotsFamily = "Other bots"
+
+// Classification of requests as crawler traffic: by user agent when
+// logs have one (-pattern gin-user-agent, JSON, nginx), by IP ranges,
+// and IPs reading robots.txt or sitemaps are crawlers from then on.
+type CrawlerClassifier struct {
+	ranges *ThreatFeeds
+	robots map[string]bool
+}
+
+// Classifier with built-in ranges and ranges of files, lines of IP
+// or CIDR range followed by family (66.249.64.0/19 Googlebot)
+func NewCrawlerClassifier(files []string) (*CrawlerClassifier, error) {
+	ranges, err := LoadThreatFeeds(files)
+	if err != nil {
+		return nil, err
+	}
+	for _, family := range crawlerFamilies {
+		for _, r := range family.ranges {
+			ranges.add(r, family.name)
+		}
+	}
+	slices.SortFunc(ranges.bits, func(a, b int) int { return b - a })
+	return &CrawlerClassifier{ranges: ranges, robots: make(map[string]bool)}, nil
+}
+
+// Crawler family of record, empty for other traffic
+func (c *CrawlerClassifier) Family(record LogRecord) string {
+	if agent := strings.ToLower(record.Fields["user_agent"]); agent != "" {
+		for _, family := range crawlerFamilies {
+			for _, token := range family.agents {
+				if strings.Contains(agent, token) {
+					return family.name
+				}
+			}
+		}
+		for _, token := range botAgentTokens {
+			if strings.Contains(agent, token) {
+				return otherBotsFamily
+			}
+		}
+	}
+
+	if family, ok := c.ranges.Lookup(record.IP); ok {
+		return family
+	}
+
+	path := record.Path()
+	if path == "/robots.txt" || strings.HasPrefix(path, "/sitemap") && strings.HasSuffix(path, ".xml") {
+		c.robots[record.IP] = true
+	}
+	if c.robots[record.IP] {
+		return robotsFamily
+	}
+	return ""
+}
+
+// Cost of requests: count, server time and response bytes
+type crawlerCost struct {
+	requests int
+	time     time.Duration
+	bytes    int64
+}
+
+func (c *crawlerCost) add(record LogRecord, bytes int64) {
+	c.requests++
+	c.time += record.Duration
+	c.bytes += bytes
+}
+
+type crawlerFamilyStats struct {
+	crawlerCost
+	ips map[string]bool
+}
+
+type crawlerRouteStats struct {
+	all, crawlers crawlerCost
+	families      map[string]int
+}
+
+// Crawler traffic of family
+type CrawlerFamilyReport struct {
+	Family    string        `json:"family"`
+	Requests  int           `json:"requests"`
+	Share     float64       `json:"share"`
+	Time      time.Duration `json:"time"`
+	TimeShare float64       `json:"time_share"`
+	Bytes     int64         `json:"bytes"`
+	IPs       int           `json:"ips"`
+}
+
+// Crawler traffic of route
+type CrawlerRouteReport struct {
+	Route             string        `json:"route"`
+	Requests          int           `json:"requests"`
+	CrawlerRequests   int           `json:"crawler_requests"`
+	CrawlerShare      float64       `json:"crawler_share"`
+	CrawlerTime       time.Duration `json:"crawler_time"`
+	CrawlerLatency    time.Duration `json:"crawler_latency"`
+	CrawlerBytes      int64         `json:"crawler_bytes"`
+	TopFamily         string        `json:"top_family"`
+	TopFamilyRequests int           `json:"top_family_requests"`
+}
+
+// Crawler budget report
+type CrawlersReport struct {
+	Requests        int                   `json:"requests"`
+	CrawlerRequests int                   `json:"crawler_requests"`
+	Share           float64               `json:"share"`
+	Time            time.Duration         `json:"time"`
+	CrawlerTime     time.Duration         `json:"crawler_time"`
+	TimeShare       float64               `json:"time_share"`
+	Bytes           int64                 `json:"bytes"`
+	CrawlerBytes    int64                 `json:"crawler_bytes"`
+	BytesShare      float64               `json:"bytes_share"`
+	Families        []CrawlerFamilyReport `json:"families"`
+	Routes          []CrawlerRouteReport  `json:"routes"`
+
+	// Records have body size, so bytes are known
+	HasBytes bool `json:"has_bytes"`
+
+	// Records have user agent, without it only ranges and robots.txt
+	// readers are recognized and share is low estimate
+	HasAgents bool `json:"has_agents"`
+}
+
+// Crawler traffic per family and route (-crawlers), as cost of
+// crawling in requests, server time and bytes, for robots.txt and
+// rate limit changes
+type Crawlers struct {
+	classifier *CrawlerClassifier
+	total      crawlerCost
+	crawlers   crawlerCost
+	families   map[string]*crawlerFamilyStats
+	routes     map[string]*crawlerRouteStats
+	hasBytes   bool
+	hasAgents  bool
+}
+
+func NewCrawlers(classifier *CrawlerClassifier) *Crawlers {
+	return &Crawlers{
+		classifier: classifier,
+		families:   make(map[string]*crawlerFamilyStats),
+		routes:     make(map[string]*crawlerRouteStats),
+	}
+}
+
+func (c *Crawlers) Add(record LogRecord) {
+	var bytes int64
+	if size, ok := record.Fields["body_size"]; ok {
+		bytes, _ = strconv.ParseInt(size, 10, 64)
+		c.hasBytes = true
+	}
+	if record.Fields["user_agent"] != "" {
+		c.hasAgents = true
+	}
+
+	route := groupKey(record, "url")
+	rs, ok := c.routes[route]
+	if !ok {
+		rs = &crawlerRouteStats{families: make(map[string]int)}
+		c.routes[route] = rs
+	}
+	c.total.add(record, bytes)
+	rs.all.add(record, bytes)
+
+	family := c.classifier.Family(record)
+	if family == "" {
+		return
+	}
+
+	fs, ok := c.families[family]
+	if !ok {
+		fs = &crawlerFamilyStats{ips: make(map[string]bool)}
+		c.families[family] = fs
+	}
+	c.crawlers.add(record, bytes)
+	fs.add(record, bytes)
+	fs.ips[record.IP] = true
+	rs.crawlers.add(record, bytes)
+	rs.families[family]++
+}
+
+func (c *Crawlers) Report() CrawlersReport {
+	report := CrawlersReport{
+		Requests:        c.total.requests,
+		CrawlerRequests: c.crawlers.requests,
+		Share:           ratio(float64(c.crawlers.requests), float64(c.total.requests)),
+		Time:            c.total.time,
+		CrawlerTime:     c.crawlers.time,
+		TimeShare:       ratio(float64(c.crawlers.time), float64(c.total.time)),
+		Bytes:           c.total.bytes,
+		CrawlerBytes:    c.crawlers.bytes,
+		BytesShare:      ratio(float64(c.crawlers.bytes), float64(c.total.bytes)),
+		Families:        []CrawlerFamilyReport{},
+		Routes:          []CrawlerRouteReport{},
+		HasBytes:        c.hasBytes,
+		HasAgents:       c.hasAgents,
+	}
+
+	for name, fs := range c.families {
+		report.Families = append(report.Families, CrawlerFamilyReport{
+			Family:    name,
+			Requests:  fs.requests,
+			Share:     ratio(float64(fs.requests), float64(c.total.requests)),
+			Time:      fs.time,
+			TimeShare: ratio(float64(fs.time), float64(c.total.time)),
+			Bytes:     fs.bytes,
+			IPs:       len(fs.ips),
+		})
+	}
+	slices.SortFunc(report.Families, func(a, b CrawlerFamilyReport) int {
+		if c := cmp.Compare(b.Time, a.Time); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Family, b.Family)
+	})
+
+	for route, rs := range c.routes {
+		if rs.crawlers.requests == 0 {
+			continue
+		}
+		top := slices.MaxFunc(slices.Sorted(maps.Keys(rs.families)), func(a, b string) int {
+			if c := cmp.Compare(rs.families[a], rs.families[b]); c != 0 {
+				return c
+			}
+			return strings.Compare(b, a)
+		})
+		report.Routes = append(report.Routes, CrawlerRouteReport{
+			Route:             route,
+			Requests:          rs.all.requests,
+			CrawlerRequests:   rs.crawlers.requests,
+			CrawlerShare:      ratio(float64(rs.crawlers.requests), float64(rs.all.requests)),
+			CrawlerTime:       rs.crawlers.time,
+			CrawlerLatency:    rs.crawlers.time / time.Duration(rs.crawlers.requests),
+			CrawlerBytes:      rs.crawlers.bytes,
+			TopFamily:         top,
+			TopFamilyRequests: rs.families[top],
+		})
+	}
+	slices.SortFunc(report.Routes, func(a, b CrawlerRouteReport) int {
+		if c := cmp.Compare(b.CrawlerTime, a.CrawlerTime); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Route, b.Route)
+	})
+	return report
+}
+
+// Share of part in total, zero for empty total
+func ratio(part, total float64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return part / total
+}
+
+// Crawler report output, routes by crawler server time
+func printCrawlers(report CrawlersReport, locale Locale) {
+	fmt.Printf("Crawler traffic: %s of %s requests (%s), server time %s (%s)",
+		locale.Int(report.CrawlerRequests), locale.Int(report.Requests), locale.Percent(report.Share),
+		locale.Duration(report.CrawlerTime), locale.Percent(report.TimeShare))
+	if report.HasBytes {
+		fmt.Printf(", %s (%s)", formatBytes(report.CrawlerBytes), locale.Percent(report.BytesShare))
+	}
+	fmt.Println()
+	if !report.HasAgents {
+		fmt.Printf("Logs have no user agents, crawlers are recognized by IP ranges and robots.txt reads only, so share is a low estimate\n(-pattern gin-user-agent or JSON logs with user_agent recognize all)\n")
+	}
+	if report.CrawlerRequests == 0 {
+		return
+	}
+
+	bytes := func(b int64) string {
+		if !report.HasBytes {
+			return "-"
+		}
+		return formatBytes(b)
+	}
+
+	w := newTable(os.Stdout)
+	fmt.Fprintf(w, "\nFAMILY\tREQUESTS\tSHARE\tSERVER TIME\tTIME SHARE\tBYTES\tIPS\n")
+	for _, family := range report.Families {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			family.Family,
+			locale.Int(family.Requests),
+			locale.Percent(family.Share),
+			locale.Duration(family.Time),
+			locale.Percent(family.TimeShare),
+			bytes(family.Bytes),
+			locale.Int(family.IPs),
+		)
+	}
+	w.Flush()
+
+	w = newTable(os.Stdout)
+	fmt.Fprintf(w, "\nROUTE\tREQUESTS\tCRAWLERS\tCRAWLER TIME\tCRAWLER AVG\tCRAWLER BYTES\tTOP FAMILY\n")
+	for i, route := range report.Routes {
+		if i == crawlerRoutes {
+			break
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s (%s)\t%s\t%s\t%s\t%s\n",
+			route.Route,
+			locale.Int(route.Requests),
+			locale.Int(route.CrawlerRequests),
+			locale.Percent(route.CrawlerShare),
+			locale.Duration(route.CrawlerTime),
+			locale.Duration(route.CrawlerLatency),
+			bytes(route.CrawlerBytes),
+			route.TopFamily,
+		)
+	}
+	w.Flush()
+
+	if len(report.Routes) > crawlerRoutes {
+		fmt.Printf("\n%s more routes crawled (-json lists all)\n", locale.Int(len(report.Routes)-crawlerRoutes))
+	}
+}
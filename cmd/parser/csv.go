@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/csv"
+	"io"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// Header of CSV output
+var csvHeader = []string{"date", "code", "duration_ms", "ip", "method", "url"}
+
+// Writing records as CSV with header row
+func writeCSV(w io.Writer, records []LogRecord) error {
+	cw := newCSVWriter(w, nil)
+
+	for _, record := range records {
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+
+	return cw.Close()
+}
+
+// CSV writer, header is written before first record
+// (or on close for empty output)
+type csvWriter struct {
+	cw      *csv.Writer
+	started bool
+
+	// Derived fields added after record columns, duration_ms
+	// is a record column already
+	fields []string
+}
+
+func newCSVWriter(w io.Writer, fields []string) *csvWriter {
+	return &csvWriter{
+		cw: csv.NewWriter(w),
+		fields: slices.DeleteFunc(slices.Clone(fields), func(field string) bool {
+			return field == "duration_ms"
+		}),
+	}
+}
+
+// Writing header once
+func (w *csvWriter) start() error {
+	if w.started {
+		return nil
+	}
+	w.started = true
+	return w.cw.Write(append(slices.Clone(csvHeader), w.fields...))
+}
+
+// Writing one record as CSV row
+func (w *csvWriter) Write(record LogRecord) error {
+	if err := w.start(); err != nil {
+		return err
+	}
+
+	row := csvRow(record)
+	for _, field := range w.fields {
+		switch field {
+		case "normalized_route":
+			row = append(row, normalizedRoute(record))
+		case "status_class":
+			row = append(row, statusClass(record.Code))
+		}
+	}
+
+	if err := w.cw.Write(row); err != nil {
+		return err
+	}
+
+	w.cw.Flush()
+	return w.cw.Error()
+}
+
+func (w *csvWriter) Close() error {
+	if err := w.start(); err != nil {
+		return err
+	}
+
+	w.cw.Flush()
+	return w.cw.Error()
+}
+
+// CSV row of record
+func csvRow(record LogRecord) []string {
+	return []string{
+		record.Date.Format(time.DateTime),
+		strconv.Itoa(record.Code),
+		strconv.FormatFloat(durationMs(record.Duration), 'f', -1, 64),
+		record.IP,
+		record.Method,
+		record.URL,
+	}
+}
@@ -0,0 +1,399 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"text/tabwriter"
+	"time"
+)
+
+// Seconds of requests per second sparkline
+const dashSparkline = 60
+
+// Requests of one second of dashboard
+type dashSecond struct {
+	count, errors int
+	sketch        *Sketch
+
+	// Requests and requests over budget of routes with -budget
+	routes map[string]*dashBurn
+}
+
+// Requests of route and requests of it over its latency budget
+type dashBurn struct {
+	count, over int
+}
+
+// Latency budget of routes matching pattern (-budget)
+type routeBudget struct {
+	pattern string
+	budget  time.Duration
+}
+
+// Parsing "PATTERN=DURATION" values like "/api/payments/**=300ms",
+// patterns are route globs
+func parseRouteBudgets(values []string) ([]routeBudget, error) {
+	var budgets []routeBudget
+	for _, value := range values {
+		pattern, budget, ok := strings.Cut(value, "=")
+		pattern = strings.TrimSpace(pattern)
+		if !ok || !strings.HasPrefix(pattern, "/") {
+			return nil, fmt.Errorf("expected /ROUTE-PATTERN=DURATION, got %q", value)
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("bad pattern %q: %w", pattern, err)
+		}
+		d, err := parseFlagDuration(strings.TrimSpace(budget))
+		if err != nil {
+			return nil, err
+		}
+		if d <= 0 {
+			return nil, fmt.Errorf("budget of %s must be positive", pattern)
+		}
+		budgets = append(budgets, routeBudget{pattern: pattern, budget: d})
+	}
+	return budgets, nil
+}
+
+// Checking does route glob match route, /** at the end matches route
+// below it too
+func matchRoute(pattern, route string) bool {
+	if parent, ok := strings.CutSuffix(pattern, "/**"); ok {
+		if route == parent || strings.HasPrefix(route, parent+"/") {
+			return true
+		}
+	}
+	ok, _ := path.Match(pattern, route)
+	return ok
+}
+
+// Live dashboard of followed log (dash command). Requests are counted
+// by second they were read in, not by their timestamps, which have
+// second resolution and may be in other zone.
+type Dashboard struct {
+	mu      sync.Mutex
+	window  time.Duration
+	slow    time.Duration
+	seconds map[int64]*dashSecond
+
+	total, errors, slowCount int
+
+	// Budgets of routes and number of routes of budget burn panel
+	budgets    []routeBudget
+	burnRoutes int
+
+	// Recent 5xx and slow requests, newest last
+	recent []LogRecord
+	size   int
+}
+
+func NewDashboard(window, slow time.Duration, size int, budgets []routeBudget, burnRoutes int) *Dashboard {
+	return &Dashboard{
+		window:     window,
+		slow:       slow,
+		seconds:    make(map[int64]*dashSecond),
+		size:       size,
+		budgets:    budgets,
+		burnRoutes: burnRoutes,
+	}
+}
+
+// Budget of route, first matching pattern wins
+func (d *Dashboard) budget(route string) (time.Duration, bool) {
+	for _, b := range d.budgets {
+		if matchRoute(b.pattern, route) {
+			return b.budget, true
+		}
+	}
+	return 0, false
+}
+
+func (d *Dashboard) Add(record LogRecord) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := time.Now().Unix()
+	second, ok := d.seconds[now]
+	if !ok {
+		second = &dashSecond{sketch: NewSketch(), routes: make(map[string]*dashBurn)}
+		d.seconds[now] = second
+	}
+	second.count++
+	second.sketch.Add(record.Duration)
+	d.total++
+
+	route := groupKey(record, "url")
+	if budget, ok := d.budget(route); ok {
+		burn, ok := second.routes[route]
+		if !ok {
+			burn = &dashBurn{}
+			second.routes[route] = burn
+		}
+		burn.count++
+		if record.Duration > budget {
+			burn.over++
+		}
+	}
+
+	slow := d.slow > 0 && record.Duration > d.slow
+	if isError(record.Code) {
+		second.errors++
+		d.errors++
+	}
+	if slow {
+		d.slowCount++
+	}
+	if isError(record.Code) || slow {
+		d.recent = append(d.recent, record)
+		if len(d.recent) > d.size {
+			d.recent = d.recent[len(d.recent)-d.size:]
+		}
+	}
+	return nil
+}
+
+// Drawing dashboard frame, seconds older than two windows (previous
+// one is trend of budget burn) and sparkline are dropped
+func (d *Dashboard) Render(w io.Writer, name string, now time.Time, locale Locale) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	seconds := int64(d.window / time.Second)
+	keep := max(2*seconds, dashSparkline)
+	for t := range d.seconds {
+		if t <= now.Unix()-keep {
+			delete(d.seconds, t)
+		}
+	}
+
+	// Window ends with last complete second
+	var count, errors int
+	sketch := NewSketch()
+	for t := now.Unix() - seconds; t < now.Unix(); t++ {
+		if second, ok := d.seconds[t]; ok {
+			count += second.count
+			errors += second.errors
+			sketch.Merge(second.sketch)
+		}
+	}
+	errorRate := 0.0
+	if count > 0 {
+		errorRate = float64(errors) / float64(count)
+	}
+
+	fmt.Fprintf(w, "ginlog dash %s  %s  (Ctrl-C quits)\n\n", name, locale.FormatDateTime(now))
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "Requests/sec\t%s\tError rate\t%s\tp95\t%s\t(last %s)\n",
+		locale.Float(float64(count)/float64(seconds), 2),
+		colorize(locale.Percent(errorRate), errorRateColor(errorRate)),
+		colorize(locale.Duration(sketch.Quantile(95)), durationColor(sketch.Quantile(95))),
+		d.window,
+	)
+	fmt.Fprintf(tw, "Requests\t%s\tErrors\t%s\tSlow\t%s\t(since start)\n",
+		locale.Int(d.total), locale.Int(d.errors), locale.Int(d.slowCount))
+	tw.Flush()
+
+	counts := make([]float64, dashSparkline)
+	peak := 0.0
+	for i := range counts {
+		if second, ok := d.seconds[now.Unix()-dashSparkline+int64(i)]; ok {
+			counts[i] = float64(second.count)
+			peak = max(peak, counts[i])
+		}
+	}
+	fmt.Fprintf(w, "\nRequests/sec of last %ds  %s\n", dashSparkline, sparkline(counts, peak))
+
+	if len(d.budgets) > 0 {
+		d.renderBurn(w, now, seconds, locale)
+	}
+
+	title := "Recent 5xx requests"
+	if d.slow > 0 {
+		title = fmt.Sprintf("Recent 5xx and slow requests (above %s)", locale.Duration(d.slow))
+	}
+	fmt.Fprintf(w, "\n%s\n", title)
+
+	width := terminalWidth()
+	tw = tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "TIME\tCODE\tDURATION\tIP\tMETHOD\tURL\n")
+	for i := len(d.recent) - 1; i >= 0; i-- {
+		record := d.recent[i]
+		url := record.URL
+		if limit := width - 70; limit > 10 && len(url) > limit {
+			url = url[:limit-3] + "..."
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n",
+			record.Date.Format(time.TimeOnly),
+			colorize(strconv.Itoa(record.Code), codeColor(record.Code)),
+			colorize(locale.Duration(record.Duration), durationColor(record.Duration)),
+			record.IP,
+			record.Method,
+			url,
+		)
+	}
+	tw.Flush()
+}
+
+// Budget burn of route in window and window before it
+type routeBurn struct {
+	route             string
+	budget            time.Duration
+	current, previous dashBurn
+}
+
+func (b dashBurn) rate() float64 {
+	if b.count == 0 {
+		return 0
+	}
+	return float64(b.over) / float64(b.count)
+}
+
+// Drawing routes with highest share of requests over their budget in
+// window, arrows compare it with window before
+func (d *Dashboard) renderBurn(w io.Writer, now time.Time, seconds int64, locale Locale) {
+	burns := make(map[string]*routeBurn)
+	for t := now.Unix() - 2*seconds; t < now.Unix(); t++ {
+		second, ok := d.seconds[t]
+		if !ok {
+			continue
+		}
+		for route, burn := range second.routes {
+			r, ok := burns[route]
+			if !ok {
+				budget, _ := d.budget(route)
+				r = &routeBurn{route: route, budget: budget}
+				burns[route] = r
+			}
+			window := &r.current
+			if t < now.Unix()-seconds {
+				window = &r.previous
+			}
+			window.count += burn.count
+			window.over += burn.over
+		}
+	}
+
+	var routes []*routeBurn
+	for _, r := range burns {
+		if r.current.count > 0 {
+			routes = append(routes, r)
+		}
+	}
+	sort.Slice(routes, func(i, j int) bool {
+		a, b := routes[i].current, routes[j].current
+		if a.rate() != b.rate() {
+			return a.rate() > b.rate()
+		}
+		if a.over != b.over {
+			return a.over > b.over
+		}
+		return routes[i].route < routes[j].route
+	})
+	if len(routes) > d.burnRoutes {
+		routes = routes[:d.burnRoutes]
+	}
+
+	fmt.Fprintf(w, "\nBudget burn of routes (requests over latency budget, last %s)\n", d.window)
+	if len(routes) == 0 {
+		fmt.Fprintln(w, "No requests of routes with budget")
+		return
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "ROUTE\tBUDGET\tREQUESTS\tOVER\tBURN\tTREND\n")
+	for _, r := range routes {
+		rate := r.current.rate()
+		color := ""
+		if rate > 0 {
+			color = errorRateColor(rate)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n",
+			r.route,
+			locale.Duration(r.budget),
+			locale.Int(r.current.count),
+			locale.Int(r.current.over),
+			colorize(locale.Percent(rate), color),
+			burnTrend(r.current, r.previous),
+		)
+	}
+	tw.Flush()
+}
+
+// Arrow of budget burn change from previous window, changes below one
+// percentage point are steady. Routes without requests in previous
+// window are new.
+func burnTrend(current, previous dashBurn) string {
+	if previous.count == 0 {
+		return "new"
+	}
+	switch change := current.rate() - previous.rate(); {
+	case change >= 0.01:
+		return colorize("↑", ansiRed)
+	case change <= -0.01:
+		return colorize("↓", ansiGreen)
+	}
+	return "→"
+}
+
+// Width of terminal from $COLUMNS, stdlib has no terminal size query
+func terminalWidth() int {
+	if columns, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && columns > 0 {
+		return columns
+	}
+	return 120
+}
+
+// Redrawing dashboard every refresh until interrupted, records are
+// read from input in background. On terminal it's drawn on alternate
+// screen, which is restored on exit. Returns error of reading input.
+func runDashboard(dash *Dashboard, input io.Reader, accept func(line string, number int) (LogRecord, bool, error), name string, refresh time.Duration, locale Locale) error {
+	read := make(chan error, 1)
+	go func() {
+		read <- readRecords(input, 1, accept, dash.Add, nil)
+	}()
+
+	terminal := isTerminal(os.Stdout)
+	if terminal {
+		fmt.Print("\x1b[?1049h\x1b[?25l")
+		defer fmt.Print("\x1b[?25h\x1b[?1049l")
+	}
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(interrupt)
+
+	ticker := time.NewTicker(refresh)
+	defer ticker.Stop()
+
+	for {
+		var frame strings.Builder
+		if terminal {
+			frame.WriteString("\x1b[H\x1b[2J")
+		}
+		dash.Render(&frame, name, time.Now(), locale)
+		if !terminal {
+			frame.WriteString("\n")
+		}
+		os.Stdout.WriteString(frame.String())
+
+		select {
+		case <-ticker.C:
+		case err := <-read:
+			// Ended input keeps last requests shown
+			if err != nil {
+				return err
+			}
+			read = nil
+		case <-interrupt:
+			return nil
+		}
+	}
+}
@@ -0,0 +1,418 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Routes of toy service, path parameters are filled with random values
+var devRoutes = []string{
+	"GET /api/users",
+	"GET /api/users/:id",
+	"POST /api/users",
+	"PUT /api/users/:id",
+	"GET /api/orders/:id",
+	"POST /api/orders",
+	"DELETE /api/orders/:id",
+	"GET /static/*filepath",
+	"GET /health",
+}
+
+// Formats of devserver stream
+var devFormats = []string{"gin", "ndjson"}
+
+// Key suffix of WebSocket handshake (RFC 6455)
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// Status code weight of -mix
+type devCode struct {
+	code   int
+	weight float64
+}
+
+// Settings of generated stream, flags of devserver overridden by
+// query parameters of one connection
+type devSettings struct {
+	rate    float64
+	mix     []devCode
+	latency time.Duration
+	format  string
+	count   int
+}
+
+// Parsing status code mix, e.g. "200=90,404=5,500=3,503=2"
+func parseDevMix(value string) ([]devCode, error) {
+	var mix []devCode
+	for _, part := range strings.Split(value, ",") {
+		code, weight, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			return nil, fmt.Errorf("expected code=weight, got %q", part)
+		}
+		c, err := strconv.Atoi(code)
+		if err != nil || c < 100 || c > 599 {
+			return nil, fmt.Errorf("invalid status code %q", code)
+		}
+		w, err := strconv.ParseFloat(strings.TrimSuffix(weight, "%"), 64)
+		if err != nil || w < 0 {
+			return nil, fmt.Errorf("invalid weight %q", weight)
+		}
+		mix = append(mix, devCode{c, w})
+	}
+	if !slices.ContainsFunc(mix, func(c devCode) bool { return c.weight > 0 }) {
+		return nil, fmt.Errorf("all weights are zero")
+	}
+	return mix, nil
+}
+
+// Settings of connection, query parameters rate, mix, latency, format
+// and count replace defaults
+func (s devSettings) with(query url.Values) (devSettings, error) {
+	if v := query.Get("rate"); v != "" {
+		rate, err := strconv.ParseFloat(v, 64)
+		if err != nil || rate <= 0 {
+			return s, fmt.Errorf("rate must be positive number")
+		}
+		s.rate = rate
+	}
+	if v := query.Get("mix"); v != "" {
+		mix, err := parseDevMix(v)
+		if err != nil {
+			return s, fmt.Errorf("mix: %w", err)
+		}
+		s.mix = mix
+	}
+	if v := query.Get("latency"); v != "" {
+		latency, err := time.ParseDuration(v)
+		if err != nil || latency <= 0 {
+			return s, fmt.Errorf("latency must be positive duration")
+		}
+		s.latency = latency
+	}
+	if v := query.Get("format"); v != "" {
+		if !slices.Contains(devFormats, v) {
+			return s, fmt.Errorf("unknown format %q (supported: %s)", v, strings.Join(devFormats, ", "))
+		}
+		s.format = v
+	}
+	if v := query.Get("count"); v != "" {
+		count, err := strconv.Atoi(v)
+		if err != nil || count < 0 {
+			return s, fmt.Errorf("count must be non-negative number")
+		}
+		s.count = count
+	}
+	return s, nil
+}
+
+// Generator of toy requests: routes are picked with falling weights,
+// status codes by mix, latencies are log-normal around median latency
+// (errors of 5xx are slower), clients come from small pool of
+// documentation addresses
+type devGenerator struct {
+	settings devSettings
+	routes   []RoutePattern
+	methods  []string
+	rng      *rand.Rand
+}
+
+func newDevGenerator(settings devSettings, routes []string, seed uint64) *devGenerator {
+	g := &devGenerator{settings: settings, rng: rand.New(rand.NewPCG(seed, seed^0x9e3779b97f4a7c15))}
+	for _, route := range routes {
+		method, pattern, _ := strings.Cut(route, " ")
+		g.methods = append(g.methods, method)
+		g.routes = append(g.routes, RoutePattern{Pattern: pattern, segments: splitPath(pattern)})
+	}
+	return g
+}
+
+// Next request at time
+func (g *devGenerator) Next(now time.Time) LogRecord {
+	// Zipf-like weights, first routes are busiest
+	i := 0
+	for i < len(g.routes)-1 && g.rng.Float64() > 0.35 {
+		i++
+	}
+
+	var segments []string
+	for _, segment := range g.routes[i].segments {
+		switch {
+		case strings.HasPrefix(segment, ":"):
+			segment = strconv.Itoa(1 + g.rng.IntN(5000))
+		case strings.HasPrefix(segment, "*"):
+			segment = fmt.Sprintf("app.%x.js", g.rng.Uint32())
+		}
+		segments = append(segments, segment)
+	}
+
+	code := g.code()
+	latency := float64(g.settings.latency) * math.Exp(g.rng.NormFloat64()*0.8)
+	if code >= 500 {
+		latency *= 5
+	}
+
+	return LogRecord{
+		Date:     now,
+		Code:     code,
+		Duration: time.Duration(latency),
+		IP:       fmt.Sprintf("192.0.2.%d", 1+g.rng.IntN(50)),
+		Method:   g.methods[i],
+		URL:      "/" + strings.Join(segments, "/"),
+	}
+}
+
+func (g *devGenerator) code() int {
+	total := 0.0
+	for _, c := range g.settings.mix {
+		total += c.weight
+	}
+	x := g.rng.Float64() * total
+	for _, c := range g.settings.mix {
+		if x < c.weight {
+			return c.code
+		}
+		x -= c.weight
+	}
+	return g.settings.mix[len(g.settings.mix)-1].code
+}
+
+// Writing requests at rate until count is reached or write fails,
+// requests due since last tick are written together
+func (g *devGenerator) Stream(write func(line []byte) error, done <-chan struct{}) error {
+	ticker := time.NewTicker(max(time.Duration(float64(time.Second)/g.settings.rate), 10*time.Millisecond))
+	defer ticker.Stop()
+
+	start := time.Now()
+	written := 0
+	for {
+		select {
+		case <-done:
+			return nil
+		case now := <-ticker.C:
+			due := int(now.Sub(start).Seconds() * g.settings.rate)
+			for ; written < due; written++ {
+				if g.settings.count > 0 && written == g.settings.count {
+					return nil
+				}
+				line, err := g.line(g.Next(now))
+				if err != nil {
+					return err
+				}
+				if err := write(line); err != nil {
+					return err
+				}
+			}
+		}
+	}
+}
+
+// Request in gin format or as JSON record
+func (g *devGenerator) line(record LogRecord) ([]byte, error) {
+	if g.settings.format == "ndjson" {
+		line, err := json.Marshal(newJSONRecord(record, nil))
+		return append(line, '\n'), err
+	}
+
+	var b strings.Builder
+	b.WriteString("[GIN] ")
+	if err := writeRaw(&b, record); err != nil {
+		return nil, err
+	}
+	return []byte(b.String()), nil
+}
+
+// Development server (ginlog devserver) streaming toy gin logs over
+// HTTP (/log) and WebSocket (/ws), so dashboards and integrations can be
+// built against ginlog serve without real app:
+// ginlog serve -http :8080 http://localhost:9200/log
+func runDevServer(args []string) error {
+	flags := flag.NewFlagSet("devserver", flag.ExitOnError)
+	addr := flags.String("addr", ":9200", "Address to serve log stream at")
+	rate := flags.Float64("rate", 10, "Requests per second of each stream")
+	mix := flags.String("mix", "200=90,201=3,404=4,500=2,503=1", "Status code weights (code=weight, comma-separated)")
+	latency := new(time.Duration)
+	durationVar(flags, latency, "latency", 20*time.Millisecond, "Median request latency")
+	format := flags.String("format", "gin", "Stream format: gin, ndjson")
+	count := flags.Int("count", 0, "Requests of each stream before it ends (0 is endless)")
+	seed := flags.Uint64("seed", 0, "Seed of generated requests, same seed gives same requests (0 is random)")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: ginlog devserver [flags]\n\nServe endless toy gin log stream over HTTP (/log) and WebSocket (/ws).\nQuery parameters rate, mix, latency, format and count override flags per connection.\n\nFlags:\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	codes, err := parseDevMix(*mix)
+	if err != nil {
+		return flagError{"-mix", err}
+	}
+	defaults, err := devSettings{mix: codes}.with(url.Values{
+		"rate":    {strconv.FormatFloat(*rate, 'f', -1, 64)},
+		"latency": {latency.String()},
+		"format":  {*format},
+		"count":   {strconv.Itoa(*count)},
+	})
+	if err != nil {
+		return flagError{"flags", err}
+	}
+
+	// Connections get their own generator, with seed each of them
+	// streams same requests
+	generator := func(r *http.Request) (*devGenerator, error) {
+		settings, err := defaults.with(r.URL.Query())
+		if err != nil {
+			return nil, err
+		}
+		s := *seed
+		if s == 0 {
+			s = rand.Uint64()
+		}
+		return newDevGenerator(settings, devRoutes, s), nil
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /log", func(w http.ResponseWriter, r *http.Request) {
+		g, err := generator(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		if g.settings.format == "ndjson" {
+			w.Header().Set("Content-Type", "application/x-ndjson")
+		}
+		w.Header().Set("Cache-Control", "no-store")
+		flusher, _ := w.(http.Flusher)
+		g.Stream(func(line []byte) error {
+			if _, err := w.Write(line); err != nil {
+				return err
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+			return nil
+		}, r.Context().Done())
+	})
+
+	mux.HandleFunc("GET /ws", func(w http.ResponseWriter, r *http.Request) {
+		g, err := generator(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		conn, done, err := upgradeWebSocket(w, r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		defer conn.Close()
+
+		g.Stream(func(line []byte) error {
+			return writeWebSocketText(conn, line[:len(line)-1])
+		}, done)
+		conn.Write([]byte{0x88, 0})
+	})
+
+	mux.HandleFunc("GET /{$}", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "Toy gin log stream\n\n/log  lines over HTTP\n/ws   lines as WebSocket text messages\n\nQuery parameters: rate, mix, latency, format (%s), count\n", strings.Join(devFormats, ", "))
+	})
+
+	fmt.Fprintf(os.Stderr, "Serving toy log stream at http://%s/log and ws://%s/ws\n", *addr, *addr)
+	return http.ListenAndServe(*addr, mux)
+}
+
+// Completing WebSocket handshake. Done is closed when client closes
+// connection or sends close frame, client messages are ignored.
+func upgradeWebSocket(w http.ResponseWriter, r *http.Request) (net.Conn, <-chan struct{}, error) {
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if !strings.EqualFold(r.Header.Get("Upgrade"), "websocket") || key == "" {
+		return nil, nil, fmt.Errorf("expected WebSocket upgrade")
+	}
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("connection can't be upgraded")
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	hash := sha1.Sum([]byte(key + websocketGUID))
+	fmt.Fprintf(rw, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: %s\r\n\r\n", base64.StdEncoding.EncodeToString(hash[:]))
+	if err := rw.Flush(); err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		readWebSocketUntilClose(rw.Reader)
+	}()
+	return conn, done, nil
+}
+
+// Reading client frames until close frame or end of connection
+func readWebSocketUntilClose(r *bufio.Reader) {
+	header := make([]byte, 2)
+	for {
+		if _, err := io.ReadFull(r, header); err != nil {
+			return
+		}
+		if header[0]&0x0f == 0x8 {
+			return
+		}
+
+		size := uint64(header[1] & 0x7f)
+		switch size {
+		case 126:
+			var n uint16
+			if binary.Read(r, binary.BigEndian, &n) != nil {
+				return
+			}
+			size = uint64(n)
+		case 127:
+			if binary.Read(r, binary.BigEndian, &size) != nil {
+				return
+			}
+		}
+		if header[1]&0x80 != 0 {
+			size += 4
+		}
+		if _, err := io.CopyN(io.Discard, r, int64(size)); err != nil {
+			return
+		}
+	}
+}
+
+// Writing unmasked text frame, as server frames are
+func writeWebSocketText(w io.Writer, payload []byte) error {
+	frame := []byte{0x81}
+	switch n := len(payload); {
+	case n < 126:
+		frame = append(frame, byte(n))
+	case n <= math.MaxUint16:
+		frame = append(frame, 126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(n))
+	default:
+		frame = append(frame, 127)
+		frame = binary.BigEndian.AppendUint64(frame, uint64(n))
+	}
+	_, err := w.Write(append(frame, payload...))
+	return err
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"time"
+)
+
+// Time window of compare command, zero bounds are open.
+// From is inclusive and to is exclusive like -from and -to.
+type compareWindow struct {
+	from, to time.Time
+}
+
+func (w compareWindow) contains(date time.Time) bool {
+	return (w.from.IsZero() || !date.Before(w.from)) && (w.to.IsZero() || date.Before(w.to))
+}
+
+// Label of window for output
+func (w compareWindow) String() string {
+	bound := func(t time.Time) string {
+		if t.IsZero() {
+			return "..."
+		}
+		return t.Format(time.DateTime)
+	}
+	return bound(w.from) + " - " + bound(w.to)
+}
+
+// Parsing windows of -baseline-from/-baseline-to and -from/-to,
+// current window starts at end of baseline by default
+func parseCompareWindows(baselineFrom, baselineTo, from, to string, now time.Time) (compareWindow, compareWindow, error) {
+	var baseline, current compareWindow
+	var err error
+
+	if baseline.from, err = parseTimestamp(baselineFrom, now); err != nil {
+		return baseline, current, fmt.Errorf("-baseline-from: %w", err)
+	}
+	if baseline.to, err = parseTimestamp(baselineTo, now); err != nil {
+		return baseline, current, fmt.Errorf("-baseline-to: %w", err)
+	}
+	if !baseline.from.Before(baseline.to) {
+		return baseline, current, fmt.Errorf("-baseline-from (%s) must be before -baseline-to (%s)",
+			baseline.from.Format(time.DateTime), baseline.to.Format(time.DateTime))
+	}
+
+	var filter Filter
+	if err := filter.SetRange(from, to, now); err != nil {
+		return baseline, current, err
+	}
+	current = compareWindow{from: filter.From, to: filter.To}
+	if current.from.IsZero() {
+		current.from = baseline.to
+	}
+	if !current.to.IsZero() && !current.from.Before(current.to) {
+		return baseline, current, fmt.Errorf("current window (%s) is empty", current)
+	}
+
+	return baseline, current, nil
+}
+
+// Reading input into metrics of baseline and current windows,
+// each window checks durations on its own
+func readWindowMetrics(input io.Reader, workers int, accept func(line string, number int) (LogRecord, bool, error),
+	windows [2]compareWindow, newChecker func() *SanityChecker, now time.Time, percentiles []float64) ([2]SourceMetrics, error) {
+	var metrics [2]*MetricsAccumulator
+	var pipelines [2]*Pipeline
+	for i := range windows {
+		metrics[i] = NewMetricsAccumulator(now, percentiles)
+		pipelines[i] = NewPipeline(newChecker())
+		pipelines[i].AddChecked(accumulatorSink{metrics: metrics[i]})
+	}
+
+	write := func(record LogRecord) error {
+		for i, window := range windows {
+			if window.contains(record.Date) {
+				if err := pipelines[i].Write(record); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+
+	var results [2]SourceMetrics
+	if err := readRecords(input, workers, accept, write, nil); err != nil {
+		return results, err
+	}
+
+	for i, window := range windows {
+		results[i] = newSourceMetrics(window.String(), metrics[i].Metrics(), pipelines[i].Suspicious())
+	}
+	return results, nil
+}
+
+// Change of one metric between baseline and current.
+// Durations are in seconds.
+type MetricChange struct {
+	Metric   string  `json:"metric"`
+	Baseline float64 `json:"baseline"`
+	Current  float64 `json:"current"`
+	Delta    float64 `json:"delta"`
+
+	// Relative change, null when baseline is zero
+	Change *float64 `json:"change"`
+}
+
+// Result of compare command
+type MetricsDiff struct {
+	Baseline SourceMetrics  `json:"baseline"`
+	Current  SourceMetrics  `json:"current"`
+	Changes  []MetricChange `json:"changes"`
+}
+
+// Changes of request count, rps, error rate and percentiles
+func diffMetrics(baseline, current SourceMetrics, percentiles []float64) MetricsDiff {
+	diff := MetricsDiff{Baseline: baseline, Current: current, Changes: []MetricChange{}}
+
+	add := func(metric string, before, after float64) {
+		change := MetricChange{Metric: metric, Baseline: before, Current: after, Delta: after - before}
+		if before != 0 {
+			relative := (after - before) / before
+			change.Change = &relative
+		}
+		diff.Changes = append(diff.Changes, change)
+	}
+
+	add("requests", float64(baseline.Count), float64(current.Count))
+	add("rps", baseline.RPS, current.RPS)
+	add("errors", float64(baseline.Errors), float64(current.Errors))
+	add("error_rate", baseline.ErrorRate, current.ErrorRate)
+
+	for i, p := range percentiles {
+		value := func(s SourceMetrics) float64 {
+			if i >= len(s.Percentiles) {
+				return 0
+			}
+			return s.Percentiles[i].Value.Seconds()
+		}
+		add(percentileLabel(p), value(baseline), value(current))
+	}
+
+	return diff
+}
+
+// Compare output, one row per metric with change in percent
+func printMetricsDiff(diff MetricsDiff, locale Locale) {
+	w := newTable(os.Stdout)
+	defer w.Flush()
+
+	fmt.Fprintf(w, "METRIC\tBASELINE\tCURRENT\tDELTA\tCHANGE\n")
+	fmt.Fprintf(w, "\t%s\t%s\t\t\n", diff.Baseline.Source, diff.Current.Source)
+
+	for _, c := range diff.Changes {
+		var format func(v float64) string
+		switch c.Metric {
+		case "requests", "errors":
+			format = func(v float64) string { return locale.Int(int(v)) }
+		case "rps":
+			format = func(v float64) string { return locale.Float(v, 2) }
+		case "error_rate":
+			format = locale.Percent
+		default:
+			format = func(v float64) string { return locale.Duration(time.Duration(math.Round(v * float64(time.Second)))) }
+		}
+
+		change := "-"
+		if c.Change != nil {
+			change = signed(locale.Percent(*c.Change), *c.Change)
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", c.Metric, format(c.Baseline), format(c.Current), signed(format(c.Delta), c.Delta), change)
+	}
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+)
+
+// Dry run of files, email and alert destinations.
+// Destinations are checked (directories are writable, SMTP and alert
+// credentials are valid), writes are counted instead of done and
+// reported at exit.
+type DryRun struct {
+	checks  []dryRunCheck
+	targets []*dryRunTarget
+	byName  map[string]*dryRunTarget
+	dirs    map[string]bool
+}
+
+// Result of destination check
+type dryRunCheck struct {
+	name string
+	err  error
+}
+
+// Destination which would be written
+type dryRunTarget struct {
+	name  string
+	unit  string
+	note  string
+	items int
+	bytes int64
+}
+
+func NewDryRun() *DryRun {
+	return &DryRun{
+		byName: make(map[string]*dryRunTarget),
+		dirs:   make(map[string]bool),
+	}
+}
+
+// Recording result of destination check
+func (d *DryRun) Check(name string, err error) {
+	d.checks = append(d.checks, dryRunCheck{name: name, err: err})
+}
+
+// Checking once that files can be created in directory
+func (d *DryRun) CheckDir(dir string) {
+	if dir == "" {
+		dir = "."
+	}
+	if d.dirs[dir] {
+		return
+	}
+	d.dirs[dir] = true
+
+	d.Check("directory "+dir, probeDir(dir))
+}
+
+// Destination by name, unit names its items (records, messages),
+// note describes what would happen to it
+func (d *DryRun) Target(name, unit, note string) *dryRunTarget {
+	t, ok := d.byName[name]
+	if !ok {
+		t = &dryRunTarget{name: name, unit: unit, note: note}
+		d.byName[name] = t
+		d.targets = append(d.targets, t)
+	}
+	return t
+}
+
+// Target of file, noting is it created, overwritten or appended to
+func (d *DryRun) File(path, unit string, appending bool) *dryRunTarget {
+	d.CheckDir(filepath.Dir(path))
+
+	note := "new"
+	if _, err := os.Stat(path); err == nil {
+		note = "overwrite"
+		if appending {
+			note = "append"
+		}
+	}
+	return d.Target(path, unit, note)
+}
+
+// Counting item (record, entry, message) of given size
+func (t *dryRunTarget) Add(items int, bytes int64) {
+	t.items += items
+	t.bytes += bytes
+}
+
+// Writer counting bytes of target
+type dryRunWriter struct {
+	target *dryRunTarget
+}
+
+func (w dryRunWriter) Write(p []byte) (int, error) {
+	w.target.bytes += int64(len(p))
+	return len(p), nil
+}
+
+// Writer counting lines and bytes of target, output of binary
+// formats is target without unit and only its bytes are counted
+type dryRunLineWriter struct {
+	target *dryRunTarget
+}
+
+func (w dryRunLineWriter) Write(p []byte) (int, error) {
+	if w.target.unit != "" {
+		w.target.items += bytes.Count(p, []byte("\n"))
+	}
+	w.target.bytes += int64(len(p))
+	return len(p), nil
+}
+
+// Record writer counting records of target
+type dryRunRecordWriter struct {
+	target *dryRunTarget
+}
+
+func (w dryRunRecordWriter) Write(record LogRecord) error {
+	w.target.Add(1, 0)
+	return nil
+}
+
+func (w dryRunRecordWriter) Close() error {
+	return nil
+}
+
+// Printing checks and skipped writes to stderr,
+// error is returned if any check failed
+func (d *DryRun) Report() error {
+	w := tabwriter.NewWriter(os.Stderr, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "Dry run, nothing was written\n")
+
+	var errs []error
+	for _, c := range d.checks {
+		status := "ok"
+		if c.err != nil {
+			status = "FAILED: " + c.err.Error()
+			errs = append(errs, fmt.Errorf("%s: %w", c.name, c.err))
+		}
+		fmt.Fprintf(w, "check\t%s\t%s\n", c.name, status)
+	}
+
+	for _, t := range d.targets {
+		size := ""
+		if t.bytes > 0 {
+			size = ", " + formatBytes(t.bytes)
+		}
+		if t.unit == "" {
+			fmt.Fprintf(w, "write\t%s\t%s (%s)\n", t.name, formatBytes(t.bytes), t.note)
+			continue
+		}
+		fmt.Fprintf(w, "write\t%s\t%d %s%s (%s)\n", t.name, t.items, t.unit, size, t.note)
+	}
+
+	w.Flush()
+	return errors.Join(errs...)
+}
+
+// Checking that files can be created in directory, or in its nearest
+// existing parent if it would be created. Probe file is removed.
+func probeDir(dir string) error {
+	for {
+		info, err := os.Stat(dir)
+		if err == nil {
+			if !info.IsDir() {
+				return fmt.Errorf("%s is not a directory", dir)
+			}
+			break
+		}
+		if !os.IsNotExist(err) {
+			return err
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return err
+		}
+		dir = parent
+	}
+
+	probe, err := os.CreateTemp(dir, ".ginlog-dry-run-*")
+	if err != nil {
+		return err
+	}
+	probe.Close()
+	return os.Remove(probe.Name())
+}
+
+// Human-readable byte size
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// Notifier recording alerts instead of sending them
+type dryRunNotifier struct {
+	Notifier
+	dryRun *DryRun
+}
+
+func (n dryRunNotifier) Trigger(alert Alert) error {
+	n.dryRun.Target(n.Name()+" trigger "+alert.Rule.Expr, "alerts", alert.Summary()).Add(1, 0)
+	return nil
+}
+
+func (n dryRunNotifier) Resolve(alert Alert) error {
+	n.dryRun.Target(n.Name()+" resolve "+alert.Rule.Expr, "alerts", alert.Summary()).Add(1, 0)
+	return nil
+}
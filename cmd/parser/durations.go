@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Unit of bare numbers in duration flags (-default-duration-unit)
+var defaultDurationUnit = time.Millisecond
+
+// Units of duration flags, Go units and days
+var durationUnits = map[string]time.Duration{
+	"ns": time.Nanosecond,
+	"us": time.Microsecond,
+	"µs": time.Microsecond,
+	"μs": time.Microsecond,
+	"ms": time.Millisecond,
+	"s":  time.Second,
+	"m":  time.Minute,
+	"h":  time.Hour,
+	"d":  24 * time.Hour,
+}
+
+const durationUnitList = "ns, us, ms, s, m, h, d"
+
+// Units people write instead of supported ones. M is rejected rather
+// than guessed, it may be minutes or months.
+var durationUnitHints = map[string]string{
+	"M":       "m for minutes or ms for milliseconds",
+	"MS":      "ms",
+	"msec":    "ms",
+	"msecs":   "ms",
+	"S":       "s",
+	"sec":     "s",
+	"secs":    "s",
+	"second":  "s",
+	"seconds": "s",
+	"min":     "m",
+	"mins":    "m",
+	"minute":  "m",
+	"minutes": "m",
+	"H":       "h",
+	"hr":      "h",
+	"hrs":     "h",
+	"hour":    "h",
+	"hours":   "h",
+	"D":       "d",
+	"day":     "d",
+	"days":    "d",
+	"w":       "d, a week is 7d",
+	"week":    "d, a week is 7d",
+	"weeks":   "d, a week is 7d",
+}
+
+var durationComponent = regexp.MustCompile(`^([0-9]*\.?[0-9]+)([^0-9.]*)`)
+
+// Parsing duration of flags: Go durations (1.5h, 90m, 1h30m), days (2d)
+// and bare numbers in default unit (500 is 500ms). Values which could
+// be read more than one way (1h30, 5M, 1,5h) are rejected.
+func parseFlagDuration(value string) (time.Duration, error) {
+	s := strings.TrimSpace(value)
+	if s == "" {
+		return 0, fmt.Errorf("empty duration")
+	}
+	if strings.Contains(s, ",") {
+		return 0, fmt.Errorf("ambiguous duration %q, decimal separator is . (e.g. %s)", value, strings.ReplaceAll(s, ",", "."))
+	}
+
+	sign := 1.0
+	if rest, ok := strings.CutPrefix(s, "-"); ok {
+		sign, s = -1, rest
+	} else {
+		s = strings.TrimPrefix(s, "+")
+	}
+
+	var total float64
+	if n, err := strconv.ParseFloat(s, 64); err == nil && !strings.ContainsAny(s, "eEinfINFxX_") {
+		total = n * float64(defaultDurationUnit)
+	} else {
+		for rest := s; rest != ""; {
+			m := durationComponent.FindStringSubmatch(rest)
+			if m == nil {
+				return 0, fmt.Errorf("invalid duration %q (e.g. 500ms, 1.5h, 90m, 2d)", value)
+			}
+			n, _ := strconv.ParseFloat(m[1], 64)
+			unit := strings.TrimSpace(m[2])
+			if unit == "" {
+				return 0, fmt.Errorf("ambiguous duration %q, %s has no unit (e.g. %sm)", value, m[1], s)
+			}
+			multiple, ok := durationUnits[unit]
+			if !ok {
+				if hint, ok := durationUnitHints[unit]; ok {
+					return 0, fmt.Errorf("ambiguous unit %q in duration %q, use %s", unit, value, hint)
+				}
+				return 0, fmt.Errorf("unknown unit %q in duration %q (supported: %s)", unit, value, durationUnitList)
+			}
+			total += n * float64(multiple)
+			rest = rest[len(m[0]):]
+		}
+	}
+
+	total = math.Round(sign * total)
+	if total > math.MaxInt64 || total < math.MinInt64 {
+		return 0, fmt.Errorf("duration %q out of range", value)
+	}
+	return time.Duration(total), nil
+}
+
+// Setting unit of bare numbers, one of units of duration flags
+func setDefaultDurationUnit(unit string) error {
+	multiple, ok := durationUnits[unit]
+	if !ok {
+		return fmt.Errorf("-default-duration-unit: unknown unit %q (supported: %s)", unit, durationUnitList)
+	}
+	defaultDurationUnit = multiple
+	return nil
+}
+
+// Finding -default-duration-unit before flags are parsed, so bare
+// numbers of flags before it are read in its unit too
+func scanDefaultDurationUnit(args []string) error {
+	for i, arg := range args {
+		if arg == "--" {
+			break
+		}
+		name, value, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if !strings.HasPrefix(arg, "-") || name != "default-duration-unit" {
+			continue
+		}
+		if !hasValue {
+			if i+1 >= len(args) {
+				return nil
+			}
+			value = args[i+1]
+		}
+		if err := setDefaultDurationUnit(value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/textproto"
+	"os"
+	"strings"
+	"time"
+)
+
+// Struct of SMTP delivery settings
+type EmailConfig struct {
+	To       []string
+	From     string
+	Server   string
+	User     string
+	Password string
+	Subject  string
+}
+
+// HTML report sent in email body
+var emailTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"percentileLabel": percentileLabel,
+}).Parse(`<!DOCTYPE html>
+<html>
+<body style="font-family: sans-serif">
+<h2>{{.Subject}}</h2>
+<table cellpadding="4">
+<tr><td>Total Requests</td><td>{{.Locale.Int .Metrics.Count}}</td></tr>
+{{- if .Metrics.Count}}
+<tr><td>Average Time</td><td>{{.Locale.Duration .Metrics.AverageTime}}</td></tr>
+<tr><td>Min Time</td><td>{{.Locale.Duration .Metrics.MinTime}}</td></tr>
+<tr><td>Max Time</td><td>{{.Locale.Duration .Metrics.MaxTime}}</td></tr>
+{{- range .Metrics.Percentiles}}
+<tr><td>{{percentileLabel .P}} Time</td><td>{{$.Locale.Duration .Value}}</td></tr>
+{{- end}}
+<tr><td>Error Rate</td><td>{{.Locale.Percent .Metrics.ErrorRate}}</td></tr>
+{{- end}}
+</table>
+{{- if .Metrics.StatusCounts}}
+<h3>Status Code Distribution</h3>
+<table cellpadding="4">
+{{- range $code, $count := .Metrics.StatusCounts}}
+<tr><td>{{$code}}</td><td>{{$.Locale.Int $count}}</td></tr>
+{{- end}}
+</table>
+{{- end}}
+<p>Generated at {{.Locale.FormatDateTime .Generated}}, matching records are attached as CSV.</p>
+</body>
+</html>
+`))
+
+// Rendering report message, returns config with default sender and subject
+func renderReport(cfg EmailConfig, metrics Metrics, records []LogRecord, locale Locale) (EmailConfig, []byte, error) {
+	if cfg.From == "" {
+		cfg.From = "ginlog@" + hostname()
+	}
+	if cfg.Subject == "" {
+		cfg.Subject = "Gin log report"
+	}
+
+	var html bytes.Buffer
+	err := emailTemplate.Execute(&html, map[string]any{
+		"Subject":   cfg.Subject,
+		"Metrics":   metrics,
+		"Locale":    locale,
+		"Generated": time.Now(),
+	})
+	if err != nil {
+		return cfg, nil, fmt.Errorf("rendering report: %w", err)
+	}
+
+	var attachment bytes.Buffer
+	if err := writeCSV(&attachment, records); err != nil {
+		return cfg, nil, fmt.Errorf("rendering CSV: %w", err)
+	}
+
+	message, err := buildMessage(cfg, html.Bytes(), attachment.Bytes())
+	return cfg, message, err
+}
+
+// Building multipart MIME message
+func buildMessage(cfg EmailConfig, html []byte, csv []byte) ([]byte, error) {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+
+	fmt.Fprintf(&body, "From: %s\r\n", cfg.From)
+	fmt.Fprintf(&body, "To: %s\r\n", strings.Join(cfg.To, ", "))
+	fmt.Fprintf(&body, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", cfg.Subject))
+	fmt.Fprintf(&body, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&body, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&body, "Content-Type: multipart/mixed; boundary=%s\r\n\r\n", mw.Boundary())
+
+	part, err := mw.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {"text/html; charset=utf-8"},
+		"Content-Transfer-Encoding": {"quoted-printable"},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	qp := quotedprintable.NewWriter(part)
+	if _, err := qp.Write(html); err != nil {
+		return nil, err
+	}
+	if err := qp.Close(); err != nil {
+		return nil, err
+	}
+
+	part, err = mw.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {"text/csv; charset=utf-8"},
+		"Content-Transfer-Encoding": {"quoted-printable"},
+		"Content-Disposition":       {`attachment; filename="records.csv"`},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	qp = quotedprintable.NewWriter(part)
+	if _, err := qp.Write(csv); err != nil {
+		return nil, err
+	}
+	if err := qp.Close(); err != nil {
+		return nil, err
+	}
+
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+
+	return body.Bytes(), nil
+}
+
+// Local host name for default sender
+func hostname() string {
+	name, err := os.Hostname()
+	if err != nil {
+		return "localhost"
+	}
+	return name
+}
@@ -0,0 +1,351 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"net"
+	"net/url"
+	"os"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Largest StatsD packet, fits Ethernet MTU with IP and UDP headers
+const statsdPacket = 1432
+
+// Percentiles sent to Graphite without -percentiles
+var emitPercentiles = []float64{50, 95, 99}
+
+// Destination of -emit: statsd://host[:8125] or graphite://host[:2003]
+type EmitTarget struct {
+	Scheme string
+	Addr   string
+}
+
+func parseEmitTarget(value string) (EmitTarget, error) {
+	u, err := url.Parse(value)
+	if err != nil || u.Host == "" {
+		return EmitTarget{}, fmt.Errorf("invalid target %q (expected statsd://host:8125 or graphite://host:2003)", value)
+	}
+
+	ports := map[string]string{"statsd": "8125", "graphite": "2003"}
+	port, ok := ports[u.Scheme]
+	if !ok {
+		return EmitTarget{}, fmt.Errorf("unknown scheme %q (supported: statsd, graphite)", u.Scheme)
+	}
+	if u.Port() != "" {
+		port = u.Port()
+	}
+	return EmitTarget{Scheme: u.Scheme, Addr: net.JoinHostPort(u.Hostname(), port)}, nil
+}
+
+// Metric path segment of route: /api/users/:id is api.users._id
+func metricSegment(route string) string {
+	route = strings.Trim(route, "/")
+	if route == "" {
+		return "root"
+	}
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r == '/':
+			return '.'
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-':
+			return r
+		}
+		return '_'
+	}, route)
+}
+
+// Percentiles sent for routes matching pattern (-emit-route-percentiles)
+type routePercentiles struct {
+	pattern     string
+	percentiles []float64
+}
+
+// Parsing "PATTERN=LIST" values like "/api/payments/**=50,99,99.9".
+// Patterns are globs of routes (path.Match) and /** at the end matches
+// route below it too. Empty list sends no percentiles of route.
+func parseRoutePercentiles(values []string) ([]routePercentiles, error) {
+	var rules []routePercentiles
+	for _, value := range values {
+		pattern, list, ok := strings.Cut(value, "=")
+		pattern = strings.TrimSpace(pattern)
+		if !ok || !strings.HasPrefix(pattern, "/") {
+			return nil, fmt.Errorf("expected /ROUTE-PATTERN=PERCENTILES, got %q", value)
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("bad pattern %q: %w", pattern, err)
+		}
+		percentiles, err := parsePercentiles(list)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, routePercentiles{pattern: pattern, percentiles: percentiles})
+	}
+	return rules, nil
+}
+
+// Checking does pattern match route
+func (r routePercentiles) Match(route string) bool {
+	return matchRoute(r.pattern, route)
+}
+
+// Aggregate of route between Graphite flushes
+type emitRoute struct {
+	route            string
+	requests, errors int
+	sketch           *Sketch
+}
+
+// Sink sending metrics of records to StatsD or Graphite while input
+// is read (-emit), so followed logs feed existing dashboards.
+//
+// StatsD gets counters and timers of every request in packets sent
+// at least every second: PREFIX.requests, PREFIX.errors,
+// PREFIX.status.5xx, PREFIX.route.ROUTE.requests and
+// PREFIX.route.ROUTE.latency. Graphite has no aggregation, so counts
+// and latency percentiles of each interval are sent at its end, per
+// route group when configured, so deep percentiles of few routes don't
+// multiply metrics of all of them.
+type Emitter struct {
+	target      EmitTarget
+	prefix      string
+	interval    time.Duration
+	percentiles []float64
+	routeRules  []routePercentiles
+
+	mu     sync.Mutex
+	conn   net.Conn
+	packet []byte
+
+	requests, errors int
+	classes          map[string]int
+	routes           map[string]*emitRoute
+
+	// Failure is reported once until sending works again
+	failing bool
+
+	// Target of -dry-run counting data instead of sending it
+	dryRun *dryRunTarget
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+func NewEmitter(target EmitTarget, prefix string, interval time.Duration, percentiles []float64, routeRules []routePercentiles, dryRun *DryRun) *Emitter {
+	if len(percentiles) == 0 {
+		percentiles = emitPercentiles
+	}
+	e := &Emitter{
+		target:      target,
+		prefix:      strings.TrimSuffix(prefix, "."),
+		interval:    interval,
+		percentiles: percentiles,
+		routeRules:  routeRules,
+		classes:     make(map[string]int),
+		routes:      make(map[string]*emitRoute),
+		stop:        make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+	if target.Scheme == "statsd" {
+		e.interval = time.Second
+	}
+
+	// Dry run checks address, Graphite by connecting to it, and counts
+	// packets and writes instead of sending them
+	if dryRun != nil {
+		name := target.Scheme + "://" + target.Addr
+		dryRun.Check(name, probeEmitTarget(target))
+		unit := "packets"
+		if target.Scheme == "graphite" {
+			unit = "writes"
+		}
+		e.dryRun = dryRun.Target(name, unit, "not sent")
+	}
+
+	go e.run()
+	return e
+}
+
+// Flushing every interval until finished
+func (e *Emitter) run() {
+	defer close(e.done)
+
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			e.flush(now)
+		case <-e.stop:
+			return
+		}
+	}
+}
+
+func (e *Emitter) Add(record LogRecord) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	key := groupKey(record, "url")
+	route := metricSegment(key)
+	class := statusClass(record.Code)
+
+	if e.target.Scheme == "statsd" {
+		e.statsd("requests:1|c")
+		e.statsd("status." + class + ":1|c")
+		if isError(record.Code) {
+			e.statsd("errors:1|c")
+		}
+		e.statsd("route." + route + ".requests:1|c")
+		e.statsd("route." + route + ".latency:" + strconv.FormatFloat(durationMs(record.Duration), 'f', -1, 64) + "|ms")
+		return nil
+	}
+
+	r, ok := e.routes[route]
+	if !ok {
+		r = &emitRoute{route: key, sketch: NewSketch()}
+		e.routes[route] = r
+	}
+	e.requests++
+	r.requests++
+	e.classes[class]++
+	if isError(record.Code) {
+		e.errors++
+		r.errors++
+	}
+	r.sketch.Add(record.Duration)
+	return nil
+}
+
+// Adding StatsD line to packet, full packet is sent first
+func (e *Emitter) statsd(line string) {
+	line = e.prefix + "." + line
+	if len(e.packet) > 0 && len(e.packet)+1+len(line) > statsdPacket {
+		e.send(e.packet)
+		e.packet = e.packet[:0]
+	}
+	if len(e.packet) > 0 {
+		e.packet = append(e.packet, '\n')
+	}
+	e.packet = append(e.packet, line...)
+}
+
+// Sending pending StatsD packet, or Graphite metrics of interval
+func (e *Emitter) flush(now time.Time) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.target.Scheme == "statsd" {
+		if len(e.packet) > 0 {
+			e.send(e.packet)
+			e.packet = e.packet[:0]
+		}
+		return
+	}
+
+	var b strings.Builder
+	ts := strconv.FormatInt(now.Unix(), 10)
+	metric := func(path string, value string) {
+		b.WriteString(e.prefix + "." + path + " " + value + " " + ts + "\n")
+	}
+
+	metric("requests", strconv.Itoa(e.requests))
+	metric("errors", strconv.Itoa(e.errors))
+	for _, class := range []string{"1xx", "2xx", "3xx", "4xx", "5xx"} {
+		metric("status."+class, strconv.Itoa(e.classes[class]))
+	}
+	for _, name := range slices.Sorted(maps.Keys(e.routes)) {
+		r := e.routes[name]
+		metric("route."+name+".requests", strconv.Itoa(r.requests))
+		metric("route."+name+".errors", strconv.Itoa(r.errors))
+		for _, p := range e.routePercentiles(r.route) {
+			metric("route."+name+".latency."+percentileLabel(p), strconv.FormatFloat(durationMs(r.sketch.Quantile(p)), 'f', -1, 64))
+		}
+	}
+
+	// Routes without requests are dropped, so unused routes stop
+	// being sent rather than being sent as zeroes forever
+	e.requests, e.errors = 0, 0
+	clear(e.classes)
+	clear(e.routes)
+
+	e.send([]byte(b.String()))
+}
+
+// Percentiles of route, of first matching rule or -percentiles
+func (e *Emitter) routePercentiles(route string) []float64 {
+	for _, rule := range e.routeRules {
+		if rule.Match(route) {
+			return rule.percentiles
+		}
+	}
+	return e.percentiles
+}
+
+// Sending data, connection is opened again after failure
+func (e *Emitter) send(data []byte) {
+	if e.dryRun != nil {
+		e.dryRun.Add(1, int64(len(data)))
+		return
+	}
+
+	if e.conn == nil {
+		network := "udp"
+		if e.target.Scheme == "graphite" {
+			network = "tcp"
+		}
+		conn, err := net.DialTimeout(network, e.target.Addr, 5*time.Second)
+		if err != nil {
+			e.fail(err)
+			return
+		}
+		e.conn = conn
+	}
+
+	e.conn.SetWriteDeadline(time.Now().Add(5 * time.Second))
+	if _, err := e.conn.Write(data); err != nil {
+		e.conn.Close()
+		e.conn = nil
+		e.fail(err)
+		return
+	}
+	e.failing = false
+}
+
+// Checking address of -emit, StatsD is UDP so only its address is
+// resolved
+func probeEmitTarget(target EmitTarget) error {
+	if target.Scheme == "statsd" {
+		_, err := net.ResolveUDPAddr("udp", target.Addr)
+		return err
+	}
+	conn, err := net.DialTimeout("tcp", target.Addr, 5*time.Second)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+func (e *Emitter) fail(err error) {
+	if !e.failing {
+		fmt.Fprintf(os.Stderr, "Error sending metrics to %s: %v\n", e.target.Addr, err)
+	}
+	e.failing = true
+}
+
+// Sending what is pending and closing connection
+func (e *Emitter) Finish() error {
+	close(e.stop)
+	<-e.done
+	e.flush(time.Now())
+
+	if e.conn != nil {
+		return e.conn.Close()
+	}
+	return nil
+}
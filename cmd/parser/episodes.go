@@ -0,0 +1,178 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Routes shown per episode in table, JSON has all of them
+const episodeRoutes = 3
+
+// 5xx request kept for clustering
+type episodeError struct {
+	date  time.Time
+	route string
+	code  int
+}
+
+// Errors of route in episode
+type EpisodeRoute struct {
+	Route  string `json:"route"`
+	Errors int    `json:"errors"`
+}
+
+// Errors of status code in episode
+type EpisodeCode struct {
+	Code   int `json:"code"`
+	Errors int `json:"errors"`
+}
+
+// Error episode: 5xx requests less than gap apart
+type Episode struct {
+	Start  time.Time      `json:"start"`
+	End    time.Time      `json:"end"`
+	Errors int            `json:"errors"`
+	Routes []EpisodeRoute `json:"routes"`
+	Codes  []EpisodeCode  `json:"codes"`
+}
+
+// Episodes report, errors of episodes smaller than min are isolated
+type EpisodesReport struct {
+	Gap      time.Duration `json:"gap"`
+	Min      int           `json:"min"`
+	PerRoute bool          `json:"per_route"`
+	Errors   int           `json:"errors"`
+	Isolated int           `json:"isolated"`
+	Episodes []Episode     `json:"episodes"`
+}
+
+// Clustering of 5xx requests into error episodes (-episodes), so
+// thousands of error lines become handful of incidents to review.
+// Errors less than gap apart belong to one episode, with perRoute
+// only errors of same route do.
+type Episodes struct {
+	gap      time.Duration
+	min      int
+	perRoute bool
+	now      time.Time
+	errors   []episodeError
+}
+
+func NewEpisodes(gap time.Duration, min int, perRoute bool, now time.Time) *Episodes {
+	return &Episodes{gap: gap, min: min, perRoute: perRoute, now: now}
+}
+
+// Adding record, only 5xx requests with plausible timestamps are kept
+func (e *Episodes) Add(record LogRecord) {
+	if !isError(record.Code) || !plausibleTimestamp(record.Date, e.now) {
+		return
+	}
+	e.errors = append(e.errors, episodeError{record.Date, groupKey(record, "url"), record.Code})
+}
+
+// Episodes by start, input doesn't have to be in time order
+func (e *Episodes) Report() EpisodesReport {
+	report := EpisodesReport{Gap: e.gap, Min: e.min, PerRoute: e.perRoute, Errors: len(e.errors), Episodes: []Episode{}}
+
+	slices.SortStableFunc(e.errors, func(a, b episodeError) int {
+		if e.perRoute {
+			if c := cmp.Compare(a.route, b.route); c != 0 {
+				return c
+			}
+		}
+		return a.date.Compare(b.date)
+	})
+
+	for start := 0; start < len(e.errors); {
+		end := start + 1
+		for end < len(e.errors) && e.errors[end].date.Sub(e.errors[end-1].date) < e.gap &&
+			(!e.perRoute || e.errors[end].route == e.errors[start].route) {
+			end++
+		}
+
+		if end-start < e.min {
+			report.Isolated += end - start
+		} else {
+			report.Episodes = append(report.Episodes, newEpisode(e.errors[start:end]))
+		}
+		start = end
+	}
+
+	slices.SortStableFunc(report.Episodes, func(a, b Episode) int {
+		return a.Start.Compare(b.Start)
+	})
+	return report
+}
+
+// Episode of errors in time order, routes and codes by errors
+func newEpisode(errors []episodeError) Episode {
+	episode := Episode{Start: errors[0].date, End: errors[len(errors)-1].date, Errors: len(errors)}
+
+	routes := make(map[string]int)
+	codes := make(map[int]int)
+	for _, err := range errors {
+		routes[err.route]++
+		codes[err.code]++
+	}
+
+	for _, route := range slices.Sorted(maps.Keys(routes)) {
+		episode.Routes = append(episode.Routes, EpisodeRoute{Route: route, Errors: routes[route]})
+	}
+	slices.SortStableFunc(episode.Routes, func(a, b EpisodeRoute) int {
+		return cmp.Compare(b.Errors, a.Errors)
+	})
+
+	for _, code := range slices.Sorted(maps.Keys(codes)) {
+		episode.Codes = append(episode.Codes, EpisodeCode{Code: code, Errors: codes[code]})
+	}
+	return episode
+}
+
+// Episodes output, routes beyond first few are counted only
+func printEpisodes(report EpisodesReport, locale Locale) {
+	by := "5xx requests"
+	if report.PerRoute {
+		by = "5xx requests of one route"
+	}
+	fmt.Printf("Error episodes: %s less than %v apart, at least %s errors\n\n", by, report.Gap, locale.Int(report.Min))
+
+	w := newTable(os.Stdout)
+	fmt.Fprintf(w, "START\tEND\tDURATION\tERRORS\tCODES\tROUTES\n")
+	for _, episode := range report.Episodes {
+		codes := make([]string, len(episode.Codes))
+		for i, code := range episode.Codes {
+			codes[i] = fmt.Sprintf("%d×%s", code.Code, locale.Int(code.Errors))
+		}
+
+		var routes []string
+		for i, route := range episode.Routes {
+			if i == episodeRoutes {
+				routes = append(routes, "+"+strconv.Itoa(len(episode.Routes)-episodeRoutes)+" more")
+				break
+			}
+			routes = append(routes, fmt.Sprintf("%s (%s)", route.Route, locale.Int(route.Errors)))
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%v\t%s\t%s\t%s\n",
+			locale.FormatDateTime(episode.Start),
+			locale.FormatDateTime(episode.End),
+			episode.End.Sub(episode.Start),
+			locale.Int(episode.Errors),
+			strings.Join(codes, " "),
+			strings.Join(routes, ", "),
+		)
+	}
+	w.Flush()
+
+	fmt.Printf("\n%s episodes of %s errors", locale.Int(len(report.Episodes)), locale.Int(report.Errors-report.Isolated))
+	if report.Isolated > 0 {
+		fmt.Printf(", %s isolated errors", locale.Int(report.Isolated))
+	}
+	fmt.Println()
+}
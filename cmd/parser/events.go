@@ -0,0 +1,381 @@
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Supported -events kinds
+var eventKinds = []string{"routes", "panics", "debug", "all"}
+
+// Event parsed from non-request gin output
+type Event interface {
+	Kind() string
+}
+
+// Route registration, "[GIN-debug] GET /users/:id --> main.getUser (3 handlers)"
+type RouteEvent struct {
+	Type     string `json:"type"`
+	Method   string `json:"method"`
+	Path     string `json:"path"`
+	Handler  string `json:"handler"`
+	Handlers int    `json:"handlers"`
+}
+
+// Other [GIN-debug] message
+type DebugEvent struct {
+	Type    string `json:"type"`
+	Message string `json:"message"`
+	Warning bool   `json:"warning"`
+}
+
+// Panic recovered by gin.Recovery.
+// Request is taken from request dump (debug mode) or from the
+// following [GIN] record with status 500 (release mode).
+type PanicEvent struct {
+	Type     string    `json:"type"`
+	Date     time.Time `json:"date"`
+	Method   string    `json:"method"`
+	URL      string    `json:"url"`
+	Route    string    `json:"route"`
+	IP       string    `json:"ip,omitempty"`
+	Error    string    `json:"error"`
+	Location string    `json:"location"`
+	Stack    []string  `json:"stack"`
+}
+
+func (RouteEvent) Kind() string { return "routes" }
+func (DebugEvent) Kind() string { return "debug" }
+func (PanicEvent) Kind() string { return "panics" }
+
+var (
+	ansiEscape    = regexp.MustCompile(`\x1b\[[0-9;]*m`)
+	routeLine     = regexp.MustCompile(`^\[GIN-debug\] (\S+)\s+(\S+)\s+--> (\S+) \((\d+) handlers\)$`)
+	recoveryLine  = regexp.MustCompile(`\[Recovery\] (\d{4}/\d{2}/\d{2} - \d{2}:\d{2}:\d{2}) panic recovered:`)
+	requestLine   = regexp.MustCompile(`^([A-Z]+) (\S+) HTTP/\d`)
+	stackFileLine = regexp.MustCompile(`^(\S+\.go):(\d+) \(0x[0-9a-f]+\)$`)
+)
+
+// Checking is events kind supported
+func validEvents(kind string) error {
+	if !slices.Contains(eventKinds, kind) {
+		return fmt.Errorf("unknown kind %q (supported: %s)", kind, strings.Join(eventKinds, ", "))
+	}
+	return nil
+}
+
+// Streaming parser of gin events.
+// Panic dumps span many lines, so lines must be passed in order.
+type EventParser struct {
+	emit func(Event)
+
+	// Panic being read and its state
+	current *PanicEvent
+	state   int
+
+	// Panics waiting for their [GIN] 500 record
+	pending []*PanicEvent
+}
+
+// States of panic dump parsing
+const (
+	panicRequest = iota
+	panicHeaders
+	panicError
+	panicStack
+)
+
+func NewEventParser(emit func(Event)) *EventParser {
+	return &EventParser{emit: emit}
+}
+
+// Parsing one line of output
+func (p *EventParser) Line(line string) {
+	line = ansiEscape.ReplaceAllString(strings.TrimSuffix(line, "\r"), "")
+
+	if m := recoveryLine.FindStringSubmatch(line); m != nil {
+		p.finishPanic()
+
+		date, _ := time.Parse("2006/01/02 - 15:04:05", m[1])
+		p.current = &PanicEvent{Type: "panic", Date: localTime(date)}
+		p.state = panicRequest
+		return
+	}
+
+	if strings.HasPrefix(line, "[GIN-debug]") {
+		p.finishPanic()
+		p.debugLine(line)
+		return
+	}
+
+	if strings.HasPrefix(line, "[GIN]") {
+		p.finishPanic()
+		if record, err := parseLine(line); err == nil && isError(record.Code) {
+			p.linkPanic(record)
+		}
+		return
+	}
+
+	if p.current != nil {
+		p.panicLine(line)
+	}
+}
+
+// Finishing input, panics without request are emitted as they are
+func (p *EventParser) Close() {
+	p.finishPanic()
+	for _, event := range p.pending {
+		p.emit(*event)
+	}
+	p.pending = nil
+}
+
+func (p *EventParser) debugLine(line string) {
+	if m := routeLine.FindStringSubmatch(line); m != nil {
+		handlers, _ := strconv.Atoi(m[4])
+		p.emit(RouteEvent{Type: "route", Method: m[1], Path: m[2], Handler: m[3], Handlers: handlers})
+		return
+	}
+
+	message := strings.TrimSpace(strings.TrimPrefix(line, "[GIN-debug]"))
+	message, warning := strings.CutPrefix(message, "[WARNING]")
+	p.emit(DebugEvent{Type: "debug", Message: strings.TrimSpace(message), Warning: warning})
+}
+
+func (p *EventParser) panicLine(line string) {
+	event := p.current
+
+	switch p.state {
+	case panicRequest:
+		if m := requestLine.FindStringSubmatch(line); m != nil {
+			event.Method, event.URL = m[1], m[2]
+			p.state = panicHeaders
+			return
+		}
+		if line == "" {
+			return
+		}
+		p.state = panicError
+		p.panicLine(line)
+
+	case panicHeaders:
+		if line == "" {
+			p.state = panicError
+		}
+
+	case panicError:
+		if stackFileLine.MatchString(line) {
+			p.state = panicStack
+			p.panicLine(line)
+			return
+		}
+		if line != "" {
+			event.Error = strings.TrimSpace(event.Error + "\n" + line)
+		}
+
+	case panicStack:
+		if line == "" {
+			return
+		}
+		event.Stack = append(event.Stack, line)
+
+		// First frame outside of runtime is where panic happened
+		if m := stackFileLine.FindStringSubmatch(line); m != nil && event.Location == "" &&
+			!strings.Contains(m[1], "/runtime/") && !strings.HasSuffix(m[1], "gin/recovery.go") {
+			event.Location = m[1] + ":" + m[2]
+		}
+	}
+}
+
+// Emitting finished panic, or keeping it until its request is logged
+func (p *EventParser) finishPanic() {
+	event := p.current
+	if event == nil {
+		return
+	}
+	p.current = nil
+
+	if event.URL == "" {
+		p.pending = append(p.pending, event)
+		return
+	}
+	p.emit(*event)
+}
+
+// Taking request of oldest pending panic from [GIN] 500 record
+func (p *EventParser) linkPanic(record LogRecord) {
+	if len(p.pending) == 0 {
+		return
+	}
+
+	event := p.pending[0]
+	p.pending = p.pending[1:]
+
+	event.Method, event.URL, event.IP = record.Method, record.URL, record.IP
+	p.emit(*event)
+}
+
+// Checking is event matching filter, only request filters
+// available for event are applied
+func eventMatches(event Event, filter Filter) bool {
+	switch e := event.(type) {
+	case RouteEvent:
+		return matchesFilter(LogRecord{Method: e.Method, URL: e.Path}, Filter{
+			methods:     filter.methods,
+			urls:        filter.urls,
+			urlPrefixes: filter.urlPrefixes,
+			urlRegex:    filter.urlRegex,
+		})
+	case PanicEvent:
+		filter.codes, filter.classes = filterList{}, filterList{}
+		filter.MinDuration, filter.MaxDuration, filter.exprs = "", "", nil
+		return matchesFilter(LogRecord{Date: e.Date, Method: e.Method, URL: e.URL, IP: e.IP}, filter)
+	}
+	return true
+}
+
+// Reading events of kind from input
+func readEvents(input io.Reader, kind string, filter Filter, normalizer *Normalizer) ([]Event, error) {
+	events := []Event{}
+
+	parser := NewEventParser(func(event Event) {
+		if kind != "all" && event.Kind() != kind {
+			return
+		}
+
+		if e, ok := event.(PanicEvent); ok {
+			e.Route = e.URL
+			if normalizer != nil && e.URL != "" {
+				e.Route = normalizer.Normalize(e.URL)
+			}
+			event = e
+		}
+
+		if eventMatches(event, filter) {
+			events = append(events, event)
+		}
+	})
+
+	reader := newLineReader(input)
+	for {
+		line, _, err := reader.ReadLine()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		parser.Line(line)
+	}
+	parser.Close()
+
+	return events, nil
+}
+
+// Panic count of route
+type PanicSummary struct {
+	Route     string `json:"route"`
+	Count     int    `json:"count"`
+	LastError string `json:"last_error"`
+	Location  string `json:"location"`
+}
+
+// Counting panics per route, most frequent first
+func summarizePanics(events []Event) []PanicSummary {
+	routes := make(map[string]*PanicSummary)
+	for _, event := range events {
+		e, ok := event.(PanicEvent)
+		if !ok {
+			continue
+		}
+
+		route := e.Method + " " + e.Route
+		if e.URL == "" {
+			route = "(unknown)"
+		}
+
+		summary, ok := routes[route]
+		if !ok {
+			summary = &PanicSummary{Route: route}
+			routes[route] = summary
+		}
+		summary.Count++
+		summary.LastError = e.Error
+		summary.Location = e.Location
+	}
+
+	summaries := make([]PanicSummary, 0, len(routes))
+	for _, summary := range routes {
+		summaries = append(summaries, *summary)
+	}
+	slices.SortFunc(summaries, func(a, b PanicSummary) int {
+		if c := cmp.Compare(b.Count, a.Count); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Route, b.Route)
+	})
+	return summaries
+}
+
+// Events mode output
+func printEvents(events []Event, kind string, locale Locale) {
+	w := newTable(os.Stdout)
+	defer w.Flush()
+
+	switch kind {
+	case "routes":
+		fmt.Fprintf(w, "METHOD\tPATH\tHANDLER\tHANDLERS\n")
+		for _, event := range events {
+			e := event.(RouteEvent)
+			fmt.Fprintf(w, "%s\t%s\t%s\t%d\n", e.Method, e.Path, e.Handler, e.Handlers)
+		}
+
+	case "panics":
+		fmt.Fprintf(w, "ROUTE\tPANICS\tLAST ERROR\tLOCATION\n")
+		for _, s := range summarizePanics(events) {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", s.Route, locale.Int(s.Count), firstLine(s.LastError), s.Location)
+		}
+
+	default:
+		for _, event := range events {
+			switch e := event.(type) {
+			case RouteEvent:
+				fmt.Fprintf(w, "route\t%s %s\t%s\n", e.Method, e.Path, e.Handler)
+			case DebugEvent:
+				level := "debug"
+				if e.Warning {
+					level = "warning"
+				}
+				fmt.Fprintf(w, "%s\t%s\t\n", level, e.Message)
+			case PanicEvent:
+				fmt.Fprintf(w, "panic\t%s %s %s\t%s (%s)\n",
+					locale.FormatDateTime(e.Date), e.Method, e.URL, firstLine(e.Error), e.Location)
+			}
+		}
+	}
+}
+
+// NDJSON events output
+func printEventsNDJSON(events []Event) error {
+	enc := json.NewEncoder(os.Stdout)
+	for _, event := range events {
+		if err := enc.Encode(event); err != nil {
+			return fmt.Errorf("encoding JSON: %w", err)
+		}
+	}
+	return nil
+}
+
+// First line of multi-line text
+func firstLine(text string) string {
+	line, _, _ := strings.Cut(text, "\n")
+	return line
+}
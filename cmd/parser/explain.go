@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"text/tabwriter"
+)
+
+// Explanation of filtering (-explain): records dropped per filter, so
+// filters returning nothing can be told apart. In raw mode first
+// record dropped by each filter and every -explain-every one after it
+// are printed to stderr with filter which dropped them.
+type Explain struct {
+	filter   Filter
+	every    int
+	annotate bool
+
+	mu    sync.Mutex
+	kept  int
+	drops map[string]int
+
+	// Filters in order of first drop
+	order []string
+}
+
+func NewExplain(filter Filter, every int, annotate bool) *Explain {
+	return &Explain{filter: filter, every: every, annotate: annotate, drops: make(map[string]int)}
+}
+
+// Recording record kept by filters
+func (e *Explain) Keep() {
+	e.mu.Lock()
+	e.kept++
+	e.mu.Unlock()
+}
+
+// Recording record of line dropped by filter flag (or -skip-paths,
+// -threat-only)
+func (e *Explain) Drop(flag string, number int, record LogRecord) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.drops[flag] == 0 {
+		e.order = append(e.order, flag)
+	}
+	e.drops[flag]++
+
+	if e.annotate && (e.drops[flag]-1)%e.every == 0 {
+		var line strings.Builder
+		writeRaw(&line, record)
+		fmt.Fprintf(os.Stderr, "Dropped by %s (line %d): %s", e.describe(flag), number, line.String())
+	}
+}
+
+// Filter flag with its value
+func (e *Explain) describe(flag string) string {
+	if value := e.filter.flagValue(flag); value != "" {
+		return fmt.Sprintf("%s %q", flag, value)
+	}
+	return flag
+}
+
+// Drops per filter with their share of parsed records
+func (e *Explain) Report(w io.Writer, locale Locale) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	total := e.kept
+	for _, n := range e.drops {
+		total += n
+	}
+
+	fmt.Fprintf(w, "Explain, parsed records per filter (first failing filter drops record):\n")
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, flag := range e.order {
+		fmt.Fprintf(tw, "  dropped by %s\t%s\t%s\n", e.describe(flag), locale.Int(e.drops[flag]), locale.Percent(ratio(float64(e.drops[flag]), float64(total))))
+	}
+	fmt.Fprintf(tw, "  kept\t%s\t%s\n", locale.Int(e.kept), locale.Percent(ratio(float64(e.kept), float64(total))))
+	tw.Flush()
+}
@@ -0,0 +1,847 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// Compiled expression over record fields.
+//
+// Supported syntax: literals (42, 1.5, "text", 200ms), fields (code,
+// duration, url, path, query, route, method, ip, date, day, hour), extra fields
+// of custom formats (field("user_agent")), arithmetic
+// (+ - * / %), comparison (== != < <= > >=), regex match (=~ !~),
+// logic (&& || !), parentheses and function calls like path_depth(url).
+// Expressions of -having are evaluated over group metrics instead.
+type Expr interface {
+	Eval(env exprEnv) (any, error)
+}
+
+// Names expression is evaluated over, record or group metrics
+type exprEnv interface {
+	field(name string) (any, error)
+	extraField(name string) string
+}
+
+// Record as expression environment
+type recordEnv LogRecord
+
+func (r recordEnv) field(name string) (any, error) {
+	return fieldValue(LogRecord(r), name)
+}
+
+func (r recordEnv) extraField(name string) string {
+	return r.Fields[name]
+}
+
+// Functions available in expressions
+var exprFuncs = map[string]func(args []any) (any, error){
+	"path_depth": func(args []any) (any, error) {
+		s, err := stringArg(args, 0, 1)
+		if err != nil {
+			return nil, err
+		}
+		path, _, _ := strings.Cut(s, "?")
+		return int64(len(splitPath(path))), nil
+	},
+	"segment": func(args []any) (any, error) {
+		s, err := stringArg(args, 0, 2)
+		if err != nil {
+			return nil, err
+		}
+		n, ok := args[1].(int64)
+		if !ok {
+			return nil, fmt.Errorf("segment: index must be integer")
+		}
+		path, _, _ := strings.Cut(s, "?")
+		segments := splitPath(path)
+		if n < 1 || int(n) > len(segments) {
+			return "", nil
+		}
+		return segments[n-1], nil
+	},
+	"prefix": func(args []any) (any, error) {
+		s, err := stringArg(args, 0, 2)
+		if err != nil {
+			return nil, err
+		}
+		n, ok := args[1].(int64)
+		if !ok {
+			return nil, fmt.Errorf("prefix: depth must be integer")
+		}
+		path, _, _ := strings.Cut(s, "?")
+		segments := splitPath(path)
+		return "/" + strings.Join(segments[:min(int(max(n, 0)), len(segments))], "/"), nil
+	},
+	"lower": func(args []any) (any, error) {
+		s, err := stringArg(args, 0, 1)
+		return strings.ToLower(s), err
+	},
+	"upper": func(args []any) (any, error) {
+		s, err := stringArg(args, 0, 1)
+		return strings.ToUpper(s), err
+	},
+	"len": func(args []any) (any, error) {
+		s, err := stringArg(args, 0, 1)
+		return int64(len(s)), err
+	},
+	"status_class": func(args []any) (any, error) {
+		if len(args) != 1 {
+			return nil, fmt.Errorf("status_class: expected 1 argument")
+		}
+		code, ok := args[0].(int64)
+		if !ok {
+			return nil, fmt.Errorf("status_class: code must be integer")
+		}
+		return strconv.FormatInt(code/100, 10) + "xx", nil
+	},
+}
+
+var exprCache sync.Map
+
+// Compiling record expression, results are cached by source
+func compileExpr(src string) (Expr, error) {
+	if expr, ok := exprCache.Load(src); ok {
+		return expr.(Expr), nil
+	}
+
+	expr, err := parseExpr(src, recordEnv{})
+	if err != nil {
+		return nil, err
+	}
+
+	exprCache.Store(src, expr)
+	return expr, nil
+}
+
+// Parsing expression, field names are checked against env
+func parseExpr(src string, env exprEnv) (Expr, error) {
+	p := &exprParser{src: src, env: env}
+	if err := p.tokenize(); err != nil {
+		return nil, err
+	}
+
+	expr, err := p.parseBinary(0)
+	if err != nil {
+		return nil, err
+	}
+
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected %q at %d", p.tokens[p.pos].text, p.tokens[p.pos].offset)
+	}
+	return expr, nil
+}
+
+// Checking is expression boolean, by evaluating it over env.
+// Errors of evaluation (e.g. missing values) are left to matching.
+func checkBoolean(expr Expr, env exprEnv) error {
+	value, err := expr.Eval(env)
+	if err != nil {
+		return nil
+	}
+	if _, ok := value.(bool); !ok {
+		return fmt.Errorf("expression must be boolean, not %s", formatValue(value))
+	}
+	return nil
+}
+
+// Splitting expression into operands of its top-level && chain, so
+// they can be checked one by one. Expression with top-level || is
+// one operand.
+func splitConjuncts(src string) []string {
+	p := &exprParser{src: src}
+	if err := p.tokenize(); err != nil {
+		return []string{src}
+	}
+
+	var parts []string
+	start, depth := 0, 0
+	for _, t := range p.tokens {
+		if t.kind != tokenOp {
+			continue
+		}
+		switch {
+		case t.text == "(":
+			depth++
+		case t.text == ")":
+			depth--
+		case depth == 0 && t.text == "||":
+			return []string{src}
+		case depth == 0 && t.text == "&&":
+			parts = append(parts, strings.TrimSpace(src[start:t.offset]))
+			start = t.offset + len(t.text)
+		}
+	}
+	return append(parts, strings.TrimSpace(src[start:]))
+}
+
+// Evaluating boolean expression, errors and other values don't match
+func exprMatches(expr Expr, env exprEnv) bool {
+	value, err := expr.Eval(env)
+	matched, ok := value.(bool)
+	return err == nil && ok && matched
+}
+
+// Formatting expression value as group key
+func formatValue(value any) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case time.Time:
+		return v.Format("2006/01/02 - 15:04:05")
+	}
+	return fmt.Sprint(value)
+}
+
+// Lexer
+
+type tokenKind int
+
+const (
+	tokenNumber tokenKind = iota
+	tokenDuration
+	tokenString
+	tokenIdent
+	tokenOp
+)
+
+type token struct {
+	kind   tokenKind
+	text   string
+	offset int
+	value  any
+}
+
+// Operators, longest first
+var exprOperators = []string{"&&", "||", "==", "!=", "<=", ">=", "=~", "!~", "<", ">", "+", "-", "*", "/", "%", "!", "(", ")", ","}
+
+type exprParser struct {
+	src    string
+	env    exprEnv
+	tokens []token
+	pos    int
+}
+
+func (p *exprParser) tokenize() error {
+	src := p.src
+
+	for i := 0; i < len(src); {
+		c := rune(src[i])
+
+		switch {
+		case unicode.IsSpace(c):
+			i++
+
+		case c >= '0' && c <= '9' || c == '.':
+			j := i
+			for j < len(src) && (src[j] >= '0' && src[j] <= '9' || src[j] == '.') {
+				j++
+			}
+			k := j
+			for k < len(src) && unicode.IsLetter(rune(src[k])) {
+				k++
+			}
+
+			if k > j {
+				d, err := parseDuration(src[i:k])
+				if err != nil {
+					return fmt.Errorf("invalid duration %q at %d", src[i:k], i)
+				}
+				p.tokens = append(p.tokens, token{tokenDuration, src[i:k], i, d})
+			} else if strings.Contains(src[i:j], ".") {
+				f, err := strconv.ParseFloat(src[i:j], 64)
+				if err != nil {
+					return fmt.Errorf("invalid number %q at %d", src[i:j], i)
+				}
+				p.tokens = append(p.tokens, token{tokenNumber, src[i:j], i, f})
+			} else {
+				n, err := strconv.ParseInt(src[i:j], 10, 64)
+				if err != nil {
+					return fmt.Errorf("invalid number %q at %d", src[i:j], i)
+				}
+				p.tokens = append(p.tokens, token{tokenNumber, src[i:j], i, n})
+			}
+			i = k
+
+		case c == '"' || c == '\'':
+			j := i + 1
+			for j < len(src) && src[j] != byte(c) {
+				if src[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j >= len(src) {
+				return fmt.Errorf("unterminated string at %d", i)
+			}
+
+			text := src[i : j+1]
+			if c == '\'' {
+				text = `"` + strings.ReplaceAll(src[i+1:j], `"`, `\"`) + `"`
+			}
+			value, err := strconv.Unquote(text)
+			if err != nil {
+				return fmt.Errorf("invalid string at %d", i)
+			}
+			p.tokens = append(p.tokens, token{tokenString, src[i : j+1], i, value})
+			i = j + 1
+
+		case unicode.IsLetter(c) || c == '_':
+			j := i
+			for j < len(src) && (unicode.IsLetter(rune(src[j])) || unicode.IsDigit(rune(src[j])) || src[j] == '_') {
+				j++
+			}
+			p.tokens = append(p.tokens, token{tokenIdent, src[i:j], i, nil})
+			i = j
+
+		default:
+			matched := false
+			for _, op := range exprOperators {
+				if strings.HasPrefix(src[i:], op) {
+					p.tokens = append(p.tokens, token{tokenOp, op, i, nil})
+					i += len(op)
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return fmt.Errorf("unexpected %q at %d", c, i)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Parser
+
+// Binary operator precedence
+var exprPrecedence = map[string]int{
+	"||": 1,
+	"&&": 2,
+	"==": 3, "!=": 3, "<": 3, "<=": 3, ">": 3, ">=": 3, "=~": 3, "!~": 3,
+	"+": 4, "-": 4,
+	"*": 5, "/": 5, "%": 5,
+}
+
+func (p *exprParser) peek() (token, bool) {
+	if p.pos >= len(p.tokens) {
+		return token{}, false
+	}
+	return p.tokens[p.pos], true
+}
+
+func (p *exprParser) expect(op string) error {
+	t, ok := p.peek()
+	if !ok {
+		return fmt.Errorf("expected %q at end of expression", op)
+	}
+	if t.kind != tokenOp || t.text != op {
+		return fmt.Errorf("expected %q at %d, got %q", op, t.offset, t.text)
+	}
+	p.pos++
+	return nil
+}
+
+func (p *exprParser) parseBinary(minPrecedence int) (Expr, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		t, ok := p.peek()
+		if !ok || t.kind != tokenOp {
+			return left, nil
+		}
+
+		precedence, ok := exprPrecedence[t.text]
+		if !ok || precedence <= minPrecedence {
+			return left, nil
+		}
+		p.pos++
+
+		right, err := p.parseBinary(precedence)
+		if err != nil {
+			return nil, err
+		}
+
+		if t.text == "=~" || t.text == "!~" {
+			left, err = newMatchExpr(left, right, t.text == "!~")
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		left = binaryExpr{op: t.text, left: left, right: right}
+	}
+}
+
+func (p *exprParser) parseUnary() (Expr, error) {
+	t, ok := p.peek()
+	if ok && t.kind == tokenOp && (t.text == "!" || t.text == "-") {
+		p.pos++
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return unaryExpr{op: t.text, operand: operand}, nil
+	}
+
+	return p.parsePrimary()
+}
+
+func (p *exprParser) parsePrimary() (Expr, error) {
+	t, ok := p.peek()
+	if !ok {
+		return nil, fmt.Errorf("unexpected end of expression")
+	}
+	p.pos++
+
+	switch t.kind {
+	case tokenNumber, tokenDuration, tokenString:
+		return literalExpr{t.value}, nil
+
+	case tokenIdent:
+		switch t.text {
+		case "true":
+			return literalExpr{true}, nil
+		case "false":
+			return literalExpr{false}, nil
+		}
+
+		if next, ok := p.peek(); ok && next.kind == tokenOp && next.text == "(" {
+			return p.parseCall(t)
+		}
+
+		if _, err := p.env.field(t.text); err != nil {
+			return nil, fmt.Errorf("%v at %d", err, t.offset)
+		}
+		return fieldExpr{t.text}, nil
+
+	case tokenOp:
+		if t.text == "(" {
+			expr, err := p.parseBinary(0)
+			if err != nil {
+				return nil, err
+			}
+			return expr, p.expect(")")
+		}
+	}
+
+	return nil, fmt.Errorf("unexpected %q at %d", t.text, t.offset)
+}
+
+func (p *exprParser) parseCall(name token) (Expr, error) {
+	if name.text == "field" {
+		return p.parseFieldCall(name)
+	}
+
+	fn, ok := exprFuncs[name.text]
+	if !ok {
+		return nil, fmt.Errorf("unknown function %q at %d", name.text, name.offset)
+	}
+
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+
+	call := callExpr{name: name.text, fn: fn}
+	if t, ok := p.peek(); ok && t.kind == tokenOp && t.text == ")" {
+		p.pos++
+		return call, nil
+	}
+
+	for {
+		arg, err := p.parseBinary(0)
+		if err != nil {
+			return nil, err
+		}
+		call.args = append(call.args, arg)
+
+		t, ok := p.peek()
+		if ok && t.kind == tokenOp && t.text == "," {
+			p.pos++
+			continue
+		}
+		return call, p.expect(")")
+	}
+}
+
+// Extra field lookup, field("user_agent")
+func (p *exprParser) parseFieldCall(name token) (Expr, error) {
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+
+	t, ok := p.peek()
+	if !ok || t.kind != tokenString {
+		return nil, fmt.Errorf("field: expected field name string at %d", name.offset)
+	}
+	p.pos++
+
+	return extraFieldExpr{t.value.(string)}, p.expect(")")
+}
+
+// Nodes
+
+type literalExpr struct {
+	value any
+}
+
+func (e literalExpr) Eval(exprEnv) (any, error) {
+	return e.value, nil
+}
+
+type fieldExpr struct {
+	name string
+}
+
+func (e fieldExpr) Eval(env exprEnv) (any, error) {
+	return env.field(e.name)
+}
+
+// Value of record field by name
+func fieldValue(record LogRecord, name string) (any, error) {
+	switch name {
+	case "code":
+		return int64(record.Code), nil
+	case "duration":
+		return record.Duration, nil
+	case "url":
+		return record.URL, nil
+	case "path":
+		return record.Path(), nil
+	case "query":
+		return record.Query(), nil
+	case "route":
+		return groupKey(record, "url"), nil
+	case "method":
+		return record.Method, nil
+	case "ip":
+		return record.IP, nil
+	case "date":
+		return record.Date, nil
+	case "day":
+		return record.Date.Format("2006/01/02"), nil
+	case "hour":
+		return int64(record.Date.Hour()), nil
+	}
+	return nil, fmt.Errorf("unknown field %q", name)
+}
+
+type extraFieldExpr struct {
+	name string
+}
+
+func (e extraFieldExpr) Eval(env exprEnv) (any, error) {
+	return env.extraField(e.name), nil
+}
+
+type callExpr struct {
+	name string
+	fn   func(args []any) (any, error)
+	args []Expr
+}
+
+func (e callExpr) Eval(env exprEnv) (any, error) {
+	args := make([]any, len(e.args))
+	for i, arg := range e.args {
+		value, err := arg.Eval(env)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = value
+	}
+	return e.fn(args)
+}
+
+type unaryExpr struct {
+	op      string
+	operand Expr
+}
+
+func (e unaryExpr) Eval(env exprEnv) (any, error) {
+	value, err := e.operand.Eval(env)
+	if err != nil {
+		return nil, err
+	}
+
+	if e.op == "!" {
+		b, ok := value.(bool)
+		if !ok {
+			return nil, fmt.Errorf("! expects boolean")
+		}
+		return !b, nil
+	}
+
+	switch v := value.(type) {
+	case int64:
+		return -v, nil
+	case float64:
+		return -v, nil
+	case time.Duration:
+		return -v, nil
+	}
+	return nil, fmt.Errorf("- expects number")
+}
+
+type matchExpr struct {
+	left   Expr
+	re     *regexp.Regexp
+	negate bool
+}
+
+func newMatchExpr(left, right Expr, negate bool) (Expr, error) {
+	literal, ok := right.(literalExpr)
+	pattern, isString := literal.value.(string)
+	if !ok || !isString {
+		return nil, fmt.Errorf("right side of =~ must be string literal")
+	}
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	return matchExpr{left: left, re: re, negate: negate}, nil
+}
+
+func (e matchExpr) Eval(env exprEnv) (any, error) {
+	value, err := e.left.Eval(env)
+	if err != nil {
+		return nil, err
+	}
+	return e.re.MatchString(formatValue(value)) != e.negate, nil
+}
+
+type binaryExpr struct {
+	op          string
+	left, right Expr
+}
+
+func (e binaryExpr) Eval(env exprEnv) (any, error) {
+	left, err := e.left.Eval(env)
+	if err != nil {
+		return nil, err
+	}
+
+	// Short-circuit logic
+	if e.op == "&&" || e.op == "||" {
+		l, ok := left.(bool)
+		if !ok {
+			return nil, fmt.Errorf("%s expects boolean", e.op)
+		}
+		if e.op == "&&" && !l || e.op == "||" && l {
+			return l, nil
+		}
+
+		right, err := e.right.Eval(env)
+		if err != nil {
+			return nil, err
+		}
+		r, ok := right.(bool)
+		if !ok {
+			return nil, fmt.Errorf("%s expects boolean", e.op)
+		}
+		return r, nil
+	}
+
+	right, err := e.right.Eval(env)
+	if err != nil {
+		return nil, err
+	}
+
+	return applyOp(e.op, left, right)
+}
+
+// Applying binary operator to values
+func applyOp(op string, left, right any) (any, error) {
+	switch l := left.(type) {
+	case string:
+		r, ok := right.(string)
+		if !ok {
+			return nil, fmt.Errorf("can't apply %s to string and %T", op, right)
+		}
+		switch op {
+		case "+":
+			return l + r, nil
+		case "==":
+			return l == r, nil
+		case "!=":
+			return l != r, nil
+		case "<":
+			return l < r, nil
+		case "<=":
+			return l <= r, nil
+		case ">":
+			return l > r, nil
+		case ">=":
+			return l >= r, nil
+		}
+		return nil, fmt.Errorf("can't apply %s to strings", op)
+
+	case bool:
+		r, ok := right.(bool)
+		if !ok {
+			return nil, fmt.Errorf("can't apply %s to bool and %T", op, right)
+		}
+		switch op {
+		case "==":
+			return l == r, nil
+		case "!=":
+			return l != r, nil
+		}
+		return nil, fmt.Errorf("can't apply %s to booleans", op)
+
+	case time.Time:
+		r, ok := right.(time.Time)
+		if !ok {
+			return nil, fmt.Errorf("can't apply %s to time and %T", op, right)
+		}
+		return compareOp(op, float64(l.Sub(r)), 0)
+
+	case time.Duration:
+		switch r := right.(type) {
+		case time.Duration:
+			switch op {
+			case "+":
+				return l + r, nil
+			case "-":
+				return l - r, nil
+			case "/":
+				if r == 0 {
+					return nil, fmt.Errorf("division by zero")
+				}
+				return float64(l) / float64(r), nil
+			}
+			return compareOp(op, float64(l), float64(r))
+
+		case int64, float64:
+			f := toFloat(r)
+			switch op {
+			case "*":
+				return time.Duration(float64(l) * f), nil
+			case "/":
+				if f == 0 {
+					return nil, fmt.Errorf("division by zero")
+				}
+				return time.Duration(float64(l) / f), nil
+			}
+		}
+		return nil, fmt.Errorf("can't apply %s to duration and %T", op, right)
+
+	case int64:
+		switch r := right.(type) {
+		case int64:
+			switch op {
+			case "+":
+				return l + r, nil
+			case "-":
+				return l - r, nil
+			case "*":
+				return l * r, nil
+			case "/", "%":
+				if r == 0 {
+					return nil, fmt.Errorf("division by zero")
+				}
+				if op == "/" {
+					return l / r, nil
+				}
+				return l % r, nil
+			}
+			return compareOp(op, float64(l), float64(r))
+		case float64:
+			return floatOp(op, float64(l), r)
+		case time.Duration:
+			if op == "*" {
+				return time.Duration(l) * r, nil
+			}
+		}
+		return nil, fmt.Errorf("can't apply %s to number and %T", op, right)
+
+	case float64:
+		switch r := right.(type) {
+		case int64, float64:
+			return floatOp(op, l, toFloat(r))
+		case time.Duration:
+			if op == "*" {
+				return time.Duration(l * float64(r)), nil
+			}
+		}
+		return nil, fmt.Errorf("can't apply %s to number and %T", op, right)
+	}
+
+	return nil, fmt.Errorf("can't apply %s to %T", op, left)
+}
+
+func floatOp(op string, l, r float64) (any, error) {
+	switch op {
+	case "+":
+		return l + r, nil
+	case "-":
+		return l - r, nil
+	case "*":
+		return l * r, nil
+	case "/":
+		if r == 0 {
+			return nil, fmt.Errorf("division by zero")
+		}
+		return l / r, nil
+	case "%":
+		if r == 0 {
+			return nil, fmt.Errorf("division by zero")
+		}
+		return math.Mod(l, r), nil
+	}
+	return compareOp(op, l, r)
+}
+
+func compareOp(op string, l, r float64) (any, error) {
+	switch op {
+	case "==":
+		return l == r, nil
+	case "!=":
+		return l != r, nil
+	case "<":
+		return l < r, nil
+	case "<=":
+		return l <= r, nil
+	case ">":
+		return l > r, nil
+	case ">=":
+		return l >= r, nil
+	}
+	return nil, fmt.Errorf("can't apply %s to numbers", op)
+}
+
+func toFloat(value any) float64 {
+	switch v := value.(type) {
+	case int64:
+		return float64(v)
+	case float64:
+		return v
+	}
+	return 0
+}
+
+// String argument of function call
+func stringArg(args []any, i int, count int) (string, error) {
+	if len(args) != count {
+		return "", fmt.Errorf("expected %d arguments, got %d", count, len(args))
+	}
+	s, ok := args[i].(string)
+	if !ok {
+		return "", fmt.Errorf("argument %d must be string", i+1)
+	}
+	return s, nil
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+var exprRecord = LogRecord{
+	Date:     time.Date(2024, 5, 1, 10, 30, 0, 0, time.UTC),
+	Code:     503,
+	Duration: 250 * time.Millisecond,
+	IP:       "10.0.0.5",
+	Method:   "POST",
+	URL:      "/api/v1/orders/42?dry=1",
+	Fields:   map[string]string{"user_agent": "curl/8.0"},
+}
+
+func TestExprEval(t *testing.T) {
+	tests := []struct {
+		src  string
+		want any
+	}{
+		{"code", int64(503)},
+		{"code >= 500 && duration > 200ms", true},
+		{"code >= 500 && duration > 300ms", false},
+		{"code == 200 || method == \"POST\"", true},
+		{"!(code < 500)", true},
+		{"url =~ \"^/api/\"", true},
+		{"url !~ \"orders\"", false},
+		{"path", "/api/v1/orders/42"},
+		{"query", "dry=1"},
+		{"hour", int64(10)},
+		{"day", "2024/05/01"},
+		{"code / 100", int64(5)},
+		{"code % 100", int64(3)},
+		{"code / 2.0", 251.5},
+		{"1 + 2 * 3", int64(7)},
+		{"(1 + 2) * 3", int64(9)},
+		{"-code + 3", int64(-500)},
+		{"duration * 2", 500 * time.Millisecond},
+		{"duration / 1s", 0.25},
+		{"duration + 1s > 1s", true},
+		{"\"a\" + \"b\"", "ab"},
+		{"path_depth(url)", int64(4)},
+		{"segment(url, 3)", "orders"},
+		{"segment(url, 9)", ""},
+		{"prefix(url, 2)", "/api/v1"},
+		{"upper(method)", "POST"},
+		{"lower(\"GET\")", "get"},
+		{"len(ip)", int64(8)},
+		{"status_class(code)", "5xx"},
+		{"field(\"user_agent\") == \"curl/8.0\"", true},
+		{"field(\"missing\")", ""},
+	}
+	for _, tt := range tests {
+		expr, err := parseExpr(tt.src, recordEnv{})
+		if err != nil {
+			t.Errorf("parseExpr(%q): %v", tt.src, err)
+			continue
+		}
+		got, err := expr.Eval(recordEnv(exprRecord))
+		if err != nil {
+			t.Errorf("%q: %v", tt.src, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%q = %#v, want %#v", tt.src, got, tt.want)
+		}
+	}
+}
+
+func TestExprParseErrors(t *testing.T) {
+	for _, src := range []string{
+		"",
+		"code >",
+		"(code > 1",
+		"code > 1)",
+		"unknown_field > 1",
+		"nofunc(url)",
+		"\"unterminated",
+		"url =~ \"(\"",
+		"code $ 1",
+	} {
+		if _, err := parseExpr(src, recordEnv{}); err == nil {
+			t.Errorf("parseExpr(%q) succeeded, want error", src)
+		}
+	}
+}
+
+func TestExprEvalErrors(t *testing.T) {
+	for _, src := range []string{
+		"code / 0",
+		"code % 0",
+		"duration / 0",
+		"url + 1",
+		"method < 5",
+		"true + true",
+		"segment(url, \"x\")",
+		"status_class(url)",
+	} {
+		expr, err := parseExpr(src, recordEnv{})
+		if err != nil {
+			t.Errorf("parseExpr(%q): %v", src, err)
+			continue
+		}
+		if got, err := expr.Eval(recordEnv(exprRecord)); err == nil {
+			t.Errorf("%q = %#v, want error", src, got)
+		}
+	}
+}
+
+func TestExprMatches(t *testing.T) {
+	for src, want := range map[string]bool{
+		"code == 503": true,
+		"code == 200": false,
+		"code":        false,
+		"code / 0":    false,
+	} {
+		expr, err := compileExpr(src)
+		if err != nil {
+			t.Fatalf("compileExpr(%q): %v", src, err)
+		}
+		if got := exprMatches(expr, recordEnv(exprRecord)); got != want {
+			t.Errorf("exprMatches(%q) = %v, want %v", src, got, want)
+		}
+	}
+
+	if err := checkBoolean(mustCompile(t, "code + 1"), recordEnv(exprRecord)); err == nil {
+		t.Error("checkBoolean of number succeeded")
+	}
+	if err := checkBoolean(mustCompile(t, "code > 1"), recordEnv(exprRecord)); err != nil {
+		t.Errorf("checkBoolean of comparison: %v", err)
+	}
+}
+
+func mustCompile(t *testing.T, src string) Expr {
+	t.Helper()
+	expr, err := compileExpr(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return expr
+}
+
+func TestSplitConjuncts(t *testing.T) {
+	tests := map[string][]string{
+		"code >= 500":                    {"code >= 500"},
+		"code >= 500 && url =~ \"a&&b\"": {"code >= 500", "url =~ \"a&&b\""},
+		"(a && b) && c":                  {"(a && b)", "c"},
+		"a && b || c":                    {"a && b || c"},
+		"a && (b || c) && duration > 1s": {"a", "(b || c)", "duration > 1s"},
+	}
+	for src, want := range tests {
+		if got := splitConjuncts(src); !reflect.DeepEqual(got, want) {
+			t.Errorf("splitConjuncts(%q) = %q, want %q", src, got, want)
+		}
+	}
+}
+
+func TestFormatValue(t *testing.T) {
+	for _, tt := range []struct {
+		value any
+		want  string
+	}{
+		{"x", "x"},
+		{1.5, "1.5"},
+		{int64(42), "42"},
+		{true, "true"},
+		{250 * time.Millisecond, "250ms"},
+		{exprRecord.Date, "2024/05/01 - 10:30:00"},
+	} {
+		if got := formatValue(tt.value); got != tt.want && !strings.EqualFold(got, tt.want) {
+			t.Errorf("formatValue(%#v) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,474 @@
+package main
+
+import (
+	"fmt"
+	"net/netip"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Struct of record filters.
+// Method, Code, Class, Date, URL, URLPrefix, IP and Param take
+// comma-separated values, "!" before value excludes it (e.g.
+// "!/healthz,!/ready").
+type Filter struct {
+	Method string
+	Code   string
+	Date   string
+	URL    string
+	IP     string
+
+	URLPrefix string
+
+	// Query parameters, name=value or name for any value
+	Param string
+
+	// Single regex, as it can contain commas, "!" excludes matches
+	URLRegex string
+
+	// Status classes, e.g. 4xx,5xx
+	Class string
+
+	// Duration bounds, both inclusive, in log units (e.g. 500ms, 1.5s)
+	MinDuration string
+	MaxDuration string
+
+	// Boolean expressions over record fields of -filter and -where,
+	// e.g. code >= 500 && url =~ "^/api/"
+	Expr  string
+	Where string
+
+	// Time range, From is inclusive and To is exclusive.
+	// Zero value means the bound is not set.
+	From time.Time
+	To   time.Time
+
+	// Compiled matchers
+	methods, codes, classes, dates filterList
+	urls, urlPrefixes, urlRegex    filterList
+	ips, params                    filterList
+
+	minDuration, maxDuration time.Duration
+	exprs                    []Expr
+	exprFlags                []string
+}
+
+// Matcher of one filter value
+type recordMatcher func(record LogRecord) bool
+
+// Compiled values of filter flag. Record matches list when it matches
+// any included value (if there are any) and no excluded one.
+type filterList struct {
+	include, exclude []recordMatcher
+}
+
+// Parsing comma-separated filter values, "!" before value excludes it
+func parseFilterList(value string, parse func(v string) (recordMatcher, error)) (filterList, error) {
+	var list filterList
+	if value == "" {
+		return list, nil
+	}
+
+	for _, v := range strings.Split(value, ",") {
+		v, negate := strings.CutPrefix(strings.TrimSpace(v), "!")
+		if v == "" {
+			return list, fmt.Errorf("empty value in %q", value)
+		}
+
+		match, err := parse(v)
+		if err != nil {
+			return list, err
+		}
+
+		if negate {
+			list.exclude = append(list.exclude, match)
+		} else {
+			list.include = append(list.include, match)
+		}
+	}
+	return list, nil
+}
+
+// Checking is record matching list, empty list matches every record
+func (l filterList) matches(record LogRecord) bool {
+	if len(l.include) > 0 && !slices.ContainsFunc(l.include, func(m recordMatcher) bool { return m(record) }) {
+		return false
+	}
+	return !slices.ContainsFunc(l.exclude, func(m recordMatcher) bool { return m(record) })
+}
+
+// Matcher of status class like 5xx
+func parseClass(v string) (recordMatcher, error) {
+	class := strings.ToLower(v)
+	if len(class) != 3 || class[0] < '1' || class[0] > '5' || class[1:] != "xx" {
+		return nil, fmt.Errorf("invalid status class %q (expected 1xx to 5xx)", v)
+	}
+	return func(record LogRecord) bool { return statusClass(record.Code) == class }, nil
+}
+
+// Matcher of status code, or of status class
+func parseCode(v string) (recordMatcher, error) {
+	if strings.HasSuffix(strings.ToLower(v), "xx") {
+		return parseClass(v)
+	}
+
+	code, err := strconv.Atoi(v)
+	if err != nil {
+		return nil, fmt.Errorf("invalid status code %q", v)
+	}
+	return func(record LogRecord) bool { return record.Code == code }, nil
+}
+
+// Matcher of URL path, query string is compared only when value has one
+func parseURL(v string) (recordMatcher, error) {
+	if strings.Contains(v, "?") {
+		return func(record LogRecord) bool { return record.URL == v }, nil
+	}
+	return func(record LogRecord) bool { return record.Path() == v }, nil
+}
+
+// Matcher of query parameter: name=value matches one of values of
+// parameter, name alone matches any value
+func parseParam(v string) (recordMatcher, error) {
+	name, value, hasValue := strings.Cut(v, "=")
+	if name == "" {
+		return nil, fmt.Errorf("invalid parameter %q (expected name=value or name)", v)
+	}
+	return func(record LogRecord) bool {
+		values, ok := queryParams(record.URL)[name]
+		return ok && (!hasValue || slices.Contains(values, value))
+	}, nil
+}
+
+// Matcher of IP address or CIDR range
+func parseIP(v string) (recordMatcher, error) {
+	if !strings.Contains(v, "/") {
+		return func(record LogRecord) bool { return record.IP == v }, nil
+	}
+
+	prefix, err := netip.ParsePrefix(v)
+	if err != nil {
+		return nil, err
+	}
+	prefix = prefix.Masked()
+
+	return func(record LogRecord) bool {
+		addr, err := netip.ParseAddr(record.IP)
+		return err == nil && prefix.Contains(addr.Unmap())
+	}, nil
+}
+
+// Timestamp layouts accepted by -from/-to
+var timestampLayouts = []string{
+	"2006/01/02 - 15:04:05",
+	"2006/01/02 15:04:05",
+	"2006/01/02 15:04",
+	"2006/01/02",
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04:05",
+	"2006-01-02",
+}
+
+// Compiling value lists, regex and CIDR matchers, called once before matching
+func (f *Filter) Compile() error {
+	var err error
+
+	lists := []struct {
+		flag  string
+		value string
+		list  *filterList
+		parse func(v string) (recordMatcher, error)
+	}{
+		{"-method", f.Method, &f.methods, func(v string) (recordMatcher, error) {
+			return func(record LogRecord) bool { return record.Method == v }, nil
+		}},
+		{"-code", f.Code, &f.codes, parseCode},
+		{"-class", f.Class, &f.classes, parseClass},
+		{"-date", f.Date, &f.dates, func(v string) (recordMatcher, error) {
+			return func(record LogRecord) bool { return record.Date.Format("2006/01/02") == v }, nil
+		}},
+		{"-url", f.URL, &f.urls, parseURL},
+		{"-url-prefix", f.URLPrefix, &f.urlPrefixes, func(v string) (recordMatcher, error) {
+			return func(record LogRecord) bool { return strings.HasPrefix(record.URL, v) }, nil
+		}},
+		{"-ip", f.IP, &f.ips, parseIP},
+		{"-param", f.Param, &f.params, parseParam},
+	}
+	for _, l := range lists {
+		if *l.list, err = parseFilterList(l.value, l.parse); err != nil {
+			return fmt.Errorf("%s: %w", l.flag, err)
+		}
+	}
+
+	if f.URLRegex != "" {
+		src, negate := strings.CutPrefix(f.URLRegex, "!")
+		re, err := regexp.Compile(src)
+		if err != nil {
+			return fmt.Errorf("-url-regex: %w", err)
+		}
+
+		match := recordMatcher(func(record LogRecord) bool { return re.MatchString(record.URL) })
+		if negate {
+			f.urlRegex.exclude = []recordMatcher{match}
+		} else {
+			f.urlRegex.include = []recordMatcher{match}
+		}
+	}
+
+	if f.MinDuration != "" {
+		if f.minDuration, err = parseFlagDuration(f.MinDuration); err != nil {
+			return fmt.Errorf("-min-duration: %w", err)
+		}
+	}
+	if f.MaxDuration != "" {
+		if f.maxDuration, err = parseFlagDuration(f.MaxDuration); err != nil {
+			return fmt.Errorf("-max-duration: %w", err)
+		}
+	}
+	if f.MinDuration != "" && f.MaxDuration != "" && f.minDuration > f.maxDuration {
+		return fmt.Errorf("-min-duration (%v) must not be above -max-duration (%v)", f.minDuration, f.maxDuration)
+	}
+
+	for _, e := range []struct{ flag, src string }{{"-filter", f.Expr}, {"-where", f.Where}} {
+		if e.src == "" {
+			continue
+		}
+
+		expr, err := parseExpr(e.src, recordEnv{})
+		if err == nil {
+			err = checkBoolean(expr, recordEnv{})
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", e.flag, err)
+		}
+		f.exprs = append(f.exprs, expr)
+		f.exprFlags = append(f.exprFlags, e.flag)
+	}
+
+	return nil
+}
+
+// Status class of code, e.g. 5xx
+func statusClass(code int) string {
+	return fmt.Sprintf("%dxx", code/100)
+}
+
+// Setting time range from flag values
+func (f *Filter) SetRange(from, to string, now time.Time) error {
+	var err error
+
+	if from != "" {
+		f.From, err = parseTimestamp(from, now)
+		if err != nil {
+			return fmt.Errorf("-from: %w", err)
+		}
+	}
+
+	if to != "" {
+		f.To, err = parseTimestamp(to, now)
+		if err != nil {
+			return fmt.Errorf("-to: %w", err)
+		}
+	}
+
+	if !f.From.IsZero() && !f.To.IsZero() && !f.From.Before(f.To) {
+		return fmt.Errorf("-from (%s) must be before -to (%s)",
+			f.From.Format(time.DateTime), f.To.Format(time.DateTime))
+	}
+
+	return nil
+}
+
+// Timestamp parsing
+//
+// Gin writes local wall-clock time without a zone, and parseLine reads it
+// as UTC, so relative and zoned values are converted to the same
+// wall-clock representation before comparing. With -tz all values are
+// instants, zone-less ones are read in display zone.
+func parseTimestamp(value string, now time.Time) (time.Time, error) {
+	value = strings.TrimSpace(value)
+
+	if value == "now" {
+		return zonedTime(now), nil
+	}
+
+	if strings.HasPrefix(value, "-") || strings.HasPrefix(value, "+") {
+		offset, err := parseFlagDuration(value)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid relative time: %w", err)
+		}
+		return zonedTime(now.Add(offset)), nil
+	}
+
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return zonedTime(t.In(now.Location())), nil
+	}
+
+	for _, layout := range timestampLayouts {
+		if t, err := time.ParseInLocation(layout, value, flagZone()); err == nil {
+			return t, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("invalid timestamp %q", value)
+}
+
+// Dropping location but keeping wall-clock time
+func wallClock(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(),
+		t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.UTC)
+}
+
+// Checking is record matching filter
+func matchesFilter(record LogRecord, filter Filter) bool {
+	return rejectingFilter(record, filter) == ""
+}
+
+// Flag of first filter rejecting record, empty when record matches
+func rejectingFilter(record LogRecord, filter Filter) string {
+	lists := [...]struct {
+		flag string
+		list *filterList
+	}{
+		{"-method", &filter.methods},
+		{"-code", &filter.codes},
+		{"-class", &filter.classes},
+		{"-date", &filter.dates},
+		{"-url", &filter.urls},
+		{"-url-prefix", &filter.urlPrefixes},
+		{"-url-regex", &filter.urlRegex},
+		{"-ip", &filter.ips},
+		{"-param", &filter.params},
+	}
+	for _, l := range lists {
+		if !l.list.matches(record) {
+			return l.flag
+		}
+	}
+
+	if filter.MinDuration != "" && record.Duration < filter.minDuration {
+		return "-min-duration"
+	}
+
+	if filter.MaxDuration != "" && record.Duration > filter.maxDuration {
+		return "-max-duration"
+	}
+
+	if !filter.From.IsZero() && record.Date.Before(filter.From) {
+		return "-from"
+	}
+
+	if !filter.To.IsZero() && !record.Date.Before(filter.To) {
+		return "-to"
+	}
+
+	for i, expr := range filter.exprs {
+		if !exprMatches(expr, recordEnv(record)) {
+			return filter.exprFlags[i]
+		}
+	}
+
+	return ""
+}
+
+// Filter of record, checked alone
+type filterCheck struct {
+	flag, value string
+	match       recordMatcher
+}
+
+// Set filters in order rejectingFilter checks them, operands of && in
+// -filter and -where expressions are checked one by one
+func filterChecks(filter Filter) []filterCheck {
+	var checks []filterCheck
+	lists := [...]struct {
+		flag string
+		list filterList
+	}{
+		{"-method", filter.methods},
+		{"-code", filter.codes},
+		{"-class", filter.classes},
+		{"-date", filter.dates},
+		{"-url", filter.urls},
+		{"-url-prefix", filter.urlPrefixes},
+		{"-url-regex", filter.urlRegex},
+		{"-ip", filter.ips},
+		{"-param", filter.params},
+	}
+	for _, l := range lists {
+		if len(l.list.include) > 0 || len(l.list.exclude) > 0 {
+			checks = append(checks, filterCheck{l.flag, filter.flagValue(l.flag), l.list.matches})
+		}
+	}
+
+	if filter.MinDuration != "" {
+		checks = append(checks, filterCheck{"-min-duration", filter.MinDuration, func(r LogRecord) bool { return r.Duration >= filter.minDuration }})
+	}
+	if filter.MaxDuration != "" {
+		checks = append(checks, filterCheck{"-max-duration", filter.MaxDuration, func(r LogRecord) bool { return r.Duration <= filter.maxDuration }})
+	}
+	if !filter.From.IsZero() {
+		checks = append(checks, filterCheck{"-from", filter.flagValue("-from"), func(r LogRecord) bool { return !r.Date.Before(filter.From) }})
+	}
+	if !filter.To.IsZero() {
+		checks = append(checks, filterCheck{"-to", filter.flagValue("-to"), func(r LogRecord) bool { return r.Date.Before(filter.To) }})
+	}
+
+	for i, expr := range filter.exprs {
+		flag := filter.exprFlags[i]
+		var operands []filterCheck
+		for _, src := range splitConjuncts(filter.flagValue(flag)) {
+			operand, err := parseExpr(src, recordEnv{})
+			if err != nil {
+				operands = nil
+				break
+			}
+			operands = append(operands, filterCheck{flag, src, func(r LogRecord) bool { return exprMatches(operand, recordEnv(r)) }})
+		}
+		if operands == nil {
+			operands = []filterCheck{{flag, filter.flagValue(flag), func(r LogRecord) bool { return exprMatches(expr, recordEnv(r)) }}}
+		}
+		checks = append(checks, operands...)
+	}
+	return checks
+}
+
+// Value of filter flag as given
+func (f Filter) flagValue(flag string) string {
+	switch flag {
+	case "-method":
+		return f.Method
+	case "-code":
+		return f.Code
+	case "-class":
+		return f.Class
+	case "-date":
+		return f.Date
+	case "-url":
+		return f.URL
+	case "-url-prefix":
+		return f.URLPrefix
+	case "-url-regex":
+		return f.URLRegex
+	case "-ip":
+		return f.IP
+	case "-param":
+		return f.Param
+	case "-min-duration":
+		return f.MinDuration
+	case "-max-duration":
+		return f.MaxDuration
+	case "-from":
+		return f.From.Format(time.RFC3339)
+	case "-to":
+		return f.To.Format(time.RFC3339)
+	case "-filter":
+		return f.Expr
+	case "-where":
+		return f.Where
+	}
+	return ""
+}
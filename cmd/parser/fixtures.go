@@ -0,0 +1,375 @@
+package main
+
+import (
+	crand "crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"math/rand/v2"
+	"net/netip"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Formats of fixture files
+var fixtureFormats = []string{"json", "yaml"}
+
+// Extra fields kept in fixtures, others may identify users
+var fixtureFields = []string{"user_agent", "proto", "body_size", "bytes_in", "content_type", "accept"}
+
+// Query values kept as they are, like page=2 or sort=desc
+var fixtureSafeValue = regexp.MustCompile(`^(?:[A-Za-z_-]{1,20}|\d{1,6})$`)
+
+// Sampled request of fixture
+type FixtureSample struct {
+	Method     string            `json:"method"`
+	URL        string            `json:"url"`
+	Status     int               `json:"status"`
+	DurationMs float64           `json:"duration_ms"`
+	Date       time.Time         `json:"date"`
+	IP         string            `json:"ip"`
+	Fields     map[string]string `json:"fields,omitempty"`
+}
+
+// Fixture file of route
+type Fixture struct {
+	Route    string          `json:"route"`
+	Requests int             `json:"requests"`
+	Samples  []FixtureSample `json:"samples"`
+}
+
+// Records of route with one method and status class, sampled
+// uniformly with reservoir
+type fixtureStratum struct {
+	key     string
+	seen    int
+	samples []LogRecord
+}
+
+// Strata of route
+type fixtureRoute struct {
+	route    string
+	requests int
+	strata   map[string]*fixtureStratum
+}
+
+// Recorder of representative requests per route (record-fixtures).
+// Every route keeps up to perRoute samples of each method and status
+// class, so rare error responses get into fixtures too.
+type FixtureRecorder struct {
+	total, perRoute int
+	routes          map[string]*fixtureRoute
+}
+
+func NewFixtureRecorder(total, perRoute int) *FixtureRecorder {
+	return &FixtureRecorder{
+		total:    total,
+		perRoute: perRoute,
+		routes:   make(map[string]*fixtureRoute),
+	}
+}
+
+// Adding record, without -routes or -normalize URLs are grouped by
+// built-in heuristics, so /users/1 and /users/2 share fixture
+func (f *FixtureRecorder) Add(record LogRecord) error {
+	key := normalizedRoute(record)
+	route, ok := f.routes[key]
+	if !ok {
+		route = &fixtureRoute{route: key, strata: make(map[string]*fixtureStratum)}
+		f.routes[key] = route
+	}
+	route.requests++
+
+	stratumKey := record.Method + " " + statusClass(record.Code)
+	stratum, ok := route.strata[stratumKey]
+	if !ok {
+		stratum = &fixtureStratum{key: stratumKey}
+		route.strata[stratumKey] = stratum
+	}
+	stratum.seen++
+
+	if len(stratum.samples) < f.perRoute {
+		stratum.samples = append(stratum.samples, record)
+	} else if i := rand.IntN(stratum.seen); i < f.perRoute {
+		stratum.samples[i] = record
+	}
+	return nil
+}
+
+// Fixtures of routes by traffic. Slots are dealt to routes one by one
+// until total is reached, so with many routes busiest ones are kept.
+// Samples of route take turns among its strata, busiest first.
+func (f *FixtureRecorder) Fixtures(anonymizer *Anonymizer) []Fixture {
+	routes := make([]*fixtureRoute, 0, len(f.routes))
+	for _, route := range f.routes {
+		routes = append(routes, route)
+	}
+	slices.SortFunc(routes, func(a, b *fixtureRoute) int {
+		if a.requests != b.requests {
+			return b.requests - a.requests
+		}
+		return strings.Compare(a.route, b.route)
+	})
+
+	slots := make([]int, len(routes))
+	for left, round := f.total, 0; left > 0 && round < f.perRoute; round++ {
+		for i := range routes {
+			if left == 0 {
+				break
+			}
+			slots[i]++
+			left--
+		}
+	}
+
+	var fixtures []Fixture
+	for i, route := range routes {
+		if slots[i] == 0 {
+			break
+		}
+
+		strata := make([]*fixtureStratum, 0, len(route.strata))
+		for _, stratum := range route.strata {
+			strata = append(strata, stratum)
+		}
+		slices.SortFunc(strata, func(a, b *fixtureStratum) int {
+			if a.seen != b.seen {
+				return b.seen - a.seen
+			}
+			return strings.Compare(a.key, b.key)
+		})
+
+		fixture := Fixture{Route: route.route, Requests: route.requests}
+		for round := 0; len(fixture.Samples) < slots[i]; round++ {
+			added := false
+			for _, stratum := range strata {
+				if round < len(stratum.samples) && len(fixture.Samples) < slots[i] {
+					fixture.Samples = append(fixture.Samples, anonymizer.Sample(stratum.samples[round]))
+					added = true
+				}
+			}
+			if !added {
+				break
+			}
+		}
+		fixtures = append(fixtures, fixture)
+	}
+	return fixtures
+}
+
+// Writing fixture per route into directory, file names are made
+// from routes (/users/:id is users_id.json)
+func writeFixtures(dir, format string, fixtures []Fixture) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+
+	used := make(map[string]bool)
+	for _, fixture := range fixtures {
+		name := fixtureFileName(fixture.Route)
+		for i := 2; used[name]; i++ {
+			name = fixtureFileName(fixture.Route) + "-" + strconv.Itoa(i)
+		}
+		used[name] = true
+
+		out, err := createAtomic(filepath.Join(dir, name+"."+format), false)
+		if err != nil {
+			return err
+		}
+		if format == "yaml" {
+			err = writeFixtureYAML(out.File(), fixture)
+		} else {
+			err = writeFixtureJSON(out.File(), fixture)
+		}
+		if err != nil {
+			out.Abort()
+			return err
+		}
+		if err := out.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// File name of route, characters other than letters, digits, dots
+// and dashes become underscores
+func fixtureFileName(route string) string {
+	name := strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '.' || r == '-' {
+			return r
+		}
+		return '_'
+	}, strings.Trim(route, "/"))
+	name = strings.Trim(regexp.MustCompile(`_+`).ReplaceAllString(name, "_"), "_.")
+	if name == "" {
+		return "root"
+	}
+	return name
+}
+
+func writeFixtureJSON(w io.Writer, fixture Fixture) error {
+	data, err := json.MarshalIndent(fixture, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+// YAML of fixture, strings are double-quoted with JSON escapes
+// which YAML reads the same
+func writeFixtureYAML(w io.Writer, fixture Fixture) error {
+	quote := func(s string) string {
+		data, _ := json.Marshal(s)
+		return string(data)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "route: %s\nrequests: %d\nsamples:\n", quote(fixture.Route), fixture.Requests)
+	for _, sample := range fixture.Samples {
+		fmt.Fprintf(&b, "  - method: %s\n", quote(sample.Method))
+		fmt.Fprintf(&b, "    url: %s\n", quote(sample.URL))
+		fmt.Fprintf(&b, "    status: %d\n", sample.Status)
+		fmt.Fprintf(&b, "    duration_ms: %s\n", strconv.FormatFloat(sample.DurationMs, 'f', -1, 64))
+		fmt.Fprintf(&b, "    date: %s\n", quote(sample.Date.Format(time.RFC3339Nano)))
+		fmt.Fprintf(&b, "    ip: %s\n", quote(sample.IP))
+		if len(sample.Fields) > 0 {
+			b.WriteString("    fields:\n")
+			for _, name := range slices.Sorted(maps.Keys(sample.Fields)) {
+				fmt.Fprintf(&b, "      %s: %s\n", name, quote(sample.Fields[name]))
+			}
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// Anonymizer of fixture samples. IPs are replaced with addresses of
+// documentation ranges in order of appearance, identifiers in paths
+// with values of same shape derived from them with random salt of
+// run, query values other than short words and numbers are redacted.
+type Anonymizer struct {
+	salt []byte
+	ips  map[string]string
+}
+
+func NewAnonymizer() *Anonymizer {
+	salt := make([]byte, 16)
+	crand.Read(salt)
+	return &Anonymizer{salt: salt, ips: make(map[string]string)}
+}
+
+// Anonymized sample of record
+func (a *Anonymizer) Sample(record LogRecord) FixtureSample {
+	sample := FixtureSample{
+		Method:     record.Method,
+		URL:        a.URL(record.URL),
+		Status:     record.Code,
+		DurationMs: durationMs(record.Duration),
+		Date:       record.Date,
+		IP:         a.IP(record.IP),
+	}
+	for _, name := range fixtureFields {
+		if value, ok := record.Fields[name]; ok {
+			if sample.Fields == nil {
+				sample.Fields = make(map[string]string)
+			}
+			sample.Fields[name] = value
+		}
+	}
+	return sample
+}
+
+// Address of documentation ranges (RFC 5737, RFC 3849) standing for IP
+func (a *Anonymizer) IP(ip string) string {
+	if ip == "" {
+		return ""
+	}
+	if fake, ok := a.ips[ip]; ok {
+		return fake
+	}
+
+	n := len(a.ips)
+	var fake string
+	if addr, err := netip.ParseAddr(ip); err == nil && addr.Unmap().Is6() {
+		fake = fmt.Sprintf("2001:db8::%x", n+1)
+	} else {
+		nets := []string{"192.0.2", "198.51.100", "203.0.113"}
+		fake = fmt.Sprintf("%s.%d", nets[n/254%len(nets)], n%254+1)
+		if n >= 254*len(nets) {
+			fake = fmt.Sprintf("2001:db8::%x", n+1)
+		}
+	}
+	a.ips[ip] = fake
+	return fake
+}
+
+// URL with identifiers in path replaced and query values redacted
+func (a *Anonymizer) URL(rawURL string) string {
+	path, query, hasQuery := strings.Cut(rawURL, "?")
+
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		switch {
+		case numericSegment.MatchString(segment):
+			segments[i] = a.digits(segment)
+		case uuidSegment.MatchString(segment):
+			h := a.hash(segment)
+			segments[i] = fmt.Sprintf("%x-%x-%x-%x-%x", h[0:4], h[4:6], h[6:8], h[8:10], h[10:16])
+		case hashSegment.MatchString(segment):
+			segments[i] = strings.Repeat(hex.EncodeToString(a.hash(segment)), len(segment)/64+1)[:len(segment)]
+		}
+	}
+	path = strings.Join(segments, "/")
+	if !hasQuery {
+		return path
+	}
+
+	pairs := strings.Split(query, "&")
+	for i, pair := range pairs {
+		name, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			continue
+		}
+		if decoded, err := url.QueryUnescape(value); err != nil || !fixtureSafeValue.MatchString(decoded) {
+			pairs[i] = name + "=REDACTED"
+		}
+	}
+	return path + "?" + strings.Join(pairs, "&")
+}
+
+// Number of same length standing for numeric identifier, small
+// numbers like page or version are kept
+func (a *Anonymizer) digits(segment string) string {
+	if len(segment) <= 2 {
+		return segment
+	}
+	n := binary.BigEndian.Uint64(a.hash(segment))
+	digits := strconv.FormatUint(n, 10)
+	for len(digits) < len(segment) {
+		digits += digits
+	}
+	digits = digits[:len(segment)]
+	if digits[0] == '0' {
+		digits = "1" + digits[1:]
+	}
+	return digits
+}
+
+func (a *Anonymizer) hash(value string) []byte {
+	h := sha256.New()
+	h.Write(a.salt)
+	h.Write([]byte(value))
+	return h.Sum(nil)
+}
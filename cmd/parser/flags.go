@@ -0,0 +1,79 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Repeatable string flag
+type listFlag []string
+
+func (l *listFlag) String() string {
+	return strings.Join(*l, ", ")
+}
+
+func (l *listFlag) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// Byte size flag like 500MB or 2GiB, units are powers of 1024
+type sizeFlag int64
+
+func (s *sizeFlag) String() string {
+	if *s == 0 {
+		return "0"
+	}
+	return formatBytes(int64(*s))
+}
+
+func (s *sizeFlag) Set(value string) error {
+	upper := strings.ToUpper(strings.TrimSpace(value))
+	number := strings.TrimRightFunc(upper, unicode.IsLetter)
+	unit := upper[len(number):]
+
+	multiplier := map[string]float64{
+		"": 1, "B": 1,
+		"K": 1 << 10, "KB": 1 << 10, "KIB": 1 << 10,
+		"M": 1 << 20, "MB": 1 << 20, "MIB": 1 << 20,
+		"G": 1 << 30, "GB": 1 << 30, "GIB": 1 << 30,
+		"T": 1 << 40, "TB": 1 << 40, "TIB": 1 << 40,
+	}[unit]
+	n, err := strconv.ParseFloat(strings.TrimSpace(number), 64)
+	if err != nil || multiplier == 0 || n < 0 {
+		return fmt.Errorf("invalid size %q", value)
+	}
+	*s = sizeFlag(n * multiplier)
+	return nil
+}
+
+// Duration flag accepting Go durations, days (2d) and bare numbers in
+// -default-duration-unit (500 is 500ms by default)
+type durationFlag time.Duration
+
+func (d *durationFlag) String() string {
+	return time.Duration(*d).String()
+}
+
+func (d *durationFlag) Set(value string) error {
+	parsed, err := parseFlagDuration(value)
+	if err != nil {
+		return err
+	}
+	*d = durationFlag(parsed)
+	return nil
+}
+
+func (d *durationFlag) Get() any {
+	return time.Duration(*d)
+}
+
+// Registering duration flag like flag.DurationVar
+func durationVar(fs *flag.FlagSet, p *time.Duration, name string, value time.Duration, usage string) {
+	*p = value
+	fs.Var((*durationFlag)(p), name, usage)
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Total server time per route (-folded), written as folded stacks
+// of flamegraph.pl, speedscope and pprof-like tools: path segments
+// are frames, so width of each node is time spent under that part
+// of URL tree.
+type FoldedStacks struct {
+	time map[string]time.Duration
+}
+
+func NewFoldedStacks() *FoldedStacks {
+	return &FoldedStacks{time: make(map[string]time.Duration)}
+}
+
+func (f *FoldedStacks) Add(record LogRecord) {
+	f.time[groupKey(record, "url")] += record.Duration
+}
+
+// Stack of route, /api/users/:id is api;users;:id. Query string is
+// dropped and ";" in segments, which separates frames, is escaped.
+func foldedStack(route string) string {
+	route, _, _ = strings.Cut(route, "?")
+	route = strings.Trim(route, "/")
+	if route == "" {
+		return "/"
+	}
+	segments := strings.Split(route, "/")
+	for i, segment := range segments {
+		segments[i] = strings.ReplaceAll(segment, ";", "%3B")
+	}
+	return strings.Join(segments, ";")
+}
+
+// Writing stacks by stack with weight in microseconds, as tools
+// expect integer weights. Routes with same stack are summed.
+func (f *FoldedStacks) Write(w io.Writer) error {
+	stacks := make(map[string]time.Duration)
+	for route, total := range f.time {
+		stacks[foldedStack(route)] += total
+	}
+
+	bw := bufio.NewWriter(w)
+	for _, stack := range slices.Sorted(maps.Keys(stacks)) {
+		if weight := stacks[stack].Microseconds(); weight > 0 {
+			fmt.Fprintf(bw, "%s %d\n", stack, weight)
+		}
+	}
+	return bw.Flush()
+}
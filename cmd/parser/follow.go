@@ -0,0 +1,78 @@
+package main
+
+import (
+	"io"
+	"os"
+	"time"
+)
+
+// Interval of checking followed file for new data
+const followInterval = 500 * time.Millisecond
+
+// Reader of growing file, like tail -F.
+// Blocks on end of file waiting for new data, reopens file when it was
+// rotated (replaced or truncated).
+type followReader struct {
+	path string
+	file *os.File
+}
+
+// Opening file for following from the beginning
+func newFollowReader(path string) (*followReader, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return &followReader{path: path, file: file}, nil
+}
+
+// Skipping data written so far, only new lines are read
+func (r *followReader) SeekEnd() error {
+	_, err := r.file.Seek(0, io.SeekEnd)
+	return err
+}
+
+func (r *followReader) Read(p []byte) (int, error) {
+	for {
+		n, err := r.file.Read(p)
+		if n > 0 || err != nil && err != io.EOF {
+			return n, err
+		}
+
+		time.Sleep(followInterval)
+
+		if r.rotated() {
+			file, err := os.Open(r.path)
+			if err != nil {
+				// New file is not created yet
+				continue
+			}
+			r.file.Close()
+			r.file = file
+		}
+	}
+}
+
+// Checking is file replaced or truncated
+func (r *followReader) rotated() bool {
+	current, err := os.Stat(r.path)
+	if err != nil {
+		return false
+	}
+
+	opened, err := r.file.Stat()
+	if err != nil {
+		return true
+	}
+
+	if !os.SameFile(current, opened) {
+		return true
+	}
+
+	offset, err := r.file.Seek(0, io.SeekCurrent)
+	return err == nil && current.Size() < offset
+}
+
+func (r *followReader) Close() error {
+	return r.file.Close()
+}
@@ -0,0 +1,404 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"math"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// z-score of 95% prediction band
+const forecastZ = 1.96
+
+// Smoothing parameters tried when fitting models
+var forecastGrid = []float64{0.1, 0.2, 0.3, 0.4, 0.5, 0.6, 0.7, 0.8, 0.9}
+
+// Point of request volume history or forecast
+type ForecastPoint struct {
+	Start time.Time `json:"start"`
+	Value float64   `json:"value"`
+	Low   float64   `json:"low"`
+	High  float64   `json:"high"`
+}
+
+// Forecast of route request volume
+type RouteForecast struct {
+	Route string `json:"route"`
+
+	// holt-winters (trend and season), holt (trend) or mean
+	// when history is too short for them
+	Model string  `json:"model"`
+	Alpha float64 `json:"alpha,omitempty"`
+	Beta  float64 `json:"beta,omitempty"`
+	Gamma float64 `json:"gamma,omitempty"`
+
+	History  []ForecastPoint `json:"history"`
+	Forecast []ForecastPoint `json:"forecast"`
+
+	// Requests over whole forecast period
+	Total ForecastPoint `json:"total"`
+}
+
+// Request counts per route and time bucket, for forecasting
+type Forecaster struct {
+	interval time.Duration
+	horizon  time.Duration
+	season   time.Duration
+	now      time.Time
+	counts   map[string]map[time.Time]int
+}
+
+func NewForecaster(interval, horizon, season time.Duration, now time.Time) *Forecaster {
+	return &Forecaster{
+		interval: interval,
+		horizon:  horizon,
+		season:   season,
+		now:      now,
+		counts:   make(map[string]map[time.Time]int),
+	}
+}
+
+// Checking forecast settings
+func validForecast(interval, horizon, season time.Duration) error {
+	if interval <= 0 {
+		return fmt.Errorf("-forecast-interval must be positive")
+	}
+	if horizon < interval {
+		return fmt.Errorf("-forecast must be at least one -forecast-interval (%v)", interval)
+	}
+	if season < 0 || season%interval != 0 {
+		return fmt.Errorf("-season must be a multiple of -forecast-interval (%v)", interval)
+	}
+	return nil
+}
+
+// Counting record in its route and bucket, records with
+// implausible timestamps are skipped
+func (f *Forecaster) Add(record LogRecord) {
+	if !plausibleTimestamp(record.Date, f.now) {
+		return
+	}
+
+	route := groupKey(record, "url")
+	counts, ok := f.counts[route]
+	if !ok {
+		counts = make(map[time.Time]int)
+		f.counts[route] = counts
+	}
+	counts[record.Date.Truncate(f.interval)]++
+}
+
+// Forecasts of routes by request volume, every route has history
+// of buckets from first to last record of all routes
+func (f *Forecaster) Forecasts() ([]RouteForecast, error) {
+	var first, last time.Time
+	for _, counts := range f.counts {
+		for start := range counts {
+			if first.IsZero() || start.Before(first) {
+				first = start
+			}
+			if start.After(last) {
+				last = start
+			}
+		}
+	}
+	if first.IsZero() {
+		return []RouteForecast{}, nil
+	}
+
+	size := int(last.Sub(first)/f.interval) + 1
+	if size > maxTimeBuckets {
+		return nil, fmt.Errorf("%d buckets of %v, use bigger -forecast-interval", size, f.interval)
+	}
+
+	steps := int(f.horizon / f.interval)
+	period := int(f.season / f.interval)
+
+	forecasts := []RouteForecast{}
+	for route, counts := range f.counts {
+		history := make([]float64, size)
+		for start, count := range counts {
+			history[int(start.Sub(first)/f.interval)] = float64(count)
+		}
+
+		forecast := forecastSeries(history, period, steps)
+		forecast.Route = route
+
+		for i, value := range history {
+			start := first.Add(time.Duration(i) * f.interval)
+			forecast.History = append(forecast.History, ForecastPoint{Start: start, Value: value, Low: value, High: value})
+		}
+		for i := range forecast.Forecast {
+			forecast.Forecast[i].Start = last.Add(time.Duration(i+1) * f.interval)
+		}
+		forecast.Total.Start = last.Add(f.interval)
+
+		forecasts = append(forecasts, forecast)
+	}
+
+	slices.SortFunc(forecasts, func(a, b RouteForecast) int {
+		if c := -compareFloat(a.Total.Value, b.Total.Value); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Route, b.Route)
+	})
+	return forecasts, nil
+}
+
+// Comparing floats for sorting
+func compareFloat(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// Fitted exponential smoothing model
+type smoothingModel struct {
+	alpha, beta, gamma float64
+	period             int
+
+	level, trend float64
+	season       []float64
+
+	// One-step errors of fit
+	sse    float64
+	errors int
+}
+
+// Fitting additive Holt-Winters with seasonal period, or Holt's
+// linear trend when period is 0. History must have at least two
+// periods (two values without season).
+func fitSmoothing(y []float64, period int, alpha, beta, gamma float64) smoothingModel {
+	m := smoothingModel{alpha: alpha, beta: beta, gamma: gamma, period: period}
+
+	start := 1
+	if period > 0 {
+		first, second := mean(y[:period]), mean(y[period:2*period])
+		m.level = first
+		m.trend = (second - first) / float64(period)
+		m.season = make([]float64, period)
+		for i := range period {
+			m.season[i] = y[i] - first
+		}
+		start = period
+	} else {
+		m.level = y[0]
+		m.trend = y[1] - y[0]
+	}
+
+	for t := start; t < len(y); t++ {
+		seasonal := 0.0
+		if period > 0 {
+			seasonal = m.season[t%period]
+		}
+
+		err := y[t] - (m.level + m.trend + seasonal)
+		m.sse += err * err
+		m.errors++
+
+		level := alpha*(y[t]-seasonal) + (1-alpha)*(m.level+m.trend)
+		m.trend = beta*(level-m.level) + (1-beta)*m.trend
+		if period > 0 {
+			m.season[t%period] = gamma*(y[t]-level) + (1-gamma)*seasonal
+		}
+		m.level = level
+	}
+
+	return m
+}
+
+// Forecast h steps after last value of history of length n
+func (m smoothingModel) predict(n, h int) float64 {
+	value := m.level + float64(h)*m.trend
+	if m.period > 0 {
+		value += m.season[(n-1+h)%m.period]
+	}
+	return value
+}
+
+// Standard deviation of h-step forecast error, of additive
+// Holt-Winters state space model (ETS(A,A,A))
+func (m smoothingModel) sigma(h int) float64 {
+	if m.errors == 0 {
+		return 0
+	}
+
+	variance := 1.0
+	for j := 1; j < h; j++ {
+		c := m.alpha * (1 + float64(j)*m.beta)
+		if m.period > 0 && j%m.period == 0 {
+			c += m.gamma * (1 - m.alpha)
+		}
+		variance += c * c
+	}
+	return math.Sqrt(m.sse / float64(m.errors) * variance)
+}
+
+// Forecast of series with smoothing parameters of best one-step fit,
+// seasonal model needs two periods of history
+func forecastSeries(y []float64, period, steps int) RouteForecast {
+	if period < 2 || len(y) < 2*period {
+		period = 0
+	}
+
+	forecast := RouteForecast{Forecast: make([]ForecastPoint, steps)}
+
+	// Too short for trend, mean with band of standard deviation
+	if len(y) < 3 {
+		avg := mean(y)
+		var variance float64
+		for _, v := range y {
+			variance += (v - avg) * (v - avg)
+		}
+		sd := math.Sqrt(variance / float64(len(y)))
+
+		forecast.Model = "mean"
+		for i := range forecast.Forecast {
+			forecast.Forecast[i] = bandPoint(avg, forecastZ*sd)
+		}
+		forecast.Total = bandPoint(avg*float64(steps), forecastZ*sd*math.Sqrt(float64(steps)))
+		return forecast
+	}
+
+	gammas := []float64{0}
+	forecast.Model = "holt"
+	if period > 0 {
+		gammas = forecastGrid
+		forecast.Model = "holt-winters"
+	}
+
+	var best smoothingModel
+	for _, alpha := range forecastGrid {
+		for _, beta := range forecastGrid {
+			for _, gamma := range gammas {
+				m := fitSmoothing(y, period, alpha, beta, gamma)
+				if best.errors == 0 || m.sse < best.sse {
+					best = m
+				}
+			}
+		}
+	}
+	forecast.Alpha, forecast.Beta, forecast.Gamma = best.alpha, best.beta, best.gamma
+
+	var total, totalVariance float64
+	for h := 1; h <= steps; h++ {
+		value, sigma := best.predict(len(y), h), best.sigma(h)
+		forecast.Forecast[h-1] = bandPoint(value, forecastZ*sigma)
+
+		total += max(value, 0)
+		totalVariance += sigma * sigma
+	}
+	forecast.Total = bandPoint(total, forecastZ*math.Sqrt(totalVariance))
+
+	return forecast
+}
+
+// Point with band around value, volumes are not negative
+func bandPoint(value, band float64) ForecastPoint {
+	return ForecastPoint{
+		Value: max(value, 0),
+		Low:   max(value-band, 0),
+		High:  max(value+band, 0),
+	}
+}
+
+// Mean of values
+func mean(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	return sum / float64(len(values))
+}
+
+// Points shown in sparkline of text output
+const sparklinePoints = 30
+
+// Sparkline of values scaled to max
+func sparkline(values []float64, peak float64) string {
+	const bars = "▁▂▃▄▅▆▇█"
+	levels := []rune(bars)
+
+	var b strings.Builder
+	for _, v := range values {
+		i := 0
+		if peak > 0 {
+			i = int(v / peak * float64(len(levels)-1))
+		}
+		b.WriteRune(levels[min(max(i, 0), len(levels)-1)])
+	}
+	return b.String()
+}
+
+// Forecast output, sparkline shows end of history and
+// beginning of forecast
+func printForecasts(forecasts []RouteForecast, interval, horizon time.Duration, locale Locale) {
+	fmt.Printf("Requests per %v forecast for next %v (95%% band)\n\n", interval, horizon)
+
+	w := newTable(os.Stdout)
+	defer w.Flush()
+
+	fmt.Fprintf(w, "ROUTE\tMODEL\tAVG\tFORECAST AVG\tFORECAST TOTAL\tLOW\tHIGH\tHISTORY | FORECAST\n")
+	for _, f := range forecasts {
+		history := make([]float64, len(f.History))
+		for i, p := range f.History {
+			history[i] = p.Value
+		}
+		forecast := make([]float64, len(f.Forecast))
+		for i, p := range f.Forecast {
+			forecast[i] = p.Value
+		}
+
+		history = history[max(len(history)-sparklinePoints, 0):]
+		forecast = forecast[:min(len(forecast), sparklinePoints)]
+		peak := max(slices.Max(history), slices.Max(forecast))
+
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s|%s\n",
+			f.Route,
+			f.Model,
+			locale.Float(mean(history), 1),
+			locale.Float(f.Total.Value/float64(len(f.Forecast)), 1),
+			locale.Int(int(math.Round(f.Total.Value))),
+			locale.Int(int(math.Round(f.Total.Low))),
+			locale.Int(int(math.Round(f.Total.High))),
+			sparkline(history, peak),
+			sparkline(forecast, peak),
+		)
+	}
+}
+
+// CSV forecast output, history and forecast rows per route for charts
+func writeForecastCSV(forecasts []RouteForecast) error {
+	w := csv.NewWriter(os.Stdout)
+	w.Write([]string{"route", "start", "kind", "value", "low", "high"})
+
+	format := func(v float64) string {
+		return strconv.FormatFloat(v, 'f', 2, 64)
+	}
+
+	for _, f := range forecasts {
+		for _, rows := range []struct {
+			kind   string
+			points []ForecastPoint
+		}{{"history", f.History}, {"forecast", f.Forecast}} {
+			for _, p := range rows.points {
+				w.Write([]string{f.Route, p.Start.Format(time.RFC3339), rows.kind, format(p.Value), format(p.Low), format(p.High)})
+			}
+		}
+	}
+
+	w.Flush()
+	return w.Error()
+}
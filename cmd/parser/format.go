@@ -0,0 +1,430 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Parser of log lines into records
+type LineFormat interface {
+	Parse(line string) (LogRecord, error)
+}
+
+// Default gin logger format
+type ginFormat struct{}
+
+func (ginFormat) Parse(line string) (LogRecord, error) {
+	return parseLine(line)
+}
+
+// Built-in -pattern presets besides default "gin"
+var formatPresets = map[string]string{
+	// Example of gin.LoggerWithFormatter from gin documentation
+	"gin-docs": `%ip - [%t] "%m %u %{proto} %s %d "%{user_agent}" %{error}"`,
+
+	// Default gin layout with extra field appended
+	"gin-user-agent": `[GIN] %t | %s | %d | %ip | %m %u | "%{user_agent}"`,
+	"gin-request-id": `[GIN] %t | %s | %d | %ip | %m %u | %{request_id}`,
+}
+
+// Finding line format by preset name or pattern
+func findFormat(pattern string) (LineFormat, error) {
+	switch pattern {
+	case "", "gin":
+		return ginFormat{}, nil
+	case "gin-json":
+		return jsonFormat{}, nil
+	}
+
+	if preset, ok := formatPresets[pattern]; ok {
+		return compilePattern(preset)
+	}
+
+	if !strings.Contains(pattern, "%") {
+		return nil, fmt.Errorf("unknown preset %q (supported: %s, or pattern with %%t %%s %%d %%ip %%m %%u %%{name})",
+			pattern, strings.Join(presetNames(), ", "))
+	}
+
+	return compilePattern(pattern)
+}
+
+// Names of -pattern presets
+func presetNames() []string {
+	return append([]string{"gin", "gin-json"}, slices.Sorted(maps.Keys(formatPresets))...)
+}
+
+// Supported -input formats
+var inputFormats = []string{"auto", "gin", "json", "nginx", "apache", "records", "syslog", "journald"}
+
+// Finding line format of -input, text is format of gin text lines
+func findInputFormat(input string, text LineFormat) (LineFormat, error) {
+	switch input {
+	case "auto":
+		return autoFormat{text: text}, nil
+	case "gin":
+		return text, nil
+	case "json":
+		return jsonFormat{}, nil
+	case "nginx", "apache":
+		return combinedFormat{}, nil
+	case "records":
+		return streamFormat{}, nil
+	case "syslog":
+		return syslogFormat{inner: autoFormat{text: text}}, nil
+	case "journald":
+		return journaldFormat{inner: autoFormat{text: text}}, nil
+	}
+	return nil, fmt.Errorf("unknown input %q (supported: %s)", input, strings.Join(inputFormats, ", "))
+}
+
+// Format detected per line, JSON objects and text lines may be
+// mixed as gin prints debug messages as text. Record stream of
+// other ginlog process and lines wrapped by container runtimes
+// (docker logs, kubectl logs) are detected too.
+type autoFormat struct {
+	text LineFormat
+}
+
+func (f autoFormat) Parse(line string) (LogRecord, error) {
+	if isStreamLine(line) {
+		return streamFormat{}.Parse(line)
+	}
+	if _, ok := containerMessage(line); ok {
+		return containerFormat{inner: f}.Parse(line)
+	}
+	if strings.HasPrefix(strings.TrimLeft(line, " \t"), "{") {
+		return jsonFormat{}.Parse(line)
+	}
+	return f.text.Parse(line)
+}
+
+// Timestamp layouts accepted by %t
+var patternTimeLayouts = []string{
+	"2006/01/02 - 15:04:05",
+	time.RFC3339Nano,
+	time.RFC1123,
+	time.RFC1123Z,
+	"02/Jan/2006:15:04:05 -0700",
+	time.DateTime,
+	"2006/01/02 15:04:05",
+}
+
+// Line format defined by pattern.
+//
+// Tokens: %t timestamp, %s status code, %d duration (1.2ms), %ip client IP,
+// %m method, %u URL, %{name} extra field, %* anything, %% percent sign.
+// Runs of spaces match any non-empty whitespace, as gin pads columns.
+type patternFormat struct {
+	re     *regexp.Regexp
+	tokens []string
+}
+
+// Compiling pattern into regular expression
+func compilePattern(pattern string) (*patternFormat, error) {
+	var expr strings.Builder
+	var tokens []string
+
+	expr.WriteString(`^\s*`)
+
+	for i := 0; i < len(pattern); {
+		c := pattern[i]
+
+		if unicode.IsSpace(rune(c)) {
+			for i < len(pattern) && unicode.IsSpace(rune(pattern[i])) {
+				i++
+			}
+			expr.WriteString(`\s+`)
+			continue
+		}
+
+		if c != '%' {
+			expr.WriteString(regexp.QuoteMeta(string(c)))
+			i++
+			continue
+		}
+
+		rest := pattern[i+1:]
+		var token, group string
+
+		switch {
+		case strings.HasPrefix(rest, "%"):
+			expr.WriteString("%")
+			i += 2
+			continue
+		case strings.HasPrefix(rest, "*"):
+			expr.WriteString(`.*?`)
+			i += 2
+			continue
+		case strings.HasPrefix(rest, "{"):
+			end := strings.IndexByte(rest, '}')
+			if end < 2 {
+				return nil, fmt.Errorf("unterminated field at %d", i)
+			}
+			token, group = rest[:end+1], `(.*?)`
+		case strings.HasPrefix(rest, "ip"):
+			token, group = "ip", `(\S*)`
+		case strings.HasPrefix(rest, "t"):
+			token, group = "t", `(.+?)`
+		case strings.HasPrefix(rest, "s"):
+			token, group = "s", `(\d{3})`
+		case strings.HasPrefix(rest, "d"):
+			token, group = "d", `(\S+)`
+		case strings.HasPrefix(rest, "m"):
+			token, group = "m", `([A-Z]+)`
+		case strings.HasPrefix(rest, "u"):
+			token, group = "u", `(\S+)`
+		default:
+			return nil, fmt.Errorf("unknown token at %d", i)
+		}
+
+		tokens = append(tokens, token)
+		expr.WriteString(group)
+		i += 1 + len(token)
+	}
+
+	expr.WriteString(`\s*$`)
+
+	re, err := regexp.Compile(expr.String())
+	if err != nil {
+		return nil, err
+	}
+	return &patternFormat{re: re, tokens: tokens}, nil
+}
+
+func (f *patternFormat) Parse(line string) (LogRecord, error) {
+	m := f.re.FindStringSubmatch(line)
+	if m == nil {
+		return LogRecord{}, fmt.Errorf("invalid format")
+	}
+
+	var record LogRecord
+	for i, token := range f.tokens {
+		value := m[i+1]
+
+		switch token {
+		case "t":
+			date, err := parsePatternTime(value)
+			if err != nil {
+				return LogRecord{}, err
+			}
+			record.Date = date
+		case "s":
+			code, err := strconv.Atoi(value)
+			if err != nil {
+				return LogRecord{}, err
+			}
+			record.Code = code
+		case "d":
+			duration, err := parseDuration(value)
+			if err != nil {
+				return LogRecord{}, err
+			}
+			record.Duration = duration
+		case "ip":
+			record.IP = value
+		case "m":
+			record.Method = value
+		case "u":
+			if unquoted, err := strconv.Unquote(value); err == nil {
+				value = unquoted
+			}
+			record.URL = value
+		default:
+			if record.Fields == nil {
+				record.Fields = make(map[string]string)
+			}
+			record.Fields[token[1:len(token)-1]] = value
+		}
+	}
+
+	return record, nil
+}
+
+// Parsing %t value, zoned times keep their wall clock like gin timestamps
+// unless -tz or -display-tz is set
+func parsePatternTime(value string) (time.Time, error) {
+	for _, layout := range patternTimeLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			if strings.Contains(layout, "07") || strings.Contains(layout, "MST") {
+				return zonedTime(t), nil
+			}
+			return localTime(t), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid timestamp %q", value)
+}
+
+// Normalized keys of record fields in JSON lines, first present key is used.
+// Keys are compared lowercased without "_", "-" and "@", so snake_case,
+// camelCase and gin.LogFormatterParams names (StatusCode) all match.
+var jsonKeys = map[string][]string{
+	"time":    {"time", "timestamp", "ts", "date"},
+	"status":  {"status", "statuscode", "code"},
+	"latency": {"latency", "duration", "latencyns", "latencyms", "durationms"},
+	"ip":      {"clientip", "ip", "remoteaddr"},
+	"method":  {"method"},
+	"url":     {"path", "uri", "url"},
+	"route":   {"route", "fullpath"},
+}
+
+// Normalized keys of extra fields stored under common name
+var jsonExtraKeys = map[string][]string{
+	"error":     {"error", "errormessage", "err"},
+	"body_size": {"bodysize", "size", "bytes", "responsesize"},
+
+	// Headers of content negotiation (-group-by content-type)
+	"content_type": {"contenttype", "responsecontenttype"},
+	"accept":       {"accept", "acceptheader"},
+}
+
+// Normalizing JSON key for lookup
+func normalizeJSONKey(key string) string {
+	return strings.ToLower(strings.NewReplacer("_", "", "-", "", "@", "").Replace(key))
+}
+
+// JSON object per line, as written by LoggerWithFormatter marshaling
+// gin.LogFormatterParams fields, or by -format ndjson. Numeric latency
+// is in nanoseconds (time.Duration), or in milliseconds for latency_ms
+// and duration_ms keys. Time, status, latency, method and path are
+// required, other JSON lines (e.g. application logs) are skipped. Route
+// (gin FullPath, as ginlogmw logs it) is kept as route template.
+// Error message and body size are kept as "error" and "body_size"
+// fields, other string, number and bool values under their own keys.
+type jsonFormat struct{}
+
+func (jsonFormat) Parse(line string) (LogRecord, error) {
+	line = strings.TrimSpace(line)
+	if !strings.HasPrefix(line, "{") {
+		return LogRecord{}, fmt.Errorf("invalid format")
+	}
+
+	var values map[string]any
+	decoder := json.NewDecoder(strings.NewReader(line))
+	decoder.UseNumber()
+	if err := decoder.Decode(&values); err != nil {
+		return LogRecord{}, err
+	}
+
+	keys := make(map[string]string, len(values))
+	for key := range values {
+		keys[normalizeJSONKey(key)] = key
+	}
+
+	var missing []string
+	for _, field := range []string{"time", "status", "latency", "method", "url"} {
+		if !slices.ContainsFunc(jsonKeys[field], func(name string) bool { _, ok := keys[name]; return ok }) {
+			missing = append(missing, field)
+		}
+	}
+	if len(missing) > 0 {
+		return LogRecord{}, fmt.Errorf("JSON line misses %s of request", strings.Join(missing, ", "))
+	}
+
+	var record LogRecord
+	used := make(map[string]bool)
+
+	lookup := func(names []string) (string, any, bool) {
+		for _, name := range names {
+			if key, ok := keys[name]; ok {
+				used[key] = true
+				return name, values[key], true
+			}
+		}
+		return "", nil, false
+	}
+
+	if _, value, ok := lookup(jsonKeys["time"]); ok {
+		date, err := jsonTime(value)
+		if err != nil {
+			return LogRecord{}, err
+		}
+		record.Date = date
+	}
+
+	if _, value, ok := lookup(jsonKeys["status"]); ok {
+		code, err := strconv.Atoi(fmt.Sprint(value))
+		if err != nil {
+			return LogRecord{}, fmt.Errorf("invalid status %v", value)
+		}
+		record.Code = code
+	}
+
+	if name, value, ok := lookup(jsonKeys["latency"]); ok {
+		duration, err := jsonDuration(name, value)
+		if err != nil {
+			return LogRecord{}, err
+		}
+		record.Duration = duration
+	}
+
+	for field, target := range map[string]*string{"ip": &record.IP, "method": &record.Method, "url": &record.URL, "route": &record.Route} {
+		if _, value, ok := lookup(jsonKeys[field]); ok {
+			*target = fmt.Sprint(value)
+		}
+	}
+
+	setField := func(name string, value any) {
+		switch value.(type) {
+		case string, json.Number, bool:
+			if record.Fields == nil {
+				record.Fields = make(map[string]string)
+			}
+			record.Fields[name] = strings.TrimSpace(fmt.Sprint(value))
+		}
+	}
+
+	for field, names := range jsonExtraKeys {
+		if _, value, ok := lookup(names); ok {
+			setField(field, value)
+		}
+	}
+
+	for key, value := range values {
+		if !used[key] {
+			setField(key, value)
+		}
+	}
+
+	return record, nil
+}
+
+// Timestamp of JSON line, string or unix seconds
+func jsonTime(value any) (time.Time, error) {
+	switch v := value.(type) {
+	case string:
+		return parsePatternTime(v)
+	case json.Number:
+		seconds, err := v.Float64()
+		if err != nil {
+			return time.Time{}, err
+		}
+		return zonedTime(time.Unix(0, int64(seconds*float64(time.Second))).Local()), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid timestamp %v", value)
+}
+
+// Latency of JSON line, duration string or number.
+// Key is normalized key of latency.
+func jsonDuration(key string, value any) (time.Duration, error) {
+	switch v := value.(type) {
+	case string:
+		return parseDuration(v)
+	case json.Number:
+		n, err := v.Float64()
+		if err != nil {
+			return 0, err
+		}
+		if key == "latencyms" || key == "durationms" {
+			return time.Duration(n * float64(time.Millisecond)), nil
+		}
+		return time.Duration(n), nil
+	}
+	return 0, fmt.Errorf("invalid latency %v", value)
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Operation type and name at start of GraphQL document
+var graphQLOperation = regexp.MustCompile(`^\s*(query|mutation|subscription)\b\s*([_A-Za-z][_0-9A-Za-z]*)?`)
+
+// GraphQL endpoints (-graphql), their requests get route of
+// endpoint with operation name, so metrics are per operation
+// instead of one opaque route
+type GraphQL struct {
+	paths []string
+
+	// Field or query parameter with operation name
+	field string
+}
+
+func NewGraphQL(paths []string, field string) (*GraphQL, error) {
+	for _, path := range paths {
+		if !strings.HasPrefix(path, "/") {
+			return nil, fmt.Errorf("path %q must start with /", path)
+		}
+	}
+	if field == "" {
+		return nil, fmt.Errorf("operation field can't be empty")
+	}
+	return &GraphQL{paths: paths, field: field}, nil
+}
+
+// Setting route of GraphQL request to endpoint route with operation
+// (/graphql GetUser), other records are kept as they are. Routes
+// of record stream may have operation already.
+func (g *GraphQL) Route(record *LogRecord) {
+	if strings.Contains(record.Route, " ") {
+		return
+	}
+
+	path := record.Path()
+	for _, endpoint := range g.paths {
+		if path == endpoint {
+			route := record.Route
+			if route == "" {
+				route = path
+			}
+			record.Route = route + " " + g.Operation(*record)
+			return
+		}
+	}
+}
+
+// Operation name of request: field of extended formats (e.g. JSON
+// logs), query parameter of same name, or name in query document of
+// GET request. Unnamed operations are "(anonymous)", requests with
+// nothing logged about operation are "(unknown)".
+func (g *GraphQL) Operation(record LogRecord) string {
+	if name := record.Fields[g.field]; name != "" {
+		return name
+	}
+
+	params := queryParams(record.URL)
+	if name := params.Get(g.field); name != "" {
+		return name
+	}
+
+	query := params.Get("query")
+	if query == "" {
+		return "(unknown)"
+	}
+	if m := graphQLOperation.FindStringSubmatch(query); m != nil && m[2] != "" {
+		return m[2]
+	}
+	return "(anonymous)"
+}
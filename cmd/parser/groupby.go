@@ -0,0 +1,242 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Supported -group-by keys
+var groupByKeys = []string{"url", "method", "code", "ip", "ip-family", "day", "content-type"}
+
+// Metrics of records group
+type GroupMetrics struct {
+	Key string `json:"key"`
+	Metrics
+}
+
+// Checking is group-by key supported.
+// Besides fixed keys, "expr:<expression>" groups by value of expression
+// and "param:<name>" by value of query parameter.
+func validGroupBy(by string) error {
+	if name, ok := strings.CutPrefix(by, "param:"); ok {
+		if name == "" {
+			return fmt.Errorf("param: needs parameter name (e.g. param:page_size)")
+		}
+		return nil
+	}
+
+	if src, ok := strings.CutPrefix(by, "expr:"); ok {
+		_, err := compileExpr(src)
+		return err
+	}
+
+	if !slices.Contains(groupByKeys, by) {
+		return fmt.Errorf("unknown key %q (supported: %s, expr:<expression>, param:<name>)", by, strings.Join(groupByKeys, ", "))
+	}
+	return nil
+}
+
+// Group key of record
+func groupKey(record LogRecord, by string) string {
+	switch by {
+	case "url":
+		if record.Route != "" {
+			return record.Route
+		}
+		return record.Path()
+	case "method":
+		return record.Method
+	case "code":
+		return strconv.Itoa(record.Code)
+	case "ip":
+		return record.IP
+	case "ip-family":
+		return ipFamily(record.IP)
+	case "day":
+		return record.Date.Format("2006/01/02")
+	case "content-type":
+		return contentTypeKey(record)
+	}
+
+	if name, ok := strings.CutPrefix(by, "param:"); ok {
+		return paramKey(record, name)
+	}
+
+	if src, ok := strings.CutPrefix(by, "expr:"); ok {
+		expr, err := compileExpr(src)
+		if err != nil {
+			return "(error)"
+		}
+
+		value, err := expr.Eval(recordEnv(record))
+		if err != nil {
+			return "(error)"
+		}
+		return formatValue(value)
+	}
+
+	return ""
+}
+
+// Group metrics as expression environment of -having: count, errors,
+// error_rate (ratio), avg, min, max and computed percentiles (p95)
+// are numbers and durations, key is group key
+type groupEnv GroupMetrics
+
+func (g groupEnv) field(name string) (any, error) {
+	switch name {
+	case "key":
+		return g.Key, nil
+	case "count":
+		return int64(g.Count), nil
+	case "errors":
+		return int64(g.Errors), nil
+	case "error_rate":
+		return g.ErrorRate, nil
+	case "rps":
+		return g.RPS, nil
+	case "avg":
+		return g.AverageTime(), nil
+	case "min":
+		return g.MinTime, nil
+	case "max":
+		return g.MaxTime, nil
+	}
+
+	if p, ok := strings.CutPrefix(name, "p"); ok {
+		if value, err := strconv.ParseFloat(p, 64); err == nil {
+			for _, percentile := range g.Percentiles {
+				if percentile.P == value {
+					return percentile.Value, nil
+				}
+			}
+			return nil, fmt.Errorf("percentile %q is not calculated (see -percentiles)", name)
+		}
+	}
+
+	return nil, fmt.Errorf("unknown metric %q", name)
+}
+
+func (groupEnv) extraField(string) string {
+	return ""
+}
+
+// Compiling -having expression over metrics of groups
+func compileHaving(src string, percentiles []float64) (Expr, error) {
+	env := groupEnv{}
+	for _, p := range percentiles {
+		env.Percentiles = append(env.Percentiles, Percentile{P: p})
+	}
+
+	expr, err := parseExpr(src, env)
+	if err != nil {
+		return nil, err
+	}
+	return expr, checkBoolean(expr, env)
+}
+
+// Incremental calculation of metrics per group
+type GroupAccumulator struct {
+	by          string
+	now         time.Time
+	percentiles []float64
+	groups      map[string]*MetricsAccumulator
+}
+
+func NewGroupAccumulator(by string, now time.Time, percentiles []float64) *GroupAccumulator {
+	return &GroupAccumulator{
+		by:          by,
+		now:         now,
+		percentiles: percentiles,
+		groups:      make(map[string]*MetricsAccumulator),
+	}
+}
+
+// Adding record to its group
+func (a *GroupAccumulator) Add(record LogRecord) {
+	key := groupKey(record, a.by)
+
+	acc, ok := a.groups[key]
+	if !ok {
+		acc = NewMetricsAccumulator(a.now, a.percentiles)
+		a.groups[key] = acc
+	}
+	acc.Add(record)
+}
+
+// Metrics per group.
+// Span and rps of groups are over time span of all records, so
+// rps of groups add up to total and sparse groups have low rps.
+// Groups are sorted by count, days are sorted chronologically.
+func (a *GroupAccumulator) Groups() []GroupMetrics {
+	groups := make([]GroupMetrics, 0, len(a.groups))
+	var start, end time.Time
+	for key, acc := range a.groups {
+		m := acc.Metrics()
+		if !m.Start.IsZero() && (start.IsZero() || m.Start.Before(start)) {
+			start = m.Start
+		}
+		if m.End.After(end) {
+			end = m.End
+		}
+		groups = append(groups, GroupMetrics{Key: key, Metrics: m})
+	}
+
+	if !start.IsZero() {
+		span := end.Sub(start) + time.Second
+		for i := range groups {
+			groups[i].Span = span
+			groups[i].RPS = float64(groups[i].Count-groups[i].BadTimestamps) / span.Seconds()
+		}
+	}
+
+	slices.SortFunc(groups, func(x, y GroupMetrics) int {
+		if a.by != "day" && x.Count != y.Count {
+			return y.Count - x.Count
+		}
+		return strings.Compare(x.Key, y.Key)
+	})
+
+	return groups
+}
+
+// Group-by mode output
+func printGroups(groups []GroupMetrics, by string, locale Locale) {
+	printSampleNote(os.Stdout, locale)
+
+	w := newTable(os.Stdout)
+	defer w.Flush()
+
+	header := strings.ToUpper(by)
+	if src, ok := strings.CutPrefix(by, "expr:"); ok {
+		header = src
+	}
+	if name, ok := strings.CutPrefix(by, "param:"); ok {
+		header = name
+	}
+
+	fmt.Fprintf(w, "%s\tCOUNT\tRPS\tAVG\tMIN\tMAX\tERRORS\n", header)
+
+	for _, group := range groups {
+		key := group.Key
+		if by == "day" {
+			if day, err := time.Parse("2006/01/02", key); err == nil {
+				key = locale.FormatDate(day)
+			}
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			key,
+			locale.Int(group.Count),
+			locale.Float(group.RPS, 2),
+			locale.Duration(group.AverageTime()),
+			locale.Duration(group.MinTime),
+			locale.Duration(group.MaxTime),
+			locale.Percent(group.ErrorRate),
+		)
+	}
+}
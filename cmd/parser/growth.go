@@ -0,0 +1,209 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Version of -growth-state file
+const growthStateVersion = 1
+
+// Periods of -growth
+var growthPeriods = []string{"day", "week"}
+
+// Unique clients of one period, with clients of periods before it
+// new ones and clients of previous period churned ones are estimated
+type GrowthPeriod struct {
+	Start     string  `json:"start"`
+	Unique    int     `json:"unique"`
+	New       int     `json:"new"`
+	Returning int     `json:"returning"`
+	Churned   int     `json:"churned"`
+	Growth    float64 `json:"growth"`
+}
+
+// Client growth report
+type GrowthReport struct {
+	Period  string         `json:"period"`
+	Periods []GrowthPeriod `json:"periods"`
+}
+
+// Clients of period as stored in -growth-state
+type growthStatePeriod struct {
+	Start   string `json:"start"`
+	Clients []byte `json:"clients"`
+}
+
+// File of -growth-state, sketches of client IPs per period
+type growthState struct {
+	Version   int                 `json:"version"`
+	WrittenBy string              `json:"written_by,omitempty"`
+	Period    string              `json:"period"`
+	Periods   []growthStatePeriod `json:"periods"`
+}
+
+// Unique client IPs per day or week (-growth), counted with
+// HyperLogLog sketches, so memory doesn't grow with clients. Sketches
+// of earlier runs are read from state file and written back with
+// periods of input, so new and returning clients are told apart over
+// logs of many runs; periods read again are merged, not doubled.
+type Growth struct {
+	period  string
+	now     time.Time
+	periods map[string]*HyperLogLog
+}
+
+func NewGrowth(period string, now time.Time) *Growth {
+	return &Growth{period: period, now: now, periods: make(map[string]*HyperLogLog)}
+}
+
+// Start of period of time, weeks start on Monday
+func (g *Growth) start(t time.Time) string {
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	if g.period == "week" {
+		day = day.AddDate(0, 0, -(int(day.Weekday())+6)%7)
+	}
+	return day.Format(time.DateOnly)
+}
+
+// Adding client of record, records with implausible timestamps are
+// left out
+func (g *Growth) Add(record LogRecord) {
+	if !plausibleTimestamp(record.Date, g.now) {
+		return
+	}
+	key := g.start(record.Date)
+	clients, ok := g.periods[key]
+	if !ok {
+		clients = NewHyperLogLog()
+		g.periods[key] = clients
+	}
+	clients.Add(record.IP)
+}
+
+// Merging periods of state file, missing file is first run
+func (g *Growth) Load(path string) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var state growthState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	if state.Version != growthStateVersion {
+		return incompatibleState(path, "growth state", state.Version, growthStateVersion, state.WrittenBy, "move it away to count clients from this run on")
+	}
+	if state.Period != g.period {
+		return fmt.Errorf("%s: has %s periods, not %s", path, state.Period, g.period)
+	}
+
+	for _, p := range state.Periods {
+		stored, err := hyperLogLogOf(p.Clients)
+		if err != nil {
+			return fmt.Errorf("%s: %s: %w", path, p.Start, err)
+		}
+		if clients, ok := g.periods[p.Start]; ok {
+			stored.Merge(clients)
+		}
+		g.periods[p.Start] = stored
+	}
+	return nil
+}
+
+// Writing all periods to state file, replaced only when written
+// completely
+func (g *Growth) Save(path string, dryRun *DryRun) error {
+	state := growthState{Version: growthStateVersion, WrittenBy: currentBuild().String(), Period: g.period, Periods: []growthStatePeriod{}}
+	for _, start := range slices.Sorted(maps.Keys(g.periods)) {
+		state.Periods = append(state.Periods, growthStatePeriod{Start: start, Clients: g.periods[start].Registers()})
+	}
+
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	if dryRun != nil {
+		dryRun.File(path, "periods", false).Add(len(state.Periods), int64(len(data)+1))
+		return nil
+	}
+
+	out, err := createAtomic(path, false)
+	if err != nil {
+		return err
+	}
+	if _, err := out.File().Write(append(data, '\n')); err != nil {
+		out.Abort()
+		return err
+	}
+	return out.Commit()
+}
+
+// Periods in time order. Counts of new, returning and churned
+// clients are differences of sketch estimates, clamped to possible
+// values.
+func (g *Growth) Report() GrowthReport {
+	report := GrowthReport{Period: g.period, Periods: []GrowthPeriod{}}
+
+	seen := NewHyperLogLog()
+	var previous *HyperLogLog
+	for _, start := range slices.Sorted(maps.Keys(g.periods)) {
+		clients := g.periods[start]
+		p := GrowthPeriod{Start: start, Unique: clients.Count()}
+
+		before := seen.Count()
+		seen.Merge(clients)
+		p.New = min(max(seen.Count()-before, 0), p.Unique)
+		p.Returning = p.Unique - p.New
+
+		if previous != nil {
+			union := previous.Clone()
+			union.Merge(clients)
+			p.Churned = max(union.Count()-p.Unique, 0)
+
+			last := report.Periods[len(report.Periods)-1].Unique
+			p.Growth = ratio(float64(p.Unique-last), float64(last))
+		}
+
+		report.Periods = append(report.Periods, p)
+		previous = clients
+	}
+	return report
+}
+
+// Growth output, first period has no previous one to compare with
+func printGrowth(report GrowthReport, locale Locale) {
+	w := newTable(os.Stdout)
+	fmt.Fprintf(w, "%s\tUNIQUE\tNEW\tRETURNING\tCHURNED\tGROWTH\n", strings.ToUpper(report.Period))
+	for i, p := range report.Periods {
+		churned, growth := "-", "-"
+		if i > 0 {
+			churned = locale.Int(p.Churned)
+			growth = locale.Percent(p.Growth)
+			if p.Growth > 0 {
+				growth = "+" + growth
+			}
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n",
+			p.Start,
+			locale.Int(p.Unique),
+			locale.Int(p.New),
+			locale.Int(p.Returning),
+			churned,
+			growth,
+		)
+	}
+	w.Flush()
+
+	fmt.Printf("\nUnique clients are estimated (HyperLogLog, about 1%% error), new clients were not seen in earlier periods\n")
+}
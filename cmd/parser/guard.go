@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Input reader ending input early when -max-lines, -max-bytes or
+// -max-runtime is reached, so shared machines are not kept busy by
+// scans of whole archives. Input ends after the line reaching limit,
+// so there are no half lines, and everything read so far is reported
+// as usual with truncation issue.
+type guardReader struct {
+	r        io.Reader
+	issues   *Issues
+	maxLines int
+	maxBytes int64
+	deadline time.Time
+	runtime  time.Duration
+
+	lines   int
+	bytes   int64
+	lineEnd bool
+
+	// Limit which was reached, input ends at next line end
+	reason string
+	done   bool
+}
+
+// Wrapper of inputs with limits. Line and byte limits are per input
+// (per source when sources are compared), runtime is of whole run.
+// Without limits inputs are returned as they are.
+func newInputLimit(maxLines int, maxBytes int64, maxRuntime time.Duration, issues *Issues) func(io.Reader) io.Reader {
+	var deadline time.Time
+	if maxRuntime > 0 {
+		deadline = time.Now().Add(maxRuntime)
+	}
+
+	return func(r io.Reader) io.Reader {
+		if maxLines <= 0 && maxBytes <= 0 && maxRuntime <= 0 {
+			return r
+		}
+		return &guardReader{r: r, issues: issues, maxLines: maxLines, maxBytes: maxBytes, deadline: deadline, runtime: maxRuntime, lineEnd: true}
+	}
+}
+
+// Runtime is checked before each read, so input waiting for data
+// (stdin or -follow) ends when next data comes
+func (g *guardReader) Read(p []byte) (int, error) {
+	if g.done {
+		return 0, io.EOF
+	}
+	if g.reason == "" && !g.deadline.IsZero() && time.Now().After(g.deadline) {
+		g.reason = fmt.Sprintf("-max-runtime %v reached", g.runtime)
+	}
+	if g.reason != "" && g.lineEnd {
+		// Input is truncated only when there is more of it, blank
+		// lines ending concatenated inputs don't count
+		for {
+			n, err := g.r.Read(p)
+			if len(bytes.TrimSpace(p[:n])) > 0 {
+				return 0, g.stop()
+			}
+			if err != nil {
+				g.done = true
+				return 0, io.EOF
+			}
+		}
+	}
+
+	n, err := g.r.Read(p)
+	data := p[:n]
+	for offset := 0; offset < n; {
+		i := bytes.IndexByte(data[offset:], '\n')
+		if i < 0 {
+			g.bytes += int64(n - offset)
+			g.check()
+			break
+		}
+
+		end := offset + i + 1
+		g.bytes += int64(end - offset)
+		g.lines++
+		g.check()
+		if g.reason != "" {
+			g.lineEnd = true
+			if len(bytes.TrimSpace(data[end:])) > 0 {
+				return end, g.stop()
+			}
+			return end, nil
+		}
+		offset = end
+	}
+
+	if n > 0 {
+		g.lineEnd = data[n-1] == '\n'
+	}
+	return n, err
+}
+
+// Checking line and byte limits
+func (g *guardReader) check() {
+	switch {
+	case g.reason != "":
+	case g.maxLines > 0 && g.lines >= g.maxLines:
+		g.reason = fmt.Sprintf("-max-lines %d reached", g.maxLines)
+	case g.maxBytes > 0 && g.bytes >= g.maxBytes:
+		g.reason = fmt.Sprintf("-max-bytes %s reached", formatBytes(g.maxBytes))
+	}
+}
+
+// Ending input and recording truncation
+func (g *guardReader) stop() error {
+	g.done = true
+	g.issues.Add(issueTruncated, fmt.Sprintf("%s after %d lines (%s), results are partial", g.reason, g.lines, formatBytes(g.bytes)))
+	return io.EOF
+}
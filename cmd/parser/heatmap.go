@@ -0,0 +1,243 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Latency rows of heatmap without -buckets, 1-2-5 steps
+var heatmapBuckets = []time.Duration{
+	time.Millisecond,
+	2 * time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	20 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	200 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	2 * time.Second,
+	5 * time.Second,
+}
+
+// Most columns of heatmap, more intervals are merged
+const (
+	heatmapColumns    = 100
+	heatmapSVGColumns = 400
+)
+
+// Shades of terminal cells by share of column requests
+var heatmapShades = []struct {
+	share float64
+	char  string
+}{{0.4, "█"}, {0.15, "▓"}, {0.05, "▒"}, {0, "░"}}
+
+// Size of SVG cells and margin of labels
+const (
+	heatmapCellWidth  = 4
+	heatmapCellHeight = 18
+	heatmapMargin     = 70
+)
+
+// Interval of heatmap with requests per latency bucket, last bucket
+// counts durations above all bounds
+type HeatmapColumn struct {
+	Start    time.Time `json:"start"`
+	Requests int       `json:"requests"`
+	Counts   []int     `json:"counts"`
+	Events   []string  `json:"events,omitempty"`
+}
+
+// Latency heatmap report
+type HeatmapReport struct {
+	Interval time.Duration   `json:"interval"`
+	Bounds   []time.Duration `json:"bounds"`
+	Columns  []HeatmapColumn `json:"columns"`
+}
+
+// Requests per interval and latency bucket (-heatmap), latency
+// distribution shifting during deploy shows up as cells moving up
+// or down
+type Heatmap struct {
+	interval    time.Duration
+	bounds      []time.Duration
+	now         time.Time
+	annotations []Annotation
+	columns     map[time.Time][]int
+}
+
+func NewHeatmap(interval time.Duration, bounds []time.Duration, now time.Time, annotations []Annotation) *Heatmap {
+	return &Heatmap{interval: interval, bounds: bounds, now: now, annotations: annotations, columns: make(map[time.Time][]int)}
+}
+
+// Adding record to its cell, records with implausible timestamps are
+// left out
+func (h *Heatmap) Add(record LogRecord) {
+	if !plausibleTimestamp(record.Date, h.now) {
+		return
+	}
+
+	start := record.Date.Truncate(h.interval)
+	counts, ok := h.columns[start]
+	if !ok {
+		counts = make([]int, len(h.bounds)+1)
+		h.columns[start] = counts
+	}
+	i, _ := slices.BinarySearch(h.bounds, record.Duration)
+	counts[i]++
+}
+
+// Columns from first to last record, including empty ones between,
+// merged until there are at most max of them
+func (h *Heatmap) Report(max int) (HeatmapReport, error) {
+	report := HeatmapReport{Interval: h.interval, Bounds: h.bounds, Columns: []HeatmapColumn{}}
+	if len(h.columns) == 0 {
+		return report, nil
+	}
+
+	starts := slices.SortedFunc(maps.Keys(h.columns), time.Time.Compare)
+	first, last := starts[0], starts[len(starts)-1]
+
+	size := int(last.Sub(first)/h.interval) + 1
+	if size > maxTimeBuckets {
+		return report, fmt.Errorf("%d intervals of %v, use bigger interval", size, h.interval)
+	}
+
+	factor := (size + max - 1) / max
+	report.Interval = h.interval * time.Duration(factor)
+	for i := 0; i < size; i += factor {
+		column := HeatmapColumn{Start: first.Add(time.Duration(i) * h.interval), Counts: make([]int, len(h.bounds)+1)}
+		for j := i; j < min(i+factor, size); j++ {
+			for k, n := range h.columns[first.Add(time.Duration(j)*h.interval)] {
+				column.Counts[k] += n
+				column.Requests += n
+			}
+		}
+		column.Events = annotationsBetween(h.annotations, column.Start, column.Start.Add(report.Interval))
+		report.Columns = append(report.Columns, column)
+	}
+	return report, nil
+}
+
+// Label of latency row
+func heatmapRow(bounds []time.Duration, i int, locale Locale) string {
+	if i == len(bounds) {
+		return "> " + locale.Duration(bounds[i-1])
+	}
+	return "<= " + locale.Duration(bounds[i])
+}
+
+// Share of column requests in cell
+func heatmapShare(column HeatmapColumn, row int) float64 {
+	return ratio(float64(column.Counts[row]), float64(column.Requests))
+}
+
+// Terminal heatmap, slowest row on top, each cell shaded by share of
+// its interval's requests, so shifts show with any traffic volume
+func printHeatmap(report HeatmapReport, locale Locale) {
+	if len(report.Columns) == 0 {
+		fmt.Println("No requests")
+		return
+	}
+
+	for row := len(report.Bounds); row >= 0; row-- {
+		var cells strings.Builder
+		for _, column := range report.Columns {
+			cell := " "
+			if column.Counts[row] > 0 {
+				share := heatmapShare(column, row)
+				for _, shade := range heatmapShades {
+					if share >= shade.share {
+						cell = shade.char
+						break
+					}
+				}
+			}
+			cells.WriteString(cell)
+		}
+		fmt.Printf("%12s |%s|\n", heatmapRow(report.Bounds, row, locale), cells.String())
+	}
+
+	// Annotations are marked under their column
+	marks := []rune(strings.Repeat(" ", len(report.Columns)))
+	var events []string
+	for i, column := range report.Columns {
+		if len(column.Events) > 0 {
+			marks[i] = '^'
+			events = append(events, fmt.Sprintf("%s %s", locale.FormatDateTime(column.Start), strings.Join(column.Events, ", ")))
+		}
+	}
+	if len(events) > 0 {
+		fmt.Printf("%12s  %s\n", "", string(marks))
+	}
+
+	last := report.Columns[len(report.Columns)-1].Start
+	fmt.Printf("\n%s to %s, %s per column, shade is share of column requests (░ < 5%%, ▒ < 15%%, ▓ < 40%%, █)\n",
+		locale.FormatDateTime(report.Columns[0].Start),
+		locale.FormatDateTime(last.Add(report.Interval)),
+		report.Interval,
+	)
+	for _, event := range events {
+		fmt.Printf("^ %s\n", event)
+	}
+}
+
+// SVG heatmap, standalone file with cell details as tooltips
+func writeHeatmapSVG(w io.Writer, report HeatmapReport, locale Locale) error {
+	rows := len(report.Bounds) + 1
+	width := heatmapMargin + len(report.Columns)*heatmapCellWidth + 10
+	height := rows*heatmapCellHeight + 50
+
+	if len(report.Columns) == 0 {
+		_, err := fmt.Fprintf(w, `<svg xmlns="http://www.w3.org/2000/svg" width="200" height="30" font-family="sans-serif" font-size="11"><text x="10" y="20">No requests</text></svg>`+"\n")
+		return err
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" font-family="sans-serif" font-size="11">`+"\n", width, height, width, height)
+	fmt.Fprintf(&b, `<rect width="100%%" height="100%%" fill="#ffffff"/>`+"\n")
+
+	for row := range rows {
+		y := (rows - 1 - row) * heatmapCellHeight
+		fmt.Fprintf(&b, `<text x="%d" y="%d" text-anchor="end" fill="#616161">%s</text>`+"\n", heatmapMargin-6, y+heatmapCellHeight-5, html.EscapeString(heatmapRow(report.Bounds, row, locale)))
+
+		for i, column := range report.Columns {
+			if column.Counts[row] == 0 {
+				continue
+			}
+			share := heatmapShare(column, row)
+			fmt.Fprintf(&b, `<rect x="%d" y="%d" width="%d" height="%d" fill="#c62828" fill-opacity="%.3f"><title>%s %s: %s (%s)</title></rect>`+"\n",
+				heatmapMargin+i*heatmapCellWidth, y, heatmapCellWidth, heatmapCellHeight, 0.1+0.9*share,
+				html.EscapeString(locale.FormatDateTime(column.Start)),
+				html.EscapeString(heatmapRow(report.Bounds, row, locale)),
+				locale.Int(column.Counts[row]),
+				locale.Percent(share),
+			)
+		}
+	}
+
+	bottom := rows * heatmapCellHeight
+	fmt.Fprintf(&b, `<line x1="%d" y1="%d" x2="%d" y2="%d" stroke="#bdbdbd"/>`+"\n", heatmapMargin, bottom, width-10, bottom)
+	for i, column := range report.Columns {
+		if len(column.Events) == 0 {
+			continue
+		}
+		x := heatmapMargin + i*heatmapCellWidth
+		fmt.Fprintf(&b, `<line x1="%d" y1="0" x2="%d" y2="%d" stroke="#1565c0" stroke-dasharray="3,2"><title>%s</title></line>`+"\n", x, x, bottom, html.EscapeString(strings.Join(column.Events, ", ")))
+	}
+
+	last := report.Columns[len(report.Columns)-1].Start.Add(report.Interval)
+	fmt.Fprintf(&b, `<text x="%d" y="%d" fill="#616161">%s</text>`+"\n", heatmapMargin, bottom+16, html.EscapeString(locale.FormatDateTime(report.Columns[0].Start)))
+	fmt.Fprintf(&b, `<text x="%d" y="%d" text-anchor="end" fill="#616161">%s</text>`+"\n", width-10, bottom+16, html.EscapeString(locale.FormatDateTime(last)))
+	fmt.Fprintf(&b, `<text x="%d" y="%d" fill="#9e9e9e">%s per column, shade is share of column requests</text>`+"\n", heatmapMargin, bottom+34, report.Interval)
+	b.WriteString("</svg>\n")
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Default latency histogram buckets
+var defaultBuckets = []time.Duration{
+	time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+}
+
+// Width of histogram bars in characters
+const histogramWidth = 40
+
+// Histogram bucket, Le is upper bound (zero for overflow bucket)
+type HistogramBucket struct {
+	Le    time.Duration `json:"le"`
+	Count int           `json:"count"`
+}
+
+// Parsing bucket list like "1ms,5ms,1s"
+func parseBuckets(value string) ([]time.Duration, error) {
+	var buckets []time.Duration
+
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		d, err := parseFlagDuration(part)
+		if err != nil {
+			return nil, err
+		}
+		if d <= 0 {
+			return nil, fmt.Errorf("invalid bucket %q", part)
+		}
+		buckets = append(buckets, d)
+	}
+
+	if len(buckets) == 0 {
+		return nil, fmt.Errorf("no buckets")
+	}
+
+	slices.Sort(buckets)
+	return slices.Compact(buckets), nil
+}
+
+// Incremental latency histogram
+type Histogram struct {
+	bounds  []time.Duration
+	buckets []HistogramBucket
+}
+
+func NewHistogram(bounds []time.Duration) *Histogram {
+	buckets := make([]HistogramBucket, len(bounds)+1)
+	for i, le := range bounds {
+		buckets[i].Le = le
+	}
+	return &Histogram{bounds: bounds, buckets: buckets}
+}
+
+// Adding record duration to its bucket
+func (h *Histogram) Add(record LogRecord) {
+	i, _ := slices.BinarySearch(h.bounds, record.Duration)
+	h.buckets[i].Count++
+}
+
+// Histogram buckets, last bucket counts durations above all bounds.
+// Counts of -sample are scaled to estimates.
+func (h *Histogram) Buckets() []HistogramBucket {
+	buckets := slices.Clone(h.buckets)
+	if sampleRate < 1 {
+		for i := range buckets {
+			buckets[i].Count = scaleCount(buckets[i].Count)
+		}
+	}
+	return buckets
+}
+
+// Histogram mode output
+func printHistogram(buckets []HistogramBucket, locale Locale) {
+	printSampleNote(os.Stdout, locale)
+
+	total, peak := 0, 0
+	for _, bucket := range buckets {
+		total += bucket.Count
+		peak = max(peak, bucket.Count)
+	}
+
+	for i, bucket := range buckets {
+		label := "<= " + locale.Duration(bucket.Le)
+		if i == len(buckets)-1 {
+			label = "> " + locale.Duration(buckets[i-1].Le)
+		}
+
+		width := 0
+		if peak > 0 {
+			width = bucket.Count * histogramWidth / peak
+		}
+
+		share := 0.0
+		if total > 0 {
+			share = float64(bucket.Count) / float64(total)
+		}
+
+		fmt.Printf("%12s |%s%s| %s (%s)\n",
+			label,
+			strings.Repeat("█", width),
+			strings.Repeat(" ", histogramWidth-width),
+			locale.Int(bucket.Count),
+			locale.Percent(share),
+		)
+	}
+}
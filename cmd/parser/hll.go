@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math"
+	"math/bits"
+)
+
+// Precision of HyperLogLog, 2^13 registers of one byte have standard
+// error of about 1.15%
+const hllPrecision = 13
+
+// HyperLogLog estimating number of distinct strings (client IPs) in
+// fixed memory. Sketches of same precision merge into sketch of union,
+// and adding same string again changes nothing, so reading same logs
+// twice doesn't count their clients twice.
+type HyperLogLog struct {
+	registers []byte
+}
+
+func NewHyperLogLog() *HyperLogLog {
+	return &HyperLogLog{registers: make([]byte, 1<<hllPrecision)}
+}
+
+// Sketch of registers written by Registers
+func hyperLogLogOf(registers []byte) (*HyperLogLog, error) {
+	if len(registers) != 1<<hllPrecision {
+		return nil, fmt.Errorf("sketch has %d registers, expected %d", len(registers), 1<<hllPrecision)
+	}
+	return &HyperLogLog{registers: registers}, nil
+}
+
+func (h *HyperLogLog) Add(value string) {
+	hash := fnv.New64a()
+	hash.Write([]byte(value))
+	x := mix64(hash.Sum64())
+
+	i := x >> (64 - hllPrecision)
+	rank := byte(bits.LeadingZeros64(x<<hllPrecision|1<<(hllPrecision-1)) + 1)
+	h.registers[i] = max(h.registers[i], rank)
+}
+
+// Finalizer of splitmix64, FNV alone spreads similar IPs badly
+func mix64(z uint64) uint64 {
+	z ^= z >> 30
+	z *= 0xbf58476d1ce4e5b9
+	z ^= z >> 27
+	z *= 0x94d049bb133111eb
+	return z ^ z>>31
+}
+
+func (h *HyperLogLog) Merge(other *HyperLogLog) {
+	for i, r := range other.registers {
+		h.registers[i] = max(h.registers[i], r)
+	}
+}
+
+func (h *HyperLogLog) Clone() *HyperLogLog {
+	return &HyperLogLog{registers: append([]byte(nil), h.registers...)}
+}
+
+// Estimated number of distinct values, small counts are counted
+// by empty registers (linear counting)
+func (h *HyperLogLog) Count() int {
+	m := float64(len(h.registers))
+	sum, zeros := 0.0, 0
+	for _, r := range h.registers {
+		sum += math.Ldexp(1, -int(r))
+		if r == 0 {
+			zeros++
+		}
+	}
+
+	estimate := 0.7213 / (1 + 1.079/m) * m * m / sum
+	if estimate <= 2.5*m && zeros > 0 {
+		estimate = m * math.Log(m/float64(zeros))
+	}
+	return int(math.Round(estimate))
+}
+
+// Registers for storing sketch
+func (h *HyperLogLog) Registers() []byte {
+	return h.registers
+}
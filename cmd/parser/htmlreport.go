@@ -0,0 +1,437 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Routes in top endpoints table of HTML report
+const htmlTopRoutes = 20
+
+// Points of requests-over-time chart, intervals are merged above it
+const htmlMaxPoints = 360
+
+// Size of chart area of SVG charts
+const (
+	htmlChartWidth  = 720
+	htmlChartHeight = 200
+)
+
+// Colors of status classes in pie chart, shades for codes of one class
+var htmlClassColors = map[string][]string{
+	"2xx": {"#2e7d32", "#66bb6a", "#a5d6a7"},
+	"3xx": {"#1565c0", "#42a5f5", "#90caf9"},
+	"4xx": {"#ef6c00", "#ffa726", "#ffcc80"},
+	"5xx": {"#c62828", "#ef5350", "#ef9a9a"},
+}
+
+// Offline HTML report (report command), one page with styles,
+// script and SVG charts inline, so it can be attached to postmortem
+type HTMLReport struct {
+	pipeline  *Pipeline
+	metrics   *MetricsAccumulator
+	groups    *GroupAccumulator
+	histogram *Histogram
+	series    *TimeSeries
+}
+
+func NewHTMLReport(checker *SanityChecker, interval time.Duration, buckets []time.Duration, now time.Time, percentiles []float64) *HTMLReport {
+	r := &HTMLReport{
+		pipeline:  NewPipeline(checker),
+		metrics:   NewMetricsAccumulator(now, percentiles),
+		groups:    NewGroupAccumulator("url", now, percentiles),
+		histogram: NewHistogram(buckets),
+		series:    NewTimeSeries(interval, now, nil),
+	}
+	r.pipeline.AddChecked(htmlReportSink{r})
+	return r
+}
+
+// Sink of HTML report, records with plausible durations
+type htmlReportSink struct {
+	report *HTMLReport
+}
+
+func (s htmlReportSink) Add(record LogRecord) error {
+	s.report.metrics.Add(record)
+	s.report.groups.Add(record)
+	s.report.histogram.Add(record)
+	s.report.series.Add(record)
+	return nil
+}
+
+func (s htmlReportSink) Finish() error {
+	return nil
+}
+
+// Slice of status code pie chart
+type htmlSlice struct {
+	Code  int
+	Count int
+	Share float64
+	Path  string
+	Color string
+}
+
+// Bar of latency histogram
+type htmlBar struct {
+	Label  string
+	Count  int
+	X, Y   float64
+	Width  float64
+	Height float64
+}
+
+// Point of requests-over-time chart
+type htmlPoint struct {
+	Start  time.Time
+	Count  int
+	Errors int
+	X, Y   float64
+	ErrorY float64
+}
+
+// Writing report page
+func (r *HTMLReport) Write(w io.Writer, title string, inputs []string, created time.Time, locale Locale) error {
+	metrics := r.metrics.Metrics()
+	metrics.Suspicious = r.pipeline.Suspicious()
+
+	buckets, err := r.series.Buckets()
+	if err != nil {
+		return err
+	}
+	buckets, interval := mergeTimeBuckets(buckets, r.series.interval, htmlMaxPoints)
+	points, requestsLine, errorsLine := htmlTimeline(buckets)
+
+	groups := r.groups.Groups()
+	groups = groups[:min(len(groups), htmlTopRoutes)]
+
+	if len(inputs) == 0 {
+		inputs = []string{"stdin"}
+	}
+
+	return htmlReportTemplate.Execute(w, map[string]any{
+		"Title":        title,
+		"Created":      created,
+		"Inputs":       strings.Join(inputs, ", "),
+		"Metrics":      metrics,
+		"Slices":       htmlPie(metrics.StatusCounts),
+		"Bars":         htmlHistogram(r.histogram.Buckets(), locale),
+		"Points":       points,
+		"RequestsLine": requestsLine,
+		"ErrorsLine":   errorsLine,
+		"Interval":     interval,
+		"Groups":       groups,
+		"Locale":       locale,
+		"Width":        float64(htmlChartWidth),
+		"Height":       float64(htmlChartHeight),
+	})
+}
+
+// Merging consecutive buckets until there are at most max of them,
+// returns buckets with their interval
+func mergeTimeBuckets(buckets []TimeBucket, interval time.Duration, max int) ([]TimeBucket, time.Duration) {
+	factor := (len(buckets) + max - 1) / max
+	if factor <= 1 {
+		return buckets, interval
+	}
+
+	var merged []TimeBucket
+	for i := 0; i < len(buckets); i += factor {
+		bucket := TimeBucket{Start: buckets[i].Start}
+		for _, b := range buckets[i:min(i+factor, len(buckets))] {
+			bucket.Count += b.Count
+			bucket.Errors += b.Errors
+			bucket.TotalTime += b.TotalTime
+		}
+		if bucket.Count > 0 {
+			bucket.AvgTime = bucket.TotalTime / time.Duration(bucket.Count)
+		}
+		merged = append(merged, bucket)
+	}
+	return merged, interval * time.Duration(factor)
+}
+
+// Slices of status codes in order of codes, shaded by class
+func htmlPie(counts map[int]int) []htmlSlice {
+	total := 0
+	codes := make([]int, 0, len(counts))
+	for code, count := range counts {
+		codes = append(codes, code)
+		total += count
+	}
+	slices.Sort(codes)
+
+	var pie []htmlSlice
+	angle := -math.Pi / 2
+	shade := map[string]int{}
+	for _, code := range codes {
+		share := float64(counts[code]) / float64(total)
+		class := statusClass(code)
+		colors, ok := htmlClassColors[class]
+		if !ok {
+			colors = []string{"#757575"}
+		}
+
+		end := angle + share*2*math.Pi
+		pie = append(pie, htmlSlice{
+			Code:  code,
+			Count: counts[code],
+			Share: share,
+			Path:  pieSlicePath(angle, end),
+			Color: colors[shade[class]%len(colors)],
+		})
+		shade[class]++
+		angle = end
+	}
+	return pie
+}
+
+// SVG path of pie slice of circle with radius 90 around (100, 100)
+func pieSlicePath(from, to float64) string {
+	const r = 90.0
+	point := func(a float64) string {
+		return strconv.FormatFloat(100+r*math.Cos(a), 'f', 2, 64) + " " + strconv.FormatFloat(100+r*math.Sin(a), 'f', 2, 64)
+	}
+
+	// Whole circle can't be single arc
+	if to-from >= 2*math.Pi-1e-9 {
+		return "M " + point(from) + " A 90 90 0 1 1 " + point(from+math.Pi) + " A 90 90 0 1 1 " + point(from) + " Z"
+	}
+
+	large := 0
+	if to-from > math.Pi {
+		large = 1
+	}
+	return fmt.Sprintf("M 100 100 L %s A 90 90 0 %d 1 %s Z", point(from), large, point(to))
+}
+
+// Bars of latency histogram scaled to chart
+func htmlHistogram(buckets []HistogramBucket, locale Locale) []htmlBar {
+	peak := 0
+	for _, bucket := range buckets {
+		peak = max(peak, bucket.Count)
+	}
+
+	width := float64(htmlChartWidth) / float64(len(buckets))
+	bars := make([]htmlBar, len(buckets))
+	for i, bucket := range buckets {
+		label := "> " + locale.Duration(buckets[max(i-1, 0)].Le)
+		if bucket.Le > 0 {
+			label = "≤ " + locale.Duration(bucket.Le)
+		}
+
+		height := 0.0
+		if peak > 0 {
+			height = float64(bucket.Count) / float64(peak) * htmlChartHeight
+		}
+		bars[i] = htmlBar{
+			Label:  label,
+			Count:  bucket.Count,
+			X:      float64(i)*width + 4,
+			Y:      htmlChartHeight - height,
+			Width:  width - 8,
+			Height: height,
+		}
+	}
+	return bars
+}
+
+// Points of requests-over-time chart with polylines of requests
+// and errors
+func htmlTimeline(buckets []TimeBucket) ([]htmlPoint, string, string) {
+	peak := 0
+	for _, bucket := range buckets {
+		peak = max(peak, bucket.Count)
+	}
+
+	step := 0.0
+	if len(buckets) > 1 {
+		step = float64(htmlChartWidth) / float64(len(buckets)-1)
+	}
+	y := func(count int) float64 {
+		if peak == 0 {
+			return htmlChartHeight
+		}
+		return htmlChartHeight - float64(count)/float64(peak)*htmlChartHeight
+	}
+
+	points := make([]htmlPoint, len(buckets))
+	var requests, errors []string
+	for i, bucket := range buckets {
+		points[i] = htmlPoint{
+			Start:  bucket.Start,
+			Count:  bucket.Count,
+			Errors: bucket.Errors,
+			X:      float64(i) * step,
+			Y:      y(bucket.Count),
+			ErrorY: y(bucket.Errors),
+		}
+		requests = append(requests, fmt.Sprintf("%.1f,%.1f", points[i].X, points[i].Y))
+		errors = append(errors, fmt.Sprintf("%.1f,%.1f", points[i].X, points[i].ErrorY))
+	}
+	return points, strings.Join(requests, " "), strings.Join(errors, " ")
+}
+
+// Page of HTML report, everything inline so it works offline
+var htmlReportTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"percentileLabel": percentileLabel,
+	"add":             func(a, b float64) float64 { return a + b },
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; margin: 2em auto; max-width: 1000px; color: #212121; padding: 0 1em; }
+h1 { margin-bottom: 0.2em; }
+.meta { color: #757575; margin-top: 0; }
+section { margin: 2em 0; }
+.cards { display: flex; flex-wrap: wrap; gap: 0.8em; }
+.card { border: 1px solid #e0e0e0; border-radius: 6px; padding: 0.6em 1em; min-width: 8em; }
+.card .label { color: #757575; font-size: 0.85em; }
+.card .value { font-size: 1.3em; font-weight: 600; }
+.pie { display: flex; align-items: center; gap: 2em; }
+.legend td { padding: 2px 8px; }
+.swatch { display: inline-block; width: 0.9em; height: 0.9em; border-radius: 2px; vertical-align: middle; }
+svg text { font-size: 11px; fill: #616161; }
+.axis { stroke: #bdbdbd; }
+.requests { fill: none; stroke: #1565c0; stroke-width: 1.5; }
+.errors { fill: none; stroke: #c62828; stroke-width: 1.5; }
+.bar { fill: #42a5f5; }
+.bar:hover, path:hover { opacity: 0.75; }
+table.routes { border-collapse: collapse; width: 100%; }
+table.routes th, table.routes td { padding: 4px 8px; border-bottom: 1px solid #eeeeee; text-align: right; }
+table.routes th:first-child, table.routes td:first-child { text-align: left; word-break: break-all; }
+table.routes th { cursor: pointer; user-select: none; background: #fafafa; }
+table.routes th.sorted::after { content: " ▾"; }
+table.routes th.sorted.asc::after { content: " ▴"; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<p class="meta">Generated {{.Locale.FormatDateTime .Created}} from {{.Inputs}}</p>
+
+<section>
+<h2>Summary</h2>
+<div class="cards">
+<div class="card"><div class="label">Requests</div><div class="value">{{.Locale.Int .Metrics.Count}}</div></div>
+{{- if .Metrics.Count}}
+{{- if not .Metrics.Start.IsZero}}
+<div class="card"><div class="label">Period</div><div class="value">{{.Locale.FormatDateTime .Metrics.Start}} – {{.Locale.FormatDateTime .Metrics.End}}</div></div>
+<div class="card"><div class="label">RPS</div><div class="value">{{.Locale.Float .Metrics.RPS 2}}</div></div>
+{{- end}}
+<div class="card"><div class="label">Error rate</div><div class="value">{{.Locale.Percent .Metrics.ErrorRate}}</div></div>
+<div class="card"><div class="label">Average</div><div class="value">{{.Locale.Duration .Metrics.AverageTime}}</div></div>
+<div class="card"><div class="label">Min</div><div class="value">{{.Locale.Duration .Metrics.MinTime}}</div></div>
+<div class="card"><div class="label">Max</div><div class="value">{{.Locale.Duration .Metrics.MaxTime}}</div></div>
+{{- range .Metrics.Percentiles}}
+<div class="card"><div class="label">{{percentileLabel .P}}</div><div class="value">{{$.Locale.Duration .Value}}</div></div>
+{{- end}}
+{{- end}}
+{{- if .Metrics.Suspicious}}
+<div class="card"><div class="label">Suspicious durations</div><div class="value">{{.Locale.Int .Metrics.Suspicious}}</div></div>
+{{- end}}
+</div>
+</section>
+
+{{- if .Slices}}
+<section>
+<h2>Status codes</h2>
+<div class="pie">
+<svg width="200" height="200" viewBox="0 0 200 200" role="img" aria-label="Status code pie chart">
+{{- range .Slices}}
+<path d="{{.Path}}" fill="{{.Color}}"><title>{{.Code}}: {{$.Locale.Int .Count}} ({{$.Locale.Percent .Share}})</title></path>
+{{- end}}
+</svg>
+<table class="legend">
+{{- range .Slices}}
+<tr><td><span class="swatch" style="background: {{.Color}}"></span> {{.Code}}</td><td>{{$.Locale.Int .Count}}</td><td>{{$.Locale.Percent .Share}}</td></tr>
+{{- end}}
+</table>
+</div>
+</section>
+{{- end}}
+
+{{- if .Metrics.Count}}
+<section>
+<h2>Latency histogram</h2>
+<svg width="100%" viewBox="0 -10 {{.Width}} {{add .Height 40}}" role="img" aria-label="Latency histogram">
+<line class="axis" x1="0" y1="{{.Height}}" x2="{{.Width}}" y2="{{.Height}}"/>
+{{- range .Bars}}
+<rect class="bar" x="{{.X}}" y="{{.Y}}" width="{{.Width}}" height="{{.Height}}"><title>{{.Label}}: {{$.Locale.Int .Count}}</title></rect>
+<text x="{{add .X 2}}" y="{{add $.Height 16}}">{{.Label}}</text>
+<text x="{{add .X 2}}" y="{{add $.Height 30}}">{{$.Locale.Int .Count}}</text>
+{{- end}}
+</svg>
+</section>
+{{- end}}
+
+{{- if .Points}}
+<section>
+<h2>Requests over time</h2>
+<p class="meta">Per {{.Interval}}, <span style="color: #1565c0">requests</span> and <span style="color: #c62828">server errors</span></p>
+<svg width="100%" viewBox="-5 -10 {{add .Width 10}} {{add .Height 40}}" role="img" aria-label="Requests over time">
+<line class="axis" x1="0" y1="{{.Height}}" x2="{{.Width}}" y2="{{.Height}}"/>
+<polyline class="requests" points="{{.RequestsLine}}"/>
+<polyline class="errors" points="{{.ErrorsLine}}"/>
+{{- range .Points}}
+<circle cx="{{.X}}" cy="{{.Y}}" r="3" fill="transparent"><title>{{$.Locale.FormatDateTime .Start}}: {{$.Locale.Int .Count}} requests, {{$.Locale.Int .Errors}} errors</title></circle>
+{{- end}}
+{{- with index .Points 0}}
+<text x="0" y="{{add $.Height 18}}">{{$.Locale.FormatDateTime .Start}}</text>
+{{- end}}
+</svg>
+</section>
+{{- end}}
+
+{{- if .Groups}}
+<section>
+<h2>Top endpoints</h2>
+<table class="routes" id="routes">
+<thead><tr><th>Route</th><th>Count</th><th>RPS</th><th>Avg</th>{{range (index .Groups 0).Percentiles}}<th>{{percentileLabel .P}}</th>{{end}}<th>Max</th><th>Errors</th></tr></thead>
+<tbody>
+{{- range .Groups}}
+<tr><td>{{.Key}}</td><td data-value="{{.Count}}">{{$.Locale.Int .Count}}</td><td data-value="{{.RPS}}">{{$.Locale.Float .RPS 2}}</td><td data-value="{{.AverageTime.Nanoseconds}}">{{$.Locale.Duration .AverageTime}}</td>{{range .Percentiles}}<td data-value="{{.Value.Nanoseconds}}">{{$.Locale.Duration .Value}}</td>{{end}}<td data-value="{{.MaxTime.Nanoseconds}}">{{$.Locale.Duration .MaxTime}}</td><td data-value="{{.ErrorRate}}">{{$.Locale.Percent .ErrorRate}}</td></tr>
+{{- end}}
+</tbody>
+</table>
+</section>
+{{- end}}
+
+<script>
+// Sorting top endpoints by clicked column
+(function () {
+  var table = document.getElementById("routes");
+  if (!table) return;
+  var headers = table.querySelectorAll("th");
+  headers.forEach(function (th, column) {
+    th.addEventListener("click", function () {
+      var asc = th.classList.contains("sorted") && !th.classList.contains("asc");
+      headers.forEach(function (h) { h.classList.remove("sorted", "asc"); });
+      th.classList.add("sorted");
+      if (asc) th.classList.add("asc");
+
+      var body = table.tBodies[0];
+      var rows = Array.prototype.slice.call(body.rows);
+      rows.sort(function (a, b) {
+        var x = a.cells[column], y = b.cells[column];
+        var cmp = column === 0
+          ? x.textContent.localeCompare(y.textContent)
+          : parseFloat(x.dataset.value) - parseFloat(y.dataset.value);
+        return asc ? cmp : -cmp;
+      });
+      rows.forEach(function (row) { body.appendChild(row); });
+    });
+  });
+})();
+</script>
+</body>
+</html>
+`))
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Impact of route on users
+type RouteImpact struct {
+	Route    string        `json:"route"`
+	Requests int           `json:"requests"`
+	Share    float64       `json:"share"`
+	Latency  time.Duration `json:"latency"`
+
+	// Latency over budget relative to budget, 0.5 is 50% over it
+	Excess    float64 `json:"excess"`
+	ErrorRate float64 `json:"error_rate"`
+	Score     float64 `json:"score"`
+}
+
+// Impact report
+type ImpactReport struct {
+	Budget     time.Duration `json:"budget"`
+	Percentile float64       `json:"percentile"`
+	Routes     []RouteImpact `json:"routes"`
+}
+
+// Impact score of route: traffic share × (latency excess over budget
+// + error rate). Penalties are added, as multiplying them would give
+// zero to routes which are only slow or only failing. Routes within
+// budget without errors have zero score.
+func routeImpacts(groups []GroupMetrics, budget time.Duration, percentile float64) ImpactReport {
+	report := ImpactReport{Budget: budget, Percentile: percentile, Routes: []RouteImpact{}}
+
+	total := 0
+	for _, group := range groups {
+		total += group.Count
+	}
+
+	for _, group := range groups {
+		impact := RouteImpact{
+			Route:     group.Key,
+			Requests:  group.Count,
+			Share:     float64(group.Count) / float64(total),
+			ErrorRate: group.ErrorRate,
+		}
+		for _, p := range group.Percentiles {
+			if p.P == percentile {
+				impact.Latency = p.Value
+			}
+		}
+		if impact.Latency > budget {
+			impact.Excess = float64(impact.Latency-budget) / float64(budget)
+		}
+		impact.Score = impact.Share * (impact.Excess + impact.ErrorRate)
+		report.Routes = append(report.Routes, impact)
+	}
+
+	slices.SortFunc(report.Routes, func(a, b RouteImpact) int {
+		if a.Score != b.Score {
+			if a.Score > b.Score {
+				return -1
+			}
+			return 1
+		}
+		return strings.Compare(a.Route, b.Route)
+	})
+	return report
+}
+
+// Impact report output, routes without impact are counted only
+func printImpact(report ImpactReport, locale Locale) {
+	label := percentileLabel(report.Percentile)
+	fmt.Printf("Routes by impact score: traffic share × (%s excess over %s budget + error rate)\n\n", label, locale.Duration(report.Budget))
+
+	w := newTable(os.Stdout)
+	fmt.Fprintf(w, "ROUTE\tREQUESTS\tSHARE\t%s\tEXCESS\tERRORS\tSCORE\n", strings.ToUpper(label))
+
+	within := 0
+	for _, route := range report.Routes {
+		if route.Score == 0 {
+			within++
+			continue
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			route.Route,
+			locale.Int(route.Requests),
+			locale.Percent(route.Share),
+			locale.Duration(route.Latency),
+			locale.Percent(route.Excess),
+			locale.Percent(route.ErrorRate),
+			locale.Float(route.Score, 4),
+		)
+	}
+	w.Flush()
+
+	if within > 0 {
+		fmt.Printf("\n%s routes within budget without errors\n", locale.Int(within))
+	}
+}
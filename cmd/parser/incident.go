@@ -0,0 +1,279 @@
+package main
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// Width of largest bar of timeline chart
+const incidentBarWidth = 40
+
+// File of incident bundle
+type IncidentFile struct {
+	Name   string `json:"name"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// Manifest of incident bundle, how and from what it was made
+type IncidentManifest struct {
+	Version  string         `json:"version"`
+	Build    Build          `json:"build"`
+	Created  time.Time      `json:"created"`
+	Command  []string       `json:"command"`
+	From     time.Time      `json:"from"`
+	To       time.Time      `json:"to"`
+	Inputs   []string       `json:"inputs"`
+	Requests int            `json:"requests"`
+	Files    []IncidentFile `json:"files"`
+}
+
+// Sinks of incident bundle. Matching records are written to
+// temp file as raw lines, as there may be too many to keep.
+type Incident struct {
+	raw      *os.File
+	rawBuf   *bufio.Writer
+	requests int
+
+	pipeline  *Pipeline
+	metrics   *MetricsAccumulator
+	groups    *GroupAccumulator
+	series    *TimeSeries
+	anomalies *Anomalies
+}
+
+func NewIncident(checker *SanityChecker, anomaly AnomalyConfig, now time.Time, percentiles []float64) (*Incident, error) {
+	raw, err := os.CreateTemp("", "ginlog-incident-*.log")
+	if err != nil {
+		return nil, err
+	}
+
+	i := &Incident{
+		raw:       raw,
+		pipeline:  NewPipeline(checker),
+		metrics:   NewMetricsAccumulator(now, percentiles),
+		groups:    NewGroupAccumulator("url", now, percentiles),
+		series:    NewTimeSeries(anomaly.Interval, now, nil),
+		anomalies: NewAnomalies(anomaly, now),
+	}
+
+	i.rawBuf = bufio.NewWriter(raw)
+	i.pipeline.Add(rawIncidentSink{i})
+	i.pipeline.AddChecked(incidentSink{i})
+	return i, nil
+}
+
+// Removing temp file of raw lines
+func (i *Incident) Close() error {
+	i.raw.Close()
+	return os.Remove(i.raw.Name())
+}
+
+// Writing bundle as tar.gz, files are put into directory named
+// after start of window
+func (i *Incident) Write(w io.Writer, manifest IncidentManifest, locale Locale) error {
+	metrics := i.metrics.Metrics()
+	metrics.Suspicious = i.pipeline.Suspicious()
+	groups := i.groups.Groups()
+	anomalies := i.anomalies.Anomalies()
+
+	buckets, err := i.series.Buckets()
+	if err != nil {
+		return err
+	}
+
+	type file struct {
+		name string
+		data []byte
+	}
+	var files []file
+	add := func(name string, data []byte, err error) error {
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		files = append(files, file{name, data})
+		return nil
+	}
+	text := func(name string, print func()) error {
+		data, err := captureStdout(print)
+		return add(name, data, err)
+	}
+	jsonFile := func(name string, v any) error {
+		data, err := json.MarshalIndent(v, "", "  ")
+		return add(name, append(data, '\n'), err)
+	}
+
+	for _, err := range []error{
+		text("summary.txt", func() { printMetrics(metrics, locale) }),
+		jsonFile("metrics.json", metrics),
+		text("routes.txt", func() { printGroups(groups, "url", locale) }),
+		jsonFile("routes.json", groups),
+		text("timeline.txt", func() { printIncidentTimeline(buckets, i.series.interval, locale) }),
+		jsonFile("timeline.json", buckets),
+		text("anomalies.txt", func() { printAnomalies(anomalies, i.anomalies.config, locale) }),
+		jsonFile("anomalies.json", anomalies),
+	} {
+		if err != nil {
+			return err
+		}
+	}
+
+	// Raw lines are hashed before copied, so they are read twice
+	if err := i.rawBuf.Flush(); err != nil {
+		return err
+	}
+	if _, err := i.raw.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	hash := sha256.New()
+	size, err := io.Copy(hash, i.raw)
+	if err != nil {
+		return err
+	}
+
+	manifest.Requests = i.requests
+	manifest.Files = []IncidentFile{{Name: "requests.log", Size: size, SHA256: hex.EncodeToString(hash.Sum(nil))}}
+	for _, f := range files {
+		sum := sha256.Sum256(f.data)
+		manifest.Files = append(manifest.Files, IncidentFile{Name: f.name, Size: int64(len(f.data)), SHA256: hex.EncodeToString(sum[:])})
+	}
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	files = append([]file{{"manifest.json", append(data, '\n')}}, files...)
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	dir := "incident-" + manifest.From.Format("20060102-150405") + "/"
+
+	header := func(name string, size int64) error {
+		return tw.WriteHeader(&tar.Header{
+			Name:    dir + name,
+			Mode:    0o644,
+			Size:    size,
+			ModTime: manifest.Created,
+		})
+	}
+
+	for _, f := range files {
+		if err := header(f.name, int64(len(f.data))); err != nil {
+			return err
+		}
+		if _, err := tw.Write(f.data); err != nil {
+			return err
+		}
+	}
+
+	if err := header("requests.log", size); err != nil {
+		return err
+	}
+	if _, err := i.raw.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if _, err := io.Copy(tw, i.raw); err != nil {
+		return err
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// Sink of raw lines of incident
+type rawIncidentSink struct {
+	incident *Incident
+}
+
+func (s rawIncidentSink) Add(record LogRecord) error {
+	s.incident.requests++
+	return writeRaw(s.incident.rawBuf, record)
+}
+
+func (s rawIncidentSink) Finish() error {
+	return nil
+}
+
+// Sink of incident reports, records with plausible durations
+type incidentSink struct {
+	incident *Incident
+}
+
+func (s incidentSink) Add(record LogRecord) error {
+	s.incident.metrics.Add(record)
+	s.incident.groups.Add(record)
+	s.incident.series.Add(record)
+	s.incident.anomalies.Add(record)
+	return nil
+}
+
+func (s incidentSink) Finish() error {
+	return nil
+}
+
+// Timeline chart, bar of requests per interval with errors
+// marked at its start
+func printIncidentTimeline(buckets []TimeBucket, interval time.Duration, locale Locale) {
+	peak := 0
+	for _, bucket := range buckets {
+		peak = max(peak, bucket.Count)
+	}
+
+	fmt.Printf("Requests per %v, errors marked with !\n\n", interval)
+
+	w := newTable(os.Stdout)
+	defer w.Flush()
+
+	fmt.Fprintf(w, "TIME\tCOUNT\tERRORS\tAVG\t\n")
+	for _, bucket := range buckets {
+		var bar string
+		if peak > 0 {
+			width := (bucket.Count*incidentBarWidth + peak - 1) / peak
+			errors := (bucket.Errors*incidentBarWidth + peak - 1) / peak
+			bar = strings.Repeat("!", errors) + strings.Repeat("#", width-errors)
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n",
+			locale.FormatDateTime(bucket.Start),
+			locale.Int(bucket.Count),
+			locale.Int(bucket.Errors),
+			locale.Duration(bucket.AvgTime),
+			bar,
+		)
+	}
+}
+
+// Running print with stdout going to buffer, report printers
+// write to stdout like -o does
+func captureStdout(print func()) ([]byte, error) {
+	temp, err := os.CreateTemp("", "ginlog-report-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(temp.Name())
+	defer temp.Close()
+
+	// Captured text goes to files, so it's never colored or truncated
+	stdout, color, width := os.Stdout, colorOutput, tableWidth
+	os.Stdout, colorOutput, tableWidth = temp, false, 0
+	print()
+	os.Stdout, colorOutput, tableWidth = stdout, color, width
+
+	if _, err := temp.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	_, err = buf.ReadFrom(temp)
+	return buf.Bytes(), err
+}
@@ -0,0 +1,309 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Index of log file is written next to it with this suffix
+const indexSuffix = ".ginidx"
+
+// First bytes of index file, version is last byte
+var indexMagic = [8]byte{'G', 'I', 'N', 'L', 'I', 'D', 'X', 1}
+
+// Input bytes of one block, blocks end at line end
+const indexBlockSize = 1 << 20
+
+// Header of index file, followed by key and blocks
+type indexHeader struct {
+	Magic   [8]byte
+	Size    int64
+	ModTime int64
+	Blocks  uint32
+	KeyLen  uint32
+}
+
+// Block of lines: bytes [Start, End) of file, and bounds of records
+// parsed from them. Block without records has zero bounds.
+type indexBlock struct {
+	Start, End               int64
+	Lines, Records           uint32
+	MinTime, MaxTime         int64
+	MinCode, MaxCode         uint32
+	MinDuration, MaxDuration int64
+}
+
+// Options which change parsed records, index written with other ones
+// is not used
+func indexKey(o *Options) string {
+	return fmt.Sprintf("input=%s pattern=%s container-time=%t tz=%s", o.InputFormat, o.Pattern, o.ContainerTime, o.TZ)
+}
+
+// Writing index of file (ginlog index): byte ranges of blocks with
+// time, status code and duration bounds of their records, so later runs
+// filtering by them read only blocks which can match
+func writeIndex(path string, format LineFormat, key string) (int, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return 0, err
+	}
+	if !info.Mode().IsRegular() || strings.HasSuffix(path, ".gz") {
+		return 0, fmt.Errorf("%s: only uncompressed files can be indexed", path)
+	}
+
+	var blocks []indexBlock
+	block := indexBlock{}
+	reader := newLineReader(file)
+	var offset int64
+
+	for {
+		line, size, err := reader.ReadLine()
+		if err != nil && err != io.EOF {
+			return 0, fmt.Errorf("%s: %w", path, err)
+		}
+		if err == nil {
+			offset += size
+			block.Lines++
+			if record, err := format.Parse(line); err == nil {
+				block.add(record)
+			}
+		}
+
+		if offset-block.Start >= indexBlockSize || (err == io.EOF && offset > block.Start) {
+			block.End = offset
+			blocks = append(blocks, block)
+			block = indexBlock{Start: offset}
+		}
+		if err == io.EOF {
+			break
+		}
+	}
+
+	// Size is what was read, file may have grown meanwhile
+	if offset != info.Size() {
+		return 0, fmt.Errorf("%s: file changed while indexing", path)
+	}
+
+	out, err := createAtomic(path+indexSuffix, false)
+	if err != nil {
+		return 0, err
+	}
+
+	header := indexHeader{Magic: indexMagic, Size: offset, ModTime: info.ModTime().UnixNano(), Blocks: uint32(len(blocks)), KeyLen: uint32(len(key))}
+	w := bufio.NewWriter(out.File())
+	binary.Write(w, binary.LittleEndian, header)
+	w.WriteString(key)
+	binary.Write(w, binary.LittleEndian, blocks)
+	if err := w.Flush(); err != nil {
+		out.Abort()
+		return 0, err
+	}
+	return len(blocks), out.Commit()
+}
+
+// Widening bounds of block with record
+func (b *indexBlock) add(record LogRecord) {
+	date := record.Date.UnixNano()
+	code := uint32(max(record.Code, 0))
+	duration := int64(record.Duration)
+
+	if b.Records == 0 {
+		b.MinTime, b.MaxTime = date, date
+		b.MinCode, b.MaxCode = code, code
+		b.MinDuration, b.MaxDuration = duration, duration
+	}
+	b.Records++
+	b.MinTime, b.MaxTime = min(b.MinTime, date), max(b.MaxTime, date)
+	b.MinCode, b.MaxCode = min(b.MinCode, code), max(b.MaxCode, code)
+	b.MinDuration, b.MaxDuration = min(b.MinDuration, duration), max(b.MaxDuration, duration)
+}
+
+// Bounds of filter which blocks of index can be checked against.
+// Status codes are ranges of -code and -class values, only when
+// no value is excluded.
+type blockFilter struct {
+	key                      string
+	from, to                 int64
+	minDuration, maxDuration int64
+	codes                    [][2]uint32
+}
+
+// Filter of blocks, nil when filter has no bounds index knows
+func newBlockFilter(filter Filter, key string) *blockFilter {
+	f := &blockFilter{key: key, from: math.MinInt64, to: math.MaxInt64, minDuration: math.MinInt64, maxDuration: math.MaxInt64}
+	bounded := false
+
+	if !filter.From.IsZero() {
+		f.from, bounded = filter.From.UnixNano(), true
+	}
+	if !filter.To.IsZero() {
+		f.to, bounded = filter.To.UnixNano(), true
+	}
+	if filter.MinDuration != "" {
+		f.minDuration, bounded = int64(filter.minDuration), true
+	}
+	if filter.MaxDuration != "" {
+		f.maxDuration, bounded = int64(filter.maxDuration), true
+	}
+
+	// Record must match one value of every list, so only one list
+	// can be checked as union of its ranges
+	for _, value := range []string{filter.Code, filter.Class} {
+		if codes, ok := codeRanges(value); ok {
+			f.codes, bounded = codes, true
+			break
+		}
+	}
+
+	if !bounded {
+		return nil
+	}
+	return f
+}
+
+// Ranges of included status codes and classes, false with exclusions
+func codeRanges(value string) ([][2]uint32, bool) {
+	if value == "" {
+		return nil, false
+	}
+
+	var ranges [][2]uint32
+	for _, v := range strings.Split(value, ",") {
+		v = strings.ToLower(strings.TrimSpace(v))
+		if strings.HasPrefix(v, "!") {
+			return nil, false
+		}
+		if class, ok := strings.CutSuffix(v, "xx"); ok {
+			n, err := strconv.Atoi(class)
+			if err != nil {
+				return nil, false
+			}
+			ranges = append(ranges, [2]uint32{uint32(n * 100), uint32(n*100 + 99)})
+			continue
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return nil, false
+		}
+		ranges = append(ranges, [2]uint32{uint32(n), uint32(n)})
+	}
+	return ranges, true
+}
+
+// Checking can block have matching records. To is exclusive like
+// in filter.
+func (f *blockFilter) matches(b indexBlock) bool {
+	if b.Records == 0 {
+		return false
+	}
+	if b.MaxTime < f.from || b.MinTime >= f.to {
+		return false
+	}
+	if b.MaxDuration < f.minDuration || b.MinDuration > f.maxDuration {
+		return false
+	}
+	if f.codes == nil {
+		return true
+	}
+	for _, r := range f.codes {
+		if b.MinCode <= r[1] && b.MaxCode >= r[0] {
+			return true
+		}
+	}
+	return false
+}
+
+// Reading index of file, false when there is none or it doesn't
+// match file (written before file changed, or with other -input,
+// -pattern, -container-time or -tz)
+func readIndex(path string, info os.FileInfo, key string) ([]indexBlock, bool) {
+	file, err := os.Open(path + indexSuffix)
+	if err != nil {
+		return nil, false
+	}
+	defer file.Close()
+
+	r := bufio.NewReader(file)
+	var header indexHeader
+	if err := binary.Read(r, binary.LittleEndian, &header); err != nil {
+		return nil, false
+	}
+	if header.Magic != indexMagic || header.Size != info.Size() || header.ModTime != info.ModTime().UnixNano() || int(header.KeyLen) != len(key) {
+		return nil, false
+	}
+
+	stored := make([]byte, header.KeyLen)
+	if _, err := io.ReadFull(r, stored); err != nil || string(stored) != key {
+		return nil, false
+	}
+
+	blocks := make([]indexBlock, header.Blocks)
+	if err := binary.Read(r, binary.LittleEndian, blocks); err != nil {
+		return nil, false
+	}
+	return blocks, true
+}
+
+// Opening file through its index, only blocks which can match filter
+// are read. False when file has no usable index, then whole file is
+// read as usual.
+func openIndexed(name string, filter *blockFilter) (io.ReadCloser, bool) {
+	if name == "-" || strings.HasPrefix(name, "http://") || strings.HasPrefix(name, "https://") || strings.HasSuffix(name, ".gz") {
+		return nil, false
+	}
+
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, false
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, false
+	}
+
+	blocks, ok := readIndex(name, info, filter.key)
+	if !ok {
+		file.Close()
+		return nil, false
+	}
+
+	// Adjacent matching blocks are read as one section
+	var sections []io.Reader
+	var start, end int64 = -1, -1
+	for _, b := range blocks {
+		if !filter.matches(b) {
+			continue
+		}
+		if b.Start != end {
+			if end > start {
+				sections = append(sections, io.NewSectionReader(file, start, end-start))
+			}
+			start = b.Start
+		}
+		end = b.End
+	}
+	if end > start {
+		sections = append(sections, io.NewSectionReader(file, start, end-start))
+	}
+
+	return readCloser{io.MultiReader(sections...), file}, true
+}
+
+// Index summary of ginlog index
+func printIndexed(path string, blocks int, took time.Duration) {
+	fmt.Fprintf(os.Stderr, "Indexed %s: %d blocks in %v, written to %s\n", path, blocks, took.Round(time.Millisecond), path+indexSuffix)
+}
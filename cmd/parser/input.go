@@ -0,0 +1,393 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Reader of several inputs one after another, like concatenated files.
+// Newline is added after each input so last line of input is not
+// joined with first line of next one. With issues collector unreadable
+// inputs, or rest of inputs broken while reading, are skipped and
+// recorded instead of failing, unless -fail-on-partial is set.
+type concatReader struct {
+	next    func() (io.Reader, error)
+	current io.Reader
+	closer  io.Closer
+	offset  *offsetReader
+
+	// Name of current input and collector of skipped ones
+	name   string
+	issues *Issues
+
+	// Filter of blocks of indexed files, nil reads files whole
+	index *blockFilter
+}
+
+func (r *concatReader) Read(p []byte) (int, error) {
+	for {
+		if r.current == nil {
+			input, err := r.next()
+			if err == io.EOF {
+				return 0, err
+			}
+			if err != nil {
+				if err = r.skip(err); err == nil {
+					continue
+				}
+				return 0, err
+			}
+
+			r.closer, _ = input.(io.Closer)
+			if opened, ok := input.(openedInput); ok {
+				r.offset = opened.offset
+			}
+			r.current = io.MultiReader(input, strings.NewReader("\n"))
+		}
+
+		n, err := r.current.Read(p)
+		if err == io.EOF {
+			r.closeCurrent()
+			if n == 0 {
+				continue
+			}
+			err = nil
+		}
+
+		// Rest of broken input is skipped, line read so far is ended
+		if err != nil {
+			if err = r.skip(err); err == nil {
+				r.closeCurrent()
+				r.current = strings.NewReader("\n")
+			}
+		}
+		return n, err
+	}
+}
+
+// Recording unreadable input, returns error when it can't be skipped
+func (r *concatReader) skip(err error) error {
+	detail := unreadableDetail(r.name, r.offset, err)
+	if r.issues == nil || r.issues.FailOnPartial {
+		return errors.New(detail)
+	}
+
+	fmt.Fprintf(os.Stderr, "Skipping input %s\n", detail)
+	r.issues.Add(issueUnreadable, detail)
+	return nil
+}
+
+// Unreadable input with its name and, when it broke while reading,
+// byte range which was skipped
+func unreadableDetail(name string, offset *offsetReader, err error) string {
+	detail := err.Error()
+	if !strings.Contains(detail, name) {
+		detail = name + ": " + detail
+	}
+	if offset != nil {
+		detail += " (" + offset.Skipped() + ")"
+	}
+	return detail
+}
+
+func (r *concatReader) closeCurrent() {
+	if r.closer != nil {
+		r.closer.Close()
+	}
+	r.current, r.closer, r.offset = nil, nil, nil
+}
+
+// Input counting bytes consumed from it, so rest of input which broke
+// while reading is reported as byte range. With ReadByte decompressors
+// read only what they need, so offset of broken gzip is exact.
+type offsetReader struct {
+	r      *bufio.Reader
+	offset int64
+
+	// Size of input, -1 when not known
+	size int64
+}
+
+func (o *offsetReader) Read(p []byte) (int, error) {
+	n, err := o.r.Read(p)
+	o.offset += int64(n)
+	return n, err
+}
+
+func (o *offsetReader) ReadByte() (byte, error) {
+	b, err := o.r.ReadByte()
+	if err == nil {
+		o.offset++
+	}
+	return b, err
+}
+
+// Skipped part of input once reading it failed
+func (o *offsetReader) Skipped() string {
+	switch {
+	case o.size < 0:
+		return fmt.Sprintf("bytes from %d skipped", o.offset)
+	case o.offset >= o.size:
+		return fmt.Sprintf("at end of its %d bytes, lines before were read", o.size)
+	}
+	return fmt.Sprintf("bytes %d-%d of %d skipped", o.offset, o.size, o.size)
+}
+
+// Opened input with offset of its bytes
+type openedInput struct {
+	io.Reader
+	io.Closer
+	offset *offsetReader
+}
+
+func (r *concatReader) Close() error {
+	r.closeCurrent()
+	return nil
+}
+
+// Opening inputs given as arguments: files, http(s) URLs or "-" for stdin.
+// Inputs are opened one by one while reading, files and URLs ending
+// with .gz are decompressed.
+func openInputs(names []string, issues *Issues) *concatReader {
+	r := &concatReader{issues: issues}
+	r.next = func() (io.Reader, error) {
+		if len(names) == 0 {
+			return nil, io.EOF
+		}
+		r.name, names = names[0], names[1:]
+
+		if r.index != nil {
+			if input, ok := openIndexed(r.name, r.index); ok {
+				return input, nil
+			}
+		}
+
+		input, err := openInput(r.name, issues)
+		if err != nil {
+			return nil, err
+		}
+		return input, nil
+	}
+	return r
+}
+
+// Opening one input, retries of URLs are recorded to issues
+func openInput(name string, issues *Issues) (io.ReadCloser, error) {
+	if name == "-" {
+		return io.NopCloser(os.Stdin), nil
+	}
+
+	var input io.ReadCloser
+	path := name
+
+	if strings.HasPrefix(name, "http://") || strings.HasPrefix(name, "https://") {
+		u, err := url.Parse(name)
+		if err != nil {
+			return nil, err
+		}
+		input, path = newHTTPReader(name, issues), u.Path
+	} else {
+		file, err := os.Open(name)
+		if err != nil {
+			return nil, err
+		}
+
+		// Binary record files are mapped and read as record stream
+		if isBinaryRecordFile(file) {
+			file.Close()
+			records, err := openBinaryRecords(name)
+			if err != nil {
+				return nil, err
+			}
+			return readCloser{newBinaryStream(records), records}, nil
+		}
+		input = file
+	}
+
+	offset := &offsetReader{r: bufio.NewReader(input), size: -1}
+	if file, ok := input.(*os.File); ok {
+		if info, err := file.Stat(); err == nil && info.Mode().IsRegular() {
+			offset.size = info.Size()
+		}
+	}
+	if !strings.HasSuffix(path, ".gz") {
+		return openedInput{offset, input, offset}, nil
+	}
+
+	gz, err := gzip.NewReader(offset)
+	if err != nil {
+		input.Close()
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return openedInput{gz, input, offset}, nil
+}
+
+// Reader closing underlying input
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// HTTP download retry settings
+const (
+	httpRetries    = 5
+	httpRetryDelay = time.Second
+	httpTimeout    = 30 * time.Second
+)
+
+// Streaming download of URL.
+// Interrupted downloads are resumed with Range requests, transient
+// failures (network errors, 429 and 5xx) are retried with backoff.
+type httpReader struct {
+	url    string
+	client *http.Client
+	body   io.ReadCloser
+
+	// Bytes read so far and validator of resumed content
+	offset    int64
+	validator string
+
+	// Failed attempts since last successful read
+	failures int
+
+	issues *Issues
+}
+
+func newHTTPReader(url string, issues *Issues) *httpReader {
+	// Compression is disabled so Range offsets match body bytes
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DisableCompression = true
+	transport.ResponseHeaderTimeout = httpTimeout
+
+	return &httpReader{url: url, client: &http.Client{Transport: transport}, issues: issues}
+}
+
+func (r *httpReader) Read(p []byte) (int, error) {
+	for {
+		if r.body == nil {
+			if err := r.open(); err != nil {
+				if !r.retry(err) {
+					return 0, fmt.Errorf("%s: %w", r.url, err)
+				}
+				continue
+			}
+		}
+
+		n, err := r.body.Read(p)
+		r.offset += int64(n)
+		if n > 0 {
+			r.failures = 0
+		}
+
+		if err == nil || err == io.EOF {
+			return n, err
+		}
+
+		// Connection broken, resume after returning data already read
+		r.body.Close()
+		r.body = nil
+		if !r.retry(err) {
+			return n, fmt.Errorf("%s: %w", r.url, err)
+		}
+		if n > 0 {
+			return n, nil
+		}
+	}
+}
+
+// Waiting before next attempt, false when attempts are exhausted
+func (r *httpReader) retry(err error) bool {
+	if _, ok := err.(permanentError); ok {
+		return false
+	}
+
+	r.failures++
+	if r.failures > httpRetries {
+		return false
+	}
+
+	delay := httpRetryDelay << (r.failures - 1)
+	fmt.Fprintf(os.Stderr, "Retrying %s in %v: %v\n", r.url, delay, err)
+	r.issues.Add(issueRetries, fmt.Sprintf("%s: %v", r.url, err))
+	time.Sleep(delay)
+	return true
+}
+
+// Error which is not fixed by retrying
+type permanentError struct {
+	error
+}
+
+// Requesting rest of content
+func (r *httpReader) open() error {
+	req, err := http.NewRequest(http.MethodGet, r.url, nil)
+	if err != nil {
+		return permanentError{err}
+	}
+
+	if r.offset > 0 {
+		req.Header.Set("Range", "bytes="+strconv.FormatInt(r.offset, 10)+"-")
+		if r.validator != "" {
+			req.Header.Set("If-Range", r.validator)
+		}
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusPartialContent && r.offset > 0:
+	case resp.StatusCode == http.StatusOK:
+		if r.offset > 0 && validatorOf(resp) != r.validator {
+			resp.Body.Close()
+			return permanentError{fmt.Errorf("content changed during download")}
+		}
+
+		// Range is not supported, skipping part read before
+		if r.offset > 0 {
+			if _, err := io.CopyN(io.Discard, resp.Body, r.offset); err != nil {
+				resp.Body.Close()
+				return err
+			}
+		}
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		resp.Body.Close()
+		return fmt.Errorf("%s", resp.Status)
+	default:
+		resp.Body.Close()
+		return permanentError{fmt.Errorf("%s", resp.Status)}
+	}
+
+	if r.offset == 0 {
+		r.validator = validatorOf(resp)
+	}
+
+	r.body = resp.Body
+	return nil
+}
+
+// Strong ETag or Last-Modified of response
+func validatorOf(resp *http.Response) string {
+	if etag := resp.Header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		return etag
+	}
+	return resp.Header.Get("Last-Modified")
+}
+
+func (r *httpReader) Close() error {
+	if r.body != nil {
+		return r.body.Close()
+	}
+	return nil
+}
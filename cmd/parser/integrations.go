@@ -0,0 +1,7 @@
+//go:build !minimal
+
+package main
+
+// Kafka, SQLite, ssh and SMTP integrations are built in, see
+// integrations_minimal.go for builds with -tags minimal
+const minimalBuild = false
@@ -0,0 +1,51 @@
+//go:build minimal
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+// Minimal build runs no other programs and sends no email, flags of
+// Kafka, SQLite, ssh and SMTP are rejected by checkBuild
+const minimalBuild = true
+
+type KafkaSpec struct{}
+
+func parseKafkaSpec(fields []string) (KafkaSpec, error) {
+	return KafkaSpec{}, errMinimal
+}
+
+func openKafka(spec KafkaSpec) (io.ReadCloser, error) {
+	return nil, errMinimal
+}
+
+func consumeMetrics(input io.Reader, accept func(string, int) (LogRecord, bool, error), every time.Duration, percentiles []float64, asJSON bool, locale Locale) error {
+	return errMinimal
+}
+
+func newSQLiteWriter(path string, lockTimeout time.Duration) (RecordWriter, error) {
+	return nil, errMinimal
+}
+
+func runQuery(args []string) error {
+	return fmt.Errorf("in query: %w", errMinimal)
+}
+
+func runStore(args []string) error {
+	return fmt.Errorf("in store: %w", errMinimal)
+}
+
+func openSSH(spec string, compress bool) (io.ReadCloser, error) {
+	return nil, errMinimal
+}
+
+func sendReport(cfg EmailConfig, metrics Metrics, records []LogRecord, locale Locale) error {
+	return errMinimal
+}
+
+func checkSMTP(cfg EmailConfig) error {
+	return errMinimal
+}
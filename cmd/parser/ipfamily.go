@@ -0,0 +1,58 @@
+package main
+
+import (
+	"net/netip"
+	"strings"
+)
+
+// Address of client written by proxies and middleware in other forms
+// than bare IP: PROXY protocol header ("PROXY TCP4 SRC DST SPORT
+// DPORT"), Forwarded element (for="[2001:db8::1]:443"), X-Forwarded-For
+// list (first one is client) and address with port
+func parseClientAddr(ip string) (netip.Addr, bool) {
+	s := strings.TrimSpace(ip)
+	if fields := strings.Fields(s); len(fields) >= 3 && fields[0] == "PROXY" && (fields[1] == "TCP4" || fields[1] == "TCP6") {
+		s = fields[2]
+	}
+	if first, _, ok := strings.Cut(s, ","); ok {
+		s = strings.TrimSpace(first)
+	}
+	if len(s) > 4 && strings.EqualFold(s[:4], "for=") {
+		s = s[4:]
+	}
+	s = strings.Trim(s, `"`)
+
+	if addr, err := netip.ParseAddr(strings.Trim(s, "[]")); err == nil {
+		return addr, true
+	}
+	if addrPort, err := netip.ParseAddrPort(s); err == nil {
+		return addrPort.Addr(), true
+	}
+	return netip.Addr{}, false
+}
+
+// Client IP of record, prefixed and port forms are reduced to bare IP
+// and other values are kept as they are. IPv4-mapped IPv6 addresses are
+// kept too, they are what application saw.
+func clientIP(ip string) string {
+	if _, err := netip.ParseAddr(ip); err == nil || ip == "" {
+		return ip
+	}
+	if addr, ok := parseClientAddr(ip); ok {
+		return addr.String()
+	}
+	return ip
+}
+
+// Address family of client (-group-by ip-family), IPv4-mapped IPv6
+// addresses of dual-stack sockets are IPv4 clients
+func ipFamily(ip string) string {
+	addr, ok := parseClientAddr(ip)
+	switch {
+	case !ok:
+		return "unknown"
+	case addr.Unmap().Is4():
+		return "ipv4"
+	}
+	return "ipv6"
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"text/tabwriter"
+)
+
+// Class of non-fatal issue with exit code of run where it happened
+type issueClass struct {
+	name        string
+	code        int
+	description string
+}
+
+// Issue classes by exit code. Codes identify class and are kept as
+// classes are added, they aren't ordered by severity: run exits with
+// highest code of its classes, summary lists all of them. Classes of
+// code 0 are notices, listed without making run partial.
+var (
+	issueSkippedLines = issueClass{"skipped_lines", 3, "lines not parsed as requests"}
+	issueRetries      = issueClass{"retries", 4, "inputs retried after transient failures"}
+	issueUnreadable   = issueClass{"unreadable_inputs", 5, "inputs skipped as unreadable"}
+	issueAlerts       = issueClass{"failed_alerts", 6, "alerts not delivered"}
+	issueRegressions  = issueClass{"regressions", 7, "routes regressed beyond baseline tolerance"}
+	issueThresholds   = issueClass{"violated_thresholds", 8, "thresholds of check violated"}
+	issueTruncated    = issueClass{"truncated_input", 9, "input ended early by -max-lines, -max-bytes or -max-runtime"}
+	issueOversized    = issueClass{"oversized_lines", 10, "lines longer than -max-line-size, truncated to it"}
+	issueConformance  = issueClass{"nonconforming_traffic", 11, "methods and routes outside -conformance allowlist"}
+	issueSilenced     = issueClass{"silenced_alerts", 0, "firing alerts not sent, matched by active silence"}
+
+	issueClasses = []issueClass{issueSilenced, issueSkippedLines, issueRetries, issueUnreadable, issueAlerts, issueRegressions, issueThresholds, issueTruncated, issueOversized, issueConformance}
+)
+
+// Supported -summary values
+var summaryFormats = []string{"text", "json"}
+
+// Details kept per issue class
+const issueDetails = 5
+
+// Non-fatal issues of run, reported at exit so automation can tell
+// partial success from clean run. Nil collector ignores issues.
+type Issues struct {
+	mu      sync.Mutex
+	counts  map[string]int
+	details map[string][]string
+
+	// Skipped lines are counted without lock, they are counted
+	// by parsing workers
+	skipped atomic.Int64
+
+	// Printing every skipped line (-report-errors)
+	ReportLines bool
+
+	// Failing on unreadable inputs instead of skipping them
+	// (-fail-on-partial)
+	FailOnPartial bool
+
+	// Input and its line number of line of merged inputs (-merge),
+	// nil when line numbers count lines of all inputs
+	locate func(number int) (string, int, bool)
+}
+
+// Summary of issues
+type IssueSummary struct {
+	Status   string        `json:"status"`
+	ExitCode int           `json:"exit_code"`
+	Issues   []IssueReport `json:"issues"`
+}
+
+// Issues of one class
+type IssueReport struct {
+	Class       string   `json:"class"`
+	ExitCode    int      `json:"exit_code"`
+	Description string   `json:"description"`
+	Count       int      `json:"count"`
+	Details     []string `json:"details,omitempty"`
+}
+
+func NewIssues() *Issues {
+	return &Issues{
+		counts:  make(map[string]int),
+		details: make(map[string][]string),
+	}
+}
+
+// Recording issue, first details of each class are kept
+func (i *Issues) Add(class issueClass, detail string) {
+	if i == nil {
+		return
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.counts[class.name]++
+	if len(i.details[class.name]) < issueDetails {
+		i.details[class.name] = append(i.details[class.name], detail)
+	}
+}
+
+// Line which is not request, with its number in input and
+// parse error. Input is named when inputs are merged.
+type lineError struct {
+	input  string
+	number int
+	line   string
+	err    error
+}
+
+func (e lineError) Error() string {
+	line := e.line
+	if len(line) > 120 {
+		line = line[:120] + "..."
+	}
+	if e.input != "" {
+		return fmt.Sprintf("%s line %d: %v: %s", e.input, e.number, e.err, line)
+	}
+	return fmt.Sprintf("line %d: %v: %s", e.number, e.err, line)
+}
+
+// Error of line, located in its input when inputs are merged
+func (i *Issues) lineError(number int, line string, err error) lineError {
+	e := lineError{number: number, line: line, err: err}
+	if i != nil && i.locate != nil {
+		if input, n, ok := i.locate(number); ok {
+			e.input, e.number = input, n
+		}
+	}
+	return e
+}
+
+// Checking is line expected in logs though not request, gin
+// debug lines and empty lines
+func ignoredLine(line string) bool {
+	return strings.TrimSpace(line) == "" || strings.HasPrefix(line, "[GIN-debug]")
+}
+
+// Counting line which is not request, ignored lines are not
+// counted. With ReportLines every line is printed to stderr.
+func (i *Issues) SkipLine(number int, line string, err error) {
+	if i == nil || ignoredLine(line) || errors.Is(err, errIgnoredLine) {
+		return
+	}
+
+	detail := i.lineError(number, line, err).Error()
+	if i.ReportLines {
+		fmt.Fprintf(os.Stderr, "Skipping %s\n", detail)
+	}
+
+	if i.skipped.Add(1) <= issueDetails {
+		i.mu.Lock()
+		i.details[issueSkippedLines.name] = append(i.details[issueSkippedLines.name], detail)
+		i.mu.Unlock()
+	}
+}
+
+// Summary of recorded issues by severity
+func (i *Issues) Summary() IssueSummary {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	summary := IssueSummary{Status: "clean", Issues: []IssueReport{}}
+	for _, class := range issueClasses {
+		count := i.counts[class.name]
+		if class == issueSkippedLines {
+			count = int(i.skipped.Load())
+		}
+		if count == 0 {
+			continue
+		}
+
+		if class.code > 0 {
+			summary.Status = "partial"
+			summary.ExitCode = class.code
+		}
+		summary.Issues = append(summary.Issues, IssueReport{
+			Class:       class.name,
+			ExitCode:    class.code,
+			Description: class.description,
+			Count:       count,
+			Details:     i.details[class.name],
+		})
+	}
+	return summary
+}
+
+// Printing summary to stderr, text summary only when there are
+// issues, returns exit code. Failed run (code is not 0) is reported
+// with status "failed" and keeps its code, so automation tells it
+// from partial run.
+func (i *Issues) Report(format string, code int) int {
+	summary := i.Summary()
+	if code != 0 {
+		summary.Status, summary.ExitCode = "failed", code
+	}
+
+	if format == "json" {
+		json.NewEncoder(os.Stderr).Encode(summary)
+		return summary.ExitCode
+	}
+
+	if len(summary.Issues) == 0 {
+		return summary.ExitCode
+	}
+
+	w := tabwriter.NewWriter(os.Stderr, 0, 0, 2, ' ', 0)
+	if code != 0 {
+		fmt.Fprintf(w, "Failed with issues (exit code %d)\n", summary.ExitCode)
+	} else {
+		fmt.Fprintf(w, "Finished with issues (exit code %d)\n", summary.ExitCode)
+	}
+	for _, r := range summary.Issues {
+		fmt.Fprintf(w, "%s\t%d\t%s\n", r.Class, r.Count, r.Description)
+		for _, detail := range r.Details {
+			fmt.Fprintf(w, "\t\t  %s\n", detail)
+		}
+	}
+	w.Flush()
+	return summary.ExitCode
+}
@@ -0,0 +1,278 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Output of job run kept for status, its last bytes
+const jobOutputTail = 4096
+
+// Scheduled job of config file: ginlog command line run every period
+type Job struct {
+	Name  string
+	Every time.Duration
+	Args  []string
+}
+
+// Loading jobs section of config file, written like presets with
+// every (period, runs are aligned to multiples of it), command
+// (stats by default) and input (files or URLs) besides flags:
+//
+//	jobs:
+//	  errors-hourly:
+//	    every: 1h
+//	    command: filter
+//	    input: /var/log/app.log
+//	    class: 5xx
+//	    o: /srv/reports/errors.log
+//
+// Flags are checked against command like flags of saved views.
+func loadJobs(path string) ([]Job, error) {
+	sections, err := loadFlagSections(path, "jobs")
+	if err != nil {
+		return nil, err
+	}
+	if len(sections) == 0 {
+		return nil, fmt.Errorf("%s has no jobs", path)
+	}
+
+	var jobs []Job
+	for _, name := range slices.Sorted(maps.Keys(sections)) {
+		job := Job{Name: name}
+		command := "stats"
+		var flags, inputs []string
+
+		for _, flag := range sections[name] {
+			switch flag.name {
+			case "every":
+				every, err := time.ParseDuration(flag.value)
+				if err != nil || every <= 0 {
+					return nil, fmt.Errorf("job %s: every must be positive duration, got %q", name, flag.value)
+				}
+				job.Every = every
+			case "command":
+				command = flag.value
+			case "input":
+				inputs = append(inputs, flag.value)
+			default:
+				flags = append(flags, "-"+flag.name+"="+flag.value)
+			}
+		}
+		if job.Every == 0 {
+			return nil, fmt.Errorf("job %s: every is missing", name)
+		}
+
+		if _, ok := findCommand(command); !ok {
+			return nil, fmt.Errorf("job %s: unknown command %q", name, command)
+		}
+		job.Args = append(strings.Fields(command), flags...)
+		if len(flags) > 0 {
+			if _, err := newView(name, job.Args); err != nil {
+				return nil, fmt.Errorf("job %s: %w", name, err)
+			}
+		}
+		if len(inputs) > 0 {
+			job.Args = append(append(job.Args, "--"), inputs...)
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, nil
+}
+
+// Status of job of admin API
+type JobStatus struct {
+	Name  string        `json:"name"`
+	Every time.Duration `json:"every"`
+	Args  []string      `json:"args"`
+
+	Running  bool      `json:"running"`
+	NextRun  time.Time `json:"next_run,omitzero"`
+	Runs     int       `json:"runs"`
+	Failures int       `json:"failures"`
+
+	// Last run, status is ok, issues (exit code 3 and above, see
+	// -summary) or failed, and last bytes of its output
+	LastStart    time.Time     `json:"last_start,omitzero"`
+	LastDuration time.Duration `json:"last_duration"`
+	LastExitCode int           `json:"last_exit_code"`
+	LastStatus   string        `json:"last_status,omitempty"`
+	LastOutput   string        `json:"last_output,omitempty"`
+}
+
+// Job with its status, runs of job never overlap
+type scheduledJob struct {
+	Job
+	status  JobStatus
+	trigger chan struct{}
+}
+
+// Jobs of config file run by one process (serve -jobs) instead of
+// cron entries. Each run is separate ginlog process, so jobs can't
+// affect each other or serve.
+type Scheduler struct {
+	executable string
+	mu         sync.Mutex
+	jobs       []*scheduledJob
+}
+
+func NewScheduler(jobs []Job) (*Scheduler, error) {
+	executable, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Scheduler{executable: executable}
+	for _, job := range jobs {
+		s.jobs = append(s.jobs, &scheduledJob{
+			Job:     job,
+			status:  JobStatus{Name: job.Name, Every: job.Every, Args: job.Args},
+			trigger: make(chan struct{}, 1),
+		})
+	}
+	return s, nil
+}
+
+// Running jobs in background
+func (s *Scheduler) Start() {
+	for _, job := range s.jobs {
+		go s.loop(job)
+	}
+}
+
+// Waiting for next multiple of period or run requested by API
+func (s *Scheduler) loop(job *scheduledJob) {
+	for {
+		next := time.Now().Truncate(job.Every).Add(job.Every)
+		s.mu.Lock()
+		job.status.NextRun = next
+		s.mu.Unlock()
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-timer.C:
+		case <-job.trigger:
+			timer.Stop()
+		}
+		s.run(job)
+	}
+}
+
+func (s *Scheduler) run(job *scheduledJob) {
+	start := time.Now()
+	s.mu.Lock()
+	job.status.Running = true
+	job.status.LastStart = start
+	s.mu.Unlock()
+
+	output := &tailBuffer{limit: jobOutputTail}
+	cmd := exec.Command(s.executable, job.Args...)
+	cmd.Stdout = output
+	cmd.Stderr = output
+	err := cmd.Run()
+
+	// Killed runs have exit code -1
+	code := 0
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			code = exitErr.ExitCode()
+		} else {
+			fmt.Fprintf(output, "%v\n", err)
+			code = 1
+		}
+	}
+
+	status := "ok"
+	switch {
+	case code >= 3:
+		status = "issues"
+	case code != 0:
+		status = "failed"
+	}
+
+	s.mu.Lock()
+	job.status.Running = false
+	job.status.Runs++
+	if status == "failed" {
+		job.status.Failures++
+	}
+	job.status.LastDuration = time.Since(start)
+	job.status.LastExitCode = code
+	job.status.LastStatus = status
+	job.status.LastOutput = output.String()
+	s.mu.Unlock()
+
+	fmt.Fprintf(os.Stderr, "Job %s %s (exit code %d) in %v\n", job.Name, status, code, time.Since(start).Round(time.Millisecond))
+}
+
+// Statuses of jobs by name
+func (s *Scheduler) Statuses() []JobStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	statuses := make([]JobStatus, len(s.jobs))
+	for i, job := range s.jobs {
+		statuses[i] = job.status
+	}
+	return statuses
+}
+
+// Registering admin API of jobs:
+//
+//	GET  /jobs             status of every job
+//	POST /jobs/{name}/run  run job now, once it isn't running
+func (s *Scheduler) Register(mux *http.ServeMux) {
+	mux.HandleFunc("GET /jobs", func(w http.ResponseWriter, r *http.Request) {
+		writeAPIJSON(w, s.Statuses())
+	})
+
+	mux.HandleFunc("POST /jobs/{name}/run", func(w http.ResponseWriter, r *http.Request) {
+		i := slices.IndexFunc(s.jobs, func(job *scheduledJob) bool { return job.Name == r.PathValue("name") })
+		if i < 0 {
+			http.NotFound(w, r)
+			return
+		}
+
+		select {
+		case s.jobs[i].trigger <- struct{}{}:
+		default:
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(map[string]string{"job": s.jobs[i].Name, "status": "queued"})
+	})
+}
+
+// Writer keeping last limit bytes written to it
+type tailBuffer struct {
+	mu    sync.Mutex
+	limit int
+	buf   []byte
+}
+
+func (b *tailBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.buf = append(b.buf, p...)
+	if len(b.buf) > b.limit {
+		b.buf = append(b.buf[:0], b.buf[len(b.buf)-b.limit:]...)
+	}
+	return len(p), nil
+}
+
+func (b *tailBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return string(b.buf)
+}
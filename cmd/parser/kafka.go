@@ -0,0 +1,211 @@
+//go:build !minimal
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Start offsets of consume without group
+var kafkaOffsets = []string{"beginning", "end", "stored"}
+
+// Topic to consume: -kafka "brokers=... topic=..." with optional
+// group, offset and librdkafka properties (security.protocol=SASL_SSL)
+type KafkaSpec struct {
+	Brokers    string
+	Topic      string
+	Group      string
+	Offset     string
+	Properties []string
+}
+
+// Parsing key=value fields of -kafka
+func parseKafkaSpec(fields []string) (KafkaSpec, error) {
+	spec := KafkaSpec{Offset: "end"}
+	for _, field := range fields {
+		key, value, ok := strings.Cut(field, "=")
+		if !ok || key == "" || value == "" {
+			return spec, fmt.Errorf("invalid %q (expected key=value)", field)
+		}
+		switch key {
+		case "brokers":
+			spec.Brokers = value
+		case "topic":
+			spec.Topic = value
+		case "group":
+			spec.Group = value
+		case "offset":
+			if !slices.Contains(kafkaOffsets, value) {
+				return spec, fmt.Errorf("unknown offset %q (supported: %s)", value, strings.Join(kafkaOffsets, ", "))
+			}
+			spec.Offset = value
+		default:
+			spec.Properties = append(spec.Properties, field)
+		}
+	}
+
+	if spec.Brokers == "" || spec.Topic == "" {
+		return spec, fmt.Errorf("brokers and topic are required (e.g. brokers=kafka1:9092,kafka2:9092 topic=gin-logs)")
+	}
+	return spec, nil
+}
+
+// Kafka client: kcat (or kafkacat of older distributions), or
+// $GINLOG_KCAT
+func kcatPath() (string, error) {
+	if path := os.Getenv("GINLOG_KCAT"); path != "" {
+		return path, nil
+	}
+	for _, name := range []string{"kcat", "kafkacat"} {
+		if path, err := exec.LookPath(name); err == nil {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("kcat not found, install it or set $GINLOG_KCAT")
+}
+
+// Arguments of kcat printing message values one per line. With group
+// partitions are balanced over consumers of group and offsets are
+// committed, so restarted consumer continues where it stopped.
+func (s KafkaSpec) kcatArgs() []string {
+	args := []string{"-b", s.Brokers, "-u", "-q", "-f", "%s\n"}
+	for _, property := range s.Properties {
+		args = append(args, "-X", property)
+	}
+
+	if s.Group != "" {
+		reset := "latest"
+		if s.Offset == "beginning" {
+			reset = "earliest"
+		}
+		return append(args, "-X", "auto.offset.reset="+reset, "-G", s.Group, s.Topic)
+	}
+	return append(args, "-C", "-t", s.Topic, "-o", s.Offset)
+}
+
+// Messages of topic streamed by kcat, reading ends only when kcat
+// exits. Like ssh, the system client is used, so the tool has no
+// Kafka library to keep up to date.
+type kafkaReader struct {
+	cmd    *exec.Cmd
+	stdout io.ReadCloser
+}
+
+func openKafka(spec KafkaSpec) (*kafkaReader, error) {
+	path, err := kcatPath()
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := exec.Command(path, spec.kcatArgs()...)
+	cmd.Stderr = os.Stderr
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	fmt.Fprintf(os.Stderr, "Consuming %s from %s\n", spec.Topic, spec.Brokers)
+	return &kafkaReader{cmd: cmd, stdout: stdout}, nil
+}
+
+// Reading messages, failure of kcat is reported at end of input
+func (r *kafkaReader) Read(p []byte) (int, error) {
+	n, err := r.stdout.Read(p)
+	if err == io.EOF {
+		if err := r.cmd.Wait(); err != nil {
+			return n, fmt.Errorf("kcat: %w", err)
+		}
+	}
+	return n, err
+}
+
+func (r *kafkaReader) Close() error {
+	r.stdout.Close()
+	if r.cmd.ProcessState == nil {
+		r.cmd.Process.Kill()
+		r.cmd.Wait()
+	}
+	return nil
+}
+
+// Metrics of one interval of consume
+type ConsumeWindow struct {
+	WindowStart time.Time `json:"window_start"`
+	WindowEnd   time.Time `json:"window_end"`
+	Metrics
+}
+
+// Printing metrics of consumed records every interval, as text or as
+// JSON line per interval. Intervals follow the clock, not record
+// timestamps, and empty intervals are printed too, so gaps of traffic
+// show. Metrics of last interval are printed when input ends or on
+// interrupt.
+func consumeMetrics(input io.Reader, accept func(string, int) (LogRecord, bool, error), every time.Duration, percentiles []float64, asJSON bool, locale Locale) error {
+	var mu sync.Mutex
+	start := time.Now()
+	metrics := NewMetricsAccumulator(start, percentiles)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- readRecords(input, 1, accept, func(record LogRecord) error {
+			mu.Lock()
+			defer mu.Unlock()
+			metrics.Add(record)
+			return nil
+		}, nil)
+	}()
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(interrupt)
+
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+
+	enc := json.NewEncoder(os.Stdout)
+	flush := func(end time.Time) error {
+		mu.Lock()
+		window := ConsumeWindow{WindowStart: start, WindowEnd: end, Metrics: metrics.Metrics()}
+		metrics = NewMetricsAccumulator(end, percentiles)
+		start = end
+		mu.Unlock()
+
+		if asJSON {
+			return enc.Encode(window)
+		}
+		fmt.Printf("Window: %s to %s\n", locale.FormatDateTime(window.WindowStart), locale.FormatDateTime(window.WindowEnd))
+		printMetrics(window.Metrics, locale)
+		fmt.Println()
+		return nil
+	}
+
+	for {
+		select {
+		case now := <-ticker.C:
+			if err := flush(now); err != nil {
+				return err
+			}
+		case err := <-done:
+			if flushErr := flush(time.Now()); err == nil {
+				err = flushErr
+			}
+			return err
+		case <-interrupt:
+			return flush(time.Now())
+		}
+	}
+}
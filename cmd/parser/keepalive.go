@@ -0,0 +1,239 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// Idle timeouts keep-alive reuse is estimated for
+var keepAliveTimeouts = []time.Duration{time.Second, 5 * time.Second, 15 * time.Second, 60 * time.Second, 75 * time.Second}
+
+// Buckets of requests per connection, by smallest size
+var keepAliveSizes = []struct {
+	label string
+	min   int
+}{{"1", 1}, {"2-5", 2}, {"6-20", 6}, {"21+", 21}}
+
+// Estimated connection of client, open until gap after its
+// last request is above idle gap
+type keepAliveConn struct {
+	end      time.Time
+	requests int
+}
+
+// Connections of all clients with one idle gap. Gin logs request
+// when it ends, so request starts at its time minus latency.
+// Concurrent requests of one IP need connections of their own.
+type keepAliveSim struct {
+	gap         time.Duration
+	clients     map[string][]*keepAliveConn
+	connections int
+	sizes       []int
+}
+
+func newKeepAliveSim(gap time.Duration) *keepAliveSim {
+	return &keepAliveSim{gap: gap, clients: make(map[string][]*keepAliveConn), sizes: make([]int, len(keepAliveSizes))}
+}
+
+// Adding request, true when it reused connection
+func (s *keepAliveSim) add(ip string, start, end time.Time) bool {
+	conns := s.clients[ip]
+
+	// Idle connection which ended last before request
+	var reuse *keepAliveConn
+	open := conns[:0]
+	for _, conn := range conns {
+		if start.Sub(conn.end) > s.gap {
+			s.close(conn)
+			continue
+		}
+		open = append(open, conn)
+		if !conn.end.After(start) && (reuse == nil || conn.end.After(reuse.end)) {
+			reuse = conn
+		}
+	}
+
+	if reuse == nil {
+		reuse = &keepAliveConn{}
+		open = append(open, reuse)
+		s.connections++
+	}
+	reuse.end = end
+	reuse.requests++
+	s.clients[ip] = open
+	return reuse.requests > 1
+}
+
+func (s *keepAliveSim) close(conn *keepAliveConn) {
+	for i := len(keepAliveSizes) - 1; i >= 0; i-- {
+		if conn.requests >= keepAliveSizes[i].min {
+			s.sizes[i]++
+			return
+		}
+	}
+}
+
+// Closing connections still open at end of input
+func (s *keepAliveSim) finish() {
+	for ip, conns := range s.clients {
+		for _, conn := range conns {
+			s.close(conn)
+		}
+		delete(s.clients, ip)
+	}
+}
+
+// Connections of requests per connection bucket
+type KeepAliveSize struct {
+	Requests    string `json:"requests"`
+	Connections int    `json:"connections"`
+}
+
+// Estimated connections with other idle timeout
+type KeepAliveTimeout struct {
+	Timeout       time.Duration `json:"timeout"`
+	Connections   int           `json:"connections"`
+	PerConnection float64       `json:"per_connection"`
+}
+
+// Keep-alive estimate
+type KeepAliveReport struct {
+	Gap           time.Duration `json:"gap"`
+	Requests      int           `json:"requests"`
+	Connections   int           `json:"connections"`
+	PerConnection float64       `json:"per_connection"`
+	Reused        int           `json:"reused"`
+
+	// Average latency of first requests of connections and of
+	// requests reusing connection
+	FirstLatency  time.Duration `json:"first_latency"`
+	ReusedLatency time.Duration `json:"reused_latency"`
+
+	Sizes    []KeepAliveSize    `json:"sizes"`
+	Timeouts []KeepAliveTimeout `json:"timeouts"`
+
+	// Timestamps are whole seconds, gaps are too coarse for
+	// sub-second idle gap and estimate is rough
+	SecondResolution bool `json:"second_resolution"`
+}
+
+// Keep-alive reuse estimated from request gaps per client IP.
+// Input is expected in time order, like logs of one instance.
+type KeepAlive struct {
+	now      time.Time
+	sim      *keepAliveSim
+	timeouts []*keepAliveSim
+
+	requests, reused      int
+	firstTime, reusedTime time.Duration
+	subsecond             bool
+}
+
+func NewKeepAlive(gap time.Duration, now time.Time) *KeepAlive {
+	k := &KeepAlive{now: now, sim: newKeepAliveSim(gap)}
+	for _, timeout := range keepAliveTimeouts {
+		k.timeouts = append(k.timeouts, newKeepAliveSim(timeout))
+	}
+	return k
+}
+
+// Adding record, records with implausible timestamps are skipped
+func (k *KeepAlive) Add(record LogRecord) {
+	if !plausibleTimestamp(record.Date, k.now) {
+		return
+	}
+	if record.Date.Nanosecond() != 0 {
+		k.subsecond = true
+	}
+
+	start := record.Date.Add(-record.Duration)
+	k.requests++
+	if k.sim.add(record.IP, start, record.Date) {
+		k.reused++
+		k.reusedTime += record.Duration
+	} else {
+		k.firstTime += record.Duration
+	}
+
+	for _, sim := range k.timeouts {
+		sim.add(record.IP, start, record.Date)
+	}
+}
+
+// Report of records added so far, closes connections
+func (k *KeepAlive) Report() KeepAliveReport {
+	k.sim.finish()
+
+	report := KeepAliveReport{
+		Gap:              k.sim.gap,
+		Requests:         k.requests,
+		Connections:      k.sim.connections,
+		Reused:           k.reused,
+		Sizes:            []KeepAliveSize{},
+		Timeouts:         []KeepAliveTimeout{},
+		SecondResolution: k.requests > 0 && !k.subsecond,
+	}
+	perConnection := func(connections int) float64 {
+		if connections == 0 {
+			return 0
+		}
+		return float64(k.requests) / float64(connections)
+	}
+	report.PerConnection = perConnection(report.Connections)
+
+	if first := k.requests - k.reused; first > 0 {
+		report.FirstLatency = k.firstTime / time.Duration(first)
+	}
+	if k.reused > 0 {
+		report.ReusedLatency = k.reusedTime / time.Duration(k.reused)
+	}
+
+	for i, size := range keepAliveSizes {
+		report.Sizes = append(report.Sizes, KeepAliveSize{Requests: size.label, Connections: k.sim.sizes[i]})
+	}
+	for _, sim := range k.timeouts {
+		report.Timeouts = append(report.Timeouts, KeepAliveTimeout{
+			Timeout:       sim.gap,
+			Connections:   sim.connections,
+			PerConnection: perConnection(sim.connections),
+		})
+	}
+	return report
+}
+
+// Keep-alive output
+func printKeepAlive(report KeepAliveReport, locale Locale) {
+	fmt.Printf("Keep-alive estimate, requests of IP less than %v apart share connection:\n\n", report.Gap)
+	if report.SecondResolution {
+		fmt.Printf("Timestamps have second resolution, gaps below it are guessed and estimate is rough\n(JSON logs with sub-second time give better estimate)\n\n")
+	}
+
+	fmt.Printf("Requests: %s\n", locale.Int(report.Requests))
+	fmt.Printf("Connections: %s\n", locale.Int(report.Connections))
+	fmt.Printf("Requests/connection: %s\n", locale.Float(report.PerConnection, 2))
+	if report.Requests == 0 {
+		return
+	}
+	fmt.Printf("Reusing connection: %s (%s)\n", locale.Int(report.Reused), locale.Percent(float64(report.Reused)/float64(report.Requests)))
+
+	if report.Reused > 0 && report.FirstLatency > 0 {
+		change := float64(report.ReusedLatency-report.FirstLatency) / float64(report.FirstLatency)
+		fmt.Printf("Avg latency: first request %s, reusing %s (%s)\n",
+			locale.Duration(report.FirstLatency), locale.Duration(report.ReusedLatency), signed(locale.Percent(change), change))
+	}
+
+	w := newTable(os.Stdout)
+	fmt.Fprintf(w, "\nREQUESTS/CONN\tCONNECTIONS\n")
+	for _, size := range report.Sizes {
+		fmt.Fprintf(w, "%s\t%s\n", size.Requests, locale.Int(size.Connections))
+	}
+	w.Flush()
+
+	w = newTable(os.Stdout)
+	fmt.Fprintf(w, "\nIDLE TIMEOUT\tCONNECTIONS\tREQUESTS/CONN\n")
+	for _, t := range report.Timeouts {
+		fmt.Fprintf(w, "%v\t%s\t%s\n", t.Timeout, locale.Int(t.Connections), locale.Float(t.PerConnection, 2))
+	}
+	w.Flush()
+}
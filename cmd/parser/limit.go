@@ -0,0 +1,61 @@
+package main
+
+// Record writer skipping first offset records and passing at most
+// limit records after them, zero limit passes all
+type limitWriter struct {
+	w      RecordWriter
+	offset int
+	limit  int
+	seen   int
+}
+
+func newLimitWriter(w RecordWriter, offset, limit int) *limitWriter {
+	return &limitWriter{w: w, offset: offset, limit: limit}
+}
+
+func (w *limitWriter) Write(record LogRecord) error {
+	w.seen++
+	if w.seen <= w.offset {
+		return nil
+	}
+	if w.limit > 0 && w.seen > w.offset+w.limit {
+		return nil
+	}
+	return w.w.Write(record)
+}
+
+func (w *limitWriter) Close() error {
+	return w.w.Close()
+}
+
+// Record writer passing only last n records, they are written on close
+type tailWriter struct {
+	w       RecordWriter
+	records []LogRecord
+	next    int
+}
+
+func newTailWriter(w RecordWriter, n int) *tailWriter {
+	return &tailWriter{w: w, records: make([]LogRecord, 0, n)}
+}
+
+func (w *tailWriter) Write(record LogRecord) error {
+	if len(w.records) < cap(w.records) {
+		w.records = append(w.records, record)
+		return nil
+	}
+
+	// Ring buffer is full, oldest record is overwritten
+	w.records[w.next] = record
+	w.next = (w.next + 1) % len(w.records)
+	return nil
+}
+
+func (w *tailWriter) Close() error {
+	for i := range w.records {
+		if err := w.w.Write(w.records[(w.next+i)%len(w.records)]); err != nil {
+			return err
+		}
+	}
+	return w.w.Close()
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Default of -max-line-size
+const defaultMaxLineSize = 1 << 20
+
+// Longest line kept whole (-max-line-size) and collector of longer
+// ones, set once before input is read
+var (
+	maxLineSize = defaultMaxLineSize
+	lineIssues  *Issues
+)
+
+func setMaxLineSize(size int64, issues *Issues) {
+	maxLineSize = int(size)
+	lineIssues = issues
+}
+
+// Reader of input lines of bounded length. Line longer than
+// maxLineSize (huge query string, dumped headers) is truncated to it
+// and rest of it is dropped, so memory stays bounded and prefix of
+// line, which has everything but end of URL in gin format, is still
+// parsed. Truncated lines are counted as issues.
+type lineReader struct {
+	r      *bufio.Reader
+	buf    []byte
+	number int
+}
+
+func newLineReader(input io.Reader) *lineReader {
+	return &lineReader{r: bufio.NewReader(input)}
+}
+
+// Next line without line end, and input bytes it had. io.EOF is
+// returned after last line.
+func (l *lineReader) ReadLine() (string, int64, error) {
+	l.buf = l.buf[:0]
+	var size int64
+	for {
+		chunk, err := l.r.ReadSlice('\n')
+		size += int64(len(chunk))
+		if room := maxLineSize + 2 - len(l.buf); room > 0 {
+			l.buf = append(l.buf, chunk[:min(len(chunk), room)]...)
+		}
+
+		if errors.Is(err, bufio.ErrBufferFull) {
+			continue
+		}
+		if err != nil && (err != io.EOF || size == 0) {
+			return "", size, err
+		}
+		break
+	}
+	l.number++
+
+	line := strings.TrimSuffix(strings.TrimSuffix(string(l.buf), "\n"), "\r")
+	if len(line) > maxLineSize {
+		line = line[:maxLineSize]
+		lineIssues.Add(issueOversized, fmt.Sprintf("line %d: %s truncated to %s: %s...", l.number, formatBytes(size), formatBytes(int64(maxLineSize)), line[:min(len(line), 120)]))
+	}
+	return line, size, nil
+}
+
+// Checking is more input buffered, so reading next line won't block
+func (l *lineReader) Buffered() bool {
+	return l.r.Buffered() > 0
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Field of records tagged as synthetic traffic of load test
+const loadTestField = "load_test"
+
+// Load test, window of schedule and/or expression matching its
+// requests (e.g. user agent of load generator)
+type LoadTest struct {
+	Label      string
+	Start, End time.Time
+	where      Expr
+}
+
+// Load tests of -load-tests. Their requests are tagged with load_test
+// field and left out of reports they would distort: anomalies, alert
+// rules and availability, so load tests don't page on-call. Windows
+// are marked in time based reports like annotations.
+type LoadTests struct {
+	tests []LoadTest
+
+	// Excluded requests per report and labels of their load tests
+	excluded map[string]int
+	labels   map[string]bool
+}
+
+// Loading load tests from JSON file or http(s) URL. Input is an array
+// like [{"label": "k6 checkout", "start": "2024-05-01T10:00:00Z",
+// "end": "2024-05-01T10:30:00Z", "where": "field(\"user_agent\") =~ \"k6\""}],
+// start and end accept the same formats as -from. Test needs window,
+// expression or both.
+func loadLoadTests(source string, now time.Time) (*LoadTests, error) {
+	data, err := readSource(source)
+	if err != nil {
+		return nil, err
+	}
+
+	var decoded []struct {
+		Label string `json:"label"`
+		Start string `json:"start"`
+		End   string `json:"end"`
+		Where string `json:"where"`
+	}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return nil, fmt.Errorf("%s: %w", source, err)
+	}
+
+	l := &LoadTests{excluded: make(map[string]int), labels: make(map[string]bool)}
+	for i, d := range decoded {
+		test := LoadTest{Label: d.Label}
+		if test.Label == "" {
+			test.Label = fmt.Sprintf("load test %d", i+1)
+		}
+		if (d.Start == "") != (d.End == "") {
+			return nil, fmt.Errorf("%s: load test %d: window needs both start and end", source, i+1)
+		}
+		if d.Start != "" {
+			if test.Start, err = parseTimestamp(d.Start, now); err == nil {
+				test.End, err = parseTimestamp(d.End, now)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("%s: load test %d: %w", source, i+1, err)
+			}
+			if !test.End.After(test.Start) {
+				return nil, fmt.Errorf("%s: load test %d: end must be after start", source, i+1)
+			}
+		}
+		if d.Where != "" {
+			test.where, err = parseExpr(d.Where, recordEnv{})
+			if err == nil {
+				err = checkBoolean(test.where, recordEnv{})
+			}
+			if err != nil {
+				return nil, fmt.Errorf("%s: load test %d: where: %w", source, i+1, err)
+			}
+		}
+		if d.Start == "" && d.Where == "" {
+			return nil, fmt.Errorf("%s: load test %d: needs start and end, where or both", source, i+1)
+		}
+		l.tests = append(l.tests, test)
+	}
+	return l, nil
+}
+
+// Tagging record of first load test it belongs to, start of window is
+// inclusive and end exclusive
+func (l *LoadTests) Tag(record *LogRecord) bool {
+	for _, test := range l.tests {
+		if !test.Start.IsZero() && (record.Date.Before(test.Start) || !record.Date.Before(test.End)) {
+			continue
+		}
+		if test.where != nil && !exprMatches(test.where, recordEnv(*record)) {
+			continue
+		}
+		if record.Fields == nil {
+			record.Fields = make(map[string]string)
+		}
+		record.Fields[loadTestField] = test.Label
+		return true
+	}
+	return false
+}
+
+// Windows of load tests as annotations of their start and end
+func (l *LoadTests) Annotations() []Annotation {
+	var annotations []Annotation
+	for _, test := range l.tests {
+		if !test.Start.IsZero() {
+			annotations = append(annotations,
+				Annotation{Time: test.Start, Label: test.Label + " started"},
+				Annotation{Time: test.End, Label: test.Label + " ended"})
+		}
+	}
+	return annotations
+}
+
+// Adding only records of real traffic to report, requests of load
+// tests are counted as excluded
+func (l *LoadTests) Exclude(report string, add func(LogRecord) error) func(LogRecord) error {
+	return func(record LogRecord) error {
+		if label := record.Fields[loadTestField]; label != "" {
+			l.excluded[report]++
+			l.labels[label] = true
+			return nil
+		}
+		return add(record)
+	}
+}
+
+// Requests excluded per report
+func (l *LoadTests) Report(w io.Writer, locale Locale) {
+	if len(l.excluded) == 0 {
+		return
+	}
+	labels := strings.Join(slices.Sorted(maps.Keys(l.labels)), ", ")
+	for _, report := range slices.Sorted(maps.Keys(l.excluded)) {
+		fmt.Fprintf(w, "Excluded %s requests of load tests (%s) from %s\n", locale.Int(l.excluded[report]), labels, report)
+	}
+}
+
+// Sink with records added through other function, e.g. one excluding
+// load tests
+type excludingSink struct {
+	Sink
+	add func(LogRecord) error
+}
+
+func (s excludingSink) Add(record LogRecord) error {
+	return s.add(record)
+}
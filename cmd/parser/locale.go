@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Number and time formatting rules for human-readable output
+type Locale struct {
+	Name     string
+	Decimal  string
+	Group    string
+	Date     string
+	DateTime string
+}
+
+// Known locales.
+// Default locale keeps Go formatting, so output without -locale
+// stays stable for scripts.
+var locales = []Locale{
+	{Name: "en-US", Decimal: ".", Group: ",", Date: "01/02/2006", DateTime: "01/02/2006 3:04:05 PM"},
+	{Name: "en-GB", Decimal: ".", Group: ",", Date: "02/01/2006", DateTime: "02/01/2006 15:04:05"},
+	{Name: "de-DE", Decimal: ",", Group: ".", Date: "02.01.2006", DateTime: "02.01.2006 15:04:05"},
+	{Name: "fr-FR", Decimal: ",", Group: " ", Date: "02/01/2006", DateTime: "02/01/2006 15:04:05"},
+	{Name: "es-ES", Decimal: ",", Group: ".", Date: "02/01/2006", DateTime: "02/01/2006 15:04:05"},
+	{Name: "it-IT", Decimal: ",", Group: ".", Date: "02/01/2006", DateTime: "02/01/2006 15:04:05"},
+	{Name: "nl-NL", Decimal: ",", Group: ".", Date: "02-01-2006", DateTime: "02-01-2006 15:04:05"},
+	{Name: "pt-BR", Decimal: ",", Group: ".", Date: "02/01/2006", DateTime: "02/01/2006 15:04:05"},
+	{Name: "ru-RU", Decimal: ",", Group: " ", Date: "02.01.2006", DateTime: "02.01.2006 15:04:05"},
+	{Name: "ja-JP", Decimal: ".", Group: ",", Date: "2006/01/02", DateTime: "2006/01/02 15:04:05"},
+}
+
+// Getting locale by name, empty name means default formatting
+func findLocale(name string) (Locale, error) {
+	if name == "" {
+		return Locale{}, nil
+	}
+
+	i := slices.IndexFunc(locales, func(l Locale) bool {
+		return strings.EqualFold(l.Name, strings.ReplaceAll(name, "_", "-"))
+	})
+	if i < 0 {
+		names := make([]string, len(locales))
+		for n, l := range locales {
+			names[n] = l.Name
+		}
+		return Locale{}, fmt.Errorf("unknown locale %q (supported: %s)", name, strings.Join(names, ", "))
+	}
+
+	return locales[i], nil
+}
+
+// Integer formatting with digit grouping
+func (l Locale) Int(n int) string {
+	s := strconv.Itoa(n)
+	if l.Name == "" {
+		return s
+	}
+
+	sign := ""
+	if n < 0 {
+		sign, s = "-", s[1:]
+	}
+
+	var b strings.Builder
+	for i, c := range s {
+		if i > 0 && (len(s)-i)%3 == 0 {
+			b.WriteString(l.Group)
+		}
+		b.WriteRune(c)
+	}
+
+	return sign + b.String()
+}
+
+// Float formatting with fixed precision
+func (l Locale) Float(f float64, prec int) string {
+	s := strconv.FormatFloat(f, 'f', prec, 64)
+	if l.Name == "" {
+		return s
+	}
+
+	whole, frac, _ := strings.Cut(s, ".")
+	n, _ := strconv.Atoi(whole)
+
+	out := l.Int(n)
+	if n == 0 && strings.HasPrefix(whole, "-") {
+		out = "-" + out
+	}
+	if frac != "" {
+		out += l.Decimal + frac
+	}
+
+	return out
+}
+
+// Percent formatting of ratio
+func (l Locale) Percent(ratio float64) string {
+	return l.Float(ratio*100, 2) + "%"
+}
+
+// Duration formatting
+func (l Locale) Duration(d time.Duration) string {
+	if l.Name == "" {
+		return d.String()
+	}
+
+	switch {
+	case d < time.Microsecond:
+		return l.Int(int(d)) + "ns"
+	case d < time.Millisecond:
+		return l.Float(float64(d)/float64(time.Microsecond), 3) + "µs"
+	case d < time.Second:
+		return l.Float(float64(d)/float64(time.Millisecond), 3) + "ms"
+	}
+
+	return l.Float(d.Seconds(), 3) + "s"
+}
+
+// Date formatting
+func (l Locale) FormatDate(t time.Time) string {
+	if l.Name == "" {
+		return t.Format("2006/01/02")
+	}
+	return t.Format(l.Date)
+}
+
+// Date and time formatting
+func (l Locale) FormatDateTime(t time.Time) string {
+	if l.Name == "" {
+		return t.Format("2006/01/02 - 15:04:05")
+	}
+	return t.Format(l.DateTime)
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// Lock files not refreshed for this long are left by killed
+// processes and are taken over
+const lockStale = 10 * time.Minute
+
+// First and maximal wait between lock attempts
+const (
+	lockBackoff    = 50 * time.Millisecond
+	lockMaxBackoff = 2 * time.Second
+)
+
+// Cooperative lock of file shared by parallel runs (cron jobs,
+// agents), held as path.lock created exclusively, so it works on
+// every platform. Lock file holds owner with time it was taken, so
+// owner is recognized when lock was taken over. Returns function
+// releasing lock.
+func lockPath(path string, timeout time.Duration) (func(), error) {
+	lock := path + ".lock"
+	deadline := time.Now().Add(timeout)
+	backoff := lockBackoff
+
+	host, _ := os.Hostname()
+	owner := fmt.Sprintf("pid %d on %s\n%d\n", os.Getpid(), host, time.Now().UnixNano())
+	owned := func() bool {
+		data, err := os.ReadFile(lock)
+		return err == nil && string(data) == owner
+	}
+
+	for {
+		file, err := os.OpenFile(lock, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+		if err == nil {
+			_, err = file.WriteString(owner)
+			file.Close()
+			if err != nil {
+				os.Remove(lock)
+				return nil, err
+			}
+
+			// Waiter taking over stale lock may have moved it meanwhile
+			if !owned() {
+				continue
+			}
+
+			// Long runs keep lock fresh, so it isn't taken as stale
+			done := make(chan struct{})
+			go func() {
+				ticker := time.NewTicker(lockStale / 10)
+				defer ticker.Stop()
+				for {
+					select {
+					case now := <-ticker.C:
+						if owned() {
+							os.Chtimes(lock, now, now)
+						}
+					case <-done:
+						return
+					}
+				}
+			}()
+
+			return func() {
+				close(done)
+				if owned() {
+					os.Remove(lock)
+				}
+			}, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, err
+		}
+
+		if info, err := os.Stat(lock); err == nil && time.Since(info.ModTime()) > lockStale {
+			takeOverLock(lock)
+			continue
+		}
+
+		if !time.Now().Before(deadline) {
+			holder, _ := os.ReadFile(lock)
+			first, _, _ := strings.Cut(string(holder), "\n")
+			return nil, fmt.Errorf("%s is locked by %s (waited %v, see -lock-timeout)", path, first, timeout)
+		}
+
+		time.Sleep(min(backoff, time.Until(deadline)))
+		backoff = min(backoff*2, lockMaxBackoff)
+	}
+}
+
+// Removing stale lock. Lock is renamed to unique name first, so of
+// waiters seeing it stale only one removes it. Lock renamed after
+// other waiter has already taken it over is fresh and is put back,
+// unless yet another run has taken lock since.
+func takeOverLock(lock string) {
+	stale := fmt.Sprintf("%s.stale-%d-%d", lock, os.Getpid(), time.Now().UnixNano())
+	if err := os.Rename(lock, stale); err != nil {
+		return
+	}
+	if info, err := os.Stat(stale); err == nil && time.Since(info.ModTime()) <= lockStale {
+		os.Link(stale, lock)
+	}
+	os.Remove(stale)
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"fmt"
+	"runtime/debug"
+)
+
+// Soft memory limit of -low-memory, garbage is collected more
+// often as heap gets close to it
+const lowMemoryLimit = 40 << 20
+
+// Checking options keeping every record, which can't have
+// bounded memory
+func validLowMemory(o *Options) error {
+	switch {
+	case o.SortBy != "":
+		return fmt.Errorf("can't be combined with -sort, it keeps all records")
+	case o.SplitAt != "":
+		return fmt.Errorf("can't be combined with -split-at, it keeps all durations")
+	case o.EmailTo != "":
+		return fmt.Errorf("can't be combined with -email-to, it keeps records for attachment")
+	}
+	return nil
+}
+
+// Lowering memory use for small devices: percentiles come from
+// sketch only, input is parsed in one goroutine in small chunks
+// and Parquet row groups are smaller
+func setLowMemory(o *Options) {
+	o.Workers = 1
+	exactLimit = 0
+	chunkLines = 256
+	parquetRowGroup = 10000
+	debug.SetMemoryLimit(lowMemoryLimit)
+}
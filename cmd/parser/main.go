@@ -1,272 +1,1851 @@
 package main
 
 import (
-	"bufio"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"os"
-	"strconv"
+	"os/exec"
+	"slices"
 	"strings"
+	"text/template"
 	"time"
-	"encoding/json"
 )
 
-// Struct of log record
-type LogRecord struct {
-	Date     time.Time     `json:"date"`
-	Code     int           `json:"code"`
-	Duration time.Duration `json:"duration"`
-	IP       string        `json:"ip"`
-	Method   string        `json:"method"`
-	URL      string        `json:"url"`
-}
+func main() {
+	if len(os.Args) > 1 && os.Args[1] == "self-update" {
+		if err := selfUpdate(os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "Error %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
 
-// Struct of metrics
-type Metrics struct {
-	Count        int `json:"count"`
-	TotalTime    time.Duration
-	MinTime      time.Duration
-	MaxTime      time.Duration
-	StatusCounts map[int]int
-}
+	if len(os.Args) > 1 && os.Args[1] == "query" {
+		if err := runQuery(os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "Error %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
 
-func main() {
-	// Filters
-	var method, date, url, ip string
-	var code int
+	if len(os.Args) > 1 && os.Args[1] == "store" {
+		if err := runStore(os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "Error %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
 
-	// Output modes
-	var raw bool
-	var json bool
+	if len(os.Args) > 1 && os.Args[1] == "devserver" {
+		if err := runDevServer(os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "Error %v\n", err)
+			os.Exit(exitCode(err))
+		}
+		return
+	}
 
-	// Flag parsing
-	flag.StringVar(&method, "method", "", "HTTP method to filter")
-	flag.IntVar(&code, "code", 0, "Status code to filter")
-	flag.StringVar(&date, "date", "", "Date to filter (format: YYYY/MM/DD)")
-	flag.StringVar(&url, "url", "", "URL path to filter")
-	flag.StringVar(&ip, "ip", "", "IP address to filter")
-	flag.BoolVar(&raw, "raw", false, "Output filtered logs instead of statistics")
-	flag.BoolVar(&json, "json", false, "Output logs in JSON format")
-	flag.Parse()
+	if len(os.Args) > 1 && os.Args[1] == "config" {
+		if err := runConfig(os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "Error %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
 
-	// Scanning input and parsing logs
-	scanner := bufio.NewScanner(os.Stdin)
-	var records []LogRecord
+	// "ginlog view run NAME" is replaced with command and flags of view
+	if len(os.Args) > 1 && os.Args[1] == "view" {
+		args, err := runView(os.Args[2:])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error %v\n", err)
+			os.Exit(1)
+		}
+		if args == nil {
+			return
+		}
+		os.Args = append(os.Args[:1], args...)
+	}
 
-	for scanner.Scan() {
-		line := scanner.Text()
-		record, err := parseLine(line)
+	// "ginlog resume CHECKPOINT" is replaced with command line of
+	// interrupted export skipping records it sent
+	if len(os.Args) > 1 && os.Args[1] == "resume" {
+		args, err := resumeCommandLine(os.Args[2:])
 		if err != nil {
-			continue
+			fmt.Fprintf(os.Stderr, "Error %v\n", err)
+			os.Exit(1)
 		}
+		os.Args = append(os.Args[:1], args...)
+	}
 
-		if !matchesFilter(record, method, code, date, url, ip) {
-			continue
+	// Presets of config file are replaced with their flags
+	args, err := expandPresets(os.Args[1:])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error in -preset: %v\n", err)
+		os.Exit(2)
+	}
+	os.Args = append(os.Args[:1], args...)
+	if err := scanDefaultDurationUnit(os.Args[1:]); err != nil {
+		fmt.Fprintf(os.Stderr, "Error in %v\n", err)
+		os.Exit(2)
+	}
+
+	// "ginlog ssh user@host:/path [flags]" is a shortcut of -ssh
+	if len(os.Args) > 2 && os.Args[1] == "ssh" {
+		os.Args = append([]string{os.Args[0], "-ssh", os.Args[2]}, os.Args[3:]...)
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "capabilities" {
+		var o Options
+		o.legacyFlags(flag.CommandLine)
+		if err := printCapabilities(flag.CommandLine, os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "Error %v\n", err)
+			os.Exit(1)
 		}
+		return
+	}
 
-		records = append(records, record)
+	o, args := parseCommandLine(os.Args[1:])
+
+	if o.Append && o.OutputFile == "" {
+		fmt.Fprintf(os.Stderr, "Error in -append: needs -o\n")
+		os.Exit(2)
+	}
+	if o.Append && o.FormatName == "binary" {
+		fmt.Fprintf(os.Stderr, "Error in -append: binary record files can't be appended to, write one file per run\n")
+		os.Exit(2)
 	}
 
-	if err := scanner.Err(); err != nil {
-		fmt.Fprintf(os.Stderr, "Error reading input: %v\n", err)
-		os.Exit(1)
+	if !slices.Contains(summaryFormats, o.Summary) {
+		fmt.Fprintf(os.Stderr, "Error in -summary: unknown format %q (supported: %s)\n", o.Summary, strings.Join(summaryFormats, ", "))
+		os.Exit(2)
 	}
 
-	// Output
-	if json {
-		printJSON(records)
-		os.Exit(0)
+	// Non-fatal issues change exit code of otherwise successful run
+	issues := NewIssues()
+
+	// Destinations are checked and writes are only counted, dry run is
+	// reported once output is counted too
+	var dryRun *DryRun
+	if o.DryRun {
+		dryRun = NewDryRun()
+	}
+
+	if o.OutputFile == "" {
+		code := run(o, args, issues, dryRun)
+		if code == 0 {
+			code = reportDryRun(dryRun)
+		}
+		os.Exit(issues.Report(o.Summary, code))
+	}
+
+	if o.FollowFile != "" || o.ServeAddr != "" || o.ListenSyslog != "" {
+		fmt.Fprintf(os.Stderr, "Error in -o: can't be combined with -follow, -serve or -listen-syslog\n")
+		os.Exit(2)
+	}
+
+	if dryRun != nil {
+		code := runDryRunOutput(o, args, issues, dryRun)
+		if code == 0 {
+			code = reportDryRun(dryRun)
+		}
+		os.Exit(issues.Report(o.Summary, code))
 	}
 
-	if raw {
-		printRaw(records)
-		os.Exit(0)
+	// Parallel runs appending to same file take turns, otherwise
+	// output appended by one of them would be lost
+	unlock := func() {}
+	if o.Append {
+		var err error
+		if unlock, err = lockPath(o.OutputFile, o.LockTimeout); err != nil {
+			fmt.Fprintf(os.Stderr, "Error opening output: %v\n", err)
+			os.Exit(issues.Report(o.Summary, 1))
+		}
+	}
+
+	// Output goes to temp file replacing target only when everything is written
+	out, err := createAtomic(o.OutputFile, o.Append)
+	if err != nil {
+		unlock()
+		fmt.Fprintf(os.Stderr, "Error opening output: %v\n", err)
+		os.Exit(issues.Report(o.Summary, 1))
 	}
 
-	metrics := calculateMetrics(records)
-	printMetrics(metrics)
+	stdout := os.Stdout
+	os.Stdout = out.File()
+	code := run(o, args, issues, dryRun)
+	os.Stdout = stdout
+
+	// Failed run leaves target as it was
+	if code != 0 {
+		out.Abort()
+		unlock()
+		os.Exit(issues.Report(o.Summary, code))
+	}
+
+	err = out.Commit()
+	unlock()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing output: %v\n", err)
+		code = 1
+	}
+	os.Exit(issues.Report(o.Summary, code))
+}
+
+// Invalid flag of subcommand, exit code 2 like flags of run
+type flagError struct {
+	flag string
+	err  error
 }
 
-// Line parsing
-func parseLine(line string) (LogRecord, error) {
-	if !strings.HasPrefix(line, "[GIN]") {
-		return LogRecord{}, fmt.Errorf("invalid format")
+func (e flagError) Error() string {
+	return fmt.Sprintf("in %s: %v", e.flag, e.err)
+}
+
+// Exit code of failed subcommand
+func exitCode(err error) int {
+	if errors.As(err, new(flagError)) {
+		return 2
+	}
+	return 1
+}
+
+// Running command with parsed options, output goes to stdout
+// and non-fatal issues to collector, writes of -dry-run to dryRun.
+// Returns exit code of failed run, so callers release locks and temp
+// files before exiting.
+func run(o *Options, args []string, issues *Issues, dryRun *DryRun) int {
+	now := time.Now()
+	issues.ReportLines = o.ReportErrors
+	issues.FailOnPartial = o.FailOnPartial
+	setColor(o.NoColor, o.Slow)
+	setTableWidth(o.MaxWidth, o.NoTruncate)
+
+	if err := o.checkBuild(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error %v\n", err)
+		return 2
+	}
+
+	filter := Filter{
+		Method: o.Method,
+		Code:   o.Code,
+		Date:   o.Date,
+		URL:    o.URL,
+		IP:     o.IP,
+
+		URLPrefix: o.URLPrefix,
+		URLRegex:  o.URLRegex,
+		Class:     o.Class,
+		Param:     o.Param,
+
+		MinDuration: o.MinDuration,
+		MaxDuration: o.MaxDuration,
+		Expr:        o.FilterExpr,
+		Where:       o.Where,
+	}
+
+	if err := filter.Compile(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error in filter: %v\n", err)
+		return 2
+	}
+
+	lineFormat, err := findFormat(o.Pattern)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error in -pattern: %v\n", err)
+		return 2
+	}
+
+	lineFormat, err = findInputFormat(o.InputFormat, lineFormat)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error in -input: %v\n", err)
+		return 2
 	}
 
-	parts := strings.Split(line, "|")
-	if len(parts) != 5 {
-		return LogRecord{}, fmt.Errorf("invalid format")
+	// Container envelope is removed first, so its timestamp is kept
+	if o.ContainerTime {
+		lineFormat = containerFormat{inner: lineFormat, runtimeTime: true}
 	}
 
-	datePart := strings.TrimSpace(parts[0])
-	codePart := strings.TrimSpace(parts[1])
-	durationPart := strings.TrimSpace(parts[2])
-	ipPart := strings.TrimSpace(parts[3])
-	methodUrlPart := strings.TrimSpace(parts[4])
+	// Received messages keep their syslog header
+	if o.ListenSyslog != "" && o.InputFormat != "syslog" && o.InputFormat != "journald" {
+		lineFormat = syslogFormat{inner: lineFormat}
+	}
 
-	dateStr := strings.Fields(datePart)[1] + " " + strings.Fields(datePart)[3]
-	parsedDate, err := time.Parse("2006/01/02 15:04:05", dateStr)
+	percentiles, err := parsePercentiles(o.PercentilesList)
 	if err != nil {
-		return LogRecord{}, err
+		fmt.Fprintf(os.Stderr, "Error in -percentiles: %v\n", err)
+		return 2
 	}
 
-	parsedCode, err := strconv.Atoi(codePart)
+	format, err := outputFormat(o.FormatName, o.Raw, o.JSON)
 	if err != nil {
-		return LogRecord{}, err
+		fmt.Fprintf(os.Stderr, "Error in -format: %v\n", err)
+		return 2
+	}
+
+	// Modes printing aggregates instead of records
+	aggregated := o.reportMode() || o.Top != "" && o.Top != "slowest" || o.CompareSources
+
+	// Metrics are printed as JSON in record formats
+	if isRecordFormat(format) && format != "raw" && aggregated {
+		o.JSONMetrics = true
 	}
 
-	parsedDuration, err := parseDuration(durationPart)
+	locale, err := findLocale(o.LocaleName)
 	if err != nil {
-		return LogRecord{}, err
+		fmt.Fprintf(os.Stderr, "Error in -locale: %v\n", err)
+		return 2
 	}
 
-	methodUrlParts := strings.Fields(methodUrlPart)
-	if len(methodUrlParts) < 2 {
-		return LogRecord{}, fmt.Errorf("invalid method/URL format")
+	if o.GroupBy != "" {
+		if err := validGroupBy(o.GroupBy); err != nil {
+			fmt.Fprintf(os.Stderr, "Error in -group-by: %v\n", err)
+			return 2
+		}
 	}
 
-	return LogRecord{
-		Date:     parsedDate,
-		Code:     parsedCode,
-		Duration: parsedDuration,
-		IP:       ipPart,
-		Method:   methodUrlParts[0],
-		URL:      strings.Join(methodUrlParts[1:], " "),
-	}, nil
-}
+	var having Expr
+	if o.Having != "" {
+		if o.GroupBy == "" && (o.Top == "" || o.Top == "slowest") {
+			fmt.Fprintf(os.Stderr, "Error in -having: needs -group-by\n")
+			return 2
+		}
 
-// Duration parsing
-func parseDuration(durStr string) (time.Duration, error) {
-	durStr = strings.TrimSpace(durStr)
-	
-	if strings.HasSuffix(durStr, "µs") {
-		val, err := strconv.ParseFloat(strings.TrimSuffix(durStr, "µs"), 64)
+		having, err = compileHaving(o.Having, percentiles)
 		if err != nil {
-			return 0, err
+			fmt.Fprintf(os.Stderr, "Error in -having: %v\n", err)
+			return 2
+		}
+	}
+
+	if o.SortBy != "" {
+		if err := validSort(o.SortBy); err != nil {
+			fmt.Fprintf(os.Stderr, "Error in -sort: %v\n", err)
+			return 2
 		}
-		return time.Duration(val * float64(time.Microsecond)), nil
 	}
 
-	if strings.HasSuffix(durStr, "ms") {
-		val, err := strconv.ParseFloat(strings.TrimSuffix(durStr, "ms"), 64)
+	var fields []string
+	if o.DerivedFields != "" {
+		fields, err = parseDerivedFields(o.DerivedFields)
 		if err != nil {
-			return 0, err
+			fmt.Fprintf(os.Stderr, "Error in -fields: %v\n", err)
+			return 2
+		}
+
+		if !slices.Contains(derivedFieldFormats, format) || aggregated || o.Top != "" && o.Top != "slowest" {
+			fmt.Fprintf(os.Stderr, "Error in -fields: needs record output (%s)\n", strings.Join(derivedFieldFormats, ", "))
+			return 2
 		}
-		return time.Duration(val * float64(time.Millisecond)), nil
 	}
 
-	return time.ParseDuration(durStr)
-}
+	if o.SplitBy != "" {
+		if err := validSplitBy(o.SplitBy); err != nil {
+			fmt.Fprintf(os.Stderr, "Error in -split-by: %v\n", err)
+			return 2
+		}
 
-// Checking is line matching GIN logs format
-func matchesFilter(record LogRecord, method string, code int, date string, url string, ip string) bool {
-	if method != "" && record.Method != method {
-		return false
+		if !isRecordFormat(format) || aggregated || o.Top != "" {
+			fmt.Fprintf(os.Stderr, "Error in -split-by: only record output (raw, json, csv, ndjson) can be split\n")
+			return 2
+		}
 	}
-	
-	if code != 0 && record.Code != code {
-		return false
+
+	// Template replaces raw lines of records or text of metrics
+	var tmpl *template.Template
+	if o.Template != "" || o.TemplateFile != "" {
+		tmpl, err = parseTemplate(o.Template, o.TemplateFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error in -template: %v\n", err)
+			return 2
+		}
+
+		if format != "raw" && format != "text" || aggregated || o.Top != "" || o.SplitBy != "" || o.SQLiteFile != "" || o.JSONMetrics {
+			fmt.Fprintf(os.Stderr, "Error in -template: needs raw records or text metrics output\n")
+			return 2
+		}
 	}
-	
-	if date != "" && record.Date.Format("2006/01/02") != date {
-		return false
+
+	if o.SQLiteFile != "" && (aggregated || o.Top != "" || o.SplitBy != "" || format == "prometheus") {
+		fmt.Fprintf(os.Stderr, "Error in -sqlite: only records can be exported, not reports, -split-by or prometheus\n")
+		return 2
 	}
-	
-	if url != "" && record.URL != url {
-		return false
+
+	var otlpEndpointURL string
+	var otlpHeaders map[string]string
+	if o.OTLP != "" {
+		otlpEndpointURL, err = otlpEndpoint(o.OTLP, o.OTLPSignal)
+		if err == nil {
+			otlpHeaders, err = parseOTLPHeaders(o.OTLPHeaders)
+		}
+		if err == nil && o.OTLPInterval <= 0 {
+			err = fmt.Errorf("-otlp-interval must be positive")
+		}
+		if err == nil && (aggregated || o.Top != "" || o.SplitBy != "" || o.SQLiteFile != "" || o.RollupDir != "" || o.Series > 0 || o.Availability > 0 || format == "prometheus") {
+			err = fmt.Errorf("only records can be exported, not reports, -split-by, -sqlite, -rollup-dir, -series, -availability or prometheus")
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error in -otlp: %v\n", err)
+			return 2
+		}
 	}
-	
-	if ip != "" && record.IP != ip {
-		return false
+
+	// Spans are sent in order of records, aggregated metrics aren't
+	if o.Checkpoint != "" && (o.OTLP == "" || o.OTLPSignal != "traces") {
+		fmt.Fprintf(os.Stderr, "Error in -checkpoint: needs -otlp with -otlp-signal traces\n")
+		return 2
+	}
+
+	if o.Series < 0 {
+		fmt.Fprintf(os.Stderr, "Error in -series: interval can't be negative\n")
+		return 2
+	}
+	if o.Series > 0 && (!slices.Contains(seriesFormats, format) || aggregated || o.Top != "" || o.SplitBy != "" || o.SQLiteFile != "" || o.RollupDir != "") {
+		fmt.Fprintf(os.Stderr, "Error in -series: needs -format %s and can't be combined with reports, -split-by, -sqlite or -rollup-dir\n", strings.Join(seriesFormats, ", "))
+		return 2
+	}
+
+	failedCodes, err := parseFilterList(o.AvailabilityErrors, parseCode)
+	if err == nil && o.Availability < 0 {
+		err = fmt.Errorf("interval can't be negative")
+	}
+	if err == nil && o.Availability > 0 && (!slices.Contains(seriesFormats, format) || aggregated || o.Top != "" || o.SplitBy != "" || o.SQLiteFile != "" || o.RollupDir != "" || o.Series > 0) {
+		err = fmt.Errorf("needs -format %s and can't be combined with reports, -series, -split-by, -sqlite or -rollup-dir", strings.Join(seriesFormats, ", "))
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error in -availability: %v\n", err)
+		return 2
 	}
-	
-	return true
-}
 
-// Calculation of metrics
-func calculateMetrics(records []LogRecord) Metrics {
-	if len(records) == 0 {
-		return Metrics{StatusCounts: make(map[int]int)}
+	if o.Limit < 0 || o.Offset < 0 || o.Tail < 0 {
+		fmt.Fprintf(os.Stderr, "Error in -limit: -limit, -offset and -tail can't be negative\n")
+		return 2
 	}
 
-	metrics := Metrics{
-		MinTime:      records[0].Duration,
-		MaxTime:      records[0].Duration,
-		StatusCounts: make(map[int]int),
+	if o.Tail > 0 && (o.Limit > 0 || o.Offset > 0) {
+		fmt.Fprintf(os.Stderr, "Error in -tail: can't be combined with -limit or -offset\n")
+		return 2
 	}
 
-	for _, record := range records {
-		metrics.Count++
-		metrics.TotalTime += record.Duration
-		metrics.StatusCounts[record.Code]++
+	if o.CompareSources && (len(args) < 2 || o.reportMode() || o.Top != "") {
+		fmt.Fprintf(os.Stderr, "Error in -compare-sources: needs at least two inputs and can't be combined with other reports\n")
+		return 2
+	}
 
-		if record.Duration < metrics.MinTime {
-			metrics.MinTime = record.Duration
+	if o.PrintOffsets && (o.CompareSources || o.EventsKind != "" || o.ServeAddr != "" || o.RollupDir != "" || o.Merge) {
+		fmt.Fprintf(os.Stderr, "Error in -print-offsets: can't be combined with -compare-sources, -events, -serve, -rollup-dir or -merge\n")
+		return 2
+	}
+
+	if o.MaxWidth < 0 || o.MaxWidth > 0 && o.NoTruncate {
+		fmt.Fprintf(os.Stderr, "Error in -max-width: must be positive and can't be combined with -no-truncate\n")
+		return 2
+	}
+
+	if o.NativeHistograms && o.ServeAddr == "" {
+		fmt.Fprintf(os.Stderr, "Error in -native-histograms: needs -serve, native histograms are only scraped as protobuf\n")
+		return 2
+	}
+
+	if o.InitCounters != "" && (o.ServeAddr == "" || o.NativeHistograms) {
+		fmt.Fprintf(os.Stderr, "Error in -init-counters: needs -serve and can't be combined with -native-histograms, native buckets aren't in text snapshots\n")
+		return 2
+	}
+
+	var scheduler *Scheduler
+	if o.Jobs {
+		if o.ServeAddr == "" {
+			fmt.Fprintf(os.Stderr, "Error in -jobs: needs -serve\n")
+			return 2
 		}
-		if record.Duration > metrics.MaxTime {
-			metrics.MaxTime = record.Duration
+		jobs, err := loadJobs(configPath())
+		if err == nil {
+			scheduler, err = NewScheduler(jobs)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error in -jobs: %v\n", err)
+			return 2
 		}
 	}
 
-	return metrics
-}
+	if err := setZones(o.TZ, o.DisplayTZ); err != nil {
+		fmt.Fprintf(os.Stderr, "Error in %v\n", err)
+		return 2
+	}
+
+	if len(o.IndexFiles) > 0 {
+		for _, path := range o.IndexFiles {
+			start := time.Now()
+			blocks, err := writeIndex(path, lineFormat, indexKey(o))
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error %v\n", err)
+				return 1
+			}
+			printIndexed(path, blocks, time.Since(start))
+		}
+		return 0
+	}
 
-// JSON mode output
-func printJSON(records []LogRecord) {
-	formatted, err := json.Marshal(records)
+	if o.MaxLineSize <= 0 {
+		fmt.Fprintf(os.Stderr, "Error in -max-line-size: size must be positive\n")
+		return 2
+	}
+	setMaxLineSize(int64(o.MaxLineSize), issues)
+
+	if o.LowMemory {
+		if err := validLowMemory(o); err != nil {
+			fmt.Fprintf(os.Stderr, "Error in -low-memory: %v\n", err)
+			return 2
+		}
+		setLowMemory(o)
+	}
+
+	if o.Forecast > 0 {
+		if err := validForecast(o.ForecastInterval, o.Forecast, o.Season); err != nil {
+			fmt.Fprintf(os.Stderr, "Error in -forecast: %v\n", err)
+			return 2
+		}
+	}
+
+	if o.Clients < 0 || o.ClientRate <= 0 {
+		fmt.Fprintf(os.Stderr, "Error in -clients: -clients can't be negative and -client-rate must be positive\n")
+		return 2
+	}
+
+	if o.Quotas < 0 || o.Quota <= 0 || o.QuotaPeriod <= 0 {
+		fmt.Fprintf(os.Stderr, "Error in -quotas: -quotas can't be negative, -quota and -quota-period must be positive\n")
+		return 2
+	}
+	if o.Quotas > 0 && o.User == "" {
+		fmt.Fprintf(os.Stderr, "Error in -quotas: needs -user\n")
+		return 2
+	}
+	var quotas map[string]int
+	if o.QuotaFile != "" {
+		var err error
+		if quotas, err = loadQuotas(o.QuotaFile); err != nil {
+			fmt.Fprintf(os.Stderr, "Error in -quota-file: %v\n", err)
+			return 2
+		}
+	}
 
+	privacy, err := NewPrivacy(o.PrivacyK, o.PrivacyEpsilon)
+	if err == nil && privacy != nil && o.GroupBy == "" && (o.Top == "" || o.Top == "slowest") && o.Clients == 0 {
+		err = fmt.Errorf("-privacy-k: only -group-by, -top and -clients reports are protected")
+	}
 	if err != nil {
-		fmt.Errorf("failed to encode in json: %w", err)
-		os.Exit(1)
+		fmt.Fprintf(os.Stderr, "Error in %v\n", err)
+		return 2
 	}
 
-	fmt.Println(string(formatted))
-}
+	if o.KeepAlive < 0 {
+		fmt.Fprintf(os.Stderr, "Error in -keepalive: gap can't be negative\n")
+		return 2
+	}
 
-// Metrics mode output
-func printMetrics(metrics Metrics) {
-	fmt.Printf("Total Requests: %d\n", metrics.Count)
-	
-	if metrics.Count == 0 {
-		return
+	if o.Capacity < 0 || o.CapacityHeadroom < 1 || o.CapacityWorkers < 0 {
+		fmt.Fprintf(os.Stderr, "Error in -capacity: window and -capacity-workers can't be negative, -capacity-headroom must be at least 1\n")
+		return 2
 	}
 
-	fmt.Printf("Total Time: %v\n", metrics.TotalTime)
-	fmt.Printf("Average Time: %v\n", metrics.TotalTime/time.Duration(metrics.Count))
-	fmt.Printf("Min Time: %v\n", metrics.MinTime)
-	fmt.Printf("Max Time: %v\n", metrics.MaxTime)
-	fmt.Println("\nStatus Code Distribution:")
-	
-	for code, count := range metrics.StatusCounts {
-		fmt.Printf("  %d: %d\n", code, count)
+	if o.Heatmap < 0 {
+		fmt.Fprintf(os.Stderr, "Error in -heatmap: interval can't be negative\n")
+		return 2
+	}
+
+	if o.Episodes < 0 || o.EpisodeMin <= 0 {
+		fmt.Fprintf(os.Stderr, "Error in -episodes: gap can't be negative and -episode-min must be positive\n")
+		return 2
+	}
+
+	var growth *Growth
+	if o.Growth != "" {
+		if !slices.Contains(growthPeriods, o.Growth) {
+			fmt.Fprintf(os.Stderr, "Error in -growth: unknown period %q (supported: %s)\n", o.Growth, strings.Join(growthPeriods, ", "))
+			return 2
+		}
+		growth = NewGrowth(o.Growth, now)
+		if o.GrowthState != "" {
+			// Parallel runs update state in turns, otherwise clients
+			// saved by one of them would be lost
+			if dryRun == nil {
+				unlock, err := lockPath(o.GrowthState, o.LockTimeout)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "Error in -growth-state: %v\n", err)
+					return 1
+				}
+				defer unlock()
+			}
+			if err := growth.Load(o.GrowthState); err != nil {
+				fmt.Fprintf(os.Stderr, "Error in -growth-state: %v\n", err)
+				return 2
+			}
+		}
+	}
+
+	var allowlist []AllowedRoute
+	if o.Conformance != "" {
+		var err error
+		if allowlist, err = loadAllowlist(o.Conformance); err != nil {
+			fmt.Fprintf(os.Stderr, "Error in -conformance: %v\n", err)
+			return 2
+		}
+	}
+
+	if o.TreeDepth < 0 {
+		fmt.Fprintf(os.Stderr, "Error in -tree-depth: depth can't be negative\n")
+		return 2
+	}
+
+	if o.Anomaly.Interval > 0 {
+		if err := validAnomalies(o.Anomaly); err != nil {
+			fmt.Fprintf(os.Stderr, "Error in -anomalies: %v\n", err)
+			return 2
+		}
+	}
+
+	if o.EventsKind != "" {
+		if err := validEvents(o.EventsKind); err != nil {
+			fmt.Fprintf(os.Stderr, "Error in -events: %v\n", err)
+			return 2
+		}
+	}
+
+	var emitTarget EmitTarget
+	if o.Emit != "" {
+		if emitTarget, err = parseEmitTarget(o.Emit); err != nil || o.EmitInterval <= 0 {
+			if err == nil {
+				err = fmt.Errorf("-emit-interval must be positive")
+			}
+			fmt.Fprintf(os.Stderr, "Error in -emit: %v\n", err)
+			return 2
+		}
+	}
+	var emitRoutes []routePercentiles
+	if len(o.EmitRoutePercentiles) > 0 {
+		if emitRoutes, err = parseRoutePercentiles(o.EmitRoutePercentiles); err == nil && emitTarget.Scheme != "graphite" {
+			err = fmt.Errorf("needs -emit graphite://, StatsD calculates percentiles itself")
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error in -emit-route-percentiles: %v\n", err)
+			return 2
+		}
+	}
+
+	if o.Top != "" {
+		if err := validTop(o.Top); err != nil {
+			fmt.Fprintf(os.Stderr, "Error in -top: %v\n", err)
+			return 2
+		}
+	}
+
+	if !slices.Contains(topOutputs, o.TopOutput) && o.TopOutput != "" || o.TopOutput == "urls" && o.Top != "urls" {
+		fmt.Fprintf(os.Stderr, "Error in -output: expected %s, urls is output of top urls report\n", strings.Join(topOutputs, " or "))
+		return 2
+	}
+
+	var alertRules []AlertRule
+	for _, expr := range o.AlertExprs {
+		rule, err := parseAlertRule(expr)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error in -alert: %v\n", err)
+			return 2
+		}
+		rule.DedupPrefix = o.AlertDedupPrefix
+		alertRules = append(alertRules, rule)
+
+		if p, ok := rule.Percentile(); ok && !slices.Contains(percentiles, p) {
+			percentiles = append(percentiles, p)
+		}
+	}
+
+	alertState := NewAlertState()
+	if o.AlertState != "" {
+		if len(alertRules) == 0 {
+			fmt.Fprintf(os.Stderr, "Error in -alert-state: needs -alert\n")
+			return 2
+		}
+		// Parallel runs update state in turns, otherwise firing alerts
+		// saved by one of them would be lost
+		if dryRun == nil {
+			unlock, err := lockPath(o.AlertState, o.LockTimeout)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error in -alert-state: %v\n", err)
+				return 1
+			}
+			defer unlock()
+		}
+		if err := alertState.Load(o.AlertState); err != nil {
+			fmt.Fprintf(os.Stderr, "Error in -alert-state: %v\n", err)
+			return 2
+		}
+	}
+
+	var checkRules []AlertRule
+	for _, expr := range o.CheckExprs {
+		rule, err := parseAlertRule(expr)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error in check: %v\n", err)
+			return 2
+		}
+		checkRules = append(checkRules, rule)
+
+		if p, ok := rule.Percentile(); ok && !slices.Contains(percentiles, p) {
+			percentiles = append(percentiles, p)
+		}
+	}
+
+	if o.Impact < 0 || o.ImpactPercentile <= 0 || o.ImpactPercentile >= 100 {
+		fmt.Fprintf(os.Stderr, "Error in -impact: budget can't be negative and -impact-percentile must be between 0 and 100\n")
+		return 2
+	}
+	if o.Impact > 0 && !slices.Contains(percentiles, o.ImpactPercentile) {
+		percentiles = append(percentiles, o.ImpactPercentile)
+	}
+
+	var notifiers []Notifier
+	if o.PagerDutyKey != "" {
+		notifiers = append(notifiers, PagerDuty{RoutingKey: o.PagerDutyKey})
+	}
+	if o.OpsgenieKey != "" {
+		notifiers = append(notifiers, Opsgenie{APIKey: o.OpsgenieKey})
+	}
+
+	// Destinations are checked and writes are only counted
+	if dryRun != nil {
+		for i, notifier := range notifiers {
+			dryRun.Check(notifier.Name(), notifier.Check())
+			notifiers[i] = dryRunNotifier{Notifier: notifier, dryRun: dryRun}
+		}
+	}
+
+	var splitTime time.Time
+	if o.SplitAt != "" {
+		splitTime, err = parseTimestamp(o.SplitAt, now)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error in -split-at: %v\n", err)
+			return 2
+		}
+	}
+
+	buckets := defaultBuckets
+	var promBuckets []float64
+	if o.BucketsList != "" {
+		buckets, err = parseBuckets(o.BucketsList)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error in -buckets: %v\n", err)
+			return 2
+		}
+
+		for _, bucket := range buckets {
+			promBuckets = append(promBuckets, bucket.Seconds())
+		}
+	}
+
+	var normalizer *Normalizer
+	if o.Normalize {
+		normalizer = &Normalizer{}
+	}
+
+	if o.RoutesFile != "" {
+		patterns, err := loadRoutes(o.RoutesFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error loading routes: %v\n", err)
+			return 2
+		}
+		normalizer = &Normalizer{Patterns: patterns}
+	}
+
+	var graphQL *GraphQL
+	if len(o.GraphQL) > 0 {
+		graphQL, err = NewGraphQL(o.GraphQL, o.GraphQLField)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error in -graphql: %v\n", err)
+			return 2
+		}
+	}
+
+	var silences []Silence
+	if o.SilencesFile != "" && o.ServeAddr == "" {
+		silences, err = loadSilences(o.SilencesFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error loading silences: %v\n", err)
+			return 2
+		}
+	}
+
+	var annotations []Annotation
+	if o.AnnotationsSource != "" {
+		annotations, err = loadAnnotations(o.AnnotationsSource, now)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error loading annotations: %v\n", err)
+			return 2
+		}
+	}
+
+	var loadTests *LoadTests
+	if o.LoadTestsSource != "" {
+		loadTests, err = loadLoadTests(o.LoadTestsSource, now)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error in -load-tests: %v\n", err)
+			return 2
+		}
+		annotations = append(annotations, loadTests.Annotations()...)
+		defer loadTests.Report(os.Stderr, locale)
+	}
+
+	// Windows of compare are applied by compare itself
+	var windows [2]compareWindow
+	from, to := o.From, o.To
+	if o.Compare && o.BaselineFrom != "" {
+		windows[0], windows[1], err = parseCompareWindows(o.BaselineFrom, o.BaselineTo, o.From, o.To, now)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error in time range: %v\n", err)
+			return 2
+		}
+		from, to = "", ""
+	}
+
+	if err := filter.SetRange(from, to, now); err != nil {
+		fmt.Fprintf(os.Stderr, "Error in time range: %v\n", err)
+		return 2
+	}
+
+	sampler, err := NewSampler(o.Sample, o.SampleEvery)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error in %v\n", err)
+		return 2
+	}
+	if sampler != nil && (o.unscaledReport() || format == "prometheus") {
+		fmt.Fprintf(os.Stderr, "Error in -sample: counts of this report aren't scaled, sample only metrics, -group-by, -top, -interval, -histogram, -clients or records\n")
+		return 2
+	}
+	if sampler != nil {
+		sampleRate = sampler.rate
+	}
+
+	skipPaths, err := NewSkipPaths(o.SkipPaths)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error in -skip-paths: %v\n", err)
+		return 2
+	}
+	if skipPaths != nil {
+		defer skipPaths.Report(os.Stderr, locale)
+	}
+
+	var threatFeeds *ThreatFeeds
+	if len(o.ThreatFeeds) > 0 {
+		threatFeeds, err = LoadThreatFeeds(o.ThreatFeeds)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error in -threat-feed: %v\n", err)
+			return 2
+		}
+	}
+	if (o.ThreatOnly || o.Threats > 0) && threatFeeds == nil {
+		fmt.Fprintf(os.Stderr, "Error in -threat-feed: -threat-only and -threats need feed\n")
+		return 2
 	}
-}
 
-// Raw mode output
-func printRaw(records []LogRecord) {
-	for _, record := range records {
-		fmt.Printf("%s | %3d | %12s | %15s | %-7s %s\n",
-			record.Date.Format("2006/01/02 - 15:04:05"),
-			record.Code,
-			strings.TrimSpace(formatDuration(record.Duration)),
-			strings.TrimSpace(record.IP),
-			strings.TrimSpace(record.Method),
-			strings.TrimSpace(record.URL),
-		)
+	users, err := NewUserExtractor(o.User)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error in -user: %v\n", err)
+		return 2
+	}
+
+	var crawlers *CrawlerClassifier
+	if o.Crawlers {
+		crawlers, err = NewCrawlerClassifier(o.CrawlerRanges)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error in -crawler-ranges: %v\n", err)
+			return 2
+		}
+	}
+
+	var explain *Explain
+	if o.Explain {
+		if o.ExplainEvery <= 0 {
+			fmt.Fprintf(os.Stderr, "Error in -explain-every: must be positive\n")
+			return 2
+		}
+		explain = NewExplain(filter, o.ExplainEvery, format == "raw" && !aggregated)
+		defer explain.Report(os.Stderr, locale)
+	}
+
+	var profile *FilterProfile
+	if o.Profile {
+		profile = NewFilterProfile(filter)
+		defer profile.Report(os.Stderr, locale)
+	}
+
+	// Tagging record, true when its IP is flagged by threat feeds.
+	// Records are tagged before filters, so expressions can use threat,
+	// user and load_test fields.
+	tag := func(record *LogRecord) bool {
+		record.IP = clientIP(record.IP)
+		if users != nil {
+			users.Tag(record)
+		}
+		if loadTests != nil {
+			loadTests.Tag(record)
+		}
+		return threatFeeds != nil && threatFeeds.Tag(record)
+	}
+
+	// Route of record stream is kept, it may come from -routes of other process
+	route := func(record *LogRecord) {
+		if normalizer != nil && record.Route == "" {
+			record.Route = normalizer.Normalize(record.URL)
+		}
+		if graphQL != nil {
+			graphQL.Route(record)
+		}
+	}
+
+	// Filtering parsed record
+	acceptRecord := func(record LogRecord, number int) (LogRecord, bool, error) {
+		if !tag(&record) && o.ThreatOnly {
+			if explain != nil {
+				explain.Drop("-threat-only", number, record)
+			}
+			return LogRecord{}, false, nil
+		}
+
+		if explain != nil || profile != nil {
+			var rejected string
+			if profile != nil {
+				rejected = profile.Reject(record)
+			} else {
+				rejected = rejectingFilter(record, filter)
+			}
+			if rejected == "" && skipPaths != nil && skipPaths.Skip(record) {
+				rejected = "-skip-paths"
+			}
+			if rejected != "" {
+				if explain != nil {
+					explain.Drop(rejected, number, record)
+				}
+				return LogRecord{}, false, nil
+			}
+			if explain != nil {
+				explain.Keep()
+			}
+		} else if !matchesFilter(record, filter) || skipPaths != nil && skipPaths.Skip(record) {
+			return LogRecord{}, false, nil
+		}
+
+		route(&record)
+		return record, true, nil
+	}
+
+	// Parsing line into filtered record
+	accept := func(line string, number int) (LogRecord, bool, error) {
+		if sampler != nil && !sampler.Keep(number) {
+			return LogRecord{}, false, nil
+		}
+
+		record, err := lineFormat.Parse(line)
+		if err != nil {
+			if o.Strict && !ignoredLine(line) && !errors.Is(err, errIgnoredLine) {
+				return LogRecord{}, false, fmt.Errorf("parsing %w (see -strict)", issues.lineError(number, line, err))
+			}
+			issues.SkipLine(number, line, err)
+			return LogRecord{}, false, nil
+		}
+
+		return acceptRecord(record, number)
+	}
+
+	// Filtering record of binary record file
+	acceptMappedRecord := func(record LogRecord, number int) (LogRecord, bool, error) {
+		if sampler != nil && !sampler.Keep(number) {
+			return LogRecord{}, false, nil
+		}
+		return acceptRecord(record, number)
+	}
+
+	// Binary record files given as arguments are mapped instead of
+	// read by repl and REST API. Records accepted by filters are kept
+	// as numbers and tagged again when they are queried.
+	mapInputs := func() (recordSet, bool, error) {
+		if len(args) == 0 || o.ArchiveFile != "" || o.SSHFile != "" || o.FollowFile != "" || o.ListenSyslog != "" {
+			return nil, false, nil
+		}
+		mapped, ok, err := openMappedInputs(args)
+		if err != nil || !ok {
+			return nil, false, err
+		}
+
+		filtered := sampler != nil || len(filterChecks(filter)) > 0 || skipPaths != nil || o.ThreatOnly
+		records, err := acceptMapped(mapped, filtered, acceptMappedRecord, func(record *LogRecord) {
+			tag(record)
+			route(record)
+		})
+		return records, true, err
+	}
+
+	// Files and URLs given as arguments are read instead of stdin
+	var input io.Reader = os.Stdin
+	if len(args) > 0 {
+		if o.ArchiveFile != "" || o.SSHFile != "" || o.FollowFile != "" || o.ListenSyslog != "" {
+			fmt.Fprintf(os.Stderr, "Error in arguments: input files can't be combined with -archive, -ssh, -follow or -listen-syslog\n")
+			return 2
+		}
+
+		// Records of binary record files are read as they are, not
+		// encoded as record stream and parsed again. Limits are applied
+		// to stream, and broken files are skipped by reading it.
+		var mapped *mappedRecords
+		if !o.Merge && o.MaxLines <= 0 && o.MaxBytes <= 0 && o.MaxRuntime <= 0 {
+			if records, ok, err := openMappedInputs(args); ok && err == nil {
+				mapped = records
+			}
+		}
+
+		switch {
+		case mapped != nil:
+			records := newMappedInput(mapped, acceptMappedRecord)
+			defer records.Close()
+			input = records
+		case o.Merge && len(args) > 1:
+			merged := openMerged(args, lineFormat, issues)
+			defer merged.Close()
+			input = merged
+		default:
+			inputs := openInputs(args, issues)
+			defer inputs.Close()
+
+			// Line numbers of sampling and offsets count every line
+			if o.Sample == 0 && o.SampleEvery == 0 && !o.PrintOffsets {
+				inputs.index = newBlockFilter(filter, indexKey(o))
+			}
+			input = inputs
+		}
+	}
+
+	if o.ArchiveFile != "" {
+		archive, err := openArchive(o.ArchiveFile, o.ArchiveMembers, o.ArchivePassword)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error opening input: %v\n", err)
+			return 1
+		}
+		defer archive.Close()
+		input = archive
+	}
+
+	if o.SSHFile != "" {
+		remote, err := openSSH(o.SSHFile, o.SSHCompress)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error opening input: %v\n", err)
+			return 1
+		}
+		defer remote.Close()
+		input = remote
+	}
+
+	if o.Kafka != nil {
+		kafka, err := openKafka(*o.Kafka)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error opening input: %v\n", err)
+			return 1
+		}
+		defer kafka.Close()
+		input = kafka
+	}
+
+	if o.ListenSyslog != "" {
+		listener, err := listenSyslog(o.ListenSyslog)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error opening input: %v\n", err)
+			return 1
+		}
+		defer listener.Close()
+		input = listener
+	}
+
+	if o.FollowFile != "" {
+		follow, err := newFollowReader(o.FollowFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error opening input: %v\n", err)
+			return 1
+		}
+		defer follow.Close()
+		input = follow
+
+		// Dashboard shows traffic from now on
+		if o.Dash {
+			if err := follow.SeekEnd(); err != nil {
+				fmt.Fprintf(os.Stderr, "Error opening input: %v\n", err)
+				return 1
+			}
+		}
+	}
+
+	limitInput := newInputLimit(o.MaxLines, int64(o.MaxBytes), o.MaxRuntime, issues)
+	input = limitInput(input)
+
+	if o.EventsKind != "" {
+		events, err := readEvents(input, o.EventsKind, filter, normalizer)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading input: %v\n", err)
+			return 1
+		}
+
+		switch {
+		case format == "json":
+			err = printJSON(events)
+		case format == "ndjson":
+			err = printEventsNDJSON(events)
+		case o.JSONMetrics && o.EventsKind == "panics":
+			err = printJSON(summarizePanics(events))
+		default:
+			printEvents(events, o.EventsKind, locale)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error %v\n", err)
+			return 1
+		}
+		return 0
+	}
+
+	if o.Dash {
+		budgets, err := parseRouteBudgets(o.DashBudgets)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error in -budget: %v\n", err)
+			return 2
+		}
+		dash := NewDashboard(o.DashWindow, o.Slow, o.DashRecent, budgets, o.DashBurnRoutes)
+		if err := runDashboard(dash, input, accept, o.FollowFile, o.DashRefresh, locale); err != nil {
+			fmt.Fprintf(os.Stderr, "Error %v\n", err)
+			return 1
+		}
+		return 0
+	}
+
+	if o.Kafka != nil && format == "text" {
+		if err := consumeMetrics(input, accept, o.ConsumeEvery, percentiles, o.JSONMetrics, locale); err != nil {
+			fmt.Fprintf(os.Stderr, "Error %v\n", err)
+			return 1
+		}
+		return 0
+	}
+
+	if o.ServeAddr != "" {
+		var index *RecordIndex
+		if o.APIAddr != "" {
+			index = NewRecordIndex(o.APIRetain)
+			records, mapped, err := mapInputs()
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error opening input: %v\n", err)
+				return 1
+			}
+			if mapped {
+				index = NewMappedRecordIndex(records)
+			}
+		}
+		collector := NewPromCollector(promBuckets, o.NativeHistograms)
+		if o.InitCounters != "" {
+			if err := seedPromCollector(collector, o.InitCounters); err != nil {
+				fmt.Fprintf(os.Stderr, "Error in -init-counters: %v\n", err)
+				return 2
+			}
+		}
+		var silenceStore *SilenceStore
+		if o.SilencesFile != "" {
+			if silenceStore, err = NewSilenceStore(o.SilencesFile); err != nil {
+				fmt.Fprintf(os.Stderr, "Error loading silences: %v\n", err)
+				return 2
+			}
+		}
+		if err := serve(o.ServeAddr, input, accept, collector, index, percentiles, scheduler, silenceStore); err != nil {
+			fmt.Fprintf(os.Stderr, "Error serving metrics: %v\n", err)
+			return 1
+		}
+		return 0
+	}
+
+	if o.RollupDir != "" {
+		rollup, err := NewRollup(o.RollupDir, o.RollupPeriod, percentiles, annotations, dryRun)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error in -rollup-dir: %v\n", err)
+			return 2
+		}
+
+		if err := runRollup(rollup, input, accept); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing rollup: %v\n", err)
+			return 1
+		}
+		return 0
+	}
+
+	if o.Series > 0 {
+		series := NewPercentileSeries(o.Series, now, percentiles)
+		if err := readRecords(input, o.Workers, accept, series.Add, nil); err != nil {
+			fmt.Fprintf(os.Stderr, "Error %v\n", err)
+			return 1
+		}
+		if err := writeSeries(os.Stdout, series.Rows(), percentiles, format); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing series: %v\n", err)
+			return 1
+		}
+		return 0
+	}
+
+	if o.Availability > 0 {
+		availability := NewAvailabilitySeries(o.Availability, failedCodes, now)
+		add := availability.Add
+		if loadTests != nil {
+			add = loadTests.Exclude("availability", add)
+		}
+		if err := readRecords(input, o.Workers, accept, add, nil); err != nil {
+			fmt.Fprintf(os.Stderr, "Error %v\n", err)
+			return 1
+		}
+		if err := writeAvailability(os.Stdout, availability.Rows(), format); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing availability: %v\n", err)
+			return 1
+		}
+		return 0
+	}
+
+	if o.CompareSources {
+		var results []SourceMetrics
+		for _, source := range parseSources(args) {
+			var checker *SanityChecker
+			if !o.KeepSuspicious {
+				checker = NewSanityChecker(o.DurationCap, o.SuspiciousGaps)
+			}
+
+			result, err := readSourceMetrics(source, limitInput, o.Workers, accept, checker, now, percentiles)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error %v\n", err)
+				return 1
+			}
+			results = append(results, result)
+		}
+
+		markOutliers(results, percentiles)
+		if o.JSONMetrics {
+			if err := printJSON(results); err != nil {
+				fmt.Fprintf(os.Stderr, "Error %v\n", err)
+				return 1
+			}
+		} else {
+			printSourceComparison(results, percentiles, locale)
+		}
+		return 0
+	}
+
+	if o.Compare {
+		newChecker := func() *SanityChecker {
+			if o.KeepSuspicious {
+				return nil
+			}
+			return NewSanityChecker(o.DurationCap, o.SuspiciousGaps)
+		}
+
+		var results [2]SourceMetrics
+		if o.BaselineFrom != "" {
+			results, err = readWindowMetrics(input, o.Workers, accept, windows, newChecker, now, percentiles)
+		} else {
+			for i, source := range parseSources(args) {
+				if results[i], err = readSourceMetrics(source, limitInput, o.Workers, accept, newChecker(), now, percentiles); err != nil {
+					break
+				}
+			}
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error %v\n", err)
+			return 1
+		}
+
+		diff := diffMetrics(results[0], results[1], percentiles)
+		if o.JSONMetrics {
+			if err := printJSON(diff); err != nil {
+				fmt.Fprintf(os.Stderr, "Error %v\n", err)
+				return 1
+			}
+		} else {
+			printMetricsDiff(diff, locale)
+		}
+		return 0
+	}
+
+	if o.Mirror {
+		tolerance, err := parseThreshold(o.MirrorTolerance)
+		if err != nil || tolerance < 0 || o.MirrorWindow < 0 {
+			fmt.Fprintf(os.Stderr, "Error in -tolerance: invalid tolerance %q (e.g. 20%% or 0.2) or negative -match-window\n", o.MirrorTolerance)
+			return 2
+		}
+
+		var sides [2][]LogRecord
+		for i, name := range args {
+			if sides[i], err = readInputRecords(name, limitInput, o.Workers, accept); err != nil {
+				fmt.Fprintf(os.Stderr, "Error %v\n", err)
+				return 1
+			}
+		}
+
+		report := compareMirror(sides[0], sides[1], o.MirrorWindow, tolerance)
+		if o.JSONMetrics {
+			if err := printJSON(report); err != nil {
+				fmt.Fprintf(os.Stderr, "Error %v\n", err)
+				return 1
+			}
+		} else {
+			printMirror(report, locale)
+		}
+		return 0
+	}
+
+	if o.BaselineSave != "" || o.BaselineAgainst != "" {
+		var profile BaselineProfile
+		var tolerance float64
+		if o.BaselineAgainst != "" {
+			if profile, err = loadBaselineProfile(o.BaselineAgainst); err != nil {
+				fmt.Fprintf(os.Stderr, "Error in -against: %v\n", err)
+				return 2
+			}
+			percentiles = profile.Percentiles
+
+			if tolerance, err = parseThreshold(o.Tolerance); err != nil || tolerance < 0 {
+				fmt.Fprintf(os.Stderr, "Error in -tolerance: invalid tolerance %q (e.g. 10%% or 0.1)\n", o.Tolerance)
+				return 2
+			}
+		}
+
+		var checker *SanityChecker
+		if !o.KeepSuspicious {
+			checker = NewSanityChecker(o.DurationCap, o.SuspiciousGaps)
+		}
+		sink := baselineSink{
+			metrics: NewMetricsAccumulator(now, percentiles),
+			groups:  NewGroupAccumulator("url", now, percentiles),
+		}
+		pipeline := NewPipeline(checker)
+		pipeline.AddChecked(sink)
+
+		if err := readRecords(input, o.Workers, accept, pipeline.Write, nil); err != nil {
+			fmt.Fprintf(os.Stderr, "Error %v\n", err)
+			return 1
+		}
+
+		if o.BaselineSave != "" {
+			profile = newBaselineProfile(sink.metrics.Metrics(), sink.groups.Groups(), percentiles, now)
+			if err := saveBaselineProfile(o.BaselineSave, profile); err != nil {
+				fmt.Fprintf(os.Stderr, "Error writing baseline: %v\n", err)
+				return 1
+			}
+			fmt.Fprintf(os.Stderr, "Saved baseline of %d routes to %s\n", len(profile.Routes), o.BaselineSave)
+			return 0
+		}
+
+		check := checkBaseline(profile, sink.groups.Groups(), tolerance)
+		for _, route := range check.Regressed() {
+			issues.Add(issueRegressions, route)
+		}
+		if o.JSONMetrics {
+			if err := printJSON(check); err != nil {
+				fmt.Fprintf(os.Stderr, "Error %v\n", err)
+				return 1
+			}
+		} else {
+			printBaselineCheck(check, locale)
+		}
+		return 0
+	}
+
+	if len(checkRules) > 0 {
+		var checker *SanityChecker
+		if !o.KeepSuspicious {
+			checker = NewSanityChecker(o.DurationCap, o.SuspiciousGaps)
+		}
+		metrics := NewMetricsAccumulator(now, percentiles)
+		pipeline := NewPipeline(checker)
+		var sink Sink = accumulatorSink{metrics: metrics}
+		if loadTests != nil {
+			sink = excludingSink{sink, loadTests.Exclude("check thresholds", sink.Add)}
+		}
+		pipeline.AddChecked(sink)
+
+		if err := readRecords(input, o.Workers, accept, pipeline.Write, nil); err != nil {
+			fmt.Fprintf(os.Stderr, "Error %v\n", err)
+			return 1
+		}
+
+		report := checkThresholds(checkRules, metrics.Metrics())
+		for _, result := range report.Results {
+			if !result.Passed {
+				issues.Add(issueThresholds, result.Rule)
+			}
+		}
+		if o.JSONMetrics {
+			if err := printJSON(report); err != nil {
+				fmt.Fprintf(os.Stderr, "Error %v\n", err)
+				return 1
+			}
+		} else {
+			printCheck(report, locale)
+		}
+		return 0
+	}
+
+	if o.Repl {
+		records, mapped, err := mapInputs()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error opening input: %v\n", err)
+			return 1
+		}
+		if !mapped {
+			var loaded recordSlice
+			err := readRecords(input, o.Workers, accept, func(record LogRecord) error {
+				loaded = append(loaded, record)
+				return nil
+			}, nil)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error %v\n", err)
+				return 1
+			}
+			records = loaded
+		}
+
+		newChecker := func() *SanityChecker {
+			if o.KeepSuspicious {
+				return nil
+			}
+			return NewSanityChecker(o.DurationCap, o.SuspiciousGaps)
+		}
+		if err := NewRepl(records, newChecker, now, percentiles, locale).Run(os.Stdin); err != nil {
+			fmt.Fprintf(os.Stderr, "Error %v\n", err)
+			return 1
+		}
+		return 0
+	}
+
+	if o.Incident {
+		var checker *SanityChecker
+		if !o.KeepSuspicious {
+			checker = NewSanityChecker(o.DurationCap, o.SuspiciousGaps)
+		}
+		incident, err := NewIncident(checker, o.Anomaly, now, percentiles)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error creating incident: %v\n", err)
+			return 1
+		}
+		defer incident.Close()
+
+		if err := readRecords(input, o.Workers, accept, incident.pipeline.Write, nil); err != nil {
+			incident.Close()
+			fmt.Fprintf(os.Stderr, "Error %v\n", err)
+			return 1
+		}
+
+		manifest := IncidentManifest{
+			Version: currentVersion(),
+			Build:   currentBuild(),
+			Created: now,
+			Command: os.Args,
+			From:    filter.From,
+			To:      filter.To,
+			Inputs:  append([]string{}, args...),
+		}
+		if err := incident.Write(os.Stdout, manifest, locale); err != nil {
+			incident.Close()
+			fmt.Fprintf(os.Stderr, "Error writing incident: %v\n", err)
+			return 1
+		}
+		return 0
+	}
+
+	if o.FixturesDir != "" {
+		recorder := NewFixtureRecorder(o.FixturesTotal, o.FixturesPerRoute)
+		if err := readRecords(input, o.Workers, accept, recorder.Add, nil); err != nil {
+			fmt.Fprintf(os.Stderr, "Error %v\n", err)
+			return 1
+		}
+
+		fixtures := recorder.Fixtures(NewAnonymizer())
+		if err := writeFixtures(o.FixturesDir, o.FixturesFormat, fixtures); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing fixtures: %v\n", err)
+			return 1
+		}
+
+		samples := 0
+		for _, fixture := range fixtures {
+			samples += len(fixture.Samples)
+		}
+		fmt.Printf("Wrote %s samples of %s routes to %s\n", locale.Int(samples), locale.Int(len(fixtures)), o.FixturesDir)
+		return 0
+	}
+
+	if o.HTMLReport {
+		var checker *SanityChecker
+		if !o.KeepSuspicious {
+			checker = NewSanityChecker(o.DurationCap, o.SuspiciousGaps)
+		}
+		report := NewHTMLReport(checker, o.ReportInterval, buckets, now, percentiles)
+
+		if err := readRecords(input, o.Workers, accept, report.pipeline.Write, nil); err != nil {
+			fmt.Fprintf(os.Stderr, "Error %v\n", err)
+			return 1
+		}
+		if err := report.Write(os.Stdout, o.ReportTitle, args, now, locale); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing report: %v\n", err)
+			return 1
+		}
+		return 0
+	}
+
+	// Pipeline of filtered records, suspicious durations are
+	// excluded from everything except records output
+	var checker *SanityChecker
+	if !o.KeepSuspicious {
+		checker = NewSanityChecker(o.DurationCap, o.SuspiciousGaps)
+	}
+	pipeline := NewPipeline(checker)
+
+	if o.Emit != "" {
+		pipeline.AddChecked(NewEmitter(emitTarget, o.EmitPrefix, o.EmitInterval, percentiles, emitRoutes, dryRun))
+	}
+
+	if o.EmailTo != "" {
+		o.Email.To = strings.Split(o.EmailTo, ",")
+		o.Email.Password = os.Getenv("GINLOG_SMTP_PASSWORD")
+
+		pipeline.AddChecked(&emailSink{
+			config:   o.Email,
+			metrics:  NewMetricsAccumulator(now, percentiles),
+			pipeline: pipeline,
+			locale:   locale,
+			dryRun:   dryRun,
+		})
+	}
+
+	if len(alertRules) > 0 {
+		var sink Sink = alertSink{
+			rules:     alertRules,
+			metrics:   NewMetricsAccumulator(now, percentiles),
+			notifiers: notifiers,
+			silences:  silences,
+			now:       now,
+			issues:    issues,
+			state:     alertState,
+			statePath: o.AlertState,
+			dryRun:    dryRun,
+		}
+		if loadTests != nil {
+			sink = excludingSink{sink, loadTests.Exclude("alert rules", sink.Add)}
+		}
+		pipeline.AddChecked(sink)
 	}
+
+	switch {
+	case o.OTLP != "":
+		exporter := NewOTLPExporter(otlpEndpointURL, o.OTLPSignal, o.OTLPService, otlpHeaders, o.OTLPInterval, dryRun)
+		exporter.offset, exporter.limit = o.Offset, o.Limit
+		if o.Checkpoint != "" && dryRun == nil {
+			exporter.checkpoint = newCheckpointer(o.Checkpoint, o.Offset, o.Limit)
+		}
+		pipeline.Add(exporter)
+
+	case (isRecordFormat(format) || o.SQLiteFile != "") && !aggregated && o.Top == "":
+		w := newRecordWriter(os.Stdout, format, fields)
+		if tmpl != nil {
+			w = &templateWriter{w: os.Stdout, tmpl: tmpl}
+		}
+		if o.SplitBy != "" {
+			w = newSplitWriter(o.SplitBy, o.SplitPath, format, fields, dryRun)
+		}
+		if o.SQLiteFile != "" && dryRun != nil {
+			_, err := exec.LookPath("sqlite3")
+			dryRun.Check("sqlite3", err)
+			w = dryRunRecordWriter{target: dryRun.File(o.SQLiteFile, "records", true)}
+		} else if o.SQLiteFile != "" {
+			sqlite, err := newSQLiteWriter(o.SQLiteFile, o.LockTimeout)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error in -sqlite: %v\n", err)
+				return 1
+			}
+			w = sqlite
+		}
+		if o.Limit > 0 || o.Offset > 0 {
+			w = newLimitWriter(w, o.Offset, o.Limit)
+		}
+		if o.Tail > 0 {
+			w = newTailWriter(w, o.Tail)
+		}
+		if o.SortBy != "" {
+			w = newSortedWriter(w, o.SortBy, o.Desc)
+		}
+		pipeline.Add(recordSink{w: w})
+
+	case format == "prometheus":
+		pipeline.Add(promSink{collector: NewPromCollector(promBuckets, false)})
+
+	case o.Top == "slowest":
+		pipeline.AddChecked(slowestSink{tracker: NewSlowestTracker(o.TopN), format: format, fields: fields, locale: locale})
+
+	case o.TopOutput == "urls":
+		pipeline.AddChecked(warmSink{list: NewWarmList(), limit: max(o.TopN, 0), base: o.URLBase})
+
+	case o.Top != "":
+		by := topGroupBy(o.Top)
+		pipeline.AddChecked(groupSink{
+			groups: NewGroupAccumulator(by, now, percentiles),
+			by:     by,
+			json:   o.JSONMetrics,
+			locale: locale,
+
+			include: func(record LogRecord) bool { return topIncludes(o.Top, record) },
+			limit:   max(o.TopN, 0),
+			having:  having,
+			privacy: privacy,
+		})
+
+	case !splitTime.IsZero():
+		pipeline.AddChecked(compareSink{
+			samples: NewSplitSamples(splitTime),
+			alpha:   o.Alpha,
+			json:    o.JSONMetrics,
+			locale:  locale,
+		})
+
+	case o.Forecast > 0:
+		pipeline.AddChecked(forecastSink{
+			forecaster: NewForecaster(o.ForecastInterval, o.Forecast, o.Season, now),
+			format:     format,
+			json:       o.JSONMetrics,
+			locale:     locale,
+		})
+
+	case o.Arrivals:
+		pipeline.AddChecked(arrivalsSink{
+			arrivals: NewArrivals(now),
+			json:     o.JSONMetrics,
+			locale:   locale,
+		})
+
+	case o.Params > 0:
+		pipeline.AddChecked(paramsSink{
+			params: NewParams(o.Params, o.ParamsPath),
+			json:   o.JSONMetrics,
+			locale: locale,
+		})
+
+	case o.Impact > 0:
+		pipeline.AddChecked(impactSink{
+			groups:     NewGroupAccumulator("url", now, percentiles),
+			budget:     o.Impact,
+			percentile: o.ImpactPercentile,
+			json:       o.JSONMetrics,
+			locale:     locale,
+		})
+
+	case o.Threats > 0:
+		pipeline.AddChecked(threatsSink{
+			threats: NewThreats(threatFeeds, o.Threats, now),
+			json:    o.JSONMetrics,
+			locale:  locale,
+		})
+
+	case o.KeepAlive > 0:
+		pipeline.AddChecked(keepAliveSink{
+			keepAlive: NewKeepAlive(o.KeepAlive, now),
+			json:      o.JSONMetrics,
+			locale:    locale,
+		})
+
+	case o.Capacity > 0:
+		pipeline.AddChecked(capacitySink{
+			capacity: NewCapacity(o.Capacity, o.CapacityHeadroom, o.CapacityWorkers, now),
+			json:     o.JSONMetrics,
+			locale:   locale,
+		})
+
+	case o.Quotas > 0:
+		pipeline.AddChecked(quotasSink{
+			quotas: NewQuotas(o.Quotas, o.Quota, o.QuotaPeriod, quotas, now),
+			json:   o.JSONMetrics,
+			locale: locale,
+		})
+
+	case o.Clients > 0:
+		pipeline.AddChecked(clientsSink{
+			clients: NewClients(o.Clients, o.ClientRate, now),
+			privacy: privacy,
+			json:    o.JSONMetrics,
+			locale:  locale,
+		})
+
+	case o.Folded:
+		pipeline.AddChecked(foldedSink{stacks: NewFoldedStacks()})
+
+	case growth != nil:
+		pipeline.AddChecked(growthSink{
+			growth: growth,
+			state:  o.GrowthState,
+			dryRun: dryRun,
+			json:   o.JSONMetrics,
+			locale: locale,
+		})
+
+	case allowlist != nil:
+		pipeline.AddChecked(conformanceSink{
+			conformance: NewConformance(allowlist),
+			issues:      issues,
+			json:        o.JSONMetrics,
+			locale:      locale,
+		})
+
+	case o.Tree:
+		pipeline.AddChecked(treeSink{
+			tree:   NewTree(o.TreeDepth, percentiles),
+			json:   o.JSONMetrics,
+			locale: locale,
+		})
+
+	case o.Crawlers:
+		pipeline.AddChecked(crawlersSink{
+			crawlers: NewCrawlers(crawlers),
+			json:     o.JSONMetrics,
+			locale:   locale,
+		})
+
+	case o.Episodes > 0:
+		pipeline.AddChecked(episodesSink{
+			episodes: NewEpisodes(o.Episodes, o.EpisodeMin, o.EpisodesPerRoute, now),
+			json:     o.JSONMetrics,
+			locale:   locale,
+		})
+
+	case o.Anomaly.Interval > 0:
+		var sink Sink = anomaliesSink{
+			anomalies: NewAnomalies(o.Anomaly, now),
+			json:      o.JSONMetrics,
+			locale:    locale,
+		}
+		if loadTests != nil {
+			sink = excludingSink{sink, loadTests.Exclude("anomalies", sink.Add)}
+		}
+		pipeline.AddChecked(sink)
+
+	case o.Interval > 0:
+		pipeline.AddChecked(seriesSink{
+			series: NewTimeSeries(o.Interval, now, annotations),
+			format: format,
+			json:   o.JSONMetrics,
+			locale: locale,
+		})
+
+	case o.Heatmap > 0:
+		bounds := heatmapBuckets
+		if o.BucketsList != "" {
+			bounds = buckets
+		}
+		pipeline.AddChecked(heatmapSink{
+			heatmap: NewHeatmap(o.Heatmap, bounds, now, annotations),
+			svg:     strings.HasSuffix(strings.ToLower(o.OutputFile), ".svg"),
+			json:    o.JSONMetrics,
+			locale:  locale,
+		})
+
+	case o.Histogram:
+		pipeline.AddChecked(histogramSink{
+			histogram: NewHistogram(buckets),
+			json:      o.JSONMetrics,
+			locale:    locale,
+		})
+
+	case o.GroupBy != "":
+		pipeline.AddChecked(groupSink{
+			groups:  NewGroupAccumulator(o.GroupBy, now, percentiles),
+			by:      o.GroupBy,
+			json:    o.JSONMetrics,
+			locale:  locale,
+			having:  having,
+			privacy: privacy,
+		})
+
+	default:
+		pipeline.AddChecked(metricsSink{
+			metrics:  NewMetricsAccumulator(now, percentiles),
+			pipeline: pipeline,
+			json:     o.JSONMetrics,
+			template: tmpl,
+			locale:   locale,
+		})
+	}
+
+	// Input offsets, records written as they are read are committed
+	// per chunk, other output once it is finished
+	var hooks OffsetHooks
+	var offsets *offsetPrinter
+	if o.PrintOffsets {
+		streaming := isRecordFormat(format) && format != "parquet" && format != "binary" && !aggregated && o.Top == "" && o.SortBy == "" && o.Tail == 0 && o.EmailTo == ""
+		offsets = &offsetPrinter{w: os.Stderr, streaming: streaming}
+		hooks = offsets
+	}
+
+	// Parsing input and passing records to pipeline
+	if err := readRecords(input, o.Workers, accept, pipeline.Write, hooks); err != nil {
+		fmt.Fprintf(os.Stderr, "Error %v\n", err)
+		return 1
+	}
+
+	// Output
+	if err := pipeline.Finish(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error %v\n", err)
+		return 1
+	}
+
+	if offsets != nil {
+		if err := offsets.Finish(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error %v\n", err)
+			return 1
+		}
+	}
+
+	return 0
 }
 
-// Duration formatting
-func formatDuration(d time.Duration) string {
-	if d < time.Microsecond {
-		return fmt.Sprintf("%.3fns", float64(d.Nanoseconds()))
+// Running with -o and -dry-run, output is counted instead of written
+func runDryRunOutput(o *Options, args []string, issues *Issues, dryRun *DryRun) int {
+	unit := "lines"
+	if o.FormatName == "parquet" || o.FormatName == "binary" {
+		unit = ""
+	}
+	target := dryRun.File(o.OutputFile, unit, o.Append)
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error opening output: %v\n", err)
+		return 1
+	}
+	counted := make(chan struct{})
+	go func() {
+		io.Copy(dryRunLineWriter{target: target}, r)
+		close(counted)
+	}()
 
-	} else if d < time.Millisecond {
-		return fmt.Sprintf("%.3fµs", float64(d.Microseconds()))
+	stdout := os.Stdout
+	os.Stdout = w
+	code := run(o, args, issues, dryRun)
+	os.Stdout = stdout
 
-	} else if d < time.Second {
-		return fmt.Sprintf("%.3fms", float64(d.Milliseconds()))
+	w.Close()
+	<-counted
+	r.Close()
+	return code
+}
+
+// Reporting dry run, exit code of failed checks is returned
+func reportDryRun(dryRun *DryRun) int {
+	if dryRun == nil {
+		return 0
 	}
 
-	return fmt.Sprintf("%.3fs", d.Seconds())
+	if err := dryRun.Report(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error in dry run: %v\n", err)
+		return 1
+	}
+	return 0
 }
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"testing"
+)
+
+// Running command line like main does, returns stdout and exit code.
+// Zones of -tz are reset after run.
+func runCommandLine(t *testing.T, args ...string) (string, int) {
+	t.Helper()
+	t.Cleanup(func() { inputZone, displayZone = nil, nil })
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+
+	var out bytes.Buffer
+	done := make(chan struct{})
+	go func() {
+		io.Copy(&out, r)
+		close(done)
+	}()
+
+	o, rest := parseCommandLine(args)
+	issues := NewIssues()
+	code := run(o, rest, issues, nil)
+	if code == 0 {
+		code = issues.Summary().ExitCode
+	}
+
+	w.Close()
+	<-done
+	r.Close()
+	return out.String(), code
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"container/heap"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// Lines of merged input after which lines not parsed are no longer
+// located in their input, they are parsed long before
+const mergeLocateLines = 1 << 20
+
+// Input of merge with its next line
+type mergeInput struct {
+	name   string
+	reader *lineReader
+	closer io.Closer
+	offset *offsetReader
+
+	// Next line and its timestamp, lines without timestamp get
+	// timestamp of line before, so they stay next to it
+	line string
+	date time.Time
+
+	// Number of line in input, and is line not parsed as request
+	number int
+	failed bool
+
+	// Order of input, ties keep argument order
+	index int
+}
+
+// Inputs by timestamp of next line
+type mergeHeap []*mergeInput
+
+func (h mergeHeap) Len() int { return len(h) }
+func (h mergeHeap) Less(i, j int) bool {
+	if !h[i].date.Equal(h[j].date) {
+		return h[i].date.Before(h[j].date)
+	}
+	return h[i].index < h[j].index
+}
+func (h mergeHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+func (h *mergeHeap) Push(x any)   { *h = append(*h, x.(*mergeInput)) }
+
+func (h *mergeHeap) Pop() any {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
+// Reader of several inputs merged by timestamp (-merge), like
+// sort -m. Each input is expected to be in time order already, as
+// rotated files and logs of one instance are, so only next line of
+// every input is kept. Unreadable inputs are skipped and recorded,
+// with -fail-on-partial reading fails instead.
+type mergeReader struct {
+	inputs  mergeHeap
+	format  LineFormat
+	issues  *Issues
+	pending []byte
+	err     error
+
+	// Lines read, and input and line number of lines not parsed,
+	// so skipped lines are reported with line of their input
+	mu     sync.Mutex
+	lines  int
+	failed map[int]mergeLine
+}
+
+// Line of merge input
+type mergeLine struct {
+	name   string
+	number int
+}
+
+func openMerged(names []string, format LineFormat, issues *Issues) *mergeReader {
+	r := &mergeReader{format: format, issues: issues, failed: make(map[int]mergeLine)}
+	issues.locate = r.locate
+	for i, name := range names {
+		input, err := openInput(name, issues)
+		if err != nil {
+			r.skip(name, nil, err)
+			continue
+		}
+
+		in := &mergeInput{name: name, reader: newLineReader(input), closer: input, index: i}
+		if opened, ok := input.(openedInput); ok {
+			in.offset = opened.offset
+		}
+		if r.advance(in) {
+			r.inputs = append(r.inputs, in)
+		}
+	}
+	heap.Init(&r.inputs)
+	return r
+}
+
+// Reading next line of input, false at its end
+func (r *mergeReader) advance(in *mergeInput) bool {
+	line, _, err := in.reader.ReadLine()
+	if err != nil {
+		if err != io.EOF {
+			r.skip(in.name, in.offset, err)
+		}
+		in.closer.Close()
+		return false
+	}
+
+	in.line = line
+	in.number++
+	record, err := r.format.Parse(in.line)
+	if err == nil {
+		in.date = record.Date
+	}
+	in.failed = err != nil && !ignoredLine(line) && !errors.Is(err, errIgnoredLine)
+	return true
+}
+
+// Input and its line number of line of merged input, lines not parsed
+// are located once
+func (r *mergeReader) locate(number int) (string, int, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	line, ok := r.failed[number]
+	delete(r.failed, number)
+	return line.name, line.number, ok
+}
+
+// Remembering input of line not parsed. Lines dropped before parsing
+// (-sample) are never located, they are forgotten when far behind.
+func (r *mergeReader) remember(in *mergeInput) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.lines++
+	if in.failed {
+		r.failed[r.lines] = mergeLine{in.name, in.number}
+	}
+	if r.lines%mergeLocateLines == 0 {
+		for number := range r.failed {
+			if number < r.lines-mergeLocateLines {
+				delete(r.failed, number)
+			}
+		}
+	}
+}
+
+// Recording unreadable input, rest of it is skipped
+func (r *mergeReader) skip(name string, offset *offsetReader, err error) {
+	detail := unreadableDetail(name, offset, err)
+	if r.issues.FailOnPartial {
+		if r.err == nil {
+			r.err = errors.New(detail)
+		}
+		return
+	}
+	fmt.Fprintf(os.Stderr, "Skipping input %s\n", detail)
+	r.issues.Add(issueUnreadable, detail)
+}
+
+// Reading merged lines, as many as fit into p, so readers
+// don't see input running dry after every line
+func (r *mergeReader) Read(p []byte) (int, error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+	n := copy(p, r.pending)
+	r.pending = r.pending[n:]
+
+	for n < len(p) && len(r.inputs) > 0 {
+		in := r.inputs[0]
+		r.pending = append(append(r.pending[:0], in.line...), '\n')
+		r.remember(in)
+		if r.advance(in) {
+			heap.Fix(&r.inputs, 0)
+		} else {
+			heap.Pop(&r.inputs)
+		}
+
+		copied := copy(p[n:], r.pending)
+		r.pending = r.pending[copied:]
+		n += copied
+	}
+
+	if n == 0 {
+		return 0, io.EOF
+	}
+	return n, nil
+}
+
+func (r *mergeReader) Close() error {
+	for _, in := range r.inputs {
+		in.closer.Close()
+	}
+	r.inputs = nil
+	return nil
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestMergeByTimestamp(t *testing.T) {
+	first := writeFile(t, "a.log", ginLine("10:00:01", "/a1")+ginLine("10:00:03", "/a3")+"[GIN-debug] after a3\n"+ginLine("10:00:05", "/a5"))
+	second := writeFile(t, "b.log", ginLine("10:00:02", "/b2")+ginLine("10:00:03", "/b3")+ginLine("10:00:06", "/b6"))
+
+	issues := NewIssues()
+	r := openMerged([]string{first, second}, ginFormat{}, issues)
+	defer r.Close()
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, line := range strings.Split(strings.TrimSuffix(string(data), "\n"), "\n") {
+		if record, err := parseLine(line); err == nil {
+			got = append(got, record.URL)
+		} else {
+			got = append(got, line)
+		}
+	}
+
+	// Ties keep argument order, line without timestamp stays after its line
+	want := []string{"/a1", "/b2", "/a3", "[GIN-debug] after a3", "/b3", "/a5", "/b6"}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("merged order\ngot  %q\nwant %q", got, want)
+	}
+	if summary := issues.Summary(); summary.ExitCode != 0 {
+		t.Errorf("issues %+v, want none", summary.Issues)
+	}
+}
+
+func TestMergeSkipsMissingInput(t *testing.T) {
+	input := writeFile(t, "a.log", ginLine("10:00:01", "/a1"))
+	missing := filepath.Join(t.TempDir(), "missing.log")
+
+	issues := NewIssues()
+	r := openMerged([]string{missing, input}, ginFormat{}, issues)
+	data, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != ginLine("10:00:01", "/a1") {
+		t.Errorf("got %q", data)
+	}
+
+	summary := issues.Summary()
+	if len(summary.Issues) != 1 || summary.Issues[0].Class != issueUnreadable.name ||
+		!strings.Contains(summary.Issues[0].Details[0], "missing.log") {
+		t.Errorf("issues %+v, want unreadable missing.log", summary.Issues)
+	}
+
+	issues = NewIssues()
+	issues.FailOnPartial = true
+	if _, err := io.ReadAll(openMerged([]string{missing, input}, ginFormat{}, issues)); err == nil {
+		t.Error("reading succeeded with -fail-on-partial")
+	}
+}
+
+// Skipped lines name their input and line in it, not line of merged input
+func TestMergeLocatesSkippedLines(t *testing.T) {
+	first := writeFile(t, "a.log", ginLine("10:00:01", "/a1")+ginLine("10:00:03", "/a3"))
+	second := writeFile(t, "b.log", ginLine("10:00:02", "/b2")+"garbage\n"+ginLine("10:00:04", "/b4"))
+
+	issues := NewIssues()
+	r := openMerged([]string{first, second}, ginFormat{}, issues)
+	defer r.Close()
+
+	accept := func(line string, number int) (LogRecord, bool, error) {
+		record, err := parseLine(line)
+		if err != nil {
+			issues.SkipLine(number, line, err)
+		}
+		return record, err == nil, nil
+	}
+	if err := readRecords(r, 4, accept, func(LogRecord) error { return nil }, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	summary := issues.Summary()
+	if len(summary.Issues) != 1 || len(summary.Issues[0].Details) != 1 ||
+		!strings.HasPrefix(summary.Issues[0].Details[0], second+" line 2:") {
+		t.Errorf("issues %+v, want skipped line 2 of b.log", summary.Issues)
+	}
+}
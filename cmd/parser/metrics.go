@@ -0,0 +1,200 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Struct of metrics
+type Metrics struct {
+	Count        int            `json:"count"`
+	TotalTime    time.Duration  `json:"total_time"`
+	MinTime      time.Duration  `json:"min_time"`
+	MaxTime      time.Duration  `json:"max_time"`
+	StatusCounts map[int]int    `json:"status_counts"`
+	ClassCounts  map[string]int `json:"class_counts"`
+	Percentiles  []Percentile   `json:"percentiles"`
+	Errors       int            `json:"errors"`
+	ErrorRate    float64        `json:"error_rate"`
+
+	// Time of first and last record
+	Start time.Time `json:"start,omitzero"`
+	End   time.Time `json:"end,omitzero"`
+
+	// Time span of records and requests per second over it.
+	// Timestamps have second resolution, so span includes last second.
+	Span time.Duration `json:"span"`
+	RPS  float64       `json:"rps"`
+
+	// Records with future or pre-2000 timestamps
+	BadTimestamps int `json:"bad_timestamps"`
+
+	// Records with implausible durations, excluded from metrics
+	Suspicious int `json:"suspicious"`
+
+	// Share of lines of -sample, counts are scaled estimates
+	SampleRate float64 `json:"sample_rate,omitempty"`
+}
+
+// Average request duration
+func (m Metrics) AverageTime() time.Duration {
+	if m.Count == 0 {
+		return 0
+	}
+	return m.TotalTime / time.Duration(m.Count)
+}
+
+// Checking is status code a server error
+func isError(code int) bool {
+	return code >= 500
+}
+
+// Incremental calculation of metrics, records are not kept
+type MetricsAccumulator struct {
+	metrics     Metrics
+	quantiles   Quantiles
+	percentiles []float64
+	now         time.Time
+}
+
+func NewMetricsAccumulator(now time.Time, percentiles []float64) *MetricsAccumulator {
+	return &MetricsAccumulator{
+		metrics:     Metrics{StatusCounts: make(map[int]int)},
+		percentiles: percentiles,
+		now:         now,
+	}
+}
+
+// Adding record to metrics
+func (a *MetricsAccumulator) Add(record LogRecord) {
+	m := &a.metrics
+
+	if m.Count == 0 || record.Duration < m.MinTime {
+		m.MinTime = record.Duration
+	}
+	if record.Duration > m.MaxTime {
+		m.MaxTime = record.Duration
+	}
+
+	m.Count++
+	m.TotalTime += record.Duration
+	m.StatusCounts[record.Code]++
+	a.quantiles.Add(record.Duration)
+
+	if isError(record.Code) {
+		m.Errors++
+	}
+
+	if !plausibleTimestamp(record.Date, a.now) {
+		m.BadTimestamps++
+	} else {
+		if m.Start.IsZero() || record.Date.Before(m.Start) {
+			m.Start = record.Date
+		}
+		if record.Date.After(m.End) {
+			m.End = record.Date
+		}
+	}
+}
+
+// Metrics of records added so far
+func (a *MetricsAccumulator) Metrics() Metrics {
+	metrics := a.metrics
+	metrics.StatusCounts = maps.Clone(a.metrics.StatusCounts)
+
+	metrics.ClassCounts = make(map[string]int)
+	for code, count := range metrics.StatusCounts {
+		metrics.ClassCounts[statusClass(code)] += count
+	}
+
+	if metrics.Count == 0 {
+		return metrics
+	}
+
+	metrics.ErrorRate = float64(metrics.Errors) / float64(metrics.Count)
+
+	// Averages and rates stay as sampled, counts are scaled
+	if sampleRate < 1 {
+		metrics.SampleRate = sampleRate
+		metrics.TotalTime = time.Duration(float64(metrics.TotalTime) / sampleRate)
+		metrics.Count = scaleCount(metrics.Count)
+		metrics.Errors = scaleCount(metrics.Errors)
+		metrics.BadTimestamps = scaleCount(metrics.BadTimestamps)
+		for code, count := range metrics.StatusCounts {
+			metrics.StatusCounts[code] = scaleCount(count)
+		}
+		for class, count := range metrics.ClassCounts {
+			metrics.ClassCounts[class] = scaleCount(count)
+		}
+	}
+
+	if !metrics.Start.IsZero() {
+		metrics.Span = metrics.End.Sub(metrics.Start) + time.Second
+		metrics.RPS = float64(metrics.Count-metrics.BadTimestamps) / metrics.Span.Seconds()
+	}
+
+	for _, p := range a.percentiles {
+		metrics.Percentiles = append(metrics.Percentiles, Percentile{
+			P:     p,
+			Value: a.quantiles.Quantile(p),
+		})
+	}
+
+	return metrics
+}
+
+// Metrics mode output
+func printMetrics(metrics Metrics, locale Locale) {
+	fmt.Printf("Total Requests: %s\n", locale.Int(metrics.Count))
+	if metrics.SampleRate > 0 {
+		fmt.Printf("Sampled: %s of lines, counts are estimates\n", locale.Percent(metrics.SampleRate))
+	}
+
+	if metrics.Count == 0 {
+		if metrics.Suspicious > 0 {
+			fmt.Printf("Suspicious Durations: %s (excluded, use -keep-suspicious to include)\n", locale.Int(metrics.Suspicious))
+		}
+		return
+	}
+
+	if !metrics.Start.IsZero() {
+		fmt.Printf("Time Span: %s to %s (%s)\n", locale.FormatDateTime(metrics.Start), locale.FormatDateTime(metrics.End), locale.Duration(metrics.Span))
+		fmt.Printf("Requests/sec: %s\n", locale.Float(metrics.RPS, 2))
+	}
+
+	fmt.Printf("Total Time: %s\n", locale.Duration(metrics.TotalTime))
+	duration := func(d time.Duration) string {
+		return colorize(locale.Duration(d), durationColor(d))
+	}
+	fmt.Printf("Average Time: %s\n", duration(metrics.AverageTime()))
+	fmt.Printf("Min Time: %s\n", duration(metrics.MinTime))
+	fmt.Printf("Max Time: %s\n", duration(metrics.MaxTime))
+
+	for _, p := range metrics.Percentiles {
+		fmt.Printf("%s Time: %s\n", strings.ToUpper(percentileLabel(p.P)), duration(p.Value))
+	}
+	fmt.Printf("Error Rate: %s (%s)\n", colorize(locale.Percent(metrics.ErrorRate), errorRateColor(metrics.ErrorRate)), locale.Int(metrics.Errors))
+	fmt.Println("\nStatus Code Distribution:")
+
+	for code, count := range metrics.StatusCounts {
+		fmt.Printf("  %s: %s\n", colorize(strconv.Itoa(code), codeColor(code)), locale.Int(count))
+	}
+
+	fmt.Println("\nStatus Class Distribution:")
+	for _, class := range slices.Sorted(maps.Keys(metrics.ClassCounts)) {
+		count := metrics.ClassCounts[class]
+		fmt.Printf("  %s: %s (%s)\n", colorize(class, codeColor(int(class[0]-'0')*100)), locale.Int(count), locale.Percent(float64(count)/float64(metrics.Count)))
+	}
+
+	if metrics.Suspicious > 0 {
+		fmt.Printf("\nSuspicious Durations: %s (excluded, use -keep-suspicious to include)\n", locale.Int(metrics.Suspicious))
+	}
+
+	if metrics.BadTimestamps > 0 {
+		fmt.Printf("\nSuspicious Timestamps: %s (future or before 2000)\n", locale.Int(metrics.BadTimestamps))
+	}
+}
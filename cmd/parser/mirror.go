@@ -0,0 +1,214 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"io"
+	"maps"
+	"math"
+	"os"
+	"slices"
+	"time"
+)
+
+// Status codes of primary and shadow differing in matched requests
+type StatusDivergence struct {
+	Primary int    `json:"primary"`
+	Shadow  int    `json:"shadow"`
+	Count   int    `json:"count"`
+	Example string `json:"example"`
+}
+
+// Matched requests of route
+type MirrorRoute struct {
+	Route       string        `json:"route"`
+	Matched     int           `json:"matched"`
+	StatusDiffs int           `json:"status_diffs"`
+	PrimaryP50  time.Duration `json:"primary_p50"`
+	ShadowP50   time.Duration `json:"shadow_p50"`
+	Change      float64       `json:"change"`
+	Slower      int           `json:"slower"`
+	Faster      int           `json:"faster"`
+}
+
+// Comparison of primary and shadow deployment
+type MirrorReport struct {
+	Window    time.Duration `json:"window"`
+	Tolerance float64       `json:"tolerance"`
+
+	Primary          int `json:"primary"`
+	Shadow           int `json:"shadow"`
+	Matched          int `json:"matched"`
+	UnmatchedPrimary int `json:"unmatched_primary"`
+	UnmatchedShadow  int `json:"unmatched_shadow"`
+
+	// Matched requests with other status, and with shadow latency
+	// beyond tolerance of primary one
+	StatusDiffs int `json:"status_diffs"`
+	Slower      int `json:"slower"`
+	Faster      int `json:"faster"`
+
+	Statuses []StatusDivergence `json:"statuses"`
+	Routes   []MirrorRoute      `json:"routes"`
+}
+
+// Durations of matched requests of route
+type mirrorRoute struct {
+	MirrorRoute
+	primary, shadow []time.Duration
+}
+
+// Matching requests of shadow deployment receiving mirrored traffic
+// with requests of primary (mirror command). Requests of same method
+// and route are matched in time order when their times are at most
+// window apart, so requests only one side got stay unmatched instead
+// of shifting every later pair. Status of matched requests is compared
+// exactly, latency with relative tolerance.
+func compareMirror(primary, shadow []LogRecord, window time.Duration, tolerance float64) MirrorReport {
+	report := MirrorReport{Window: window, Tolerance: tolerance, Primary: len(primary), Shadow: len(shadow), Statuses: []StatusDivergence{}, Routes: []MirrorRoute{}}
+
+	byKey := func(records []LogRecord) map[string][]LogRecord {
+		keys := make(map[string][]LogRecord)
+		for _, r := range records {
+			key := r.Method + " " + groupKey(r, "url")
+			keys[key] = append(keys[key], r)
+		}
+		for _, list := range keys {
+			slices.SortStableFunc(list, func(a, b LogRecord) int { return a.Date.Compare(b.Date) })
+		}
+		return keys
+	}
+	primaryKeys, shadowKeys := byKey(primary), byKey(shadow)
+
+	routes := make(map[string]*mirrorRoute)
+	statuses := make(map[[2]int]*StatusDivergence)
+	for key, p := range primaryKeys {
+		s := shadowKeys[key]
+		for i, j := 0, 0; i < len(p) && j < len(s); {
+			gap := s[j].Date.Sub(p[i].Date)
+			switch {
+			case gap < -window:
+				j++
+				continue
+			case gap > window:
+				i++
+				continue
+			}
+
+			route := groupKey(p[i], "url")
+			r, ok := routes[route]
+			if !ok {
+				r = &mirrorRoute{MirrorRoute: MirrorRoute{Route: route}}
+				routes[route] = r
+			}
+			r.Matched++
+			report.Matched++
+			r.primary = append(r.primary, p[i].Duration)
+			r.shadow = append(r.shadow, s[j].Duration)
+
+			if p[i].Code != s[j].Code {
+				r.StatusDiffs++
+				report.StatusDiffs++
+				codes := [2]int{p[i].Code, s[j].Code}
+				if statuses[codes] == nil {
+					statuses[codes] = &StatusDivergence{Primary: codes[0], Shadow: codes[1], Example: p[i].Method + " " + p[i].URL}
+				}
+				statuses[codes].Count++
+			}
+
+			limit := float64(p[i].Duration) * tolerance
+			switch diff := float64(s[j].Duration - p[i].Duration); {
+			case diff > limit:
+				r.Slower++
+				report.Slower++
+			case -diff > limit:
+				r.Faster++
+				report.Faster++
+			}
+			i++
+			j++
+		}
+	}
+	report.UnmatchedPrimary = report.Primary - report.Matched
+	report.UnmatchedShadow = report.Shadow - report.Matched
+
+	for _, s := range statuses {
+		report.Statuses = append(report.Statuses, *s)
+	}
+	slices.SortFunc(report.Statuses, func(a, b StatusDivergence) int {
+		return cmp.Or(cmp.Compare(b.Count, a.Count), cmp.Compare(a.Primary, b.Primary), cmp.Compare(a.Shadow, b.Shadow))
+	})
+
+	for _, name := range slices.Sorted(maps.Keys(routes)) {
+		r := routes[name]
+		r.PrimaryP50, r.ShadowP50 = median(r.primary), median(r.shadow)
+		if r.PrimaryP50 > 0 {
+			r.Change = float64(r.ShadowP50-r.PrimaryP50) / float64(r.PrimaryP50)
+		}
+		report.Routes = append(report.Routes, r.MirrorRoute)
+	}
+	slices.SortStableFunc(report.Routes, func(a, b MirrorRoute) int {
+		return cmp.Or(cmp.Compare(b.StatusDiffs, a.StatusDiffs), cmp.Compare(math.Abs(b.Change), math.Abs(a.Change)))
+	})
+	return report
+}
+
+// Reading records of input, accepted by filters
+func readInputRecords(name string, limit func(io.Reader) io.Reader, workers int, accept func(line string, number int) (LogRecord, bool, error)) ([]LogRecord, error) {
+	input, err := openInput(name, nil)
+	if err != nil {
+		return nil, fmt.Errorf("opening input: %w", err)
+	}
+	defer input.Close()
+
+	var records []LogRecord
+	err = readRecords(limit(input), workers, accept, func(record LogRecord) error {
+		records = append(records, record)
+		return nil
+	}, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return records, nil
+}
+
+// Mirror comparison output
+func printMirror(report MirrorReport, locale Locale) {
+	fmt.Printf("Mirror comparison, requests of same method and route at most %v apart are matched:\n\n", report.Window)
+	fmt.Printf("Primary: %s requests, shadow: %s requests\n", locale.Int(report.Primary), locale.Int(report.Shadow))
+	fmt.Printf("Matched: %s (%s of primary), unmatched primary %s, unmatched shadow %s\n",
+		locale.Int(report.Matched), locale.Percent(ratio(float64(report.Matched), float64(report.Primary))),
+		locale.Int(report.UnmatchedPrimary), locale.Int(report.UnmatchedShadow))
+	if report.Matched == 0 {
+		return
+	}
+
+	tolerance := locale.Percent(report.Tolerance)
+	fmt.Printf("Status differs: %s (%s)\n", locale.Int(report.StatusDiffs), locale.Percent(ratio(float64(report.StatusDiffs), float64(report.Matched))))
+	fmt.Printf("Shadow slower by more than %s: %s, faster: %s\n", tolerance, locale.Int(report.Slower), locale.Int(report.Faster))
+
+	if len(report.Statuses) > 0 {
+		w := newTable(os.Stdout)
+		fmt.Fprintf(w, "\nPRIMARY\tSHADOW\tCOUNT\tEXAMPLE\n")
+		for _, s := range report.Statuses {
+			fmt.Fprintf(w, "%d\t%d\t%s\t%s\n", s.Primary, s.Shadow, locale.Int(s.Count), s.Example)
+		}
+		w.Flush()
+	}
+
+	w := newTable(os.Stdout)
+	fmt.Fprintf(w, "\nROUTE\tMATCHED\tSTATUS DIFFS\tP50 PRIMARY\tP50 SHADOW\tCHANGE\tSLOWER\tFASTER\n")
+	for _, r := range report.Routes {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			r.Route,
+			locale.Int(r.Matched),
+			locale.Int(r.StatusDiffs),
+			locale.Duration(r.PrimaryP50),
+			locale.Duration(r.ShadowP50),
+			signed(locale.Percent(r.Change), r.Change),
+			locale.Int(r.Slower),
+			locale.Int(r.Faster),
+		)
+	}
+	w.Flush()
+}
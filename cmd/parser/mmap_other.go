@@ -0,0 +1,21 @@
+//go:build !unix
+
+package main
+
+import (
+	"io"
+	"os"
+)
+
+// Reading file whole where mmap isn't available
+func mapFile(file *os.File, size int) ([]byte, error) {
+	data := make([]byte, size)
+	if _, err := io.ReadFull(io.NewSectionReader(file, 0, int64(size)), data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func unmapFile(data []byte) error {
+	return nil
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Common and Combined Log Format of nginx and Apache:
+//
+//	127.0.0.1 - frank [10/Oct/2000:13:55:36 -0700] "GET /a.gif HTTP/1.0" 200 2326 "http://ref/" "curl/8.0" 0.012
+//
+// Referer and user agent are optional (Common format). Trailing request
+// time in seconds, like nginx $request_time, is taken as duration,
+// otherwise duration is 0.
+var combinedLine = regexp.MustCompile(`^(\S+) \S+ (\S+) \[([^\]]+)\] "((?:[^"\\]|\\.)*)" (\d{3}) (\d+|-)(?: "((?:[^"\\]|\\.)*)" "((?:[^"\\]|\\.)*)")?(.*)$`)
+
+// Layout of Common Log Format timestamp
+const combinedTimeLayout = "02/Jan/2006:15:04:05 -0700"
+
+// Nginx and Apache access log format
+type combinedFormat struct{}
+
+func (combinedFormat) Parse(line string) (LogRecord, error) {
+	m := combinedLine.FindStringSubmatch(strings.TrimSpace(line))
+	if m == nil {
+		return LogRecord{}, fmt.Errorf("invalid format")
+	}
+
+	date, err := time.Parse(combinedTimeLayout, m[3])
+	if err != nil {
+		return LogRecord{}, err
+	}
+
+	code, err := strconv.Atoi(m[5])
+	if err != nil {
+		return LogRecord{}, err
+	}
+
+	size := m[6]
+	if size == "-" {
+		size = "0"
+	}
+
+	record := LogRecord{
+		Date:   zonedTime(date),
+		Code:   code,
+		IP:     m[1],
+		Fields: map[string]string{"body_size": size},
+	}
+
+	// Malformed requests (TLS handshakes, scanners) are kept without method and URL
+	if parts := strings.Fields(m[4]); len(parts) == 3 {
+		record.Method, record.URL = parts[0], parts[1]
+		record.Fields["proto"] = parts[2]
+	}
+
+	if m[2] != "-" {
+		record.Fields["user"] = m[2]
+	}
+	if m[7] != "" || m[8] != "" {
+		record.Fields["referer"] = unescapeQuoted(m[7])
+		record.Fields["user_agent"] = unescapeQuoted(m[8])
+	}
+
+	if rest := strings.Fields(m[9]); len(rest) > 0 {
+		if seconds, err := strconv.ParseFloat(rest[0], 64); err == nil {
+			record.Duration = time.Duration(seconds * float64(time.Second))
+		}
+	}
+
+	return record, nil
+}
+
+// Unescaping quoted log value
+var quotedEscapes = strings.NewReplacer(`\"`, `"`, `\\`, `\`)
+
+func unescapeQuoted(value string) string {
+	return quotedEscapes.Replace(value)
+}
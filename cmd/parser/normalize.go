@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+var (
+	numericSegment = regexp.MustCompile(`^\d+$`)
+	uuidSegment    = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+	hashSegment    = regexp.MustCompile(`^[0-9a-fA-F]{16,}$`)
+)
+
+// Route pattern in gin syntax, e.g. /users/:id or /static/*filepath
+type RoutePattern struct {
+	Pattern  string
+	segments []string
+}
+
+// Route normalizer, maps URLs with path parameters to route templates
+type Normalizer struct {
+	Patterns []RoutePattern
+}
+
+// Loading route patterns from file, one per line.
+// Empty lines and lines starting with # are ignored, an optional
+// method before the pattern (as printed by [GIN-debug]) is skipped.
+func loadRoutes(path string) ([]RoutePattern, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var patterns []RoutePattern
+	scanner := bufio.NewScanner(file)
+
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		pattern := fields[len(fields)-1]
+		if !strings.HasPrefix(pattern, "/") {
+			return nil, fmt.Errorf("%s:%d: route must start with /", path, n)
+		}
+
+		patterns = append(patterns, RoutePattern{
+			Pattern:  pattern,
+			segments: splitPath(pattern),
+		})
+	}
+
+	return patterns, scanner.Err()
+}
+
+// Normalizing URL to route template.
+// Query string is dropped, user patterns are tried in order before
+// the built-in heuristics.
+func (n *Normalizer) Normalize(url string) string {
+	path, _, _ := strings.Cut(url, "?")
+	segments := splitPath(path)
+
+	for _, pattern := range n.Patterns {
+		if pattern.match(segments) {
+			return pattern.Pattern
+		}
+	}
+
+	for i, segment := range segments {
+		switch {
+		case numericSegment.MatchString(segment):
+			segments[i] = ":id"
+		case uuidSegment.MatchString(segment):
+			segments[i] = ":uuid"
+		case hashSegment.MatchString(segment):
+			segments[i] = ":hash"
+		}
+	}
+
+	route := "/" + strings.Join(segments, "/")
+	if strings.HasSuffix(path, "/") && len(segments) > 0 {
+		route += "/"
+	}
+	return route
+}
+
+// Checking is path segments matching pattern
+func (p RoutePattern) match(segments []string) bool {
+	for i, part := range p.segments {
+		if strings.HasPrefix(part, "*") {
+			return true
+		}
+		if i >= len(segments) {
+			return false
+		}
+		if !strings.HasPrefix(part, ":") && part != segments[i] {
+			return false
+		}
+	}
+
+	return len(segments) == len(p.segments)
+}
+
+// Splitting path into non-empty segments
+func splitPath(path string) []string {
+	var segments []string
+	for _, segment := range strings.Split(path, "/") {
+		if segment != "" {
+			segments = append(segments, segment)
+		}
+	}
+	return segments
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"io"
+)
+
+// Hooks around delivery of input, for external tailers bookmarking
+// how far input was processed.
+//
+// Begin is called before records parsed from input bytes [start, end)
+// are written, Commit after all of them were written. Offsets count
+// bytes of input as it is read (decompressed, inputs given as arguments
+// concatenated with newline added after each), so reading can be resumed
+// at end of last commit without losing records.
+type OffsetHooks interface {
+	Begin(start, end int64) error
+	Commit(end int64) error
+}
+
+// Offsets of -print-offsets.
+// Output which is not written until end of input (sorted or tailed
+// records, reports) is committed once, when it is finished.
+type offsetPrinter struct {
+	w         io.Writer
+	streaming bool
+	end       int64
+}
+
+func (p *offsetPrinter) Begin(start, end int64) error {
+	if !p.streaming {
+		return nil
+	}
+	_, err := fmt.Fprintf(p.w, "offset begin %d %d\n", start, end)
+	return err
+}
+
+func (p *offsetPrinter) Commit(end int64) error {
+	p.end = end
+	if !p.streaming {
+		return nil
+	}
+	_, err := fmt.Fprintf(p.w, "offset commit %d\n", end)
+	return err
+}
+
+// Committing whole input after output is finished
+func (p *offsetPrinter) Finish() error {
+	if p.streaming {
+		return nil
+	}
+	if _, err := fmt.Fprintf(p.w, "offset begin 0 %d\n", p.end); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(p.w, "offset commit %d\n", p.end)
+	return err
+}
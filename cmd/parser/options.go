@@ -0,0 +1,632 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"runtime"
+	"time"
+)
+
+// Command line options, shared by subcommands and legacy flags
+type Options struct {
+	// Filters
+	Method, Date, URL, IP string
+	URLPrefix, URLRegex   string
+	Param                 string
+	Class                 string
+	MinDuration           string
+	MaxDuration           string
+	FilterExpr, Where     string
+	From, To              string
+	SkipPaths             string
+	Code                  string
+
+	// Threat-intel IP lists, records from listed IPs are tagged
+	ThreatFeeds listFlag
+	ThreatOnly  bool
+
+	// Sources of user field, e.g. field:api_key or param:key
+	User string
+
+	// Schedule and tags of load tests, left out of anomalies, alerts
+	// and availability
+	LoadTestsSource string
+
+	// Explaining filters, records dropped per filter, and their
+	// evaluation counts and time
+	Explain      bool
+	ExplainEvery int
+	Profile      bool
+
+	// Input
+	FollowFile                                   string
+	InputFormat, Pattern                         string
+	ContainerTime                                bool
+	ArchiveFile, ArchiveMembers, ArchivePassword string
+	SSHFile                                      string
+	SSHCompress                                  bool
+	ListenSyslog                                 string
+	Workers                                      int
+	LowMemory                                    bool
+	TZ, DisplayTZ                                string
+	Strict, ReportErrors                         bool
+	FailOnPartial                                bool
+	Merge                                        bool
+	Sample                                       float64
+	SampleEvery                                  int
+	PrintOffsets                                 bool
+	CompareSources                               bool
+
+	// Limits of input read in one run
+	MaxLines   int
+	MaxBytes   sizeFlag
+	MaxRuntime time.Duration
+
+	// Longest line read whole
+	MaxLineSize sizeFlag
+
+	// Compare command, baseline window replaces second input
+	Compare                  bool
+	BaselineFrom, BaselineTo string
+
+	// Wait for other runs writing same file or database
+	LockTimeout time.Duration
+
+	// Check command, rules failing it like alert rules
+	CheckExprs listFlag
+
+	// Repl command, queries are read from stdin
+	Repl bool
+
+	// Incident command, bundle of -from/-to window
+	Incident bool
+
+	// Report command, HTML page with title and interval of its chart
+	HTMLReport     bool
+	ReportTitle    string
+	ReportInterval time.Duration
+
+	// Record-fixtures command, directory of fixtures, their total,
+	// per route limit and format
+	FixturesDir      string
+	FixturesTotal    int
+	FixturesPerRoute int
+	FixturesFormat   string
+
+	// Baseline commands, profile to write or to check against
+	BaselineSave, BaselineAgainst string
+	Tolerance                     string
+
+	// Events mode
+	EventsKind string
+
+	// Dash command, window of live metrics, refresh interval and
+	// number of recent 5xx and slow requests shown, latency budgets
+	// of routes and number of routes of budget burn panel
+	Dash           bool
+	DashWindow     time.Duration
+	DashRefresh    time.Duration
+	DashRecent     int
+	DashBudgets    listFlag
+	DashBurnRoutes int
+
+	// Consume command, topic and interval of metrics output
+	Kafka        *KafkaSpec
+	KafkaFields  string
+	ConsumeEvery time.Duration
+
+	// Files to write block index of (index command)
+	IndexFiles []string
+
+	// Metrics sent to StatsD or Graphite while reading, their prefix,
+	// interval and percentiles per route group of Graphite
+	Emit                 string
+	EmitPrefix           string
+	EmitInterval         time.Duration
+	EmitRoutePercentiles listFlag
+
+	// Records exported to OpenTelemetry collector as spans or
+	// metrics, with service name, headers and metrics interval
+	OTLP         string
+	OTLPSignal   string
+	OTLPService  string
+	OTLPHeaders  listFlag
+	OTLPInterval time.Duration
+	Checkpoint   string
+
+	// Serve mode, address of REST API over records and number of
+	// records it keeps, native histograms of /metrics and snapshot of
+	// earlier exporter counters start from
+	ServeAddr        string
+	APIAddr          string
+	APIRetain        int
+	NativeHistograms bool
+	InitCounters     string
+
+	// Running jobs section of config file in serve mode
+	Jobs bool
+
+	// Rollup to disk
+	RollupDir, RollupPeriod string
+
+	// Interval of percentile series per route, 0 disables it
+	Series time.Duration
+
+	// Interval of availability series and status codes counted as
+	// failures
+	Availability       time.Duration
+	AvailabilityErrors string
+
+	// SQLite database of records
+	SQLiteFile string
+
+	// Output modes
+	Raw                 bool
+	JSON                bool
+	JSONMetrics         bool
+	FormatName          string
+	DerivedFields       string
+	SortBy              string
+	Desc                bool
+	SplitBy, SplitPath  string
+	Limit, Offset, Tail int
+
+	// Template of records or metrics output, inline or in file
+	Template, TemplateFile string
+
+	// Color of terminal output and duration highlighted in it
+	NoColor bool
+	Slow    time.Duration
+
+	// Checking destinations without writing
+	DryRun bool
+
+	// Output file instead of stdout
+	OutputFile string
+	Append     bool
+
+	// Width tables are fitted to, terminal width by default
+	MaxWidth   int
+	NoTruncate bool
+
+	// Summary of non-fatal issues at exit
+	Summary string
+
+	// Preset of config file, expanded before flags are parsed
+	Preset string
+
+	// Email delivery
+	EmailTo string
+	Email   EmailConfig
+
+	// Alerting
+	AlertExprs                listFlag
+	PagerDutyKey, OpsgenieKey string
+	SilencesFile              string
+	AlertState                string
+	AlertDedupPrefix          string
+
+	// Metrics options
+	PercentilesList   string
+	LocaleName        string
+	GroupBy           string
+	Having            string
+	Histogram         bool
+	Arrivals          bool
+	Interval          time.Duration
+	SplitAt           string
+	AnnotationsSource string
+	Alpha             float64
+	BucketsList       string
+	RoutesFile        string
+	Normalize         bool
+
+	// GraphQL endpoints grouped per operation and field with its name
+	GraphQL      listFlag
+	GraphQLField string
+
+	Top            string
+	TopN           int
+	TopOutput      string
+	URLBase        string
+	DurationCap    time.Duration
+	KeepSuspicious bool
+	SuspiciousGaps bool
+
+	// Capacity forecast
+	Forecast, ForecastInterval, Season time.Duration
+
+	// Spike detection, enabled by interval
+	Anomaly AnomalyConfig
+
+	// Client report, number of top clients and flagged request rate
+	Clients, ClientRate int
+
+	// Interval of threat feed report timeline, 0 disables it
+	Threats time.Duration
+
+	// Latency budget of impact report and its percentile
+	Impact           time.Duration
+	ImpactPercentile float64
+
+	// Largest gap of requests of one IP on same connection, 0 disables keep-alive report
+	KeepAlive time.Duration
+
+	// Query parameter report, number of top values, and path or
+	// route it is limited to
+	Params     int
+	ParamsPath string
+
+	// Largest gap of 5xx requests of one error episode, 0 disables
+	// episodes report, and smallest number of errors of episode
+	Episodes         time.Duration
+	EpisodeMin       int
+	EpisodesPerRoute bool
+
+	// Folded stacks of server time per route
+	Folded bool
+
+	// Crawler report and files of crawler IP ranges
+	Crawlers      bool
+	CrawlerRanges listFlag
+
+	// Path tree report and its depth in segments, 0 is unlimited
+	Tree      bool
+	TreeDepth int
+
+	// Unique client growth period and file of client sketches of
+	// earlier runs
+	Growth      string
+	GrowthState string
+
+	// Allowlist of method and route pairs, traffic outside it is reported
+	Conformance string
+
+	// Interval of latency heatmap columns
+	Heatmap time.Duration
+
+	// Quota report of top N users, default quota per period and file
+	// of quotas of users
+	Quotas      int
+	Quota       int
+	QuotaPeriod time.Duration
+	QuotaFile   string
+
+	// k-anonymity threshold and noise of shared reports
+	PrivacyK       int
+	PrivacyEpsilon float64
+
+	// Window of peak of capacity report, headroom factor and workers
+	// of one instance
+	Capacity         time.Duration
+	CapacityHeadroom float64
+	CapacityWorkers  int
+
+	// Mirror command, greatest time apart of matched requests and
+	// latency tolerance of shadow
+	Mirror          bool
+	MirrorWindow    time.Duration
+	MirrorTolerance string
+}
+
+// Checking is report of aggregates selected, other than -top and
+// -compare-sources which main checks on their own
+func (o *Options) reportMode() bool {
+	return o.GroupBy != "" || o.Histogram || o.Interval > 0 || o.SplitAt != "" || o.Forecast > 0 || o.Arrivals || o.Anomaly.Interval > 0 || o.Clients > 0 || o.Params > 0 || o.KeepAlive > 0 || o.Threats > 0 || o.Impact > 0 || o.Episodes > 0 || o.Crawlers || o.Folded || o.Tree || o.Growth != "" || o.Conformance != "" || o.Heatmap > 0 || o.Quotas > 0 || o.Capacity > 0
+}
+
+// Checking is output selected whose counts -sample doesn't scale
+// to estimates, unlike metrics, -group-by, -top, -interval,
+// -histogram, -clients and records
+func (o *Options) unscaledReport() bool {
+	return o.SplitAt != "" || o.Forecast > 0 || o.Arrivals || o.Anomaly.Interval > 0 || o.Params > 0 || o.KeepAlive > 0 || o.Threats > 0 || o.Impact > 0 || o.Episodes > 0 || o.Crawlers || o.Folded || o.Tree || o.Growth != "" || o.Conformance != "" || o.Heatmap > 0 || o.Quotas > 0 || o.Capacity > 0 || o.CompareSources || o.EventsKind != "" || o.Series > 0 || o.Availability > 0 || o.RollupDir != "" || o.ServeAddr != "" || o.Emit != ""
+}
+
+// Checking no flag needs integration left out of minimal build
+func (o *Options) checkBuild() error {
+	if !minimalBuild {
+		return nil
+	}
+	switch {
+	case o.SSHFile != "":
+		return flagError{"-ssh", errMinimal}
+	case o.SQLiteFile != "":
+		return flagError{"-sqlite", errMinimal}
+	case o.EmailTo != "":
+		return flagError{"-email-to", errMinimal}
+	}
+	return nil
+}
+
+// Request filters
+func (o *Options) filterFlags(fs *flag.FlagSet) {
+	fs.StringVar(&o.Method, "method", "", "HTTP methods to filter, comma-separated, ! excludes (e.g. GET,POST or !OPTIONS)")
+	fs.StringVar(&o.Code, "code", "", "Status codes or classes to filter (e.g. 500 or !200,!204 or 5xx)")
+	fs.StringVar(&o.Class, "class", "", "Status classes to filter (e.g. 5xx or 4xx,5xx or !2xx)")
+	fs.StringVar(&o.MinDuration, "min-duration", "", "Minimum request duration, inclusive (e.g. 500ms, 250µs, 1.5s)")
+	fs.StringVar(&o.MaxDuration, "max-duration", "", "Maximum request duration, inclusive (same units as -min-duration)")
+	fs.StringVar(&o.FilterExpr, "filter", "", "Boolean expression over record fields (e.g. 'code == 200 && duration > 2s')")
+	fs.StringVar(&o.Where, "where", "", "Boolean expression over record fields, combined with other filters (e.g. 'code >= 500 && url =~ \"^/api/\"')")
+	fs.StringVar(&o.Date, "date", "", "Dates to filter (format: YYYY/MM/DD)")
+	fs.StringVar(&o.URL, "url", "", "URL paths to filter, query string is compared only when value has one (e.g. !/healthz,!/ready)")
+	fs.StringVar(&o.URLPrefix, "url-prefix", "", "URL path prefixes to filter (e.g. /api or !/internal)")
+	fs.StringVar(&o.URLRegex, "url-regex", "", "URL regular expression to filter, ! before it excludes matches")
+	fs.StringVar(&o.Param, "param", "", "Query parameters to filter, name=value or name for any value (e.g. q=shoes or !debug)")
+	fs.StringVar(&o.IP, "ip", "", "IP addresses or CIDR ranges to filter (e.g. 10.0.0.0/8 or !127.0.0.1)")
+	fs.Var(&o.ThreatFeeds, "threat-feed", "Threat-intel IP list (plain text IPs and CIDR ranges or CSV like STIX-lite), records from listed IPs get threat field (repeatable)")
+	fs.BoolVar(&o.ThreatOnly, "threat-only", false, "Only records from IPs of -threat-feed")
+	fs.StringVar(&o.User, "user", "", "Take user of records into user field from first of comma-separated sources: field:NAME, param:NAME or url:REGEX with group (e.g. field:api_key,param:key)")
+	fs.StringVar(&o.LoadTestsSource, "load-tests", "", "JSON file or URL with load tests (windows and/or where expressions), their requests get load_test field and are left out of anomalies, alerts and availability")
+	fs.StringVar(&o.SkipPaths, "skip-paths", "", "Paths application doesn't log (gin LoggerConfig.SkipPaths), comma-separated; left out of metrics where older logs have them")
+	fs.StringVar(&o.From, "from", "", "Start of time range, inclusive (YYYY/MM/DD [HH:MM:SS], RFC3339 or relative like -1h)")
+	fs.StringVar(&o.To, "to", "", "End of time range, exclusive (same formats as -from)")
+	fs.BoolVar(&o.Explain, "explain", false, "Print records dropped per filter to stderr at exit, in raw mode with dropped records and filter which dropped them")
+	fs.IntVar(&o.ExplainEvery, "explain-every", 100, "Print first record dropped by each filter and every Nth after it with -explain")
+	fs.BoolVar(&o.Profile, "profile", false, "Print records each filter was evaluated on and dropped, with time spent in it, to stderr at exit")
+}
+
+// Input sources and line formats
+func (o *Options) inputFlags(fs *flag.FlagSet) {
+	o.lineFlags(fs)
+	fs.StringVar(&o.ArchiveFile, "archive", "", "Read logs from zip, tar or tar.gz archive instead of stdin")
+	fs.StringVar(&o.ArchiveMembers, "archive-members", "*", "Glob of archive members to read (matched against base name if it has no slash)")
+	fs.StringVar(&o.ArchivePassword, "archive-password", os.Getenv("GINLOG_ARCHIVE_PASSWORD"), "Password of encrypted zip archive")
+	fs.StringVar(&o.SSHFile, "ssh", "", "Read remote log file over ssh (user@host:/var/log/app.log)")
+	fs.BoolVar(&o.SSHCompress, "ssh-gzip", false, "Compress remote file with gzip on remote host while streaming")
+	fs.StringVar(&o.ListenSyslog, "listen-syslog", "", "Receive logs as syslog messages over UDP and TCP at address (e.g. :514) instead of stdin")
+	fs.IntVar(&o.MaxLines, "max-lines", 0, "Stop reading input after this many lines, results are partial (0 is no limit)")
+	fs.Var(&o.MaxBytes, "max-bytes", "Stop reading input after this many bytes (e.g. 500MB, 2GB), results are partial")
+	durationVar(fs, &o.MaxRuntime, "max-runtime", 0, "Stop reading input after running this long (e.g. 5m), results are partial")
+}
+
+// Line formats and parsing
+func (o *Options) lineFlags(fs *flag.FlagSet) {
+	fs.StringVar(&o.InputFormat, "input", "auto", "Input format: gin, json (gin JSON logger output), nginx or apache (Common/Combined Log Format), records (stream of ginlog parse), syslog (lines with syslog header, e.g. /var/log/syslog), journald (journalctl -o json) or auto (gin text, JSON or records, detected per line)")
+	fs.StringVar(&o.Pattern, "pattern", "", "Log line format: preset (gin, gin-json, gin-docs, gin-user-agent, gin-request-id) or pattern like \"%ip [%t] %m %u %s %d %{user_agent}\"")
+	o.MaxLineSize = defaultMaxLineSize
+	fs.Var(&o.MaxLineSize, "max-line-size", "Longest line read whole (e.g. 4MB), longer lines are truncated to it and reported, rest of them is dropped")
+	fs.BoolVar(&o.ContainerTime, "container-time", false, "Use timestamps of container runtime (docker, CRI, kubectl logs --timestamps) instead of gin ones, which have second resolution")
+	fs.IntVar(&o.Workers, "workers", runtime.NumCPU(), "Number of goroutines parsing input lines (1 parses sequentially)")
+	fs.StringVar(&o.TZ, "tz", "", "Zone of timestamps without one, as IANA name (Europe/Berlin), Local, UTC or offset (+02:00); makes times zone aware")
+	fs.StringVar(&o.DisplayTZ, "display-tz", "", "Zone times are shown, grouped by day and compared in (default -tz zone)")
+	fs.BoolVar(&o.Strict, "strict", false, "Fail on first line which is not request instead of skipping it (gin debug and empty lines are allowed)")
+	fs.BoolVar(&o.ReportErrors, "report-errors", false, "Print every skipped line with its number and reason to stderr")
+	fs.BoolVar(&o.FailOnPartial, "fail-on-partial", false, "Fail when input can't be read whole (missing file, corrupt gzip) instead of skipping rest of it with exit code 5")
+	fs.BoolVar(&o.Merge, "merge", false, "Merge input files by timestamp instead of reading them one after another (rotated files of several instances)")
+	fs.Float64Var(&o.Sample, "sample", 0, "Process random share of lines (e.g. 0.01), counts are scaled to estimates")
+	fs.IntVar(&o.SampleEvery, "sample-every", 0, "Process every Nth line, counts are scaled to estimates")
+	fs.BoolVar(&o.LowMemory, "low-memory", false, "Keep memory use low and bounded for small devices: one worker, sketch percentiles, small buffers")
+	fs.BoolVar(&o.PrintOffsets, "print-offsets", false, "Print input byte offsets to stderr as output is written (\"offset begin START END\", \"offset commit END\"), for resuming input after last commit")
+}
+
+// Route normalization
+func (o *Options) routeFlags(fs *flag.FlagSet) {
+	fs.BoolVar(&o.Normalize, "normalize", true, "Aggregate URLs by route template (/users/123 as /users/:id)")
+	fs.StringVar(&o.RoutesFile, "routes", "", "File with route patterns (e.g. /users/:id), one per line")
+	fs.Var(&o.GraphQL, "graphql", "GraphQL endpoint path (e.g. /graphql), its requests are grouped per operation (repeatable)")
+	fs.StringVar(&o.GraphQLField, "graphql-field", "operationName", "Field or query parameter with GraphQL operation name")
+}
+
+// Metrics calculation and formatting
+func (o *Options) metricsFlags(fs *flag.FlagSet) {
+	fs.StringVar(&o.PercentilesList, "percentiles", "50,90,95,99", "Comma-separated latency percentiles to calculate")
+	fs.StringVar(&o.LocaleName, "locale", "", "Locale for numbers and dates in text output (e.g. de-DE)")
+	durationVar(fs, &o.DurationCap, "duration-cap", 10*time.Minute, "Durations above this are suspicious and excluded from metrics (0 disables)")
+	fs.BoolVar(&o.KeepSuspicious, "keep-suspicious", false, "Include suspicious durations in metrics")
+	fs.BoolVar(&o.SuspiciousGaps, "suspicious-gaps", false, "Also treat durations longer than gap to previous request of same IP, method and URL as suspicious (misflags overlapping retries and polling)")
+}
+
+// Aggregated reports
+func (o *Options) reportFlags(fs *flag.FlagSet) {
+	fs.BoolVar(&o.CompareSources, "compare-sources", false, "Compare inputs given as arguments (label=path) side by side instead of combining them")
+	fs.StringVar(&o.EventsKind, "events", "", "Report [GIN-debug] and panic recovery events instead of requests (routes, panics, debug, all)")
+	fs.StringVar(&o.GroupBy, "group-by", "", "Output metrics per group (url, method, code, ip, ip-family, day, content-type)")
+	fs.StringVar(&o.Having, "having", "", "Keep groups whose metrics match expression (e.g. 'p95 > 3 * p50 && count > 100')")
+	fs.StringVar(&o.SplitAt, "split-at", "", "Compare route latencies before and after this time (same formats as -from)")
+	fs.Float64Var(&o.Alpha, "alpha", 0.05, "Significance level of -split-at comparison")
+	durationVar(fs, &o.Interval, "interval", 0, "Output time series of count, errors and average latency per interval (e.g. 1m)")
+	fs.StringVar(&o.AnnotationsSource, "annotations", "", "JSON file or URL with events (deploys, flag flips) to mark in -interval and -rollup-dir output")
+	fs.BoolVar(&o.Histogram, "histogram", false, "Output latency histogram")
+	durationVar(fs, &o.Heatmap, "heatmap", 0, "Output latency heatmap with columns of this interval (e.g. 1m) and rows of -buckets, as SVG with -o FILE.svg")
+	fs.BoolVar(&o.Arrivals, "arrivals", false, "Output inter-arrival times overall and per route, flagging periodic traffic")
+	o.bucketsFlag(fs)
+	durationVar(fs, &o.Forecast, "forecast", 0, "Forecast requests per route for this period ahead (e.g. 720h) with Holt-Winters, -format csv for charts")
+	durationVar(fs, &o.ForecastInterval, "forecast-interval", 24*time.Hour, "Time bucket of -forecast")
+	durationVar(fs, &o.Season, "season", 7*24*time.Hour, "Seasonal period of -forecast, multiple of -forecast-interval (0 disables seasonality)")
+	fs.IntVar(&o.Clients, "clients", 0, "Output unique client IPs, top N clients by requests and by errors, and clients above -client-rate")
+	fs.IntVar(&o.ClientRate, "client-rate", 100, "Requests per minute of one IP flagged by -clients")
+	fs.IntVar(&o.Quotas, "quotas", 0, "Output top N users of -user by requests and users above -quota in some -quota-period")
+	fs.IntVar(&o.Quota, "quota", 10000, "Requests of one user per -quota-period allowed by -quotas")
+	durationVar(fs, &o.QuotaPeriod, "quota-period", 24*time.Hour, "Period of -quota (e.g. 1h)")
+	fs.StringVar(&o.QuotaFile, "quota-file", "", "File of quotas of users replacing -quota, \"USER LIMIT\" per line")
+	fs.IntVar(&o.PrivacyK, "privacy-k", 0, "Suppress groups and clients of -group-by, -top and -clients with fewer requests than this, generalizing IPs to /24 and /48 networks")
+	fs.Float64Var(&o.PrivacyEpsilon, "privacy-epsilon", 0, "Add Laplace noise of scale 1/epsilon to counts of -group-by, -top and -clients, spent once per count a request is in, up to 4 (e.g. 0.5, smaller is noisier, needs -privacy-k)")
+	durationVar(fs, &o.Capacity, "capacity", 0, "Output workers needed at peak by Little's law, peak is busiest window of this size (e.g. 1h)")
+	fs.Float64Var(&o.CapacityHeadroom, "capacity-headroom", 1.5, "Factor of -capacity workers over peak concurrency")
+	fs.IntVar(&o.CapacityWorkers, "capacity-workers", 0, "Workers (concurrent requests) of one instance, -capacity outputs instances needed")
+	durationVar(fs, &o.KeepAlive, "keepalive", 0, "Estimate keep-alive connection reuse, requests of one IP less than this apart share connection (e.g. 100ms)")
+	durationVar(fs, &o.Impact, "impact", 0, "Rank routes by impact score, traffic share × (latency excess over this budget + error rate) (e.g. 300ms)")
+	fs.Float64Var(&o.ImpactPercentile, "impact-percentile", 95, "Latency percentile compared with -impact budget")
+	durationVar(fs, &o.Threats, "threats", 0, "Output requests from IPs of -threat-feed per IP, route and interval of this size (e.g. 1h)")
+	fs.IntVar(&o.Params, "params", 0, "Output query parameters with number of distinct values and top N values, flagging unbounded ones")
+	fs.StringVar(&o.ParamsPath, "params-path", "", "Limit -params to requests of this path or route (e.g. /search)")
+	durationVar(fs, &o.Anomaly.Interval, "anomalies", 0, "Flag intervals of this size (e.g. 1m) with error rate or p95 latency spikes, with top contributing routes")
+	o.anomalyFlags(fs)
+	durationVar(fs, &o.Episodes, "episodes", 0, "Cluster 5xx requests less than this apart (e.g. 5m) into error episodes with start, end, routes and codes")
+	fs.IntVar(&o.EpisodeMin, "episode-min", 3, "Smallest number of errors of -episodes episode, fewer are counted as isolated")
+	fs.BoolVar(&o.EpisodesPerRoute, "episodes-per-route", false, "Keep -episodes of different routes apart")
+	fs.BoolVar(&o.Folded, "folded", false, "Output total server time per route as folded stacks of path segments, for flamegraph.pl or speedscope")
+	fs.BoolVar(&o.Crawlers, "crawlers", false, "Output crawler traffic share, server time and bytes per crawler family and route")
+	fs.BoolVar(&o.Tree, "tree", false, "Output metrics rolled up by path segments (/api, /api/v1, /api/v1/users) as indented tree")
+	fs.IntVar(&o.TreeDepth, "tree-depth", 0, "Segments of -tree paths, deeper paths are counted in their parents (0 is all)")
+	fs.StringVar(&o.Growth, "growth", "", "Output unique client IPs per day or week with new, returning and churned clients")
+	fs.StringVar(&o.GrowthState, "growth-state", "", "File of -growth client sketches, read and updated so clients of earlier runs count as returning")
+	o.lockTimeoutFlag(fs)
+	fs.StringVar(&o.Conformance, "conformance", "", "Output traffic outside allowlist file of method and route pairs (GET /users/:id, or [GIN-debug] route lines): unknown routes and unexpected methods")
+	fs.Var(&o.CrawlerRanges, "crawler-ranges", "File of crawler IPs and CIDR ranges with family (66.249.64.0/19 Googlebot) added to built-in ones (repeatable)")
+}
+
+// Latency buckets of histogram and Prometheus output
+func (o *Options) bucketsFlag(fs *flag.FlagSet) {
+	fs.StringVar(&o.BucketsList, "buckets", "", "Comma-separated histogram bucket bounds (default 1ms,5ms,10ms,50ms,100ms,500ms,1s)")
+}
+
+// Top N reports
+func (o *Options) topFlags(fs *flag.FlagSet, name string) {
+	fs.StringVar(&o.Top, name, o.Top, "Output top N report (slowest, urls, ips, errors)")
+	fs.IntVar(&o.TopN, "n", 10, "Number of entries in -"+name+" report")
+	fs.StringVar(&o.TopOutput, "output", "table", "Output of -"+name+" urls: table, or urls (URLs of successful GET requests one per line, for cache warmers)")
+	fs.StringVar(&o.URLBase, "url-base", "", "Prefix of -output urls lines (e.g. https://www.example.com)")
+}
+
+// Record output
+func (o *Options) recordFlags(fs *flag.FlagSet) {
+	fs.StringVar(&o.FormatName, "format", o.FormatName, "Output format: text (metrics), raw, json, csv, ndjson, parquet, records (stream read by other ginlog commands), binary (record file mapped by other ginlog commands), prometheus")
+	fs.StringVar(&o.DerivedFields, "fields", "", "Derived fields added to json, ndjson, csv and parquet records (normalized_route, status_class, duration_ms)")
+	fs.StringVar(&o.SortBy, "sort", "", "Sort output records by key (duration, date, code, url)")
+	fs.BoolVar(&o.Desc, "desc", false, "Sort records in descending order")
+	fs.StringVar(&o.SplitBy, "split-by", "", "Write records to one file per partition (day, route, status-class or -group-by key)")
+	fs.StringVar(&o.SplitPath, "split-path", "", "File path template of -split-by, {key} is replaced with partition (default {key}.<format>)")
+	fs.IntVar(&o.Limit, "limit", 0, "Output at most N records (0 is unlimited)")
+	fs.IntVar(&o.Offset, "offset", 0, "Skip first N records of output")
+	fs.IntVar(&o.Tail, "tail", 0, "Output only last N records")
+}
+
+// Metrics sent while reading input
+func (o *Options) emitFlags(fs *flag.FlagSet) {
+	fs.StringVar(&o.Emit, "emit", "", "Send request counters and route latencies to statsd://host:8125 or graphite://host:2003 while reading input")
+	fs.StringVar(&o.EmitPrefix, "emit-prefix", "ginlog", "Prefix of -emit metric names")
+	durationVar(fs, &o.EmitInterval, "emit-interval", 10*time.Second, "Interval of metrics sent to Graphite (StatsD aggregates itself)")
+	fs.Var(&o.EmitRoutePercentiles, "emit-route-percentiles", "Percentiles sent to Graphite for routes matching pattern instead of -percentiles, like \"/api/payments/**=50,99,99.9\" (repeatable, first match wins)")
+}
+
+// Custom output through Go template
+func (o *Options) templateFlags(fs *flag.FlagSet) {
+	fs.StringVar(&o.Template, "template", "", "Go template rendering each record of raw output or metrics of text output (e.g. '{{.Date}} {{.Code}} {{.URL}}')")
+	fs.StringVar(&o.TemplateFile, "template-file", "", "File with Go template of -template")
+}
+
+// Color of raw and metrics output on terminal
+func (o *Options) colorFlags(fs *flag.FlagSet) {
+	fs.BoolVar(&o.NoColor, "no-color", false, "Disable colored status codes and slow durations, also disabled when stdout isn't terminal or NO_COLOR is set")
+	durationVar(fs, &o.Slow, "slow", time.Second, "Durations above this are highlighted in colored output (0 disables)")
+}
+
+// Output file and width of tables
+func (o *Options) outputFlags(fs *flag.FlagSet) {
+	fs.StringVar(&o.OutputFile, "o", "", "Write output to file, replaced atomically when output is complete")
+	fs.BoolVar(&o.Append, "append", false, "Append to -o file instead of replacing it")
+	fs.IntVar(&o.MaxWidth, "max-width", 0, "Truncate widest table columns with ellipsis to fit this many characters (default: width of terminal, $COLUMNS)")
+	fs.BoolVar(&o.NoTruncate, "no-truncate", false, "Print table columns whole, as they are when output isn't terminal")
+	o.lockTimeoutFlag(fs)
+}
+
+// Settings of anomaly detection, interval is set by caller
+func (o *Options) anomalyFlags(fs *flag.FlagSet) {
+	fs.IntVar(&o.Anomaly.Window, "anomaly-window", 30, "Number of previous intervals forming baseline of -anomalies")
+	fs.Float64Var(&o.Anomaly.Sigma, "anomaly-sigma", 3, "Standard deviations above baseline mean which are -anomalies")
+	fs.Float64Var(&o.Anomaly.ErrorRate, "anomaly-error-rate", 0, "Fixed error rate threshold (e.g. 0.05) of -anomalies instead of baseline")
+	durationVar(fs, &o.Anomaly.P95, "anomaly-p95", 0, "Fixed p95 latency threshold (e.g. 500ms) of -anomalies instead of baseline")
+}
+
+// Summary of non-fatal issues
+func (o *Options) summaryFlag(fs *flag.FlagSet) {
+	fs.StringVar(&o.Summary, "summary", "text", "Format of summary of non-fatal issues printed to stderr at exit (text: only when there are issues, json: always)")
+}
+
+// Preset of config file, only shown in help as presets are
+// replaced with their flags before parsing
+func (o *Options) presetFlag(fs *flag.FlagSet) {
+	fs.StringVar(&o.Preset, "preset", "", "Apply flags of named preset of config file ("+configPath()+", $GINLOG_CONFIG), flags after it override preset")
+}
+
+// Unit of bare numbers in duration flags, only checked when parsing
+// as it is found before other flags (scanDefaultDurationUnit)
+func (o *Options) durationUnitFlag(fs *flag.FlagSet) {
+	fs.Func("default-duration-unit", "Unit of bare numbers in duration flags, e.g. -interval 500 (ns, us, ms, s, m, h, d; default ms)", setDefaultDurationUnit)
+}
+
+// Dry run of files, email and alerts
+func (o *Options) dryRunFlag(fs *flag.FlagSet) {
+	fs.BoolVar(&o.DryRun, "dry-run", false, "Check destinations (directories, SMTP, alert credentials) and report what would be written, without writing files, sending email or alerts")
+}
+
+// Rollup to disk
+func (o *Options) rollupFlags(fs *flag.FlagSet) {
+	fs.StringVar(&o.RollupDir, "rollup-dir", "", "Write closed time bucket aggregates to files in directory instead of keeping records")
+	fs.StringVar(&o.RollupPeriod, "rollup-period", "hour", "Time bucket of -rollup-dir (hour, day)")
+	durationVar(fs, &o.Series, "series", 0, "Write one row per interval of this size (e.g. 1m) and route with count, errors, -percentiles and mergeable sketch, as -format csv, json or ndjson")
+	durationVar(fs, &o.Availability, "availability", 0, "Write availability (share of requests not failed) per interval of this size (e.g. 1m) for status pages, as -format csv, json or ndjson")
+	fs.StringVar(&o.AvailabilityErrors, "availability-errors", "5xx", "Status codes or classes counted as failures by -availability, ! excludes (e.g. 5xx,429 or 5xx,!501)")
+}
+
+// Exporting records to OpenTelemetry collector
+func (o *Options) otlpFlags(fs *flag.FlagSet) {
+	fs.StringVar(&o.OTLP, "otlp", "", "Export records to OpenTelemetry collector over OTLP/HTTP (e.g. http://collector:4318) instead of writing them")
+	fs.StringVar(&o.OTLPSignal, "otlp-signal", "traces", "What -otlp exports: traces (span per request) or metrics (duration histograms)")
+	fs.StringVar(&o.OTLPService, "otlp-service", "gin", "Service name (service.name) of -otlp spans and metrics")
+	fs.Var(&o.OTLPHeaders, "otlp-header", "Header of -otlp requests like \"Authorization=Bearer TOKEN\" (repeatable)")
+	durationVar(fs, &o.OTLPInterval, "otlp-interval", time.Minute, "Interval of record timestamps aggregated into one -otlp-signal metrics data point")
+	fs.StringVar(&o.Checkpoint, "checkpoint", "", "Write records sent to -otlp traces to this file when sending fails, \"ginlog resume FILE\" sends the rest")
+}
+
+// Loading records into SQLite database
+func (o *Options) sqliteFlag(fs *flag.FlagSet) {
+	fs.StringVar(&o.SQLiteFile, "sqlite", "", "Load records into indexed SQLite database (table records), query it with \"ginlog query\"; needs sqlite3 command")
+	o.lockTimeoutFlag(fs)
+}
+
+// Waiting for parallel runs writing same -append file, state file or database
+func (o *Options) lockTimeoutFlag(fs *flag.FlagSet) {
+	if fs.Lookup("lock-timeout") == nil {
+		durationVar(fs, &o.LockTimeout, "lock-timeout", 30*time.Second, "How long to wait for other runs writing same -o -append file, -growth-state or -alert-state file or -sqlite database")
+	}
+}
+
+// Email reports and alerts
+func (o *Options) deliveryFlags(fs *flag.FlagSet) {
+	fs.StringVar(&o.EmailTo, "email-to", "", "Comma-separated recipients of HTML report with CSV attached")
+	fs.StringVar(&o.Email.From, "email-from", "", "Sender address of report email")
+	fs.StringVar(&o.Email.Subject, "email-subject", "", "Subject of report email")
+	fs.StringVar(&o.Email.Server, "smtp", "localhost:25", "SMTP server address (host:port)")
+	fs.StringVar(&o.Email.User, "smtp-user", "", "SMTP username, password is read from GINLOG_SMTP_PASSWORD")
+	fs.Var(&o.AlertExprs, "alert", "Alert rule like \"p95 > 500ms\" or \"error_rate > 5%\" (repeatable)")
+	fs.StringVar(&o.PagerDutyKey, "pagerduty-key", os.Getenv("GINLOG_PAGERDUTY_KEY"), "PagerDuty Events API v2 routing key for alerts")
+	fs.StringVar(&o.OpsgenieKey, "opsgenie-key", os.Getenv("GINLOG_OPSGENIE_KEY"), "Opsgenie API key for alerts")
+	fs.StringVar(&o.SilencesFile, "silences", "", "JSON file with alert silences (maintenance windows)")
+	fs.StringVar(&o.AlertState, "alert-state", "", "File of firing alerts, read and updated so alerts fired by earlier runs are resolved when they stop firing")
+	fs.StringVar(&o.AlertDedupPrefix, "alert-dedup-prefix", "ginlog", "Prefix of alert dedup keys, alerts of same rule and prefix update the same incident (e.g. ginlog/$HOSTNAME for incident per host)")
+	o.lockTimeoutFlag(fs)
+}
+
+// All flags of the command line without subcommand
+func (o *Options) legacyFlags(fs *flag.FlagSet) {
+	o.filterFlags(fs)
+	o.inputFlags(fs)
+	o.routeFlags(fs)
+	o.metricsFlags(fs)
+	o.reportFlags(fs)
+	o.topFlags(fs, "top")
+	o.recordFlags(fs)
+	o.templateFlags(fs)
+	o.colorFlags(fs)
+	o.rollupFlags(fs)
+	o.sqliteFlag(fs)
+	o.otlpFlags(fs)
+	o.emitFlags(fs)
+	o.deliveryFlags(fs)
+	o.dryRunFlag(fs)
+	o.outputFlags(fs)
+	o.summaryFlag(fs)
+	o.presetFlag(fs)
+	o.durationUnitFlag(fs)
+
+	fs.StringVar(&o.FollowFile, "follow", "", "Read log file and keep waiting for new lines, like tail -F")
+	fs.StringVar(&o.ServeAddr, "serve", "", "Serve Prometheus metrics at address (e.g. :9100) while reading input")
+	fs.BoolVar(&o.NativeHistograms, "native-histograms", false, "Serve native latency histograms next to classic buckets to Prometheus scraping protobuf")
+	fs.StringVar(&o.InitCounters, "init-counters", "", "Start counters and histograms of -serve from metrics of earlier exporter in this file (text exposition format)")
+	fs.BoolVar(&o.Jobs, "jobs", false, "Run jobs of config file on their schedule with -serve, status at /jobs")
+	fs.BoolVar(&o.Raw, "raw", false, "Output filtered logs instead of statistics")
+	fs.BoolVar(&o.JSON, "json", false, "Output logs in JSON format")
+	fs.BoolVar(&o.JSONMetrics, "json-metrics", false, "Output metrics in JSON format")
+}
@@ -0,0 +1,436 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Signals of -otlp-signal
+var otlpSignals = []string{"traces", "metrics"}
+
+// Spans or data points per OTLP request
+const otlpBatch = 1000
+
+// Bucket bounds of duration histogram in milliseconds, the default
+// of OpenTelemetry SDKs, so exported histograms merge with theirs
+var otlpBounds = []float64{0, 5, 10, 25, 50, 75, 100, 250, 500, 750, 1000, 2500, 5000, 7500, 10000}
+
+// OTLP span kind and status code
+const (
+	otlpKindServer  = 2
+	otlpStatusError = 2
+)
+
+// Collector endpoint of -otlp, path of signal is added to base URL
+// without path (http://collector:4318 is http://collector:4318/v1/traces)
+func otlpEndpoint(value, signal string) (string, error) {
+	u, err := url.Parse(value)
+	if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		return "", fmt.Errorf("invalid endpoint %q (expected http://collector:4318)", value)
+	}
+	if !slices.Contains(otlpSignals, signal) {
+		return "", fmt.Errorf("unknown signal %q (supported: %s)", signal, strings.Join(otlpSignals, ", "))
+	}
+	if u.Path == "" || u.Path == "/" {
+		u.Path = "/v1/" + signal
+	}
+	return u.String(), nil
+}
+
+// OTLP/JSON attribute
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpValue struct {
+	String *string `json:"stringValue,omitempty"`
+	Int    *string `json:"intValue,omitempty"`
+}
+
+func otlpString(key, value string) otlpAttribute {
+	return otlpAttribute{Key: key, Value: otlpValue{String: &value}}
+}
+
+func otlpInt(key string, value int) otlpAttribute {
+	s := strconv.Itoa(value)
+	return otlpAttribute{Key: key, Value: otlpValue{Int: &s}}
+}
+
+// Time as OTLP/JSON fixed64, which is string
+func otlpTime(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
+
+// Random trace or span id of n bytes, hex encoded as OTLP/JSON wants
+func otlpID(n int) string {
+	id := make([]byte, n)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+type otlpSpan struct {
+	TraceID    string          `json:"traceId"`
+	SpanID     string          `json:"spanId"`
+	Name       string          `json:"name"`
+	Kind       int             `json:"kind"`
+	Start      string          `json:"startTimeUnixNano"`
+	End        string          `json:"endTimeUnixNano"`
+	Attributes []otlpAttribute `json:"attributes"`
+	Status     *otlpStatus     `json:"status,omitempty"`
+}
+
+type otlpStatus struct {
+	Code int `json:"code"`
+}
+
+type otlpDataPoint struct {
+	Start        string          `json:"startTimeUnixNano"`
+	Time         string          `json:"timeUnixNano"`
+	Count        string          `json:"count"`
+	Sum          float64         `json:"sum"`
+	Min          float64         `json:"min"`
+	Max          float64         `json:"max"`
+	BucketCounts []string        `json:"bucketCounts"`
+	Bounds       []float64       `json:"explicitBounds"`
+	Attributes   []otlpAttribute `json:"attributes"`
+}
+
+// Histogram of one interval, method, route and status code
+type otlpPoint struct {
+	start    time.Time
+	method   string
+	route    string
+	code     int
+	count    int
+	sum      float64
+	min, max float64
+	buckets  []int
+}
+
+type otlpPointKey struct {
+	start  time.Time
+	method string
+	route  string
+	code   int
+}
+
+// Span of request: gin logs request when it ends, so span starts
+// duration before timestamp of record
+func newOTLPSpan(record LogRecord) otlpSpan {
+	route := groupKey(record, "url")
+	span := otlpSpan{
+		TraceID: otlpID(16),
+		SpanID:  otlpID(8),
+		Name:    record.Method + " " + route,
+		Kind:    otlpKindServer,
+		Start:   otlpTime(record.Date.Add(-record.Duration)),
+		End:     otlpTime(record.Date),
+		Attributes: []otlpAttribute{
+			otlpString("http.method", record.Method),
+			otlpInt("http.status_code", record.Code),
+			otlpString("http.route", route),
+			otlpString("http.target", record.URL),
+			otlpString("net.sock.peer.addr", record.IP),
+		},
+	}
+	if isError(record.Code) {
+		span.Status = &otlpStatus{Code: otlpStatusError}
+	}
+	return span
+}
+
+// Sink exporting records to OpenTelemetry collector over OTLP/HTTP
+// (-otlp), so services with only gin logs get traces or metrics.
+//
+// Traces have server span per request. Metrics have delta histogram
+// http.server.duration per interval of record timestamps, method,
+// route and status code; interval is sent when records of interval
+// after it arrive, rest at end of input.
+type OTLPExporter struct {
+	endpoint string
+	signal   string
+	service  string
+	headers  map[string]string
+	interval time.Duration
+	client   *http.Client
+	dryRun   *DryRun
+
+	spans  []otlpSpan
+	points map[otlpPointKey]*otlpPoint
+	latest time.Time
+
+	// Records and requests sent, for summary on stderr
+	exported, requests int
+
+	// First offset records are skipped and at most limit records
+	// after them are exported (-offset, -limit), spans of sent
+	// records are counted for checkpoint written when sending fails
+	offset, limit, seen, sent int
+	checkpoint                *checkpointer
+}
+
+func NewOTLPExporter(endpoint, signal, service string, headers map[string]string, interval time.Duration, dryRun *DryRun) *OTLPExporter {
+	return &OTLPExporter{
+		endpoint: endpoint,
+		signal:   signal,
+		service:  service,
+		headers:  headers,
+		interval: interval,
+		client:   &http.Client{Timeout: httpTimeout},
+		dryRun:   dryRun,
+		points:   make(map[otlpPointKey]*otlpPoint),
+	}
+}
+
+func (e *OTLPExporter) Add(record LogRecord) error {
+	e.seen++
+	if e.seen <= e.offset || e.limit > 0 && e.seen > e.offset+e.limit {
+		return nil
+	}
+
+	e.exported++
+	if e.signal == "traces" {
+		e.spans = append(e.spans, newOTLPSpan(record))
+		if len(e.spans) >= otlpBatch {
+			return e.sendSpans()
+		}
+		return nil
+	}
+
+	start := record.Date.Truncate(e.interval)
+	key := otlpPointKey{start, record.Method, groupKey(record, "url"), record.Code}
+	p, ok := e.points[key]
+	if !ok {
+		p = &otlpPoint{start: start, method: key.method, route: key.route, code: key.code, buckets: make([]int, len(otlpBounds)+1)}
+		e.points[key] = p
+	}
+
+	ms := durationMs(record.Duration)
+	if p.count == 0 || ms < p.min {
+		p.min = ms
+	}
+	if p.count == 0 || ms > p.max {
+		p.max = ms
+	}
+	p.count++
+	p.sum += ms
+	i, _ := slices.BinarySearch(otlpBounds, ms)
+	p.buckets[i]++
+
+	// Interval before previous one is complete, a little disorder
+	// of input is merged into its interval
+	if start.After(e.latest) {
+		e.latest = start
+		return e.sendPoints(func(p *otlpPoint) bool {
+			return p.start.Before(start.Add(-e.interval))
+		})
+	}
+	if len(e.points) >= otlpBatch {
+		return e.sendPoints(func(*otlpPoint) bool { return true })
+	}
+	return nil
+}
+
+func (e *OTLPExporter) resource() map[string]any {
+	return map[string]any{"attributes": []otlpAttribute{otlpString("service.name", e.service)}}
+}
+
+var otlpScope = map[string]string{"name": "ginlog", "version": currentVersion()}
+
+func (e *OTLPExporter) sendSpans() error {
+	if len(e.spans) == 0 {
+		return nil
+	}
+	body := map[string]any{
+		"resourceSpans": []any{map[string]any{
+			"resource":   e.resource(),
+			"scopeSpans": []any{map[string]any{"scope": otlpScope, "spans": e.spans}},
+		}},
+	}
+	n := len(e.spans)
+	e.spans = e.spans[:0]
+	if err := e.post(body, n, "spans"); err != nil {
+		if e.checkpoint != nil {
+			if cpErr := e.checkpoint.Fail(e.sent, err); cpErr != nil {
+				fmt.Fprintf(os.Stderr, "Error writing checkpoint: %v\n", cpErr)
+			}
+		}
+		return err
+	}
+	e.sent += n
+	return nil
+}
+
+// Sending data points selected by done, in time order
+func (e *OTLPExporter) sendPoints(done func(*otlpPoint) bool) error {
+	var points []*otlpPoint
+	for key, p := range e.points {
+		if done(p) {
+			points = append(points, p)
+			delete(e.points, key)
+		}
+	}
+	if len(points) == 0 {
+		return nil
+	}
+	slices.SortFunc(points, func(a, b *otlpPoint) int {
+		if c := a.start.Compare(b.start); c != 0 {
+			return c
+		}
+		return strings.Compare(a.method+" "+a.route+" "+strconv.Itoa(a.code), b.method+" "+b.route+" "+strconv.Itoa(b.code))
+	})
+
+	for len(points) > 0 {
+		batch := points[:min(len(points), otlpBatch)]
+		points = points[len(batch):]
+
+		dataPoints := make([]otlpDataPoint, len(batch))
+		for i, p := range batch {
+			counts := make([]string, len(p.buckets))
+			for j, c := range p.buckets {
+				counts[j] = strconv.Itoa(c)
+			}
+			dataPoints[i] = otlpDataPoint{
+				Start:        otlpTime(p.start),
+				Time:         otlpTime(p.start.Add(e.interval)),
+				Count:        strconv.Itoa(p.count),
+				Sum:          p.sum,
+				Min:          p.min,
+				Max:          p.max,
+				BucketCounts: counts,
+				Bounds:       otlpBounds,
+				Attributes: []otlpAttribute{
+					otlpString("http.method", p.method),
+					otlpString("http.route", p.route),
+					otlpInt("http.status_code", p.code),
+				},
+			}
+		}
+
+		body := map[string]any{
+			"resourceMetrics": []any{map[string]any{
+				"resource": e.resource(),
+				"scopeMetrics": []any{map[string]any{
+					"scope": otlpScope,
+					"metrics": []any{map[string]any{
+						"name":        "http.server.duration",
+						"description": "Duration of HTTP server requests",
+						"unit":        "ms",
+						"histogram": map[string]any{
+							"aggregationTemporality": 1,
+							"dataPoints":             dataPoints,
+						},
+					}},
+				}},
+			}},
+		}
+		if err := e.post(body, len(batch), "data points"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Posting OTLP/JSON request, transient failures (network errors, 429
+// and 5xx) are retried with backoff like downloads are
+func (e *OTLPExporter) post(body any, items int, unit string) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	if e.dryRun != nil {
+		e.dryRun.Target(e.endpoint, unit, "not sent").Add(items, int64(len(payload)))
+		return nil
+	}
+
+	for failures := 0; ; failures++ {
+		err = e.request(payload)
+		if err == nil {
+			e.requests++
+			return nil
+		}
+		if _, ok := err.(permanentError); ok || failures == httpRetries {
+			return fmt.Errorf("%s: %w", e.endpoint, err)
+		}
+
+		delay := httpRetryDelay << failures
+		fmt.Fprintf(os.Stderr, "Retrying %s in %v: %v\n", e.endpoint, delay, err)
+		time.Sleep(delay)
+	}
+}
+
+func (e *OTLPExporter) request(payload []byte) error {
+	req, err := http.NewRequest(http.MethodPost, e.endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return permanentError{err}
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range e.headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 300 {
+		io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	err = fmt.Errorf("unexpected status %s: %s", resp.Status, bytes.TrimSpace(msg))
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+		return err
+	}
+	return permanentError{err}
+}
+
+// Sending what is pending
+func (e *OTLPExporter) Finish() error {
+	var err error
+	if e.signal == "traces" {
+		err = e.sendSpans()
+	} else {
+		err = e.sendPoints(func(*otlpPoint) bool { return true })
+	}
+	if err != nil {
+		return err
+	}
+	if e.checkpoint != nil {
+		if err := e.checkpoint.Done(); err != nil {
+			return err
+		}
+	}
+
+	if e.dryRun == nil {
+		fmt.Fprintf(os.Stderr, "Exported %d records as %s to %s in %d requests\n", e.exported, e.signal, e.endpoint, e.requests)
+	}
+	return nil
+}
+
+// Headers of -otlp-header, Authorization=Bearer ... or Authorization: Bearer ...
+func parseOTLPHeaders(values []string) (map[string]string, error) {
+	headers := make(map[string]string)
+	for _, value := range values {
+		i := strings.IndexAny(value, "=:")
+		if i <= 0 {
+			return nil, fmt.Errorf("invalid header %q (expected name=value)", value)
+		}
+		headers[strings.TrimSpace(value[:i])] = strings.TrimSpace(value[i+1:])
+	}
+	return headers, nil
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Collector of OTLP/JSON requests
+func otlpCollector(t *testing.T) (*httptest.Server, func() []map[string]any) {
+	t.Helper()
+	var mu sync.Mutex
+	var bodies []map[string]any
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Type") != "application/json" || r.Header.Get("Authorization") != "Bearer token" {
+			http.Error(w, "bad headers", http.StatusBadRequest)
+			return
+		}
+		var body map[string]any
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		mu.Lock()
+		bodies = append(bodies, body)
+		mu.Unlock()
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv, func() []map[string]any {
+		mu.Lock()
+		defer mu.Unlock()
+		return bodies
+	}
+}
+
+// Walking decoded JSON by keys and list indexes
+func jsonPath(t *testing.T, v any, path ...any) any {
+	t.Helper()
+	for _, p := range path {
+		switch p := p.(type) {
+		case string:
+			m, ok := v.(map[string]any)
+			if !ok {
+				t.Fatalf("no object for %q", p)
+			}
+			v = m[p]
+		case int:
+			l, ok := v.([]any)
+			if !ok || p >= len(l) {
+				t.Fatalf("no list element %d", p)
+			}
+			v = l[p]
+		}
+	}
+	return v
+}
+
+// Attributes of span or data point as map of key to value
+func otlpAttributes(t *testing.T, item any) map[string]string {
+	t.Helper()
+	attributes := map[string]string{}
+	for _, a := range jsonPath(t, item, "attributes").([]any) {
+		value := jsonPath(t, a, "value").(map[string]any)
+		for _, v := range value {
+			attributes[jsonPath(t, a, "key").(string)] = v.(string)
+		}
+	}
+	return attributes
+}
+
+var otlpHeaders = map[string]string{"Authorization": "Bearer token"}
+
+func TestOTLPTraces(t *testing.T) {
+	srv, bodies := otlpCollector(t)
+	endpoint, err := otlpEndpoint(srv.URL, "traces")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	date := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	e := NewOTLPExporter(endpoint, "traces", "shop", otlpHeaders, time.Minute, nil)
+	for _, record := range []LogRecord{
+		{Date: date, Code: 200, Duration: 250 * time.Millisecond, IP: "127.0.0.1", Method: "GET", URL: "/ping?x=1"},
+		{Date: date.Add(time.Second), Code: 503, Duration: time.Second, IP: "10.0.0.1", Method: "POST", URL: "/orders"},
+	} {
+		if err := e.Add(record); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := e.Finish(); err != nil {
+		t.Fatal(err)
+	}
+
+	got := bodies()
+	if len(got) != 1 {
+		t.Fatalf("%d requests, want 1", len(got))
+	}
+	resource := jsonPath(t, got[0], "resourceSpans", 0)
+	if service := otlpAttributes(t, jsonPath(t, resource, "resource"))["service.name"]; service != "shop" {
+		t.Errorf("service.name %q, want shop", service)
+	}
+
+	spans := jsonPath(t, resource, "scopeSpans", 0, "spans").([]any)
+	if len(spans) != 2 {
+		t.Fatalf("%d spans, want 2", len(spans))
+	}
+
+	ok := spans[0].(map[string]any)
+	if ok["name"] != "GET /ping" || ok["status"] != nil || ok["kind"] != float64(otlpKindServer) {
+		t.Errorf("span of 200: %v", ok)
+	}
+	if ok["endTimeUnixNano"] != strconv.FormatInt(date.UnixNano(), 10) ||
+		ok["startTimeUnixNano"] != strconv.FormatInt(date.Add(-250*time.Millisecond).UnixNano(), 10) {
+		t.Errorf("span of 200 from %v to %v, want end at timestamp and start duration before", ok["startTimeUnixNano"], ok["endTimeUnixNano"])
+	}
+	if len(ok["traceId"].(string)) != 32 || len(ok["spanId"].(string)) != 16 {
+		t.Errorf("trace id %v, span id %v", ok["traceId"], ok["spanId"])
+	}
+
+	want := map[string]string{
+		"http.method":        "GET",
+		"http.status_code":   "200",
+		"http.route":         "/ping",
+		"http.target":        "/ping?x=1",
+		"net.sock.peer.addr": "127.0.0.1",
+	}
+	if attributes := otlpAttributes(t, ok); !reflect.DeepEqual(attributes, want) {
+		t.Errorf("attributes %v, want %v", attributes, want)
+	}
+
+	if code := jsonPath(t, spans[1], "status", "code"); code != float64(otlpStatusError) {
+		t.Errorf("status of 503 span %v, want error", code)
+	}
+}
+
+func TestOTLPMetrics(t *testing.T) {
+	srv, bodies := otlpCollector(t)
+	endpoint, err := otlpEndpoint(srv.URL+"/", "metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	date := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	e := NewOTLPExporter(endpoint, "metrics", "shop", otlpHeaders, time.Minute, nil)
+	for _, record := range []LogRecord{
+		{Date: date, Code: 200, Duration: 3 * time.Millisecond, Method: "GET", URL: "/ping"},
+		{Date: date.Add(time.Second), Code: 200, Duration: 30 * time.Millisecond, Method: "GET", URL: "/ping"},
+		{Date: date.Add(2 * time.Second), Code: 200, Duration: 20 * time.Second, Method: "GET", URL: "/ping"},
+		{Date: date.Add(3 * time.Minute), Code: 200, Duration: time.Millisecond, Method: "GET", URL: "/ping"},
+	} {
+		if err := e.Add(record); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// First interval is sent when interval after next one starts
+	if got := len(bodies()); got != 1 {
+		t.Errorf("%d requests before finish, want 1", got)
+	}
+	if err := e.Finish(); err != nil {
+		t.Fatal(err)
+	}
+
+	got := bodies()
+	if len(got) != 2 {
+		t.Fatalf("%d requests, want 2", len(got))
+	}
+	metric := jsonPath(t, got[0], "resourceMetrics", 0, "scopeMetrics", 0, "metrics", 0)
+	if metric.(map[string]any)["name"] != "http.server.duration" {
+		t.Errorf("metric %v", metric)
+	}
+	if temporality := jsonPath(t, metric, "histogram", "aggregationTemporality"); temporality != float64(1) {
+		t.Errorf("temporality %v, want delta", temporality)
+	}
+
+	point := jsonPath(t, metric, "histogram", "dataPoints", 0).(map[string]any)
+	if point["count"] != "3" || point["min"] != float64(3) || point["max"] != float64(20000) || point["sum"] != float64(20033) {
+		t.Errorf("data point %v", point)
+	}
+	if point["startTimeUnixNano"] != strconv.FormatInt(date.UnixNano(), 10) ||
+		point["timeUnixNano"] != strconv.FormatInt(date.Add(time.Minute).UnixNano(), 10) {
+		t.Errorf("data point from %v to %v, want one interval", point["startTimeUnixNano"], point["timeUnixNano"])
+	}
+
+	buckets := make([]string, len(otlpBounds)+1)
+	for i := range buckets {
+		buckets[i] = "0"
+	}
+	buckets[1], buckets[4], buckets[len(otlpBounds)] = "1", "1", "1"
+	var counts []string
+	for _, c := range point["bucketCounts"].([]any) {
+		counts = append(counts, c.(string))
+	}
+	if !reflect.DeepEqual(counts, buckets) {
+		t.Errorf("bucket counts %v, want %v", counts, buckets)
+	}
+}
+
+func TestOTLPEndpoint(t *testing.T) {
+	for value, want := range map[string]string{
+		"http://collector:4318":           "http://collector:4318/v1/traces",
+		"https://collector:4318/":         "https://collector:4318/v1/traces",
+		"http://collector:4318/custom/tr": "http://collector:4318/custom/tr",
+	} {
+		if got, err := otlpEndpoint(value, "traces"); err != nil || got != want {
+			t.Errorf("otlpEndpoint(%q) = %q, %v, want %q", value, got, err, want)
+		}
+	}
+
+	for _, value := range []string{"collector:4318", "ftp://collector", "http://"} {
+		if _, err := otlpEndpoint(value, "traces"); err == nil {
+			t.Errorf("otlpEndpoint(%q) succeeded, want error", value)
+		}
+	}
+	if _, err := otlpEndpoint("http://collector:4318", "logs"); err == nil {
+		t.Error("unknown signal accepted")
+	}
+}
+
+func TestParseOTLPHeaders(t *testing.T) {
+	got, err := parseOTLPHeaders([]string{"Authorization: Bearer abc", "X-Scope-OrgID=team=a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"Authorization": "Bearer abc", "X-Scope-OrgID": "team=a"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	for _, value := range []string{"novalue", "=x", ":x"} {
+		if _, err := parseOTLPHeaders([]string{value}); err == nil {
+			t.Errorf("parseOTLPHeaders(%q) succeeded, want error", value)
+		}
+	}
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Supported -format values
+var outputFormats = []string{"text", "raw", "json", "csv", "ndjson", "parquet", "records", "binary", "prometheus"}
+
+// Resolving output format from -format and legacy -raw/-json flags
+func outputFormat(format string, raw bool, json bool) (string, error) {
+	switch {
+	case format != "":
+		if !slices.Contains(outputFormats, format) {
+			return "", fmt.Errorf("unknown format %q (supported: %s)", format, strings.Join(outputFormats, ", "))
+		}
+		return format, nil
+	case json:
+		return "json", nil
+	case raw:
+		return "raw", nil
+	}
+
+	return "text", nil
+}
+
+// Checking is format printing records instead of metrics
+func isRecordFormat(format string) bool {
+	return format != "text" && format != "prometheus"
+}
+
+// Records output in given format
+func printRecords(records []LogRecord, format string, fields []string) error {
+	w := newRecordWriter(os.Stdout, format, fields)
+
+	for _, record := range records {
+		if err := w.Write(record); err != nil {
+			return fmt.Errorf("writing output: %w", err)
+		}
+	}
+
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("writing output: %w", err)
+	}
+	return nil
+}
+
+// JSON output of aggregates
+func printJSON(v any) error {
+	formatted, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("encoding JSON: %w", err)
+	}
+
+	fmt.Println(string(formatted))
+	return nil
+}
+
+// Streaming writer of records in one of record formats.
+// Every record is written as soon as it is passed, so output
+// of follow mode appears without delay.
+type RecordWriter interface {
+	Write(record LogRecord) error
+	Close() error
+}
+
+// Record writer of format, raw for unknown ones.
+// Derived fields of -fields are added by json, ndjson, csv and parquet.
+func newRecordWriter(w io.Writer, format string, fields []string) RecordWriter {
+	switch format {
+	case "json":
+		return &jsonWriter{w: w, fields: fields}
+	case "csv":
+		return newCSVWriter(w, fields)
+	case "ndjson":
+		return newNDJSONWriter(w, fields)
+	case "parquet":
+		return newParquetWriter(w, fields)
+	case "records":
+		return newStreamWriter(w)
+	case "binary":
+		return newBinaryWriter(w)
+	}
+	return rawWriter{w: w, color: colorOutput && w == os.Stdout}
+}
+
+// Raw writer, lines in gin format, colored on terminal
+type rawWriter struct {
+	w     io.Writer
+	color bool
+}
+
+func (w rawWriter) Write(record LogRecord) error {
+	if w.color {
+		return writeColorRaw(w.w, record)
+	}
+	return writeRaw(w.w, record)
+}
+
+func (w rawWriter) Close() error {
+	return nil
+}
+
+// JSON writer, records as one array
+type jsonWriter struct {
+	w       io.Writer
+	fields  []string
+	started bool
+}
+
+func (w *jsonWriter) Write(record LogRecord) error {
+	formatted, err := json.Marshal(newJSONRecord(record, w.fields))
+	if err != nil {
+		return err
+	}
+
+	sep := ","
+	if !w.started {
+		sep = "["
+		w.started = true
+	}
+
+	_, err = fmt.Fprintf(w.w, "%s%s", sep, formatted)
+	return err
+}
+
+func (w *jsonWriter) Close() error {
+	if !w.started {
+		_, err := fmt.Fprintln(w.w, "[]")
+		return err
+	}
+
+	_, err := fmt.Fprintln(w.w, "]")
+	return err
+}
+
+// NDJSON writer, flushes every record so output can be streamed
+type ndjsonWriter struct {
+	buf    *bufio.Writer
+	enc    *json.Encoder
+	fields []string
+}
+
+func newNDJSONWriter(w io.Writer, fields []string) *ndjsonWriter {
+	buf := bufio.NewWriter(w)
+	return &ndjsonWriter{buf: buf, enc: json.NewEncoder(buf), fields: fields}
+}
+
+// Writing one record as JSON line
+func (w *ndjsonWriter) Write(record LogRecord) error {
+	if err := w.enc.Encode(newJSONRecord(record, w.fields)); err != nil {
+		return err
+	}
+	return w.buf.Flush()
+}
+
+func (w *ndjsonWriter) Close() error {
+	return w.buf.Flush()
+}
+
+// JSON representation of record, duration is in milliseconds
+type jsonRecord struct {
+	Date       time.Time `json:"date"`
+	Code       int       `json:"code"`
+	DurationMs float64   `json:"duration_ms"`
+	IP         string    `json:"ip"`
+	Method     string    `json:"method"`
+	URL        string    `json:"url"`
+
+	// Derived fields of -fields
+	NormalizedRoute string `json:"normalized_route,omitempty"`
+	StatusClass     string `json:"status_class,omitempty"`
+
+	Fields map[string]string `json:"fields,omitempty"`
+}
+
+// JSON representation with derived fields, duration_ms is always there
+func newJSONRecord(r LogRecord, fields []string) jsonRecord {
+	record := jsonRecord{
+		Date:       r.Date,
+		Code:       r.Code,
+		DurationMs: durationMs(r.Duration),
+		IP:         r.IP,
+		Method:     r.Method,
+		URL:        r.URL,
+		Fields:     r.Fields,
+	}
+
+	for _, field := range fields {
+		switch field {
+		case "normalized_route":
+			record.NormalizedRoute = normalizedRoute(r)
+		case "status_class":
+			record.StatusClass = statusClass(r.Code)
+		}
+	}
+	return record
+}
+
+func (r LogRecord) MarshalJSON() ([]byte, error) {
+	return json.Marshal(newJSONRecord(r, nil))
+}
+
+func (r *LogRecord) UnmarshalJSON(data []byte) error {
+	var decoded jsonRecord
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+
+	*r = LogRecord{
+		Date:     decoded.Date,
+		Code:     decoded.Code,
+		Duration: time.Duration(decoded.DurationMs * float64(time.Millisecond)),
+		IP:       decoded.IP,
+		Method:   decoded.Method,
+		URL:      decoded.URL,
+		Fields:   decoded.Fields,
+	}
+	return nil
+}
+
+// Derived fields of -fields, computed per record so they don't have
+// to be computed again downstream
+var derivedFields = []string{"normalized_route", "status_class", "duration_ms"}
+
+// Formats which can add derived fields
+var derivedFieldFormats = []string{"json", "ndjson", "csv", "parquet"}
+
+// Parsing comma-separated -fields list
+func parseDerivedFields(value string) ([]string, error) {
+	var fields []string
+	for _, field := range strings.Split(value, ",") {
+		field = strings.TrimSpace(field)
+		if !slices.Contains(derivedFields, field) {
+			return nil, fmt.Errorf("unknown field %q (supported: %s)", field, strings.Join(derivedFields, ", "))
+		}
+		if !slices.Contains(fields, field) {
+			fields = append(fields, field)
+		}
+	}
+	return fields, nil
+}
+
+// Route of record, URLs without route of -normalize or -routes are
+// normalized with built-in heuristics
+func normalizedRoute(record LogRecord) string {
+	if record.Route != "" {
+		return record.Route
+	}
+	return (&Normalizer{}).Normalize(record.URL)
+}
+
+// Duration in milliseconds
+func durationMs(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Number of lines parsed by worker at once, lowered by -low-memory
+var chunkLines = 4096
+
+// Chunk of input lines and records parsed from them
+type chunk struct {
+	lines   []string
+	records []LogRecord
+	done    chan struct{}
+
+	// Input bytes of lines, [start, end)
+	start, end int64
+
+	// Number of first line, and error which stopped parsing
+	first int
+	err   error
+}
+
+// Input of records which aren't read as lines, like mapped binary
+// record files. Its records are filtered by accept of records it was
+// opened with, accept of lines isn't used.
+type recordInput interface {
+	readRecords(write func(LogRecord) error) error
+}
+
+// Reading input and passing accepted records to write in input order.
+//
+// With more than one worker lines are read in chunks, parsed and
+// filtered concurrently, and chunks are merged back in the order they
+// were read, so output is the same for any number of workers.
+// Chunk is passed to workers early when no more input is buffered,
+// so followed input is not delayed until chunk is full.
+// Optional hooks are called around writing records of every chunk.
+// Error of accept stops reading after records of lines before it.
+// Record inputs are read by one goroutine, their records aren't parsed;
+// with hooks, which need byte offsets, they are read as lines.
+func readRecords(input io.Reader, workers int, accept func(line string, number int) (LogRecord, bool, error), write func(LogRecord) error, hooks OffsetHooks) error {
+	if records, ok := input.(recordInput); ok && hooks == nil {
+		return records.readRecords(write)
+	}
+
+	if workers <= 1 {
+		var start int64
+		number := 0
+		return readLines(input, func(lines []string, end int64) error {
+			if hooks != nil {
+				if err := hooks.Begin(start, end); err != nil {
+					return err
+				}
+			}
+
+			for _, line := range lines {
+				number++
+				record, ok, err := accept(line, number)
+				if err != nil {
+					return err
+				}
+				if ok {
+					if err := write(record); err != nil {
+						return err
+					}
+				}
+			}
+
+			start = end
+			if hooks != nil {
+				return hooks.Commit(end)
+			}
+			return nil
+		})
+	}
+
+	jobs := make(chan *chunk)
+	queue := make(chan *chunk, workers*2)
+	stop := make(chan struct{})
+	readErr := make(chan error, 1)
+
+	for range workers {
+		go func() {
+			for c := range jobs {
+				for i, line := range c.lines {
+					record, ok, err := accept(line, c.first+i)
+					if err != nil {
+						c.err = err
+						break
+					}
+					if ok {
+						c.records = append(c.records, record)
+					}
+				}
+				c.lines = nil
+				close(c.done)
+			}
+		}()
+	}
+
+	go func() {
+		defer close(queue)
+		defer close(jobs)
+
+		var start int64
+		first := 1
+		readErr <- readLines(input, func(lines []string, end int64) error {
+			c := &chunk{lines: lines, done: make(chan struct{}), start: start, end: end, first: first}
+			start = end
+			first += len(lines)
+
+			// Queue keeps input order, so it is filled first
+			select {
+			case <-stop:
+				return errStopped
+			default:
+			}
+
+			select {
+			case queue <- c:
+			case <-stop:
+				return errStopped
+			}
+
+			jobs <- c
+			return nil
+		})
+	}()
+
+	for c := range queue {
+		<-c.done
+
+		if hooks != nil {
+			if err := hooks.Begin(c.start, c.end); err != nil {
+				close(stop)
+				return err
+			}
+		}
+
+		for _, record := range c.records {
+			if err := write(record); err != nil {
+				close(stop)
+				return err
+			}
+		}
+		if c.err != nil {
+			close(stop)
+			return c.err
+		}
+
+		if hooks != nil {
+			if err := hooks.Commit(c.end); err != nil {
+				close(stop)
+				return err
+			}
+		}
+	}
+
+	if err := <-readErr; err != nil && !errors.Is(err, errStopped) {
+		return err
+	}
+	return nil
+}
+
+// Reading was stopped by consumer
+var errStopped = errors.New("stopped")
+
+// Reading input lines in chunks, last chunk may be partial.
+// Handle gets input offset after last line of chunk.
+func readLines(input io.Reader, handle func(lines []string, end int64) error) error {
+	reader := newLineReader(input)
+	lines := make([]string, 0, chunkLines)
+	var offset int64
+
+	for {
+		line, size, err := reader.ReadLine()
+		offset += size
+		if err == nil {
+			lines = append(lines, line)
+		}
+
+		if err != nil && err != io.EOF {
+			return fmt.Errorf("reading input: %w", err)
+		}
+
+		// Full chunk, end of input, or reading more would block
+		if len(lines) > 0 && (len(lines) == chunkLines || err == io.EOF || !reader.Buffered()) {
+			if err := handle(lines, offset); err != nil {
+				return err
+			}
+			lines = make([]string, 0, chunkLines)
+		}
+
+		if err == io.EOF {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Generated gin log of toy service
+func generatedLog(lines int) string {
+	codes := []int{200, 200, 200, 200, 201, 304, 404, 500}
+	methods := []string{"GET", "GET", "POST", "DELETE"}
+	start := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+
+	var b strings.Builder
+	for i := range lines {
+		fmt.Fprintf(&b, "[GIN] %s | %3d | %13v | %15s | %-7s %q\n",
+			start.Add(time.Duration(i)*time.Millisecond).Format("2006/01/02 - 15:04:05"),
+			codes[i%len(codes)], time.Duration(i%997)*time.Microsecond,
+			fmt.Sprintf("10.0.%d.%d", i%7, i%251), methods[i%len(methods)],
+			fmt.Sprintf("/api/items/%d?page=%d", i%113, i%5))
+	}
+	return b.String()
+}
+
+func parseAccept(line string, number int) (LogRecord, bool, error) {
+	record, err := parseLine(line)
+	return record, err == nil, nil
+}
+
+func TestReadRecordsKeepsOrder(t *testing.T) {
+	log := generatedLog(3*chunkLines + 17)
+
+	var want []LogRecord
+	if err := readRecords(strings.NewReader(log), 1, parseAccept, func(record LogRecord) error {
+		want = append(want, record)
+		return nil
+	}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	i := 0
+	err := readRecords(strings.NewReader(log), 4, parseAccept, func(record LogRecord) error {
+		if i >= len(want) || record.URL != want[i].URL || !record.Date.Equal(want[i].Date) {
+			return fmt.Errorf("record %d differs from record of one worker", i+1)
+		}
+		i++
+		return nil
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if i != len(want) || i != 3*chunkLines+17 {
+		t.Errorf("got %d records with 4 workers, %d with one, want %d", i, len(want), 3*chunkLines+17)
+	}
+}
+
+// Speedup of worker pool over one worker parsing the same log
+func BenchmarkReadRecords(b *testing.B) {
+	log := generatedLog(200000)
+
+	counts := []int{1}
+	if runtime.NumCPU() > 1 {
+		counts = append(counts, runtime.NumCPU())
+	}
+	for _, workers := range counts {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			b.SetBytes(int64(len(log)))
+			for b.Loop() {
+				count := 0
+				err := readRecords(strings.NewReader(log), workers, parseAccept, func(LogRecord) error {
+					count++
+					return nil
+				}, nil)
+				if err != nil || count != 200000 {
+					b.Fatalf("got %d records, error %v", count, err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Distinct values kept per query parameter, parameters with more
+// values are unbounded anyway
+const paramMaxValues = 10000
+
+// Parameter is unbounded when it has at least paramUnboundedValues
+// distinct values and most requests with it have new value
+const (
+	paramUnboundedValues = 100
+	paramUnboundedRatio  = 0.5
+)
+
+// Array suffix of parameter name, ids[] and ids[0] are ids
+var paramArraySuffix = regexp.MustCompile(`\[\d*\]$`)
+
+// Query parameters of request URL with decoded names and values,
+// array-style names are merged. Malformed pairs are skipped.
+func queryParams(rawURL string) url.Values {
+	_, query, ok := strings.Cut(rawURL, "?")
+	if !ok {
+		return nil
+	}
+
+	params := url.Values{}
+	for pair := range strings.SplitSeq(query, "&") {
+		name, value, _ := strings.Cut(pair, "=")
+		name, err := url.QueryUnescape(name)
+		if err != nil || name == "" {
+			continue
+		}
+		value, err = url.QueryUnescape(value)
+		if err != nil {
+			continue
+		}
+
+		name = paramArraySuffix.ReplaceAllString(name, "")
+		params[name] = append(params[name], value)
+	}
+	return params
+}
+
+// Group key of param:<name>, values of repeated parameter are
+// joined with commas, requests without it have empty key
+func paramKey(record LogRecord, name string) string {
+	return strings.Join(queryParams(record.URL)[name], ",")
+}
+
+// Cardinality of query parameter
+type ParamStats struct {
+	Name     string `json:"name"`
+	Requests int    `json:"requests"`
+
+	// Distinct values, counting stops at paramMaxValues
+	Values    int  `json:"values"`
+	Capped    bool `json:"capped"`
+	Unbounded bool `json:"unbounded"`
+
+	// Most frequent values
+	Top []ParamValue `json:"top"`
+}
+
+// Value of parameter with number of requests
+type ParamValue struct {
+	Value    string `json:"value"`
+	Requests int    `json:"requests"`
+}
+
+// Values of one parameter
+type paramCounter struct {
+	requests int
+	values   map[string]int
+	capped   bool
+}
+
+// Query parameter cardinalities of requests, of path or route only
+// when path is set
+type Params struct {
+	n      int
+	path   string
+	params map[string]*paramCounter
+}
+
+func NewParams(n int, path string) *Params {
+	return &Params{n: n, path: path, params: make(map[string]*paramCounter)}
+}
+
+// Adding parameters of record
+func (p *Params) Add(record LogRecord) {
+	if p.path != "" && record.Path() != p.path && groupKey(record, "url") != p.path {
+		return
+	}
+	for name, values := range queryParams(record.URL) {
+		counter, ok := p.params[name]
+		if !ok {
+			counter = &paramCounter{values: make(map[string]int)}
+			p.params[name] = counter
+		}
+
+		counter.requests++
+		value := strings.Join(values, ",")
+		if _, ok := counter.values[value]; ok || len(counter.values) < paramMaxValues {
+			counter.values[value]++
+		} else {
+			counter.capped = true
+		}
+	}
+}
+
+// Parameters by number of distinct values
+func (p *Params) Stats() []ParamStats {
+	stats := []ParamStats{}
+	for name, counter := range p.params {
+		s := ParamStats{
+			Name:     name,
+			Requests: counter.requests,
+			Values:   len(counter.values),
+			Capped:   counter.capped,
+			Top:      []ParamValue{},
+		}
+		s.Unbounded = counter.capped || s.Values >= paramUnboundedValues && float64(s.Values) >= paramUnboundedRatio*float64(s.Requests)
+
+		for value, requests := range counter.values {
+			s.Top = append(s.Top, ParamValue{Value: value, Requests: requests})
+		}
+		slices.SortFunc(s.Top, func(a, b ParamValue) int {
+			if a.Requests != b.Requests {
+				return b.Requests - a.Requests
+			}
+			return strings.Compare(a.Value, b.Value)
+		})
+		s.Top = s.Top[:min(len(s.Top), p.n)]
+
+		stats = append(stats, s)
+	}
+
+	slices.SortFunc(stats, func(a, b ParamStats) int {
+		if a.Values != b.Values {
+			return b.Values - a.Values
+		}
+		return strings.Compare(a.Name, b.Name)
+	})
+	return stats
+}
+
+// Parameter cardinality output, unbounded parameters (cache-busting,
+// tokens, abuse) are marked with "*"
+func printParams(stats []ParamStats, locale Locale) {
+	w := newTable(os.Stdout)
+
+	fmt.Fprintf(w, "PARAM\tREQUESTS\tVALUES\tTOP VALUES\n")
+	for _, s := range stats {
+		values := locale.Int(s.Values)
+		if s.Capped {
+			values += "+"
+		}
+		if s.Unbounded {
+			values += " *"
+		}
+
+		var top []string
+		for _, v := range s.Top {
+			top = append(top, fmt.Sprintf("%s (%s)", v.Value, locale.Int(v.Requests)))
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", s.Name, locale.Int(s.Requests), values, strings.Join(top, ", "))
+	}
+	w.Flush()
+
+	if slices.ContainsFunc(stats, func(s ParamStats) bool { return s.Unbounded }) {
+		fmt.Printf("\n* unbounded: at least %d values, most requests with new value (cache-busting or abuse)\n", paramUnboundedValues)
+	}
+}
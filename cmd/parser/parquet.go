@@ -0,0 +1,450 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"math"
+)
+
+// Records in row group of Parquet output, lowered by -low-memory
+var parquetRowGroup int64 = 100000
+
+// Parquet physical types, encodings and codecs of format spec
+const (
+	parquetInt32     = 1
+	parquetInt64     = 2
+	parquetDouble    = 5
+	parquetByteArray = 6
+
+	parquetPlain = 0
+	parquetRLE   = 3
+	parquetGzip  = 2
+
+	parquetDataPage = 0
+)
+
+// Logical types of columns
+const (
+	parquetNoLogical = iota
+	parquetString
+	parquetTimestamp
+)
+
+// Column of Parquet output, values of current row group are kept
+// plain encoded
+type parquetColumn struct {
+	name     string
+	typ      int32
+	logical  int
+	optional bool
+
+	values  bytes.Buffer
+	defined []bool
+}
+
+// Written column chunk
+type parquetChunk struct {
+	offset       int64
+	uncompressed int64
+	compressed   int64
+}
+
+// Written row group
+type parquetRowGroupMeta struct {
+	rows   int64
+	chunks []parquetChunk
+}
+
+// Record writer of Parquet file.
+// Records are written in row groups of gzip compressed columns, so only
+// one row group and offsets of written ones are kept in memory.
+type parquetWriter struct {
+	w       io.Writer
+	offset  int64
+	columns []*parquetColumn
+	fields  []string
+	rows    int64
+	groups  []parquetRowGroupMeta
+	err     error
+}
+
+// Writer of record columns, derived fields of -fields are
+// columns after them
+func newParquetWriter(w io.Writer, fields []string) *parquetWriter {
+	p := &parquetWriter{
+		w:      w,
+		fields: fields,
+		columns: []*parquetColumn{
+			{name: "date", typ: parquetInt64, logical: parquetTimestamp},
+			{name: "code", typ: parquetInt32},
+			{name: "duration_ns", typ: parquetInt64},
+			{name: "ip", typ: parquetByteArray, logical: parquetString},
+			{name: "method", typ: parquetByteArray, logical: parquetString},
+			{name: "url", typ: parquetByteArray, logical: parquetString},
+			{name: "route", typ: parquetByteArray, logical: parquetString},
+			{name: "fields", typ: parquetByteArray, logical: parquetString, optional: true},
+		},
+	}
+
+	for _, field := range fields {
+		column := &parquetColumn{name: field, typ: parquetByteArray, logical: parquetString}
+		if field == "duration_ms" {
+			column.typ, column.logical = parquetDouble, parquetNoLogical
+		}
+		p.columns = append(p.columns, column)
+	}
+	return p
+}
+
+func (p *parquetWriter) Write(record LogRecord) error {
+	if p.err != nil {
+		return p.err
+	}
+
+	c := p.columns
+	c[0].int64(record.Date.UnixMicro())
+	c[1].int32(int32(record.Code))
+	c[2].int64(record.Duration.Nanoseconds())
+	c[3].string(record.IP)
+	c[4].string(record.Method)
+	c[5].string(record.URL)
+	c[6].string(groupKey(record, "url"))
+
+	if len(record.Fields) > 0 {
+		encoded, err := json.Marshal(record.Fields)
+		if err != nil {
+			return err
+		}
+		c[7].string(string(encoded))
+		c[7].defined = append(c[7].defined, true)
+	} else {
+		c[7].defined = append(c[7].defined, false)
+	}
+
+	for i, field := range p.fields {
+		switch field {
+		case "normalized_route":
+			c[8+i].string(normalizedRoute(record))
+		case "status_class":
+			c[8+i].string(statusClass(record.Code))
+		case "duration_ms":
+			c[8+i].double(durationMs(record.Duration))
+		}
+	}
+
+	p.rows++
+	if p.rows%parquetRowGroup == 0 {
+		p.flush()
+	}
+	return p.err
+}
+
+// Writing last row group and footer
+func (p *parquetWriter) Close() error {
+	p.start()
+	if p.rows%parquetRowGroup != 0 {
+		p.flush()
+	}
+
+	footer := p.footer()
+	p.write(footer)
+	p.write(binary.LittleEndian.AppendUint32(nil, uint32(len(footer))))
+	p.write([]byte("PAR1"))
+	return p.err
+}
+
+// Writing buffered values as row group, one data page per column
+func (p *parquetWriter) flush() {
+	p.start()
+	group := parquetRowGroupMeta{rows: p.rows - p.written()}
+
+	for _, c := range p.columns {
+		var body bytes.Buffer
+		if c.optional {
+			levels := rleLevels(c.defined)
+			body.Write(binary.LittleEndian.AppendUint32(nil, uint32(len(levels))))
+			body.Write(levels)
+		}
+		body.Write(c.values.Bytes())
+
+		var compressed bytes.Buffer
+		gz := gzip.NewWriter(&compressed)
+		gz.Write(body.Bytes())
+		gz.Close()
+
+		t := newThriftWriter()
+		t.i32(1, parquetDataPage)
+		t.i32(2, int32(body.Len()))
+		t.i32(3, int32(compressed.Len()))
+		t.begin(5)
+		t.i32(1, int32(group.rows))
+		t.i32(2, parquetPlain)
+		t.i32(3, parquetRLE)
+		t.i32(4, parquetRLE)
+		t.end()
+		header := t.bytes()
+
+		group.chunks = append(group.chunks, parquetChunk{
+			offset:       p.offset,
+			uncompressed: int64(len(header) + body.Len()),
+			compressed:   int64(len(header) + compressed.Len()),
+		})
+		p.write(header)
+		p.write(compressed.Bytes())
+
+		c.values.Reset()
+		c.defined = c.defined[:0]
+	}
+
+	p.groups = append(p.groups, group)
+}
+
+// Rows in written row groups
+func (p *parquetWriter) written() int64 {
+	var n int64
+	for _, g := range p.groups {
+		n += g.rows
+	}
+	return n
+}
+
+// File metadata with schema and row groups
+func (p *parquetWriter) footer() []byte {
+	t := newThriftWriter()
+	t.i32(1, 1)
+
+	t.list(2, thriftStruct, len(p.columns)+1)
+	t.push()
+	t.binary(4, "schema")
+	t.i32(5, int32(len(p.columns)))
+	t.end()
+	for _, c := range p.columns {
+		repetition := int32(0)
+		if c.optional {
+			repetition = 1
+		}
+
+		t.push()
+		t.i32(1, c.typ)
+		t.i32(3, repetition)
+		t.binary(4, c.name)
+
+		// Converted types for older readers, logical types for newer ones
+		switch c.logical {
+		case parquetString:
+			t.i32(6, 0)
+			t.begin(10)
+			t.begin(1)
+			t.end()
+			t.end()
+		case parquetTimestamp:
+			t.i32(6, 10)
+			t.begin(10)
+			t.begin(8)
+			t.boolean(1, true)
+			t.begin(2)
+			t.begin(2)
+			t.end()
+			t.end()
+			t.end()
+			t.end()
+		}
+		t.end()
+	}
+
+	t.i64(3, p.rows)
+
+	t.list(4, thriftStruct, len(p.groups))
+	for _, g := range p.groups {
+		var total int64
+
+		t.push()
+		t.list(1, thriftStruct, len(g.chunks))
+		for i, chunk := range g.chunks {
+			c := p.columns[i]
+			total += chunk.uncompressed
+
+			t.push()
+			t.i64(2, chunk.offset)
+			t.begin(3)
+			t.i32(1, c.typ)
+			t.list(2, thriftI32, 2)
+			t.varint(parquetPlain)
+			t.varint(parquetRLE)
+			t.list(3, thriftBinary, 1)
+			t.string(c.name)
+			t.i32(4, parquetGzip)
+			t.i64(5, g.rows)
+			t.i64(6, chunk.uncompressed)
+			t.i64(7, chunk.compressed)
+			t.i64(9, chunk.offset)
+			t.end()
+			t.end()
+		}
+		t.i64(2, total)
+		t.i64(3, g.rows)
+		t.end()
+	}
+
+	t.binary(6, currentBuild().String())
+	return t.bytes()
+}
+
+// Writing magic at start of file, not when writer is created,
+// so writer which is never used writes nothing
+func (p *parquetWriter) start() {
+	if p.offset == 0 {
+		p.write([]byte("PAR1"))
+	}
+}
+
+func (p *parquetWriter) write(b []byte) {
+	if p.err != nil {
+		return
+	}
+	n, err := p.w.Write(b)
+	p.offset += int64(n)
+	p.err = err
+}
+
+func (c *parquetColumn) int32(v int32) {
+	c.values.Write(binary.LittleEndian.AppendUint32(nil, uint32(v)))
+}
+
+func (c *parquetColumn) int64(v int64) {
+	c.values.Write(binary.LittleEndian.AppendUint64(nil, uint64(v)))
+}
+
+func (c *parquetColumn) double(v float64) {
+	c.values.Write(binary.LittleEndian.AppendUint64(nil, math.Float64bits(v)))
+}
+
+func (c *parquetColumn) string(s string) {
+	c.values.Write(binary.LittleEndian.AppendUint32(nil, uint32(len(s))))
+	c.values.WriteString(s)
+}
+
+// Definition levels of optional column as RLE runs of bit width 1
+func rleLevels(defined []bool) []byte {
+	var out []byte
+	for i := 0; i < len(defined); {
+		j := i
+		for j < len(defined) && defined[j] == defined[i] {
+			j++
+		}
+
+		out = binary.AppendUvarint(out, uint64(j-i)<<1)
+		if defined[i] {
+			out = append(out, 1)
+		} else {
+			out = append(out, 0)
+		}
+		i = j
+	}
+	return out
+}
+
+// Thrift compact protocol types
+const (
+	thriftTrue   = 1
+	thriftFalse  = 2
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftBinary = 8
+	thriftList   = 9
+	thriftStruct = 12
+)
+
+// Writer of Thrift compact protocol, used by Parquet metadata.
+// Writer starts inside top-level struct, nested structs are
+// opened with begin (field) or push (list element) and closed with end.
+type thriftWriter struct {
+	buf  bytes.Buffer
+	last []int16
+}
+
+func newThriftWriter() *thriftWriter {
+	return &thriftWriter{last: []int16{0}}
+}
+
+// Encoded top-level struct
+func (t *thriftWriter) bytes() []byte {
+	t.end()
+	return t.buf.Bytes()
+}
+
+// Field header, field id is delta encoded when possible
+func (t *thriftWriter) field(id int16, typ byte) {
+	last := &t.last[len(t.last)-1]
+	if delta := id - *last; delta > 0 && delta <= 15 {
+		t.buf.WriteByte(byte(delta)<<4 | typ)
+	} else {
+		t.buf.WriteByte(typ)
+		t.varint(int64(id))
+	}
+	*last = id
+}
+
+// Zigzag varint
+func (t *thriftWriter) varint(v int64) {
+	t.buf.Write(binary.AppendUvarint(nil, uint64(v<<1^v>>63)))
+}
+
+func (t *thriftWriter) string(s string) {
+	t.buf.Write(binary.AppendUvarint(nil, uint64(len(s))))
+	t.buf.WriteString(s)
+}
+
+func (t *thriftWriter) i32(id int16, v int32) {
+	t.field(id, thriftI32)
+	t.varint(int64(v))
+}
+
+func (t *thriftWriter) i64(id int16, v int64) {
+	t.field(id, thriftI64)
+	t.varint(v)
+}
+
+func (t *thriftWriter) binary(id int16, s string) {
+	t.field(id, thriftBinary)
+	t.string(s)
+}
+
+func (t *thriftWriter) boolean(id int16, v bool) {
+	if v {
+		t.field(id, thriftTrue)
+	} else {
+		t.field(id, thriftFalse)
+	}
+}
+
+// List header, elements are written after it
+func (t *thriftWriter) list(id int16, elem byte, n int) {
+	t.field(id, thriftList)
+	if n < 15 {
+		t.buf.WriteByte(byte(n)<<4 | elem)
+	} else {
+		t.buf.WriteByte(0xf0 | elem)
+		t.buf.Write(binary.AppendUvarint(nil, uint64(n)))
+	}
+}
+
+// Opening struct field
+func (t *thriftWriter) begin(id int16) {
+	t.field(id, thriftStruct)
+	t.push()
+}
+
+// Opening struct list element
+func (t *thriftWriter) push() {
+	t.last = append(t.last, 0)
+}
+
+// Closing struct
+func (t *thriftWriter) end() {
+	t.buf.WriteByte(0)
+	t.last = t.last[:len(t.last)-1]
+}
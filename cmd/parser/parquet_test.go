@@ -0,0 +1,238 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"io"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// Reader of Thrift compact protocol, structs are decoded into maps
+// of field id to value
+type thriftReader struct {
+	t   *testing.T
+	buf []byte
+}
+
+func (r *thriftReader) byte() byte {
+	if len(r.buf) == 0 {
+		r.t.Fatal("thrift data ended")
+	}
+	b := r.buf[0]
+	r.buf = r.buf[1:]
+	return b
+}
+
+func (r *thriftReader) uvarint() uint64 {
+	v, n := binary.Uvarint(r.buf)
+	if n <= 0 {
+		r.t.Fatal("bad thrift varint")
+	}
+	r.buf = r.buf[n:]
+	return v
+}
+
+func (r *thriftReader) varint() int64 {
+	v := r.uvarint()
+	return int64(v>>1) ^ -int64(v&1)
+}
+
+func (r *thriftReader) value(typ byte) any {
+	switch typ {
+	case thriftTrue:
+		return true
+	case thriftFalse:
+		return false
+	case thriftI32, thriftI64:
+		return r.varint()
+	case thriftBinary:
+		n := r.uvarint()
+		s := string(r.buf[:n])
+		r.buf = r.buf[n:]
+		return s
+	case thriftList:
+		header := r.byte()
+		n := uint64(header >> 4)
+		if n == 15 {
+			n = r.uvarint()
+		}
+		list := make([]any, n)
+		for i := range list {
+			list[i] = r.value(header & 0xf)
+		}
+		return list
+	case thriftStruct:
+		fields := map[int16]any{}
+		var id int16
+		for {
+			header := r.byte()
+			if header == 0 {
+				return fields
+			}
+			if delta := int16(header >> 4); delta != 0 {
+				id += delta
+			} else {
+				id = int16(r.varint())
+			}
+			fields[id] = r.value(header & 0xf)
+		}
+	}
+	r.t.Fatalf("unexpected thrift type %d", typ)
+	return nil
+}
+
+// Decoding struct, returns it and rest of data
+func decodeThrift(t *testing.T, data []byte) (map[int16]any, []byte) {
+	t.Helper()
+	r := &thriftReader{t: t, buf: data}
+	return r.value(thriftStruct).(map[int16]any), r.buf
+}
+
+// Values of column chunk, decompressed data page after level bytes
+func readParquetPage(t *testing.T, file []byte, chunk map[int16]any, optional bool) ([]byte, []byte) {
+	t.Helper()
+	meta := chunk[3].(map[int16]any)
+	header, rest := decodeThrift(t, file[meta[9].(int64):])
+	if header[1].(int64) != parquetDataPage {
+		t.Fatalf("page type %v, want data page", header[1])
+	}
+
+	gz, err := gzip.NewReader(bytes.NewReader(rest[:header[3].(int64)]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := io.ReadAll(gz)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if int64(len(body)) != header[2].(int64) {
+		t.Errorf("page of %d bytes, header says %d", len(body), header[2])
+	}
+
+	if !optional {
+		return nil, body
+	}
+	n := binary.LittleEndian.Uint32(body)
+	return body[4 : 4+n], body[4+n:]
+}
+
+func TestParquetWriter(t *testing.T) {
+	defer func(size int64) { parquetRowGroup = size }(parquetRowGroup)
+	parquetRowGroup = 2
+
+	date := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	records := []LogRecord{
+		{Date: date, Code: 200, Duration: time.Millisecond, IP: "127.0.0.1", Method: "GET", URL: "/a"},
+		{Date: date.Add(time.Second), Code: 404, Duration: 2 * time.Millisecond, IP: "127.0.0.1", Method: "GET", URL: "/b", Fields: map[string]string{"user_agent": "curl"}},
+		{Date: date.Add(2 * time.Second), Code: 500, IP: "10.0.0.1", Method: "POST", URL: "/c"},
+		{Date: date.Add(3 * time.Second), Code: 201, IP: "10.0.0.1", Method: "PUT", URL: "/d"},
+		{Date: date.Add(4 * time.Second), Code: 302, IP: "10.0.0.1", Method: "GET", URL: "/e"},
+	}
+
+	var out bytes.Buffer
+	w := newParquetWriter(&out, []string{"status_class"})
+	for _, record := range records {
+		if err := w.Write(record); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	file := out.Bytes()
+	if !bytes.HasPrefix(file, []byte("PAR1")) || !bytes.HasSuffix(file, []byte("PAR1")) {
+		t.Fatal("missing magic")
+	}
+	size := binary.LittleEndian.Uint32(file[len(file)-8:])
+	meta, rest := decodeThrift(t, file[len(file)-8-int(size):len(file)-8])
+	if len(rest) != 0 {
+		t.Errorf("%d bytes after footer", len(rest))
+	}
+
+	if meta[3] != int64(len(records)) {
+		t.Errorf("num_rows %v, want %d", meta[3], len(records))
+	}
+
+	var names []string
+	for _, element := range meta[2].([]any) {
+		names = append(names, element.(map[int16]any)[4].(string))
+	}
+	want := []string{"schema", "date", "code", "duration_ns", "ip", "method", "url", "route", "fields", "status_class"}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("schema %q, want %q", names, want)
+	}
+
+	var codes []int32
+	var urls, classes []string
+	var levels []byte
+	groups := meta[4].([]any)
+	for i, g := range groups {
+		group := g.(map[int16]any)
+		if rows := group[3].(int64); rows != min(2, int64(len(records)-2*i)) {
+			t.Errorf("row group %d has %d rows", i, rows)
+		}
+		chunks := group[1].([]any)
+
+		_, values := readParquetPage(t, file, chunks[1].(map[int16]any), false)
+		for len(values) > 0 {
+			codes = append(codes, int32(binary.LittleEndian.Uint32(values)))
+			values = values[4:]
+		}
+
+		urls = append(urls, byteArrays(t, file, chunks[5].(map[int16]any))...)
+		classes = append(classes, byteArrays(t, file, chunks[8].(map[int16]any))...)
+
+		groupLevels, _ := readParquetPage(t, file, chunks[7].(map[int16]any), true)
+		levels = append(levels, groupLevels...)
+	}
+
+	if len(groups) != 3 {
+		t.Errorf("%d row groups, want 3", len(groups))
+	}
+	if want := []int32{200, 404, 500, 201, 302}; !reflect.DeepEqual(codes, want) {
+		t.Errorf("codes %v, want %v", codes, want)
+	}
+	if want := []string{"/a", "/b", "/c", "/d", "/e"}; !reflect.DeepEqual(urls, want) {
+		t.Errorf("urls %q, want %q", urls, want)
+	}
+	if want := []string{"2xx", "4xx", "5xx", "2xx", "3xx"}; !reflect.DeepEqual(classes, want) {
+		t.Errorf("status classes %q, want %q", classes, want)
+	}
+	if want := []byte{2, 0, 2, 1, 4, 0, 2, 0}; !bytes.Equal(levels, want) {
+		t.Errorf("definition levels of fields %v, want %v", levels, want)
+	}
+}
+
+// Plain encoded byte arrays of column chunk
+func byteArrays(t *testing.T, file []byte, chunk map[int16]any) []string {
+	t.Helper()
+	_, values := readParquetPage(t, file, chunk, false)
+
+	var out []string
+	for len(values) > 0 {
+		n := binary.LittleEndian.Uint32(values)
+		out = append(out, string(values[4:4+n]))
+		values = values[4+n:]
+	}
+	return out
+}
+
+func TestRLELevels(t *testing.T) {
+	tests := []struct {
+		defined []bool
+		want    []byte
+	}{
+		{nil, nil},
+		{[]bool{true, true, false}, []byte{4, 1, 2, 0}},
+		{make([]bool, 100), []byte{200, 1, 0}},
+	}
+	for _, tt := range tests {
+		if got := rleLevels(tt.defined); !bytes.Equal(got, tt.want) {
+			t.Errorf("rleLevels(%v) = %v, want %v", tt.defined, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Number of durations kept for exact percentiles, after that
+// values are moved into the sketch. Zero with -low-memory.
+var exactLimit = 100000
+
+// Relative accuracy of sketch quantiles
+const sketchAccuracy = 0.01
+
+// Percentile value of metrics
+type Percentile struct {
+	P     float64       `json:"p"`
+	Value time.Duration `json:"value"`
+}
+
+// Percentile estimator.
+// Exact for small inputs, switches to a log-bucketed sketch
+// (DDSketch-like, bounded relative error) for large ones.
+type Quantiles struct {
+	values []time.Duration
+	sketch *Sketch
+}
+
+// Adding duration to estimator
+func (q *Quantiles) Add(d time.Duration) {
+	if q.sketch != nil {
+		q.sketch.Add(d)
+		return
+	}
+
+	q.values = append(q.values, d)
+	if len(q.values) <= exactLimit {
+		return
+	}
+
+	q.sketch = NewSketch()
+	for _, v := range q.values {
+		q.sketch.Add(v)
+	}
+	q.values = nil
+}
+
+// Getting quantile, p is in range 0-100
+func (q *Quantiles) Quantile(p float64) time.Duration {
+	if q.sketch != nil {
+		return q.sketch.Quantile(p)
+	}
+
+	if len(q.values) == 0 {
+		return 0
+	}
+
+	if !slices.IsSorted(q.values) {
+		slices.Sort(q.values)
+	}
+
+	// Nearest-rank method
+	rank := int(math.Ceil(p / 100 * float64(len(q.values))))
+	if rank < 1 {
+		rank = 1
+	}
+	return q.values[rank-1]
+}
+
+// Streaming quantile sketch with logarithmic buckets
+type Sketch struct {
+	gamma  float64
+	counts map[int]int
+	zeros  int
+	total  int
+}
+
+// Creating empty sketch
+func NewSketch() *Sketch {
+	return &Sketch{
+		gamma:  (1 + sketchAccuracy) / (1 - sketchAccuracy),
+		counts: make(map[int]int),
+	}
+}
+
+// Adding duration to sketch
+func (s *Sketch) Add(d time.Duration) {
+	s.total++
+	if d <= 0 {
+		s.zeros++
+		return
+	}
+
+	s.counts[s.index(d)]++
+}
+
+// Merging other sketch into this one
+func (s *Sketch) Merge(other *Sketch) {
+	s.total += other.total
+	s.zeros += other.zeros
+	for i, c := range other.counts {
+		s.counts[i] += c
+	}
+}
+
+// Getting quantile, p is in range 0-100
+func (s *Sketch) Quantile(p float64) time.Duration {
+	if s.total == 0 {
+		return 0
+	}
+
+	rank := int(math.Ceil(p / 100 * float64(s.total)))
+	if rank <= s.zeros {
+		return 0
+	}
+
+	keys := make([]int, 0, len(s.counts))
+	for i := range s.counts {
+		keys = append(keys, i)
+	}
+	slices.Sort(keys)
+
+	seen := s.zeros
+	for _, i := range keys {
+		seen += s.counts[i]
+		if seen >= rank {
+			return s.value(i)
+		}
+	}
+
+	return s.value(keys[len(keys)-1])
+}
+
+// Sketch serialized for re-aggregation elsewhere: bins are pairs of
+// bucket index and count, bucket i holds durations (in ns) up to
+// gamma^i, where gamma = (1 + accuracy) / (1 - accuracy). Merging
+// sketches is adding counts of same indexes.
+func (s *Sketch) MarshalJSON() ([]byte, error) {
+	bins := make([][2]int, 0, len(s.counts))
+	for _, i := range slices.Sorted(maps.Keys(s.counts)) {
+		bins = append(bins, [2]int{i, s.counts[i]})
+	}
+	return json.Marshal(struct {
+		Accuracy float64  `json:"accuracy"`
+		Zeros    int      `json:"zeros"`
+		Bins     [][2]int `json:"bins"`
+	}{sketchAccuracy, s.zeros, bins})
+}
+
+// Bucket index of duration
+func (s *Sketch) index(d time.Duration) int {
+	return int(math.Ceil(math.Log(float64(d)) / math.Log(s.gamma)))
+}
+
+// Representative duration of bucket
+func (s *Sketch) value(i int) time.Duration {
+	return time.Duration(2 * math.Pow(s.gamma, float64(i)) / (s.gamma + 1))
+}
+
+// Parsing percentile list like "50,90,95,99"
+func parsePercentiles(value string) ([]float64, error) {
+	var percentiles []float64
+
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		p, err := strconv.ParseFloat(strings.TrimPrefix(part, "p"), 64)
+		if err != nil || p <= 0 || p > 100 {
+			return nil, fmt.Errorf("invalid percentile %q", part)
+		}
+		percentiles = append(percentiles, p)
+	}
+
+	return percentiles, nil
+}
+
+// Percentile label like p99 or p99.9
+func percentileLabel(p float64) string {
+	return "p" + strconv.FormatFloat(p, 'f', -1, 64)
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestQuantilesNearestRank(t *testing.T) {
+	var q Quantiles
+	if got := q.Quantile(50); got != 0 {
+		t.Errorf("empty quantile = %v, want 0", got)
+	}
+
+	for _, d := range []time.Duration{5, 1, 4, 2, 3, 10, 9, 8, 7, 6} {
+		q.Add(d)
+	}
+	for p, want := range map[float64]time.Duration{0: 1, 10: 1, 11: 2, 50: 5, 90: 9, 99: 10, 100: 10} {
+		if got := q.Quantile(p); got != want {
+			t.Errorf("p%v = %v, want %v", p, got, want)
+		}
+	}
+}
+
+func TestQuantilesSwitchToSketch(t *testing.T) {
+	defer func(limit int) { exactLimit = limit }(exactLimit)
+	exactLimit = 10
+
+	var q Quantiles
+	for i := 1; i <= 1000; i++ {
+		q.Add(time.Duration(i) * time.Millisecond)
+	}
+	if q.sketch == nil || q.values != nil {
+		t.Fatal("values are not moved into sketch over exact limit")
+	}
+	checkAccuracy(t, q.Quantile(99), 990*time.Millisecond)
+}
+
+func checkAccuracy(t *testing.T, got, want time.Duration) {
+	t.Helper()
+	if math.Abs(float64(got-want)) > sketchAccuracy*float64(want) {
+		t.Errorf("quantile %v, want %v within %v", got, want, sketchAccuracy)
+	}
+}
+
+func TestSketch(t *testing.T) {
+	s := NewSketch()
+	if got := s.Quantile(50); got != 0 {
+		t.Errorf("empty sketch quantile = %v, want 0", got)
+	}
+
+	for i := 1; i <= 10000; i++ {
+		s.Add(time.Duration(i) * time.Microsecond)
+	}
+	for _, p := range []float64{1, 25, 50, 90, 99, 99.9, 100} {
+		want := time.Duration(math.Ceil(p/100*10000)) * time.Microsecond
+		checkAccuracy(t, s.Quantile(p), want)
+	}
+}
+
+func TestSketchZeros(t *testing.T) {
+	s := NewSketch()
+	for range 30 {
+		s.Add(0)
+	}
+	for range 70 {
+		s.Add(time.Second)
+	}
+
+	if got := s.Quantile(30); got != 0 {
+		t.Errorf("p30 = %v, want 0", got)
+	}
+	checkAccuracy(t, s.Quantile(31), time.Second)
+}
+
+func TestSketchMerge(t *testing.T) {
+	a, b, all := NewSketch(), NewSketch(), NewSketch()
+	for i := 1; i <= 1000; i++ {
+		d := time.Duration(i) * time.Millisecond
+		if i%3 == 0 {
+			a.Add(d)
+		} else {
+			b.Add(d)
+		}
+		all.Add(d)
+	}
+	a.Add(0)
+	all.Add(0)
+
+	a.Merge(b)
+	if !reflect.DeepEqual(a, all) {
+		t.Error("merged sketch differs from sketch of all durations")
+	}
+}
+
+func TestParsePercentiles(t *testing.T) {
+	got, err := parsePercentiles("50, p90,,99.9")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []float64{50, 90, 99.9}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	for _, value := range []string{"0", "101", "-5", "p", "x50"} {
+		if _, err := parsePercentiles(value); err == nil {
+			t.Errorf("parsePercentiles(%q) succeeded, want error", value)
+		}
+	}
+
+	if got := percentileLabel(99.9); got != "p99.9" {
+		t.Errorf("label = %q, want p99.9", got)
+	}
+}
@@ -0,0 +1,803 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Consumer of filtered records.
+// Records are added one by one as lines are read, each sink keeps
+// only what its output needs and prints it on finish.
+type Sink interface {
+	Add(record LogRecord) error
+	Finish() error
+}
+
+// Stage of pipeline
+type stage struct {
+	sink Sink
+
+	// Sink receives only records with plausible durations
+	checked bool
+}
+
+// Streaming pipeline of sinks.
+// Durations are checked once per record, suspicious ones are passed
+// only to sinks printing records as they are.
+type Pipeline struct {
+	checker *SanityChecker
+	stages  []stage
+}
+
+// Creating pipeline, nil checker passes every record to all sinks
+func NewPipeline(checker *SanityChecker) *Pipeline {
+	return &Pipeline{checker: checker}
+}
+
+// Adding sink receiving every record
+func (p *Pipeline) Add(sink Sink) {
+	p.stages = append(p.stages, stage{sink: sink})
+}
+
+// Adding sink receiving records with plausible durations
+func (p *Pipeline) AddChecked(sink Sink) {
+	p.stages = append(p.stages, stage{sink: sink, checked: true})
+}
+
+// Passing record to sinks
+func (p *Pipeline) Write(record LogRecord) error {
+	plausible := p.checker == nil || p.checker.Check(record)
+
+	for _, stage := range p.stages {
+		if stage.checked && !plausible {
+			continue
+		}
+
+		if err := stage.sink.Add(record); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Finishing sinks in order they were added
+func (p *Pipeline) Finish() error {
+	for _, stage := range p.stages {
+		if err := stage.sink.Finish(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Number of records excluded as suspicious
+func (p *Pipeline) Suspicious() int {
+	if p.checker == nil {
+		return 0
+	}
+	return p.checker.Suspicious
+}
+
+// Sink writing records in record format
+type recordSink struct {
+	w RecordWriter
+}
+
+func (s recordSink) Add(record LogRecord) error {
+	if err := s.w.Write(record); err != nil {
+		return fmt.Errorf("writing output: %w", err)
+	}
+	return nil
+}
+
+func (s recordSink) Finish() error {
+	if err := s.w.Close(); err != nil {
+		return fmt.Errorf("writing output: %w", err)
+	}
+	return nil
+}
+
+// Sink writing Prometheus exposition
+type promSink struct {
+	collector *PromCollector
+}
+
+func (s promSink) Add(record LogRecord) error {
+	s.collector.Add(record)
+	return nil
+}
+
+func (s promSink) Finish() error {
+	if err := s.collector.Write(os.Stdout); err != nil {
+		return fmt.Errorf("writing output: %w", err)
+	}
+	return nil
+}
+
+// Sink writing N slowest records, text format is table
+type slowestSink struct {
+	tracker *SlowestTracker
+	format  string
+	fields  []string
+	locale  Locale
+}
+
+func (s slowestSink) Add(record LogRecord) error {
+	s.tracker.Add(record)
+	return nil
+}
+
+func (s slowestSink) Finish() error {
+	if s.format == "text" {
+		printSlowest(s.tracker.Records(), s.locale)
+		return nil
+	}
+
+	return printRecords(s.tracker.Records(), s.format, s.fields)
+}
+
+// Sink writing URLs of top urls report for cache warmers
+type warmSink struct {
+	list  *WarmList
+	limit int
+	base  string
+}
+
+func (s warmSink) Add(record LogRecord) error {
+	s.list.Add(record)
+	return nil
+}
+
+func (s warmSink) Finish() error {
+	return writeWarmList(os.Stdout, s.list.URLs(s.limit), s.base)
+}
+
+// Sink of group-by and aggregated top reports
+type groupSink struct {
+	groups *GroupAccumulator
+	by     string
+	json   bool
+	locale Locale
+
+	// Record filter of top report and number of printed groups,
+	// zero limit prints all
+	include func(LogRecord) bool
+	limit   int
+
+	// Filter of groups by their metrics, -having
+	having Expr
+
+	privacy *Privacy
+}
+
+func (s groupSink) Add(record LogRecord) error {
+	if s.privacy != nil {
+		record = s.privacy.Record(record)
+	}
+	if s.include == nil || s.include(record) {
+		s.groups.Add(record)
+	}
+	return nil
+}
+
+func (s groupSink) Finish() error {
+	groups := s.groups.Groups()
+	if s.privacy != nil {
+		groups = s.privacy.Groups(groups, s.by)
+	}
+	if s.having != nil {
+		groups = slices.DeleteFunc(groups, func(g GroupMetrics) bool {
+			return !exprMatches(s.having, groupEnv(g))
+		})
+	}
+	if s.limit > 0 {
+		groups = groups[:min(s.limit, len(groups))]
+	}
+
+	if s.json {
+		return printJSON(groups)
+	} else {
+		printGroups(groups, s.by, s.locale)
+	}
+	return nil
+}
+
+// Sink of -split-at comparison
+type compareSink struct {
+	samples *SplitSamples
+	alpha   float64
+	json    bool
+	locale  Locale
+}
+
+func (s compareSink) Add(record LogRecord) error {
+	s.samples.Add(record)
+	return nil
+}
+
+func (s compareSink) Finish() error {
+	comparisons := compareRoutes(s.samples.Before, s.samples.After, s.alpha)
+
+	if s.json {
+		return printJSON(comparisons)
+	} else {
+		printComparison(comparisons, s.locale)
+	}
+	return nil
+}
+
+// Sink of -interval time series
+type seriesSink struct {
+	series *TimeSeries
+	format string
+	json   bool
+	locale Locale
+}
+
+func (s seriesSink) Add(record LogRecord) error {
+	s.series.Add(record)
+	return nil
+}
+
+func (s seriesSink) Finish() error {
+	buckets, err := s.series.Buckets()
+	if err != nil {
+		return fmt.Errorf("in -interval: %w", err)
+	}
+
+	switch {
+	case s.format == "ndjson":
+		return printTimeSeriesNDJSON(buckets)
+	case s.json:
+		return printJSON(buckets)
+	default:
+		printTimeSeries(buckets, s.locale)
+	}
+	return nil
+}
+
+// Sink of -forecast
+type forecastSink struct {
+	forecaster *Forecaster
+	format     string
+	json       bool
+	locale     Locale
+}
+
+func (s forecastSink) Add(record LogRecord) error {
+	s.forecaster.Add(record)
+	return nil
+}
+
+func (s forecastSink) Finish() error {
+	forecasts, err := s.forecaster.Forecasts()
+	if err != nil {
+		return fmt.Errorf("in -forecast: %w", err)
+	}
+
+	switch {
+	case s.format == "csv":
+		if err := writeForecastCSV(forecasts); err != nil {
+			return fmt.Errorf("writing output: %w", err)
+		}
+	case s.json:
+		return printJSON(forecasts)
+	default:
+		printForecasts(forecasts, s.forecaster.interval, s.forecaster.horizon, s.locale)
+	}
+	return nil
+}
+
+// Sink of -arrivals
+type arrivalsSink struct {
+	arrivals *Arrivals
+	json     bool
+	locale   Locale
+}
+
+func (s arrivalsSink) Add(record LogRecord) error {
+	s.arrivals.Add(record)
+	return nil
+}
+
+func (s arrivalsSink) Finish() error {
+	all, routes := s.arrivals.Stats()
+	if s.json {
+		return printJSON(struct {
+			All    ArrivalStats   `json:"all"`
+			Routes []ArrivalStats `json:"routes"`
+		}{all, routes})
+	} else {
+		printArrivals(all, routes, s.locale)
+	}
+	return nil
+}
+
+// Sink of query parameter report
+type paramsSink struct {
+	params *Params
+	json   bool
+	locale Locale
+}
+
+func (s paramsSink) Add(record LogRecord) error {
+	s.params.Add(record)
+	return nil
+}
+
+func (s paramsSink) Finish() error {
+	if s.json {
+		return printJSON(s.params.Stats())
+	} else {
+		printParams(s.params.Stats(), s.locale)
+	}
+	return nil
+}
+
+// Sink of client report
+type clientsSink struct {
+	clients *Clients
+	privacy *Privacy
+	json    bool
+	locale  Locale
+}
+
+func (s clientsSink) Add(record LogRecord) error {
+	if s.privacy != nil {
+		record = s.privacy.Record(record)
+	}
+	s.clients.Add(record)
+	return nil
+}
+
+func (s clientsSink) Finish() error {
+	report := s.clients.Report()
+	if s.privacy != nil {
+		report = s.privacy.Clients(report)
+	}
+
+	if s.json {
+		return printJSON(report)
+	} else {
+		printClients(report, s.locale)
+	}
+	return nil
+}
+
+// Sink of impact report
+type impactSink struct {
+	groups     *GroupAccumulator
+	budget     time.Duration
+	percentile float64
+	json       bool
+	locale     Locale
+}
+
+func (s impactSink) Add(record LogRecord) error {
+	s.groups.Add(record)
+	return nil
+}
+
+func (s impactSink) Finish() error {
+	report := routeImpacts(s.groups.Groups(), s.budget, s.percentile)
+	if s.json {
+		return printJSON(report)
+	} else {
+		printImpact(report, s.locale)
+	}
+	return nil
+}
+
+// Sink of threat feed report
+type threatsSink struct {
+	threats *Threats
+	json    bool
+	locale  Locale
+}
+
+func (s threatsSink) Add(record LogRecord) error {
+	s.threats.Add(record)
+	return nil
+}
+
+func (s threatsSink) Finish() error {
+	if s.json {
+		return printJSON(s.threats.Report())
+	} else {
+		printThreats(s.threats.Report(), s.threats.interval, s.locale)
+	}
+	return nil
+}
+
+// Sink of keep-alive report
+type keepAliveSink struct {
+	keepAlive *KeepAlive
+	json      bool
+	locale    Locale
+}
+
+func (s keepAliveSink) Add(record LogRecord) error {
+	s.keepAlive.Add(record)
+	return nil
+}
+
+func (s keepAliveSink) Finish() error {
+	if s.json {
+		return printJSON(s.keepAlive.Report())
+	} else {
+		printKeepAlive(s.keepAlive.Report(), s.locale)
+	}
+	return nil
+}
+
+// Sink writing folded stacks of server time
+type foldedSink struct {
+	stacks *FoldedStacks
+}
+
+func (s foldedSink) Add(record LogRecord) error {
+	s.stacks.Add(record)
+	return nil
+}
+
+func (s foldedSink) Finish() error {
+	return s.stacks.Write(os.Stdout)
+}
+
+// Sink of client growth report, state is saved before output
+type growthSink struct {
+	growth *Growth
+	state  string
+	dryRun *DryRun
+	json   bool
+	locale Locale
+}
+
+func (s growthSink) Add(record LogRecord) error {
+	s.growth.Add(record)
+	return nil
+}
+
+func (s growthSink) Finish() error {
+	if s.state != "" {
+		if err := s.growth.Save(s.state, s.dryRun); err != nil {
+			return err
+		}
+	}
+	if s.json {
+		return printJSON(s.growth.Report())
+	} else {
+		printGrowth(s.growth.Report(), s.locale)
+	}
+	return nil
+}
+
+// Sink of conformance report, traffic outside allowlist is recorded
+// as issue
+type conformanceSink struct {
+	conformance *Conformance
+	issues      *Issues
+	json        bool
+	locale      Locale
+}
+
+func (s conformanceSink) Add(record LogRecord) error {
+	s.conformance.Add(record)
+	return nil
+}
+
+func (s conformanceSink) Finish() error {
+	report := s.conformance.Report()
+	for _, v := range report.Violations {
+		s.issues.Add(issueConformance, fmt.Sprintf("%s %s %s", strings.ReplaceAll(v.Kind, "_", " "), v.Method, v.Route))
+	}
+	if s.json {
+		return printJSON(report)
+	} else {
+		printConformance(report, s.locale)
+	}
+	return nil
+}
+
+// Sink of latency heatmap, SVG has room for more columns than
+// terminal
+type heatmapSink struct {
+	heatmap *Heatmap
+	svg     bool
+	json    bool
+	locale  Locale
+}
+
+func (s heatmapSink) Add(record LogRecord) error {
+	s.heatmap.Add(record)
+	return nil
+}
+
+func (s heatmapSink) Finish() error {
+	columns := heatmapColumns
+	if s.svg {
+		columns = heatmapSVGColumns
+	}
+	report, err := s.heatmap.Report(columns)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case s.json:
+		return printJSON(report)
+	case s.svg:
+		return writeHeatmapSVG(os.Stdout, report, s.locale)
+	default:
+		printHeatmap(report, s.locale)
+	}
+	return nil
+}
+
+// Sink of user quota report
+type quotasSink struct {
+	quotas *Quotas
+	json   bool
+	locale Locale
+}
+
+func (s quotasSink) Add(record LogRecord) error {
+	s.quotas.Add(record)
+	return nil
+}
+
+func (s quotasSink) Finish() error {
+	if s.json {
+		return printJSON(s.quotas.Report())
+	} else {
+		printQuotas(s.quotas.Report(), s.locale)
+	}
+	return nil
+}
+
+// Sink of capacity report
+type capacitySink struct {
+	capacity *Capacity
+	json     bool
+	locale   Locale
+}
+
+func (s capacitySink) Add(record LogRecord) error {
+	s.capacity.Add(record)
+	return nil
+}
+
+func (s capacitySink) Finish() error {
+	if s.json {
+		return printJSON(s.capacity.Report())
+	} else {
+		printCapacity(s.capacity.Report(), s.locale)
+	}
+	return nil
+}
+
+// Sink of path tree report
+type treeSink struct {
+	tree   *Tree
+	json   bool
+	locale Locale
+}
+
+func (s treeSink) Add(record LogRecord) error {
+	s.tree.Add(record)
+	return nil
+}
+
+func (s treeSink) Finish() error {
+	if s.json {
+		return printJSON(s.tree.Report())
+	} else {
+		printTree(s.tree.Report(), s.locale)
+	}
+	return nil
+}
+
+// Sink of crawler report
+type crawlersSink struct {
+	crawlers *Crawlers
+	json     bool
+	locale   Locale
+}
+
+func (s crawlersSink) Add(record LogRecord) error {
+	s.crawlers.Add(record)
+	return nil
+}
+
+func (s crawlersSink) Finish() error {
+	if s.json {
+		return printJSON(s.crawlers.Report())
+	} else {
+		printCrawlers(s.crawlers.Report(), s.locale)
+	}
+	return nil
+}
+
+// Sink of error episodes report
+type episodesSink struct {
+	episodes *Episodes
+	json     bool
+	locale   Locale
+}
+
+func (s episodesSink) Add(record LogRecord) error {
+	s.episodes.Add(record)
+	return nil
+}
+
+func (s episodesSink) Finish() error {
+	if s.json {
+		return printJSON(s.episodes.Report())
+	} else {
+		printEpisodes(s.episodes.Report(), s.locale)
+	}
+	return nil
+}
+
+// Sink of anomalies report
+type anomaliesSink struct {
+	anomalies *Anomalies
+	json      bool
+	locale    Locale
+}
+
+func (s anomaliesSink) Add(record LogRecord) error {
+	s.anomalies.Add(record)
+	return nil
+}
+
+func (s anomaliesSink) Finish() error {
+	anomalies := s.anomalies.Anomalies()
+	if s.json {
+		return printJSON(anomalies)
+	} else {
+		printAnomalies(anomalies, s.anomalies.config, s.locale)
+	}
+	return nil
+}
+
+// Sink of latency histogram
+type histogramSink struct {
+	histogram *Histogram
+	json      bool
+	locale    Locale
+}
+
+func (s histogramSink) Add(record LogRecord) error {
+	s.histogram.Add(record)
+	return nil
+}
+
+func (s histogramSink) Finish() error {
+	if s.json {
+		return printJSON(s.histogram.Buckets())
+	} else {
+		printHistogram(s.histogram.Buckets(), s.locale)
+	}
+	return nil
+}
+
+// Sink of overall metrics
+type metricsSink struct {
+	metrics  *MetricsAccumulator
+	pipeline *Pipeline
+	json     bool
+	template *template.Template
+	locale   Locale
+}
+
+func (s metricsSink) Add(record LogRecord) error {
+	s.metrics.Add(record)
+	return nil
+}
+
+func (s metricsSink) Finish() error {
+	metrics := s.metrics.Metrics()
+	metrics.Suspicious = s.pipeline.Suspicious()
+
+	switch {
+	case s.json:
+		return printJSON(metrics)
+	case s.template != nil:
+		return executeTemplate(os.Stdout, s.template, &bytes.Buffer{}, metrics)
+	default:
+		printMetrics(metrics, s.locale)
+	}
+	return nil
+}
+
+// Sink sending email report.
+// Records are kept for CSV attachment. With dry run SMTP server
+// and credentials are checked, but nothing is sent.
+type emailSink struct {
+	config   EmailConfig
+	metrics  *MetricsAccumulator
+	pipeline *Pipeline
+	locale   Locale
+	records  []LogRecord
+	dryRun   *DryRun
+}
+
+func (s *emailSink) Add(record LogRecord) error {
+	s.metrics.Add(record)
+	s.records = append(s.records, record)
+	return nil
+}
+
+func (s *emailSink) Finish() error {
+	metrics := s.metrics.Metrics()
+	metrics.Suspicious = s.pipeline.Suspicious()
+
+	if s.dryRun != nil {
+		_, message, err := renderReport(s.config, metrics, s.records, s.locale)
+		if err != nil {
+			return fmt.Errorf("sending email: %w", err)
+		}
+
+		s.dryRun.Check("smtp "+s.config.Server, checkSMTP(s.config))
+		s.dryRun.Target("email to "+strings.Join(s.config.To, ", "), "messages", fmt.Sprintf("%d records attached", len(s.records))).
+			Add(1, int64(len(message)))
+		return nil
+	}
+
+	if err := sendReport(s.config, metrics, s.records, s.locale); err != nil {
+		return fmt.Errorf("sending email: %w", err)
+	}
+	return nil
+}
+
+// Sink evaluating alert rules and notifying about them.
+// Notification errors are printed and don't stop output.
+type alertSink struct {
+	rules     []AlertRule
+	metrics   *MetricsAccumulator
+	notifiers []Notifier
+	silences  []Silence
+	now       time.Time
+	issues    *Issues
+
+	// Firing alerts, saved to statePath when it's given
+	state     *AlertState
+	statePath string
+	dryRun    *DryRun
+}
+
+func (s alertSink) Add(record LogRecord) error {
+	s.metrics.Add(record)
+	return nil
+}
+
+func (s alertSink) Finish() error {
+	metrics := s.metrics.Metrics()
+
+	for _, rule := range s.rules {
+		alert := rule.Evaluate(metrics)
+		if alert.Pending {
+			fmt.Fprintf(os.Stderr, "PENDING %s (not enough data)\n", alert.Summary())
+		} else if alert.Firing {
+			fmt.Fprintf(os.Stderr, "ALERT %s\n", alert.Summary())
+		}
+	}
+
+	for _, err := range runAlerts(s.rules, metrics, s.notifiers, s.silences, s.state, s.issues, s.now) {
+		fmt.Fprintf(os.Stderr, "Error sending alert: %v\n", err)
+		s.issues.Add(issueAlerts, err.Error())
+	}
+	if s.statePath != "" {
+		if err := s.state.Save(s.statePath, s.dryRun); err != nil {
+			return fmt.Errorf("writing alert state: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Flag of preset, repeatable flags have one entry per value
+type presetFlag struct {
+	name  string
+	value string
+}
+
+// Path of config file, $GINLOG_CONFIG or ~/.ginlog.yaml
+func configPath() string {
+	if path := os.Getenv("GINLOG_CONFIG"); path != "" {
+		return path
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ".ginlog.yaml"
+	}
+	return filepath.Join(home, ".ginlog.yaml")
+}
+
+// Replacing -preset NAME arguments with flags of preset, so flags
+// after it override preset ones
+func expandPresets(args []string) ([]string, error) {
+	var presets map[string][]presetFlag
+	var expanded []string
+
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			return append(expanded, args[i:]...), nil
+		}
+
+		name, ok := "", false
+		switch {
+		case arg == "-preset" || arg == "--preset":
+			if i+1 == len(args) {
+				return nil, fmt.Errorf("flag needs an argument: -preset")
+			}
+			name, ok = args[i+1], true
+			i++
+		case strings.HasPrefix(arg, "-preset=") || strings.HasPrefix(arg, "--preset="):
+			_, name, _ = strings.Cut(arg, "=")
+			ok = true
+		}
+
+		if !ok {
+			expanded = append(expanded, arg)
+			continue
+		}
+
+		if presets == nil {
+			var err error
+			if presets, err = loadPresets(configPath()); err != nil {
+				return nil, err
+			}
+		}
+
+		flags, found := presets[name]
+		if !found {
+			names := make([]string, 0, len(presets))
+			for name := range presets {
+				names = append(names, name)
+			}
+			slices.Sort(names)
+			return nil, fmt.Errorf("unknown preset %q (defined in %s: %s)", name, configPath(), strings.Join(names, ", "))
+		}
+
+		for _, flag := range flags {
+			expanded = append(expanded, "-"+flag.name+"="+flag.value)
+		}
+	}
+
+	return expanded, nil
+}
+
+// Loading presets of config file, written in subset of YAML:
+//
+//	version: 2
+//	presets:
+//	  errors-api:
+//	    url-prefix: /api
+//	    class: 5xx
+//	    format: json
+//	    alert:
+//	      - "p95 > 1s"
+//
+// Keys of preset are flag names, lists are repeated flags.
+// Other top-level sections are ignored, files of older schema
+// versions are read as well ("ginlog config migrate" upgrades them).
+func loadPresets(path string) (map[string][]presetFlag, error) {
+	return loadFlagSections(path, "presets")
+}
+
+// Loading named maps of flags of top-level section of config file,
+// presets and jobs are written alike
+func loadFlagSections(path, name string) (map[string][]presetFlag, error) {
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("config file %s not found", path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	presets := make(map[string][]presetFlag)
+
+	var section, preset, list string
+	presetIndent, flagIndent := -1, -1
+
+	scanner := bufio.NewScanner(file)
+	for n := 1; scanner.Scan(); n++ {
+		line := stripYAMLComment(scanner.Text())
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		content := strings.TrimLeft(line, " ")
+		indent := len(line) - len(content)
+		if strings.HasPrefix(content, "\t") {
+			return nil, fmt.Errorf("%s:%d: tabs can't be used for indentation", path, n)
+		}
+
+		fail := func(format string, args ...any) error {
+			return fmt.Errorf("%s:%d: %s", path, n, fmt.Sprintf(format, args...))
+		}
+
+		// List item of flag
+		if item, ok := strings.CutPrefix(content, "- "); ok || content == "-" {
+			if section != name {
+				continue
+			}
+			if list == "" || indent < flagIndent {
+				return nil, fail("unexpected list item")
+			}
+			value, err := yamlScalar(item)
+			if err != nil {
+				return nil, fail("%v", err)
+			}
+			presets[preset] = append(presets[preset], presetFlag{list, value})
+			continue
+		}
+		list = ""
+
+		key, rest, ok := strings.Cut(content, ":")
+		if !ok || key == "" {
+			return nil, fail("expected key: value")
+		}
+		key = strings.TrimSpace(key)
+		value, err := yamlScalar(rest)
+		if err != nil {
+			return nil, fail("%v", err)
+		}
+
+		switch {
+		case indent == 0:
+			section, preset = key, ""
+			presetIndent, flagIndent = -1, -1
+
+			if key == "version" {
+				version, err := strconv.Atoi(value)
+				if err != nil || version < 1 {
+					return nil, fail("invalid config version %q", value)
+				}
+				if err := checkConfigVersion(version); err != nil {
+					return nil, fail("%v", err)
+				}
+			}
+
+		case section != name:
+			continue
+
+		case presetIndent == -1 || indent == presetIndent:
+			if value != "" {
+				return nil, fail("%s %q must be map of flags", strings.TrimSuffix(name, "s"), key)
+			}
+			presetIndent, flagIndent = indent, -1
+			preset = key
+			presets[preset] = []presetFlag{}
+
+		case indent < presetIndent:
+			return nil, fail("unexpected indentation")
+
+		default:
+			if flagIndent == -1 {
+				flagIndent = indent
+			}
+			if indent != flagIndent {
+				return nil, fail("unexpected indentation")
+			}
+
+			if value == "" && strings.TrimSpace(rest) == "" {
+				list = key
+				continue
+			}
+			presets[preset] = append(presets[preset], presetFlag{key, value})
+		}
+	}
+
+	return presets, scanner.Err()
+}
+
+// Dropping comment, # starts comment at line start or after space
+// outside of quotes
+func stripYAMLComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#' && (i == 0 || line[i-1] == ' '):
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// Value of scalar, quoted or plain
+func yamlScalar(value string) (string, error) {
+	value = strings.TrimSpace(value)
+
+	switch {
+	case strings.HasPrefix(value, `"`):
+		return strconv.Unquote(value)
+	case strings.HasPrefix(value, "'"):
+		if len(value) < 2 || !strings.HasSuffix(value, "'") {
+			return "", fmt.Errorf("unterminated string %s", value)
+		}
+		return strings.ReplaceAll(value[1:len(value)-1], "''", "'"), nil
+	}
+	return value, nil
+}
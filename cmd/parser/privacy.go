@@ -0,0 +1,179 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"net/netip"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Prefixes IPs are generalized to in shared reports
+const (
+	privacyPrefix4 = 24
+	privacyPrefix6 = 48
+)
+
+// Protection of reports shared outside ops team (-privacy-k,
+// -privacy-epsilon): client IPs are generalized to their /24 (/48 for
+// IPv6) network, groups and clients with fewer than k requests are
+// suppressed (k-anonymity threshold) and counts get Laplace noise of
+// scale 1/epsilon, so one request changes published counts only by
+// amount hidden in noise.
+//
+// Epsilon is spent once per published count a request is in: count,
+// errors, its status code and its class of group, or requests, errors
+// and peak rate of client and total requests. So a report spends up to
+// 4 epsilon per request. Noise doesn't hide min and max latency, which
+// are single requests, so epsilon needs k too.
+type Privacy struct {
+	k       int
+	epsilon float64
+}
+
+// Privacy of flags, nil when both are zero
+func NewPrivacy(k int, epsilon float64) (*Privacy, error) {
+	if k < 0 {
+		return nil, fmt.Errorf("-privacy-k: threshold can't be negative")
+	}
+	if epsilon < 0 {
+		return nil, fmt.Errorf("-privacy-epsilon: epsilon can't be negative")
+	}
+	if k == 0 && epsilon == 0 {
+		return nil, nil
+	}
+	if k == 0 {
+		return nil, fmt.Errorf("-privacy-epsilon: needs -privacy-k, min and max latencies of small groups aren't hidden by noise")
+	}
+	return &Privacy{k: k, epsilon: epsilon}, nil
+}
+
+// Network of IP, values which aren't IPs are kept
+func (p *Privacy) IP(ip string) string {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return ip
+	}
+	addr = addr.Unmap()
+
+	bits := privacyPrefix4
+	if addr.Is6() {
+		bits = privacyPrefix6
+	}
+	prefix, err := addr.Prefix(bits)
+	if err != nil {
+		return ip
+	}
+	return prefix.String()
+}
+
+// Record of report with generalized IP
+func (p *Privacy) Record(record LogRecord) LogRecord {
+	record.IP = p.IP(record.IP)
+	return record
+}
+
+// Is count below k-anonymity threshold
+func (p *Privacy) suppressed(count int) bool {
+	return count < p.k
+}
+
+// Count with Laplace noise, rounded and never negative. Zero counts get
+// noise too, or zero would be published exactly.
+func (p *Privacy) noisy(n int) int {
+	if p.epsilon == 0 {
+		return n
+	}
+	u := rand.Float64() - 0.5
+	noise := -math.Copysign(1/p.epsilon, u) * math.Log(1-2*math.Abs(u))
+	return max(int(math.Round(float64(n)+noise)), 0)
+}
+
+// Groups above threshold with noisy counts, sorted again by noisy
+// count (days stay chronological)
+func (p *Privacy) Groups(groups []GroupMetrics, by string) []GroupMetrics {
+	n := len(groups)
+	groups = slices.DeleteFunc(groups, func(g GroupMetrics) bool { return p.suppressed(g.Count) })
+	p.report(n-len(groups), "groups")
+
+	for i := range groups {
+		m := &groups[i].Metrics
+		// Totals are scaled with count, so averages stay as they are
+		count := p.noisy(m.Count)
+		if m.Count > 0 {
+			scale := float64(count) / float64(m.Count)
+			m.RPS *= scale
+			m.TotalTime = time.Duration(float64(m.TotalTime) * scale)
+		}
+		m.Count = count
+		m.Errors = min(p.noisy(m.Errors), count)
+		m.ErrorRate = ratio(float64(m.Errors), float64(count))
+
+		statusCounts := make(map[int]int, len(m.StatusCounts))
+		for code, n := range m.StatusCounts {
+			statusCounts[code] = p.noisy(n)
+		}
+		m.StatusCounts = statusCounts
+		classCounts := make(map[string]int, len(m.ClassCounts))
+		for class, n := range m.ClassCounts {
+			classCounts[class] = p.noisy(n)
+		}
+		m.ClassCounts = classCounts
+	}
+
+	slices.SortStableFunc(groups, func(x, y GroupMetrics) int {
+		if by != "day" && x.Count != y.Count {
+			return y.Count - x.Count
+		}
+		return strings.Compare(x.Key, y.Key)
+	})
+	return groups
+}
+
+// Client report without clients below threshold, with noisy counts.
+// Clients of several lists get same noise, so lists agree.
+func (p *Privacy) Clients(report ClientsReport) ClientsReport {
+	noisy := make(map[string]*ClientStats)
+	suppressed := 0
+	clients := func(list []ClientStats) []ClientStats {
+		kept := []ClientStats{}
+		for _, c := range list {
+			if n, ok := noisy[c.IP]; ok {
+				if n != nil {
+					kept = append(kept, *n)
+				}
+				continue
+			}
+			if p.suppressed(c.Requests) {
+				noisy[c.IP] = nil
+				suppressed++
+				continue
+			}
+			c.Requests = p.noisy(c.Requests)
+			c.Errors = min(p.noisy(c.Errors), c.Requests)
+			c.ErrorRate = ratio(float64(c.Errors), float64(c.Requests))
+			c.PeakRate = p.noisy(c.PeakRate)
+			noisy[c.IP] = &c
+			kept = append(kept, c)
+		}
+		return kept
+	}
+
+	report.ByRequests = clients(report.ByRequests)
+	report.ByErrors = clients(report.ByErrors)
+	report.OverRate = clients(report.OverRate)
+	report.Unique = p.noisy(report.Unique)
+	report.Requests = p.noisy(report.Requests)
+	p.report(suppressed, "networks")
+	return report
+}
+
+// Note of suppressed groups, on stderr so JSON output stays as it is
+func (p *Privacy) report(suppressed int, what string) {
+	if suppressed > 0 {
+		fmt.Fprintf(os.Stderr, "Privacy: %d %s with fewer than %d requests suppressed\n", suppressed, what, p.k)
+	}
+}
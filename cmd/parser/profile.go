@@ -0,0 +1,134 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"text/tabwriter"
+	"time"
+)
+
+// Counters of one filter check
+type filterStats struct {
+	filterCheck
+	evaluated, dropped, nanos atomic.Int64
+}
+
+// Profile of filters (-profile): records each filter was evaluated
+// on, dropped and time spent in it. Filters are checked in fixed order
+// and first failing one drops record, so filters after one dropping
+// most records see few of them. Expression operands show which
+// predicates of -filter and -where are worth moving first, and filters
+// which never drop anything or drop everything are pointed out.
+type FilterProfile struct {
+	checks []*filterStats
+	kept   atomic.Int64
+}
+
+func NewFilterProfile(filter Filter) *FilterProfile {
+	p := &FilterProfile{}
+	for _, check := range filterChecks(filter) {
+		p.checks = append(p.checks, &filterStats{filterCheck: check})
+	}
+	return p
+}
+
+// Flag of first filter rejecting record like rejectingFilter, with
+// evaluation of each filter counted and timed
+func (p *FilterProfile) Reject(record LogRecord) string {
+	for _, s := range p.checks {
+		start := time.Now()
+		matched := s.match(record)
+		s.nanos.Add(int64(time.Since(start)))
+		s.evaluated.Add(1)
+		if !matched {
+			s.dropped.Add(1)
+			return s.flag
+		}
+	}
+	p.kept.Add(1)
+	return ""
+}
+
+// Filter statistics in order they are checked
+func (p *FilterProfile) Report(w io.Writer, locale Locale) {
+	fmt.Fprintf(w, "Profile, filters in order they are checked (first failing filter drops record):\n")
+	if len(p.checks) == 0 {
+		fmt.Fprintf(w, "  no filters set\n")
+		return
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "  FILTER\tEVALUATED\tDROPPED\tDROP RATE\tTIME\tPER RECORD\n")
+	var never, all []string
+	for _, s := range p.checks {
+		evaluated, dropped, spent := s.evaluated.Load(), s.dropped.Load(), time.Duration(s.nanos.Load())
+		perRecord := time.Duration(0)
+		if evaluated > 0 {
+			perRecord = spent / time.Duration(evaluated)
+		}
+		name := fmt.Sprintf("%s %q", s.flag, s.value)
+		fmt.Fprintf(tw, "  %s\t%s\t%s\t%s\t%s\t%s\n",
+			name,
+			locale.Int(int(evaluated)),
+			locale.Int(int(dropped)),
+			locale.Percent(ratio(float64(dropped), float64(evaluated))),
+			locale.Duration(spent),
+			locale.Duration(perRecord),
+		)
+
+		switch {
+		case evaluated > 0 && dropped == 0:
+			never = append(never, name)
+		case evaluated > 0 && dropped == evaluated:
+			all = append(all, name)
+		}
+	}
+	fmt.Fprintf(tw, "  kept\t%s\t\t\t\t\n", locale.Int(int(p.kept.Load())))
+	tw.Flush()
+
+	for _, name := range never {
+		fmt.Fprintf(w, "Never dropped a record: %s\n", name)
+	}
+	for _, name := range all {
+		fmt.Fprintf(w, "Matched nothing, dropped every record it saw: %s\n", name)
+	}
+	for _, flag := range []string{"-filter", "-where"} {
+		if order := p.fasterOrder(flag); order != "" {
+			fmt.Fprintf(w, "Faster order of %s operands (most drops per time first): %s\n", flag, order)
+		}
+	}
+}
+
+// Operands of expression flag by dropped records per time spent,
+// empty when they are already in that order. Drop rates of later
+// operands are of records earlier ones let through, so it's a hint.
+func (p *FilterProfile) fasterOrder(flag string) string {
+	var operands []*filterStats
+	for _, s := range p.checks {
+		if s.flag == flag {
+			operands = append(operands, s)
+		}
+	}
+	if len(operands) < 2 {
+		return ""
+	}
+
+	score := func(s *filterStats) float64 {
+		return ratio(float64(s.dropped.Load()), float64(s.nanos.Load()))
+	}
+	sorted := slices.Clone(operands)
+	slices.SortStableFunc(sorted, func(a, b *filterStats) int { return cmp.Compare(score(b), score(a)) })
+	if slices.Equal(sorted, operands) {
+		return ""
+	}
+
+	values := make([]string, len(sorted))
+	for i, s := range sorted {
+		values[i] = s.value
+	}
+	return strings.Join(values, " && ")
+}
@@ -0,0 +1,308 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"maps"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Default histogram buckets in seconds, same as Prometheus client
+var defaultPromBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Schema of native histograms, buckets grow by factor 2^(2^-3) (about
+// 9%), same as Prometheus client with bucket factor 1.1
+const promNativeSchema = 3
+
+// Durations up to this many seconds are counted in zero bucket of
+// native histograms, default of Prometheus client
+var promZeroThreshold = math.Ldexp(1, -128)
+
+// Prometheus counters and histograms of records
+type PromCollector struct {
+	mu       sync.Mutex
+	buckets  []float64
+	native   bool
+	requests map[promRequestKey]int
+	latency  map[promLatencyKey]*promHistogram
+}
+
+type promRequestKey struct {
+	Method string
+	Code   int
+	Route  string
+}
+
+type promLatencyKey struct {
+	Method string
+	Route  string
+}
+
+type promHistogram struct {
+	counts []int
+	count  int
+	sum    float64
+
+	// Native histogram, counts by bucket index of promNativeSchema
+	zero   int
+	sparse map[int]int
+}
+
+// Creating collector with histogram buckets in seconds, native
+// histograms are collected next to them when native is set
+func NewPromCollector(buckets []float64, native bool) *PromCollector {
+	if len(buckets) == 0 {
+		buckets = defaultPromBuckets
+	}
+
+	return &PromCollector{
+		buckets:  buckets,
+		native:   native,
+		requests: make(map[promRequestKey]int),
+		latency:  make(map[promLatencyKey]*promHistogram),
+	}
+}
+
+// Adding record to collector
+func (c *PromCollector) Add(record LogRecord) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	route := groupKey(record, "url")
+	c.requests[promRequestKey{record.Method, record.Code, route}]++
+
+	key := promLatencyKey{record.Method, route}
+	h := c.latency[key]
+	if h == nil {
+		h = &promHistogram{counts: make([]int, len(c.buckets))}
+		c.latency[key] = h
+	}
+
+	seconds := record.Duration.Seconds()
+	for i, le := range c.buckets {
+		if seconds <= le {
+			h.counts[i]++
+		}
+	}
+	h.count++
+	h.sum += seconds
+
+	if c.native {
+		if seconds <= promZeroThreshold {
+			h.zero++
+		} else {
+			if h.sparse == nil {
+				h.sparse = make(map[int]int)
+			}
+			h.sparse[promNativeBucket(seconds)]++
+		}
+	}
+}
+
+// Index of native bucket of value, bucket i holds values in
+// (base^(i-1), base^i] with base 2^(2^-schema)
+func promNativeBucket(v float64) int {
+	return int(math.Ceil(math.Log2(v) * (1 << promNativeSchema)))
+}
+
+// Writing metrics in Prometheus text exposition format
+func (c *PromCollector) Write(w io.Writer) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	bw := bufio.NewWriter(w)
+
+	build := currentBuild()
+	fmt.Fprintln(bw, "# HELP ginlog_build_info Build of ginlog exporting metrics.")
+	fmt.Fprintln(bw, "# TYPE ginlog_build_info gauge")
+	fmt.Fprintf(bw, "ginlog_build_info{version=%s,commit=%s,goversion=%s} 1\n", promLabel(build.Version), promLabel(build.Commit), promLabel(build.Go))
+
+	fmt.Fprintln(bw, "# HELP gin_requests_total Total number of HTTP requests.")
+	fmt.Fprintln(bw, "# TYPE gin_requests_total counter")
+
+	for _, key := range c.requestKeys() {
+		fmt.Fprintf(bw, "gin_requests_total{method=%s,code=\"%d\",route=%s} %d\n",
+			promLabel(key.Method), key.Code, promLabel(key.Route), c.requests[key])
+	}
+
+	fmt.Fprintln(bw, "# HELP gin_request_duration_seconds HTTP request latency.")
+	fmt.Fprintln(bw, "# TYPE gin_request_duration_seconds histogram")
+
+	for _, key := range c.latencyKeys() {
+		h := c.latency[key]
+		labels := fmt.Sprintf("method=%s,route=%s", promLabel(key.Method), promLabel(key.Route))
+
+		for i, le := range c.buckets {
+			fmt.Fprintf(bw, "gin_request_duration_seconds_bucket{%s,le=\"%s\"} %d\n",
+				labels, promFloat(le), h.counts[i])
+		}
+		fmt.Fprintf(bw, "gin_request_duration_seconds_bucket{%s,le=\"+Inf\"} %d\n", labels, h.count)
+		fmt.Fprintf(bw, "gin_request_duration_seconds_sum{%s} %s\n", labels, promFloat(h.sum))
+		fmt.Fprintf(bw, "gin_request_duration_seconds_count{%s} %d\n", labels, h.count)
+	}
+
+	return bw.Flush()
+}
+
+// Counter keys in output order
+func (c *PromCollector) requestKeys() []promRequestKey {
+	return slices.SortedFunc(maps.Keys(c.requests), func(a, b promRequestKey) int {
+		return strings.Compare(
+			a.Route+" "+a.Method+" "+strconv.Itoa(a.Code),
+			b.Route+" "+b.Method+" "+strconv.Itoa(b.Code),
+		)
+	})
+}
+
+// Histogram keys in output order
+func (c *PromCollector) latencyKeys() []promLatencyKey {
+	return slices.SortedFunc(maps.Keys(c.latency), func(a, b promLatencyKey) int {
+		return strings.Compare(a.Route+" "+a.Method, b.Route+" "+b.Method)
+	})
+}
+
+// Writing metrics in delimited protobuf exposition format, histograms
+// have native buckets next to classic ones when collected, so
+// Prometheus with native histograms enabled stores one series per
+// method and route instead of one per bucket
+func (c *PromCollector) WriteProtobuf(w io.Writer) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	bw := bufio.NewWriter(w)
+
+	// io.prometheus.client.MetricFamily of type GAUGE
+	build := currentBuild()
+	var info, gauge protoMessage
+	info.string(1, "ginlog_build_info")
+	info.string(2, "Build of ginlog exporting metrics.")
+	info.uint(3, 1)
+	gauge.double(1, 1)
+	metric := promProtoLabels("version", build.Version, "commit", build.Commit, "goversion", build.Go)
+	metric.bytes(2, gauge)
+	info.bytes(4, metric)
+	if err := writeDelimited(bw, info); err != nil {
+		return err
+	}
+
+	// MetricFamily of type COUNTER
+	var requests protoMessage
+	requests.string(1, "gin_requests_total")
+	requests.string(2, "Total number of HTTP requests.")
+	requests.uint(3, 0)
+	for _, key := range c.requestKeys() {
+		var counter protoMessage
+		counter.double(1, float64(c.requests[key]))
+
+		metric := promProtoLabels("method", key.Method, "code", strconv.Itoa(key.Code), "route", key.Route)
+		metric.bytes(3, counter)
+		requests.bytes(4, metric)
+	}
+	if err := writeDelimited(bw, requests); err != nil {
+		return err
+	}
+
+	// MetricFamily of type HISTOGRAM
+	var latency protoMessage
+	latency.string(1, "gin_request_duration_seconds")
+	latency.string(2, "HTTP request latency.")
+	latency.uint(3, 4)
+	for _, key := range c.latencyKeys() {
+		h := c.latency[key]
+
+		var histogram protoMessage
+		histogram.uint(1, uint64(h.count))
+		histogram.double(2, h.sum)
+		for i, le := range c.buckets {
+			var bucket protoMessage
+			bucket.uint(1, uint64(h.counts[i]))
+			bucket.double(2, le)
+			histogram.bytes(3, bucket)
+		}
+		// Last bucket is +Inf like le="+Inf" of text format
+		var inf protoMessage
+		inf.uint(1, uint64(h.count))
+		inf.double(2, math.Inf(1))
+		histogram.bytes(3, inf)
+		if c.native {
+			h.writeNative(&histogram)
+		}
+
+		metric := promProtoLabels("method", key.Method, "route", key.Route)
+		metric.bytes(7, histogram)
+		latency.bytes(4, metric)
+	}
+	if err := writeDelimited(bw, latency); err != nil {
+		return err
+	}
+
+	return bw.Flush()
+}
+
+// Adding native buckets to Histogram message: schema, zero bucket,
+// then spans of consecutive bucket indexes and counts as deltas from
+// previous bucket
+func (h *promHistogram) writeNative(m *protoMessage) {
+	m.sint(5, promNativeSchema)
+	m.double(6, promZeroThreshold)
+	m.uint(7, uint64(h.zero))
+
+	indexes := slices.Sorted(maps.Keys(h.sparse))
+	if len(indexes) == 0 {
+		return
+	}
+
+	deltas := make([]int64, len(indexes))
+	spanOffset, spanLength := indexes[0], 0
+	previous, count := indexes[0]-1, 0
+	for i, index := range indexes {
+		if index != previous+1 {
+			m.bytes(12, promProtoSpan(spanOffset, spanLength))
+			spanOffset, spanLength = index-previous-1, 0
+		}
+		spanLength++
+		deltas[i] = int64(h.sparse[index] - count)
+		previous, count = index, h.sparse[index]
+	}
+	m.bytes(12, promProtoSpan(spanOffset, spanLength))
+	m.packedSint(13, deltas)
+}
+
+// BucketSpan message, offset is gap from previous span (or index of
+// first bucket)
+func promProtoSpan(offset, length int) protoMessage {
+	var span protoMessage
+	span.sint(1, int64(offset))
+	span.uint(2, uint64(length))
+	return span
+}
+
+// Metric message with its LabelPair messages of name and value pairs
+func promProtoLabels(pairs ...string) protoMessage {
+	var metric protoMessage
+	for i := 0; i < len(pairs); i += 2 {
+		var label protoMessage
+		label.string(1, pairs[i])
+		label.string(2, pairs[i+1])
+		metric.bytes(1, label)
+	}
+	return metric
+}
+
+// Quoted and escaped label value
+func promLabel(value string) string {
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	value = strings.ReplaceAll(value, "\n", `\n`)
+	value = strings.ReplaceAll(value, `"`, `\"`)
+	return `"` + value + `"`
+}
+
+// Float formatting for exposition format
+func promFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Field of protobuf message, varint and fixed64 values are kept in
+// value, length-delimited ones in data
+type protoField struct {
+	value uint64
+	data  []byte
+}
+
+// Decoding protobuf message into fields by number
+func decodeProto(t *testing.T, m []byte) map[int][]protoField {
+	t.Helper()
+	fields := map[int][]protoField{}
+	for len(m) > 0 {
+		tag, n := binary.Uvarint(m)
+		if n <= 0 {
+			t.Fatal("bad protobuf tag")
+		}
+		m = m[n:]
+
+		var f protoField
+		switch tag & 7 {
+		case protoVarint:
+			f.value, n = binary.Uvarint(m)
+			if n <= 0 {
+				t.Fatal("bad protobuf varint")
+			}
+			m = m[n:]
+		case protoFixed64:
+			f.value = binary.LittleEndian.Uint64(m)
+			m = m[8:]
+		case protoBytes:
+			size, n := binary.Uvarint(m)
+			if n <= 0 || uint64(len(m)-n) < size {
+				t.Fatal("bad protobuf length")
+			}
+			f.data = m[n : n+int(size)]
+			m = m[n+int(size):]
+		default:
+			t.Fatalf("unexpected wire type %d", tag&7)
+		}
+		fields[int(tag>>3)] = append(fields[int(tag>>3)], f)
+	}
+	return fields
+}
+
+func zigzag(v uint64) int64 {
+	return int64(v>>1) ^ -int64(v&1)
+}
+
+// Length-delimited MetricFamily messages by name
+func decodeFamilies(t *testing.T, data []byte) map[string]map[int][]protoField {
+	t.Helper()
+	families := map[string]map[int][]protoField{}
+	for len(data) > 0 {
+		size, n := binary.Uvarint(data)
+		if n <= 0 || uint64(len(data)-n) < size {
+			t.Fatal("bad delimited message")
+		}
+		family := decodeProto(t, data[n:n+int(size)])
+		families[string(family[1][0].data)] = family
+		data = data[n+int(size):]
+	}
+	return families
+}
+
+// Labels of Metric message
+func protoLabels(t *testing.T, metric map[int][]protoField) map[string]string {
+	t.Helper()
+	labels := map[string]string{}
+	for _, f := range metric[1] {
+		label := decodeProto(t, f.data)
+		labels[string(label[1][0].data)] = string(label[2][0].data)
+	}
+	return labels
+}
+
+func TestPromProtobuf(t *testing.T) {
+	c := NewPromCollector([]float64{0.5, 1}, true)
+	for _, d := range []time.Duration{0, time.Second, 1050 * time.Millisecond, 2 * time.Second, 2 * time.Second} {
+		c.Add(LogRecord{Code: 200, Duration: d, Method: "GET", URL: "/ping"})
+	}
+	c.Add(LogRecord{Code: 500, Duration: time.Second, Method: "GET", URL: "/ping"})
+
+	var out bytes.Buffer
+	if err := c.WriteProtobuf(&out); err != nil {
+		t.Fatal(err)
+	}
+	families := decodeFamilies(t, out.Bytes())
+
+	if info := families["ginlog_build_info"]; info == nil || info[3][0].value != 1 {
+		t.Error("missing build info gauge")
+	}
+
+	requests := families["gin_requests_total"]
+	if requests == nil || requests[3][0].value != 0 || len(requests[4]) != 2 {
+		t.Fatalf("requests family %v, want counter with 2 metrics", requests)
+	}
+	metric := decodeProto(t, requests[4][0].data)
+	if labels := protoLabels(t, metric); !reflect.DeepEqual(labels, map[string]string{"method": "GET", "code": "200", "route": "/ping"}) {
+		t.Errorf("counter labels %v", labels)
+	}
+	if count := math.Float64frombits(decodeProto(t, metric[3][0].data)[1][0].value); count != 5 {
+		t.Errorf("counter %v, want 5", count)
+	}
+
+	latency := families["gin_request_duration_seconds"]
+	if latency == nil || latency[3][0].value != 4 || len(latency[4]) != 1 {
+		t.Fatalf("latency family %v, want histogram with 1 metric", latency)
+	}
+	h := decodeProto(t, decodeProto(t, latency[4][0].data)[7][0].data)
+	if h[1][0].value != 6 || math.Float64frombits(h[2][0].value) != 7.05 {
+		t.Errorf("count %d, sum %v", h[1][0].value, math.Float64frombits(h[2][0].value))
+	}
+
+	var classic []uint64
+	var bounds []float64
+	for _, f := range h[3] {
+		bucket := decodeProto(t, f.data)
+		classic = append(classic, bucket[1][0].value)
+		bounds = append(bounds, math.Float64frombits(bucket[2][0].value))
+	}
+	if want := []uint64{1, 3, 6}; !reflect.DeepEqual(classic, want) {
+		t.Errorf("cumulative buckets %v, want %v", classic, want)
+	}
+	if want := []float64{0.5, 1, math.Inf(1)}; !reflect.DeepEqual(bounds, want) {
+		t.Errorf("bucket bounds %v, want %v", bounds, want)
+	}
+
+	// 1s is bucket 0, 1.05s bucket 1, 2s bucket 8: spans of
+	// buckets 0-1 and, after gap of 6, bucket 8
+	if schema := zigzag(h[5][0].value); schema != promNativeSchema {
+		t.Errorf("schema %d, want %d", schema, promNativeSchema)
+	}
+	if zero := h[7][0].value; zero != 1 {
+		t.Errorf("zero bucket %d, want 1", zero)
+	}
+	var spans [][2]int64
+	for _, f := range h[12] {
+		span := decodeProto(t, f.data)
+		spans = append(spans, [2]int64{zigzag(span[1][0].value), int64(span[2][0].value)})
+	}
+	if want := [][2]int64{{0, 2}, {6, 1}}; !reflect.DeepEqual(spans, want) {
+		t.Errorf("spans %v, want %v", spans, want)
+	}
+
+	var deltas []int64
+	for packed := h[13][0].data; len(packed) > 0; {
+		v, n := binary.Uvarint(packed)
+		deltas = append(deltas, zigzag(v))
+		packed = packed[n:]
+	}
+	if want := []int64{2, -1, 1}; !reflect.DeepEqual(deltas, want) {
+		t.Errorf("deltas %v, want %v", deltas, want)
+	}
+}
+
+func TestPromText(t *testing.T) {
+	c := NewPromCollector([]float64{0.5, 1}, false)
+	for _, d := range []time.Duration{100 * time.Millisecond, time.Second, 2 * time.Second} {
+		c.Add(LogRecord{Code: 200, Duration: d, Method: "GET", URL: "/ping"})
+	}
+
+	var out bytes.Buffer
+	if err := c.Write(&out); err != nil {
+		t.Fatal(err)
+	}
+
+	var buckets []string
+	for _, line := range strings.Split(out.String(), "\n") {
+		if strings.HasPrefix(line, "gin_request_duration_seconds_bucket") {
+			buckets = append(buckets, line)
+		}
+	}
+	want := []string{
+		`gin_request_duration_seconds_bucket{method="GET",route="/ping",le="0.5"} 1`,
+		`gin_request_duration_seconds_bucket{method="GET",route="/ping",le="1"} 2`,
+		`gin_request_duration_seconds_bucket{method="GET",route="/ping",le="+Inf"} 3`,
+	}
+	if !reflect.DeepEqual(buckets, want) {
+		t.Errorf("buckets\n%s\nwant\n%s", strings.Join(buckets, "\n"), strings.Join(want, "\n"))
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"encoding/binary"
+	"io"
+	"math"
+)
+
+// Content type of delimited protobuf exposition, needed for native
+// histograms, which text format can't carry
+const promProtoContentType = "application/vnd.google.protobuf; proto=io.prometheus.client.MetricFamily; encoding=delimited"
+
+// Protobuf wire types
+const (
+	protoVarint  = 0
+	protoFixed64 = 1
+	protoBytes   = 2
+)
+
+// Protobuf message encoded field by field, nested messages are
+// encoded first and added as bytes
+type protoMessage []byte
+
+func (m *protoMessage) tag(field int, typ int) {
+	*m = binary.AppendUvarint(*m, uint64(field<<3|typ))
+}
+
+func (m *protoMessage) uint(field int, v uint64) {
+	m.tag(field, protoVarint)
+	*m = binary.AppendUvarint(*m, v)
+}
+
+// Zigzag encoded sint32 and sint64
+func (m *protoMessage) sint(field int, v int64) {
+	m.uint(field, uint64(v<<1^v>>63))
+}
+
+func (m *protoMessage) double(field int, v float64) {
+	m.tag(field, protoFixed64)
+	*m = binary.LittleEndian.AppendUint64(*m, math.Float64bits(v))
+}
+
+func (m *protoMessage) bytes(field int, b []byte) {
+	m.tag(field, protoBytes)
+	*m = binary.AppendUvarint(*m, uint64(len(b)))
+	*m = append(*m, b...)
+}
+
+func (m *protoMessage) string(field int, s string) {
+	m.bytes(field, []byte(s))
+}
+
+// Packed repeated sint64
+func (m *protoMessage) packedSint(field int, values []int64) {
+	var packed []byte
+	for _, v := range values {
+		packed = binary.AppendUvarint(packed, uint64(v<<1^v>>63))
+	}
+	m.bytes(field, packed)
+}
+
+// Writing message prefixed with its length
+func writeDelimited(w io.Writer, m protoMessage) error {
+	if _, err := w.Write(binary.AppendUvarint(nil, uint64(len(m)))); err != nil {
+		return err
+	}
+	_, err := w.Write(m)
+	return err
+}
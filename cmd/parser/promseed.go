@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Sample of text exposition format
+type promSample struct {
+	name   string
+	labels map[string]string
+	value  float64
+}
+
+// Parsing sample line: name, optional labels in braces, value and
+// optional timestamp
+func parsePromSample(line string) (promSample, error) {
+	sample := promSample{labels: make(map[string]string)}
+
+	end := strings.IndexAny(line, "{ \t")
+	if end <= 0 {
+		return sample, fmt.Errorf("invalid sample %q", line)
+	}
+	sample.name, line = line[:end], line[end:]
+
+	if strings.HasPrefix(line, "{") {
+		line = line[1:]
+		for {
+			line = strings.TrimLeft(line, " \t,")
+			if rest, ok := strings.CutPrefix(line, "}"); ok {
+				line = rest
+				break
+			}
+			name, rest, ok := strings.Cut(line, "=")
+			if !ok || !strings.HasPrefix(rest, `"`) {
+				return sample, fmt.Errorf("invalid labels of %s", sample.name)
+			}
+
+			var value strings.Builder
+			i := 1
+			for ; i < len(rest) && rest[i] != '"'; i++ {
+				if rest[i] == '\\' && i+1 < len(rest) {
+					i++
+					if rest[i] == 'n' {
+						value.WriteByte('\n')
+						continue
+					}
+				}
+				value.WriteByte(rest[i])
+			}
+			if i >= len(rest) {
+				return sample, fmt.Errorf("unterminated label value of %s", sample.name)
+			}
+			sample.labels[strings.TrimSpace(name)] = value.String()
+			line = rest[i+1:]
+		}
+	}
+
+	fields := strings.Fields(line)
+	if len(fields) == 0 || len(fields) > 2 {
+		return sample, fmt.Errorf("invalid value of %s", sample.name)
+	}
+	value, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return sample, fmt.Errorf("invalid value of %s: %q", sample.name, fields[0])
+	}
+	sample.value = value
+	return sample, nil
+}
+
+// Seeding counters and histograms from metrics of earlier exporter in
+// text exposition format (-init-counters), so counters served after
+// cutover continue from its values instead of resetting. Series of
+// other metrics are skipped, histograms need same buckets as
+// collector. Returns number of seeded series.
+func (c *PromCollector) Seed(r io.Reader) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	seeded := make(map[promLatencyKey][]bool)
+	histogram := func(key promLatencyKey) *promHistogram {
+		h := c.latency[key]
+		if h == nil {
+			h = &promHistogram{counts: make([]int, len(c.buckets))}
+			c.latency[key] = h
+			seeded[key] = make([]bool, len(c.buckets))
+		}
+		return h
+	}
+
+	series := 0
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for number := 1; scanner.Scan(); number++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		sample, err := parsePromSample(line)
+		if err != nil {
+			return 0, fmt.Errorf("line %d: %w", number, err)
+		}
+		if sample.value < 0 || sample.value != sample.value {
+			return 0, fmt.Errorf("line %d: invalid value of %s", number, sample.name)
+		}
+
+		key := promLatencyKey{sample.labels["method"], sample.labels["route"]}
+		switch sample.name {
+		case "gin_requests_total":
+			code, err := strconv.Atoi(sample.labels["code"])
+			if err != nil {
+				return 0, fmt.Errorf("line %d: invalid code label %q", number, sample.labels["code"])
+			}
+			c.requests[promRequestKey{key.Method, code, key.Route}] = int(sample.value)
+			series++
+
+		case "gin_request_duration_seconds_bucket":
+			le := sample.labels["le"]
+			if le == "+Inf" {
+				continue
+			}
+			bound, err := strconv.ParseFloat(le, 64)
+			if err != nil {
+				return 0, fmt.Errorf("line %d: invalid le label %q", number, le)
+			}
+			i := slices.Index(c.buckets, bound)
+			if i < 0 {
+				return 0, fmt.Errorf("line %d: bucket le=%q isn't one of -buckets, histograms need same buckets", number, le)
+			}
+			h := histogram(key)
+			h.counts[i] = int(sample.value)
+			seeded[key][i] = true
+
+		case "gin_request_duration_seconds_sum":
+			histogram(key).sum = sample.value
+
+		case "gin_request_duration_seconds_count":
+			histogram(key).count = int(sample.value)
+			series++
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+
+	for key, buckets := range seeded {
+		if i := slices.Index(buckets, false); i >= 0 {
+			return 0, fmt.Errorf("histogram of %s %s misses bucket le=%q, histograms need same buckets", key.Method, key.Route, promFloat(c.buckets[i]))
+		}
+	}
+	return series, nil
+}
+
+// Seeding collector from snapshot file
+func seedPromCollector(c *PromCollector, name string) error {
+	file, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	series, err := c.Seed(file)
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	if series == 0 {
+		return fmt.Errorf("%s: no gin_requests_total or gin_request_duration_seconds series", name)
+	}
+	return nil
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Struct of log record
+type LogRecord struct {
+	Date     time.Time     `json:"date"`
+	Code     int           `json:"code"`
+	Duration time.Duration `json:"duration_ms"`
+	IP       string        `json:"ip"`
+	Method   string        `json:"method"`
+	URL      string        `json:"url"`
+
+	// Normalized route template, e.g. /users/:id
+	Route string `json:"-"`
+
+	// Extra fields of custom formats, e.g. user agent or request id
+	Fields map[string]string `json:"-"`
+}
+
+// Path of URL, without query string
+func (r LogRecord) Path() string {
+	path, _, _ := strings.Cut(r.URL, "?")
+	return path
+}
+
+// Query string of URL without "?", empty when there is none
+func (r LogRecord) Query() string {
+	_, query, _ := strings.Cut(r.URL, "?")
+	return query
+}
+
+// Line parsing. Variations of gin.Logger and gin.LoggerWithWriter
+// output across gin versions are tolerated: any [GIN...] prefix,
+// colored status and method (ForceConsoleColor), padding and leading
+// zeros, quoted (1.6+) or bare paths, "|" in paths and latencies
+// truncated to seconds (1.7+, e.g. 1m5s).
+func parseLine(line string) (LogRecord, error) {
+	if strings.IndexByte(line, '\x1b') >= 0 {
+		line = ansiEscape.ReplaceAllString(line, "")
+	}
+
+	rest, ok := strings.CutPrefix(line, "[GIN")
+	end := strings.IndexByte(rest, ']')
+	if !ok || end < 0 {
+		return LogRecord{}, fmt.Errorf("invalid format")
+	}
+
+	// Path is last, so "|" in it stays part of it
+	parts := strings.SplitN(rest[end+1:], "|", 5)
+	if len(parts) != 5 {
+		return LogRecord{}, fmt.Errorf("invalid format")
+	}
+
+	datePart := strings.TrimSpace(parts[0])
+	codePart := strings.TrimSpace(parts[1])
+	durationPart := strings.TrimSpace(parts[2])
+	ipPart := strings.TrimSpace(parts[3])
+	methodUrlPart := strings.TrimSpace(parts[4])
+
+	parsedDate, err := parseGinDate(datePart)
+	if err != nil {
+		return LogRecord{}, err
+	}
+	parsedDate = localTime(parsedDate)
+
+	parsedCode, err := strconv.Atoi(codePart)
+	if err != nil {
+		return LogRecord{}, err
+	}
+
+	parsedDuration, err := parseDuration(durationPart)
+	if err != nil {
+		return LogRecord{}, err
+	}
+
+	methodUrlParts := strings.Fields(methodUrlPart)
+	if len(methodUrlParts) < 2 {
+		return LogRecord{}, fmt.Errorf("invalid method/URL format")
+	}
+
+	// Gin writes path as Go quoted string, end of path of truncated
+	// line is missing
+	url := strings.Join(methodUrlParts[1:], " ")
+	if unquoted, err := strconv.Unquote(url); err == nil {
+		url = unquoted
+	} else if len(url) > 1 && url[0] == '"' && !strings.HasSuffix(url, `"`) {
+		url = url[1:]
+	}
+
+	return LogRecord{
+		Date:     parsedDate,
+		Code:     parsedCode,
+		Duration: parsedDuration,
+		IP:       ipPart,
+		Method:   methodUrlParts[0],
+		URL:      url,
+	}, nil
+}
+
+// Date of gin line, "2006/01/02 - 15:04:05" with any spacing, or
+// without the dash
+func parseGinDate(value string) (time.Time, error) {
+	day, clock, ok := strings.Cut(value, " ")
+	if !ok {
+		return time.Time{}, fmt.Errorf("invalid date %q", value)
+	}
+	clock = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(clock), "-"))
+	return time.Parse("2006/01/02 15:04:05", day+" "+clock)
+}
+
+// Duration parsing
+func parseDuration(durStr string) (time.Duration, error) {
+	durStr = strings.TrimSpace(durStr)
+
+	if strings.HasSuffix(durStr, "µs") {
+		val, err := strconv.ParseFloat(strings.TrimSuffix(durStr, "µs"), 64)
+		if err != nil {
+			return 0, err
+		}
+		return time.Duration(val * float64(time.Microsecond)), nil
+	}
+
+	if strings.HasSuffix(durStr, "ms") {
+		val, err := strconv.ParseFloat(strings.TrimSuffix(durStr, "ms"), 64)
+		if err != nil {
+			return 0, err
+		}
+		return time.Duration(val * float64(time.Millisecond)), nil
+	}
+
+	return time.ParseDuration(durStr)
+}
+
+// Raw mode output of one record
+func writeRaw(w io.Writer, record LogRecord) error {
+	_, err := fmt.Fprintf(w, "%s | %3d | %12s | %15s | %-7s %#v\n",
+		record.Date.Format("2006/01/02 - 15:04:05"),
+		record.Code,
+		strings.TrimSpace(formatDuration(record.Duration)),
+		strings.TrimSpace(record.IP),
+		strings.TrimSpace(record.Method),
+		strings.TrimSpace(record.URL),
+	)
+	return err
+}
+
+// Duration formatting
+func formatDuration(d time.Duration) string {
+	if d < time.Microsecond {
+		return fmt.Sprintf("%.3fns", float64(d.Nanoseconds()))
+
+	} else if d < time.Millisecond {
+		return fmt.Sprintf("%.3fµs", float64(d)/float64(time.Microsecond))
+
+	} else if d < time.Second {
+		return fmt.Sprintf("%.3fms", float64(d)/float64(time.Millisecond))
+	}
+
+	return fmt.Sprintf("%.3fs", d.Seconds())
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Lines of gin versions in testdata are exported like golden file,
+// none of them is dropped
+func TestGinVersionsCorpus(t *testing.T) {
+	want, err := os.ReadFile("testdata/gin-versions.ndjson")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, code := runCommandLine(t, "export", "-strict", "-tz", "UTC", "testdata/gin-versions.log")
+	if code != 0 {
+		t.Errorf("exit code %d, want 0", code)
+	}
+
+	gotLines := strings.Split(strings.TrimSuffix(got, "\n"), "\n")
+	wantLines := strings.Split(strings.TrimSuffix(string(want), "\n"), "\n")
+	for i := range max(len(gotLines), len(wantLines)) {
+		var g, w string
+		if i < len(gotLines) {
+			g = gotLines[i]
+		}
+		if i < len(wantLines) {
+			w = wantLines[i]
+		}
+		if g != w {
+			t.Errorf("record %d:\ngot  %s\nwant %s", i+1, g, w)
+		}
+	}
+}
+
+func TestParseLine(t *testing.T) {
+	tests := []struct {
+		line     string
+		code     int
+		duration time.Duration
+		method   string
+		url      string
+	}{
+		{`[GIN] 2024/05/01 - 10:00:01 | 200 |     103.601µs |       127.0.0.1 | GET      "/ping"`, 200, 103601 * time.Nanosecond, "GET", "/ping"},
+		{"[GIN] 2024/05/01 - 10:00:02 |\x1b[97;42m 200 \x1b[0m|      1.2ms |       127.0.0.1 |\x1b[97;44m GET     \x1b[0m \"/api/users/1\"", 200, 1200 * time.Microsecond, "GET", "/api/users/1"},
+		{`[GIN] 2024/05/01 - 10:00:04 | 504 |          1m5s |        10.0.0.5 | GET      "/api/export"`, 504, 65 * time.Second, "GET", "/api/export"},
+		{`[GIN] 2024/05/01 - 10:00:06 | 200 |       912µs |       127.0.0.1 | GET      "/search?q=a|b"`, 200, 912 * time.Microsecond, "GET", "/search?q=a|b"},
+		{`[GIN] 2024/05/01 - 10:00:07 | 200 |   5.4ms |  127.0.0.1 |  GET     /legacy`, 200, 5400 * time.Microsecond, "GET", "/legacy"},
+		{`[GIN-debug] 2024/05/01 10:00:12 | 0302 |       0s |       127.0.0.1 | GET      "/login`, 302, 0, "GET", "/login"},
+	}
+	for _, tt := range tests {
+		record, err := parseLine(tt.line)
+		if err != nil {
+			t.Errorf("parseLine(%q): %v", tt.line, err)
+			continue
+		}
+		if record.Code != tt.code || record.Duration != tt.duration || record.Method != tt.method || record.URL != tt.url {
+			t.Errorf("parseLine(%q) = %d %v %s %s, want %d %v %s %s", tt.line,
+				record.Code, record.Duration, record.Method, record.URL, tt.code, tt.duration, tt.method, tt.url)
+		}
+	}
+}
+
+func TestParseLineErrors(t *testing.T) {
+	for _, line := range []string{
+		"",
+		"garbage line",
+		`[GIN-debug] GET    /ping                     --> main.main.func1 (3 handlers)`,
+		`[GIN] 2024/05/01 - 10:00:01 | OK | 1ms | 127.0.0.1 | GET "/ping"`,
+		`[GIN] 2024/05/01 - 10:00:01 | 200 | fast | 127.0.0.1 | GET "/ping"`,
+		`[GIN] 2024/05/01 - 10:00:01 | 200 | 1ms | 127.0.0.1 | GET`,
+	} {
+		if record, err := parseLine(line); err == nil {
+			t.Errorf("parseLine(%q) = %+v, want error", line, record)
+		}
+	}
+}
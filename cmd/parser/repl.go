@@ -0,0 +1,405 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Records shown by show without count
+const replShowLimit = 20
+
+// Queries kept in history file
+const replHistoryLimit = 1000
+
+// Names of filter command, filter flags with - or _
+var replFilters = []string{"method", "code", "class", "date", "url", "url_prefix", "url_regex", "ip", "param", "min_duration", "max_duration", "from", "to", "route"}
+
+// Help of repl commands
+const replHelp = `Commands, each can end with "where EXPR" applied to it only:
+  where EXPR          filter following queries (where alone clears it)
+  filter NAME=VALUE   narrow following queries like filter flags (code=500, url-prefix=/api, min-duration=1s, route=/users/:id)
+  reset               clear filters and where
+  stats               metrics of matching records (stats group-by BY [N] is group)
+  group BY [N]        metrics per group (url, method, code, ip, day, content-type, expr:..., param:...)
+  top REPORT [N]      top report (slowest, urls, ips, errors)
+  show [N]            first matching records
+  count               number of matching records
+  history             previous queries, !N or !! runs one again
+  help, quit
+`
+
+// Interactive session over records loaded once, or mapped from
+// binary record files, queries scan them instead of reading input again
+type Repl struct {
+	records recordSet
+
+	// Filter of where command, nil matches everything
+	where    Expr
+	whereSrc string
+
+	// Filters of filter command, record must match all of them
+	filters    []func(record LogRecord) bool
+	filterSrcs []string
+
+	newChecker  func() *SanityChecker
+	now         time.Time
+	percentiles []float64
+	locale      Locale
+
+	history     []string
+	historyFile string
+}
+
+func NewRepl(records recordSet, newChecker func() *SanityChecker, now time.Time, percentiles []float64, locale Locale) *Repl {
+	r := &Repl{
+		records:     records,
+		newChecker:  newChecker,
+		now:         now,
+		percentiles: percentiles,
+		locale:      locale,
+		historyFile: replHistoryPath(),
+	}
+
+	if data, err := os.ReadFile(r.historyFile); err == nil {
+		r.history = strings.Split(strings.TrimSpace(string(data)), "\n")
+	}
+	return r
+}
+
+// Path of history file, $GINLOG_HISTORY or ~/.ginlog_history
+func replHistoryPath() string {
+	if path := os.Getenv("GINLOG_HISTORY"); path != "" {
+		return path
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ".ginlog_history"
+	}
+	return filepath.Join(home, ".ginlog_history")
+}
+
+// Reading queries until quit or end of input
+func (r *Repl) Run(input io.Reader) error {
+	fmt.Printf("Loaded %s records, type help for commands\n", r.locale.Int(r.records.Len()))
+
+	scanner := bufio.NewScanner(input)
+	for {
+		if prompt := strings.Join(append(slices.Clone(r.filterSrcs), r.whereSrc), " "); strings.TrimSpace(prompt) != "" {
+			fmt.Printf("ginlog [%s]> ", strings.TrimSpace(prompt))
+		} else {
+			fmt.Print("ginlog> ")
+		}
+		if !scanner.Scan() {
+			fmt.Println()
+			break
+		}
+
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		// Earlier query is repeated and recorded again
+		if strings.HasPrefix(line, "!") {
+			query, err := r.recall(line)
+			if err != nil {
+				fmt.Printf("Error %v\n", err)
+				continue
+			}
+			line = query
+			fmt.Println(line)
+		}
+
+		if line == "quit" || line == "exit" {
+			break
+		}
+		if line != "history" {
+			r.remember(line)
+		}
+
+		start := time.Now()
+		matched, err := r.Query(line)
+		if err != nil {
+			fmt.Printf("Error %v\n", err)
+			continue
+		}
+		if matched >= 0 {
+			fmt.Printf("(%s records, %v)\n", r.locale.Int(matched), time.Since(start).Round(time.Microsecond))
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return r.saveHistory()
+}
+
+// Running query, returns number of matching records or -1
+// when query doesn't scan records
+func (r *Repl) Query(line string) (int, error) {
+	command, rest, _ := strings.Cut(line, " ")
+	rest = strings.TrimSpace(rest)
+
+	// stats group-by BY is group BY, like -group-by of stats command
+	if command == "stats" && (rest == "group-by" || strings.HasPrefix(rest, "group-by ")) {
+		command, rest = "group", strings.TrimSpace(strings.TrimPrefix(rest, "group-by"))
+	}
+
+	switch command {
+	case "where":
+		return r.setWhere(rest)
+	case "filter":
+		return r.addFilter(rest)
+	case "reset":
+		r.where, r.whereSrc = nil, ""
+		r.filters, r.filterSrcs = nil, nil
+		fmt.Println("Filters cleared")
+		return r.records.Len(), nil
+	}
+
+	// Trailing where applies to this query only
+	var where Expr
+	if args, src, ok := strings.Cut(" "+rest, " where "); ok {
+		expr, err := compileFilter(src)
+		if err != nil {
+			return 0, err
+		}
+		where, rest = expr, strings.TrimSpace(args)
+	}
+	args := strings.Fields(rest)
+
+	pipeline := NewPipeline(r.newChecker())
+
+	var sink Sink
+	switch command {
+	case "help":
+		fmt.Print(replHelp)
+		return -1, nil
+
+	case "history":
+		for i, query := range r.history {
+			fmt.Printf("%5d  %s\n", i+1, query)
+		}
+		return -1, nil
+
+	case "count":
+
+	case "stats":
+		sink = metricsSink{metrics: NewMetricsAccumulator(r.now, r.percentiles), pipeline: pipeline, locale: r.locale}
+
+	case "group":
+		if len(args) == 0 {
+			return 0, fmt.Errorf("group needs key (e.g. group url)")
+		}
+		if err := validGroupBy(args[0]); err != nil {
+			return 0, err
+		}
+		limit, err := replLimit(args[1:], 0)
+		if err != nil {
+			return 0, err
+		}
+		sink = groupSink{groups: NewGroupAccumulator(args[0], r.now, r.percentiles), by: args[0], locale: r.locale, limit: limit}
+
+	case "top":
+		if len(args) == 0 {
+			return 0, fmt.Errorf("top needs report (%s)", strings.Join(topReports, ", "))
+		}
+		if err := validTop(args[0]); err != nil {
+			return 0, err
+		}
+		limit, err := replLimit(args[1:], 10)
+		if err != nil {
+			return 0, err
+		}
+
+		report := args[0]
+		if report == "slowest" {
+			sink = slowestSink{tracker: NewSlowestTracker(limit), format: "text", locale: r.locale}
+			break
+		}
+		by := topGroupBy(report)
+		sink = groupSink{
+			groups:  NewGroupAccumulator(by, r.now, r.percentiles),
+			by:      by,
+			locale:  r.locale,
+			include: func(record LogRecord) bool { return topIncludes(report, record) },
+			limit:   limit,
+		}
+
+	case "show":
+		limit, err := replLimit(args, replShowLimit)
+		if err != nil {
+			return 0, err
+		}
+		sink = &showSink{limit: limit}
+
+	default:
+		return 0, fmt.Errorf("unknown command %q, type help for commands", command)
+	}
+
+	if sink != nil {
+		pipeline.AddChecked(sink)
+	}
+
+	matched := 0
+	for i := range r.records.Len() {
+		record := r.records.Record(i)
+		if !r.matches(record) || where != nil && !exprMatches(where, recordEnv(record)) {
+			continue
+		}
+		matched++
+		if err := pipeline.Write(record); err != nil {
+			return 0, err
+		}
+	}
+
+	if command == "count" {
+		fmt.Println(r.locale.Int(matched))
+	}
+	return matched, pipeline.Finish()
+}
+
+// Setting filter of following queries
+func (r *Repl) setWhere(src string) (int, error) {
+	if src == "" {
+		r.where, r.whereSrc = nil, ""
+		fmt.Println("Filter cleared")
+		return r.count(), nil
+	}
+
+	expr, err := compileFilter(src)
+	if err != nil {
+		return 0, err
+	}
+
+	r.where, r.whereSrc = expr, src
+	matched := r.count()
+	fmt.Printf("Filter: %s\n", src)
+	return matched, nil
+}
+
+// Checking is record matching filters and where of session
+func (r *Repl) matches(record LogRecord) bool {
+	for _, filter := range r.filters {
+		if !filter(record) {
+			return false
+		}
+	}
+	return r.where == nil || exprMatches(r.where, recordEnv(record))
+}
+
+// Adding filters of following queries, each filter command narrows
+// records further
+func (r *Repl) addFilter(src string) (int, error) {
+	if src == "" {
+		return 0, fmt.Errorf("filter needs NAME=VALUE (%s)", strings.Join(replFilters, ", "))
+	}
+
+	query := url.Values{}
+	for _, arg := range strings.Fields(src) {
+		name, value, ok := strings.Cut(arg, "=")
+		name = strings.ReplaceAll(strings.TrimPrefix(name, "-"), "-", "_")
+		if !ok || !slices.Contains(replFilters, name) {
+			return 0, fmt.Errorf("unknown filter %q (supported: %s)", arg, strings.Join(replFilters, ", "))
+		}
+		query.Set(name, value)
+	}
+	match, err := apiFilter(query)
+	if err != nil {
+		return 0, err
+	}
+
+	r.filters = append(r.filters, match)
+	r.filterSrcs = append(r.filterSrcs, src)
+	fmt.Printf("Filter: %s\n", strings.Join(r.filterSrcs, " "))
+	return r.count(), nil
+}
+
+// Number of records matching filters and where of session
+func (r *Repl) count() int {
+	matched := 0
+	for i := range r.records.Len() {
+		if r.matches(r.records.Record(i)) {
+			matched++
+		}
+	}
+	return matched
+}
+
+// Compiling boolean record expression of where
+func compileFilter(src string) (Expr, error) {
+	expr, err := compileExpr(src)
+	if err != nil {
+		return nil, err
+	}
+	return expr, checkBoolean(expr, recordEnv{})
+}
+
+// Query of !N or !!
+func (r *Repl) recall(line string) (string, error) {
+	if len(r.history) == 0 {
+		return "", fmt.Errorf("history is empty")
+	}
+	if line == "!!" {
+		return r.history[len(r.history)-1], nil
+	}
+
+	n, err := strconv.Atoi(line[1:])
+	if err != nil || n < 1 || n > len(r.history) {
+		return "", fmt.Errorf("no query %s in history", line)
+	}
+	return r.history[n-1], nil
+}
+
+func (r *Repl) remember(query string) {
+	if len(r.history) == 0 || r.history[len(r.history)-1] != query {
+		r.history = append(r.history, query)
+	}
+}
+
+// Writing last queries to history file
+func (r *Repl) saveHistory() error {
+	history := r.history[max(len(r.history)-replHistoryLimit, 0):]
+	if len(history) == 0 {
+		return nil
+	}
+	return os.WriteFile(r.historyFile, []byte(strings.Join(history, "\n")+"\n"), 0o600)
+}
+
+// Optional count argument of query
+func replLimit(args []string, fallback int) (int, error) {
+	if len(args) == 0 {
+		return fallback, nil
+	}
+	n, err := strconv.Atoi(args[0])
+	if err != nil || n < 0 || len(args) > 1 {
+		return 0, fmt.Errorf("invalid count %q", strings.Join(args, " "))
+	}
+	return n, nil
+}
+
+// Sink of show, first records in raw format
+type showSink struct {
+	limit   int
+	records []LogRecord
+}
+
+func (s *showSink) Add(record LogRecord) error {
+	if len(s.records) < s.limit {
+		s.records = append(s.records, record)
+	}
+	return nil
+}
+
+func (s *showSink) Finish() error {
+	return printRecords(s.records, "raw", nil)
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"syscall"
+	"time"
+)
+
+// Time after bucket end to wait for late records before closing it
+const rollupGrace = 5 * time.Minute
+
+// Aggregate of one closed time bucket
+type RollupEntry struct {
+	Start   time.Time      `json:"start"`
+	End     time.Time      `json:"end"`
+	Metrics Metrics        `json:"metrics"`
+	Routes  []GroupMetrics `json:"routes"`
+	Events  []string       `json:"events,omitempty"`
+
+	// Build which wrote entry
+	WrittenBy string `json:"written_by,omitempty"`
+}
+
+// Streaming aggregation into hourly or daily buckets.
+// Closed buckets are appended to files in dir (one file per bucket)
+// and dropped from memory, so long-running follow mode keeps bounded
+// memory. Records arriving after their bucket was closed are appended
+// as another entry for the same bucket.
+type Rollup struct {
+	dir         string
+	period      string
+	percentiles []float64
+	annotations []Annotation
+	dryRun      *DryRun
+
+	open   map[time.Time]*rollupBucket
+	latest time.Time
+}
+
+// Aggregates of open bucket
+type rollupBucket struct {
+	metrics *MetricsAccumulator
+	routes  *GroupAccumulator
+}
+
+// Creating rollup writing to dir, period is "hour" or "day".
+// Annotations are attached to entries of buckets they fall into.
+// With dry run entries are only counted.
+func NewRollup(dir string, period string, percentiles []float64, annotations []Annotation, dryRun *DryRun) (*Rollup, error) {
+	if period != "hour" && period != "day" {
+		return nil, fmt.Errorf("unknown period %q (supported: hour, day)", period)
+	}
+
+	if dryRun != nil {
+		dryRun.CheckDir(dir)
+	} else if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	return &Rollup{
+		dir:         dir,
+		period:      period,
+		percentiles: percentiles,
+		annotations: annotations,
+		dryRun:      dryRun,
+		open:        make(map[time.Time]*rollupBucket),
+	}, nil
+}
+
+// Adding record and flushing buckets closed by its time.
+// Records with implausible timestamps are skipped.
+func (r *Rollup) Add(record LogRecord, now time.Time) error {
+	if !plausibleTimestamp(record.Date, now) {
+		return nil
+	}
+
+	start := r.bucketStart(record.Date)
+	bucket, ok := r.open[start]
+	if !ok {
+		bucket = &rollupBucket{
+			metrics: NewMetricsAccumulator(now, r.percentiles),
+			routes:  NewGroupAccumulator("url", now, r.percentiles),
+		}
+		r.open[start] = bucket
+	}
+	bucket.metrics.Add(record)
+	bucket.routes.Add(record)
+
+	if record.Date.After(r.latest) {
+		r.latest = record.Date
+	}
+
+	return r.flush(false)
+}
+
+// Flushing all open buckets, used on exit
+func (r *Rollup) Close() error {
+	return r.flush(true)
+}
+
+// Writing closed buckets to disk
+func (r *Rollup) flush(all bool) error {
+	starts := slices.SortedFunc(maps.Keys(r.open), time.Time.Compare)
+	for _, start := range starts {
+		end := r.bucketEnd(start)
+		if !all && r.latest.Before(end.Add(rollupGrace)) {
+			continue
+		}
+
+		bucket := r.open[start]
+		entry := RollupEntry{
+			Start:   start,
+			End:     end,
+			Metrics: bucket.metrics.Metrics(),
+			Routes:  bucket.routes.Groups(),
+			Events:  annotationsBetween(r.annotations, start, end),
+
+			WrittenBy: currentBuild().String(),
+		}
+
+		if err := r.write(entry); err != nil {
+			return err
+		}
+		delete(r.open, start)
+	}
+
+	return nil
+}
+
+// Appending entry to bucket file
+func (r *Rollup) write(entry RollupEntry) error {
+	name := entry.Start.Format("2006-01-02")
+	if r.period == "hour" {
+		name = entry.Start.Format("2006-01-02T15")
+	}
+
+	path := filepath.Join(r.dir, name+".ndjson")
+	if r.dryRun != nil {
+		data, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		r.dryRun.File(path, "entries", true).Add(1, int64(len(data))+1)
+		return nil
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+
+	if err := json.NewEncoder(file).Encode(entry); err != nil {
+		file.Close()
+		return err
+	}
+
+	return file.Close()
+}
+
+// Start of bucket containing time
+func (r *Rollup) bucketStart(t time.Time) time.Time {
+	if r.period == "hour" {
+		return t.Truncate(time.Hour)
+	}
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+// End of bucket starting at time
+func (r *Rollup) bucketEnd(start time.Time) time.Time {
+	if r.period == "hour" {
+		return start.Add(time.Hour)
+	}
+	return start.AddDate(0, 0, 1)
+}
+
+// Feeding input into rollup until end of input or interrupt,
+// open buckets are flushed in both cases
+func runRollup(rollup *Rollup, input io.Reader, accept func(line string, number int) (LogRecord, bool, error)) error {
+	records := make(chan LogRecord)
+	errs := make(chan error, 1)
+
+	go func() {
+		reader := newLineReader(input)
+		for number := 1; ; number++ {
+			line, _, err := reader.ReadLine()
+			if err == nil {
+				var ok bool
+				var record LogRecord
+				if record, ok, err = accept(line, number); ok {
+					records <- record
+				}
+			}
+			if err != nil {
+				if err == io.EOF {
+					err = nil
+				}
+				errs <- err
+				close(records)
+				return
+			}
+		}
+	}()
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(interrupt)
+
+	for {
+		select {
+		case record, ok := <-records:
+			if !ok {
+				if err := <-errs; err != nil {
+					return err
+				}
+				return rollup.Close()
+			}
+
+			if err := rollup.Add(record, time.Now()); err != nil {
+				return err
+			}
+
+		case <-interrupt:
+			return rollup.Close()
+		}
+	}
+}
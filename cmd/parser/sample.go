@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"math/rand/v2"
+)
+
+// Share of input lines processed with -sample or -sample-every,
+// count based metrics are scaled by its inverse
+var sampleRate = 1.0
+
+// Sampling of input lines before parsing, probabilistic (-sample)
+// or every Nth line (-sample-every)
+type Sampler struct {
+	rate  float64
+	every int
+}
+
+// Sampler of flags, nil when every line is processed
+func NewSampler(rate float64, every int) (*Sampler, error) {
+	switch {
+	case rate != 0 && every != 0:
+		return nil, fmt.Errorf("-sample and -sample-every can't be combined")
+	case rate < 0 || rate > 1:
+		return nil, fmt.Errorf("-sample must be between 0 and 1")
+	case every < 0:
+		return nil, fmt.Errorf("-sample-every can't be negative")
+	case rate == 0 && every <= 1 || rate == 1:
+		return nil, nil
+	}
+
+	if every > 0 {
+		return &Sampler{rate: 1 / float64(every), every: every}, nil
+	}
+	return &Sampler{rate: rate}, nil
+}
+
+// Checking is line with number processed, called by parsing
+// workers concurrently
+func (s *Sampler) Keep(number int) bool {
+	if s.every > 0 {
+		return (number-1)%s.every == 0
+	}
+	return rand.Float64() < s.rate
+}
+
+// Count of sampled records scaled to all lines
+func scaleCount(n int) int {
+	return int(math.Round(float64(n) / sampleRate))
+}
+
+// Note of text reports with scaled counts, like the one of metrics
+func printSampleNote(w io.Writer, locale Locale) {
+	if sampleRate < 1 {
+		fmt.Fprintf(w, "Sampled: %s of lines, counts are estimates\n", locale.Percent(sampleRate))
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"time"
+)
+
+// Gin timestamps have second resolution, shorter gaps can't be trusted
+const timestampResolution = time.Second
+
+// Longest gap checked without -duration-cap
+const maxSanityGap = 10 * time.Minute
+
+// Streaming check of durations.
+//
+// Duration is suspicious if it exceeds the hard cap. With gaps
+// (-suspicious-gaps) it is also suspicious if it is longer than the gap
+// to the previous record of the same connection pattern (same IP,
+// method and URL), which may mean a mis-parsed unit rather than a real
+// slow request. Gin timestamps are completion times, so overlapping
+// identical requests (retries, polling clients) are flagged too, which
+// is why it's opt-in. Input is expected in log order, records older
+// than the previous one of their pattern are only checked against the
+// cap.
+//
+// Previous records older than the cap plus timestamp resolution are
+// evicted, longer durations are over the cap anyway, so memory is
+// bounded by patterns seen within the cap. Without cap gaps up to
+// maxSanityGap are checked.
+type SanityChecker struct {
+	durationCap time.Duration
+	gaps        bool
+	last        map[string]time.Time
+
+	// Newest record and time of last eviction
+	newest, evicted time.Time
+
+	// Number of suspicious records seen
+	Suspicious int
+}
+
+func NewSanityChecker(durationCap time.Duration, gaps bool) *SanityChecker {
+	return &SanityChecker{
+		durationCap: durationCap,
+		gaps:        gaps,
+		last:        make(map[string]time.Time),
+	}
+}
+
+// Checking is record duration plausible
+func (c *SanityChecker) Check(record LogRecord) bool {
+	suspicious := c.durationCap > 0 && record.Duration > c.durationCap
+	if c.gaps && c.gapSuspicious(record) {
+		suspicious = true
+	}
+
+	if suspicious {
+		c.Suspicious++
+	}
+	return !suspicious
+}
+
+// Checking is duration longer than gap to previous record of pattern
+func (c *SanityChecker) gapSuspicious(record LogRecord) bool {
+	suspicious := false
+	key := record.IP + " " + record.Method + " " + record.URL
+	if prev, ok := c.last[key]; ok && !record.Date.Before(prev) {
+		gap := record.Date.Sub(prev) + timestampResolution
+		if record.Duration > gap && record.Duration > timestampResolution {
+			suspicious = true
+		}
+	}
+
+	if prev, ok := c.last[key]; !ok || record.Date.After(prev) {
+		c.last[key] = record.Date
+	}
+	c.evict(record.Date)
+	return suspicious
+}
+
+// Dropping previous records gaps to which are longer than the cap,
+// once per cap of time so it's amortized over records
+func (c *SanityChecker) evict(date time.Time) {
+	if date.After(c.newest) {
+		c.newest = date
+	}
+	horizon := c.durationCap
+	if horizon <= 0 {
+		horizon = maxSanityGap
+	}
+	horizon += timestampResolution
+	if c.newest.Sub(c.evicted) < horizon {
+		return
+	}
+	for key, prev := range c.last {
+		if c.newest.Sub(prev) > horizon {
+			delete(c.last, key)
+		}
+	}
+	c.evicted = c.newest
+}
@@ -0,0 +1,369 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Release settings, set at build time with
+// -ldflags "-X main.version=v1.2.0 -X main.releasePublicKey=<base64>"
+var (
+	version          = "dev"
+	releaseAPI       = "https://api.github.com"
+	releaseRepo      = "alexdenkk/gin-log-parser"
+	releasePublicKey = ""
+)
+
+// Timeout of GitHub API and asset requests
+const releaseTimeout = 5 * time.Minute
+
+// GitHub release with its assets
+type release struct {
+	Tag    string `json:"tag_name"`
+	Assets []struct {
+		Name string `json:"name"`
+		URL  string `json:"browser_download_url"`
+	} `json:"assets"`
+}
+
+// Download URL of release asset
+func (r release) asset(name string) (string, bool) {
+	for _, a := range r.Assets {
+		if a.Name == name {
+			return a.URL, true
+		}
+	}
+	return "", false
+}
+
+// Version of running binary
+func currentVersion() string {
+	if version != "dev" {
+		return version
+	}
+	if info, ok := debug.ReadBuildInfo(); ok && strings.HasPrefix(info.Main.Version, "v") {
+		return info.Main.Version
+	}
+	return version
+}
+
+// "ginlog self-update" command.
+//
+// Release must have binary asset ginlog_<os>_<arch> (.exe on windows),
+// checksums.txt in sha256sum format and checksums.txt.sig (base64
+// ed25519 signature of checksums.txt) valid for releasePublicKey.
+// Binaries built without the key install releases verified only by
+// checksum with -checksum-only. Releases older than installed version,
+// or any release when it has no semantic version, need -force.
+func selfUpdate(args []string) error {
+	flags := flag.NewFlagSet("self-update", flag.ExitOnError)
+	check := flags.Bool("check", false, "Only check for newer release")
+	tag := flags.String("tag", "", "Install this release tag instead of latest")
+	force := flags.Bool("force", false, "Install release older than installed version, or when installed version is unknown (dev build)")
+	checksumOnly := flags.Bool("checksum-only", false, "Install release verified only by checksum when binary is built without release key")
+	flags.Parse(args)
+
+	client := &http.Client{Timeout: releaseTimeout}
+
+	rel, err := fetchRelease(client, *tag)
+	if err != nil {
+		return fmt.Errorf("checking releases: %w", err)
+	}
+
+	current := currentVersion()
+	order, err := compareVersions(rel.Tag, current)
+	switch {
+	case *check && err != nil:
+		fmt.Printf("ginlog %s is available (installed %s, not comparable: %v)\n", rel.Tag, current, err)
+		return nil
+	case *check && order > 0:
+		fmt.Printf("ginlog %s is available (installed %s)\n", rel.Tag, current)
+		return nil
+	case *check || err == nil && order == 0 && !*force:
+		fmt.Printf("ginlog %s is up to date\n", current)
+		return nil
+	case err != nil && !*force:
+		return fmt.Errorf("can't compare release %s with installed version: %w, -force installs it", rel.Tag, err)
+	case order < 0 && !*force:
+		return fmt.Errorf("release %s is older than installed %s, -force downgrades to it", rel.Tag, current)
+	}
+
+	name := fmt.Sprintf("ginlog_%s_%s", runtime.GOOS, runtime.GOARCH)
+	if runtime.GOOS == "windows" {
+		name += ".exe"
+	}
+
+	binaryURL, ok := rel.asset(name)
+	if !ok {
+		return fmt.Errorf("release %s has no %s", rel.Tag, name)
+	}
+	checksumsURL, ok := rel.asset("checksums.txt")
+	if !ok {
+		return fmt.Errorf("release %s has no checksums.txt", rel.Tag)
+	}
+
+	checksums, err := download(client, checksumsURL)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case releasePublicKey != "":
+		if err := verifySignature(client, rel, checksums); err != nil {
+			return err
+		}
+	case *checksumOnly:
+		fmt.Fprintf(os.Stderr, "Warning: binary is built without release key, signature of %s isn't verified, only its checksum\n", rel.Tag)
+	default:
+		return fmt.Errorf("binary is built without release key, so signature of %s can't be verified, -checksum-only installs it verified only by checksum", rel.Tag)
+	}
+
+	want, err := checksumOf(checksums, name)
+	if err != nil {
+		return err
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	if exe, err = filepath.EvalSymlinks(exe); err != nil {
+		return err
+	}
+
+	if err := replaceBinary(client, exe, binaryURL, want); err != nil {
+		return err
+	}
+
+	if releasePublicKey == "" {
+		fmt.Printf("Updated ginlog %s to %s (only checksum verified)\n", current, rel.Tag)
+	} else {
+		fmt.Printf("Updated ginlog %s to %s\n", current, rel.Tag)
+	}
+	return nil
+}
+
+// Comparing semantic versions like v1.2.0 or v1.3.0-rc.1, build
+// metadata after + is ignored. Returns -1, 0 or 1 like strings.Compare.
+func compareVersions(a, b string) (int, error) {
+	va, err := parseVersion(a)
+	if err != nil {
+		return 0, err
+	}
+	vb, err := parseVersion(b)
+	if err != nil {
+		return 0, err
+	}
+
+	for i := range 3 {
+		if va.core[i] != vb.core[i] {
+			return cmp.Compare(va.core[i], vb.core[i]), nil
+		}
+	}
+
+	// Release is newer than its pre-releases, which are compared
+	// field by field, numeric fields lower than alphanumeric ones
+	if len(va.pre) == 0 || len(vb.pre) == 0 {
+		return cmp.Compare(len(vb.pre), len(va.pre)), nil
+	}
+	for i := 0; i < len(va.pre) && i < len(vb.pre); i++ {
+		x, xErr := strconv.Atoi(va.pre[i])
+		y, yErr := strconv.Atoi(vb.pre[i])
+		switch {
+		case xErr == nil && yErr == nil && x != y:
+			return cmp.Compare(x, y), nil
+		case xErr == nil && yErr != nil:
+			return -1, nil
+		case xErr != nil && yErr == nil:
+			return 1, nil
+		case va.pre[i] != vb.pre[i]:
+			return strings.Compare(va.pre[i], vb.pre[i]), nil
+		}
+	}
+	return cmp.Compare(len(va.pre), len(vb.pre)), nil
+}
+
+// Semantic version, major, minor and patch and pre-release fields
+type semver struct {
+	core [3]int
+	pre  []string
+}
+
+func parseVersion(value string) (semver, error) {
+	var v semver
+	rest, ok := strings.CutPrefix(value, "v")
+	if !ok {
+		return v, fmt.Errorf("%q isn't semantic version like v1.2.0", value)
+	}
+	rest, _, _ = strings.Cut(rest, "+")
+	rest, pre, hasPre := strings.Cut(rest, "-")
+
+	parts := strings.Split(rest, ".")
+	if len(parts) != 3 {
+		return v, fmt.Errorf("%q isn't semantic version like v1.2.0", value)
+	}
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return v, fmt.Errorf("%q isn't semantic version like v1.2.0", value)
+		}
+		v.core[i] = n
+	}
+	if hasPre {
+		v.pre = strings.Split(pre, ".")
+	}
+	return v, nil
+}
+
+// Getting latest release or release by tag
+func fetchRelease(client *http.Client, tag string) (release, error) {
+	endpoint := releaseAPI + "/repos/" + releaseRepo + "/releases/latest"
+	if tag != "" {
+		endpoint = releaseAPI + "/repos/" + releaseRepo + "/releases/tags/" + url.PathEscape(tag)
+	}
+
+	req, err := http.NewRequest(http.MethodGet, endpoint, nil)
+	if err != nil {
+		return release{}, err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	if token := os.Getenv("GITHUB_TOKEN"); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return release{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return release{}, fmt.Errorf("%s: %s", endpoint, resp.Status)
+	}
+
+	var rel release
+	if err := json.NewDecoder(resp.Body).Decode(&rel); err != nil {
+		return release{}, fmt.Errorf("%s: %w", endpoint, err)
+	}
+	return rel, nil
+}
+
+// Downloading small release asset
+func download(client *http.Client, url string) ([]byte, error) {
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", url, resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// Verifying ed25519 signature of checksums
+func verifySignature(client *http.Client, rel release, checksums []byte) error {
+	key, err := base64.StdEncoding.DecodeString(releasePublicKey)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return fmt.Errorf("invalid release public key")
+	}
+
+	sigURL, ok := rel.asset("checksums.txt.sig")
+	if !ok {
+		return fmt.Errorf("release %s has no checksums.txt.sig", rel.Tag)
+	}
+
+	encoded, err := download(client, sigURL)
+	if err != nil {
+		return err
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(encoded)))
+	if err != nil {
+		return fmt.Errorf("checksums.txt.sig: %w", err)
+	}
+
+	if !ed25519.Verify(key, checksums, sig) {
+		return fmt.Errorf("invalid signature of checksums.txt")
+	}
+	return nil
+}
+
+// SHA-256 checksum of asset in sha256sum output
+func checksumOf(checksums []byte, name string) ([]byte, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(checksums))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && strings.TrimPrefix(fields[1], "*") == name {
+			return hex.DecodeString(fields[0])
+		}
+	}
+	return nil, fmt.Errorf("checksums.txt has no %s", name)
+}
+
+// Downloading new binary next to the running one and renaming it over.
+// Binary is replaced only if its checksum matches.
+func replaceBinary(client *http.Client, exe, url string, checksum []byte) error {
+	resp, err := client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: %s", url, resp.Status)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(exe), ".ginlog-update-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	hash := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(tmp, hash), resp.Body); err != nil {
+		tmp.Close()
+		return fmt.Errorf("downloading %s: %w", url, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	if !bytes.Equal(hash.Sum(nil), checksum) {
+		return fmt.Errorf("checksum mismatch of %s", url)
+	}
+
+	if err := os.Chmod(tmp.Name(), 0o755); err != nil {
+		return err
+	}
+
+	// Running binary can't be overwritten on windows, but can be renamed
+	if runtime.GOOS == "windows" {
+		old := exe + ".old"
+		os.Remove(old)
+		if err := os.Rename(exe, old); err != nil {
+			return err
+		}
+	}
+
+	return os.Rename(tmp.Name(), exe)
+}
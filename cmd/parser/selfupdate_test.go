@@ -0,0 +1,165 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Release with assets served by test server
+func releaseServer(t *testing.T, assets map[string]string) (*httptest.Server, release) {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		content, ok := assets[strings.TrimPrefix(r.URL.Path, "/")]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(content))
+	}))
+	t.Cleanup(srv.Close)
+
+	rel := release{Tag: "v1.2.0"}
+	for name := range assets {
+		rel.Assets = append(rel.Assets, struct {
+			Name string `json:"name"`
+			URL  string `json:"browser_download_url"`
+		}{name, srv.URL + "/" + name})
+	}
+	return srv, rel
+}
+
+func TestVerifySignature(t *testing.T) {
+	public, private, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func(key string) { releasePublicKey = key }(releasePublicKey)
+	releasePublicKey = base64.StdEncoding.EncodeToString(public)
+
+	checksums := []byte("0123  ginlog_linux_amd64\n")
+	sig := base64.StdEncoding.EncodeToString(ed25519.Sign(private, checksums))
+
+	srv, rel := releaseServer(t, map[string]string{"checksums.txt.sig": sig + "\n"})
+	if err := verifySignature(srv.Client(), rel, checksums); err != nil {
+		t.Errorf("valid signature: %v", err)
+	}
+
+	tampered := []byte("4567  ginlog_linux_amd64\n")
+	if err := verifySignature(srv.Client(), rel, tampered); err == nil || !strings.Contains(err.Error(), "invalid signature") {
+		t.Errorf("tampered checksums: %v, want invalid signature", err)
+	}
+
+	srv, rel = releaseServer(t, map[string]string{"checksums.txt.sig": "not base64!"})
+	if err := verifySignature(srv.Client(), rel, checksums); err == nil {
+		t.Error("garbage signature accepted")
+	}
+
+	srv, rel = releaseServer(t, map[string]string{"checksums.txt": string(checksums)})
+	if err := verifySignature(srv.Client(), rel, checksums); err == nil || !strings.Contains(err.Error(), "no checksums.txt.sig") {
+		t.Errorf("missing signature: %v, want missing asset", err)
+	}
+
+	releasePublicKey = base64.StdEncoding.EncodeToString(public[:16])
+	srv, rel = releaseServer(t, map[string]string{"checksums.txt.sig": sig})
+	if err := verifySignature(srv.Client(), rel, checksums); err == nil || !strings.Contains(err.Error(), "invalid release public key") {
+		t.Errorf("short key: %v, want invalid key", err)
+	}
+}
+
+func TestChecksumOf(t *testing.T) {
+	checksums := []byte("aa11  ginlog_linux_amd64\nbb22 *ginlog_windows_amd64.exe\nbad line\n")
+
+	for name, want := range map[string]string{"ginlog_linux_amd64": "aa11", "ginlog_windows_amd64.exe": "bb22"} {
+		got, err := checksumOf(checksums, name)
+		if err != nil || hex.EncodeToString(got) != want {
+			t.Errorf("checksumOf(%q) = %x, %v, want %s", name, got, err, want)
+		}
+	}
+	if _, err := checksumOf(checksums, "ginlog_darwin_arm64"); err == nil {
+		t.Error("checksum of missing asset found")
+	}
+}
+
+func TestReplaceBinary(t *testing.T) {
+	srv, rel := releaseServer(t, map[string]string{"ginlog_linux_amd64": "new binary"})
+	url, _ := rel.asset("ginlog_linux_amd64")
+
+	exe := filepath.Join(t.TempDir(), "ginlog")
+	if err := os.WriteFile(exe, []byte("old binary"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	wrong := sha256.Sum256([]byte("other binary"))
+	if err := replaceBinary(srv.Client(), exe, url, wrong[:]); err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Errorf("wrong checksum: %v, want mismatch", err)
+	}
+	if content, _ := os.ReadFile(exe); string(content) != "old binary" {
+		t.Errorf("binary replaced despite checksum mismatch: %q", content)
+	}
+	if leftovers, _ := filepath.Glob(filepath.Join(filepath.Dir(exe), ".ginlog-update-*")); len(leftovers) != 0 {
+		t.Errorf("temporary files left: %v", leftovers)
+	}
+
+	right := sha256.Sum256([]byte("new binary"))
+	if err := replaceBinary(srv.Client(), exe, url, right[:]); err != nil {
+		t.Fatal(err)
+	}
+	if content, _ := os.ReadFile(exe); string(content) != "new binary" {
+		t.Errorf("binary %q, want new binary", content)
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"v1.2.0", "v1.2.0", 0},
+		{"v1.10.0", "v1.9.3", 1},
+		{"v1.2.0", "v2.0.0", -1},
+		{"v1.2.0", "v1.2.0-rc.1", 1},
+		{"v1.2.0-rc.2", "v1.2.0-rc.10", -1},
+		{"v1.2.0-rc.1", "v1.2.0-beta", 1},
+		{"v1.2.0-1", "v1.2.0-alpha", -1},
+		{"v1.2.0-rc", "v1.2.0-rc.1", -1},
+		{"v1.2.0+build.5", "v1.2.0", 0},
+		{"v1.2.0", "v0.0.0-20261015100750-a2250919b282+dirty", 1},
+	}
+	for _, tt := range tests {
+		if got, err := compareVersions(tt.a, tt.b); err != nil || got != tt.want {
+			t.Errorf("compareVersions(%q, %q) = %d, %v, want %d", tt.a, tt.b, got, err, tt.want)
+		}
+	}
+
+	for _, value := range []string{"dev", "1.2.0", "v1.2", "v1.x.0", "v1.2.3.4"} {
+		if _, err := compareVersions("v1.2.0", value); err == nil {
+			t.Errorf("compareVersions with %q succeeded, want error", value)
+		}
+	}
+}
+
+func TestFetchReleaseEscapesTag(t *testing.T) {
+	var path string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.EscapedPath()
+		w.Write([]byte(`{"tag_name": "v1.2.0"}`))
+	}))
+	defer srv.Close()
+	defer func(api string) { releaseAPI = api }(releaseAPI)
+	releaseAPI = srv.URL
+
+	if _, err := fetchRelease(srv.Client(), "v1.2.0/../../latest?x"); err != nil {
+		t.Fatal(err)
+	}
+	if want := "/repos/" + releaseRepo + "/releases/tags/v1.2.0%2F..%2F..%2Flatest%3Fx"; path != want {
+		t.Errorf("requested %s, want %s", path, want)
+	}
+}
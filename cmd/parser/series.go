@@ -0,0 +1,135 @@
+package main
+
+import (
+	"cmp"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"maps"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// Formats of -series output
+var seriesFormats = []string{"csv", "json", "ndjson"}
+
+// Row of percentile series: requests of one route in one interval
+// with their sketch, so series can be re-aggregated over longer
+// intervals or several routes without loss
+type SeriesRow struct {
+	Start       time.Time    `json:"start"`
+	Route       string       `json:"route"`
+	Count       int          `json:"count"`
+	Errors      int          `json:"errors"`
+	Percentiles []Percentile `json:"percentiles"`
+	Sketch      *Sketch      `json:"sketch"`
+}
+
+// Percentile series per interval and route (export -series).
+// Percentiles are taken from sketch too, so they match what
+// re-aggregation of rows gives.
+type PercentileSeries struct {
+	interval    time.Duration
+	now         time.Time
+	percentiles []float64
+	rows        map[seriesKey]*SeriesRow
+}
+
+type seriesKey struct {
+	start time.Time
+	route string
+}
+
+func NewPercentileSeries(interval time.Duration, now time.Time, percentiles []float64) *PercentileSeries {
+	return &PercentileSeries{
+		interval:    interval,
+		now:         now,
+		percentiles: percentiles,
+		rows:        make(map[seriesKey]*SeriesRow),
+	}
+}
+
+// Adding record to row of its interval and route, records with
+// implausible timestamps are skipped
+func (s *PercentileSeries) Add(record LogRecord) error {
+	if !plausibleTimestamp(record.Date, s.now) {
+		return nil
+	}
+
+	key := seriesKey{record.Date.Truncate(s.interval), groupKey(record, "url")}
+	row, ok := s.rows[key]
+	if !ok {
+		row = &SeriesRow{Start: key.start, Route: key.route, Sketch: NewSketch()}
+		s.rows[key] = row
+	}
+	row.Count++
+	if isError(record.Code) {
+		row.Errors++
+	}
+	row.Sketch.Add(record.Duration)
+	return nil
+}
+
+// Rows by interval and route
+func (s *PercentileSeries) Rows() []SeriesRow {
+	keys := slices.SortedFunc(maps.Keys(s.rows), func(a, b seriesKey) int {
+		if c := a.start.Compare(b.start); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.route, b.route)
+	})
+
+	rows := make([]SeriesRow, 0, len(keys))
+	for _, key := range keys {
+		row := *s.rows[key]
+		row.Percentiles = make([]Percentile, len(s.percentiles))
+		for i, p := range s.percentiles {
+			row.Percentiles[i] = Percentile{P: p, Value: row.Sketch.Quantile(p)}
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// Writing series as CSV with percentile columns in milliseconds
+// and sketch as JSON, or as JSON array or NDJSON
+func writeSeries(w io.Writer, rows []SeriesRow, percentiles []float64, format string) error {
+	switch format {
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(rows)
+
+	case "ndjson":
+		enc := json.NewEncoder(w)
+		for _, row := range rows {
+			if err := enc.Encode(row); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	cw := csv.NewWriter(w)
+	header := []string{"start", "route", "count", "errors"}
+	for _, p := range percentiles {
+		header = append(header, percentileLabel(p)+"_ms")
+	}
+	cw.Write(append(header, "sketch"))
+
+	for _, row := range rows {
+		sketch, err := json.Marshal(row.Sketch)
+		if err != nil {
+			return err
+		}
+
+		line := []string{row.Start.Format(time.RFC3339), row.Route, strconv.Itoa(row.Count), strconv.Itoa(row.Errors)}
+		for _, p := range row.Percentiles {
+			line = append(line, strconv.FormatFloat(durationMs(p.Value), 'f', -1, 64))
+		}
+		cw.Write(append(line, string(sketch)))
+	}
+	cw.Flush()
+	return cw.Error()
+}
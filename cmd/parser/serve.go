@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Serve mode: reading records from input in background and exposing
+// collected metrics at /metrics, records and their metrics at REST
+// endpoints when index is given, and running scheduled jobs with
+// their status at /jobs when scheduler is given, and managing alert
+// silences at /silences when silences are given. Error of filters
+// (-strict) stops serving.
+func serve(addr string, input io.Reader, accept func(line string, number int) (LogRecord, bool, error), collector *PromCollector, index *RecordIndex, percentiles []float64, scheduler *Scheduler, silences *SilenceStore) error {
+	failed := make(chan error, 2)
+	go func() {
+		reader := newLineReader(input)
+		for number := 1; ; number++ {
+			line, _, err := reader.ReadLine()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error reading input: %v\n", err)
+				break
+			}
+
+			record, ok, err := accept(line, number)
+			if err != nil {
+				failed <- err
+				return
+			}
+			if ok {
+				collector.Add(record)
+				if index != nil {
+					index.Add(record)
+				}
+			}
+		}
+	}()
+
+	mux := http.NewServeMux()
+	// Prometheus asks for protobuf first when native histograms are
+	// enabled, text format can't carry them
+	mux.HandleFunc("GET /metrics", func(w http.ResponseWriter, r *http.Request) {
+		write := collector.Write
+		if strings.Contains(r.Header.Get("Accept"), "proto=io.prometheus.client.MetricFamily") {
+			w.Header().Set("Content-Type", promProtoContentType)
+			write = collector.WriteProtobuf
+		} else {
+			w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		}
+		if err := write(w); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing metrics: %v\n", err)
+		}
+	})
+
+	if index != nil {
+		index.Register(mux, percentiles)
+		fmt.Fprintf(os.Stderr, "Serving records at http://%s/records\n", addr)
+	}
+
+	if scheduler != nil {
+		scheduler.Register(mux)
+		scheduler.Start()
+		fmt.Fprintf(os.Stderr, "Serving status of jobs at http://%s/jobs\n", addr)
+	}
+
+	if silences != nil {
+		silences.Register(mux)
+		fmt.Fprintf(os.Stderr, "Serving alert silences at http://%s/silences\n", addr)
+	}
+
+	fmt.Fprintf(os.Stderr, "Serving metrics at http://%s/metrics\n", addr)
+	server := &http.Server{Addr: addr, Handler: buildHeaders(mux)}
+	go func() {
+		failed <- server.ListenAndServe()
+	}()
+
+	err := <-failed
+	server.Close()
+	return err
+}
+
+// Stamping every response with build of ginlog and version of record
+// schema, so clients can tell which ginlog served them
+func buildHeaders(next http.Handler) http.Handler {
+	build := currentBuild()
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Ginlog-Version", build.Version)
+		if build.Commit != "" {
+			w.Header().Set("X-Ginlog-Commit", build.Commit)
+		}
+		w.Header().Set("X-Ginlog-Schema", strconv.Itoa(build.Schemas["records"]))
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Silence rule, suppresses matching alerts during time window.
+// Matchers are glob patterns on alert labels (alertname, metric, host),
+// all of them must match. Id is given by /silences of serve mode.
+type Silence struct {
+	ID       string            `json:"id,omitempty"`
+	Start    time.Time         `json:"start"`
+	End      time.Time         `json:"end"`
+	Matchers map[string]string `json:"matchers"`
+	Comment  string            `json:"comment"`
+}
+
+// Loading silences from JSON file
+func loadSilences(file string) ([]Silence, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var silences []Silence
+	if err := json.Unmarshal(data, &silences); err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+
+	for i, silence := range silences {
+		if err := silence.check(); err != nil {
+			return nil, fmt.Errorf("%s: silence %d: %w", file, i+1, err)
+		}
+	}
+
+	return silences, nil
+}
+
+// Checking end and matcher patterns of silence
+func (s Silence) check() error {
+	if s.End.IsZero() {
+		return errors.New("silence has no end")
+	}
+	if s.End.Before(s.Start) {
+		return errors.New("silence ends before its start")
+	}
+	for label, pattern := range s.Matchers {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("bad pattern for %s: %w", label, err)
+		}
+	}
+	return nil
+}
+
+// Checking is silence active at given time
+func (s Silence) Active(now time.Time) bool {
+	return !now.Before(s.Start) && now.Before(s.End)
+}
+
+// Checking is alert matched by silence
+func (s Silence) Matches(alert Alert) bool {
+	for label, pattern := range s.Matchers {
+		if ok, _ := path.Match(pattern, alert.Labels[label]); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// Finding active silence for alert
+func findSilence(silences []Silence, alert Alert, now time.Time) (Silence, bool) {
+	for _, silence := range silences {
+		if silence.Active(now) && silence.Matches(alert) {
+			return silence, true
+		}
+	}
+	return Silence{}, false
+}
+
+// Silences of -silences file managed over admin API of serve mode.
+// Every change rewrites the file, so alert rules of scheduled jobs and
+// other runs reading it are silenced too.
+type SilenceStore struct {
+	mu       sync.Mutex
+	file     string
+	silences []Silence
+}
+
+// Opening silences of file, missing file has no silences yet and is
+// created by first silence. Silences without id are given one.
+func NewSilenceStore(file string) (*SilenceStore, error) {
+	s := &SilenceStore{file: file, silences: []Silence{}}
+	if _, err := os.Stat(file); os.IsNotExist(err) {
+		return s, nil
+	}
+	silences, err := loadSilences(file)
+	if err != nil {
+		return nil, err
+	}
+	for i := range silences {
+		if silences[i].ID == "" {
+			silences[i].ID = newSilenceID()
+		}
+	}
+	s.silences = silences
+	return s, nil
+}
+
+// Random id of silence
+func newSilenceID() string {
+	id := make([]byte, 8)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// Adding checked silence with new id
+func (s *SilenceStore) Add(silence Silence) (Silence, error) {
+	silence.ID = newSilenceID()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	silences := append(slices.Clip(s.silences), silence)
+	if err := s.save(silences); err != nil {
+		return Silence{}, err
+	}
+	s.silences = silences
+	return silence, nil
+}
+
+// Deleting silence by id, false when there is no such silence
+func (s *SilenceStore) Delete(id string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := slices.IndexFunc(s.silences, func(silence Silence) bool { return silence.ID == id })
+	if i < 0 {
+		return false, nil
+	}
+	silences := slices.Delete(slices.Clone(s.silences), i, i+1)
+	if err := s.save(silences); err != nil {
+		return false, err
+	}
+	s.silences = silences
+	return true, nil
+}
+
+// Silences, expired ones too
+func (s *SilenceStore) Silences() []Silence {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.silences)
+}
+
+// Writing silences to file, readers never see partial file
+func (s *SilenceStore) save(silences []Silence) error {
+	data, err := json.MarshalIndent(silences, "", "  ")
+	if err != nil {
+		return err
+	}
+	file, err := createAtomic(s.file, false)
+	if err != nil {
+		return err
+	}
+	if _, err := file.File().Write(append(data, '\n')); err != nil {
+		file.Abort()
+		return err
+	}
+	return file.Commit()
+}
+
+// Registering admin API of silences:
+//
+//	GET    /silences       every silence, active ones have "active": true
+//	POST   /silences       add silence of JSON body, start defaults to now
+//	DELETE /silences/{id}  delete silence
+func (s *SilenceStore) Register(mux *http.ServeMux) {
+	type apiSilence struct {
+		Silence
+		Active bool `json:"active"`
+	}
+
+	mux.HandleFunc("GET /silences", func(w http.ResponseWriter, r *http.Request) {
+		now := time.Now()
+		silences := []apiSilence{}
+		for _, silence := range s.Silences() {
+			silences = append(silences, apiSilence{silence, silence.Active(now)})
+		}
+		writeAPIJSON(w, silences)
+	})
+
+	mux.HandleFunc("POST /silences", func(w http.ResponseWriter, r *http.Request) {
+		var silence Silence
+		decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&silence); err != nil {
+			writeAPIError(w, fmt.Errorf("bad silence: %w", err))
+			return
+		}
+		now := time.Now()
+		if silence.Start.IsZero() {
+			silence.Start = now
+		}
+		if err := silence.check(); err != nil {
+			writeAPIError(w, err)
+			return
+		}
+		silence, err := s.Add(silence)
+		if err != nil {
+			writeAPIServerError(w, err)
+			return
+		}
+		fmt.Fprintf(os.Stderr, "Silence %s added until %s %s\n", silence.ID, silence.End.Format(time.DateTime), silence.Comment)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(apiSilence{silence, silence.Active(now)})
+	})
+
+	mux.HandleFunc("DELETE /silences/{id}", func(w http.ResponseWriter, r *http.Request) {
+		ok, err := s.Delete(r.PathValue("id"))
+		if err != nil {
+			writeAPIServerError(w, err)
+			return
+		}
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprintf(os.Stderr, "Silence %s deleted\n", r.PathValue("id"))
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync/atomic"
+	"text/tabwriter"
+)
+
+// Paths application doesn't log (gin.LoggerConfig.SkipPaths). Requests
+// to them are left out of all metrics, so error rate and latency of logs
+// written before and after skipping was configured are comparable.
+// They are counted to estimate traffic missing from current logs.
+type SkipPaths struct {
+	paths []string
+	seen  map[string]*atomic.Int64
+
+	// Other requests matching filters
+	requests atomic.Int64
+}
+
+// Parsing comma-separated -skip-paths, nil for empty list
+func NewSkipPaths(list string) (*SkipPaths, error) {
+	if list == "" {
+		return nil, nil
+	}
+
+	s := &SkipPaths{seen: make(map[string]*atomic.Int64)}
+	for path := range strings.SplitSeq(list, ",") {
+		path = strings.TrimSpace(path)
+		if !strings.HasPrefix(path, "/") {
+			return nil, fmt.Errorf("path %q must start with /", path)
+		}
+		if _, ok := s.seen[path]; !ok {
+			s.paths = append(s.paths, path)
+			s.seen[path] = &atomic.Int64{}
+		}
+	}
+	return s, nil
+}
+
+// Checking is record request to skipped path. Like gin, path is
+// compared without query. Called by parsing workers concurrently.
+func (s *SkipPaths) Skip(record LogRecord) bool {
+	path := record.Path()
+	if count, ok := s.seen[path]; ok {
+		count.Add(1)
+		return true
+	}
+
+	s.requests.Add(1)
+	return false
+}
+
+// Printing skipped requests found in logs and share of traffic they
+// had, which is missing from logs written with these skip paths
+func (s *SkipPaths) Report(w io.Writer, locale Locale) {
+	var skipped int64
+	for _, path := range s.paths {
+		skipped += s.seen[path].Load()
+	}
+	total := skipped + s.requests.Load()
+
+	fmt.Fprintf(w, "Skip paths, left out of metrics:\n")
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, path := range s.paths {
+		count := s.seen[path].Load()
+		if count == 0 {
+			fmt.Fprintf(tw, "  %s\tnot in logs\n", path)
+			continue
+		}
+		fmt.Fprintf(tw, "  %s\t%s requests\t%s\n", path, locale.Int(int(count)), locale.Percent(float64(count)/float64(total)))
+	}
+	tw.Flush()
+
+	if skipped == 0 {
+		fmt.Fprintf(w, "Unlogged traffic can't be estimated, logs have no requests to skip paths\n")
+		return
+	}
+	fmt.Fprintf(w, "Logs written with skip paths miss about %s of requests\n", locale.Percent(float64(skipped)/float64(total)))
+}
@@ -0,0 +1,61 @@
+//go:build !minimal
+
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/smtp"
+)
+
+// Sending metrics report with records attached as CSV
+func sendReport(cfg EmailConfig, metrics Metrics, records []LogRecord, locale Locale) error {
+	cfg, message, err := renderReport(cfg, metrics, records, locale)
+	if err != nil {
+		return err
+	}
+
+	return smtp.SendMail(cfg.Server, smtpAuth(cfg), cfg.From, cfg.To, message)
+}
+
+// Authentication of SMTP user, nil without user
+func smtpAuth(cfg EmailConfig) smtp.Auth {
+	if cfg.User == "" {
+		return nil
+	}
+	host, _, _ := net.SplitHostPort(cfg.Server)
+	return smtp.PlainAuth("", cfg.User, cfg.Password, host)
+}
+
+// Checking SMTP connection, TLS and credentials without sending,
+// the same steps as smtp.SendMail takes before MAIL command
+func checkSMTP(cfg EmailConfig) error {
+	c, err := smtp.Dial(cfg.Server)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	if err := c.Hello("localhost"); err != nil {
+		return err
+	}
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		host, _, _ := net.SplitHostPort(cfg.Server)
+		if err := c.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+
+	if auth := smtpAuth(cfg); auth != nil {
+		if ok, _ := c.Extension("AUTH"); !ok {
+			return fmt.Errorf("server doesn't support AUTH")
+		}
+		if err := c.Auth(auth); err != nil {
+			return err
+		}
+	}
+
+	return c.Quit()
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Supported -sort keys
+var sortKeys = []string{"duration", "date", "code", "url"}
+
+// Checking is sort key supported
+func validSort(key string) error {
+	if !slices.Contains(sortKeys, key) {
+		return fmt.Errorf("unknown key %q (supported: %s)", key, strings.Join(sortKeys, ", "))
+	}
+	return nil
+}
+
+// Comparing records by sort key
+func compareRecords(a, b LogRecord, key string) int {
+	switch key {
+	case "duration":
+		return cmp.Compare(a.Duration, b.Duration)
+	case "date":
+		return a.Date.Compare(b.Date)
+	case "code":
+		return cmp.Compare(a.Code, b.Code)
+	case "url":
+		return strings.Compare(a.URL, b.URL)
+	}
+	return 0
+}
+
+// Record writer sorting records before writing them.
+// Sorting needs all records, so they are kept until close.
+// Sort is stable, equal records keep input order.
+type sortedWriter struct {
+	w       RecordWriter
+	key     string
+	desc    bool
+	records []LogRecord
+}
+
+func newSortedWriter(w RecordWriter, key string, desc bool) *sortedWriter {
+	return &sortedWriter{w: w, key: key, desc: desc}
+}
+
+func (w *sortedWriter) Write(record LogRecord) error {
+	w.records = append(w.records, record)
+	return nil
+}
+
+func (w *sortedWriter) Close() error {
+	slices.SortStableFunc(w.records, func(a, b LogRecord) int {
+		if w.desc {
+			return compareRecords(b, a, w.key)
+		}
+		return compareRecords(a, b, w.key)
+	})
+
+	for _, record := range w.records {
+		if err := w.w.Write(record); err != nil {
+			return err
+		}
+	}
+	return w.w.Close()
+}
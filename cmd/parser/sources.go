@@ -0,0 +1,195 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Metric of source is an outlier when it is this many times worse
+// than median of other sources
+const outlierFactor = 2
+
+// Minimal error rate difference to other sources for error rate outlier
+const minOutlierErrorRate = 0.01
+
+// Input of -compare-sources, argument is "label=path" or just path
+type Source struct {
+	Label string
+	Name  string
+}
+
+// Parsing source arguments.
+// Text before "=" is a label if it has no slash or colon, so
+// paths and URLs with "=" in query are kept as they are.
+func parseSources(args []string) []Source {
+	sources := make([]Source, 0, len(args))
+	for _, arg := range args {
+		label, name, ok := strings.Cut(arg, "=")
+		if !ok || label == "" || strings.ContainsAny(label, "/:") {
+			label, name = arg, arg
+		}
+		sources = append(sources, Source{Label: label, Name: name})
+	}
+	return sources
+}
+
+// Metrics of one source in comparison
+type SourceMetrics struct {
+	Source      string       `json:"source"`
+	Count       int          `json:"count"`
+	RPS         float64      `json:"rps"`
+	Errors      int          `json:"errors"`
+	ErrorRate   float64      `json:"error_rate"`
+	Percentiles []Percentile `json:"percentiles"`
+	Suspicious  int          `json:"suspicious"`
+
+	// Metrics far from other sources (rps, error_rate, p95, ...)
+	Outliers []string `json:"outliers"`
+}
+
+// Reading source into its own metrics
+func readSourceMetrics(source Source, limit func(io.Reader) io.Reader, workers int, accept func(line string, number int) (LogRecord, bool, error),
+	checker *SanityChecker, now time.Time, percentiles []float64) (SourceMetrics, error) {
+	input, err := openInput(source.Name, nil)
+	if err != nil {
+		return SourceMetrics{}, fmt.Errorf("opening input: %w", err)
+	}
+	defer input.Close()
+
+	metrics := NewMetricsAccumulator(now, percentiles)
+	pipeline := NewPipeline(checker)
+	pipeline.AddChecked(accumulatorSink{metrics: metrics})
+
+	if err := readRecords(limit(input), workers, accept, pipeline.Write, nil); err != nil {
+		return SourceMetrics{}, fmt.Errorf("%s: %w", source.Name, err)
+	}
+
+	return newSourceMetrics(source.Label, metrics.Metrics(), pipeline.Suspicious()), nil
+}
+
+// Source metrics of aggregated metrics
+func newSourceMetrics(label string, m Metrics, suspicious int) SourceMetrics {
+	return SourceMetrics{
+		Source:      label,
+		Count:       m.Count,
+		RPS:         m.RPS,
+		Errors:      m.Errors,
+		ErrorRate:   m.ErrorRate,
+		Percentiles: m.Percentiles,
+		Suspicious:  suspicious,
+		Outliers:    []string{},
+	}
+}
+
+// Marking metrics far from median of other sources.
+// Error rate and latencies are outliers when higher, rps when
+// higher or lower, as a replica out of balancing is bad too.
+func markOutliers(sources []SourceMetrics, percentiles []float64) {
+	if len(sources) < 2 {
+		return
+	}
+
+	check := func(name string, value func(SourceMetrics) float64, outlier func(v, median float64) bool) {
+		for i := range sources {
+			var others []float64
+			for j := range sources {
+				if j != i {
+					others = append(others, value(sources[j]))
+				}
+			}
+
+			if outlier(value(sources[i]), medianOf(others)) {
+				sources[i].Outliers = append(sources[i].Outliers, name)
+			}
+		}
+	}
+
+	check("rps", func(s SourceMetrics) float64 { return s.RPS }, func(v, median float64) bool {
+		return v > median*outlierFactor || v*outlierFactor < median
+	})
+
+	check("error_rate", func(s SourceMetrics) float64 { return s.ErrorRate }, func(v, median float64) bool {
+		return v >= median*outlierFactor && v-median >= minOutlierErrorRate
+	})
+
+	for i, p := range percentiles {
+		check(percentileLabel(p), func(s SourceMetrics) float64 {
+			if i >= len(s.Percentiles) {
+				return 0
+			}
+			return float64(s.Percentiles[i].Value)
+		}, func(v, median float64) bool {
+			return v > 0 && v >= median*outlierFactor
+		})
+	}
+}
+
+// Median of values
+func medianOf(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+
+	sorted := slices.Sorted(slices.Values(values))
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[mid-1] + sorted[mid]) / 2
+	}
+	return sorted[mid]
+}
+
+// Sink adding records to metrics
+type accumulatorSink struct {
+	metrics *MetricsAccumulator
+}
+
+func (s accumulatorSink) Add(record LogRecord) error {
+	s.metrics.Add(record)
+	return nil
+}
+
+func (s accumulatorSink) Finish() error {
+	return nil
+}
+
+// Comparison output, one row per metric and one column per source.
+// Outliers are marked with "*".
+func printSourceComparison(sources []SourceMetrics, percentiles []float64, locale Locale) {
+	w := newTable(os.Stdout)
+
+	row := func(name string, value func(SourceMetrics) string) {
+		fmt.Fprintf(w, "%s", name)
+		for _, s := range sources {
+			cell := value(s)
+			if slices.Contains(s.Outliers, name) {
+				cell += " *"
+			}
+			fmt.Fprintf(w, "\t%s", cell)
+		}
+		fmt.Fprintln(w)
+	}
+
+	row("METRIC", func(s SourceMetrics) string { return s.Source })
+	row("requests", func(s SourceMetrics) string { return locale.Int(s.Count) })
+	row("rps", func(s SourceMetrics) string { return locale.Float(s.RPS, 2) })
+	row("error_rate", func(s SourceMetrics) string { return locale.Percent(s.ErrorRate) })
+
+	for i, p := range percentiles {
+		row(percentileLabel(p), func(s SourceMetrics) string {
+			if i >= len(s.Percentiles) {
+				return "-"
+			}
+			return locale.Duration(s.Percentiles[i].Value)
+		})
+	}
+
+	w.Flush()
+
+	if slices.ContainsFunc(sources, func(s SourceMetrics) bool { return len(s.Outliers) > 0 }) {
+		fmt.Printf("\n* outlier: at least %dx worse than median of other sources\n", outlierFactor)
+	}
+}
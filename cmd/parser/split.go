@@ -0,0 +1,143 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Supported -split-by keys, besides -group-by ones
+var splitKeys = []string{"day", "route", "status-class"}
+
+// File extensions of record formats
+var formatExtensions = map[string]string{
+	"raw":     "log",
+	"json":    "json",
+	"csv":     "csv",
+	"ndjson":  "ndjson",
+	"parquet": "parquet",
+	"records": "ndjson",
+	"binary":  "ginrec",
+}
+
+// Checking is split key supported
+func validSplitBy(by string) error {
+	if slices.Contains(splitKeys, by) {
+		return nil
+	}
+	if err := validGroupBy(by); err != nil {
+		return fmt.Errorf("unknown key %q (supported: %s or -group-by keys)", by, strings.Join(splitKeys, ", "))
+	}
+	return nil
+}
+
+// Partition key of record
+func partitionKey(record LogRecord, by string) string {
+	switch by {
+	case "day":
+		return record.Date.Format(time.DateOnly)
+	case "route":
+		return groupKey(record, "url")
+	case "status-class":
+		return statusClass(record.Code)
+	}
+	return groupKey(record, by)
+}
+
+// Making key safe to use as file name
+func fileNameKey(key string) string {
+	key = strings.Map(func(r rune) rune {
+		switch r {
+		case '/', '\\', ':', '*', '?', '"', '<', '>', '|', ' ':
+			return '_'
+		}
+		return r
+	}, key)
+
+	key = strings.Trim(key, "_")
+	if key == "" || key == "." || key == ".." {
+		return "_"
+	}
+	return key
+}
+
+// Record writer writing one file per partition.
+// Path template contains {key}, which is replaced with partition key.
+// With dry run files are only counted.
+type splitWriter struct {
+	by       string
+	template string
+	format   string
+	fields   []string
+	files    map[string]*os.File
+	writers  map[string]RecordWriter
+	dryRun   *DryRun
+	targets  map[string]*dryRunTarget
+}
+
+func newSplitWriter(by, template, format string, fields []string, dryRun *DryRun) *splitWriter {
+	if template == "" {
+		template = "{key}." + formatExtensions[format]
+	}
+
+	return &splitWriter{
+		by:       by,
+		template: template,
+		format:   format,
+		fields:   fields,
+		files:    make(map[string]*os.File),
+		writers:  make(map[string]RecordWriter),
+		dryRun:   dryRun,
+		targets:  make(map[string]*dryRunTarget),
+	}
+}
+
+func (w *splitWriter) Write(record LogRecord) error {
+	path := strings.ReplaceAll(w.template, "{key}", fileNameKey(partitionKey(record, w.by)))
+
+	writer, ok := w.writers[path]
+	if !ok && w.dryRun != nil {
+		target := w.dryRun.File(path, "records", false)
+		writer = newRecordWriter(dryRunWriter{target: target}, w.format, w.fields)
+		w.writers[path] = writer
+		w.targets[path] = target
+	} else if !ok {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			return err
+		}
+
+		file, err := os.Create(path)
+		if err != nil {
+			return err
+		}
+
+		writer = newRecordWriter(file, w.format, w.fields)
+		w.files[path] = file
+		w.writers[path] = writer
+	}
+
+	if target, ok := w.targets[path]; ok {
+		target.Add(1, 0)
+	}
+	return writer.Write(record)
+}
+
+// Closing all partition files
+func (w *splitWriter) Close() error {
+	var errs []error
+	for path, writer := range w.writers {
+		if err := writer.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", path, err))
+		}
+		if file, ok := w.files[path]; ok {
+			if err := file.Close(); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", path, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
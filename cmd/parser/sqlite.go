@@ -0,0 +1,179 @@
+//go:build !minimal
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// Records committed to database at once
+const sqliteBatch = 10000
+
+// Schema of exported records, dates are UTC wall clock text which
+// SQLite date functions understand, and build which wrote them
+const sqliteSchema = `CREATE TABLE IF NOT EXISTS records (
+	date TEXT NOT NULL,
+	code INTEGER NOT NULL,
+	duration_ns INTEGER NOT NULL,
+	ip TEXT NOT NULL,
+	method TEXT NOT NULL,
+	url TEXT NOT NULL,
+	route TEXT NOT NULL,
+	fields TEXT
+);
+CREATE INDEX IF NOT EXISTS records_date ON records (date);
+CREATE INDEX IF NOT EXISTS records_code ON records (code);
+CREATE INDEX IF NOT EXISTS records_route ON records (route, date);
+CREATE TABLE IF NOT EXISTS ginlog_meta (
+	key TEXT PRIMARY KEY,
+	value TEXT NOT NULL
+);
+`
+
+// Record writer loading records into SQLite database.
+// The sqlite3 command line shell is used, so no database driver
+// is needed; statements are written to its stdin in transactions.
+type sqliteWriter struct {
+	cmd   *exec.Cmd
+	stdin io.WriteCloser
+	buf   *bufio.Writer
+	n     int
+}
+
+// Transactions take write lock when they begin, so parallel runs
+// wait for each other's batches up to lockTimeout instead of failing
+// as busy.
+func newSQLiteWriter(path string, lockTimeout time.Duration) (*sqliteWriter, error) {
+	cmd := exec.Command("sqlite3", "-bail", path)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("starting sqlite3: %w", err)
+	}
+
+	w := &sqliteWriter{cmd: cmd, stdin: stdin, buf: bufio.NewWriter(stdin)}
+	timeout := fmt.Sprintf(".timeout %d\n", lockTimeout.Milliseconds())
+	build := currentBuild()
+	meta := fmt.Sprintf("INSERT OR REPLACE INTO ginlog_meta VALUES ('written_by', %s), ('records_schema', '%d');\n", sqlQuote(build.String()), build.Schemas["records"])
+	if _, err := w.buf.WriteString(timeout + "BEGIN IMMEDIATE;\n" + sqliteSchema + meta + "COMMIT;\nBEGIN IMMEDIATE;\n"); err != nil {
+		return nil, w.wait(err)
+	}
+	return w, nil
+}
+
+func (w *sqliteWriter) Write(record LogRecord) error {
+	fields := "NULL"
+	if len(record.Fields) > 0 {
+		encoded, err := json.Marshal(record.Fields)
+		if err != nil {
+			return err
+		}
+		fields = sqlQuote(string(encoded))
+	}
+
+	_, err := fmt.Fprintf(w.buf, "INSERT INTO records VALUES (%s, %d, %d, %s, %s, %s, %s, %s);\n",
+		sqlQuote(wallClock(record.Date).Format("2006-01-02 15:04:05.000")),
+		record.Code,
+		record.Duration.Nanoseconds(),
+		sqlQuote(record.IP),
+		sqlQuote(record.Method),
+		sqlQuote(record.URL),
+		sqlQuote(groupKey(record, "url")),
+		fields,
+	)
+	if err != nil {
+		return w.wait(err)
+	}
+
+	w.n++
+	if w.n%sqliteBatch == 0 {
+		if _, err := w.buf.WriteString("COMMIT;\nBEGIN IMMEDIATE;\n"); err != nil {
+			return w.wait(err)
+		}
+	}
+	return nil
+}
+
+// Committing last records and waiting for sqlite3
+func (w *sqliteWriter) Close() error {
+	if _, err := w.buf.WriteString("COMMIT;\n"); err != nil {
+		return w.wait(err)
+	}
+	if err := w.buf.Flush(); err != nil {
+		return w.wait(err)
+	}
+	w.stdin.Close()
+	return w.wait(nil)
+}
+
+// Waiting for sqlite3, its exit status is more useful than write error
+func (w *sqliteWriter) wait(writeErr error) error {
+	w.stdin.Close()
+	if err := w.cmd.Wait(); err != nil {
+		return fmt.Errorf("sqlite3: %w", err)
+	}
+	return writeErr
+}
+
+// Quoting SQL string literal
+func sqlQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// Output modes of sqlite3 by query -format
+var queryFormats = map[string]string{
+	"text": "-box",
+	"csv":  "-csv",
+	"json": "-json",
+}
+
+// "ginlog query" command, running SQL over database of export -sqlite
+func runQuery(args []string) error {
+	flags := flag.NewFlagSet("query", flag.ExitOnError)
+	path := flags.String("sqlite", "", "SQLite database written by export -sqlite")
+	format := flags.String("format", "text", "Output format: text, csv, json")
+	lockTimeout := new(time.Duration)
+	durationVar(flags, lockTimeout, "lock-timeout", 30*time.Second, "How long to wait while export to database is committing")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: ginlog query -sqlite logs.db [flags] \"SELECT ...\"\n\nSQL query over exported records (table records)\n\nFlags:\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if *path == "" || flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	mode, ok := queryFormats[*format]
+	if !ok {
+		return fmt.Errorf("unknown format %q (supported: text, csv, json)", *format)
+	}
+
+	if _, err := os.Stat(*path); err != nil {
+		return err
+	}
+
+	timeout := fmt.Sprintf(".timeout %d", lockTimeout.Milliseconds())
+	cmd := exec.Command("sqlite3", "-bail", "-readonly", "-header", mode, "-cmd", timeout, *path, flags.Arg(0))
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("sqlite3: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+//go:build !minimal
+
+package main
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// Remote file streamed over ssh.
+// The system ssh client is used, so ssh-agent, ~/.ssh/config and
+// known_hosts work as for interactive sessions.
+type sshReader struct {
+	cmd    *exec.Cmd
+	stdout io.ReadCloser
+	r      io.Reader
+}
+
+// Opening remote file given as [user@]host:path.
+// With compress file is gzipped on remote host, files ending
+// with .gz are decompressed locally too.
+func openSSH(spec string, compress bool) (*sshReader, error) {
+	host, file, ok := strings.Cut(spec, ":")
+	if !ok || host == "" || file == "" {
+		return nil, fmt.Errorf("invalid remote file %q (expected user@host:/path)", spec)
+	}
+
+	command := "cat -- " + shellQuote(file)
+	if compress {
+		command = "gzip -c -- " + shellQuote(file)
+	}
+
+	cmd := exec.Command("ssh", "-o", "BatchMode=yes", "--", host, command)
+	cmd.Stderr = os.Stderr
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	r := &sshReader{cmd: cmd, stdout: stdout, r: stdout}
+
+	if compress || strings.HasSuffix(file, ".gz") {
+		gz, err := gzip.NewReader(stdout)
+		if err != nil {
+			stdout.Close()
+			return nil, fmt.Errorf("%s: %w", spec, r.wait(err))
+		}
+		r.r = gz
+	}
+
+	return r, nil
+}
+
+// Reading remote file, failure of ssh is reported at end of output
+func (r *sshReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if err == io.EOF {
+		if err := r.wait(nil); err != nil {
+			return n, err
+		}
+	}
+	return n, err
+}
+
+// Waiting for ssh, its exit status is more useful than read error
+func (r *sshReader) wait(readErr error) error {
+	if err := r.cmd.Wait(); err != nil {
+		return fmt.Errorf("ssh: %w", err)
+	}
+	return readErr
+}
+
+func (r *sshReader) Close() error {
+	r.stdout.Close()
+	if r.cmd.ProcessState == nil {
+		r.cmd.Process.Kill()
+		r.cmd.Wait()
+	}
+	return nil
+}
+
+// Quoting argument for remote POSIX shell
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,95 @@
+//go:build !minimal
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// Parsing retention, duration of flags like 30d or 12h
+func parseRetention(value string) (time.Duration, error) {
+	retention, err := parseFlagDuration(value)
+	if err != nil {
+		return 0, err
+	}
+	if retention <= 0 {
+		return 0, fmt.Errorf("retention must be positive")
+	}
+	return retention, nil
+}
+
+// "ginlog store" command, maintenance of database of export -sqlite
+func runStore(args []string) error {
+	if len(args) == 0 || args[0] != "compact" {
+		fmt.Fprintf(os.Stderr, "Usage: ginlog store compact -sqlite logs.db -retention 30d\n")
+		os.Exit(2)
+	}
+
+	flags := flag.NewFlagSet("store compact", flag.ExitOnError)
+	path := flags.String("sqlite", "", "SQLite database written by export -sqlite")
+	retentionFlag := flags.String("retention", "", "Keep records this recent, Go duration or days (30d)")
+	lockTimeout := new(time.Duration)
+	durationVar(flags, lockTimeout, "lock-timeout", 30*time.Second, "How long to wait while export to database is committing")
+	dryRun := flags.Bool("dry-run", false, "Count records which would be deleted without deleting them")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: ginlog store compact -sqlite logs.db -retention 30d [flags]\n\nDeleting records older than retention and vacuuming database, so it doesn't grow unbounded\n\nFlags:\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args[1:])
+
+	if *path == "" || *retentionFlag == "" || flags.NArg() != 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	retention, err := parseRetention(*retentionFlag)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error in -retention: %v\n", err)
+		os.Exit(2)
+	}
+
+	before, err := os.Stat(*path)
+	if err != nil {
+		return err
+	}
+
+	// Dates are stored as UTC wall clock text, so cutoff is compared as
+	// text in the same layout
+	cutoff := wallClock(time.Now().Add(-retention).UTC()).Format("2006-01-02 15:04:05.000")
+	quoted := sqlQuote(cutoff)
+	script := fmt.Sprintf(".timeout %d\nBEGIN IMMEDIATE;\nDELETE FROM records WHERE date < %s;\nSELECT changes();\nCOMMIT;\nVACUUM;\nSELECT count(*) FROM records;\n", lockTimeout.Milliseconds(), quoted)
+	if *dryRun {
+		script = fmt.Sprintf(".timeout %d\nSELECT count(*) FROM records WHERE date < %s;\nSELECT count(*) FROM records WHERE date >= %s;\n", lockTimeout.Milliseconds(), quoted, quoted)
+	}
+
+	cmd := exec.Command("sqlite3", "-bail", "-list", *path)
+	cmd.Stdin = strings.NewReader(script)
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return fmt.Errorf("sqlite3: %w", err)
+	}
+
+	var deleted, kept int
+	if _, err := fmt.Sscan(string(out), &deleted, &kept); err != nil {
+		return fmt.Errorf("unexpected sqlite3 output %q", out)
+	}
+
+	if *dryRun {
+		fmt.Printf("Would delete %d records older than %s, %d records kept\n", deleted, cutoff, kept)
+		return nil
+	}
+
+	after, err := os.Stat(*path)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Deleted %d records older than %s, %d records kept\n", deleted, cutoff, kept)
+	fmt.Printf("Size %s -> %s, reclaimed %s\n", formatBytes(before.Size()), formatBytes(after.Size()), formatBytes(max(before.Size()-after.Size(), 0)))
+	return nil
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Version of record stream, written in every record. New versions
+// only add fields, so streams of older ginlog stay readable with
+// defaults of fields they lack, and streams of newer ginlog are read
+// with fields known here and a warning.
+const streamVersion = 1
+
+// Fields of record stream, first ones are required in every version
+var (
+	streamRequired = []string{"ginlog", "date", "code", "duration_ns", "method", "url"}
+	streamOptional = []string{"ip", "route", "fields"}
+)
+
+// Beginning of record stream lines, used to detect them
+const streamPrefix = `{"ginlog":`
+
+// Record of record stream.
+// Stream is written by "ginlog parse" and -format records and read by
+// every command, so parsing, filtering, enriching and reporting can
+// run as separate processes. Unlike ndjson output it keeps everything
+// parsed: exact duration, route and extra fields.
+type streamRecord struct {
+	Version    int               `json:"ginlog"`
+	Date       time.Time         `json:"date"`
+	Code       int               `json:"code"`
+	DurationNs int64             `json:"duration_ns"`
+	IP         string            `json:"ip"`
+	Method     string            `json:"method"`
+	URL        string            `json:"url"`
+	Route      string            `json:"route,omitempty"`
+	Fields     map[string]string `json:"fields,omitempty"`
+}
+
+// Record stream writer, flushes every record so stages downstream
+// get records without delay
+type streamWriter struct {
+	buf *bufio.Writer
+	enc *json.Encoder
+}
+
+func newStreamWriter(w io.Writer) *streamWriter {
+	buf := bufio.NewWriter(w)
+	return &streamWriter{buf: buf, enc: json.NewEncoder(buf)}
+}
+
+func (w *streamWriter) Write(record LogRecord) error {
+	err := w.enc.Encode(streamRecord{
+		Version:    streamVersion,
+		Date:       record.Date,
+		Code:       record.Code,
+		DurationNs: record.Duration.Nanoseconds(),
+		IP:         record.IP,
+		Method:     record.Method,
+		URL:        record.URL,
+		Route:      record.Route,
+		Fields:     record.Fields,
+	})
+	if err != nil {
+		return err
+	}
+	return w.buf.Flush()
+}
+
+func (w *streamWriter) Close() error {
+	return w.buf.Flush()
+}
+
+// Record of stream as decoded, required fields are pointers so
+// missing ones aren't taken for zero values
+type streamInput struct {
+	Version    *int              `json:"ginlog"`
+	Date       *time.Time        `json:"date"`
+	Code       *int              `json:"code"`
+	DurationNs *int64            `json:"duration_ns"`
+	IP         string            `json:"ip"`
+	Method     *string           `json:"method"`
+	URL        *string           `json:"url"`
+	Route      string            `json:"route"`
+	Fields     map[string]string `json:"fields"`
+}
+
+// Missing required fields of decoded record
+func (in streamInput) missing() []string {
+	present := []bool{in.Version != nil, in.Date != nil, in.Code != nil, in.DurationNs != nil, in.Method != nil, in.URL != nil}
+	var missing []string
+	for i, ok := range present {
+		if !ok {
+			missing = append(missing, streamRequired[i])
+		}
+	}
+	return missing
+}
+
+// Warning of stream of newer ginlog, printed once per run
+var streamNewerWarning sync.Once
+
+// Line format of record stream
+type streamFormat struct{}
+
+func (streamFormat) Parse(line string) (LogRecord, error) {
+	var decoded streamInput
+	if err := json.Unmarshal([]byte(line), &decoded); err != nil {
+		return LogRecord{}, err
+	}
+
+	if missing := decoded.missing(); len(missing) > 0 {
+		return LogRecord{}, fmt.Errorf("record stream misses required %s", strings.Join(missing, ", "))
+	}
+	if *decoded.Version < 1 {
+		return LogRecord{}, fmt.Errorf("unsupported record stream version %d", *decoded.Version)
+	}
+	if *decoded.Version > streamVersion {
+		streamNewerWarning.Do(func() { warnNewerStream(*decoded.Version, line) })
+	}
+
+	return LogRecord{
+		Date:     streamDate(*decoded.Date),
+		Code:     *decoded.Code,
+		Duration: time.Duration(*decoded.DurationNs),
+		IP:       decoded.IP,
+		Method:   *decoded.Method,
+		URL:      *decoded.URL,
+		Route:    decoded.Route,
+		Fields:   decoded.Fields,
+	}, nil
+}
+
+// Warning of stream written by newer ginlog, with its fields which
+// are dropped here
+func warnNewerStream(version int, line string) {
+	var fields map[string]json.RawMessage
+	json.Unmarshal([]byte(line), &fields)
+
+	var unknown []string
+	for _, name := range slices.Sorted(maps.Keys(fields)) {
+		if !slices.Contains(streamRequired, name) && !slices.Contains(streamOptional, name) {
+			unknown = append(unknown, name)
+		}
+	}
+
+	dropped := ""
+	if len(unknown) > 0 {
+		dropped = ", its fields " + strings.Join(unknown, ", ") + " are dropped"
+	}
+	fmt.Fprintf(os.Stderr, "Warning: record stream version %d is newer than version %d of this ginlog%s\n", version, streamVersion, dropped)
+}
+
+// Record dates keep zone they were written with, so streams of parse
+// runs with different -tz merge in order. Zone is only moved to
+// -display-tz, default keeps dates as they are.
+func streamDate(date time.Time) time.Time {
+	if displayZone == nil {
+		return date
+	}
+	return date.In(displayZone)
+}
+
+// Checking is line record of record stream
+func isStreamLine(line string) bool {
+	return strings.HasPrefix(strings.TrimLeft(line, " \t"), streamPrefix)
+}
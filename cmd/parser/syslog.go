@@ -0,0 +1,329 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Message of syslog or journald which is not request either, like
+// [GIN-debug] lines or journalctl "-- Boot ..." markers
+var errIgnoredLine = errors.New("not request")
+
+// Largest syslog message accepted over TCP
+const maxSyslogMessage = 1 << 20
+
+// Timestamps of RFC 3164 header and journalctl short outputs
+var syslogStamps = []string{time.StampMicro, time.StampMilli, time.Stamp}
+
+// Timestamps of rsyslog high precision and journalctl short-iso outputs
+var syslogISOStamps = []string{time.RFC3339Nano, "2006-01-02T15:04:05.999999999-0700"}
+
+// Lines wrapped in syslog header (-input syslog, -listen-syslog):
+// RFC 5424, RFC 3164, rsyslog files and journalctl short output.
+// Messages are parsed with inner format, host and app of header
+// become host and app fields.
+type syslogFormat struct {
+	inner LineFormat
+}
+
+func (f syslogFormat) Parse(line string) (LogRecord, error) {
+	message, host, app, ok := syslogMessage(line)
+	if !ok {
+		return LogRecord{}, fmt.Errorf("invalid syslog header")
+	}
+	return parseWrapped(f.inner, message, host, app)
+}
+
+// Journal entries (-input journald) of journalctl -o json, or of its
+// default short output. MESSAGE is parsed with inner format.
+type journaldFormat struct {
+	inner LineFormat
+}
+
+func (f journaldFormat) Parse(line string) (LogRecord, error) {
+	if !strings.HasPrefix(strings.TrimLeft(line, " \t"), "{") {
+		if strings.HasPrefix(line, "-- ") {
+			return LogRecord{}, errIgnoredLine
+		}
+		return syslogFormat(f).Parse(line)
+	}
+
+	var entry struct {
+		Message json.RawMessage `json:"MESSAGE"`
+		Host    string          `json:"_HOSTNAME"`
+		App     string          `json:"SYSLOG_IDENTIFIER"`
+	}
+	if err := json.Unmarshal([]byte(line), &entry); err != nil {
+		return LogRecord{}, err
+	}
+
+	// Messages which aren't valid UTF-8 are arrays of bytes
+	var message string
+	if err := json.Unmarshal(entry.Message, &message); err != nil {
+		var data []int
+		if err := json.Unmarshal(entry.Message, &data); err != nil {
+			return LogRecord{}, fmt.Errorf("journal entry without MESSAGE")
+		}
+		b := make([]byte, len(data))
+		for i, c := range data {
+			b[i] = byte(c)
+		}
+		message = string(b)
+	}
+	return parseWrapped(f.inner, message, entry.Host, entry.App)
+}
+
+// Parsing message of syslog or journal entry
+func parseWrapped(inner LineFormat, message, host, app string) (LogRecord, error) {
+	if ignoredLine(message) {
+		return LogRecord{}, errIgnoredLine
+	}
+
+	record, err := inner.Parse(message)
+	if err != nil {
+		return record, err
+	}
+
+	for name, value := range map[string]string{"host": host, "app": app} {
+		if value == "" || record.Fields[name] != "" {
+			continue
+		}
+		if record.Fields == nil {
+			record.Fields = make(map[string]string)
+		}
+		record.Fields[name] = value
+	}
+	return record, nil
+}
+
+// Message of line with syslog header, with host and app (tag without
+// PID) of header. Timestamp of header is dropped, request has its own.
+func syslogMessage(line string) (message, host, app string, ok bool) {
+	s := line
+	if rest, found := strings.CutPrefix(s, "<"); found {
+		pri, rest, found := strings.Cut(rest, ">")
+		if _, err := strconv.Atoi(pri); !found || err != nil || len(pri) > 3 {
+			return "", "", "", false
+		}
+		s = rest
+	}
+
+	// RFC 5424: VERSION TIMESTAMP HOST APP PROCID MSGID SD MSG
+	if len(s) > 2 && s[0] >= '1' && s[0] <= '9' && s[1] == ' ' {
+		fields := strings.SplitN(s, " ", 7)
+		if len(fields) < 7 {
+			return "", "", "", false
+		}
+		nilValue := func(v string) string {
+			if v == "-" {
+				return ""
+			}
+			return v
+		}
+
+		rest, found := strings.CutPrefix(fields[6], "-")
+		for !found && strings.HasPrefix(rest, "[") {
+			end := structuredDataEnd(rest)
+			if end < 0 {
+				return "", "", "", false
+			}
+			rest = rest[end+1:]
+			found = !strings.HasPrefix(rest, "[")
+		}
+		if !found {
+			return "", "", "", false
+		}
+		rest = strings.TrimPrefix(strings.TrimPrefix(rest, " "), "\ufeff")
+		return rest, nilValue(fields[2]), nilValue(fields[3]), true
+	}
+
+	// RFC 3164 and files: TIMESTAMP HOST TAG: MSG
+	stamped := false
+	for _, layout := range syslogStamps {
+		if len(s) > len(layout) && s[len(layout)] == ' ' {
+			if _, err := time.Parse(layout, s[:len(layout)]); err == nil {
+				s, stamped = s[len(layout)+1:], true
+				break
+			}
+		}
+	}
+	if !stamped {
+		stamp, rest, _ := strings.Cut(s, " ")
+		for _, layout := range syslogISOStamps {
+			if _, err := time.Parse(layout, stamp); err == nil {
+				s, stamped = rest, true
+				break
+			}
+		}
+	}
+	if !stamped {
+		return "", "", "", false
+	}
+
+	host, s, found := strings.Cut(s, " ")
+	if !found {
+		return "", "", "", false
+	}
+
+	// Tag is optional, messages may contain ": " too
+	if tag, rest, found := strings.Cut(s, ": "); found && !strings.Contains(tag, " ") {
+		app, _, _ = strings.Cut(tag, "[")
+		s = rest
+	}
+	return s, host, app, true
+}
+
+// Index of "]" ending structured data element, escaped "\]" inside
+// values doesn't end it
+func structuredDataEnd(s string) int {
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case ']':
+			return i
+		}
+	}
+	return -1
+}
+
+// Listener of syslog messages (-listen-syslog) over UDP and TCP on
+// same address. Transport framing is removed, so messages are read
+// one per line with their syslog header.
+type syslogListener struct {
+	udp net.PacketConn
+	tcp net.Listener
+	r   *io.PipeReader
+	w   *io.PipeWriter
+
+	// Messages of concurrent senders are written whole
+	mu sync.Mutex
+}
+
+func listenSyslog(addr string) (*syslogListener, error) {
+	udp, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	tcp, err := net.Listen("tcp", addr)
+	if err != nil {
+		udp.Close()
+		return nil, err
+	}
+
+	r, w := io.Pipe()
+	l := &syslogListener{udp: udp, tcp: tcp, r: r, w: w}
+	go l.serveUDP()
+	go l.serveTCP()
+
+	fmt.Fprintf(os.Stderr, "Listening for syslog messages on %s (udp, tcp)\n", addr)
+	return l, nil
+}
+
+func (l *syslogListener) Read(p []byte) (int, error) {
+	return l.r.Read(p)
+}
+
+func (l *syslogListener) Close() error {
+	l.udp.Close()
+	l.tcp.Close()
+	return l.w.Close()
+}
+
+// Writing message as line, trailing newlines and NULs are dropped
+func (l *syslogListener) write(message []byte) {
+	message = bytes.TrimRight(message, "\r\n\x00")
+	if len(message) == 0 {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.w.Write(append(message, '\n'))
+}
+
+// One message per datagram
+func (l *syslogListener) serveUDP() {
+	buf := make([]byte, 64*1024)
+	for {
+		n, _, err := l.udp.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		l.write(buf[:n])
+	}
+}
+
+func (l *syslogListener) serveTCP() {
+	for {
+		conn, err := l.tcp.Accept()
+		if err != nil {
+			return
+		}
+		go l.serveConn(conn)
+	}
+}
+
+// Messages of TCP connection, framed with octet counting (RFC 6587,
+// "LEN MSG") or ended with newline or NUL
+func (l *syslogListener) serveConn(conn net.Conn) {
+	defer conn.Close()
+
+	r := bufio.NewReader(conn)
+	for {
+		first, err := r.Peek(1)
+		if err != nil {
+			return
+		}
+
+		if first[0] >= '1' && first[0] <= '9' {
+			length, err := r.ReadString(' ')
+			if err != nil {
+				return
+			}
+			n, err := strconv.Atoi(strings.TrimSuffix(length, " "))
+			if err != nil || n > maxSyslogMessage {
+				fmt.Fprintf(os.Stderr, "Error in syslog message from %s: invalid frame length %q\n", conn.RemoteAddr(), length)
+				return
+			}
+			message := make([]byte, n)
+			if _, err := io.ReadFull(r, message); err != nil {
+				return
+			}
+			l.write(message)
+			continue
+		}
+
+		message, err := readSyslogLine(r)
+		l.write(message)
+		if err != nil {
+			return
+		}
+	}
+}
+
+// Message ended with newline or NUL
+func readSyslogLine(r *bufio.Reader) ([]byte, error) {
+	var message []byte
+	for len(message) <= maxSyslogMessage {
+		c, err := r.ReadByte()
+		if err != nil {
+			return message, err
+		}
+		if c == '\n' || c == 0 {
+			return message, nil
+		}
+		message = append(message, c)
+	}
+	return message, fmt.Errorf("syslog message too long")
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"unicode/utf8"
+)
+
+// Width tables of terminal output are fitted to (-max-width), 0 when
+// they are printed as they are
+var tableWidth int
+
+// Columns aren't truncated below this width
+const tableMinColumn = 12
+
+// Setting width of tables: -max-width, or width of terminal when stdout
+// is terminal. Tables piped or written to -o file, and with -no-truncate,
+// are kept whole. It's checked after -o replaced stdout, like color.
+func setTableWidth(maxWidth int, noTruncate bool) {
+	switch {
+	case noTruncate:
+		tableWidth = 0
+	case maxWidth > 0:
+		tableWidth = maxWidth
+	case isTerminal(os.Stdout):
+		tableWidth = terminalWidth()
+	default:
+		tableWidth = 0
+	}
+}
+
+// Table of tab separated cells, aligned like tabwriter on flush, with
+// widest columns (long URLs and query strings) truncated with ellipsis
+// until rows fit tableWidth
+type tableWriter struct {
+	out io.Writer
+	buf bytes.Buffer
+}
+
+func newTable(out io.Writer) *tableWriter {
+	return &tableWriter{out: out}
+}
+
+func (t *tableWriter) Write(p []byte) (int, error) {
+	return t.buf.Write(p)
+}
+
+func (t *tableWriter) Flush() error {
+	text := t.buf.String()
+	t.buf.Reset()
+	if tableWidth > 0 {
+		text = fitTable(text, tableWidth)
+	}
+
+	tw := tabwriter.NewWriter(t.out, 0, 0, 2, ' ', 0)
+	if _, err := io.WriteString(tw, text); err != nil {
+		return err
+	}
+	return tw.Flush()
+}
+
+// Width of cell on terminal, color escapes take no space
+func cellWidth(cell string) int {
+	if strings.Contains(cell, "\x1b") {
+		cell = ansiEscape.ReplaceAllString(cell, "")
+	}
+	return utf8.RuneCountInString(cell)
+}
+
+// Truncating cells of rows until widest row fits width. Widest column
+// is cut first, never below tableMinColumn, so narrow columns of codes
+// and numbers stay whole. Lines without tabs (titles) aren't rows.
+func fitTable(text string, width int) string {
+	lines := strings.Split(text, "\n")
+	rows := make([][]string, len(lines))
+	for i, line := range lines {
+		if strings.Contains(line, "\t") {
+			rows[i] = strings.Split(line, "\t")
+		}
+	}
+
+	// Columns which can't be cut further, colored ones
+	stuck := make(map[int]bool)
+	for {
+		var columns []int
+		for _, cells := range rows {
+			for i, cell := range cells {
+				if i >= len(columns) {
+					columns = append(columns, 0)
+				}
+				columns[i] = max(columns[i], cellWidth(cell))
+			}
+		}
+
+		excess := 0
+		for _, cells := range rows {
+			total := 0
+			for i := range cells {
+				if i < len(cells)-1 {
+					total += columns[i] + 2
+				} else {
+					total += cellWidth(cells[i])
+				}
+			}
+			excess = max(excess, total-width)
+		}
+		if excess <= 0 {
+			break
+		}
+
+		widest := -1
+		for i, w := range columns {
+			if w > tableMinColumn && !stuck[i] && (widest < 0 || w > columns[widest]) {
+				widest = i
+			}
+		}
+		if widest < 0 {
+			break
+		}
+
+		limit := max(columns[widest]-excess, tableMinColumn)
+		stuck[widest] = true
+		for _, cells := range rows {
+			if widest < len(cells) && cellWidth(cells[widest]) > limit {
+				cells[widest] = truncateCell(cells[widest], limit)
+				stuck[widest] = stuck[widest] && cellWidth(cells[widest]) > limit
+			}
+		}
+	}
+
+	for i, cells := range rows {
+		if cells != nil {
+			lines[i] = strings.Join(cells, "\t")
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Cell cut to width with ellipsis, colored cells are kept as they are
+func truncateCell(cell string, width int) string {
+	if strings.Contains(cell, "\x1b") || utf8.RuneCountInString(cell) <= width {
+		return cell
+	}
+	runes := []rune(cell)
+	return string(runes[:width-1]) + "…"
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Functions of -template besides text/template builtins
+var templateFuncs = template.FuncMap{
+	// Duration in milliseconds, {{ms .Duration}}
+	"ms": durationMs,
+
+	// Time in layout of time package, {{.Date | date "2006-01-02"}}
+	"date": func(layout string, t time.Time) string {
+		return t.Format(layout)
+	},
+
+	// Value as JSON, {{json .URL}} quotes and escapes it
+	"json": func(v any) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+
+	// Calculated percentile of metrics, {{percentile 95 .Percentiles}}
+	"percentile": func(p float64, percentiles []Percentile) (time.Duration, error) {
+		for _, percentile := range percentiles {
+			if percentile.P == p {
+				return percentile.Value, nil
+			}
+		}
+		return 0, fmt.Errorf("percentile %s is not calculated (see -percentiles)", percentileLabel(p))
+	},
+
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+}
+
+// Parsing template of -template or -template-file. Missing fields of
+// records are empty instead of "<no value>".
+func parseTemplate(text, file string) (*template.Template, error) {
+	name := "template"
+	if file != "" {
+		if text != "" {
+			return nil, fmt.Errorf("-template and -template-file can't be combined")
+		}
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		text, name = string(data), file
+	}
+
+	return template.New(name).Funcs(templateFuncs).Option("missingkey=zero").Parse(text)
+}
+
+// Executing template, output gets trailing newline when template
+// doesn't end with one
+func executeTemplate(w io.Writer, tmpl *template.Template, buf *bytes.Buffer, data any) error {
+	buf.Reset()
+	if err := tmpl.Execute(buf, data); err != nil {
+		return err
+	}
+	if buf.Len() == 0 || buf.Bytes()[buf.Len()-1] != '\n' {
+		buf.WriteByte('\n')
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// Record writer of -template, record is executed as LogRecord
+// ({{.Date}} {{.Code}} {{.URL}} {{.Fields.user_agent}})
+type templateWriter struct {
+	w    io.Writer
+	tmpl *template.Template
+	buf  bytes.Buffer
+}
+
+func (w *templateWriter) Write(record LogRecord) error {
+	return executeTemplate(w.w, w.tmpl, &w.buf, record)
+}
+
+func (w *templateWriter) Close() error {
+	return nil
+}
@@ -0,0 +1,456 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Columns of CSV feeds, first present one is used
+var (
+	threatValueColumns = []string{"ip", "indicator", "value", "pattern", "ioc", "address"}
+	threatLabelColumns = []string{"labels", "label", "threat", "threat_type", "category", "description", "name"}
+	threatTypeColumns  = []string{"type", "indicator_type"}
+)
+
+// Value of STIX pattern, [ipv4-addr:value = '203.0.113.7']
+var stixAddrPattern = regexp.MustCompile(`-addr:value\s*=\s*'([^']+)'`)
+
+// Loaded threat feed
+type ThreatFeed struct {
+	Name       string `json:"name"`
+	Indicators int    `json:"indicators"`
+
+	// Values which are neither IP nor CIDR range, skipped
+	Invalid int `json:"invalid"`
+}
+
+// Threat-intel IP lists (-threat-feed). Records from listed IPs or
+// ranges get "threat" field with label of indicator, so they can be
+// filtered (-threat-only, field("threat")) and reported (-threats).
+type ThreatFeeds struct {
+	Feeds []ThreatFeed
+
+	ips map[netip.Addr]string
+
+	// Ranges by prefix length, most specific length first
+	ranges map[int]map[netip.Prefix]string
+	bits   []int
+}
+
+// Loading feeds, each is plain text list of IPs and CIDR ranges
+// with optional label after them (# comments) or CSV with header,
+// like STIX-lite exports with type, value and labels columns. Label
+// of indicators without one is name of feed file. First feed
+// listing IP gives its label.
+func LoadThreatFeeds(files []string) (*ThreatFeeds, error) {
+	t := &ThreatFeeds{ips: make(map[netip.Addr]string), ranges: make(map[int]map[netip.Prefix]string)}
+	for _, file := range files {
+		if err := t.load(file); err != nil {
+			return nil, err
+		}
+	}
+
+	slices.SortFunc(t.bits, func(a, b int) int { return b - a })
+	return t, nil
+}
+
+func (t *ThreatFeeds) load(file string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	name := strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+	feed := ThreatFeed{Name: name}
+
+	var lines []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			lines = append(lines, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("%s: %w", file, err)
+	}
+
+	add := func(value, label string) {
+		if label == "" {
+			label = name
+		}
+		if t.add(value, label) {
+			feed.Indicators++
+		} else {
+			feed.Invalid++
+		}
+	}
+
+	if len(lines) == 0 || !strings.Contains(lines[0], ",") {
+		for _, line := range lines {
+			fields := strings.Fields(line)
+			add(fields[0], strings.Join(fields[1:], " "))
+		}
+		t.Feeds = append(t.Feeds, feed)
+		return nil
+	}
+
+	records, err := csv.NewReader(strings.NewReader(strings.Join(lines, "\n"))).ReadAll()
+	if err != nil {
+		return fmt.Errorf("%s: %w", file, err)
+	}
+
+	// Without header first column is value and second one label
+	valueCol, labelCol, typeCol := 0, 1, -1
+	header := records[0]
+	for i := range header {
+		header[i] = strings.ToLower(strings.TrimSpace(header[i]))
+	}
+	if col := threatColumn(header, threatValueColumns); col >= 0 {
+		valueCol, labelCol, typeCol = col, threatColumn(header, threatLabelColumns), threatColumn(header, threatTypeColumns)
+		records = records[1:]
+	}
+
+	for _, record := range records {
+		if typeCol >= 0 && typeCol < len(record) && !threatAddrType(record[typeCol]) {
+			continue
+		}
+		if valueCol >= len(record) {
+			feed.Invalid++
+			continue
+		}
+
+		var label string
+		if labelCol >= 0 && labelCol < len(record) {
+			label = strings.TrimSpace(record[labelCol])
+		}
+		add(record[valueCol], label)
+	}
+
+	t.Feeds = append(t.Feeds, feed)
+	return nil
+}
+
+// Index of first present column, -1 without any
+func threatColumn(header, names []string) int {
+	for _, name := range names {
+		if i := slices.Index(header, name); i >= 0 {
+			return i
+		}
+	}
+	return -1
+}
+
+// Checking is indicator type IP address or range, rows of domains,
+// hashes and other indicators of same feed are skipped
+func threatAddrType(kind string) bool {
+	kind = strings.ToLower(kind)
+	return kind == "" || strings.Contains(kind, "ip") || strings.Contains(kind, "addr") || strings.Contains(kind, "cidr")
+}
+
+// Adding IP or CIDR range, false for invalid value
+func (t *ThreatFeeds) add(value, label string) bool {
+	value = strings.TrimSpace(value)
+	if m := stixAddrPattern.FindStringSubmatch(value); m != nil {
+		value = m[1]
+	}
+
+	if !strings.Contains(value, "/") {
+		addr, err := netip.ParseAddr(value)
+		if err != nil {
+			return false
+		}
+		if _, ok := t.ips[addr.Unmap()]; !ok {
+			t.ips[addr.Unmap()] = label
+		}
+		return true
+	}
+
+	prefix, err := netip.ParsePrefix(value)
+	if err != nil {
+		return false
+	}
+	prefix = prefix.Masked()
+
+	ranges, ok := t.ranges[prefix.Bits()]
+	if !ok {
+		ranges = make(map[netip.Prefix]string)
+		t.ranges[prefix.Bits()] = ranges
+		t.bits = append(t.bits, prefix.Bits())
+	}
+	if _, ok := ranges[prefix]; !ok {
+		ranges[prefix] = label
+	}
+	return true
+}
+
+// Label of IP, false when it isn't listed
+func (t *ThreatFeeds) Lookup(ip string) (string, bool) {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return "", false
+	}
+	addr = addr.Unmap()
+
+	if label, ok := t.ips[addr]; ok {
+		return label, true
+	}
+	for _, bits := range t.bits {
+		prefix, err := addr.Prefix(bits)
+		if err != nil {
+			continue
+		}
+		if label, ok := t.ranges[bits][prefix]; ok {
+			return label, true
+		}
+	}
+	return "", false
+}
+
+// Setting threat field of record from listed IP, true when it's listed.
+// Called by parsing workers concurrently.
+func (t *ThreatFeeds) Tag(record *LogRecord) bool {
+	label, ok := t.Lookup(record.IP)
+	if !ok {
+		return false
+	}
+	if record.Fields == nil {
+		record.Fields = make(map[string]string)
+	}
+	record.Fields["threat"] = label
+	return true
+}
+
+// Requests of flagged IP
+type ThreatIP struct {
+	IP           string    `json:"ip"`
+	Label        string    `json:"label"`
+	Requests     int       `json:"requests"`
+	ClientErrors int       `json:"client_errors"`
+	Errors       int       `json:"errors"`
+	First        time.Time `json:"first,omitzero"`
+	Last         time.Time `json:"last,omitzero"`
+}
+
+// Requests of flagged IPs to route
+type ThreatRoute struct {
+	Route        string `json:"route"`
+	Requests     int    `json:"requests"`
+	IPs          int    `json:"ips"`
+	ClientErrors int    `json:"client_errors"`
+	Errors       int    `json:"errors"`
+}
+
+// Requests of flagged IPs in interval
+type ThreatBucket struct {
+	Start    time.Time `json:"start"`
+	Requests int       `json:"requests"`
+	IPs      int       `json:"ips"`
+}
+
+// Threat feed report
+type ThreatReport struct {
+	Feeds    []ThreatFeed   `json:"feeds"`
+	Requests int            `json:"requests"`
+	Flagged  int            `json:"flagged"`
+	IPs      []ThreatIP     `json:"ips"`
+	Routes   []ThreatRoute  `json:"routes"`
+	Timeline []ThreatBucket `json:"timeline"`
+}
+
+// Counts of route or interval with IPs seen in it
+type threatCounter struct {
+	requests, clientErrors, errors int
+	ips                            map[string]bool
+}
+
+func (c *threatCounter) add(record LogRecord) {
+	if c.ips == nil {
+		c.ips = make(map[string]bool)
+	}
+	c.requests++
+	c.ips[record.IP] = true
+	switch {
+	case isError(record.Code):
+		c.errors++
+	case record.Code >= 400:
+		c.clientErrors++
+	}
+}
+
+// Requests of flagged IPs per IP, route and interval
+type Threats struct {
+	feeds    *ThreatFeeds
+	interval time.Duration
+	now      time.Time
+	requests int
+
+	ips      map[string]*ThreatIP
+	routes   map[string]*threatCounter
+	timeline map[time.Time]*threatCounter
+}
+
+func NewThreats(feeds *ThreatFeeds, interval time.Duration, now time.Time) *Threats {
+	return &Threats{
+		feeds:    feeds,
+		interval: interval,
+		now:      now,
+		ips:      make(map[string]*ThreatIP),
+		routes:   make(map[string]*threatCounter),
+		timeline: make(map[time.Time]*threatCounter),
+	}
+}
+
+// Adding record, tagged ones are counted as flagged
+func (t *Threats) Add(record LogRecord) {
+	t.requests++
+	label, ok := record.Fields["threat"]
+	if !ok {
+		return
+	}
+
+	ip, ok := t.ips[record.IP]
+	if !ok {
+		ip = &ThreatIP{IP: record.IP, Label: label}
+		t.ips[record.IP] = ip
+	}
+	ip.Requests++
+	switch {
+	case isError(record.Code):
+		ip.Errors++
+	case record.Code >= 400:
+		ip.ClientErrors++
+	}
+
+	key := groupKey(record, "url")
+	route, ok := t.routes[key]
+	if !ok {
+		route = &threatCounter{}
+		t.routes[key] = route
+	}
+	route.add(record)
+
+	if !plausibleTimestamp(record.Date, t.now) {
+		return
+	}
+	if ip.First.IsZero() || record.Date.Before(ip.First) {
+		ip.First = record.Date
+	}
+	if record.Date.After(ip.Last) {
+		ip.Last = record.Date
+	}
+
+	start := record.Date.Truncate(t.interval)
+	bucket, ok := t.timeline[start]
+	if !ok {
+		bucket = &threatCounter{}
+		t.timeline[start] = bucket
+	}
+	bucket.add(record)
+}
+
+// Report of flagged requests, IPs and routes by requests and
+// intervals with flagged requests in time order
+func (t *Threats) Report() ThreatReport {
+	report := ThreatReport{
+		Feeds:    t.feeds.Feeds,
+		Requests: t.requests,
+		IPs:      []ThreatIP{},
+		Routes:   []ThreatRoute{},
+		Timeline: []ThreatBucket{},
+	}
+
+	for _, ip := range t.ips {
+		report.Flagged += ip.Requests
+		report.IPs = append(report.IPs, *ip)
+	}
+	slices.SortFunc(report.IPs, func(a, b ThreatIP) int {
+		if a.Requests != b.Requests {
+			return b.Requests - a.Requests
+		}
+		return strings.Compare(a.IP, b.IP)
+	})
+
+	for route, c := range t.routes {
+		report.Routes = append(report.Routes, ThreatRoute{Route: route, Requests: c.requests, IPs: len(c.ips), ClientErrors: c.clientErrors, Errors: c.errors})
+	}
+	slices.SortFunc(report.Routes, func(a, b ThreatRoute) int {
+		if a.Requests != b.Requests {
+			return b.Requests - a.Requests
+		}
+		return strings.Compare(a.Route, b.Route)
+	})
+
+	for start, c := range t.timeline {
+		report.Timeline = append(report.Timeline, ThreatBucket{Start: start, Requests: c.requests, IPs: len(c.ips)})
+	}
+	slices.SortFunc(report.Timeline, func(a, b ThreatBucket) int { return a.Start.Compare(b.Start) })
+
+	return report
+}
+
+// Threat feed report output
+func printThreats(report ThreatReport, interval time.Duration, locale Locale) {
+	for _, feed := range report.Feeds {
+		fmt.Printf("Feed %s: %s indicators", feed.Name, locale.Int(feed.Indicators))
+		if feed.Invalid > 0 {
+			fmt.Printf(" (%s invalid skipped)", locale.Int(feed.Invalid))
+		}
+		fmt.Println()
+	}
+
+	fmt.Printf("\nRequests: %s\n", locale.Int(report.Requests))
+	if report.Requests == 0 {
+		return
+	}
+	fmt.Printf("From flagged IPs: %s (%s), %s IPs\n",
+		locale.Int(report.Flagged), locale.Percent(float64(report.Flagged)/float64(report.Requests)), locale.Int(len(report.IPs)))
+	if report.Flagged == 0 {
+		return
+	}
+
+	w := newTable(os.Stdout)
+	fmt.Fprintf(w, "\nIP\tLABEL\tREQUESTS\t4XX\t5XX\tFIRST\tLAST\n")
+	for _, ip := range report.IPs {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			ip.IP, ip.Label, locale.Int(ip.Requests), locale.Int(ip.ClientErrors), locale.Int(ip.Errors),
+			threatTime(ip.First, locale), threatTime(ip.Last, locale))
+	}
+	w.Flush()
+
+	w = newTable(os.Stdout)
+	fmt.Fprintf(w, "\nROUTE\tREQUESTS\tIPS\t4XX\t5XX\n")
+	for _, route := range report.Routes {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n",
+			route.Route, locale.Int(route.Requests), locale.Int(route.IPs), locale.Int(route.ClientErrors), locale.Int(route.Errors))
+	}
+	w.Flush()
+
+	if len(report.Timeline) == 0 {
+		return
+	}
+	fmt.Printf("\nPer %v, intervals with flagged requests:\n", interval)
+	w = newTable(os.Stdout)
+	fmt.Fprintf(w, "TIME\tREQUESTS\tIPS\n")
+	for _, bucket := range report.Timeline {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", locale.FormatDateTime(bucket.Start), locale.Int(bucket.Requests), locale.Int(bucket.IPs))
+	}
+	w.Flush()
+}
+
+// Time of report, dash for records without plausible timestamp
+func threatTime(t time.Time, locale Locale) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return locale.FormatDateTime(t)
+}
@@ -0,0 +1,22 @@
+package main
+
+import "time"
+
+// Timestamps before this are treated as clock misconfiguration
+var minPlausibleTime = time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// Allowed skew into the future. Log timestamps carry no zone, so this
+// has to cover the largest UTC offset difference between the log host
+// and the machine running the parser.
+const futureSkew = 26 * time.Hour
+
+// Checking is record timestamp plausible, i.e. not in the future and
+// not before 2000. Implausible records are kept in counts but skipped in
+// time based math.
+func plausibleTimestamp(t time.Time, now time.Time) bool {
+	if t.Before(minPlausibleTime) {
+		return false
+	}
+
+	return !t.After(zonedTime(now).Add(futureSkew))
+}
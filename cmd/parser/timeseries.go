@@ -0,0 +1,152 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Maximal number of buckets in time series
+const maxTimeBuckets = 1000000
+
+// Metrics of one time bucket
+type TimeBucket struct {
+	Start     time.Time     `json:"start"`
+	Count     int           `json:"count"`
+	Errors    int           `json:"errors"`
+	AvgTime   time.Duration `json:"avg_time"`
+	TotalTime time.Duration `json:"-"`
+
+	// Labels of annotations inside bucket
+	Events []string `json:"events,omitempty"`
+}
+
+// Incremental time series with given interval.
+// Only non-empty buckets are kept while reading, gaps are
+// filled when series is built.
+type TimeSeries struct {
+	interval    time.Duration
+	now         time.Time
+	annotations []Annotation
+	buckets     map[time.Time]*TimeBucket
+}
+
+func NewTimeSeries(interval time.Duration, now time.Time, annotations []Annotation) *TimeSeries {
+	return &TimeSeries{
+		interval:    interval,
+		now:         now,
+		annotations: annotations,
+		buckets:     make(map[time.Time]*TimeBucket),
+	}
+}
+
+// Adding record to its bucket, records with implausible
+// timestamps are skipped
+func (s *TimeSeries) Add(record LogRecord) {
+	if !plausibleTimestamp(record.Date, s.now) {
+		return
+	}
+
+	start := record.Date.Truncate(s.interval)
+	bucket, ok := s.buckets[start]
+	if !ok {
+		bucket = &TimeBucket{Start: start}
+		s.buckets[start] = bucket
+	}
+
+	bucket.Count++
+	bucket.TotalTime += record.Duration
+	if isError(record.Code) {
+		bucket.Errors++
+	}
+}
+
+// Buckets from first to last record, including empty ones between.
+// Without records it's empty, not nil, so JSON output is [].
+func (s *TimeSeries) Buckets() ([]TimeBucket, error) {
+	if len(s.buckets) == 0 {
+		return []TimeBucket{}, nil
+	}
+
+	var first, last time.Time
+	for start := range s.buckets {
+		if first.IsZero() || start.Before(first) {
+			first = start
+		}
+		if start.After(last) {
+			last = start
+		}
+	}
+
+	size := int(last.Sub(first)/s.interval) + 1
+	if size > maxTimeBuckets {
+		return nil, fmt.Errorf("%d buckets of %v, use bigger interval", size, s.interval)
+	}
+
+	buckets := make([]TimeBucket, size)
+	for i := range buckets {
+		start := first.Add(time.Duration(i) * s.interval)
+		if bucket, ok := s.buckets[start]; ok {
+			buckets[i] = *bucket
+		} else {
+			buckets[i].Start = start
+		}
+
+		if buckets[i].Count > 0 {
+			buckets[i].AvgTime = buckets[i].TotalTime / time.Duration(buckets[i].Count)
+		}
+		if sampleRate < 1 {
+			buckets[i].Count = scaleCount(buckets[i].Count)
+			buckets[i].Errors = scaleCount(buckets[i].Errors)
+		}
+
+		buckets[i].Events = annotationsBetween(s.annotations, start, start.Add(s.interval))
+	}
+
+	return buckets, nil
+}
+
+// NDJSON time series output
+func printTimeSeriesNDJSON(buckets []TimeBucket) error {
+	enc := json.NewEncoder(os.Stdout)
+	for _, bucket := range buckets {
+		if err := enc.Encode(bucket); err != nil {
+			return fmt.Errorf("encoding JSON: %w", err)
+		}
+	}
+	return nil
+}
+
+// Time series output
+func printTimeSeries(buckets []TimeBucket, locale Locale) {
+	printSampleNote(os.Stdout, locale)
+
+	w := newTable(os.Stdout)
+	defer w.Flush()
+
+	annotated := slices.ContainsFunc(buckets, func(bucket TimeBucket) bool {
+		return len(bucket.Events) > 0
+	})
+
+	fmt.Fprintf(w, "TIME\tCOUNT\tERRORS\tAVG")
+	if annotated {
+		fmt.Fprintf(w, "\tEVENTS")
+	}
+	fmt.Fprintln(w)
+
+	for _, bucket := range buckets {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s",
+			locale.FormatDateTime(bucket.Start),
+			locale.Int(bucket.Count),
+			locale.Int(bucket.Errors),
+			locale.Duration(bucket.AvgTime),
+		)
+		if annotated {
+			fmt.Fprintf(w, "\t%s", strings.Join(bucket.Events, ", "))
+		}
+		fmt.Fprintln(w)
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"cmp"
+	"container/heap"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+)
+
+// Supported -top reports
+var topReports = []string{"slowest", "urls", "ips", "errors"}
+
+// Checking is top report supported
+func validTop(report string) error {
+	if !slices.Contains(topReports, report) {
+		return fmt.Errorf("unknown report %q (supported: %s)", report, strings.Join(topReports, ", "))
+	}
+	return nil
+}
+
+// Tracker of N slowest records, keeps only N records in memory
+type SlowestTracker struct {
+	n       int
+	records slowestHeap
+	seq     int
+}
+
+func NewSlowestTracker(n int) *SlowestTracker {
+	return &SlowestTracker{n: n}
+}
+
+// Adding record, it is kept if it is slower than the fastest tracked one
+func (t *SlowestTracker) Add(record LogRecord) {
+	if t.n <= 0 {
+		return
+	}
+
+	t.seq++
+	entry := slowestEntry{record: record, seq: t.seq}
+
+	if len(t.records) < t.n {
+		heap.Push(&t.records, entry)
+		return
+	}
+
+	if t.records.less(t.records[0], entry) {
+		t.records[0] = entry
+		heap.Fix(&t.records, 0)
+	}
+}
+
+// Tracked records, slowest first, ties in input order
+func (t *SlowestTracker) Records() []LogRecord {
+	entries := slices.Clone(t.records)
+	slices.SortFunc(entries, func(a, b slowestEntry) int {
+		if c := cmp.Compare(b.record.Duration, a.record.Duration); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.seq, b.seq)
+	})
+
+	records := make([]LogRecord, len(entries))
+	for i, entry := range entries {
+		records[i] = entry.record
+	}
+	return records
+}
+
+// Slowest records as table, long URLs are cut to fit terminal like
+// URLs of other tables
+func printSlowest(records []LogRecord, locale Locale) {
+	w := newTable(os.Stdout)
+	defer w.Flush()
+
+	fmt.Fprintf(w, "DATE\tCODE\tDURATION\tIP\tMETHOD\tURL\n")
+	for _, record := range records {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n",
+			locale.FormatDateTime(record.Date),
+			colorize(fmt.Sprint(record.Code), codeColor(record.Code)),
+			colorize(locale.Duration(record.Duration), durationColor(record.Duration)),
+			record.IP,
+			record.Method,
+			record.URL,
+		)
+	}
+}
+
+// Record with input position, so earlier records win ties
+type slowestEntry struct {
+	record LogRecord
+	seq    int
+}
+
+// Min-heap of tracked records, fastest and latest on top
+type slowestHeap []slowestEntry
+
+func (h slowestHeap) less(a, b slowestEntry) bool {
+	if a.record.Duration != b.record.Duration {
+		return a.record.Duration < b.record.Duration
+	}
+	return a.seq > b.seq
+}
+
+func (h slowestHeap) Len() int           { return len(h) }
+func (h slowestHeap) Less(i, j int) bool { return h.less(h[i], h[j]) }
+func (h slowestHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *slowestHeap) Push(x any)        { *h = append(*h, x.(slowestEntry)) }
+
+func (h *slowestHeap) Pop() any {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
+// Group-by key of aggregated top report
+func topGroupBy(report string) string {
+	if report == "ips" {
+		return "ip"
+	}
+	return "url"
+}
+
+// Checking is record counted in aggregated top report
+func topIncludes(report string, record LogRecord) bool {
+	if report == "errors" {
+		return isError(record.Code)
+	}
+	return true
+}
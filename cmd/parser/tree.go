@@ -0,0 +1,147 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Node of URL path tree with requests of its path and every path
+// under it
+type treeNode struct {
+	children  map[string]*treeNode
+	requests  int
+	errors    int
+	time      time.Duration
+	quantiles Quantiles
+}
+
+func newTreeNode() *treeNode {
+	return &treeNode{children: make(map[string]*treeNode)}
+}
+
+func (n *treeNode) add(record LogRecord) {
+	n.requests++
+	n.time += record.Duration
+	if isError(record.Code) {
+		n.errors++
+	}
+	n.quantiles.Add(record.Duration)
+}
+
+// Metrics of path tree node, rolled up from paths under it
+type TreeNode struct {
+	Path        string        `json:"path"`
+	Requests    int           `json:"requests"`
+	Errors      int           `json:"errors"`
+	ErrorRate   float64       `json:"error_rate"`
+	TotalTime   time.Duration `json:"total_time"`
+	AverageTime time.Duration `json:"average_time"`
+	Percentiles []Percentile  `json:"percentiles"`
+	Children    []TreeNode    `json:"children,omitempty"`
+}
+
+// Metrics aggregated by path segments (-tree): /api holds requests
+// of /api/v1 and /api/v1/users, so unfamiliar service can be explored
+// from top. Routes are used when known, so /users/:id is one node
+// instead of one per user.
+type Tree struct {
+	root        *treeNode
+	depth       int
+	percentiles []float64
+}
+
+// Tree of paths up to depth segments deep, 0 has all of them
+func NewTree(depth int, percentiles []float64) *Tree {
+	return &Tree{root: newTreeNode(), depth: depth, percentiles: percentiles}
+}
+
+// Adding record to root and every node of its path
+func (t *Tree) Add(record LogRecord) {
+	path, _, _ := strings.Cut(groupKey(record, "url"), "?")
+	node := t.root
+	node.add(record)
+
+	for i, segment := range strings.Split(strings.Trim(path, "/"), "/") {
+		if segment == "" || t.depth > 0 && i == t.depth {
+			break
+		}
+		child, ok := node.children[segment]
+		if !ok {
+			child = newTreeNode()
+			node.children[segment] = child
+		}
+		child.add(record)
+		node = child
+	}
+}
+
+// Tree from root, children by requests
+func (t *Tree) Report() TreeNode {
+	return t.report("/", t.root)
+}
+
+func (t *Tree) report(path string, node *treeNode) TreeNode {
+	report := TreeNode{
+		Path:      path,
+		Requests:  node.requests,
+		Errors:    node.errors,
+		ErrorRate: ratio(float64(node.errors), float64(node.requests)),
+		TotalTime: node.time,
+	}
+	if node.requests > 0 {
+		report.AverageTime = node.time / time.Duration(node.requests)
+	}
+	for _, p := range t.percentiles {
+		report.Percentiles = append(report.Percentiles, Percentile{P: p, Value: node.quantiles.Quantile(p)})
+	}
+
+	for _, segment := range slices.Sorted(maps.Keys(node.children)) {
+		report.Children = append(report.Children, t.report(strings.TrimSuffix(path, "/")+"/"+segment, node.children[segment]))
+	}
+	slices.SortStableFunc(report.Children, func(a, b TreeNode) int {
+		return cmp.Compare(b.Requests, a.Requests)
+	})
+	return report
+}
+
+// Tree output, each level indented under its parent and named by
+// its last segment
+func printTree(root TreeNode, locale Locale) {
+	w := newTable(os.Stdout)
+	fmt.Fprintf(w, "PATH\tREQUESTS\tERRORS\tERROR RATE\tAVG")
+	for _, p := range root.Percentiles {
+		fmt.Fprintf(w, "\t%s", strings.ToUpper(percentileLabel(p.P)))
+	}
+	fmt.Fprintf(w, "\tTOTAL TIME\n")
+
+	var print func(node TreeNode, level int)
+	print = func(node TreeNode, level int) {
+		name := node.Path
+		if level > 0 {
+			name = "/" + node.Path[strings.LastIndex(node.Path, "/")+1:]
+		}
+		fmt.Fprintf(w, "%s%s\t%s\t%s\t%s\t%s",
+			strings.Repeat("  ", level),
+			name,
+			locale.Int(node.Requests),
+			locale.Int(node.Errors),
+			locale.Percent(node.ErrorRate),
+			locale.Duration(node.AverageTime),
+		)
+		for _, p := range node.Percentiles {
+			fmt.Fprintf(w, "\t%s", locale.Duration(p.Value))
+		}
+		fmt.Fprintf(w, "\t%s\n", locale.Duration(node.TotalTime))
+
+		for _, child := range node.Children {
+			print(child, level+1)
+		}
+	}
+	print(root, 0)
+	w.Flush()
+}
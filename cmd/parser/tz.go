@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+
+	// Zone database for hosts without one (containers, small devices)
+	_ "time/tzdata"
+)
+
+// Zone of zone-less input timestamps (-tz) and zone records are shown
+// in (-display-tz). Both are nil by default, then timestamps are kept
+// as wall-clock times of log host, stored as UTC.
+var inputZone, displayZone *time.Location
+
+// Fixed UTC offset zone, +02:00, -0530 or +3
+var zoneOffset = regexp.MustCompile(`^([+-])(\d{1,2})(?::?(\d{2}))?$`)
+
+// Parsing zone name: IANA name (Europe/Berlin), Local, UTC or offset
+func parseZone(name string) (*time.Location, error) {
+	if m := zoneOffset.FindStringSubmatch(name); m != nil {
+		hours, _ := strconv.Atoi(m[2])
+		minutes, _ := strconv.Atoi(m[3])
+		if hours > 14 || minutes > 59 {
+			return nil, fmt.Errorf("invalid offset %q", name)
+		}
+
+		offset := hours*3600 + minutes*60
+		if m[1] == "-" {
+			offset = -offset
+		}
+		return time.FixedZone(name, offset), nil
+	}
+
+	if name == "" {
+		return nil, fmt.Errorf("empty zone")
+	}
+	return time.LoadLocation(name)
+}
+
+// Setting zones of -tz and -display-tz, any of them enables zone
+// aware timestamps. Input zone defaults to local zone, where gin
+// usually writes its logs, display zone to input zone.
+func setZones(input, display string) error {
+	if input == "" && display == "" {
+		return nil
+	}
+
+	var err error
+	inputZone = time.Local
+	if input != "" {
+		if inputZone, err = parseZone(input); err != nil {
+			return fmt.Errorf("-tz: %w", err)
+		}
+	}
+
+	displayZone = inputZone
+	if display != "" {
+		if displayZone, err = parseZone(display); err != nil {
+			return fmt.Errorf("-display-tz: %w", err)
+		}
+	}
+	return nil
+}
+
+// Timestamp carrying zone (nginx, RFC3339, unix time), as instant in
+// display zone or as wall clock of its own zone
+func zonedTime(t time.Time) time.Time {
+	if displayZone == nil {
+		return wallClock(t)
+	}
+	return t.In(displayZone)
+}
+
+// Timestamp without zone (gin, YYYY/MM/DD), parsed as UTC. Its wall
+// clock is read in input zone.
+func localTime(t time.Time) time.Time {
+	if inputZone == nil {
+		return t
+	}
+	return time.Date(t.Year(), t.Month(), t.Day(),
+		t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), inputZone).In(displayZone)
+}
+
+// Zone of zone-less times in flags (-from, -to, -split-at). Records
+// are shown in display zone, so times are typed in it too.
+func flagZone() *time.Location {
+	if displayZone == nil {
+		return time.UTC
+	}
+	return displayZone
+}
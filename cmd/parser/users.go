@@ -0,0 +1,287 @@
+package main
+
+import (
+	"bufio"
+	"cmp"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Field of record with user of -user
+const userField = "user"
+
+// Source of user of record
+type userSource struct {
+	kind, name string
+	re         *regexp.Regexp
+}
+
+// Users of records (-user) taken from first source which has one:
+// field:NAME of extended formats (api_key, user_id), param:NAME of
+// query string or url:REGEX whose first group (or group named user)
+// matches URL. User is kept as user field, so filters, group keys and
+// outputs have it.
+type UserExtractor struct {
+	sources []userSource
+}
+
+// Parsing comma-separated sources, e.g. "field:api_key,param:key"
+func NewUserExtractor(spec string) (*UserExtractor, error) {
+	if spec == "" {
+		return nil, nil
+	}
+
+	e := &UserExtractor{}
+	for _, part := range strings.Split(spec, ",") {
+		kind, name, ok := strings.Cut(strings.TrimSpace(part), ":")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("expected field:NAME, param:NAME or url:REGEX, got %q", part)
+		}
+
+		source := userSource{kind: kind, name: name}
+		switch kind {
+		case "field", "param":
+		case "url":
+			re, err := regexp.Compile(name)
+			if err != nil {
+				return nil, err
+			}
+			if re.NumSubexp() == 0 {
+				return nil, fmt.Errorf("url regex %q has no group of user", name)
+			}
+			source.re = re
+		default:
+			return nil, fmt.Errorf("unknown source %q (supported: field, param, url)", kind)
+		}
+		e.sources = append(e.sources, source)
+	}
+	return e, nil
+}
+
+// Setting user field of record, records without user are left as
+// they are
+func (e *UserExtractor) Tag(record *LogRecord) {
+	for _, source := range e.sources {
+		if user := source.user(*record); user != "" {
+			if record.Fields == nil {
+				record.Fields = make(map[string]string)
+			}
+			record.Fields[userField] = user
+			return
+		}
+	}
+}
+
+func (s userSource) user(record LogRecord) string {
+	switch s.kind {
+	case "field":
+		return record.Fields[s.name]
+	case "param":
+		return paramKey(record, s.name)
+	}
+
+	m := s.re.FindStringSubmatch(record.URL)
+	if m == nil {
+		return ""
+	}
+	if i := s.re.SubexpIndex("user"); i > 0 {
+		return m[i]
+	}
+	return m[1]
+}
+
+// Loading quotas of users, "USER LIMIT" per line, # starts comment
+func loadQuotas(path string) (map[string]int, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	quotas := make(map[string]int)
+	scanner := bufio.NewScanner(file)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%s:%d: expected user and limit", path, n)
+		}
+		limit, err := strconv.Atoi(fields[1])
+		if err != nil || limit <= 0 {
+			return nil, fmt.Errorf("%s:%d: limit must be positive number", path, n)
+		}
+		quotas[fields[0]] = limit
+	}
+	return quotas, scanner.Err()
+}
+
+// Requests of user against quota
+type UserQuota struct {
+	User      string  `json:"user"`
+	Requests  int     `json:"requests"`
+	Errors    int     `json:"errors"`
+	ErrorRate float64 `json:"error_rate"`
+	Quota     int     `json:"quota"`
+
+	// Most requests in one period, start of that period, its share of
+	// quota and number of periods over quota
+	Peak        int       `json:"peak"`
+	PeakAt      time.Time `json:"peak_at,omitzero"`
+	Usage       float64   `json:"usage"`
+	PeriodsOver int       `json:"periods_over"`
+}
+
+// Quota report
+type QuotasReport struct {
+	Period     time.Duration `json:"period"`
+	Users      int           `json:"users"`
+	Requests   int           `json:"requests"`
+	Anonymous  int           `json:"anonymous"`
+	ByRequests []UserQuota   `json:"by_requests"`
+
+	// Users over quota in some period, by usage
+	OverQuota []UserQuota `json:"over_quota"`
+}
+
+// Counts of one user, requests are counted per period
+type userCounter struct {
+	requests, errors int
+	periods          map[time.Time]int
+}
+
+// Requests per user of -user against quota per period (-quotas), with
+// quotas of -quota-file replacing default for their users
+type Quotas struct {
+	n         int
+	limit     int
+	period    time.Duration
+	overrides map[string]int
+	now       time.Time
+
+	requests, anonymous int
+	users               map[string]*userCounter
+}
+
+func NewQuotas(n, limit int, period time.Duration, overrides map[string]int, now time.Time) *Quotas {
+	return &Quotas{n: n, limit: limit, period: period, overrides: overrides, now: now, users: make(map[string]*userCounter)}
+}
+
+// Adding record, records without user are counted as anonymous and
+// records with implausible timestamps aren't counted in periods
+func (q *Quotas) Add(record LogRecord) {
+	q.requests++
+	user := record.Fields[userField]
+	if user == "" {
+		q.anonymous++
+		return
+	}
+
+	counter, ok := q.users[user]
+	if !ok {
+		counter = &userCounter{periods: make(map[time.Time]int)}
+		q.users[user] = counter
+	}
+	counter.requests++
+	if isError(record.Code) {
+		counter.errors++
+	}
+	if plausibleTimestamp(record.Date, q.now) {
+		counter.periods[record.Date.Truncate(q.period)]++
+	}
+}
+
+// Quota of user
+func (q *Quotas) quota(user string) int {
+	if limit, ok := q.overrides[user]; ok {
+		return limit
+	}
+	return q.limit
+}
+
+// Report with top n users by requests and all users over quota
+func (q *Quotas) Report() QuotasReport {
+	report := QuotasReport{Period: q.period, Users: len(q.users), Requests: q.requests, Anonymous: q.anonymous, ByRequests: []UserQuota{}, OverQuota: []UserQuota{}}
+
+	all := make([]UserQuota, 0, len(q.users))
+	for user, counter := range q.users {
+		u := UserQuota{
+			User:      user,
+			Requests:  counter.requests,
+			Errors:    counter.errors,
+			ErrorRate: ratio(float64(counter.errors), float64(counter.requests)),
+			Quota:     q.quota(user),
+		}
+		for start, count := range counter.periods {
+			if count > u.Peak || count == u.Peak && start.Before(u.PeakAt) {
+				u.Peak, u.PeakAt = count, start
+			}
+			if count > u.Quota {
+				u.PeriodsOver++
+			}
+		}
+		u.Usage = ratio(float64(u.Peak), float64(u.Quota))
+		all = append(all, u)
+	}
+
+	slices.SortFunc(all, func(a, b UserQuota) int {
+		return cmp.Or(cmp.Compare(b.Requests, a.Requests), strings.Compare(a.User, b.User))
+	})
+	report.ByRequests = all[:min(len(all), q.n)]
+
+	for _, u := range all {
+		if u.PeriodsOver > 0 {
+			report.OverQuota = append(report.OverQuota, u)
+		}
+	}
+	slices.SortStableFunc(report.OverQuota, func(a, b UserQuota) int {
+		return cmp.Compare(b.Usage, a.Usage)
+	})
+	return report
+}
+
+// Quota report output
+func printQuotas(report QuotasReport, locale Locale) {
+	fmt.Printf("Users: %s (%s requests, %s without user)\n", locale.Int(report.Users), locale.Int(report.Requests), locale.Int(report.Anonymous))
+
+	table := func(title string, users []UserQuota) {
+		fmt.Printf("\n%s:\n", title)
+		if len(users) == 0 {
+			fmt.Println("  none")
+			return
+		}
+
+		w := newTable(os.Stdout)
+		fmt.Fprintf(w, "USER\tREQUESTS\tERRORS\tERROR RATE\tQUOTA\tPEAK\tPEAK AT\tUSAGE\tPERIODS OVER\n")
+		for _, u := range users {
+			peakAt := "-"
+			if !u.PeakAt.IsZero() {
+				peakAt = locale.FormatDateTime(u.PeakAt)
+			}
+
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+				u.User,
+				locale.Int(u.Requests),
+				locale.Int(u.Errors),
+				locale.Percent(u.ErrorRate),
+				locale.Int(u.Quota),
+				locale.Int(u.Peak),
+				peakAt,
+				locale.Percent(u.Usage),
+				locale.Int(u.PeriodsOver),
+			)
+		}
+		w.Flush()
+	}
+
+	table("Top users by requests", report.ByRequests)
+	table(fmt.Sprintf("Users over quota per %v", report.Period), report.OverQuota)
+}
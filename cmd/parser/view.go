@@ -0,0 +1,271 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// Names of views, they are file names too
+var viewName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// Saved view: command with its flags, inputs are given when it's run
+type View struct {
+	Name    string
+	Command string
+	Flags   []string
+}
+
+// Directory of saved views, $GINLOG_VIEWS or views in ginlog
+// directory of user config directory (~/.config/ginlog/views)
+func viewsDir() string {
+	if dir := os.Getenv("GINLOG_VIEWS"); dir != "" {
+		return dir
+	}
+
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return filepath.Join(".ginlog", "views")
+	}
+	return filepath.Join(dir, "ginlog", "views")
+}
+
+// "ginlog view save|run|list|rm ...", returns command line replacing
+// "view run" arguments, other actions return no arguments
+func runView(args []string) ([]string, error) {
+	usage := errors.New("usage: ginlog view save NAME [command] [flags] | run NAME[,NAME...] [flags] [file|url ...] | list | rm NAME")
+	if len(args) == 0 {
+		return nil, usage
+	}
+
+	switch args[0] {
+	case "save":
+		if len(args) < 2 {
+			return nil, usage
+		}
+		view, err := newView(args[1], args[2:])
+		if err != nil {
+			return nil, err
+		}
+		path, err := saveView(view)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(os.Stderr, "Saved view %s to %s\n", view.Name, path)
+		return nil, nil
+
+	case "run":
+		if len(args) < 2 {
+			return nil, usage
+		}
+		return viewCommandLine(strings.Split(args[1], ","), args[2:])
+
+	case "list":
+		return nil, listViews(os.Stdout)
+
+	case "rm":
+		if len(args) != 2 {
+			return nil, usage
+		}
+		if err := checkViewName(args[1]); err != nil {
+			return nil, err
+		}
+		err := os.Remove(filepath.Join(viewsDir(), args[1]+".yaml"))
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("view %q not found in %s", args[1], viewsDir())
+		}
+		return nil, err
+	}
+	return nil, usage
+}
+
+func checkViewName(name string) error {
+	if !viewName.MatchString(name) {
+		return fmt.Errorf("invalid view name %q (letters, digits, dots, dashes and underscores)", name)
+	}
+	return nil
+}
+
+// View of arguments after its name: optional command and its flags.
+// Flags are checked against command, so typos fail when view is
+// saved rather than when it's run.
+func newView(name string, args []string) (View, error) {
+	if err := checkViewName(name); err != nil {
+		return View{}, err
+	}
+
+	view := View{Name: name}
+	if len(args) > 1 {
+		if _, ok := findCommand(args[0] + " " + args[1]); ok {
+			view.Command, args = args[0]+" "+args[1], args[2:]
+		}
+	}
+	if view.Command == "" && len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		if _, ok := findCommand(args[0]); !ok {
+			return View{}, fmt.Errorf("unknown command %q", args[0])
+		}
+		view.Command, args = args[0], args[1:]
+	}
+
+	var o Options
+	fs := flag.NewFlagSet("view", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	if cmd, ok := findCommand(view.Command); ok {
+		cmd.flags(&o, fs)
+		o.presetFlag(fs)
+		o.durationUnitFlag(fs)
+	} else {
+		o.legacyFlags(fs)
+	}
+	if err := fs.Parse(args); err != nil {
+		return View{}, err
+	}
+	if fs.NArg() > 0 {
+		return View{}, fmt.Errorf("views keep flags only, inputs like %q are given to view run", fs.Arg(0))
+	}
+	if len(args) == 0 {
+		return View{}, fmt.Errorf("view %q has no flags", name)
+	}
+
+	view.Flags = args
+	return view, nil
+}
+
+// Writing view file, in subset of YAML like config file:
+//
+//	command: stats
+//	flags:
+//	  - "-class=5xx"
+//	  - "-group-by=url"
+func saveView(view View) (string, error) {
+	dir := viewsDir()
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+
+	path := filepath.Join(dir, view.Name+".yaml")
+	out, err := createAtomic(path, false)
+	if err != nil {
+		return "", err
+	}
+
+	w := bufio.NewWriter(out.File())
+	fmt.Fprintf(w, "# Saved view of ginlog, run with: ginlog view run %s [file|url ...]\n", view.Name)
+	fmt.Fprintf(w, "command: %s\n", strconv.Quote(view.Command))
+	fmt.Fprintf(w, "flags:\n")
+	for _, flag := range view.Flags {
+		fmt.Fprintf(w, "  - %s\n", strconv.Quote(flag))
+	}
+	if err := w.Flush(); err != nil {
+		out.Abort()
+		return "", err
+	}
+	return path, out.Commit()
+}
+
+// Loading view file
+func loadView(name string) (View, error) {
+	if err := checkViewName(name); err != nil {
+		return View{}, err
+	}
+
+	path := filepath.Join(viewsDir(), name+".yaml")
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return View{}, fmt.Errorf("view %q not found in %s", name, viewsDir())
+	}
+	if err != nil {
+		return View{}, err
+	}
+	defer file.Close()
+
+	view := View{Name: name}
+	var section string
+	scanner := bufio.NewScanner(file)
+	for n := 1; scanner.Scan(); n++ {
+		content := strings.TrimSpace(stripYAMLComment(scanner.Text()))
+		if content == "" {
+			continue
+		}
+
+		if item, ok := strings.CutPrefix(content, "- "); ok && section == "flags" {
+			value, err := yamlScalar(item)
+			if err != nil {
+				return View{}, fmt.Errorf("%s:%d: %v", path, n, err)
+			}
+			view.Flags = append(view.Flags, value)
+			continue
+		}
+
+		key, rest, ok := strings.Cut(content, ":")
+		if !ok {
+			return View{}, fmt.Errorf("%s:%d: expected key: value", path, n)
+		}
+		value, err := yamlScalar(rest)
+		if err != nil {
+			return View{}, fmt.Errorf("%s:%d: %v", path, n, err)
+		}
+		section = key
+		if key == "command" {
+			view.Command = value
+		}
+	}
+	return view, scanner.Err()
+}
+
+// Command line of views run one after another, so flags of later
+// views and flags given to view run override earlier ones
+func viewCommandLine(names []string, args []string) ([]string, error) {
+	var command string
+	var flags []string
+	for _, name := range names {
+		view, err := loadView(name)
+		if err != nil {
+			return nil, err
+		}
+		if view.Command != "" && command != "" && view.Command != command {
+			return nil, fmt.Errorf("views of different commands can't be combined (%s is %s, not %s)", name, view.Command, command)
+		}
+		if view.Command != "" {
+			command = view.Command
+		}
+		flags = append(flags, view.Flags...)
+	}
+
+	var line []string
+	if command != "" {
+		line = strings.Fields(command)
+	}
+	return append(append(line, flags...), args...), nil
+}
+
+// Printing saved views
+func listViews(w io.Writer) error {
+	entries, err := os.ReadDir(viewsDir())
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "VIEW\tCOMMAND\tFLAGS\n")
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), ".yaml")
+		if !ok || entry.IsDir() {
+			continue
+		}
+		view, err := loadView(name)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", view.Name, view.Command, strings.Join(view.Flags, " "))
+	}
+	return tw.Flush()
+}
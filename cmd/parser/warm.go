@@ -0,0 +1,60 @@
+package main
+
+import (
+	"bufio"
+	"cmp"
+	"io"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// Outputs of top report
+var topOutputs = []string{"table", "urls"}
+
+// Counts of exact URLs of successful GET requests, for cache warmers
+// and CDN preload jobs (-output urls). Query strings are kept, as
+// caches key on them, and routes are not used.
+type WarmList struct {
+	counts map[string]int
+}
+
+func NewWarmList() *WarmList {
+	return &WarmList{counts: make(map[string]int)}
+}
+
+// Adding record, only GET requests answered without error are worth
+// warming
+func (l *WarmList) Add(record LogRecord) {
+	if record.Method != http.MethodGet || record.Code >= 400 {
+		return
+	}
+	l.counts[record.URL]++
+}
+
+// N most requested URLs, ties by URL so lists of same traffic diff
+// cleanly
+func (l *WarmList) URLs(n int) []string {
+	urls := slices.SortedFunc(maps.Keys(l.counts), func(a, b string) int {
+		if c := cmp.Compare(l.counts[b], l.counts[a]); c != 0 {
+			return c
+		}
+		return strings.Compare(a, b)
+	})
+	if n > 0 && len(urls) > n {
+		urls = urls[:n]
+	}
+	return urls
+}
+
+// Writing URLs one per line, prefixed with base (e.g.
+// https://www.example.com) when preload job needs absolute URLs
+func writeWarmList(w io.Writer, urls []string, base string) error {
+	bw := bufio.NewWriter(w)
+	base = strings.TrimSuffix(base, "/")
+	for _, url := range urls {
+		bw.WriteString(base + url + "\n")
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,163 @@
+// Package ginlogmw provides gin logger middleware writing one JSON
+// object per request, which ginlog reads without loss: exact time and
+// latency, route template, request ID, bytes in and out, user agent.
+//
+//	router := gin.New()
+//	router.Use(ginlogmw.New())
+package ginlogmw
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Context key of request ID, for handlers logging it too
+const RequestIDKey = "request_id"
+
+// Middleware settings, zero values are defaults
+type Config struct {
+	// Log destination, gin.DefaultWriter (stdout) by default
+	Output io.Writer
+
+	// Paths not logged, like gin.LoggerConfig.SkipPaths
+	SkipPaths []string
+
+	// Header with request ID of proxy or client, X-Request-ID by
+	// default. Requests without it get random ID, which is set in
+	// response header.
+	RequestIDHeader string
+}
+
+// Log line of request. Keys are ones ginlog -input json reads
+// into record fields, body_size is response size.
+type entry struct {
+	Time      string `json:"time"`
+	Status    int    `json:"status"`
+	Latency   int64  `json:"latency"`
+	ClientIP  string `json:"client_ip"`
+	Method    string `json:"method"`
+	Path      string `json:"path"`
+	Route     string `json:"route,omitempty"`
+	RequestID string `json:"request_id"`
+	BytesIn   int64  `json:"bytes_in"`
+	BodySize  int    `json:"body_size"`
+	UserAgent string `json:"user_agent,omitempty"`
+	Referer   string `json:"referer,omitempty"`
+	Proto     string `json:"proto"`
+	Error     string `json:"error,omitempty"`
+}
+
+// Middleware with default settings
+func New() gin.HandlerFunc {
+	return NewWithConfig(Config{})
+}
+
+// Middleware with settings
+func NewWithConfig(cfg Config) gin.HandlerFunc {
+	out := cfg.Output
+	if out == nil {
+		out = gin.DefaultWriter
+	}
+	if out == nil {
+		out = os.Stdout
+	}
+
+	header := cfg.RequestIDHeader
+	if header == "" {
+		header = "X-Request-ID"
+	}
+
+	skip := make(map[string]bool, len(cfg.SkipPaths))
+	for _, path := range cfg.SkipPaths {
+		skip[path] = true
+	}
+
+	// Lines of concurrent requests are written whole
+	var mu sync.Mutex
+
+	return func(c *gin.Context) {
+		start := time.Now()
+
+		id := c.GetHeader(header)
+		if id == "" {
+			id = newRequestID()
+			c.Header(header, id)
+		}
+		c.Set(RequestIDKey, id)
+
+		body := &countingReader{r: c.Request.Body}
+		if c.Request.Body != nil {
+			c.Request.Body = body
+		}
+
+		c.Next()
+
+		if skip[c.Request.URL.Path] {
+			return
+		}
+
+		// Body length is known unless request is chunked, then
+		// bytes read by handlers are logged
+		bytesIn := c.Request.ContentLength
+		if bytesIn < 0 {
+			bytesIn = body.n
+		}
+
+		// Like gin logger, time is when request ended
+		end := time.Now()
+		line, err := json.Marshal(entry{
+			Time:      end.Format(time.RFC3339Nano),
+			Status:    c.Writer.Status(),
+			Latency:   int64(end.Sub(start)),
+			ClientIP:  c.ClientIP(),
+			Method:    c.Request.Method,
+			Path:      c.Request.URL.RequestURI(),
+			Route:     c.FullPath(),
+			RequestID: id,
+			BytesIn:   bytesIn,
+			BodySize:  max(c.Writer.Size(), 0),
+			UserAgent: c.Request.UserAgent(),
+			Referer:   c.Request.Referer(),
+			Proto:     c.Request.Proto,
+			Error:     strings.TrimSpace(c.Errors.ByType(gin.ErrorTypePrivate).String()),
+		})
+		if err != nil {
+			return
+		}
+
+		mu.Lock()
+		out.Write(append(line, '\n'))
+		mu.Unlock()
+	}
+}
+
+// Random request ID of 16 hex digits
+func newRequestID() string {
+	var b [8]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// Request body counting bytes read by handlers
+type countingReader struct {
+	r io.ReadCloser
+	n int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.n += int64(n)
+	return n, err
+}
+
+func (r *countingReader) Close() error {
+	return r.r.Close()
+}